@@ -1,5 +1,17 @@
 // В этом файле описываются миграции для базы данных, для их применения нужно запустить
-// go run ./cmd/migrator/main.go --storage-path=<Путь до бд> --migrations-path=<Пусть до миграций>
+// go run ./cmd/migrator/main.go --storage-path=<Путь до бд> --migrations-path=<Пусть до миграций> [команда]
+// Для PostgreSQL: go run ./cmd/migrator/main.go --driver=postgres --dsn=<Строка подключения> --migrations-path=./migrations/postgres [команда]
+//
+// Команды:
+//
+//	up         применить все новые миграции (по умолчанию) и заполнить каноническую форму имён
+//	down N     откатить N последних миграций
+//	goto V     перейти на версию V вверх или вниз
+//	force V    записать версию V и снять dirty, сами миграции не выполняются
+//	version    показать текущую версию
+//	status     показать применённые и ожидающие миграции
+//
+// Перед любой командой мигратор проверяет, что у каждой миграции есть up и down файлы, а версии идут подряд
 package main
 
 import (
@@ -7,43 +19,461 @@ import (
 	"flag"
 	"fmt"
 	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/postgres"
 	_ "github.com/golang-migrate/migrate/v4/database/sqlite3"
-	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/file"
+	"io"
+	"io/fs"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
 )
 
+// Коды выхода
+const (
+	exitOK = 0
+	// Миграция или бд вернули ошибку
+	exitFailed = 1
+	// Неверные флаги, команда или аргументы
+	exitUsage = 2
+	// В каталоге миграций нет down файла или пропущена версия, бд не трогали
+	exitInvalidMigrations = 3
+	// Прошлая миграция упала на середине, нужно поправить бд руками и выполнить force
+	exitDirty = 4
+)
+
+var (
+	errUsage             = errors.New("invalid usage")
+	errInvalidMigrations = errors.New("invalid migrations")
+	errDirty             = errors.New("database is dirty")
+	errUnknownVersion    = errors.New("version is not in migrations")
+)
+
+// Команды и их аргументы
+var commands = map[string]string{
+	"up":      "up",
+	"down":    "down N",
+	"goto":    "goto V",
+	"force":   "force V",
+	"version": "version",
+	"status":  "status",
+}
+
+// Миграция из каталога
+type migration struct {
+	version uint
+	name    string
+}
+
+// Логгер migrate, печатает каждую выполненную миграцию
+type logger struct {
+	verbose bool
+}
+
+func (l logger) Printf(format string, v ...any) {
+	fmt.Printf(format, v...)
+}
+
+func (l logger) Verbose() bool {
+	return l.verbose
+}
+
 func main() {
-	var storagePath, migrationsPath, migrationsTable string
+	os.Exit(run(os.Args[1:]))
+}
+
+func run(args []string) int {
+	var driver, storagePath, dsn, migrationsPath, migrationsTable string
+	var verbose bool
+
+	flags := flag.NewFlagSet("migrator", flag.ContinueOnError)
+
+	flags.StringVar(&driver, "driver", "sqlite", "Storage driver: sqlite or postgres")
+	flags.StringVar(&dsn, "dsn", "", "PostgreSQL connection string, required for postgres driver")
+	flags.StringVar(&storagePath, "storage-path", "", "Path to the sqlite database file, required for sqlite driver")
+	flags.StringVar(&migrationsPath, "migrations-path", "", "Path to a directory containing migration files")
+	flags.StringVar(&migrationsTable, "migrations-table", "migrations", "Name of migrations table")
+	flags.BoolVar(&verbose, "verbose", false, "Print every step of running migrations")
+
+	positional, err := parseArgs(flags, args)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+
+		return exitUsage
+	}
+
+	// Без команды - up, как раньше
+	command := "up"
+	if len(positional) > 0 {
+		command, positional = positional[0], positional[1:]
+	}
+
+	err = execute(command, positional, driver, storagePath, dsn, migrationsPath, migrationsTable, verbose)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", command, err)
+
+		return exitCode(err)
+	}
+
+	return exitOK
+}
+
+// Флаги можно писать и до, и после команды: migrator down 1 --storage-path=...
+func parseArgs(flags *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, err
+		}
+
+		args = flags.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+func exitCode(err error) int {
+	var dirty migrate.ErrDirty
+
+	switch {
+	case errors.Is(err, errUsage):
+		return exitUsage
+	case errors.Is(err, errInvalidMigrations):
+		return exitInvalidMigrations
+	case errors.Is(err, errDirty), errors.As(err, &dirty):
+		return exitDirty
+	default:
+		return exitFailed
+	}
+}
+
+func execute(
+	command string,
+	args []string,
+	driver, storagePath, dsn, migrationsPath, migrationsTable string,
+	verbose bool,
+) error {
+	usage, ok := commands[command]
+	if !ok {
+		return fmt.Errorf("%w: unknown command %q, expected up, down, goto, force, version or status", errUsage, command)
+	}
 
-	flag.StringVar(&storagePath, "storage-path", "", "Path to a directory containing migration files")
-	flag.StringVar(&migrationsPath, "migrations-path", "", "Path to a directory containing migration files")
-	flag.StringVar(&migrationsTable, "migrations-table", "migrations", "Name of migrations table")
-	flag.Parse()
+	argCount := strings.Count(usage, " ")
 
-	if storagePath == "" {
-		panic("storage-path is required")
+	if len(args) != argCount {
+		return fmt.Errorf("%w: expected %q", errUsage, usage)
+	}
+
+	var number uint
+
+	if argCount == 1 {
+		n, err := strconv.ParseUint(args[0], 10, 0)
+		if err != nil {
+			return fmt.Errorf("%w: expected %q with a non-negative number, got %q", errUsage, usage, args[0])
+		}
+
+		number = uint(n)
 	}
 
 	if migrationsPath == "" {
-		panic("migrations-path is required")
+		return fmt.Errorf("%w: migrations-path is required", errUsage)
 	}
 
-	m, err := migrate.New(
-		"file://"+migrationsPath,
-		fmt.Sprintf("sqlite3://%s?x-migrations-table=%s", storagePath, migrationsTable),
-	)
+	databaseURL, err := buildDatabaseURL(driver, storagePath, dsn, migrationsTable)
+	if err != nil {
+		return err
+	}
 
+	src, migrations, err := openMigrations(migrationsPath)
 	if err != nil {
-		panic(err)
+		return err
+	}
+
+	m, err := migrate.NewWithSourceInstance("file", src, databaseURL)
+	if err != nil {
+		_ = src.Close()
+
+		return err
+	}
+	defer m.Close()
+
+	m.Log = logger{verbose: verbose}
+
+	// По Ctrl+C дожидаемся конца текущей миграции, чтобы бд не осталась dirty
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupt)
+
+	go func() {
+		if _, ok := <-interrupt; ok {
+			fmt.Fprintln(os.Stderr, "Stopping after the current migration")
+			m.GracefulStop <- true
+		}
+	}()
+
+	switch command {
+	case "up":
+		if err := migrateAndReport(m, m.Up()); err != nil {
+			return err
+		}
+
+		return canonicalizeUsernames(driver, storagePath, dsn)
+	case "down":
+		if number == 0 {
+			return fmt.Errorf("%w: down expects at least 1 step", errUsage)
+		}
+
+		return migrateAndReport(m, m.Steps(-int(number)))
+	case "goto":
+		if !containsVersion(migrations, number) {
+			return fmt.Errorf("%w: %w: %d", errUsage, errUnknownVersion, number)
+		}
+
+		return migrateAndReport(m, m.Migrate(number))
+	case "force":
+		if !containsVersion(migrations, number) {
+			return fmt.Errorf("%w: %w: %d", errUsage, errUnknownVersion, number)
+		}
+
+		if err := m.Force(int(number)); err != nil {
+			return err
+		}
+
+		fmt.Printf("Forced version %d\n", number)
+
+		return nil
+	case "version":
+		return printVersion(m)
+	default:
+		return printStatus(m, migrations)
 	}
+}
 
-	if err := m.Up(); err != nil {
-		if errors.Is(err, migrate.ErrNoChange) {
-			fmt.Println("No migrations found")
+func buildDatabaseURL(driver, storagePath, dsn, migrationsTable string) (string, error) {
+	switch driver {
+	case "sqlite":
+		if storagePath == "" {
+			return "", fmt.Errorf("%w: storage-path is required", errUsage)
+		}
+
+		return fmt.Sprintf("sqlite3://%s?x-migrations-table=%s", storagePath, migrationsTable), nil
+	case "postgres":
+		if dsn == "" {
+			return "", fmt.Errorf("%w: dsn is required", errUsage)
+		}
+
+		separator := "?"
+		if strings.Contains(dsn, "?") {
+			separator = "&"
+		}
 
-			return
+		return fmt.Sprintf("%s%sx-migrations-table=%s", dsn, separator, migrationsTable), nil
+	default:
+		return "", fmt.Errorf("%w: unknown driver %q", errUsage, driver)
+	}
+}
+
+// Открывает каталог миграций и проверяет его через loadMigrations
+func openMigrations(path string) (source.Driver, []migration, error) {
+	src, err := (&file.File{}).Open("file://" + path)
+	if err != nil {
+		var duplicate source.ErrDuplicateMigration
+		if errors.As(err, &duplicate) {
+			return nil, nil, fmt.Errorf("%w:\n  version %d has more than one %s migration, %s is a duplicate",
+				errInvalidMigrations, duplicate.Version, duplicate.Direction, duplicate.Name())
 		}
 
-		panic(err)
+		return nil, nil, err
 	}
-	fmt.Println("Successfully migrated migrations")
+
+	migrations, err := loadMigrations(src)
+	if err != nil {
+		_ = src.Close()
+
+		return nil, nil, err
+	}
+
+	return src, migrations, nil
+}
+
+// Читает миграции по возрастанию версий и проверяет, что у каждой есть up и down, а версии идут подряд.
+// Сообщает сразу обо всех найденных проблемах
+func loadMigrations(src source.Driver) ([]migration, error) {
+	version, err := src.First()
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: no migration files found", errInvalidMigrations)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []migration
+	var problems []string
+
+	for {
+		name, hasUp, err := readMigration(src.ReadUp, version)
+		if err != nil {
+			return nil, err
+		}
+
+		downName, hasDown, err := readMigration(src.ReadDown, version)
+		if err != nil {
+			return nil, err
+		}
+
+		if !hasUp {
+			name = downName
+			problems = append(problems, fmt.Sprintf("%d_%s has no up migration", version, name))
+		}
+
+		if !hasDown {
+			problems = append(problems, fmt.Sprintf("%d_%s has no down migration", version, name))
+		}
+
+		if len(migrations) > 0 {
+			switch previous := migrations[len(migrations)-1].version; {
+			case version == previous+2:
+				problems = append(problems, fmt.Sprintf("version %d is missing", previous+1))
+			case version > previous+2:
+				problems = append(problems, fmt.Sprintf("versions %d to %d are missing", previous+1, version-1))
+			}
+		}
+
+		migrations = append(migrations, migration{version: version, name: name})
+
+		version, err = src.Next(version)
+		if errors.Is(err, fs.ErrNotExist) {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("%w:\n  %s", errInvalidMigrations, strings.Join(problems, "\n  "))
+	}
+
+	return migrations, nil
+}
+
+func readMigration(read func(version uint) (r io.ReadCloser, identifier string, err error), version uint) (string, bool, error) {
+	r, name, err := read(version)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", false, nil
+	}
+
+	if err != nil {
+		return "", false, err
+	}
+
+	return name, true, r.Close()
+}
+
+func containsVersion(migrations []migration, version uint) bool {
+	return slices.ContainsFunc(migrations, func(m migration) bool {
+		return m.version == version
+	})
+}
+
+func migrateAndReport(m *migrate.Migrate, err error) error {
+	if errors.Is(err, migrate.ErrNoChange) {
+		fmt.Println("No migrations to apply")
+
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	version, _, err := m.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		fmt.Println("Successfully migrated, no migrations applied")
+
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Successfully migrated to version %d\n", version)
+
+	return nil
+}
+
+func printVersion(m *migrate.Migrate) error {
+	version, dirty, err := m.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		fmt.Println("No migrations applied")
+
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if dirty {
+		fmt.Printf("%d (dirty)\n", version)
+
+		return fmt.Errorf("%w at version %d, fix the database and run force", errDirty, version)
+	}
+
+	fmt.Println(version)
+
+	return nil
+}
+
+func printStatus(m *migrate.Migrate, migrations []migration) error {
+	current, dirty, err := m.Version()
+	applied := err == nil
+
+	if err != nil && !errors.Is(err, migrate.ErrNilVersion) {
+		return err
+	}
+
+	for _, migration := range migrations {
+		state := "pending"
+
+		switch {
+		case applied && migration.version == current && dirty:
+			state = "dirty"
+		case applied && migration.version <= current:
+			state = "applied"
+		}
+
+		fmt.Printf("%6d  %-40s %s\n", migration.version, migration.name, state)
+	}
+
+	if !applied {
+		fmt.Println("No migrations applied")
+
+		return nil
+	}
+
+	// Бд мигрирована более новой версией сервиса
+	if !containsVersion(migrations, current) {
+		return fmt.Errorf("%w: database version %d", errUnknownVersion, current)
+	}
+
+	if dirty {
+		return fmt.Errorf("%w at version %d, fix the database and run force", errDirty, current)
+	}
+
+	return nil
 }
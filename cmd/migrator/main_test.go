@@ -0,0 +1,242 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Каталог миграций из файлов с пустым содержимым
+func migrationsDir(t *testing.T, files ...string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+
+	for _, name := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), nil, 0o600))
+	}
+
+	return dir
+}
+
+func TestOpenMigrations(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    []string
+		versions []uint
+		problems []string
+	}{
+		{
+			name:     "valid",
+			files:    []string{"1_init.up.sql", "1_init.down.sql", "2_users.up.sql", "2_users.down.sql", "README.md"},
+			versions: []uint{1, 2},
+		},
+		{
+			name:     "gap",
+			files:    []string{"1_init.up.sql", "1_init.down.sql", "3_apps.up.sql", "3_apps.down.sql", "6_keys.up.sql", "6_keys.down.sql"},
+			problems: []string{"version 2 is missing", "versions 4 to 5 are missing"},
+		},
+		{
+			name:     "missing down",
+			files:    []string{"1_init.up.sql", "1_init.down.sql", "2_users.up.sql"},
+			problems: []string{"2_users has no down migration"},
+		},
+		{
+			name:     "missing up",
+			files:    []string{"1_init.up.sql", "1_init.down.sql", "2_users.down.sql"},
+			problems: []string{"2_users has no up migration"},
+		},
+		{
+			name:     "duplicate version",
+			files:    []string{"1_init.up.sql", "1_init.down.sql", "1_users.up.sql", "1_users.down.sql"},
+			problems: []string{"version 1 has more than one"},
+		},
+		{
+			name:     "empty",
+			files:    []string{"README.md"},
+			problems: []string{"no migration files found"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src, migrations, err := openMigrations(migrationsDir(t, tt.files...))
+
+			if len(tt.problems) > 0 {
+				assert.ErrorIs(t, err, errInvalidMigrations)
+				assert.Equal(t, exitInvalidMigrations, exitCode(err))
+
+				for _, problem := range tt.problems {
+					assert.ErrorContains(t, err, problem)
+				}
+
+				return
+			}
+
+			require.NoError(t, err)
+			defer src.Close()
+
+			versions := make([]uint, 0, len(migrations))
+			for _, m := range migrations {
+				versions = append(versions, m.version)
+			}
+
+			assert.Equal(t, tt.versions, versions)
+		})
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		code int
+	}{
+		{fmt.Errorf("%w: dsn is required", errUsage), exitUsage},
+		{fmt.Errorf("%w: %w: 99", errUsage, errUnknownVersion), exitUsage},
+		{fmt.Errorf("%w:\n  2_users has no down migration", errInvalidMigrations), exitInvalidMigrations},
+		{fmt.Errorf("%w at version 5", errDirty), exitDirty},
+		{migrate.ErrDirty{Version: 5}, exitDirty},
+		{errors.New("no such table"), exitFailed},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.code, exitCode(tt.err), tt.err.Error())
+	}
+}
+
+func TestParseArgs(t *testing.T) {
+	flags := flag.NewFlagSet("migrator", flag.ContinueOnError)
+	path := flags.String("storage-path", "", "")
+	verbose := flags.Bool("verbose", false, "")
+
+	positional, err := parseArgs(flags, []string{"--storage-path=a.db", "down", "2", "--verbose"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"down", "2"}, positional)
+	assert.Equal(t, "a.db", *path)
+	assert.True(t, *verbose)
+
+	_, err = parseArgs(flags, []string{"up", "--unknown"})
+	assert.Error(t, err)
+}
+
+func TestRun(t *testing.T) {
+	const migrations = "../../migrations"
+
+	dbPath := filepath.Join(t.TempDir(), "sso.db")
+
+	migrator := func(args ...string) int {
+		return run(append([]string{"--storage-path=" + dbPath, "--migrations-path=" + migrations}, args...))
+	}
+
+	version := func() (uint, bool) {
+		m, err := migrate.New("file://"+migrations, "sqlite3://"+dbPath+"?x-migrations-table=migrations")
+		require.NoError(t, err)
+		defer m.Close()
+
+		v, dirty, err := m.Version()
+		require.NoError(t, err)
+
+		return v, dirty
+	}
+
+	_, all, err := openMigrations(migrations)
+	require.NoError(t, err)
+
+	latest := all[len(all)-1].version
+
+	// Без команды - up
+	require.Equal(t, exitOK, migrator())
+	v, _ := version()
+	assert.Equal(t, latest, v)
+
+	assert.Equal(t, exitOK, migrator("up"))
+
+	require.Equal(t, exitOK, migrator("down", "2"))
+	v, _ = version()
+	assert.Equal(t, latest-2, v)
+
+	require.Equal(t, exitOK, migrator("goto", "3"))
+	v, _ = version()
+	assert.Equal(t, uint(3), v)
+
+	assert.Equal(t, exitUsage, migrator("goto", "999"))
+	assert.Equal(t, exitUsage, migrator("down", "0"))
+	assert.Equal(t, exitUsage, migrator("down"))
+	assert.Equal(t, exitUsage, migrator("sideways"))
+	assert.Equal(t, exitOK, migrator("status"))
+
+	// Миграция упала на середине: up не идёт дальше, пока версию не поправят через force
+	db, err := sql.Open("sqlite3", dbPath)
+	require.NoError(t, err)
+	_, err = db.Exec("UPDATE migrations SET dirty = 1")
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	assert.Equal(t, exitDirty, migrator("up"))
+	assert.Equal(t, exitDirty, migrator("version"))
+	assert.Equal(t, exitDirty, migrator("status"))
+
+	require.Equal(t, exitOK, migrator("force", "3"))
+	v, dirty := version()
+	assert.Equal(t, uint(3), v)
+	assert.False(t, dirty)
+
+	require.Equal(t, exitOK, migrator("up"))
+	v, _ = version()
+	assert.Equal(t, latest, v)
+
+	// Каталог с пропущенной версией не даёт трогать бд
+	broken := migrationsDir(t, "1_init.up.sql", "1_init.down.sql", "3_apps.up.sql", "3_apps.down.sql")
+	assert.Equal(t, exitInvalidMigrations, run([]string{"--storage-path=" + dbPath, "--migrations-path=" + broken, "down", "1"}))
+
+	v, _ = version()
+	assert.Equal(t, latest, v)
+}
+
+// После up у старых имён сразу есть каноническая форма, а совпадения записаны, не дожидаясь запуска сервиса
+func TestRunCanonicalizesUsernames(t *testing.T) {
+	const migrations = "../../migrations"
+
+	dbPath := filepath.Join(t.TempDir(), "sso.db")
+
+	migrator := func(args ...string) int {
+		return run(append([]string{"--storage-path=" + dbPath, "--migrations-path=" + migrations}, args...))
+	}
+
+	require.Equal(t, exitOK, migrator("goto", "14"))
+
+	db, err := sql.Open("sqlite3", dbPath)
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.Exec("INSERT INTO users(username, pass_hash) VALUES ('Ivan', ''), ('ivan', ''), ('petr', '')")
+	require.NoError(t, err)
+
+	require.Equal(t, exitOK, migrator("up"))
+
+	rows, err := db.Query("SELECT username, COALESCE(username_canonical, '') FROM users ORDER BY id")
+	require.NoError(t, err)
+	defer rows.Close()
+
+	canonical := map[string]string{}
+
+	for rows.Next() {
+		var username, form string
+		require.NoError(t, rows.Scan(&username, &form))
+		canonical[username] = form
+	}
+	require.NoError(t, rows.Err())
+
+	assert.Equal(t, map[string]string{"Ivan": "ivan", "ivan": "", "petr": "petr"}, canonical)
+
+	var collisions int
+	require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM username_collisions").Scan(&collisions))
+	assert.Equal(t, 1, collisions)
+}
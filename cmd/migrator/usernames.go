@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/storage/postgres"
+	"shilka-sso/internal/storage/sqlite"
+)
+
+// Хранилище, в котором заполняется каноническая форма имён
+type usernamesStorage interface {
+	CanonicalizeUsernames(ctx context.Context) ([]models.UsernameCollision, error)
+	Close() error
+}
+
+// Миграция 15 добавляет колонку username_canonical, но саму форму (NFKC, регистр, похожие буквы) sql не посчитать.
+// Поэтому после up мигратор заполняет её сам и сразу сообщает о совпадениях, а не оставляет это первому запуску сервиса
+func canonicalizeUsernames(driver, storagePath, dsn string) error {
+	var (
+		storage usernamesStorage
+		err     error
+	)
+
+	switch driver {
+	case "sqlite":
+		storage, err = sqlite.New(storagePath, sqlite.Config{})
+	default:
+		storage, err = postgres.New(dsn)
+	}
+
+	if err != nil {
+		return fmt.Errorf("open storage to canonicalize usernames: %w", err)
+	}
+	defer storage.Close()
+
+	collisions, err := storage.CanonicalizeUsernames(context.Background())
+	if err != nil {
+		return err
+	}
+
+	for _, collision := range collisions {
+		fmt.Fprintf(os.Stderr, "Username %q of user %d collides with user %d, it only matches exactly\n",
+			collision.Username, collision.UserId, collision.ConflictsWith)
+	}
+
+	return nil
+}
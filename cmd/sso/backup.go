@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/golang-migrate/migrate/v4/source/file"
+	"io/fs"
+	"os"
+	"shilka-sso/internal/config"
+	"shilka-sso/internal/lib/backup"
+	"shilka-sso/internal/storage/sqlite"
+	"slices"
+)
+
+// Копия работающей бд:
+// go run ./cmd/sso backup --config=config/<Название конфига> --out=<Файл копии> [--compress=false] [--key-path=<Файл ключа>]
+func runBackup(args []string) error {
+	flags := flag.NewFlagSet("backup", flag.ExitOnError)
+
+	configPath := flags.String("config", os.Getenv("CONFIG_PATH"), "config file path")
+	out := flags.String("out", "", "Backup file to write")
+	compress := flags.Bool("compress", true, "Compress the backup with gzip, defaults to backup.compress from config")
+	keyPath := flags.String("key-path", "", "Encryption key file, defaults to backup.key_path from config")
+	_ = flags.Parse(args)
+
+	if *out == "" {
+		return errors.New("out is required")
+	}
+
+	cfg, err := loadSQLiteConfig(*configPath)
+	if err != nil {
+		return err
+	}
+
+	opts := backup.Options{Compress: cfg.Backup.Compress}
+
+	if isSet(flags, "compress") {
+		opts.Compress = *compress
+	}
+
+	opts.Key, err = loadKey(*keyPath, cfg.Backup.KeyPath)
+	if err != nil {
+		return err
+	}
+
+	storage, err := sqlite.New(cfg.StoragePath, sqlite.Config{BusyTimeout: cfg.Storage.SQLite.BusyTimeout})
+	if err != nil {
+		return err
+	}
+	defer storage.Close()
+
+	size, err := backup.Create(context.Background(), storage, *out, opts)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Backup written to %s (%d bytes, compressed: %t, encrypted: %t)\n", *out, size, opts.Compress, opts.Key != nil)
+
+	return nil
+}
+
+// Восстановление бд из копии, сервис должен быть остановлен:
+// go run ./cmd/sso restore --config=config/<Название конфига> --in=<Файл копии> --migrations-path=./migrations
+func runRestore(args []string) error {
+	flags := flag.NewFlagSet("restore", flag.ExitOnError)
+
+	configPath := flags.String("config", os.Getenv("CONFIG_PATH"), "config file path")
+	in := flags.String("in", "", "Backup file to restore")
+	migrationsPath := flags.String("migrations-path", "./migrations", "Path to a directory containing migration files")
+	migrationsTable := flags.String("migrations-table", "migrations", "Name of migrations table")
+	keyPath := flags.String("key-path", "", "Encryption key file, defaults to backup.key_path from config")
+	_ = flags.Parse(args)
+
+	if *in == "" {
+		return errors.New("in is required")
+	}
+
+	cfg, err := loadSQLiteConfig(*configPath)
+	if err != nil {
+		return err
+	}
+
+	key, err := loadKey(*keyPath, cfg.Backup.KeyPath)
+	if err != nil {
+		return err
+	}
+
+	versions, err := migrationVersions(*migrationsPath)
+	if err != nil {
+		return err
+	}
+
+	var restored sqlite.Schema
+
+	validate := func(ctx context.Context, path string) error {
+		schema, err := sqlite.Inspect(ctx, path, *migrationsTable)
+		if err != nil {
+			return err
+		}
+
+		if schema.Dirty {
+			return fmt.Errorf("backup has dirty schema version %d", schema.Version)
+		}
+
+		// Копия новее миграций этой версии сервиса или с чужой веткой миграций
+		if !slices.Contains(versions, schema.Version) {
+			return fmt.Errorf("backup schema version %d is not in %s", schema.Version, *migrationsPath)
+		}
+
+		restored = schema
+
+		return nil
+	}
+
+	if err := backup.Restore(context.Background(), *in, cfg.StoragePath, key, validate); err != nil {
+		return err
+	}
+
+	fmt.Printf("Restored %s from %s, schema version %d\n", cfg.StoragePath, *in, restored.Version)
+
+	if latest := versions[len(versions)-1]; restored.Version < latest {
+		fmt.Printf("Backup is behind migrations (latest %d), run the migrator before starting the service\n", latest)
+	}
+
+	return nil
+}
+
+func loadSQLiteConfig(path string) (*config.Config, error) {
+	if path == "" {
+		return nil, errors.New("config file path is empty")
+	}
+
+	cfg := config.MustLoadByPath(path)
+
+	if cfg.Storage.Driver != "sqlite" {
+		return nil, fmt.Errorf("backups are supported only for sqlite storage, use the %s tools instead", cfg.Storage.Driver)
+	}
+
+	if cfg.StoragePath == "" {
+		return nil, errors.New("storage_path is required for sqlite storage")
+	}
+
+	return cfg, nil
+}
+
+// Ключ из флага, а если он не задан - из конфига
+func loadKey(flagPath, configPath string) ([]byte, error) {
+	path := flagPath
+	if path == "" {
+		path = configPath
+	}
+
+	if path == "" {
+		return nil, nil
+	}
+
+	return backup.LoadKey(path)
+}
+
+// Версии миграций в каталоге по возрастанию
+func migrationVersions(path string) ([]uint, error) {
+	source, err := (&file.File{}).Open("file://" + path)
+	if err != nil {
+		return nil, err
+	}
+	defer source.Close()
+
+	version, err := source.First()
+	if err != nil {
+		return nil, fmt.Errorf("no migrations in %s: %w", path, err)
+	}
+
+	versions := []uint{version}
+
+	for {
+		version, err = source.Next(version)
+		if errors.Is(err, fs.ErrNotExist) {
+			return versions, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		versions = append(versions, version)
+	}
+}
+
+func isSet(flags *flag.FlagSet, name string) bool {
+	set := false
+
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+
+	return set
+}
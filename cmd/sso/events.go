@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"shilka-sso/internal/config"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/storage/postgres"
+	"shilka-sso/internal/storage/sqlite"
+	"time"
+)
+
+// Методы бд для разбора недоставляемых событий outbox
+type eventsStorage interface {
+	DeadEvents(ctx context.Context) ([]models.Event, error)
+	ReplayDeadEvent(ctx context.Context, eventID int64) error
+	Close() error
+}
+
+// Недоставляемые события и их повтор:
+// go run ./cmd/sso events --config=config/<Название конфига> [--replay=<id события>] [--replay-all]
+// Без флагов повтора выводит список недоставляемых событий
+func runEvents(args []string) error {
+	flags := flag.NewFlagSet("events", flag.ExitOnError)
+
+	configPath := flags.String("config", os.Getenv("CONFIG_PATH"), "config file path")
+	replay := flags.Int64("replay", 0, "Id of the dead event to return to the outbox queue")
+	replayAll := flags.Bool("replay-all", false, "Return all dead events to the outbox queue")
+	_ = flags.Parse(args)
+
+	if *replay != 0 && *replayAll {
+		return errors.New("replay and replay-all are mutually exclusive")
+	}
+
+	storage, err := openEventsStorage(*configPath)
+	if err != nil {
+		return err
+	}
+	defer storage.Close()
+
+	ctx := context.Background()
+
+	if *replay != 0 {
+		if err := storage.ReplayDeadEvent(ctx, *replay); err != nil {
+			return err
+		}
+
+		fmt.Printf("Event %d returned to the queue\n", *replay)
+
+		return nil
+	}
+
+	events, err := storage.DeadEvents(ctx)
+	if err != nil {
+		return err
+	}
+
+	if !*replayAll {
+		for _, event := range events {
+			fmt.Printf("%d\t%s\t%s\t%d attempts\t%s\n",
+				event.Id, event.Type, event.DeadAt.Format(time.RFC3339), event.Attempts, event.LastError)
+		}
+
+		return nil
+	}
+
+	for _, event := range events {
+		if err := storage.ReplayDeadEvent(ctx, event.Id); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("%d events returned to the queue\n", len(events))
+
+	return nil
+}
+
+// Хранилище в памяти живёт только внутри процесса сервиса, его события отсюда не достать
+func openEventsStorage(configPath string) (eventsStorage, error) {
+	if configPath == "" {
+		return nil, errors.New("config file path is empty")
+	}
+
+	cfg := config.MustLoadByPath(configPath)
+
+	switch cfg.Storage.Driver {
+	case "sqlite":
+		if cfg.StoragePath == "" {
+			return nil, errors.New("storage_path is required for sqlite storage")
+		}
+
+		return sqlite.New(cfg.StoragePath, sqlite.Config{BusyTimeout: cfg.Storage.SQLite.BusyTimeout})
+	case "postgres":
+		if cfg.Storage.DSN == "" {
+			return nil, errors.New("storage.dsn is required for postgres storage")
+		}
+
+		return postgres.New(cfg.Storage.DSN)
+	default:
+		return nil, fmt.Errorf("dead events are not stored for %q storage", cfg.Storage.Driver)
+	}
+}
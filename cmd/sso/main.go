@@ -1,8 +1,11 @@
 // Точка входа в приложение
 // Для запуска приложения go run ./cmd/sso/main.go --config=config/<Название конфига>
+// Резервная копия бд sqlite: go run ./cmd/sso backup --config=<...> --out=<Файл копии>, восстановление: restore
+// Недоставляемые события outbox: go run ./cmd/sso events --config=<...> [--replay=<id>] [--replay-all]
 package main
 
 import (
+	"fmt"
 	"log/slog"
 	"os"
 	"os/signal"
@@ -19,7 +22,25 @@ const (
 	envProd  = "prod"
 )
 
+var commands = map[string]func(args []string) error{
+	"backup":  runBackup,
+	"events":  runEvents,
+	"restore": runRestore,
+}
+
 func main() {
+	// Подкоманды работают с бд без запуска серверов
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			if err := command(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", os.Args[1], err)
+				os.Exit(1)
+			}
+
+			return
+		}
+	}
+
 	// Загружаем конфиг
 	cfg := config.MustLoad()
 
@@ -29,10 +50,11 @@ func main() {
 	log.Info("starting sso")
 
 	// Инициализизируем приложение
-	application := app.New(log, cfg.GRPC.Port, cfg.StoragePath, cfg.TokenTTL)
+	application := app.New(log, cfg)
 
-	// Запускаем сервер
+	// Запускаем серверы
 	go application.GRPCServer.MustRun()
+	go application.HTTPServer.MustRun()
 
 	// Делаем так называемый Graceful stop, приложение остановится только когда завершит последний запрос.
 	stop := make(chan os.Signal, 1)
@@ -40,7 +62,7 @@ func main() {
 
 	<-stop
 
-	application.GRPCServer.Stop()
+	application.Stop()
 }
 
 // Создание логгера
@@ -0,0 +1,207 @@
+// Массовый импорт пользователей из другой системы и выгрузка пользователей:
+// go run ./cmd/users import --config=config/<Название конфига> --format=csv|jsonl|keycloak --in=<Файл> [--dry-run] [--batch-size=500]
+// go run ./cmd/users export --config=config/<Название конфига> --format=csv|jsonl [--out=<Файл>]
+// Код выхода 1 - импорт или выгрузка прерваны, 2 - импорт прошёл, но часть записей не импортирована
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"shilka-sso/internal/config"
+	"shilka-sso/internal/lib/usernames"
+	"shilka-sso/internal/services/bulk"
+	"shilka-sso/internal/storage/postgres"
+	"shilka-sso/internal/storage/sqlite"
+)
+
+// Часть записей не импортирована
+var errRowsFailed = errors.New("some records were not imported")
+
+type storage interface {
+	bulk.Storage
+	Close() error
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, "usage: users import|export [flags]")
+		os.Exit(1)
+	}
+
+	var err error
+
+	switch os.Args[1] {
+	case "import":
+		err = runImport(os.Args[2:])
+	case "export":
+		err = runExport(os.Args[2:])
+	default:
+		err = fmt.Errorf("unknown command %q", os.Args[1])
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", os.Args[1], err)
+
+		if errors.Is(err, errRowsFailed) {
+			os.Exit(2)
+		}
+
+		os.Exit(1)
+	}
+}
+
+func runImport(args []string) error {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+
+	configPath := flags.String("config", os.Getenv("CONFIG_PATH"), "config file path")
+	format := flags.String("format", bulk.FormatCSV, "Input format: csv, jsonl or keycloak")
+	in := flags.String("in", "", "File to import, - for stdin")
+	dryRun := flags.Bool("dry-run", false, "Validate records and report errors without writing to the database")
+	batchSize := flags.Int("batch-size", bulk.DefaultBatchSize, "Number of users written in one transaction")
+	_ = flags.Parse(args)
+
+	if *in == "" {
+		return errors.New("in is required")
+	}
+
+	input := os.Stdin
+
+	if *in != "-" {
+		file, err := os.Open(*in)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		input = file
+	}
+
+	reader, err := bulk.NewReader(*format, input)
+	if err != nil {
+		return err
+	}
+
+	cfg, storage, err := openStorage(*configPath)
+	if err != nil {
+		return err
+	}
+	defer storage.Close()
+
+	report, err := newBulk(cfg, storage).Import(context.Background(), reader, bulk.ImportOptions{
+		DryRun:    *dryRun,
+		BatchSize: *batchSize,
+	})
+
+	for _, rowErr := range report.Errors {
+		fmt.Fprintln(os.Stderr, rowErr)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	verb := "Imported"
+	if *dryRun {
+		verb = "Dry run: would import"
+	}
+
+	fmt.Printf("%s %d of %d users, %d failed, %d with legacy password hashes to upgrade on next login\n",
+		verb, report.Imported, report.Total, report.Failed, report.Upgrade)
+
+	if report.Failed > 0 {
+		return errRowsFailed
+	}
+
+	return nil
+}
+
+func runExport(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+
+	configPath := flags.String("config", os.Getenv("CONFIG_PATH"), "config file path")
+	format := flags.String("format", bulk.FormatCSV, "Output format: csv or jsonl")
+	out := flags.String("out", "", "File to write, stdout if empty")
+	_ = flags.Parse(args)
+
+	var output io.Writer = os.Stdout
+
+	if *out != "" {
+		file, err := os.OpenFile(*out, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		output = file
+	}
+
+	writer, err := bulk.NewWriter(*format, output)
+	if err != nil {
+		return err
+	}
+
+	cfg, storage, err := openStorage(*configPath)
+	if err != nil {
+		return err
+	}
+	defer storage.Close()
+
+	count, err := newBulk(cfg, storage).Export(context.Background(), writer)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Exported %d users\n", count)
+
+	return nil
+}
+
+// Загружает конфиг сервиса и открывает бд из него. Хранилище в памяти живёт только внутри процесса сервиса
+func openStorage(configPath string) (*config.Config, storage, error) {
+	if configPath == "" {
+		return nil, nil, errors.New("config file path is empty")
+	}
+
+	cfg := config.MustLoadByPath(configPath)
+
+	var (
+		s   storage
+		err error
+	)
+
+	switch cfg.Storage.Driver {
+	case "sqlite":
+		if cfg.StoragePath == "" {
+			return nil, nil, errors.New("storage_path is required for sqlite storage")
+		}
+
+		s, err = sqlite.New(cfg.StoragePath, sqlite.Config{BusyTimeout: cfg.Storage.SQLite.BusyTimeout})
+	case "postgres":
+		if cfg.Storage.DSN == "" {
+			return nil, nil, errors.New("storage.dsn is required for postgres storage")
+		}
+
+		s, err = postgres.New(cfg.Storage.DSN)
+	default:
+		return nil, nil, fmt.Errorf("import and export are not supported for %q storage", cfg.Storage.Driver)
+	}
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return cfg, s, nil
+}
+
+// Подробности о каждой записи уже в отчёте, в лог идут только предупреждения и ошибки.
+// Импортированные имена проверяются по тем же правилам, что и при регистрации
+func newBulk(cfg *config.Config, storage storage) *bulk.Bulk {
+	log := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelWarn}))
+
+	return bulk.New(log, storage, usernames.NewPolicy(cfg.Usernames.MinLength, cfg.Usernames.MaxLength, cfg.Usernames.Reserved))
+}
@@ -1,33 +1,445 @@
 package app
 
 import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
 	"log/slog"
+	"net/http"
 	grpcapp "shilka-sso/internal/app/grpc"
+	httpapp "shilka-sso/internal/app/http"
+	"shilka-sso/internal/config"
+	"shilka-sso/internal/domain/models"
+	oauthhttp "shilka-sso/internal/http/oauth"
+	"shilka-sso/internal/lib/backup"
+	"shilka-sso/internal/lib/keys"
+	"shilka-sso/internal/lib/logger/sl"
+	"shilka-sso/internal/lib/usernames"
+	"shilka-sso/internal/services/apps"
+	"shilka-sso/internal/services/audit"
 	"shilka-sso/internal/services/auth"
+	"shilka-sso/internal/services/auth/ldap"
+	"shilka-sso/internal/services/backups"
+	"shilka-sso/internal/services/device"
+	"shilka-sso/internal/services/federation"
+	"shilka-sso/internal/services/oauth"
+	"shilka-sso/internal/services/outbox"
+	"shilka-sso/internal/services/outbox/publisher"
+	"shilka-sso/internal/services/passkeys"
+	"shilka-sso/internal/services/passwordless"
+	"shilka-sso/internal/services/passwordless/notifier"
+	"shilka-sso/internal/services/personaltokens"
+	"shilka-sso/internal/services/privacy"
+	"shilka-sso/internal/services/profile"
+	"shilka-sso/internal/services/serviceaccounts"
+	"shilka-sso/internal/services/users"
+	"shilka-sso/internal/services/webhooks"
+	"shilka-sso/internal/storage/cache"
+	"shilka-sso/internal/storage/memory"
+	"shilka-sso/internal/storage/postgres"
 	"shilka-sso/internal/storage/sqlite"
+	"sync"
 	"time"
 )
 
+// Storage методы хранилища, которые нужны всем сервисам приложения
+type Storage interface {
+	auth.DbServices
+	auth.UserGetter
+	audit.Storage
+	users.Storage
+	privacy.Storage
+	apps.Storage
+	serviceaccounts.Storage
+	device.Storage
+	passwordless.Storage
+	profile.Storage
+	passkeys.Storage
+	personaltokens.Storage
+	oauth.Storage
+	federation.Storage
+	webhooks.Storage
+	outbox.Storage
+	ldap.Storage
+
+	CanonicalizeUsernames(ctx context.Context) ([]models.UsernameCollision, error)
+	Close() error
+}
+
 type App struct {
 	GRPCServer *grpcapp.App
+	HTTPServer *httpapp.App
+
+	log       *slog.Logger
+	publisher outbox.Publisher
+	storage   Storage
+
+	// Фоновые задачи приложения и функция для их остановки
+	background     sync.WaitGroup
+	stopBackground context.CancelFunc
 }
 
 func New(
 	log *slog.Logger,
-	grpcPort int,
-	storagePath string,
-	tokenTTl time.Duration,
+	cfg *config.Config,
 ) *App {
-	storage, err := sqlite.New(storagePath)
+	backend, err := newStorage(cfg)
+	if err != nil {
+		panic(err)
+	}
+
+	storageCache := cache.New(backend, cache.Config{
+		Apps:  cache.EntityConfig{Size: cfg.Storage.Cache.Apps.Size, TTL: cfg.Storage.Cache.Apps.TTL},
+		Roles: cache.EntityConfig{Size: cfg.Storage.Cache.Roles.Size, TTL: cfg.Storage.Cache.Roles.TTL},
+	})
+
+	var storage Storage = &cachedStorage{Storage: backend, cache: storageCache}
+
+	if expvar.Get("storage_cache") == nil {
+		expvar.Publish("storage_cache", expvar.Func(func() any { return storageCache.Stats() }))
+	}
+
+	signingKey, err := keys.LoadOrGenerate(cfg.SigningKeyPath)
+	if err != nil {
+		panic(err)
+	}
+
+	eventPublisher, err := newPublisher(log, cfg.Events)
+	if err != nil {
+		panic(err)
+	}
+
+	// Обычно форму заполняет cmd/migrator после up. Если миграции применялись иначе, старые имена получают её здесь
+	collisions, err := storage.CanonicalizeUsernames(context.Background())
+	if err != nil {
+		panic(err)
+	}
+
+	for _, collision := range collisions {
+		log.Warn("Username collides with another user, it only matches exactly",
+			slog.Int64("userID", collision.UserId),
+			slog.String("username", collision.Username),
+			slog.Int64("conflictsWith", collision.ConflictsWith),
+		)
+	}
+
+	auditService := audit.New(log, storage, signingKey)
+
+	usernamePolicy := usernames.NewPolicy(cfg.Usernames.MinLength, cfg.Usernames.MaxLength, cfg.Usernames.Reserved)
+
+	authenticators := []auth.Authenticator{auth.NewLocal(log, storage)}
+
+	if cfg.LDAP.Enabled {
+		directory, err := ldap.New(log, storage, usernamePolicy, ldap.Config{
+			URL:            cfg.LDAP.URL,
+			StartTLS:       cfg.LDAP.StartTLS,
+			BindDN:         cfg.LDAP.BindDN,
+			BindPassword:   cfg.LDAP.BindPassword,
+			BaseDN:         cfg.LDAP.BaseDN,
+			UserFilter:     cfg.LDAP.UserFilter,
+			GroupAttribute: cfg.LDAP.GroupAttribute,
+			GroupRoles:     cfg.LDAP.GroupRoles,
+			Links:          cfg.LDAP.Links,
+			EmailAttribute: cfg.LDAP.EmailAttribute,
+			Timeout:        cfg.LDAP.Timeout,
+		})
+		if err != nil {
+			panic(err)
+		}
+
+		authenticators = append(authenticators, directory)
+	}
+
+	authService := auth.New(log, storage, auditService, cfg.TokenTTL, usernamePolicy, signingKey, authenticators...)
+
+	usersService := users.New(log, storage, auditService)
+
+	privacyService := privacy.New(log, storage, auditService, cfg.Erasure.GracePeriod)
+
+	appsService := apps.New(log, storage)
+
+	backupsService, err := newBackups(log, backend, auditService, cfg.Backup)
 	if err != nil {
 		panic(err)
 	}
 
-	authService := auth.New(log, storage, tokenTTl)
+	serviceAccountsService := serviceaccounts.New(log, storage, auditService, cfg.TokenTTL)
+
+	deviceService := device.New(
+		log,
+		authService,
+		storage,
+		cfg.OAuth.DeviceCodeTTL,
+		cfg.OAuth.DevicePollInterval,
+		cfg.TokenTTL,
+	)
+
+	codeNotifier, err := newNotifier(log, cfg.Passwordless)
+	if err != nil {
+		panic(err)
+	}
+
+	passwordlessService := passwordless.New(
+		log,
+		storage,
+		auditService,
+		codeNotifier,
+		cfg.Passwordless.CodeTTL,
+		cfg.Passwordless.MaxAttempts,
+		cfg.Passwordless.LinkURL,
+		cfg.TokenTTL,
+	)
+
+	profileService := profile.New(
+		log,
+		storage,
+		auditService,
+		codeNotifier,
+		usernamePolicy,
+		cfg.Profile.CodeTTL,
+		cfg.Profile.MaxAttempts,
+	)
+
+	passkeysService := passkeys.New(
+		log,
+		storage,
+		auditService,
+		authService,
+		cfg.Passkeys.SessionTTL,
+		cfg.TokenTTL,
+	)
+
+	// Личные токены принимаются везде, где проверяются токены доступа
+	personalTokensService := personaltokens.New(
+		log,
+		storage,
+		auditService,
+		authService,
+		cfg.PersonalTokens.DefaultTTL,
+		cfg.PersonalTokens.MaxTTL,
+	)
 
-	grpcApp := grpcapp.New(log, authService, grpcPort)
+	oauthService := oauth.New(
+		log,
+		authService,
+		personalTokensService,
+		storage,
+		signingKey,
+		cfg.OAuth.Issuer,
+		cfg.OAuth.CodeTTL,
+		cfg.TokenTTL,
+	)
+
+	connectors := make([]federation.Connector, 0, len(cfg.Connectors))
+	for _, c := range cfg.Connectors {
+		connectors = append(connectors, federation.Connector{
+			ID:            c.ID,
+			Name:          c.Name,
+			Issuer:        c.Issuer,
+			ClientID:      c.ClientID,
+			ClientSecret:  c.ClientSecret,
+			Scopes:        c.Scopes,
+			UsernameClaim: c.UsernameClaim,
+			AutoProvision: c.AutoProvision,
+			LinkByEmail:   c.LinkByEmail,
+		})
+	}
+
+	federationService := federation.New(
+		log,
+		oauthService,
+		storage,
+		auditService,
+		usernamePolicy,
+		connectors,
+		cfg.OAuth.Issuer,
+		cfg.OAuth.ConnectorLoginTTL,
+		&http.Client{Timeout: 10 * time.Second},
+	)
+
+	webhooksService := webhooks.New(
+		log,
+		storage,
+		&http.Client{Timeout: cfg.Webhooks.Timeout},
+		cfg.Webhooks.MaxAttempts,
+		cfg.Webhooks.InitialBackoff,
+		cfg.Webhooks.MaxBackoff,
+		cfg.Webhooks.PollInterval,
+		cfg.Webhooks.BatchSize,
+	)
+
+	// События из outbox уходят и в настроенный publisher, и в очередь вебхуков
+	dispatcher := outbox.New(
+		log,
+		storage,
+		publisher.NewMulti(eventPublisher, webhooksService),
+		cfg.Events.MaxAttempts,
+		cfg.Events.InitialBackoff,
+		cfg.Events.MaxBackoff,
+		cfg.Events.PollInterval,
+		cfg.Events.BatchSize,
+	)
+
+	grpcApp := grpcapp.New(log, grpcapp.Services{
+		Auth:            authService,
+		Apps:            appsService,
+		Audit:           auditService,
+		Backups:         backupsService,
+		Device:          deviceService,
+		Users:           usersService,
+		Webhooks:        webhooksService,
+		Tokens:          personalTokensService,
+		ServiceAccounts: serviceAccountsService,
+		PersonalTokens:  personalTokensService,
+		Passwordless:    passwordlessService,
+		Passkeys:        passkeysService,
+		Profile:         profileService,
+		Privacy:         privacyService,
+	}, cfg.GRPC.Port)
+
+	mux := http.NewServeMux()
+	oauthhttp.Register(mux, log, oauthhttp.Services{
+		OAuth:           oauthService,
+		ServiceAccounts: serviceAccountsService,
+		Device:          deviceService,
+		Federation:      federationService,
+	})
+
+	if cfg.HTTP.DebugVars {
+		mux.Handle("GET /debug/vars", expvar.Handler())
+	}
+
+	httpApp := httpapp.New(log, mux, cfg.HTTP.Port)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	a := &App{
+		GRPCServer:     grpcApp,
+		HTTPServer:     httpApp,
+		log:            log,
+		publisher:      eventPublisher,
+		storage:        storage,
+		stopBackground: cancel,
+	}
+
+	a.runBackground(func() { auditService.RunCheckpoints(ctx, cfg.Audit.CheckpointInterval) })
+	a.runBackground(func() { dispatcher.Run(ctx) })
+	a.runBackground(func() { webhooksService.Run(ctx) })
+	a.runBackground(func() { usersService.RunReactivation(ctx, cfg.Users.ReactivationInterval) })
+	a.runBackground(func() { privacyService.RunErasure(ctx, cfg.Erasure.Interval) })
+
+	return a
+}
+
+// Stop Останавливает gRPC и HTTP серверы, а затем фоновые задачи
+func (a *App) Stop() {
+	a.GRPCServer.Stop()
+
+	if err := a.HTTPServer.Stop(); err != nil {
+		a.log.Error("Failed to stop HTTP server", sl.Err(err))
+	}
+
+	a.stopBackground()
+	a.background.Wait()
+
+	if err := a.publisher.Close(); err != nil {
+		a.log.Error("Failed to close event publisher", sl.Err(err))
+	}
+
+	if err := a.storage.Close(); err != nil {
+		a.log.Error("Failed to close storage", sl.Err(err))
+	}
+}
+
+func (a *App) runBackground(task func()) {
+	a.background.Add(1)
+
+	go func() {
+		defer a.background.Done()
+
+		task()
+	}()
+}
+
+// Создаёт хранилище, указанное в конфиге
+func newStorage(cfg *config.Config) (Storage, error) {
+	switch cfg.Storage.Driver {
+	case "sqlite":
+		if cfg.StoragePath == "" {
+			return nil, errors.New("storage_path is required for sqlite storage")
+		}
+
+		return sqlite.New(cfg.StoragePath, sqlite.Config{
+			JournalMode:  cfg.Storage.SQLite.JournalMode,
+			BusyTimeout:  cfg.Storage.SQLite.BusyTimeout,
+			Synchronous:  cfg.Storage.SQLite.Synchronous,
+			MaxOpenConns: cfg.Storage.SQLite.MaxOpenConns,
+			MaxIdleConns: cfg.Storage.SQLite.MaxIdleConns,
+		})
+	case "postgres":
+		if cfg.Storage.DSN == "" {
+			return nil, errors.New("storage.dsn is required for postgres storage")
+		}
+
+		return postgres.New(cfg.Storage.DSN)
+	case "memory":
+		apps := make([]models.App, 0, len(cfg.Storage.Apps))
+		for _, app := range cfg.Storage.Apps {
+			apps = append(apps, models.App{
+				Id:           app.ID,
+				Name:         app.Name,
+				Secret:       app.Secret,
+				RedirectURIs: app.RedirectURIs,
+				Scopes:       app.Scopes,
+			})
+		}
+
+		return memory.New(apps...)
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", cfg.Storage.Driver)
+	}
+}
+
+// Создаёт сервис резервных копий. Снимки на ходу умеет делать только sqlite
+func newBackups(log *slog.Logger, storage Storage, auditor backups.Auditor, cfg config.BackupConfig) (*backups.Backups, error) {
+	opts := backup.Options{Compress: cfg.Compress}
+
+	if cfg.KeyPath != "" {
+		key, err := backup.LoadKey(cfg.KeyPath)
+		if err != nil {
+			return nil, err
+		}
+
+		opts.Key = key
+	}
+
+	snapshotter, _ := storage.(backup.Snapshotter)
+
+	return backups.New(log, snapshotter, auditor, cfg.Dir, opts), nil
+}
+
+// Создаёт publisher доменных событий, указанный в конфиге
+func newPublisher(log *slog.Logger, cfg config.EventsConfig) (outbox.Publisher, error) {
+	switch cfg.Publisher {
+	case "log":
+		return publisher.NewLog(log), nil
+	case "file":
+		return publisher.NewFile(cfg.FilePath)
+	case "nats":
+		return publisher.NewNATS(cfg.NATSURL, cfg.NATSSubjectPrefix)
+	default:
+		return nil, fmt.Errorf("unknown events publisher %q", cfg.Publisher)
+	}
+}
 
-	return &App{
-		GRPCServer: grpcApp,
+func newNotifier(log *slog.Logger, cfg config.PasswordlessConfig) (passwordless.Notifier, error) {
+	switch cfg.Notifier {
+	case "log":
+		return notifier.NewLog(log), nil
+	case "smtp":
+		return notifier.NewSMTP(cfg.SMTP.Host, cfg.SMTP.Port, cfg.SMTP.Username, cfg.SMTP.Password, cfg.SMTP.From), nil
+	default:
+		return nil, fmt.Errorf("unknown passwordless notifier %q", cfg.Notifier)
 	}
 }
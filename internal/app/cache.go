@@ -0,0 +1,43 @@
+package app
+
+import (
+	"context"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/storage/cache"
+)
+
+// Хранилище, в котором приложения и права администратора читаются через кэш,
+// а остальные методы идут напрямую в хранилище
+type cachedStorage struct {
+	Storage
+	cache *cache.Storage
+}
+
+// WithinTx Транзакция хранилища, после которой кэш сбрасывает изменённые в ней записи
+func (s *cachedStorage) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return s.cache.WithinTx(ctx, fn)
+}
+
+func (s *cachedStorage) GetApp(ctx context.Context, appID int) (models.App, error) {
+	return s.cache.GetApp(ctx, appID)
+}
+
+func (s *cachedStorage) SetAppRedirectURIs(ctx context.Context, appID int, redirectURIs []string) error {
+	return s.cache.SetAppRedirectURIs(ctx, appID, redirectURIs)
+}
+
+func (s *cachedStorage) SetAppScopes(ctx context.Context, appID int, scopes []string) error {
+	return s.cache.SetAppScopes(ctx, appID, scopes)
+}
+
+func (s *cachedStorage) IsAdmin(ctx context.Context, userID int64) (bool, error) {
+	return s.cache.IsAdmin(ctx, userID)
+}
+
+func (s *cachedStorage) SetAdmin(ctx context.Context, userID int64, isAdmin bool) error {
+	return s.cache.SetAdmin(ctx, userID, isAdmin)
+}
+
+func (s *cachedStorage) EraseUser(ctx context.Context, userID int64, auditRecordIDs []int64, erased models.AuditRecord) error {
+	return s.cache.EraseUser(ctx, userID, auditRecordIDs, erased)
+}
@@ -5,7 +5,20 @@ import (
 	"google.golang.org/grpc"
 	"log/slog"
 	"net"
+	appsgrpc "shilka-sso/internal/grpc/apps"
+	auditgrpc "shilka-sso/internal/grpc/audit"
 	authgrpc "shilka-sso/internal/grpc/auth"
+	backupsgrpc "shilka-sso/internal/grpc/backups"
+	devicegrpc "shilka-sso/internal/grpc/device"
+	"shilka-sso/internal/grpc/middleware"
+	passkeysgrpc "shilka-sso/internal/grpc/passkeys"
+	passwordlessgrpc "shilka-sso/internal/grpc/passwordless"
+	personaltokensgrpc "shilka-sso/internal/grpc/personaltokens"
+	privacygrpc "shilka-sso/internal/grpc/privacy"
+	profilegrpc "shilka-sso/internal/grpc/profile"
+	serviceaccountsgrpc "shilka-sso/internal/grpc/serviceaccounts"
+	usersgrpc "shilka-sso/internal/grpc/users"
+	webhooksgrpc "shilka-sso/internal/grpc/webhooks"
 )
 
 type App struct {
@@ -14,14 +27,57 @@ type App struct {
 	port       int
 }
 
+// Services сервисы, методы которых доступны по gRPC
+type Services struct {
+	Auth            authgrpc.Auth
+	Apps            appsgrpc.Apps
+	Audit           auditgrpc.Audit
+	Backups         backupsgrpc.Backups
+	Device          devicegrpc.Device
+	Users           usersgrpc.Users
+	Webhooks        webhooksgrpc.Webhooks
+	Tokens          middleware.TokenValidator
+	ServiceAccounts serviceaccountsgrpc.ServiceAccounts
+	PersonalTokens  personaltokensgrpc.PersonalTokens
+	Passwordless    passwordlessgrpc.Passwordless
+	Passkeys        passkeysgrpc.Passkeys
+	Profile         profilegrpc.Profile
+	Privacy         privacygrpc.Privacy
+}
+
+// Сервисы, доступные только администраторам
+var adminServices = []string{
+	"/apps.Apps/",
+	"/audit.Audit/",
+	"/backups.Backups/",
+	"/privacy.Privacy/",
+	"/serviceaccounts.ServiceAccounts/",
+	"/users.Users/",
+	"/webhooks.Webhooks/",
+}
+
 func New(
 	log *slog.Logger,
-	authService authgrpc.Auth,
+	services Services,
 	port int,
 ) *App {
-	gRPCServer := grpc.NewServer()
-
-	authgrpc.RegisterServer(gRPCServer, authService)
+	gRPCServer := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(middleware.Auth(services.Tokens, adminServices...)),
+	)
+
+	authgrpc.RegisterServer(gRPCServer, services.Auth)
+	appsgrpc.RegisterServer(gRPCServer, services.Apps)
+	auditgrpc.RegisterServer(gRPCServer, services.Audit)
+	backupsgrpc.RegisterServer(gRPCServer, services.Backups)
+	devicegrpc.RegisterServer(gRPCServer, services.Device)
+	passkeysgrpc.RegisterServer(gRPCServer, services.Passkeys)
+	passwordlessgrpc.RegisterServer(gRPCServer, services.Passwordless)
+	personaltokensgrpc.RegisterServer(gRPCServer, services.PersonalTokens)
+	privacygrpc.RegisterServer(gRPCServer, services.Privacy)
+	profilegrpc.RegisterServer(gRPCServer, services.Profile)
+	serviceaccountsgrpc.RegisterServer(gRPCServer, services.ServiceAccounts)
+	usersgrpc.RegisterServer(gRPCServer, services.Users)
+	webhooksgrpc.RegisterServer(gRPCServer, services.Webhooks)
 
 	return &App{
 		log:        log,
@@ -0,0 +1,84 @@
+package httpapp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Сколько ждём завершения текущих запросов при остановке
+const shutdownTimeout = 10 * time.Second
+
+type App struct {
+	log        *slog.Logger
+	httpServer *http.Server
+	port       int
+}
+
+func New(
+	log *slog.Logger,
+	handler http.Handler,
+	port int,
+) *App {
+	return &App{
+		log: log,
+		httpServer: &http.Server{
+			Handler:           handler,
+			ReadHeaderTimeout: 10 * time.Second,
+		},
+		port: port,
+	}
+}
+
+// MustRun Запускает сервер и роняет приложение если сервер не запускается
+func (a *App) MustRun() {
+	if err := a.Run(); err != nil {
+		panic(err)
+	}
+}
+
+// Run Запускает HTTP сервер
+func (a *App) Run() error {
+	const operation = "httpApp.Run"
+
+	log := a.log.With(slog.String("operation", operation),
+		slog.Int("port", a.port))
+
+	log.Info("starting HTTP server")
+
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", a.port))
+
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	log.Info("HTTP server started", slog.String("address", lis.Addr().String()))
+
+	if err := a.httpServer.Serve(lis); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return nil
+}
+
+// Stop сервер выполняет оставшиеся запросы а затем останавливается
+func (a *App) Stop() error {
+	const operation = "httpApp.Stop"
+
+	a.log.With(slog.String("operation", operation)).Info("stopping HTTP server", slog.Int("port", a.port))
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := a.httpServer.Shutdown(ctx); err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	a.log.Info("HTTP server stopped", slog.Int("port", a.port))
+
+	return nil
+}
@@ -1,8 +1,37 @@
 package models
 
+import (
+	"slices"
+	"strings"
+)
+
 // App структура, описывающая приложение
+// RedirectURIs - адреса, на которые можно вернуть пользователя после входа через OAuth,
+// Scopes - scope, которые приложение может запрашивать, пустой список разрешает только openid и profile
 type App struct {
-	Id     int
-	Name   string
-	Secret string
+	Id           int
+	Name         string
+	Secret       string
+	RedirectURIs []string
+	Scopes       []string
+}
+
+// DefaultAppScopes scope, которые может запрашивать приложение без своего списка scope
+var DefaultAppScopes = []string{"openid", "profile"}
+
+// DisallowedScope Возвращает первый из запрошенных через пробел scope, который приложению запрашивать нельзя
+// ok false, если разрешены все
+func (a App) DisallowedScope(scope string) (string, bool) {
+	allowed := a.Scopes
+	if len(allowed) == 0 {
+		allowed = DefaultAppScopes
+	}
+
+	for _, name := range strings.Fields(scope) {
+		if !slices.Contains(allowed, name) {
+			return name, true
+		}
+	}
+
+	return "", false
 }
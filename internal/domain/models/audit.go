@@ -0,0 +1,72 @@
+package models
+
+import "time"
+
+// AuditRecord запись журнала аудита
+// PrevHash - хэш предыдущей записи, Hash - хэш содержимого записи вместе с PrevHash
+type AuditRecord struct {
+	Id        int64
+	Event     string
+	UserId    int64
+	AppId     int
+	Payload   string
+	CreatedAt time.Time
+	PrevHash  []byte
+	Hash      []byte
+	// FieldSalts соли персональных полей Payload. После удаления данных значение поля заменяется его хэшем,
+	// а соль - nil. У записей, написанных до появления солей, nil вся карта
+	FieldSalts map[string][]byte
+	// Когда из Payload убрали персональные данные при удалении пользователя.
+	// Запись с FieldSalts по-прежнему сходится со своим Hash, более старая подтверждается только записью user.erased
+	RedactedAt time.Time
+}
+
+// AuditCheckpoint подписанная ключом сервера отметка о состоянии цепочки аудита
+type AuditCheckpoint struct {
+	Id        int64
+	RecordId  int64
+	Hash      []byte
+	Signature []byte
+	CreatedAt time.Time
+}
+
+// События, которые пишутся в журнал аудита
+const (
+	AuditUserRegistered  = "user.registered"
+	AuditLoginSucceeded  = "user.login_succeeded"
+	AuditLoginFailed     = "user.login_failed"
+	AuditRoleChanged     = "user.role_changed"
+	AuditUserRenamed     = "user.renamed"
+	AuditStatusChanged   = "user.status_changed"
+	AuditPasswordChanged = "user.password_changed"
+
+	AuditDataExported     = "user.data_exported"
+	AuditErasureRequested = "user.erasure_requested"
+	AuditErasureCancelled = "user.erasure_cancelled"
+	AuditUserErased       = "user.erased"
+
+	AuditIdentifierVerified = "identifier.verified"
+	AuditIdentifierRemoved  = "identifier.removed"
+
+	AuditServiceAccountCreated = "service_account.created"
+	AuditServiceAccountDeleted = "service_account.deleted"
+
+	AuditPersonalTokenCreated = "personal_token.created"
+	AuditPersonalTokenRevoked = "personal_token.revoked"
+
+	AuditPasskeyRegistered = "passkey.registered"
+	AuditPasskeyDeleted    = "passkey.deleted"
+
+	AuditBackupCreated = "backup.created"
+)
+
+// AuditRedactedRecordsField поле записи user.erased со списком id записей, из которых убраны персональные данные
+const AuditRedactedRecordsField = "redacted_records"
+
+// AuditLegacyRecordsField поле записи user.erased с теми из redacted_records, что написаны без FieldSalts.
+// Только такие записи после удаления данных не сверяются с хэшем
+const AuditLegacyRecordsField = "legacy_records"
+
+// AuditPersonalFields поля Payload записей аудита, в которых бывают персональные данные.
+// При удалении пользователя их значения заменяются хэшами, в записях без FieldSalts - псевдонимом
+var AuditPersonalFields = []string{"username", "value", "name", "reason"}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// Backup резервная копия бд в каталоге копий
+type Backup struct {
+	// Имя файла в каталоге копий
+	Name       string
+	Size       int64
+	CreatedAt  time.Time
+	Compressed bool
+	Encrypted  bool
+}
@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// Статусы кода устройства
+const (
+	DeviceCodePending  = "pending"
+	DeviceCodeApproved = "approved"
+	DeviceCodeDenied   = "denied"
+	// Токен по коду уже выдан
+	DeviceCodeConsumed = "consumed"
+)
+
+// DeviceCode запрос на вход устройства без браузера (RFC 8628)
+// Устройство опрашивает сервер по device code, пользователь подтверждает вход по короткому user code
+// В бд хранится только хэш device code
+type DeviceCode struct {
+	DeviceCodeHash string
+	UserCode       string
+	AppId          int
+	Scope          string
+	Status         string
+	// Пользователь, который подтвердил или отклонил вход
+	UserId int64
+	// Минимальный интервал между опросами, увеличивается при slow_down
+	Interval     time.Duration
+	LastPolledAt time.Time
+	ExpiresAt    time.Time
+	CreatedAt    time.Time
+}
@@ -0,0 +1,47 @@
+package models
+
+import "time"
+
+// Event доменное событие, которое через outbox отправляется другим сервисам
+// Доставка происходит минимум один раз, поэтому получатели должны отбрасывать повторы по Id
+type Event struct {
+	Id        int64
+	Type      string
+	Payload   []byte
+	CreatedAt time.Time
+	Attempts  int
+	// Раньше этого времени неудавшееся событие не публикуется повторно
+	NextAttemptAt time.Time
+	LastError     string
+	// Когда событие стало недоставляемым, нулевое у событий в очереди
+	DeadAt time.Time
+}
+
+// Типы доменных событий
+const (
+	EventUserRegistered  = "user.registered"
+	EventUserDisabled    = "user.disabled"
+	EventUserEnabled     = "user.enabled"
+	EventUserDeleted     = "user.deleted"
+	EventUserRoleChanged = "user.role_changed"
+	EventUserRenamed     = "user.renamed"
+)
+
+// EventTypes все типы доменных событий
+var EventTypes = []string{
+	EventUserRegistered,
+	EventUserDisabled,
+	EventUserEnabled,
+	EventUserDeleted,
+	EventUserRoleChanged,
+	EventUserRenamed,
+}
+
+// UserEventPayload данные событий о пользователе
+type UserEventPayload struct {
+	UserId   int64  `json:"user_id"`
+	Username string `json:"username,omitempty"`
+	IsAdmin  *bool  `json:"is_admin,omitempty"`
+	Status   string `json:"status,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// FederatedIdentity связь пользователя sso с пользователем внешнего провайдера OpenID Connect
+// Subject - sub пользователя у провайдера, он не меняется в отличие от имени и почты
+type FederatedIdentity struct {
+	ConnectorId string
+	Subject     string
+	UserId      int64
+	CreatedAt   time.Time
+}
+
+// ConnectorState незавершённый вход через внешний провайдер
+// Request - параметры исходного запроса /authorize в JSON, по ним после входа выдаётся код приложению
+type ConnectorState struct {
+	StateHash    string
+	ConnectorId  string
+	Nonce        string
+	CodeVerifier string
+	Request      []byte
+	ExpiresAt    time.Time
+}
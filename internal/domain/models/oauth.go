@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// AuthCode код авторизации OAuth, который приложение меняет на токен
+// В бд хранится только хэш кода
+type AuthCode struct {
+	CodeHash      string
+	AppId         int
+	UserId        int64
+	RedirectURI   string
+	CodeChallenge string
+	Scope         string
+	// Nonce из запроса OpenID Connect, возвращается клиенту в ID токене
+	Nonce string
+	// Когда пользователь ввёл пароль
+	AuthTime  time.Time
+	ExpiresAt time.Time
+	CreatedAt time.Time
+}
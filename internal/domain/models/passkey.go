@@ -0,0 +1,50 @@
+package models
+
+import "time"
+
+// RelyingParty настройки WebAuthn приложения
+// RPID - домен, к которому привязаны ключи, Origins - адреса страниц, с которых разрешены церемонии
+type RelyingParty struct {
+	AppId   int
+	RPID    string
+	Name    string
+	Origins []string
+}
+
+// Passkey ключ WebAuthn пользователя
+// SignCount - последнее значение счётчика подписей, по нему обнаруживаются клоны ключа
+type Passkey struct {
+	Id              int64
+	UserId          int64
+	RPID            string
+	CredentialId    []byte
+	PublicKey       []byte
+	AttestationType string
+	AAGUID          []byte
+	SignCount       uint32
+	Transports      []string
+	BackupEligible  bool
+	Name            string
+	CreatedAt       time.Time
+	LastUsedAt      time.Time
+}
+
+// Церемонии WebAuthn
+const (
+	PasskeyRegistration = "registration"
+	PasskeyLogin        = "login"
+)
+
+// PasskeySession начатая церемония WebAuthn
+// UserId равен 0 у входа, в котором пользователя определяет сам ключ.
+// PasswordVerified - пароль уже проверен, и ключ используется как второй фактор
+type PasskeySession struct {
+	Id               string
+	Ceremony         string
+	UserId           int64
+	AppId            int
+	PasswordVerified bool
+	// Данные сессии библиотеки WebAuthn в JSON
+	Data      []byte
+	ExpiresAt time.Time
+}
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// Способы доставки одноразового кода входа без пароля
+const (
+	// PasswordlessCode шестизначный код, который пользователь вводит сам
+	PasswordlessCode = "code"
+	// PasswordlessLink длинный код внутри ссылки
+	PasswordlessLink = "link"
+)
+
+// PasswordlessChallenge незавершённый вход без пароля
+// Код одноразовый и действует только для приложения AppId, в бд хранится его хэш
+type PasswordlessChallenge struct {
+	Id        string
+	UserId    int64
+	AppId     int
+	Method    string
+	CodeHash  string
+	Attempts  int
+	ExpiresAt time.Time
+	CreatedAt time.Time
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// PersonalToken токен доступа, который пользователь создаёт себе сам для скриптов и утилит
+// В бд хранится только хэш токена, LastUsedAt нулевой, если токеном ещё не пользовались
+type PersonalToken struct {
+	Id         int64
+	UserId     int64
+	Name       string
+	TokenHash  string
+	Scopes     []string
+	CreatedAt  time.Time
+	ExpiresAt  time.Time
+	LastUsedAt time.Time
+}
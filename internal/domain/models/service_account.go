@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// ServiceAccount не человеческий клиент приложения, который получает токены по client credentials
+// В бд хранится только хэш секрета, Scopes - scope, которые аккаунту разрешено запрашивать
+type ServiceAccount struct {
+	Id         int64
+	AppId      int
+	Name       string
+	ClientId   string
+	SecretHash string
+	Scopes     []string
+	CreatedAt  time.Time
+}
@@ -1,7 +1,159 @@
 package models
 
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
 type User struct {
 	Id           int64
 	Username     string
 	PasswordHash []byte
+	// Статус учётной записи и причина, по которой он выставлен
+	Status       string
+	StatusReason string
+	// До какого момента действует приостановка, нулевой - бессрочно
+	SuspendedUntil time.Time
+}
+
+// Статусы учётной записи
+const (
+	AccountActive    = "active"
+	AccountSuspended = "suspended"
+	AccountDisabled  = "disabled"
+	// AccountPending учётная запись ещё не одобрена
+	AccountPending = "pending"
+	// AccountErased данные пользователя удалены, от учётной записи остался только id
+	AccountErased = "erased"
+)
+
+// Ошибки статуса учётной записи, общие для всех способов входа и проверки токенов
+// Все они оборачивают ErrAccountInactive
+var (
+	ErrAccountInactive  = errors.New("account is not active")
+	ErrAccountSuspended = fmt.Errorf("%w: suspended", ErrAccountInactive)
+	ErrAccountDisabled  = fmt.Errorf("%w: disabled", ErrAccountInactive)
+	ErrAccountPending   = fmt.Errorf("%w: pending", ErrAccountInactive)
+)
+
+// InactiveAccountError Ошибка CheckActive со статусом учётной записи и сроком приостановки
+// Оборачивает ErrAccountSuspended, ErrAccountDisabled или ErrAccountPending, поэтому проверяется через errors.Is
+type InactiveAccountError struct {
+	// Status один из AccountSuspended, AccountDisabled и AccountPending
+	Status string
+	// До какого момента действует приостановка, нулевой - бессрочно или статус не suspended
+	SuspendedUntil time.Time
+}
+
+func (e *InactiveAccountError) Error() string {
+	return e.Unwrap().Error()
+}
+
+func (e *InactiveAccountError) Unwrap() error {
+	switch e.Status {
+	case AccountSuspended:
+		return ErrAccountSuspended
+	case AccountPending:
+		return ErrAccountPending
+	}
+
+	return ErrAccountDisabled
+}
+
+// CheckActive Возвращает *InactiveAccountError, если пользователю сейчас нельзя входить и пользоваться токенами
+// Приостановка с истёкшим SuspendedUntil уже не действует, даже если фоновая задача ещё не вернула статус active
+func (u User) CheckActive(now time.Time) error {
+	switch u.Status {
+	case AccountActive, "":
+		return nil
+	case AccountSuspended:
+		if !u.SuspendedUntil.IsZero() && !now.Before(u.SuspendedUntil) {
+			return nil
+		}
+
+		return &InactiveAccountError{Status: AccountSuspended, SuspendedUntil: u.SuspendedUntil}
+	case AccountPending:
+		return &InactiveAccountError{Status: AccountPending}
+	}
+
+	return &InactiveAccountError{Status: AccountDisabled}
+}
+
+// AccountStatusChange запись истории статусов учётной записи
+// ActorId - администратор, сменивший статус, 0 если статус вернулся сам по истечении приостановки
+type AccountStatusChange struct {
+	Id             int64
+	UserId         int64
+	Status         string
+	Reason         string
+	SuspendedUntil time.Time
+	ActorId        int64
+	CreatedAt      time.Time
+}
+
+// ErasureRequest запрос на удаление данных пользователя
+// До EraseAt запрос можно отменить, после данные удаляются фоновой задачей
+type ErasureRequest struct {
+	UserId      int64
+	ActorId     int64
+	Reason      string
+	RequestedAt time.Time
+	EraseAt     time.Time
+}
+
+// ErasedUsername Псевдоним, который после удаления данных заменяет имя пользователя в бд и журнале аудита
+func ErasedUsername(userID int64) string {
+	return fmt.Sprintf("erased-%d", userID)
+}
+
+// UsernameCollision пользователь, чьё имя в канонической форме совпало с именем другого пользователя
+// Такие имена остались с тех пор, когда имена сравнивались посимвольно
+type UsernameCollision struct {
+	UserId        int64
+	Username      string
+	Canonical     string
+	ConflictsWith int64
+	DetectedAt    time.Time
+}
+
+// Виды идентификаторов, по которым пользователь входит
+const (
+	IdentifierUsername = "username"
+	IdentifierEmail    = "email"
+	IdentifierPhone    = "phone"
+)
+
+// Identifier почта или телефон пользователя
+// Входить по идентификатору можно только после подтверждения кодом, до этого VerifiedAt нулевой.
+// В бд хранится хэш кода подтверждения, попытки и срок его действия
+type Identifier struct {
+	UserId        int64
+	Kind          string
+	Value         string
+	Canonical     string
+	VerifiedAt    time.Time
+	CodeHash      string
+	Attempts      int
+	CodeExpiresAt time.Time
+	CreatedAt     time.Time
+}
+
+// Verified подтверждён ли идентификатор
+func (i Identifier) Verified() bool {
+	return !i.VerifiedAt.IsZero()
+}
+
+// Profile имя пользователя вместе с его почтой и телефоном
+type Profile struct {
+	UserId      int64
+	Username    string
+	Identifiers []Identifier
+}
+
+// ProfileUpdate изменения профиля. nil оставляет поле как есть, пустая строка удаляет почту или телефон
+type ProfileUpdate struct {
+	Username *string
+	Email    *string
+	Phone    *string
 }
@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// Webhook адрес приложения, на который отправляются события одного типа
+type Webhook struct {
+	Id        int64
+	AppId     int
+	EventType string
+	URL       string
+	CreatedAt time.Time
+}
+
+// Статусы доставки вебхука
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliveryDelivered = "delivered"
+	WebhookDeliveryDead      = "dead"
+)
+
+// WebhookDelivery попытка доставить одно событие на один вебхук
+// URL и Secret подтягиваются из вебхука и приложения, чтобы подписать и отправить запрос
+type WebhookDelivery struct {
+	Id            int64
+	WebhookId     int64
+	AppId         int
+	URL           string
+	Secret        string
+	EventId       int64
+	EventType     string
+	Body          []byte
+	Status        string
+	Attempts      int
+	LastError     string
+	NextAttemptAt time.Time
+	CreatedAt     time.Time
+}
@@ -0,0 +1,103 @@
+package apps
+
+import (
+	"context"
+	"errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"shilka-sso/internal/services/apps"
+	appsv1 "shilka-sso/protos/gen/go/apps"
+)
+
+// Apps методы, которые необходимо реализовать хэндлерам
+type Apps interface {
+	SetRedirectURIs(ctx context.Context, appID int, redirectURIs []string) error
+	SetScopes(ctx context.Context, appID int, scopes []string) error
+	SetRelyingParty(ctx context.Context, appID int, rpID string, name string, origins []string) error
+}
+
+type ServerAPI struct {
+	appsv1.UnimplementedAppsServer
+	apps Apps
+}
+
+// RegisterServer Регистрирует сервер с методами, описанными в Apps interface
+func RegisterServer(gRPC *grpc.Server, apps Apps) {
+	appsv1.RegisterAppsServer(gRPC, &ServerAPI{apps: apps})
+}
+
+const (
+	emptyValue = 0
+)
+
+func (s *ServerAPI) SetRedirectURIs(ctx context.Context, req *appsv1.SetRedirectURIsRequest) (*appsv1.SetRedirectURIsResponse, error) {
+
+	// Валидация
+	if req.GetAppId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "appId is empty")
+	}
+
+	if err := s.apps.SetRedirectURIs(ctx, int(req.GetAppId()), req.GetRedirectUris()); err != nil {
+		if errors.Is(err, apps.ErrInvalidRedirectURI) {
+			return nil, status.Error(codes.InvalidArgument, "redirect uri must be absolute and without fragment")
+		}
+
+		if errors.Is(err, apps.ErrAppNotFound) {
+			return nil, status.Error(codes.NotFound, "app not found")
+		}
+
+		return nil, status.Errorf(codes.Internal, "internal error")
+	}
+
+	return &appsv1.SetRedirectURIsResponse{}, nil
+}
+
+func (s *ServerAPI) SetScopes(ctx context.Context, req *appsv1.SetScopesRequest) (*appsv1.SetScopesResponse, error) {
+
+	// Валидация
+	if req.GetAppId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "appId is empty")
+	}
+
+	if err := s.apps.SetScopes(ctx, int(req.GetAppId()), req.GetScopes()); err != nil {
+		if errors.Is(err, apps.ErrInvalidScope) {
+			return nil, status.Error(codes.InvalidArgument, "scope must be non-empty and contain no spaces")
+		}
+
+		if errors.Is(err, apps.ErrAppNotFound) {
+			return nil, status.Error(codes.NotFound, "app not found")
+		}
+
+		return nil, status.Errorf(codes.Internal, "internal error")
+	}
+
+	return &appsv1.SetScopesResponse{}, nil
+}
+
+func (s *ServerAPI) SetRelyingParty(ctx context.Context, req *appsv1.SetRelyingPartyRequest) (*appsv1.SetRelyingPartyResponse, error) {
+
+	// Валидация
+	if req.GetAppId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "appId is empty")
+	}
+
+	if req.GetRpId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "rpId is empty")
+	}
+
+	err := s.apps.SetRelyingParty(ctx, int(req.GetAppId()), req.GetRpId(), req.GetName(), req.GetOrigins())
+	if err != nil {
+		if errors.Is(err, apps.ErrInvalidRelyingParty) {
+			return nil, status.Error(codes.InvalidArgument, "rpId must be a host name and origins must be https urls on it")
+		}
+
+		if errors.Is(err, apps.ErrAppNotFound) {
+			return nil, status.Error(codes.NotFound, "app not found")
+		}
+
+		return nil, status.Errorf(codes.Internal, "internal error")
+	}
+
+	return &appsv1.SetRelyingPartyResponse{}, nil
+}
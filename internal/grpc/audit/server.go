@@ -0,0 +1,44 @@
+package audit
+
+import (
+	"context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"shilka-sso/internal/services/audit"
+	auditv1 "shilka-sso/protos/gen/go/audit"
+)
+
+// Audit методы, которые необходимо реализовать хэндлерам
+type Audit interface {
+	VerifyChain(ctx context.Context) (audit.Report, error)
+}
+
+type ServerAPI struct {
+	auditv1.UnimplementedAuditServer
+	audit Audit
+}
+
+// RegisterServer Регистрирует сервер с методами, описанными в Audit interface
+func RegisterServer(gRPC *grpc.Server, audit Audit) {
+	auditv1.RegisterAuditServer(gRPC, &ServerAPI{audit: audit})
+}
+
+func (s *ServerAPI) VerifyAuditChain(
+	ctx context.Context,
+	req *auditv1.VerifyAuditChainRequest,
+) (*auditv1.VerifyAuditChainResponse, error) {
+	report, err := s.audit.VerifyChain(ctx)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "internal error")
+	}
+
+	return &auditv1.VerifyAuditChainResponse{
+		Ok:                 report.Ok,
+		RecordsChecked:     report.RecordsChecked,
+		CheckpointsChecked: report.CheckpointsChecked,
+		RecordsRedacted:    report.RecordsRedacted,
+		BrokenRecordId:     report.BrokenRecordId,
+		Reason:             report.Reason,
+	}, nil
+}
@@ -7,6 +7,8 @@ import (
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"shilka-sso/internal/grpc/middleware"
+	"shilka-sso/internal/lib/usernames"
 	"shilka-sso/internal/services/auth"
 )
 
@@ -58,6 +60,15 @@ func (s *ServerAPI) Login(ctx context.Context, req *ssov1.LoginRequest) (*ssov1.
 			return nil, status.Error(codes.InvalidArgument, "invalid credentials")
 		}
 
+		// Имя из каталога занято пользователем sso, которого администратор не связал с каталогом
+		if errors.Is(err, auth.ErrUserExists) {
+			return nil, status.Error(codes.FailedPrecondition, "username is taken by an account that is not linked to the directory")
+		}
+
+		if statusErr, ok := middleware.AccountStatusError(err); ok {
+			return nil, statusErr
+		}
+
 		return nil, status.Errorf(codes.Internal, "internal error")
 	}
 
@@ -80,6 +91,11 @@ func (s *ServerAPI) Register(ctx context.Context, req *ssov1.RegisterRequest) (*
 		if errors.Is(err, auth.ErrUserExists) {
 			return nil, status.Error(codes.AlreadyExists, "user already exists")
 		}
+
+		if errors.Is(err, auth.ErrInvalidUsername) {
+			return nil, status.Error(codes.InvalidArgument, usernames.Reason(err))
+		}
+
 		return nil, status.Errorf(codes.Internal, "internal error")
 	}
 
@@ -124,8 +140,9 @@ func validateLogin(req *ssov1.LoginRequest) error {
 		return status.Errorf(codes.InvalidArgument, "password is required")
 	}
 
-	if req.GetAppId() == emptyValue {
-		return status.Errorf(codes.InvalidArgument, "appId is required")
+	// appId 0 (auth.AdminAppID) - вход в API самого sso
+	if req.GetAppId() < emptyValue {
+		return status.Errorf(codes.InvalidArgument, "appId must not be negative")
 	}
 
 	return nil
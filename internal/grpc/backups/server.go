@@ -0,0 +1,52 @@
+package backups
+
+import (
+	"context"
+	"errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/grpc/middleware"
+	"shilka-sso/internal/services/backups"
+	backupsv1 "shilka-sso/protos/gen/go/backups"
+)
+
+// Backups методы, которые необходимо реализовать хэндлерам
+type Backups interface {
+	Create(ctx context.Context, actorID int64) (models.Backup, error)
+}
+
+type ServerAPI struct {
+	backupsv1.UnimplementedBackupsServer
+	backups Backups
+}
+
+// RegisterServer Регистрирует сервер с методами, описанными в Backups interface
+func RegisterServer(gRPC *grpc.Server, backups Backups) {
+	backupsv1.RegisterBackupsServer(gRPC, &ServerAPI{backups: backups})
+}
+
+func (s *ServerAPI) CreateBackup(
+	ctx context.Context,
+	req *backupsv1.CreateBackupRequest,
+) (*backupsv1.CreateBackupResponse, error) {
+	claims, _ := middleware.ClaimsFromContext(ctx)
+
+	backup, err := s.backups.Create(ctx, claims.UserID)
+	if err != nil {
+		if errors.Is(err, backups.ErrNotSupported) {
+			return nil, status.Error(codes.Unimplemented, "storage does not support online backups")
+		}
+
+		return nil, status.Errorf(codes.Internal, "internal error")
+	}
+
+	return &backupsv1.CreateBackupResponse{
+		Name:       backup.Name,
+		Size:       backup.Size,
+		CreatedAt:  backup.CreatedAt.Unix(),
+		Compressed: backup.Compressed,
+		Encrypted:  backup.Encrypted,
+	}, nil
+}
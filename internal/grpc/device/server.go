@@ -0,0 +1,84 @@
+package device
+
+import (
+	"context"
+	"errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"shilka-sso/internal/grpc/middleware"
+	"shilka-sso/internal/services/device"
+	devicev1 "shilka-sso/protos/gen/go/device"
+)
+
+// Device методы, которые необходимо реализовать хэндлерам
+type Device interface {
+	Approve(ctx context.Context, userCode string, userID int64) error
+	Deny(ctx context.Context, userCode string, userID int64) error
+}
+
+type ServerAPI struct {
+	devicev1.UnimplementedDeviceServer
+	device Device
+}
+
+// RegisterServer Регистрирует сервер с методами, описанными в Device interface
+func RegisterServer(gRPC *grpc.Server, device Device) {
+	devicev1.RegisterDeviceServer(gRPC, &ServerAPI{device: device})
+}
+
+func (s *ServerAPI) ApproveDevice(
+	ctx context.Context,
+	req *devicev1.ApproveDeviceRequest,
+) (*devicev1.ApproveDeviceResponse, error) {
+	userID, err := validate(ctx, req.GetUserCode())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.device.Approve(ctx, req.GetUserCode(), userID); err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &devicev1.ApproveDeviceResponse{}, nil
+}
+
+func (s *ServerAPI) DenyDevice(
+	ctx context.Context,
+	req *devicev1.DenyDeviceRequest,
+) (*devicev1.DenyDeviceResponse, error) {
+	userID, err := validate(ctx, req.GetUserCode())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.device.Deny(ctx, req.GetUserCode(), userID); err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &devicev1.DenyDeviceResponse{}, nil
+}
+
+// Вход подтверждает пользователь, поэтому нужен токен, который sso выдал ему при входе. Токен приложения
+// приложение может выписать на любого пользователя и так получить токен другого приложения, а по личному
+// токену выдавался бы полный токен без ограничений его scope
+func validate(ctx context.Context, userCode string) (int64, error) {
+	if userCode == "" {
+		return 0, status.Error(codes.InvalidArgument, "userCode is required")
+	}
+
+	claims, err := middleware.SessionClaims(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	return claims.UserID, nil
+}
+
+func toStatus(err error) error {
+	if errors.Is(err, device.ErrInvalidUserCode) {
+		return status.Error(codes.NotFound, "invalid or expired user code")
+	}
+
+	return status.Errorf(codes.Internal, "internal error")
+}
@@ -0,0 +1,177 @@
+// Package middleware Перехватчики gRPC запросов
+package middleware
+
+import (
+	"context"
+	"errors"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/lib/jwt"
+	"strings"
+	"time"
+)
+
+// TokenValidator методы, нужные для проверки токена из запроса
+type TokenValidator interface {
+	ValidateToken(ctx context.Context, token string) (jwt.Claims, error)
+	IsAdmin(ctx context.Context, userID int64) (bool, error)
+}
+
+type claimsKey struct{}
+
+// AccountInactiveReason reason в errdetails.ErrorInfo ошибки неактивной учётной записи
+const AccountInactiveReason = "ACCOUNT_INACTIVE"
+
+// Домен в errdetails.ErrorInfo ошибок sso
+const errorDomain = "shilka-sso"
+
+// AdminScope scope, без которого личный токен администратора не допускается к методам adminServices
+const AdminScope = "admin"
+
+const (
+	authorizationHeader = "authorization"
+	bearerPrefix        = "bearer "
+)
+
+// Auth Проверяет bearer токен из метаданных запроса и кладёт данные из него в контекст
+// Методы сервисов из adminServices (например "/audit.Audit/") доступны только администраторам
+// с токеном для API самого sso (aud jwt.AdminAudience) или с личным токеном со scope AdminScope.
+// Токены приложений и сервисных аккаунтов к ним не допускаются: секрет приложения знает само приложение
+func Auth(validator TokenValidator, adminServices ...string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		adminOnly := false
+		for _, service := range adminServices {
+			if strings.HasPrefix(info.FullMethod, service) {
+				adminOnly = true
+				break
+			}
+		}
+
+		token, ok := bearerToken(ctx)
+		if !ok {
+			if adminOnly {
+				return nil, status.Error(codes.Unauthenticated, "token is required")
+			}
+
+			return handler(ctx, req)
+		}
+
+		claims, err := validator.ValidateToken(ctx, token)
+		if err != nil {
+			if statusErr, ok := AccountStatusError(err); ok {
+				return nil, statusErr
+			}
+
+			return nil, status.Error(codes.Unauthenticated, "invalid token")
+		}
+
+		if adminOnly {
+			if claims.IsServiceAccount() {
+				return nil, status.Error(codes.PermissionDenied, "service account tokens cannot call admin methods")
+			}
+
+			if claims.IsPersonalToken() && !claims.HasScope(AdminScope) {
+				return nil, status.Error(codes.PermissionDenied, "personal token lacks admin scope")
+			}
+
+			if !claims.IsPersonalToken() && !claims.IsAdminAPI() {
+				return nil, status.Error(codes.PermissionDenied, "token was not issued for the sso admin api")
+			}
+
+			isAdmin, err := validator.IsAdmin(ctx, claims.UserID)
+			if err != nil {
+				return nil, status.Error(codes.Internal, "internal error")
+			}
+
+			if !isAdmin {
+				return nil, status.Error(codes.PermissionDenied, "admin rights required")
+			}
+		}
+
+		return handler(context.WithValue(ctx, claimsKey{}, claims), req)
+	}
+}
+
+// AccountStatusError Переводит ошибку статуса учётной записи в FailedPrecondition с названием статуса.
+// Код отличается от PermissionDenied, которым отвечают на нехватку прав. Статус и срок приостановки
+// передаются ещё и в деталях ошибки: errdetails.ErrorInfo с reason AccountInactiveReason и metadata
+// status и suspended_until (RFC 3339, только у приостановки со сроком). ok false, если err не связана со статусом
+func AccountStatusError(err error) (error, bool) {
+	if !errors.Is(err, models.ErrAccountInactive) {
+		return nil, false
+	}
+
+	info := &errdetails.ErrorInfo{
+		Reason:   AccountInactiveReason,
+		Domain:   errorDomain,
+		Metadata: map[string]string{},
+	}
+
+	msg := models.ErrAccountInactive.Error()
+
+	var inactive *models.InactiveAccountError
+	if errors.As(err, &inactive) {
+		msg = inactive.Error()
+		info.Metadata["status"] = inactive.Status
+
+		if !inactive.SuspendedUntil.IsZero() {
+			info.Metadata["suspended_until"] = inactive.SuspendedUntil.UTC().Format(time.RFC3339)
+		}
+	}
+
+	st, detailsErr := status.New(codes.FailedPrecondition, msg).WithDetails(info)
+	if detailsErr != nil {
+		return status.Error(codes.FailedPrecondition, msg), true
+	}
+
+	return st.Err(), true
+}
+
+// SessionClaims Возвращает данные токена, который sso сам выдал пользователю при входе (aud jwt.AdminAudience).
+// Токен приложения здесь не годится: приложение подписывает его своим секретом и может выписать его на любого
+// пользователя. Личные токены и токены сервисных аккаунтов тоже не принимаются
+func SessionClaims(ctx context.Context) (jwt.Claims, error) {
+	claims, ok := ClaimsFromContext(ctx)
+	if !ok || claims.IsServiceAccount() {
+		return claims, status.Error(codes.Unauthenticated, "user token is required")
+	}
+
+	if claims.IsPersonalToken() {
+		return claims, status.Error(codes.PermissionDenied, "personal tokens are not accepted")
+	}
+
+	if !claims.IsAdminAPI() {
+		return claims, status.Error(codes.PermissionDenied, "token issued by sso at login is required")
+	}
+
+	return claims, nil
+}
+
+// ClaimsFromContext Возвращает данные из токена, проверенного перехватчиком Auth
+func ClaimsFromContext(ctx context.Context) (jwt.Claims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(jwt.Claims)
+
+	return claims, ok
+}
+
+func bearerToken(ctx context.Context) (string, bool) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", false
+	}
+
+	values := md.Get(authorizationHeader)
+	if len(values) == 0 {
+		return "", false
+	}
+
+	if len(values[0]) <= len(bearerPrefix) || !strings.EqualFold(values[0][:len(bearerPrefix)], bearerPrefix) {
+		return "", false
+	}
+
+	return values[0][len(bearerPrefix):], true
+}
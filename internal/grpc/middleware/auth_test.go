@@ -0,0 +1,208 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"io"
+	"log/slog"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/lib/jwt"
+	"shilka-sso/internal/lib/usernames"
+	"shilka-sso/internal/services/auth"
+	"shilka-sso/internal/storage/sqlite/sqlitetest"
+	"testing"
+	"time"
+)
+
+// Токены принимаются как есть, админ - пользователь с id 1
+type fakeValidator map[string]jwt.Claims
+
+func (v fakeValidator) ValidateToken(_ context.Context, token string) (jwt.Claims, error) {
+	claims, ok := v[token]
+	if !ok {
+		return jwt.Claims{}, jwt.ErrInvalidToken
+	}
+
+	return claims, nil
+}
+
+func (v fakeValidator) IsAdmin(_ context.Context, userID int64) (bool, error) {
+	return userID == 1, nil
+}
+
+func call(t *testing.T, method string, token string) error {
+	t.Helper()
+
+	validator := fakeValidator{
+		"admin":     {UserID: 1, Audience: jwt.AdminAudience},
+		"admin-app": {UserID: 1, AppID: 1},
+		"user":      {UserID: 2, Audience: jwt.AdminAudience},
+		"service":   {ServiceAccountID: 1},
+		"pat":       {UserID: 1, PersonalTokenID: 1, Scope: "read"},
+		"pat-adm":   {UserID: 1, PersonalTokenID: 2, Scope: "read admin"},
+	}
+
+	return callWith(t, validator, method, token)
+}
+
+func callWith(t *testing.T, validator TokenValidator, method string, token string) error {
+	t.Helper()
+
+	ctx := context.Background()
+	if token != "" {
+		ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(authorizationHeader, "Bearer "+token))
+	}
+
+	_, err := Auth(validator, "/audit.Audit/")(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method},
+		func(ctx context.Context, req any) (any, error) {
+			_, ok := ClaimsFromContext(ctx)
+			assert.Equal(t, token != "", ok)
+
+			return nil, nil
+		})
+
+	return err
+}
+
+func TestAuth(t *testing.T) {
+	const adminMethod = "/audit.Audit/VerifyAuditChain"
+	const publicMethod = "/auth.Auth/Login"
+
+	require.NoError(t, call(t, publicMethod, ""))
+	require.NoError(t, call(t, publicMethod, "service"))
+	require.NoError(t, call(t, adminMethod, "admin"))
+	require.NoError(t, call(t, adminMethod, "pat-adm"))
+	require.NoError(t, call(t, publicMethod, "pat"))
+
+	assert.Equal(t, codes.Unauthenticated, status.Code(call(t, adminMethod, "")))
+	assert.Equal(t, codes.Unauthenticated, status.Code(call(t, publicMethod, "garbage")))
+	assert.Equal(t, codes.PermissionDenied, status.Code(call(t, adminMethod, "user")))
+	assert.Equal(t, codes.PermissionDenied, status.Code(call(t, adminMethod, "admin-app")))
+	assert.Equal(t, codes.PermissionDenied, status.Code(call(t, adminMethod, "service")))
+	assert.Equal(t, codes.PermissionDenied, status.Code(call(t, adminMethod, "pat")))
+}
+
+// Токен приложения подписан секретом, который знает само приложение, поэтому к методам
+// администрирования он не пускает, даже если выдан администратору
+func TestAuth_AppTokenOnAdminMethod(t *testing.T) {
+	const adminMethod = "/audit.Audit/VerifyAuditChain"
+
+	ctx := context.Background()
+	storage, path := sqlitetest.New(t)
+	app := models.App{Id: 1, Name: "shop", Secret: "shop-secret"}
+	sqlitetest.SaveApp(t, path, app)
+
+	passHash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	adminID, err := storage.SaveUser(ctx, "admin", passHash)
+	require.NoError(t, err)
+	require.NoError(t, storage.SetAdmin(ctx, adminID, true))
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	service := auth.New(slog.New(slog.NewTextHandler(io.Discard, nil)), storage, nopAuditor{}, time.Hour, usernames.NewPolicy(3, 32, nil), key)
+
+	appToken, err := service.Login(ctx, "admin", "password", app.Id)
+	require.NoError(t, err)
+
+	// Приложение само подписало токен своим секретом от имени администратора
+	forged, err := jwt.NewToken(models.User{Id: adminID, Username: "admin"}, app, time.Hour)
+	require.NoError(t, err)
+
+	adminToken, err := service.Login(ctx, "admin", "password", auth.AdminAppID)
+	require.NoError(t, err)
+
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	foreign, err := jwt.NewAdminToken(otherKey, "other", models.User{Id: adminID, Username: "admin"}, time.Hour)
+	require.NoError(t, err)
+
+	assert.Equal(t, codes.PermissionDenied, status.Code(callWith(t, service, adminMethod, appToken)))
+	assert.Equal(t, codes.PermissionDenied, status.Code(callWith(t, service, adminMethod, forged)))
+	assert.Equal(t, codes.Unauthenticated, status.Code(callWith(t, service, adminMethod, foreign)))
+	require.NoError(t, callWith(t, service, adminMethod, adminToken))
+
+	// Для остальных методов токен приложения по-прежнему годится
+	require.NoError(t, callWith(t, service, "/profile.Profile/GetProfile", appToken))
+}
+
+type nopAuditor struct{}
+
+func (nopAuditor) Record(context.Context, string, int64, int, map[string]any) error {
+	return nil
+}
+
+func TestSessionClaims(t *testing.T) {
+	tests := map[string]codes.Code{
+		"":        codes.Unauthenticated,
+		"service": codes.Unauthenticated,
+		"pat":     codes.PermissionDenied,
+		"app":     codes.PermissionDenied,
+		"session": codes.OK,
+	}
+
+	claims := map[string]jwt.Claims{
+		"service": {ServiceAccountID: 1},
+		"pat":     {UserID: 2, PersonalTokenID: 1},
+		"app":     {UserID: 2, AppID: 1},
+		"session": {UserID: 2, Audience: jwt.AdminAudience},
+	}
+
+	for name, code := range tests {
+		ctx := context.Background()
+		if c, ok := claims[name]; ok {
+			ctx = context.WithValue(ctx, claimsKey{}, c)
+		}
+
+		got, err := SessionClaims(ctx)
+		assert.Equal(t, code, status.Code(err), name)
+
+		if code == codes.OK {
+			assert.Equal(t, int64(2), got.UserID)
+		}
+	}
+}
+
+// Статус учётной записи отличается от нехватки прав и кодом, и деталями ошибки
+func TestAccountStatusError(t *testing.T) {
+	until := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	user := models.User{Status: models.AccountSuspended, SuspendedUntil: until}
+
+	err, ok := AccountStatusError(fmt.Errorf("auth.Login: %w", user.CheckActive(time.Now())))
+	require.True(t, ok)
+
+	st := status.Convert(err)
+	assert.Equal(t, codes.FailedPrecondition, st.Code())
+	assert.Equal(t, models.ErrAccountSuspended.Error(), st.Message())
+
+	require.Len(t, st.Details(), 1)
+	info, ok := st.Details()[0].(*errdetails.ErrorInfo)
+	require.True(t, ok)
+	assert.Equal(t, AccountInactiveReason, info.GetReason())
+	assert.Equal(t, models.AccountSuspended, info.GetMetadata()["status"])
+	assert.Equal(t, "2030-01-02T03:04:05Z", info.GetMetadata()["suspended_until"])
+
+	err, ok = AccountStatusError(models.User{Status: models.AccountDisabled}.CheckActive(time.Now()))
+	require.True(t, ok)
+
+	info = status.Convert(err).Details()[0].(*errdetails.ErrorInfo)
+	assert.Equal(t, models.AccountDisabled, info.GetMetadata()["status"])
+	assert.NotContains(t, info.GetMetadata(), "suspended_until")
+
+	_, ok = AccountStatusError(errors.New("other"))
+	assert.False(t, ok)
+}
@@ -0,0 +1,260 @@
+package passkeys
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/grpc/middleware"
+	"shilka-sso/internal/lib/jwt"
+	"shilka-sso/internal/services/passkeys"
+	passkeysv1 "shilka-sso/protos/gen/go/passkeys"
+)
+
+// Passkeys методы, которые необходимо реализовать хэндлерам
+type Passkeys interface {
+	BeginRegistration(ctx context.Context, userID int64, appID int, password string) (string, []byte, error)
+	FinishRegistration(ctx context.Context, userID int64, sessionID string, name string, response []byte) (models.Passkey, error)
+	BeginLogin(ctx context.Context, username string, password string, appID int) (string, []byte, error)
+	FinishLogin(ctx context.Context, sessionID string, appID int, response []byte) (string, error)
+	Passkeys(ctx context.Context, userID int64) ([]models.Passkey, error)
+	Delete(ctx context.Context, userID int64, passkeyID int64) error
+}
+
+type ServerAPI struct {
+	passkeysv1.UnimplementedPasskeysServer
+	passkeys Passkeys
+}
+
+// RegisterServer Регистрирует сервер с методами, описанными в Passkeys interface
+func RegisterServer(gRPC *grpc.Server, passkeys Passkeys) {
+	passkeysv1.RegisterPasskeysServer(gRPC, &ServerAPI{passkeys: passkeys})
+}
+
+const (
+	emptyValue = 0
+)
+
+func (s *ServerAPI) BeginPasskeyRegistration(
+	ctx context.Context,
+	req *passkeysv1.BeginPasskeyRegistrationRequest,
+) (*passkeysv1.BeginPasskeyRegistrationResponse, error) {
+	claims, err := user(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Токен, выданный самим sso, уже подтверждает пользователя. Токен приложения - нет,
+	// поэтому с ним ключ привязывается только после проверки пароля
+	appID := claims.AppID
+	if claims.IsAdminAPI() {
+		if req.GetAppId() == emptyValue {
+			return nil, status.Error(codes.InvalidArgument, "appId is required")
+		}
+
+		appID = int(req.GetAppId())
+	} else if req.GetPassword() == "" {
+		return nil, status.Error(codes.PermissionDenied, "password is required to register a passkey with an app token")
+	}
+
+	sessionID, options, err := s.passkeys.BeginRegistration(ctx, claims.UserID, appID, req.GetPassword())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &passkeysv1.BeginPasskeyRegistrationResponse{
+		SessionId:   sessionID,
+		OptionsJson: string(options),
+	}, nil
+}
+
+func (s *ServerAPI) FinishPasskeyRegistration(
+	ctx context.Context,
+	req *passkeysv1.FinishPasskeyRegistrationRequest,
+) (*passkeysv1.FinishPasskeyRegistrationResponse, error) {
+
+	// Валидация
+	if req.GetSessionId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "sessionId is required")
+	}
+
+	if req.GetName() == "" {
+		return nil, status.Error(codes.InvalidArgument, "name is required")
+	}
+
+	if req.GetCredentialJson() == "" {
+		return nil, status.Error(codes.InvalidArgument, "credentialJson is required")
+	}
+
+	claims, err := user(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	passkey, err := s.passkeys.FinishRegistration(ctx, claims.UserID, req.GetSessionId(), req.GetName(), []byte(req.GetCredentialJson()))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &passkeysv1.FinishPasskeyRegistrationResponse{Passkey: toProto(passkey)}, nil
+}
+
+func (s *ServerAPI) BeginPasskeyLogin(
+	ctx context.Context,
+	req *passkeysv1.BeginPasskeyLoginRequest,
+) (*passkeysv1.BeginPasskeyLoginResponse, error) {
+
+	// Валидация
+	if req.GetAppId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "appId is required")
+	}
+
+	if req.GetPassword() != "" && req.GetUsername() == "" {
+		return nil, status.Error(codes.InvalidArgument, "username is required with password")
+	}
+
+	sessionID, options, err := s.passkeys.BeginLogin(ctx, req.GetUsername(), req.GetPassword(), int(req.GetAppId()))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &passkeysv1.BeginPasskeyLoginResponse{
+		SessionId:   sessionID,
+		OptionsJson: string(options),
+	}, nil
+}
+
+func (s *ServerAPI) FinishPasskeyLogin(
+	ctx context.Context,
+	req *passkeysv1.FinishPasskeyLoginRequest,
+) (*passkeysv1.FinishPasskeyLoginResponse, error) {
+
+	// Валидация
+	if req.GetSessionId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "sessionId is required")
+	}
+
+	if req.GetAppId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "appId is required")
+	}
+
+	if req.GetCredentialJson() == "" {
+		return nil, status.Error(codes.InvalidArgument, "credentialJson is required")
+	}
+
+	token, err := s.passkeys.FinishLogin(ctx, req.GetSessionId(), int(req.GetAppId()), []byte(req.GetCredentialJson()))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &passkeysv1.FinishPasskeyLoginResponse{Token: token}, nil
+}
+
+func (s *ServerAPI) ListPasskeys(
+	ctx context.Context,
+	_ *passkeysv1.ListPasskeysRequest,
+) (*passkeysv1.ListPasskeysResponse, error) {
+	claims, err := user(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := s.passkeys.Passkeys(ctx, claims.UserID)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "internal error")
+	}
+
+	resp := &passkeysv1.ListPasskeysResponse{}
+	for _, passkey := range list {
+		resp.Passkeys = append(resp.Passkeys, toProto(passkey))
+	}
+
+	return resp, nil
+}
+
+func (s *ServerAPI) DeletePasskey(
+	ctx context.Context,
+	req *passkeysv1.DeletePasskeyRequest,
+) (*passkeysv1.DeletePasskeyResponse, error) {
+
+	// Валидация
+	if req.GetId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "id is required")
+	}
+
+	claims, err := user(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.passkeys.Delete(ctx, claims.UserID, req.GetId()); err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &passkeysv1.DeletePasskeyResponse{}, nil
+}
+
+// Управлять ключами можно только с токеном, полученным при входе.
+// Иначе утёкший личный токен позволил бы привязать к учётной записи чужой ключ.
+// Токен приложения для регистрации ключа дополнительно подкрепляется паролем (BeginPasskeyRegistration)
+func user(ctx context.Context) (jwt.Claims, error) {
+	claims, ok := middleware.ClaimsFromContext(ctx)
+	if !ok || claims.IsServiceAccount() {
+		return claims, status.Error(codes.Unauthenticated, "user token is required")
+	}
+
+	if claims.IsPersonalToken() {
+		return claims, status.Error(codes.PermissionDenied, "personal tokens cannot manage passkeys")
+	}
+
+	return claims, nil
+}
+
+func toStatus(err error) error {
+	if statusErr, ok := middleware.AccountStatusError(err); ok {
+		return statusErr
+	}
+
+	switch {
+	case errors.Is(err, passkeys.ErrAppNotFound):
+		return status.Error(codes.NotFound, "app not found")
+	case errors.Is(err, passkeys.ErrPasskeyNotFound):
+		return status.Error(codes.NotFound, "passkey not found")
+	case errors.Is(err, passkeys.ErrPasskeysDisabled):
+		return status.Error(codes.FailedPrecondition, "passkeys are not configured for app")
+	case errors.Is(err, passkeys.ErrNoPasskeys):
+		return status.Error(codes.FailedPrecondition, "user has no passkeys")
+	case errors.Is(err, passkeys.ErrInvalidName):
+		return status.Error(codes.InvalidArgument, "invalid name")
+	case errors.Is(err, passkeys.ErrInvalidSession):
+		return status.Error(codes.FailedPrecondition, "invalid or expired session")
+	case errors.Is(err, passkeys.ErrInvalidCredential):
+		return status.Error(codes.InvalidArgument, "invalid credential")
+	case errors.Is(err, passkeys.ErrPasskeyExists):
+		return status.Error(codes.AlreadyExists, "passkey already registered")
+	case errors.Is(err, passkeys.ErrInvalidCredentials), errors.Is(err, passkeys.ErrAuthenticationFailed):
+		return status.Error(codes.Unauthenticated, "invalid credentials")
+	}
+
+	return status.Errorf(codes.Internal, "internal error")
+}
+
+func toProto(passkey models.Passkey) *passkeysv1.Passkey {
+	resp := &passkeysv1.Passkey{
+		Id:         passkey.Id,
+		Name:       passkey.Name,
+		RpId:       passkey.RPID,
+		Aaguid:     hex.EncodeToString(passkey.AAGUID),
+		Transports: passkey.Transports,
+		CreatedAt:  passkey.CreatedAt.Unix(),
+	}
+
+	if !passkey.LastUsedAt.IsZero() {
+		resp.LastUsedAt = passkey.LastUsedAt.Unix()
+	}
+
+	return resp
+}
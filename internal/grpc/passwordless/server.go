@@ -0,0 +1,106 @@
+package passwordless
+
+import (
+	"context"
+	"errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/grpc/middleware"
+	"shilka-sso/internal/services/passwordless"
+	passwordlessv1 "shilka-sso/protos/gen/go/passwordless"
+)
+
+// Passwordless методы, которые необходимо реализовать хэндлерам
+type Passwordless interface {
+	Start(ctx context.Context, username string, appID int, method string) (string, error)
+	Complete(ctx context.Context, challengeID string, code string, appID int) (string, error)
+}
+
+type ServerAPI struct {
+	passwordlessv1.UnimplementedPasswordlessServer
+	passwordless Passwordless
+}
+
+// RegisterServer Регистрирует сервер с методами, описанными в Passwordless interface
+func RegisterServer(gRPC *grpc.Server, passwordless Passwordless) {
+	passwordlessv1.RegisterPasswordlessServer(gRPC, &ServerAPI{passwordless: passwordless})
+}
+
+const (
+	emptyValue = 0
+)
+
+var methods = map[passwordlessv1.Method]string{
+	passwordlessv1.Method_METHOD_CODE: models.PasswordlessCode,
+	passwordlessv1.Method_METHOD_LINK: models.PasswordlessLink,
+}
+
+func (s *ServerAPI) StartPasswordlessLogin(
+	ctx context.Context,
+	req *passwordlessv1.StartPasswordlessLoginRequest,
+) (*passwordlessv1.StartPasswordlessLoginResponse, error) {
+
+	// Валидация
+	if req.GetUsername() == "" {
+		return nil, status.Error(codes.InvalidArgument, "username is required")
+	}
+
+	if req.GetAppId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "appId is required")
+	}
+
+	method, ok := methods[req.GetMethod()]
+	if !ok {
+		return nil, status.Error(codes.InvalidArgument, "unknown method")
+	}
+
+	challengeID, err := s.passwordless.Start(ctx, req.GetUsername(), int(req.GetAppId()), method)
+	if err != nil {
+		switch {
+		case errors.Is(err, passwordless.ErrAppNotFound):
+			return nil, status.Error(codes.NotFound, "app not found")
+		case errors.Is(err, passwordless.ErrUnsupportedMethod):
+			return nil, status.Error(codes.FailedPrecondition, "method is not enabled")
+		}
+
+		return nil, status.Errorf(codes.Internal, "internal error")
+	}
+
+	return &passwordlessv1.StartPasswordlessLoginResponse{ChallengeId: challengeID}, nil
+}
+
+func (s *ServerAPI) CompletePasswordlessLogin(
+	ctx context.Context,
+	req *passwordlessv1.CompletePasswordlessLoginRequest,
+) (*passwordlessv1.CompletePasswordlessLoginResponse, error) {
+
+	// Валидация
+	if req.GetChallengeId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "challengeId is required")
+	}
+
+	if req.GetCode() == "" {
+		return nil, status.Error(codes.InvalidArgument, "code is required")
+	}
+
+	if req.GetAppId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "appId is required")
+	}
+
+	token, err := s.passwordless.Complete(ctx, req.GetChallengeId(), req.GetCode(), int(req.GetAppId()))
+	if err != nil {
+		if errors.Is(err, passwordless.ErrInvalidCode) {
+			return nil, status.Error(codes.Unauthenticated, "invalid or expired code")
+		}
+
+		if statusErr, ok := middleware.AccountStatusError(err); ok {
+			return nil, statusErr
+		}
+
+		return nil, status.Errorf(codes.Internal, "internal error")
+	}
+
+	return &passwordlessv1.CompletePasswordlessLoginResponse{Token: token}, nil
+}
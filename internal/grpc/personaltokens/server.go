@@ -0,0 +1,154 @@
+package personaltokens
+
+import (
+	"context"
+	"errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/grpc/middleware"
+	"shilka-sso/internal/services/personaltokens"
+	personaltokensv1 "shilka-sso/protos/gen/go/personaltokens"
+	"time"
+)
+
+// PersonalTokens методы, которые необходимо реализовать хэндлерам
+type PersonalTokens interface {
+	Create(ctx context.Context, userID int64, name string, scopes []string, ttl time.Duration) (models.PersonalToken, string, error)
+	PersonalTokens(ctx context.Context, userID int64) ([]models.PersonalToken, error)
+	Revoke(ctx context.Context, userID int64, tokenID int64) error
+}
+
+type ServerAPI struct {
+	personaltokensv1.UnimplementedPersonalTokensServer
+	personalTokens PersonalTokens
+}
+
+// RegisterServer Регистрирует сервер с методами, описанными в PersonalTokens interface
+func RegisterServer(gRPC *grpc.Server, personalTokens PersonalTokens) {
+	personaltokensv1.RegisterPersonalTokensServer(gRPC, &ServerAPI{personalTokens: personalTokens})
+}
+
+const (
+	emptyValue = 0
+)
+
+func (s *ServerAPI) CreatePersonalToken(
+	ctx context.Context,
+	req *personaltokensv1.CreatePersonalTokenRequest,
+) (*personaltokensv1.CreatePersonalTokenResponse, error) {
+
+	// Валидация
+	if req.GetName() == "" {
+		return nil, status.Error(codes.InvalidArgument, "name is required")
+	}
+
+	if req.GetExpiresInSeconds() < emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "expiresInSeconds must not be negative")
+	}
+
+	userID, err := user(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ttl := time.Duration(req.GetExpiresInSeconds()) * time.Second
+
+	token, raw, err := s.personalTokens.Create(ctx, userID, req.GetName(), req.GetScopes(), ttl)
+	if err != nil {
+		switch {
+		case errors.Is(err, personaltokens.ErrInvalidName):
+			return nil, status.Error(codes.InvalidArgument, "invalid name")
+		case errors.Is(err, personaltokens.ErrInvalidScope):
+			return nil, status.Error(codes.InvalidArgument, "invalid scope")
+		case errors.Is(err, personaltokens.ErrInvalidExpiry):
+			return nil, status.Error(codes.InvalidArgument, "expiry exceeds the allowed maximum")
+		case errors.Is(err, personaltokens.ErrTokenExists):
+			return nil, status.Error(codes.AlreadyExists, "personal token with this name already exists")
+		}
+
+		return nil, status.Errorf(codes.Internal, "internal error")
+	}
+
+	return &personaltokensv1.CreatePersonalTokenResponse{
+		PersonalToken: toProto(token),
+		Token:         raw,
+	}, nil
+}
+
+func (s *ServerAPI) ListPersonalTokens(
+	ctx context.Context,
+	_ *personaltokensv1.ListPersonalTokensRequest,
+) (*personaltokensv1.ListPersonalTokensResponse, error) {
+	userID, err := user(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := s.personalTokens.PersonalTokens(ctx, userID)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "internal error")
+	}
+
+	resp := &personaltokensv1.ListPersonalTokensResponse{}
+	for _, token := range tokens {
+		resp.PersonalTokens = append(resp.PersonalTokens, toProto(token))
+	}
+
+	return resp, nil
+}
+
+func (s *ServerAPI) RevokePersonalToken(
+	ctx context.Context,
+	req *personaltokensv1.RevokePersonalTokenRequest,
+) (*personaltokensv1.RevokePersonalTokenResponse, error) {
+
+	// Валидация
+	if req.GetId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "id is required")
+	}
+
+	userID, err := user(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.personalTokens.Revoke(ctx, userID, req.GetId()); err != nil {
+		if errors.Is(err, personaltokens.ErrTokenNotFound) {
+			return nil, status.Error(codes.NotFound, "personal token not found")
+		}
+
+		return nil, status.Errorf(codes.Internal, "internal error")
+	}
+
+	return &personaltokensv1.RevokePersonalTokenResponse{}, nil
+}
+
+// Управлять токенами можно только с токеном, который sso выдал при входе. Токен приложения приложение может
+// выписать на любого пользователя и выпустить от его имени долгоживущий личный токен, а утёкший личный токен
+// позволил бы выпустить себе новые
+func user(ctx context.Context) (int64, error) {
+	claims, err := middleware.SessionClaims(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	return claims.UserID, nil
+}
+
+func toProto(token models.PersonalToken) *personaltokensv1.PersonalToken {
+	resp := &personaltokensv1.PersonalToken{
+		Id:        token.Id,
+		Name:      token.Name,
+		Scopes:    token.Scopes,
+		CreatedAt: token.CreatedAt.Unix(),
+		ExpiresAt: token.ExpiresAt.Unix(),
+	}
+
+	if !token.LastUsedAt.IsZero() {
+		resp.LastUsedAt = token.LastUsedAt.Unix()
+	}
+
+	return resp
+}
@@ -0,0 +1,108 @@
+package privacy
+
+import (
+	"context"
+	"errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/grpc/middleware"
+	"shilka-sso/internal/services/privacy"
+	privacyv1 "shilka-sso/protos/gen/go/privacy"
+)
+
+// Privacy методы, которые необходимо реализовать хэндлерам
+type Privacy interface {
+	Export(ctx context.Context, actorID int64, userID int64) ([]byte, error)
+	RequestErasure(ctx context.Context, actorID int64, userID int64, reason string) (models.ErasureRequest, error)
+	CancelErasure(ctx context.Context, actorID int64, userID int64) error
+}
+
+type ServerAPI struct {
+	privacyv1.UnimplementedPrivacyServer
+	privacy Privacy
+}
+
+// RegisterServer Регистрирует сервер с методами, описанными в Privacy interface
+func RegisterServer(gRPC *grpc.Server, privacy Privacy) {
+	privacyv1.RegisterPrivacyServer(gRPC, &ServerAPI{privacy: privacy})
+}
+
+const (
+	emptyValue = 0
+)
+
+func (s *ServerAPI) ExportUserData(
+	ctx context.Context,
+	req *privacyv1.ExportUserDataRequest,
+) (*privacyv1.ExportUserDataResponse, error) {
+
+	// Валидация
+	if req.GetUserId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "userId is empty")
+	}
+
+	claims, _ := middleware.ClaimsFromContext(ctx)
+
+	data, err := s.privacy.Export(ctx, claims.UserID, req.GetUserId())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &privacyv1.ExportUserDataResponse{Data: data}, nil
+}
+
+func (s *ServerAPI) EraseUser(
+	ctx context.Context,
+	req *privacyv1.EraseUserRequest,
+) (*privacyv1.EraseUserResponse, error) {
+
+	// Валидация
+	if req.GetUserId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "userId is empty")
+	}
+
+	claims, _ := middleware.ClaimsFromContext(ctx)
+
+	request, err := s.privacy.RequestErasure(ctx, claims.UserID, req.GetUserId(), req.GetReason())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &privacyv1.EraseUserResponse{EraseAt: request.EraseAt.Unix()}, nil
+}
+
+func (s *ServerAPI) CancelUserErasure(
+	ctx context.Context,
+	req *privacyv1.CancelUserErasureRequest,
+) (*privacyv1.CancelUserErasureResponse, error) {
+
+	// Валидация
+	if req.GetUserId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "userId is empty")
+	}
+
+	claims, _ := middleware.ClaimsFromContext(ctx)
+
+	if err := s.privacy.CancelErasure(ctx, claims.UserID, req.GetUserId()); err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &privacyv1.CancelUserErasureResponse{}, nil
+}
+
+func toStatus(err error) error {
+	switch {
+	case errors.Is(err, privacy.ErrUserNotFound):
+		return status.Error(codes.NotFound, "user not found")
+	case errors.Is(err, privacy.ErrErasureRequested):
+		return status.Error(codes.AlreadyExists, "erasure already requested")
+	case errors.Is(err, privacy.ErrErasureNotFound):
+		return status.Error(codes.NotFound, "erasure request not found")
+	case errors.Is(err, privacy.ErrOwnErasure):
+		return status.Error(codes.FailedPrecondition, "cannot erase own data")
+	}
+
+	return status.Errorf(codes.Internal, "internal error")
+}
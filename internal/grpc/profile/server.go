@@ -0,0 +1,198 @@
+package profile
+
+import (
+	"context"
+	"errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/grpc/middleware"
+	"shilka-sso/internal/lib/jwt"
+	"shilka-sso/internal/lib/usernames"
+	"shilka-sso/internal/services/profile"
+	profilev1 "shilka-sso/protos/gen/go/profile"
+)
+
+// Profile методы, которые необходимо реализовать хэндлерам
+type Profile interface {
+	Profile(ctx context.Context, userID int64) (models.Profile, error)
+	UpdateProfile(ctx context.Context, userID int64, update models.ProfileUpdate) error
+	VerifyIdentifier(ctx context.Context, userID int64, kind string, code string) error
+	ChangePassword(ctx context.Context, userID int64, currentPassword string, newPassword string) (int64, error)
+}
+
+type ServerAPI struct {
+	profilev1.UnimplementedProfileServer
+	profile Profile
+}
+
+// RegisterServer Регистрирует сервер с методами, описанными в Profile interface
+func RegisterServer(gRPC *grpc.Server, profile Profile) {
+	profilev1.RegisterProfileServer(gRPC, &ServerAPI{profile: profile})
+}
+
+var kinds = map[profilev1.IdentifierKind]string{
+	profilev1.IdentifierKind_IDENTIFIER_KIND_EMAIL: models.IdentifierEmail,
+	profilev1.IdentifierKind_IDENTIFIER_KIND_PHONE: models.IdentifierPhone,
+}
+
+func (s *ServerAPI) GetProfile(
+	ctx context.Context,
+	_ *profilev1.GetProfileRequest,
+) (*profilev1.GetProfileResponse, error) {
+	claims, err := user(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := s.profile.Profile(ctx, claims.UserID)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	resp := &profilev1.GetProfileResponse{
+		UserId:   result.UserId,
+		Username: result.Username,
+	}
+
+	for _, identifier := range result.Identifiers {
+		item := &profilev1.Identifier{
+			Value:    identifier.Value,
+			Verified: identifier.Verified(),
+		}
+
+		for kind, name := range kinds {
+			if name == identifier.Kind {
+				item.Kind = kind
+			}
+		}
+
+		if identifier.Verified() {
+			item.VerifiedAt = identifier.VerifiedAt.Unix()
+		}
+
+		resp.Identifiers = append(resp.Identifiers, item)
+	}
+
+	return resp, nil
+}
+
+func (s *ServerAPI) UpdateProfile(
+	ctx context.Context,
+	req *profilev1.UpdateProfileRequest,
+) (*profilev1.UpdateProfileResponse, error) {
+	claims, err := middleware.SessionClaims(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.profile.UpdateProfile(ctx, claims.UserID, models.ProfileUpdate{
+		Username: req.Username,
+		Email:    req.Email,
+		Phone:    req.Phone,
+	})
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &profilev1.UpdateProfileResponse{}, nil
+}
+
+func (s *ServerAPI) VerifyIdentifier(
+	ctx context.Context,
+	req *profilev1.VerifyIdentifierRequest,
+) (*profilev1.VerifyIdentifierResponse, error) {
+
+	// Валидация
+	kind, ok := kinds[req.GetKind()]
+	if !ok {
+		return nil, status.Error(codes.InvalidArgument, "kind is required")
+	}
+
+	if req.GetCode() == "" {
+		return nil, status.Error(codes.InvalidArgument, "code is required")
+	}
+
+	claims, err := middleware.SessionClaims(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.profile.VerifyIdentifier(ctx, claims.UserID, kind, req.GetCode()); err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &profilev1.VerifyIdentifierResponse{}, nil
+}
+
+func (s *ServerAPI) ChangePassword(
+	ctx context.Context,
+	req *profilev1.ChangePasswordRequest,
+) (*profilev1.ChangePasswordResponse, error) {
+
+	// Валидация
+	if req.GetCurrentPassword() == "" {
+		return nil, status.Error(codes.InvalidArgument, "current_password is required")
+	}
+
+	if req.GetNewPassword() == "" {
+		return nil, status.Error(codes.InvalidArgument, "new_password is required")
+	}
+
+	claims, err := user(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	revoked, err := s.profile.ChangePassword(ctx, claims.UserID, req.GetCurrentPassword(), req.GetNewPassword())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &profilev1.ChangePasswordResponse{RevokedTokens: revoked}, nil
+}
+
+// Смотреть профиль и менять пароль можно с токеном приложения: смена пароля всё равно требует текущий пароль.
+// Личный токен не подходит, он выдаётся для доступа к API, а не для управления учётной записью.
+// Имя и идентификаторы для входа меняются только с токеном, который sso выдал при входе (middleware.SessionClaims):
+// приложение может выписать свой токен на любого пользователя и привязать к чужой учётной записи свою почту
+func user(ctx context.Context) (jwt.Claims, error) {
+	claims, ok := middleware.ClaimsFromContext(ctx)
+	if !ok || claims.IsServiceAccount() {
+		return claims, status.Error(codes.Unauthenticated, "user token is required")
+	}
+
+	if claims.IsPersonalToken() {
+		return claims, status.Error(codes.PermissionDenied, "personal tokens cannot manage profile")
+	}
+
+	return claims, nil
+}
+
+func toStatus(err error) error {
+	switch {
+	case errors.Is(err, profile.ErrUserNotFound):
+		return status.Error(codes.NotFound, "user not found")
+	case errors.Is(err, profile.ErrInvalidUsername):
+		return status.Error(codes.InvalidArgument, usernames.Reason(err))
+	case errors.Is(err, profile.ErrUsernameTaken):
+		return status.Error(codes.AlreadyExists, "username already taken")
+	case errors.Is(err, profile.ErrInvalidEmail):
+		return status.Error(codes.InvalidArgument, "invalid email address")
+	case errors.Is(err, profile.ErrInvalidPhone):
+		return status.Error(codes.InvalidArgument, "invalid phone number")
+	case errors.Is(err, profile.ErrIdentifierTaken):
+		return status.Error(codes.AlreadyExists, "identifier already taken")
+	case errors.Is(err, profile.ErrInvalidKind):
+		return status.Error(codes.InvalidArgument, "unknown identifier kind")
+	case errors.Is(err, profile.ErrInvalidCode):
+		return status.Error(codes.FailedPrecondition, "invalid or expired code")
+	case errors.Is(err, profile.ErrDeliveryFailed):
+		return status.Error(codes.Unavailable, "failed to deliver verification code")
+	case errors.Is(err, profile.ErrInvalidPassword):
+		return status.Error(codes.InvalidArgument, "invalid current password")
+	}
+
+	return status.Errorf(codes.Internal, "internal error")
+}
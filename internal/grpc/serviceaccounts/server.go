@@ -0,0 +1,129 @@
+package serviceaccounts
+
+import (
+	"context"
+	"errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/grpc/middleware"
+	"shilka-sso/internal/services/serviceaccounts"
+	serviceaccountsv1 "shilka-sso/protos/gen/go/serviceaccounts"
+)
+
+// ServiceAccounts методы, которые необходимо реализовать хэндлерам
+type ServiceAccounts interface {
+	Create(ctx context.Context, actorID int64, appID int, name string, scopes []string) (models.ServiceAccount, string, error)
+	ServiceAccounts(ctx context.Context, appID int) ([]models.ServiceAccount, error)
+	Delete(ctx context.Context, actorID int64, accountID int64) error
+}
+
+type ServerAPI struct {
+	serviceaccountsv1.UnimplementedServiceAccountsServer
+	serviceAccounts ServiceAccounts
+}
+
+// RegisterServer Регистрирует сервер с методами, описанными в ServiceAccounts interface
+func RegisterServer(gRPC *grpc.Server, serviceAccounts ServiceAccounts) {
+	serviceaccountsv1.RegisterServiceAccountsServer(gRPC, &ServerAPI{serviceAccounts: serviceAccounts})
+}
+
+const (
+	emptyValue = 0
+)
+
+func (s *ServerAPI) CreateServiceAccount(
+	ctx context.Context,
+	req *serviceaccountsv1.CreateServiceAccountRequest,
+) (*serviceaccountsv1.CreateServiceAccountResponse, error) {
+
+	// Валидация
+	if req.GetAppId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "appId is required")
+	}
+
+	if req.GetName() == "" {
+		return nil, status.Error(codes.InvalidArgument, "name is required")
+	}
+
+	claims, _ := middleware.ClaimsFromContext(ctx)
+
+	account, secret, err := s.serviceAccounts.Create(ctx, claims.UserID, int(req.GetAppId()), req.GetName(), req.GetScopes())
+	if err != nil {
+		switch {
+		case errors.Is(err, serviceaccounts.ErrInvalidName):
+			return nil, status.Error(codes.InvalidArgument, "invalid name")
+		case errors.Is(err, serviceaccounts.ErrInvalidScope):
+			return nil, status.Error(codes.InvalidArgument, "invalid scope")
+		case errors.Is(err, serviceaccounts.ErrAppNotFound):
+			return nil, status.Error(codes.NotFound, "app not found")
+		case errors.Is(err, serviceaccounts.ErrServiceAccountExists):
+			return nil, status.Error(codes.AlreadyExists, "service account already exists")
+		}
+
+		return nil, status.Errorf(codes.Internal, "internal error")
+	}
+
+	return &serviceaccountsv1.CreateServiceAccountResponse{
+		ServiceAccount: toProto(account),
+		ClientSecret:   secret,
+	}, nil
+}
+
+func (s *ServerAPI) ListServiceAccounts(
+	ctx context.Context,
+	req *serviceaccountsv1.ListServiceAccountsRequest,
+) (*serviceaccountsv1.ListServiceAccountsResponse, error) {
+
+	// Валидация
+	if req.GetAppId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "appId is required")
+	}
+
+	accounts, err := s.serviceAccounts.ServiceAccounts(ctx, int(req.GetAppId()))
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "internal error")
+	}
+
+	resp := &serviceaccountsv1.ListServiceAccountsResponse{}
+	for _, account := range accounts {
+		resp.ServiceAccounts = append(resp.ServiceAccounts, toProto(account))
+	}
+
+	return resp, nil
+}
+
+func (s *ServerAPI) DeleteServiceAccount(
+	ctx context.Context,
+	req *serviceaccountsv1.DeleteServiceAccountRequest,
+) (*serviceaccountsv1.DeleteServiceAccountResponse, error) {
+
+	// Валидация
+	if req.GetId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "id is required")
+	}
+
+	claims, _ := middleware.ClaimsFromContext(ctx)
+
+	if err := s.serviceAccounts.Delete(ctx, claims.UserID, req.GetId()); err != nil {
+		if errors.Is(err, serviceaccounts.ErrServiceAccountNotFound) {
+			return nil, status.Error(codes.NotFound, "service account not found")
+		}
+
+		return nil, status.Errorf(codes.Internal, "internal error")
+	}
+
+	return &serviceaccountsv1.DeleteServiceAccountResponse{}, nil
+}
+
+func toProto(account models.ServiceAccount) *serviceaccountsv1.ServiceAccount {
+	return &serviceaccountsv1.ServiceAccount{
+		Id:        account.Id,
+		AppId:     int32(account.AppId),
+		Name:      account.Name,
+		ClientId:  account.ClientId,
+		Scopes:    account.Scopes,
+		CreatedAt: account.CreatedAt.Unix(),
+	}
+}
@@ -0,0 +1,145 @@
+package users
+
+import (
+	"context"
+	"errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/grpc/middleware"
+	"shilka-sso/internal/services/users"
+	usersv1 "shilka-sso/protos/gen/go/users"
+	"time"
+)
+
+// Users методы, которые необходимо реализовать хэндлерам
+type Users interface {
+	SetAdmin(ctx context.Context, actorID int64, userID int64, isAdmin bool) error
+	SetStatus(ctx context.Context, actorID int64, userID int64, status string, reason string, suspendedUntil time.Time) error
+	StatusHistory(ctx context.Context, userID int64) ([]models.AccountStatusChange, error)
+}
+
+type ServerAPI struct {
+	usersv1.UnimplementedUsersServer
+	users Users
+}
+
+// RegisterServer Регистрирует сервер с методами, описанными в Users interface
+func RegisterServer(gRPC *grpc.Server, users Users) {
+	usersv1.RegisterUsersServer(gRPC, &ServerAPI{users: users})
+}
+
+const (
+	emptyValue = 0
+)
+
+var statuses = map[usersv1.AccountStatus]string{
+	usersv1.AccountStatus_ACCOUNT_STATUS_ACTIVE:    models.AccountActive,
+	usersv1.AccountStatus_ACCOUNT_STATUS_SUSPENDED: models.AccountSuspended,
+	usersv1.AccountStatus_ACCOUNT_STATUS_DISABLED:  models.AccountDisabled,
+	usersv1.AccountStatus_ACCOUNT_STATUS_PENDING:   models.AccountPending,
+}
+
+func (s *ServerAPI) SetAdmin(ctx context.Context, req *usersv1.SetAdminRequest) (*usersv1.SetAdminResponse, error) {
+
+	// Валидация
+	if req.GetUserId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "userId is empty")
+	}
+
+	claims, _ := middleware.ClaimsFromContext(ctx)
+
+	if err := s.users.SetAdmin(ctx, claims.UserID, req.GetUserId(), req.GetIsAdmin()); err != nil {
+		if errors.Is(err, users.ErrUserNotFound) {
+			return nil, status.Error(codes.NotFound, "user not found")
+		}
+
+		return nil, status.Errorf(codes.Internal, "internal error")
+	}
+
+	return &usersv1.SetAdminResponse{}, nil
+}
+
+func (s *ServerAPI) SetUserStatus(
+	ctx context.Context,
+	req *usersv1.SetUserStatusRequest,
+) (*usersv1.SetUserStatusResponse, error) {
+
+	// Валидация
+	if req.GetUserId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "userId is empty")
+	}
+
+	accountStatus, ok := statuses[req.GetStatus()]
+	if !ok {
+		return nil, status.Error(codes.InvalidArgument, "status is required")
+	}
+
+	var suspendedUntil time.Time
+	if req.GetSuspendedUntil() != emptyValue {
+		suspendedUntil = time.Unix(req.GetSuspendedUntil(), 0)
+	}
+
+	claims, _ := middleware.ClaimsFromContext(ctx)
+
+	err := s.users.SetStatus(ctx, claims.UserID, req.GetUserId(), accountStatus, req.GetReason(), suspendedUntil)
+	if err != nil {
+		switch {
+		case errors.Is(err, users.ErrUserNotFound):
+			return nil, status.Error(codes.NotFound, "user not found")
+		case errors.Is(err, users.ErrReasonRequired):
+			return nil, status.Error(codes.InvalidArgument, "reason is required")
+		case errors.Is(err, users.ErrInvalidSuspension):
+			return nil, status.Error(codes.InvalidArgument, "suspendedUntil must be in the future and is allowed only for suspension")
+		case errors.Is(err, users.ErrInvalidStatus):
+			return nil, status.Error(codes.InvalidArgument, "invalid status")
+		case errors.Is(err, users.ErrOwnStatus):
+			return nil, status.Error(codes.FailedPrecondition, "cannot change own status")
+		}
+
+		return nil, status.Errorf(codes.Internal, "internal error")
+	}
+
+	return &usersv1.SetUserStatusResponse{}, nil
+}
+
+func (s *ServerAPI) GetUserStatusHistory(
+	ctx context.Context,
+	req *usersv1.GetUserStatusHistoryRequest,
+) (*usersv1.GetUserStatusHistoryResponse, error) {
+
+	// Валидация
+	if req.GetUserId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "userId is empty")
+	}
+
+	history, err := s.users.StatusHistory(ctx, req.GetUserId())
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "internal error")
+	}
+
+	resp := &usersv1.GetUserStatusHistoryResponse{}
+
+	for _, change := range history {
+		item := &usersv1.StatusChange{
+			Reason:    change.Reason,
+			ActorId:   change.ActorId,
+			CreatedAt: change.CreatedAt.Unix(),
+		}
+
+		for value, name := range statuses {
+			if name == change.Status {
+				item.Status = value
+			}
+		}
+
+		if !change.SuspendedUntil.IsZero() {
+			item.SuspendedUntil = change.SuspendedUntil.Unix()
+		}
+
+		resp.Changes = append(resp.Changes, item)
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,173 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/services/webhooks"
+	webhooksv1 "shilka-sso/protos/gen/go/webhooks"
+)
+
+// Webhooks методы, которые необходимо реализовать хэндлерам
+type Webhooks interface {
+	CreateWebhook(ctx context.Context, appID int, eventType string, url string) (int64, error)
+	Webhooks(ctx context.Context, appID int) ([]models.Webhook, error)
+	DeleteWebhook(ctx context.Context, webhookID int64) error
+	DeadLetters(ctx context.Context, appID int) ([]models.WebhookDelivery, error)
+	ReplayDeadLetter(ctx context.Context, deliveryID int64) error
+}
+
+type ServerAPI struct {
+	webhooksv1.UnimplementedWebhooksServer
+	webhooks Webhooks
+}
+
+// RegisterServer Регистрирует сервер с методами, описанными в Webhooks interface
+func RegisterServer(gRPC *grpc.Server, webhooks Webhooks) {
+	webhooksv1.RegisterWebhooksServer(gRPC, &ServerAPI{webhooks: webhooks})
+}
+
+const (
+	emptyValue = 0
+)
+
+func (s *ServerAPI) CreateWebhook(
+	ctx context.Context,
+	req *webhooksv1.CreateWebhookRequest,
+) (*webhooksv1.CreateWebhookResponse, error) {
+
+	// Валидация
+	if req.GetAppId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "appId is required")
+	}
+
+	if req.GetEventType() == "" {
+		return nil, status.Error(codes.InvalidArgument, "eventType is required")
+	}
+
+	if req.GetUrl() == "" {
+		return nil, status.Error(codes.InvalidArgument, "url is required")
+	}
+
+	id, err := s.webhooks.CreateWebhook(ctx, int(req.GetAppId()), req.GetEventType(), req.GetUrl())
+	if err != nil {
+		switch {
+		case errors.Is(err, webhooks.ErrUnknownEventType):
+			return nil, status.Error(codes.InvalidArgument, "unknown event type")
+		case errors.Is(err, webhooks.ErrInvalidURL):
+			return nil, status.Error(codes.InvalidArgument, "invalid url")
+		case errors.Is(err, webhooks.ErrAppNotFound):
+			return nil, status.Error(codes.NotFound, "app not found")
+		case errors.Is(err, webhooks.ErrWebhookExists):
+			return nil, status.Error(codes.AlreadyExists, "webhook already exists")
+		}
+
+		return nil, status.Errorf(codes.Internal, "internal error")
+	}
+
+	return &webhooksv1.CreateWebhookResponse{
+		WebhookId: id,
+	}, nil
+}
+
+func (s *ServerAPI) ListWebhooks(
+	ctx context.Context,
+	req *webhooksv1.ListWebhooksRequest,
+) (*webhooksv1.ListWebhooksResponse, error) {
+
+	// Валидация
+	if req.GetAppId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "appId is required")
+	}
+
+	list, err := s.webhooks.Webhooks(ctx, int(req.GetAppId()))
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "internal error")
+	}
+
+	resp := &webhooksv1.ListWebhooksResponse{}
+	for _, webhook := range list {
+		resp.Webhooks = append(resp.Webhooks, &webhooksv1.Webhook{
+			Id:        webhook.Id,
+			AppId:     int32(webhook.AppId),
+			EventType: webhook.EventType,
+			Url:       webhook.URL,
+			CreatedAt: webhook.CreatedAt.Unix(),
+		})
+	}
+
+	return resp, nil
+}
+
+func (s *ServerAPI) DeleteWebhook(
+	ctx context.Context,
+	req *webhooksv1.DeleteWebhookRequest,
+) (*webhooksv1.DeleteWebhookResponse, error) {
+
+	// Валидация
+	if req.GetWebhookId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "webhookId is required")
+	}
+
+	if err := s.webhooks.DeleteWebhook(ctx, req.GetWebhookId()); err != nil {
+		if errors.Is(err, webhooks.ErrWebhookNotFound) {
+			return nil, status.Error(codes.NotFound, "webhook not found")
+		}
+
+		return nil, status.Errorf(codes.Internal, "internal error")
+	}
+
+	return &webhooksv1.DeleteWebhookResponse{}, nil
+}
+
+func (s *ServerAPI) ListDeadLetters(
+	ctx context.Context,
+	req *webhooksv1.ListDeadLettersRequest,
+) (*webhooksv1.ListDeadLettersResponse, error) {
+	deliveries, err := s.webhooks.DeadLetters(ctx, int(req.GetAppId()))
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "internal error")
+	}
+
+	resp := &webhooksv1.ListDeadLettersResponse{}
+	for _, delivery := range deliveries {
+		resp.DeadLetters = append(resp.DeadLetters, &webhooksv1.DeadLetter{
+			DeliveryId: delivery.Id,
+			WebhookId:  delivery.WebhookId,
+			AppId:      int32(delivery.AppId),
+			Url:        delivery.URL,
+			EventId:    delivery.EventId,
+			EventType:  delivery.EventType,
+			Body:       string(delivery.Body),
+			Attempts:   int32(delivery.Attempts),
+			LastError:  delivery.LastError,
+			CreatedAt:  delivery.CreatedAt.Unix(),
+		})
+	}
+
+	return resp, nil
+}
+
+func (s *ServerAPI) ReplayDeadLetter(
+	ctx context.Context,
+	req *webhooksv1.ReplayDeadLetterRequest,
+) (*webhooksv1.ReplayDeadLetterResponse, error) {
+
+	// Валидация
+	if req.GetDeliveryId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "deliveryId is required")
+	}
+
+	if err := s.webhooks.ReplayDeadLetter(ctx, req.GetDeliveryId()); err != nil {
+		if errors.Is(err, webhooks.ErrDeadLetterNotFound) {
+			return nil, status.Error(codes.NotFound, "dead letter not found")
+		}
+
+		return nil, status.Errorf(codes.Internal, "internal error")
+	}
+
+	return &webhooksv1.ReplayDeadLetterResponse{}, nil
+}
@@ -0,0 +1,65 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/url"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/lib/jwt"
+	"shilka-sso/internal/services/oauth"
+	"strings"
+	"testing"
+)
+
+func TestClientCredentials(t *testing.T) {
+	server, serviceAccounts := newTestServer(t)
+
+	account, secret, err := serviceAccounts.Create(context.Background(), 1, appID, "reports", []string{"reports.read", "reports.write"})
+	require.NoError(t, err)
+
+	requestToken := func(clientSecret string, scope string) (int, map[string]any) {
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/token", strings.NewReader(url.Values{
+			"grant_type": {"client_credentials"},
+			"scope":      {scope},
+		}.Encode()))
+		require.NoError(t, err)
+
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.SetBasicAuth(account.ClientId, clientSecret)
+
+		resp, err := server.Client().Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		var body map[string]any
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+
+		return resp.StatusCode, body
+	}
+
+	status, body := requestToken(secret, "reports.read")
+	require.Equal(t, http.StatusOK, status, body)
+	assert.Equal(t, "reports.read", body["scope"])
+
+	claims, err := jwt.ParseToken(body["access_token"].(string), models.App{Id: appID, Secret: appSecret})
+	require.NoError(t, err)
+	assert.True(t, claims.IsServiceAccount())
+	assert.Equal(t, account.Id, claims.ServiceAccountID)
+	assert.Zero(t, claims.UserID)
+
+	// Без scope выдаются все scope аккаунта
+	status, body = requestToken(secret, "")
+	require.Equal(t, http.StatusOK, status, body)
+	assert.Equal(t, "reports.read reports.write", body["scope"])
+
+	status, body = requestToken(secret, "reports.read users.delete")
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, oauth.CodeInvalidScope, body["error"])
+
+	status, body = requestToken("wrong", "")
+	assert.Equal(t, http.StatusUnauthorized, status)
+	assert.Equal(t, oauth.CodeInvalidClient, body["error"])
+}
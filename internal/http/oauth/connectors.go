@@ -0,0 +1,143 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"shilka-sso/internal/services/federation"
+	"shilka-sso/internal/services/oauth"
+)
+
+// Federation методы входа через внешние провайдеры, которые необходимо реализовать хэндлерам
+type Federation interface {
+	Connectors() []federation.Connector
+	Start(ctx context.Context, connectorID string, req oauth.AuthorizeRequest) (string, string, error)
+	Callback(ctx context.Context, connectorID string, state string, code string, upstreamErr string) (oauth.AuthorizeRequest, string, error)
+}
+
+const (
+	connectorLoginPath    = "/connectors/{id}/login"
+	connectorCallbackPath = "/connectors/{id}/callback"
+)
+
+// Cookie, которая привязывает вход через провайдер к браузеру, начавшему его
+// Без неё чужой state, подсунутый пользователю, залогинил бы его под чужим аккаунтом
+const connectorStateCookie = "sso_connector_state"
+
+type connectorLink struct {
+	Name string
+	URL  string
+}
+
+// Ссылки на вход через коннекторы с параметрами исходного запроса /authorize
+func (s *Server) connectorLinks(params map[string]string) []connectorLink {
+	query := url.Values{}
+	for name, value := range params {
+		if value != "" {
+			query.Set(name, value)
+		}
+	}
+
+	connectors := s.federation.Connectors()
+
+	links := make([]connectorLink, 0, len(connectors))
+	for _, c := range connectors {
+		links = append(links, connectorLink{
+			Name: c.Name,
+			URL:  "/connectors/" + url.PathEscape(c.ID) + "/login?" + query.Encode(),
+		})
+	}
+
+	return links
+}
+
+// Проверяет запрос /authorize и отправляет пользователя на вход к провайдеру
+func (s *Server) connectorLogin(w http.ResponseWriter, r *http.Request) {
+	req := parseAuthorizeRequest(r)
+
+	authURL, state, err := s.federation.Start(r.Context(), r.PathValue("id"), req)
+	if err != nil {
+		if errors.Is(err, federation.ErrUnknownConnector) {
+			renderError(w, http.StatusNotFound, "Неизвестный провайдер входа")
+			return
+		}
+
+		s.authorizeError(w, r, req, connectorError(err))
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     connectorStateCookie,
+		Value:    state,
+		Path:     "/connectors/",
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// Провайдер возвращает пользователя сюда, отсюда он уходит в приложение с кодом sso
+func (s *Server) connectorCallback(w http.ResponseWriter, r *http.Request) {
+	state := r.FormValue("state")
+
+	cookie, err := r.Cookie(connectorStateCookie)
+	if err != nil || state == "" || cookie.Value != state {
+		renderError(w, http.StatusBadRequest, "Сессия входа устарела, начните вход заново")
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     connectorStateCookie,
+		Path:     "/connectors/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	req, code, err := s.federation.Callback(
+		r.Context(),
+		r.PathValue("id"),
+		state,
+		r.FormValue("code"),
+		r.FormValue("error"),
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, federation.ErrUnknownConnector):
+			renderError(w, http.StatusNotFound, "Неизвестный провайдер входа")
+		case errors.Is(err, federation.ErrInvalidState):
+			renderError(w, http.StatusBadRequest, "Сессия входа устарела, начните вход заново")
+		default:
+			s.authorizeError(w, r, req, connectorError(err))
+		}
+
+		return
+	}
+
+	redirect(w, r, req.RedirectURI, url.Values{
+		"code":  {code},
+		"state": {req.State},
+	})
+}
+
+// Переводит ошибки входа через провайдер в ошибки OAuth для приложения
+func connectorError(err error) error {
+	switch {
+	case errors.Is(err, federation.ErrAccessDenied):
+		return &oauth.Error{Code: oauth.CodeAccessDenied, Description: "login through identity provider was denied"}
+	case errors.Is(err, federation.ErrUpstream):
+		return &oauth.Error{Code: oauth.CodeServerError, Description: "identity provider is unavailable"}
+	}
+
+	return err
+}
+
+func renderError(w http.ResponseWriter, statusCode int, message string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(statusCode)
+	_ = errorPage.Execute(w, message)
+}
@@ -0,0 +1,237 @@
+package oauth
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/lib/jwt"
+	"shilka-sso/internal/services/federation"
+	"shilka-sso/internal/services/federation/mockoidc"
+	"shilka-sso/internal/storage/sqlite"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	connectorClientID     = "sso"
+	connectorClientSecret = "partner-secret"
+)
+
+func newConnector(provider *mockoidc.Provider, autoProvision bool, linkByEmail bool) federation.Connector {
+	return federation.Connector{
+		ID:            "partner",
+		Name:          "Partner",
+		Issuer:        provider.Issuer(),
+		ClientID:      connectorClientID,
+		ClientSecret:  connectorClientSecret,
+		AutoProvision: autoProvision,
+		LinkByEmail:   linkByEmail,
+	}
+}
+
+// Добавляет локальному пользователю почту, подтверждённую, если verified
+func setUserEmail(t *testing.T, storage *sqlite.Storage, email string, verified bool) {
+	t.Helper()
+
+	ctx := context.Background()
+
+	user, err := storage.GetUser(ctx, username)
+	require.NoError(t, err)
+
+	require.NoError(t, storage.SetIdentifier(ctx, models.Identifier{
+		UserId:        user.Id,
+		Kind:          models.IdentifierEmail,
+		Value:         email,
+		Canonical:     strings.ToLower(email),
+		CodeHash:      "code-hash",
+		CodeExpiresAt: time.Now().Add(time.Hour),
+		CreatedAt:     time.Now(),
+	}))
+
+	if verified {
+		require.NoError(t, storage.VerifyIdentifier(ctx, user.Id, models.IdentifierEmail))
+	}
+}
+
+// Проходит вход через коннектор с исходной страницы входа и возвращает адрес, на который sso отправил пользователя
+func connectorLogin(t *testing.T, server *httptest.Server) *url.URL {
+	t.Helper()
+
+	jar, err := cookiejar.New(nil)
+	require.NoError(t, err)
+
+	client := server.Client()
+	client.Jar = jar
+
+	// По редиректам ходим до возврата в приложение
+	client.CheckRedirect = func(req *http.Request, _ []*http.Request) error {
+		if strings.HasPrefix(req.URL.String(), redirectURI) {
+			return http.ErrUseLastResponse
+		}
+
+		return nil
+	}
+
+	resp, err := client.Get(server.URL + "/authorize?" + authorizeQuery().Encode())
+	require.NoError(t, err)
+	page, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	assert.Contains(t, string(page), "Войти через Partner")
+
+	resp, err = client.Get(server.URL + "/connectors/partner/login?" + authorizeQuery().Encode())
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	require.Equal(t, http.StatusFound, resp.StatusCode)
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	require.NoError(t, err)
+
+	return location
+}
+
+func exchangeConnectorCode(t *testing.T, server *httptest.Server, location *url.URL) jwt.Claims {
+	t.Helper()
+
+	assert.Equal(t, "xyz", location.Query().Get("state"))
+
+	code := location.Query().Get("code")
+	require.NotEmpty(t, code, location.String())
+
+	status, body := exchange(t, server, code, verifier)
+	require.Equal(t, http.StatusOK, status, body)
+
+	claims, err := jwt.ParseToken(body["access_token"].(string), models.App{Id: appID, Secret: appSecret})
+	require.NoError(t, err)
+
+	return claims
+}
+
+func TestConnectorAutoProvision(t *testing.T) {
+	provider := mockoidc.New(t, connectorClientID, connectorClientSecret)
+	provider.SetUser("partner-42", map[string]any{"preferred_username": "partner.user"})
+
+	server, _ := newTestServer(t, newConnector(provider, true, false))
+
+	claims := exchangeConnectorCode(t, server, connectorLogin(t, server))
+	assert.Equal(t, "partner.user", claims.Username)
+
+	// Повторный вход попадает в того же пользователя, даже если имя у провайдера сменилось
+	provider.SetUser("partner-42", map[string]any{"preferred_username": "renamed"})
+
+	again := exchangeConnectorCode(t, server, connectorLogin(t, server))
+	assert.Equal(t, claims.UserID, again.UserID)
+	assert.Equal(t, "partner.user", again.Username)
+}
+
+func TestConnectorLinkByEmail(t *testing.T) {
+	provider := mockoidc.New(t, connectorClientID, connectorClientSecret)
+	provider.SetUser("partner-1", map[string]any{
+		"preferred_username": "partner.user",
+		"email":              "User@Example.com",
+		"email_verified":     true,
+	})
+
+	server, _, storage := newTestServerWithStorage(t, newConnector(provider, false, true))
+	setUserEmail(t, storage, "user@example.com", true)
+
+	claims := exchangeConnectorCode(t, server, connectorLogin(t, server))
+	assert.Equal(t, username, claims.Username)
+}
+
+func TestConnectorDenied(t *testing.T) {
+	tests := []struct {
+		name          string
+		autoProvision bool
+		linkByEmail   bool
+		claims        map[string]any
+		// Почта локального пользователя, подтверждена ли она
+		localEmail    string
+		localVerified bool
+		deny          bool
+	}{
+		{name: "not linked", claims: map[string]any{"preferred_username": "stranger"}},
+		// Имя занято локальным пользователем, а связывать по имени нельзя
+		{name: "username taken", autoProvision: true, claims: map[string]any{"preferred_username": username}},
+		// Имена от провайдера проверяются так же, как при регистрации
+		{name: "invalid username", autoProvision: true, claims: map[string]any{"preferred_username": "partner user!"}},
+		{name: "short username", autoProvision: true, claims: map[string]any{"preferred_username": "pu"}},
+		{name: "username is not linked", linkByEmail: true, claims: map[string]any{"preferred_username": username}},
+		{
+			name:          "email is not verified by provider",
+			linkByEmail:   true,
+			claims:        map[string]any{"email": "user@example.com", "email_verified": false},
+			localEmail:    "user@example.com",
+			localVerified: true,
+		},
+		{
+			name:        "email is not verified locally",
+			linkByEmail: true,
+			claims:      map[string]any{"email": "user@example.com", "email_verified": true},
+			localEmail:  "user@example.com",
+		},
+		{
+			name:          "email linking is off",
+			claims:        map[string]any{"email": "user@example.com", "email_verified": true},
+			localEmail:    "user@example.com",
+			localVerified: true,
+		},
+		{name: "provider denied", autoProvision: true, claims: map[string]any{"preferred_username": "stranger"}, deny: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := mockoidc.New(t, connectorClientID, connectorClientSecret)
+			provider.SetUser("partner-1", tt.claims)
+			provider.Deny(tt.deny)
+
+			server, _, storage := newTestServerWithStorage(t, newConnector(provider, tt.autoProvision, tt.linkByEmail))
+
+			if tt.localEmail != "" {
+				setUserEmail(t, storage, tt.localEmail, tt.localVerified)
+			}
+
+			location := connectorLogin(t, server)
+			assert.Equal(t, "access_denied", location.Query().Get("error"), location.String())
+			assert.Equal(t, "xyz", location.Query().Get("state"))
+			assert.Empty(t, location.Query().Get("code"))
+		})
+	}
+}
+
+func TestConnectorCallbackRequiresStateCookie(t *testing.T) {
+	provider := mockoidc.New(t, connectorClientID, connectorClientSecret)
+	server, _ := newTestServer(t, newConnector(provider, true, false))
+
+	// Начинаем вход, но state попадает в чужой браузер без cookie
+	resp, err := noRedirectClient(server).Get(server.URL + "/connectors/partner/login?" + authorizeQuery().Encode())
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusFound, resp.StatusCode)
+
+	upstream, err := url.Parse(resp.Header.Get("Location"))
+	require.NoError(t, err)
+
+	resp, err = noRedirectClient(server).Get(server.URL + "/connectors/partner/callback?code=x&state=" + upstream.Query().Get("state"))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestConnectorUnknown(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	resp, err := noRedirectClient(server).Get(server.URL + "/connectors/missing/login?" + authorizeQuery().Encode())
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
@@ -0,0 +1,176 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/lib/logger/sl"
+	"shilka-sso/internal/services/device"
+	"shilka-sso/internal/services/oauth"
+	"strconv"
+)
+
+// Device методы входа устройств, которые необходимо реализовать хэндлерам
+type Device interface {
+	Authorize(ctx context.Context, clientID int, scope string) (device.Authorization, error)
+	ApproveWithPassword(ctx context.Context, userCode string, username string, password string, approved bool) (models.App, error)
+	Poll(ctx context.Context, clientID int, deviceCode string) (device.Token, error)
+}
+
+const (
+	deviceAuthorizationPath = "/device_authorization"
+	devicePath              = "/device"
+)
+
+// Страница, на которой пользователь вводит код с экрана устройства и подтверждает вход
+var devicePage = template.Must(template.New("device").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Вход на устройстве</title></head>
+<body>
+<h1>Вход на устройстве</h1>
+{{if .Error}}<p style="color: red">{{.Error}}</p>{{end}}
+{{if .Message}}<p>{{.Message}}</p>{{else}}<form method="post" action="/device">
+<label>Код с экрана устройства <input name="user_code" value="{{.UserCode}}" autocomplete="off" required></label>
+<label>Имя пользователя <input name="username" autocomplete="username" required></label>
+<label>Пароль <input name="password" type="password" autocomplete="current-password" required></label>
+<button type="submit" name="action" value="approve">Разрешить</button>
+<button type="submit" name="action" value="deny">Отклонить</button>
+</form>{{end}}
+</body>
+</html>
+`))
+
+// Ответ устройству с кодами, которые нужно показать пользователю (RFC 8628, раздел 3.2)
+func (s *Server) deviceAuthorization(w http.ResponseWriter, r *http.Request) {
+	clientID := r.PostFormValue("client_id")
+	if id, _, ok := r.BasicAuth(); ok {
+		clientID = id
+	}
+
+	appID, err := strconv.Atoi(clientID)
+	if err != nil {
+		writeTokenError(w, &oauth.Error{Code: oauth.CodeInvalidClient, Description: "client_id is required"})
+		return
+	}
+
+	authorization, err := s.device.Authorize(r.Context(), appID, r.PostFormValue("scope"))
+	if err != nil {
+		if errors.Is(err, device.ErrUnknownClient) {
+			writeTokenError(w, &oauth.Error{Code: oauth.CodeInvalidClient, Description: "unknown client"})
+			return
+		}
+
+		if errors.Is(err, device.ErrInvalidScope) {
+			writeTokenError(w, &oauth.Error{Code: oauth.CodeInvalidScope, Description: "scope is not allowed for the client"})
+			return
+		}
+
+		s.log.Error("Failed to start device authorization", sl.Err(err))
+		writeTokenError(w, &oauth.Error{Code: oauth.CodeServerError, Description: "internal error"})
+
+		return
+	}
+
+	verificationURI := s.oauth.Issuer() + devicePath
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"device_code":               authorization.DeviceCode,
+		"user_code":                 authorization.UserCode,
+		"verification_uri":          verificationURI,
+		"verification_uri_complete": verificationURI + "?" + url.Values{"user_code": {authorization.UserCode}}.Encode(),
+		"expires_in":                authorization.ExpiresIn,
+		"interval":                  authorization.Interval,
+	})
+}
+
+func (s *Server) devicePage(w http.ResponseWriter, r *http.Request) {
+	s.renderDevice(w, http.StatusOK, map[string]any{"UserCode": r.FormValue("user_code")})
+}
+
+func (s *Server) deviceApprove(w http.ResponseWriter, r *http.Request) {
+	userCode := r.PostFormValue("user_code")
+	approved := r.PostFormValue("action") == "approve"
+
+	app, err := s.device.ApproveWithPassword(r.Context(), userCode, r.PostFormValue("username"), r.PostFormValue("password"), approved)
+	if err != nil {
+		data := map[string]any{"UserCode": userCode}
+
+		switch {
+		case errors.Is(err, device.ErrInvalidUserCode):
+			data["Error"] = "Код не найден или устарел"
+			s.renderDevice(w, http.StatusBadRequest, data)
+		case errors.Is(err, device.ErrInvalidCredentials):
+			data["Error"] = "Неверное имя пользователя или пароль"
+			s.renderDevice(w, http.StatusUnauthorized, data)
+		case errors.Is(err, device.ErrAccountInactive):
+			data["Error"] = "Учётная запись заблокирована"
+			s.renderDevice(w, http.StatusForbidden, data)
+		default:
+			s.log.Error("Failed to resolve device authorization", sl.Err(err))
+			data["Error"] = "Внутренняя ошибка"
+			s.renderDevice(w, http.StatusInternalServerError, data)
+		}
+
+		return
+	}
+
+	message := "Вход в " + app.Name + " отклонён"
+	if approved {
+		message = "Вход в " + app.Name + " разрешён, вернитесь к устройству"
+	}
+
+	s.renderDevice(w, http.StatusOK, map[string]any{"Message": message})
+}
+
+// Опрос /token устройством
+func (s *Server) deviceToken(w http.ResponseWriter, r *http.Request) {
+	clientID, err := strconv.Atoi(r.PostFormValue("client_id"))
+	if err != nil {
+		writeTokenError(w, &oauth.Error{Code: oauth.CodeInvalidClient, Description: "client_id is required"})
+		return
+	}
+
+	token, err := s.device.Poll(r.Context(), clientID, r.PostFormValue("device_code"))
+	if err != nil {
+		// Ошибки опроса из RFC 8628 и invalid_scope совпадают с кодами, которые получает устройство
+		for _, pollErr := range []error{
+			device.ErrAuthorizationPending,
+			device.ErrSlowDown,
+			device.ErrAccessDenied,
+			device.ErrExpiredToken,
+			device.ErrInvalidGrant,
+			device.ErrInvalidScope,
+		} {
+			if errors.Is(err, pollErr) {
+				writeTokenError(w, &oauth.Error{Code: pollErr.Error()})
+				return
+			}
+		}
+
+		s.log.Error("Failed to poll device authorization", sl.Err(err))
+		writeTokenError(w, &oauth.Error{Code: oauth.CodeServerError, Description: "internal error"})
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": token.AccessToken,
+		"token_type":   "Bearer",
+		"expires_in":   token.ExpiresIn,
+		"scope":        token.Scope,
+	})
+}
+
+func (s *Server) renderDevice(w http.ResponseWriter, statusCode int, data map[string]any) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.WriteHeader(statusCode)
+
+	if err := devicePage.Execute(w, data); err != nil {
+		s.log.Error("Failed to render device page", sl.Err(err))
+	}
+}
@@ -0,0 +1,93 @@
+package oauth
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/url"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/lib/jwt"
+	"shilka-sso/internal/services/device"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func postForm(t *testing.T, server string, client *http.Client, path string, form url.Values) (int, map[string]any) {
+	t.Helper()
+
+	resp, err := client.PostForm(server+path, form)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	var body map[string]any
+	require.NoError(t, jsonDecode(resp, &body))
+
+	return resp.StatusCode, body
+}
+
+func TestDeviceFlow(t *testing.T) {
+	server, _ := newTestServer(t)
+	client := server.Client()
+
+	status, authorization := postForm(t, server.URL, client, "/device_authorization", url.Values{
+		"client_id": {strconv.Itoa(appID)},
+		"scope":     {"profile"},
+	})
+	require.Equal(t, http.StatusOK, status, authorization)
+	assert.Equal(t, server.URL+"/device", authorization["verification_uri"])
+
+	userCode := authorization["user_code"].(string)
+	assert.Regexp(t, `^[A-Z]{4}-[A-Z]{4}$`, userCode)
+
+	poll := func() (int, map[string]any) {
+		return postForm(t, server.URL, client, "/token", url.Values{
+			"grant_type":  {device.GrantType},
+			"client_id":   {strconv.Itoa(appID)},
+			"device_code": {authorization["device_code"].(string)},
+		})
+	}
+
+	status, body := poll()
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, "authorization_pending", body["error"])
+
+	// Страница подтверждения подставляет код из verification_uri_complete
+	resp, err := client.Get(authorization["verification_uri_complete"].(string))
+	require.NoError(t, err)
+	page, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	assert.Contains(t, string(page), userCode)
+
+	approve := func(password string) int {
+		resp, err := client.PostForm(server.URL+"/device", url.Values{
+			// Пользователь может ввести код без дефиса и строчными буквами
+			"user_code": {strings.ToLower(strings.ReplaceAll(userCode, "-", ""))},
+			"username":  {username},
+			"password":  {password},
+			"action":    {"approve"},
+		})
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		return resp.StatusCode
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, approve("wrong"))
+	require.Equal(t, http.StatusOK, approve(password))
+
+	status, body = poll()
+	require.Equal(t, http.StatusOK, status, body)
+	assert.Equal(t, "profile", body["scope"])
+
+	claims, err := jwt.ParseToken(body["access_token"].(string), models.App{Id: appID, Secret: appSecret})
+	require.NoError(t, err)
+	assert.Equal(t, username, claims.Username)
+
+	// Токен по коду выдаётся один раз
+	status, body = poll()
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, "invalid_grant", body["error"])
+}
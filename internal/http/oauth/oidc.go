@@ -0,0 +1,68 @@
+package oauth
+
+import (
+	"errors"
+	"net/http"
+	"shilka-sso/internal/lib/logger/sl"
+	"shilka-sso/internal/services/device"
+	"shilka-sso/internal/services/oauth"
+	"strings"
+)
+
+// Документ discovery из OpenID Connect Discovery 1.0
+func (s *Server) discovery(w http.ResponseWriter, r *http.Request) {
+	issuer := s.oauth.Issuer()
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"issuer":                                issuer,
+		"authorization_endpoint":                issuer + authorizePath,
+		"token_endpoint":                        issuer + tokenPath,
+		"userinfo_endpoint":                     issuer + userInfoPath,
+		"jwks_uri":                              issuer + jwksPath,
+		"device_authorization_endpoint":         issuer + deviceAuthorizationPath,
+		"response_types_supported":              []string{oauth.ResponseTypeCode},
+		"grant_types_supported":                 []string{oauth.GrantTypeAuthorization, oauth.GrantTypeClientCredentials, device.GrantType},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"scopes_supported":                      []string{oauth.ScopeOpenID, oauth.ScopeProfile},
+		"token_endpoint_auth_methods_supported": []string{"none", "client_secret_post", "client_secret_basic"},
+		"code_challenge_methods_supported":      []string{oauth.ChallengeMethodS256},
+		"claims_supported": []string{
+			"iss", "sub", "aud", "exp", "iat", "auth_time", "nonce", "at_hash", "preferred_username", "name",
+		},
+	})
+}
+
+func (s *Server) jwks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{"keys": s.oauth.JWKS()})
+}
+
+// Токен доступа передаётся в заголовке Authorization: Bearer, как требует RFC 6750
+func (s *Server) userInfo(w http.ResponseWriter, r *http.Request) {
+	accessToken, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || accessToken == "" {
+		w.Header().Set("WWW-Authenticate", `Bearer`)
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_request"})
+
+		return
+	}
+
+	info, err := s.oauth.UserInfo(r.Context(), accessToken)
+	if err != nil {
+		switch {
+		case errors.Is(err, oauth.ErrInvalidToken):
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_token"})
+		case errors.Is(err, oauth.ErrInsufficientScope):
+			w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope", scope="openid"`)
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "insufficient_scope"})
+		default:
+			s.log.Error("Failed to get user info", sl.Err(err))
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": oauth.CodeServerError})
+		}
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, info)
+}
@@ -0,0 +1,123 @@
+package oauth
+
+import (
+	"context"
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// Вход через стандартного клиента OpenID Connect без кода, написанного под sso
+func TestOIDC_StandardClient(t *testing.T) {
+	server, _ := newTestServer(t)
+	ctx := oidc.ClientContext(context.Background(), server.Client())
+
+	provider, err := oidc.NewProvider(ctx, server.URL)
+	require.NoError(t, err)
+
+	config := oauth2.Config{
+		ClientID:    strconv.Itoa(appID),
+		Endpoint:    provider.Endpoint(),
+		RedirectURL: redirectURI,
+		Scopes:      []string{oidc.ScopeOpenID, "profile"},
+	}
+
+	authURL, err := url.Parse(config.AuthCodeURL("xyz", oidc.Nonce("n-0S6_WzA2Mj"), oauth2.S256ChallengeOption(verifier)))
+	require.NoError(t, err)
+
+	form := authURL.Query()
+	form.Set("username", username)
+	form.Set("password", password)
+
+	resp, err := noRedirectClient(server).PostForm(server.URL+"/authorize", form)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	code := codeFromRedirect(t, resp)
+
+	token, err := config.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	require.NoError(t, err)
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	require.True(t, ok)
+
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: config.ClientID}).Verify(ctx, rawIDToken)
+	require.NoError(t, err)
+	assert.Equal(t, "n-0S6_WzA2Mj", idToken.Nonce)
+	require.NoError(t, idToken.VerifyAccessToken(token.AccessToken))
+
+	var claims struct {
+		AuthTime int64 `json:"auth_time"`
+	}
+	require.NoError(t, idToken.Claims(&claims))
+	assert.WithinDuration(t, time.Now(), time.Unix(claims.AuthTime, 0), time.Minute)
+
+	userInfo, err := provider.UserInfo(ctx, oauth2.StaticTokenSource(token))
+	require.NoError(t, err)
+	assert.Equal(t, idToken.Subject, userInfo.Subject)
+
+	var profile struct {
+		PreferredUsername string `json:"preferred_username"`
+	}
+	require.NoError(t, userInfo.Claims(&profile))
+	assert.Equal(t, username, profile.PreferredUsername)
+}
+
+// Без scope profile /userinfo отдаёт только sub, а без openid не отдаёт ничего
+func TestUserInfo_DependsOnScope(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	accessToken := func(scope string) string {
+		form := authorizeQuery()
+		form.Set("scope", scope)
+		form.Set("username", username)
+		form.Set("password", password)
+
+		resp, err := noRedirectClient(server).PostForm(server.URL+"/authorize", form)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		status, body := exchange(t, server, codeFromRedirect(t, resp), verifier)
+		require.Equal(t, http.StatusOK, status, body)
+
+		if scope == "openid" {
+			assert.NotEmpty(t, body["id_token"])
+		} else {
+			assert.Nil(t, body["id_token"])
+		}
+
+		return body["access_token"].(string)
+	}
+
+	userInfo := func(token string) (int, map[string]any) {
+		req, err := http.NewRequest(http.MethodGet, server.URL+"/userinfo", nil)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		resp, err := server.Client().Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		var body map[string]any
+		require.NoError(t, jsonDecode(resp, &body))
+
+		return resp.StatusCode, body
+	}
+
+	status, body := userInfo(accessToken("openid"))
+	require.Equal(t, http.StatusOK, status)
+	assert.NotEmpty(t, body["sub"])
+	assert.NotContains(t, body, "preferred_username")
+
+	status, _ = userInfo(accessToken("profile"))
+	assert.Equal(t, http.StatusForbidden, status)
+
+	status, _ = userInfo("garbage")
+	assert.Equal(t, http.StatusUnauthorized, status)
+}
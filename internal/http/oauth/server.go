@@ -0,0 +1,357 @@
+// Package oauth HTTP хэндлеры сервера авторизации OAuth и провайдера OpenID Connect
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/lib/keys"
+	"shilka-sso/internal/lib/logger/sl"
+	"shilka-sso/internal/services/device"
+	"shilka-sso/internal/services/oauth"
+	"shilka-sso/internal/services/serviceaccounts"
+	"strconv"
+)
+
+// OAuth методы, которые необходимо реализовать хэндлерам
+type OAuth interface {
+	Client(ctx context.Context, clientID int, redirectURI string) (models.App, error)
+	ValidateAuthorizeRequest(ctx context.Context, req oauth.AuthorizeRequest) (models.App, error)
+	Authorize(ctx context.Context, req oauth.AuthorizeRequest, username string, password string) (string, error)
+	Exchange(ctx context.Context, req oauth.TokenRequest) (oauth.Token, error)
+	UserInfo(ctx context.Context, accessToken string) (map[string]any, error)
+	Issuer() string
+	JWKS() []keys.JWK
+}
+
+// ServiceAccounts выдача токенов сервисным аккаунтам по client credentials
+type ServiceAccounts interface {
+	IssueToken(ctx context.Context, clientID string, clientSecret string, scope string) (serviceaccounts.Token, error)
+}
+
+type Server struct {
+	log             *slog.Logger
+	oauth           OAuth
+	serviceAccounts ServiceAccounts
+	device          Device
+	federation      Federation
+}
+
+// Services сервисы, которые используют хэндлеры
+type Services struct {
+	OAuth           OAuth
+	ServiceAccounts ServiceAccounts
+	Device          Device
+	Federation      Federation
+}
+
+// Пути эндпоинтов, они же публикуются в документе discovery
+const (
+	authorizePath = "/authorize"
+	tokenPath     = "/token"
+	userInfoPath  = "/userinfo"
+	jwksPath      = "/.well-known/jwks.json"
+	discoveryPath = "/.well-known/openid-configuration"
+)
+
+// Register Регистрирует хэндлеры OAuth и OpenID Connect
+func Register(mux *http.ServeMux, log *slog.Logger, services Services) {
+	s := &Server{
+		log:             log,
+		oauth:           services.OAuth,
+		serviceAccounts: services.ServiceAccounts,
+		device:          services.Device,
+		federation:      services.Federation,
+	}
+
+	mux.HandleFunc("GET "+authorizePath, s.authorizePage)
+	mux.HandleFunc("POST "+authorizePath, s.authorize)
+	mux.HandleFunc("POST "+tokenPath, s.token)
+
+	mux.HandleFunc("GET "+discoveryPath, s.discovery)
+	mux.HandleFunc("GET "+jwksPath, s.jwks)
+	mux.HandleFunc("GET "+userInfoPath, s.userInfo)
+	mux.HandleFunc("POST "+userInfoPath, s.userInfo)
+
+	mux.HandleFunc("POST "+deviceAuthorizationPath, s.deviceAuthorization)
+	mux.HandleFunc("GET "+devicePath, s.devicePage)
+	mux.HandleFunc("POST "+devicePath, s.deviceApprove)
+
+	mux.HandleFunc("GET "+connectorLoginPath, s.connectorLogin)
+	mux.HandleFunc("GET "+connectorCallbackPath, s.connectorCallback)
+}
+
+// Страница входа, которую пользователь видит вместо формы стороннего приложения
+var loginPage = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Вход - {{.AppName}}</title></head>
+<body>
+<h1>Вход в {{.AppName}}</h1>
+{{if .Error}}<p style="color: red">{{.Error}}</p>{{end}}
+<form method="post" action="/authorize">
+{{range $name, $value := .Params}}<input type="hidden" name="{{$name}}" value="{{$value}}">
+{{end}}<label>Имя пользователя <input name="username" autocomplete="username" required></label>
+<label>Пароль <input name="password" type="password" autocomplete="current-password" required></label>
+<button type="submit">Войти</button>
+</form>
+{{range .Connectors}}<p><a href="{{.URL}}">Войти через {{.Name}}</a></p>
+{{end}}</body>
+</html>
+`))
+
+var errorPage = template.Must(template.New("error").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Ошибка входа</title></head>
+<body><h1>Ошибка входа</h1><p>{{.}}</p></body>
+</html>
+`))
+
+// Параметры /authorize, которые форма входа передаёт обратно
+var authorizeParams = []string{
+	"response_type", "client_id", "redirect_uri", "scope", "state", "code_challenge", "code_challenge_method", "nonce",
+}
+
+func (s *Server) authorizePage(w http.ResponseWriter, r *http.Request) {
+	req := parseAuthorizeRequest(r)
+
+	app, err := s.oauth.ValidateAuthorizeRequest(r.Context(), req)
+	if err != nil {
+		s.authorizeError(w, r, req, err)
+		return
+	}
+
+	s.renderLogin(w, r, http.StatusOK, app.Name, "")
+}
+
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request) {
+	req := parseAuthorizeRequest(r)
+
+	code, err := s.oauth.Authorize(r.Context(), req, r.PostFormValue("username"), r.PostFormValue("password"))
+	if err != nil {
+		if errors.Is(err, oauth.ErrInvalidCredentials) {
+			app, err := s.oauth.ValidateAuthorizeRequest(r.Context(), req)
+			if err != nil {
+				s.authorizeError(w, r, req, err)
+				return
+			}
+
+			s.renderLogin(w, r, http.StatusUnauthorized, app.Name, "Неверное имя пользователя или пароль")
+
+			return
+		}
+
+		s.authorizeError(w, r, req, err)
+		return
+	}
+
+	redirect(w, r, req.RedirectURI, url.Values{
+		"code":  {code},
+		"state": {req.State},
+	})
+}
+
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	switch r.PostFormValue("grant_type") {
+	case oauth.GrantTypeClientCredentials:
+		s.clientCredentials(w, r)
+		return
+	case device.GrantType:
+		s.deviceToken(w, r)
+		return
+	}
+
+	req := oauth.TokenRequest{
+		GrantType:    r.PostFormValue("grant_type"),
+		Code:         r.PostFormValue("code"),
+		RedirectURI:  r.PostFormValue("redirect_uri"),
+		ClientSecret: r.PostFormValue("client_secret"),
+		CodeVerifier: r.PostFormValue("code_verifier"),
+	}
+
+	clientID := r.PostFormValue("client_id")
+
+	// Конфиденциальные клиенты могут передать id и секрет через Basic авторизацию
+	if id, secret, ok := r.BasicAuth(); ok {
+		clientID, req.ClientSecret = id, secret
+	}
+
+	var err error
+	if req.ClientID, err = strconv.Atoi(clientID); err != nil {
+		writeTokenError(w, &oauth.Error{Code: oauth.CodeInvalidClient, Description: "client_id is required"})
+		return
+	}
+
+	token, err := s.oauth.Exchange(r.Context(), req)
+	if err != nil {
+		var oauthErr *oauth.Error
+		if errors.As(err, &oauthErr) {
+			writeTokenError(w, oauthErr)
+			return
+		}
+
+		s.log.Error("Failed to exchange authorization code", sl.Err(err))
+		writeTokenError(w, &oauth.Error{Code: oauth.CodeServerError, Description: "internal error"})
+
+		return
+	}
+
+	body := map[string]any{
+		"access_token": token.AccessToken,
+		"token_type":   token.TokenType,
+		"expires_in":   token.ExpiresIn,
+		"scope":        token.Scope,
+	}
+
+	if token.IDToken != "" {
+		body["id_token"] = token.IDToken
+	}
+
+	writeJSON(w, http.StatusOK, body)
+}
+
+// Токен сервисного аккаунта, client id и секрет передаются в форме или через Basic авторизацию
+func (s *Server) clientCredentials(w http.ResponseWriter, r *http.Request) {
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		clientID, clientSecret = r.PostFormValue("client_id"), r.PostFormValue("client_secret")
+	}
+
+	if clientID == "" || clientSecret == "" {
+		writeTokenError(w, &oauth.Error{Code: oauth.CodeInvalidClient, Description: "client_id and client_secret are required"})
+		return
+	}
+
+	token, err := s.serviceAccounts.IssueToken(r.Context(), clientID, clientSecret, r.PostFormValue("scope"))
+	if err != nil {
+		switch {
+		case errors.Is(err, serviceaccounts.ErrInvalidClient):
+			writeTokenError(w, &oauth.Error{Code: oauth.CodeInvalidClient, Description: "client authentication failed"})
+		case errors.Is(err, serviceaccounts.ErrInvalidScope):
+			writeTokenError(w, &oauth.Error{Code: oauth.CodeInvalidScope, Description: "requested scope is not allowed for the client"})
+		default:
+			s.log.Error("Failed to issue service account token", sl.Err(err))
+			writeTokenError(w, &oauth.Error{Code: oauth.CodeServerError, Description: "internal error"})
+		}
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": token.AccessToken,
+		"token_type":   "Bearer",
+		"expires_in":   token.ExpiresIn,
+		"scope":        token.Scope,
+	})
+}
+
+// Ошибку отправляем на redirect_uri только если он проверен, иначе показываем её пользователю
+func (s *Server) authorizeError(w http.ResponseWriter, r *http.Request, req oauth.AuthorizeRequest, err error) {
+	var oauthErr *oauth.Error
+	if !errors.As(err, &oauthErr) {
+		s.log.Error("Failed to authorize", sl.Err(err))
+
+		oauthErr = &oauth.Error{Code: oauth.CodeServerError, Description: "internal error"}
+	}
+
+	if _, clientErr := s.oauth.Client(r.Context(), req.ClientID, req.RedirectURI); clientErr != nil {
+		errors.As(clientErr, &oauthErr)
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusBadRequest)
+		_ = errorPage.Execute(w, oauthErr.Description)
+
+		return
+	}
+
+	redirect(w, r, req.RedirectURI, url.Values{
+		"error":             {oauthErr.Code},
+		"error_description": {oauthErr.Description},
+		"state":             {req.State},
+	})
+}
+
+// Статус пишется после заголовков, иначе они не попадут в ответ
+func (s *Server) renderLogin(w http.ResponseWriter, r *http.Request, statusCode int, appName string, errorMessage string) {
+	params := make(map[string]string, len(authorizeParams))
+	for _, name := range authorizeParams {
+		params[name] = r.FormValue(name)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.WriteHeader(statusCode)
+
+	err := loginPage.Execute(w, map[string]any{
+		"AppName":    appName,
+		"Error":      errorMessage,
+		"Params":     params,
+		"Connectors": s.connectorLinks(params),
+	})
+	if err != nil {
+		s.log.Error("Failed to render login page", sl.Err(err))
+	}
+}
+
+func parseAuthorizeRequest(r *http.Request) oauth.AuthorizeRequest {
+	clientID, _ := strconv.Atoi(r.FormValue("client_id"))
+
+	return oauth.AuthorizeRequest{
+		ResponseType:        r.FormValue("response_type"),
+		ClientID:            clientID,
+		RedirectURI:         r.FormValue("redirect_uri"),
+		Scope:               r.FormValue("scope"),
+		State:               r.FormValue("state"),
+		CodeChallenge:       r.FormValue("code_challenge"),
+		CodeChallengeMethod: r.FormValue("code_challenge_method"),
+		Nonce:               r.FormValue("nonce"),
+	}
+}
+
+func redirect(w http.ResponseWriter, r *http.Request, redirectURI string, params url.Values) {
+	target, err := url.Parse(redirectURI)
+	if err != nil {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	query := target.Query()
+	for name, values := range params {
+		if values[0] != "" {
+			query.Set(name, values[0])
+		}
+	}
+	target.RawQuery = query.Encode()
+
+	http.Redirect(w, r, target.String(), http.StatusFound)
+}
+
+func writeTokenError(w http.ResponseWriter, err *oauth.Error) {
+	statusCode := http.StatusBadRequest
+
+	switch err.Code {
+	case oauth.CodeInvalidClient:
+		statusCode = http.StatusUnauthorized
+	case oauth.CodeServerError:
+		statusCode = http.StatusInternalServerError
+	}
+
+	writeJSON(w, statusCode, map[string]string{
+		"error":             err.Code,
+		"error_description": err.Description,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	w.WriteHeader(statusCode)
+
+	_ = json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,353 @@
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/lib/jwt"
+	"shilka-sso/internal/lib/usernames"
+	"shilka-sso/internal/services/auth"
+	"shilka-sso/internal/services/device"
+	"shilka-sso/internal/services/federation"
+	"shilka-sso/internal/services/oauth"
+	"shilka-sso/internal/services/serviceaccounts"
+	"shilka-sso/internal/storage/sqlite"
+	"shilka-sso/internal/storage/sqlite/sqlitetest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	appID       = 1
+	appSecret   = "4urka"
+	redirectURI = "https://app.example.com/callback"
+	username    = "shilka"
+	password    = "password"
+	verifier    = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+)
+
+type nopAuditor struct{}
+
+func (nopAuditor) Record(context.Context, string, int64, int, map[string]any) error {
+	return nil
+}
+
+var (
+	signingKey     *rsa.PrivateKey
+	signingKeyOnce sync.Once
+)
+
+// Генерация RSA ключа медленная, поэтому ключ общий для всех тестов
+func testSigningKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+
+	signingKeyOnce.Do(func() {
+		var err error
+
+		signingKey, err = rsa.GenerateKey(rand.Reader, 2048)
+		require.NoError(t, err)
+	})
+
+	return signingKey
+}
+
+func newTestServer(t *testing.T, connectors ...federation.Connector) (*httptest.Server, *serviceaccounts.ServiceAccounts) {
+	t.Helper()
+
+	server, serviceAccounts, _ := newTestServerWithStorage(t, connectors...)
+
+	return server, serviceAccounts
+}
+
+// То же, что newTestServer, но тесту нужна бд, например чтобы поменять настройки приложения
+func newTestServerWithStorage(t *testing.T, connectors ...federation.Connector) (*httptest.Server, *serviceaccounts.ServiceAccounts, *sqlite.Storage) {
+	t.Helper()
+
+	ctx := context.Background()
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	storage, path := sqlitetest.New(t)
+	sqlitetest.SaveApp(t, path, models.App{Id: appID, Name: "test", Secret: appSecret})
+	require.NoError(t, storage.SetAppRedirectURIs(ctx, appID, []string{redirectURI}))
+
+	passHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	_, err = storage.SaveUser(ctx, username, passHash)
+	require.NoError(t, err)
+
+	usernamePolicy := usernames.NewPolicy(3, 32, nil)
+	authService := auth.New(log, storage, nopAuditor{}, time.Hour, usernamePolicy, testSigningKey(t))
+
+	// issuer должен совпадать с адресом сервера, а он известен только после запуска
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	oauthService := oauth.New(log, authService, authService, storage, testSigningKey(t), server.URL, time.Minute, time.Hour)
+	serviceAccounts := serviceaccounts.New(log, storage, nopAuditor{}, time.Hour)
+	deviceService := device.New(log, authService, storage, time.Minute, 0, time.Hour)
+	federationService := federation.New(
+		log,
+		oauthService,
+		storage,
+		nopAuditor{},
+		usernamePolicy,
+		connectors,
+		server.URL,
+		time.Minute,
+		server.Client(),
+	)
+
+	Register(mux, log, Services{
+		OAuth:           oauthService,
+		ServiceAccounts: serviceAccounts,
+		Device:          deviceService,
+		Federation:      federationService,
+	})
+
+	return server, serviceAccounts, storage
+}
+
+// Клиент, который не ходит по редиректам, чтобы тест видел Location
+func noRedirectClient(server *httptest.Server) *http.Client {
+	client := server.Client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	return client
+}
+
+func authorizeQuery() url.Values {
+	sum := sha256.Sum256([]byte(verifier))
+
+	return url.Values{
+		"response_type":         {"code"},
+		"client_id":             {strconv.Itoa(appID)},
+		"redirect_uri":          {redirectURI},
+		"scope":                 {"profile"},
+		"state":                 {"xyz"},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(sum[:])},
+		"code_challenge_method": {"S256"},
+	}
+}
+
+func login(t *testing.T, server *httptest.Server, password string) *http.Response {
+	t.Helper()
+
+	form := authorizeQuery()
+	form.Set("username", username)
+	form.Set("password", password)
+
+	resp, err := noRedirectClient(server).PostForm(server.URL+"/authorize", form)
+	require.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+
+	return resp
+}
+
+func exchange(t *testing.T, server *httptest.Server, code string, verifier string) (int, map[string]any) {
+	t.Helper()
+
+	resp, err := server.Client().PostForm(server.URL+"/token", url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURI},
+		"client_id":     {strconv.Itoa(appID)},
+		"code_verifier": {verifier},
+	})
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, "no-store", resp.Header.Get("Cache-Control"))
+
+	var body map[string]any
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+
+	return resp.StatusCode, body
+}
+
+func codeFromRedirect(t *testing.T, resp *http.Response) string {
+	t.Helper()
+
+	require.Equal(t, http.StatusFound, resp.StatusCode)
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(location.String(), redirectURI+"?"))
+	assert.Equal(t, "xyz", location.Query().Get("state"))
+
+	code := location.Query().Get("code")
+	require.NotEmpty(t, code)
+
+	return code
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	resp, err := server.Client().Get(server.URL + "/authorize?" + authorizeQuery().Encode())
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	page, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, string(page), `name="password"`)
+
+	code := codeFromRedirect(t, login(t, server, password))
+
+	status, body := exchange(t, server, code, verifier)
+	require.Equal(t, http.StatusOK, status, body)
+	assert.Equal(t, "Bearer", body["token_type"])
+	assert.Equal(t, "profile", body["scope"])
+
+	claims, err := jwt.ParseToken(body["access_token"].(string), models.App{Id: appID, Secret: appSecret})
+	require.NoError(t, err)
+	assert.Equal(t, username, claims.Username)
+
+	// Код одноразовый
+	status, body = exchange(t, server, code, verifier)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, oauth.CodeInvalidGrant, body["error"])
+}
+
+func TestToken_WrongVerifier(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	code := codeFromRedirect(t, login(t, server, password))
+
+	status, body := exchange(t, server, code, strings.Repeat("a", 43))
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, oauth.CodeInvalidGrant, body["error"])
+}
+
+func TestAuthorize_WrongPassword(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	resp := login(t, server, "wrong")
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Empty(t, resp.Header.Get("Location"))
+
+	// Страница с ошибкой уходит с теми же заголовками, что и обычная страница входа
+	assert.Equal(t, "text/html; charset=utf-8", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "no-store", resp.Header.Get("Cache-Control"))
+	assert.Equal(t, "DENY", resp.Header.Get("X-Frame-Options"))
+}
+
+func TestAuthorize_InvalidScope(t *testing.T) {
+	server, _, storage := newTestServerWithStorage(t)
+
+	tests := []struct {
+		name   string
+		scopes []string
+		scope  string
+	}{
+		{name: "unknown scope", scope: "openid admin"},
+		{name: "not allowed for the client", scopes: []string{"openid", "orders:read"}, scope: "profile"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.NoError(t, storage.SetAppScopes(context.Background(), appID, tt.scopes))
+
+			params := authorizeQuery()
+			params.Set("scope", tt.scope)
+
+			resp, err := noRedirectClient(server).Get(server.URL + "/authorize?" + params.Encode())
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			require.Equal(t, http.StatusFound, resp.StatusCode)
+
+			location, err := url.Parse(resp.Header.Get("Location"))
+			require.NoError(t, err)
+			assert.Equal(t, oauth.CodeInvalidScope, location.Query().Get("error"))
+		})
+	}
+
+	// Собственный scope приложения разрешён
+	require.NoError(t, storage.SetAppScopes(context.Background(), appID, []string{"profile", "orders:read"}))
+
+	form := authorizeQuery()
+	form.Set("scope", "profile orders:read")
+	form.Set("username", username)
+	form.Set("password", password)
+
+	resp, err := noRedirectClient(server).PostForm(server.URL+"/authorize", form)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	code := codeFromRedirect(t, resp)
+
+	status, body := exchange(t, server, code, verifier)
+	require.Equal(t, http.StatusOK, status, body)
+	assert.Equal(t, "profile orders:read", body["scope"])
+}
+
+// Scope, который у приложения отобрали после выдачи кода, не попадает в токен
+func TestToken_ScopeNoLongerAllowed(t *testing.T) {
+	server, _, storage := newTestServerWithStorage(t)
+
+	code := codeFromRedirect(t, login(t, server, password))
+
+	require.NoError(t, storage.SetAppScopes(context.Background(), appID, []string{"openid"}))
+
+	status, body := exchange(t, server, code, verifier)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, oauth.CodeInvalidScope, body["error"])
+}
+
+// На незарегистрированный redirect_uri ошибку отправлять нельзя
+func TestAuthorize_UnregisteredRedirectURI(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	params := authorizeQuery()
+	params.Set("redirect_uri", "https://evil.example.com/callback")
+
+	resp, err := noRedirectClient(server).Get(server.URL + "/authorize?" + params.Encode())
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Empty(t, resp.Header.Get("Location"))
+}
+
+// Ошибку в остальных параметрах получает клиент на redirect_uri
+func TestAuthorize_MissingChallengeRedirectsWithError(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	params := authorizeQuery()
+	params.Del("code_challenge")
+
+	resp, err := noRedirectClient(server).Get(server.URL + "/authorize?" + params.Encode())
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusFound, resp.StatusCode)
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	require.NoError(t, err)
+	assert.Equal(t, oauth.CodeInvalidRequest, location.Query().Get("error"))
+	assert.Equal(t, "xyz", location.Query().Get("state"))
+}
+
+func jsonDecode(resp *http.Response, v any) error {
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,197 @@
+// Package auditchain Подсчёт хэшей для цепочки записей аудита
+package auditchain
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"shilka-sso/internal/domain/models"
+	"slices"
+	"time"
+)
+
+// GenesisHash хэш, на который ссылается самая первая запись цепочки
+var GenesisHash = make([]byte, sha256.Size)
+
+// Длина соли персонального поля
+const saltSize = 16
+
+// NewRecord Собирает запись аудита с payload в JSON. Каждое персональное поле payload получает свою соль,
+// поэтому после удаления данных по хэшу поля нельзя подобрать исходное значение
+func NewRecord(event string, userID int64, appID int, payload map[string]any, createdAt time.Time) (models.AuditRecord, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return models.AuditRecord{}, err
+	}
+
+	salts := make(map[string][]byte)
+
+	for _, field := range models.AuditPersonalFields {
+		if _, ok := payload[field]; !ok {
+			continue
+		}
+
+		salt := make([]byte, saltSize)
+		if _, err := rand.Read(salt); err != nil {
+			return models.AuditRecord{}, err
+		}
+
+		salts[field] = salt
+	}
+
+	return models.AuditRecord{
+		Event:      event,
+		UserId:     userID,
+		AppId:      appID,
+		Payload:    string(data),
+		FieldSalts: salts,
+		CreatedAt:  createdAt,
+	}, nil
+}
+
+// RecordHash Считает хэш записи. В хэш входят все поля записи кроме самого Hash,
+// поэтому изменение любого поля или порядка записей ломает цепочку.
+// Payload входит в хэш хэшами своих полей, так что поле, заменённое Redact на его хэш, хэш записи не меняет.
+// Записи без FieldSalts написаны до появления хэшей полей, у них в хэш входит весь Payload как есть
+func RecordHash(r models.AuditRecord) []byte {
+	h := sha256.New()
+
+	writeInt(h, r.Id)
+	writeInt(h, r.CreatedAt.UnixNano())
+	writeBytes(h, []byte(r.Event))
+	writeInt(h, r.UserId)
+	writeInt(h, int64(r.AppId))
+
+	if r.FieldSalts == nil {
+		writeBytes(h, []byte(r.Payload))
+	} else {
+		writeBytes(h, payloadDigest(r))
+	}
+
+	writeBytes(h, r.PrevHash)
+
+	return h.Sum(nil)
+}
+
+// Redact Убирает из записи персональные данные. Поле с солью заменяется хэшем, который входил в хэш записи,
+// а соль удаляется, поэтому запись по-прежнему сходится со своим Hash. В записях без FieldSalts
+// поля заменяются псевдонимом, такие записи подтверждаются только записью user.erased
+func Redact(r models.AuditRecord, pseudonym string, redactedAt time.Time) (models.AuditRecord, error) {
+	payload := make(map[string]json.RawMessage)
+	if r.Payload != "" {
+		if err := json.Unmarshal([]byte(r.Payload), &payload); err != nil {
+			return models.AuditRecord{}, fmt.Errorf("audit record %d: %w", r.Id, err)
+		}
+	}
+
+	salts := maps.Clone(r.FieldSalts)
+
+	for _, field := range models.AuditPersonalFields {
+		value, ok := payload[field]
+		if !ok {
+			continue
+		}
+
+		replacement := pseudonym
+
+		if salts != nil {
+			salt, ok := salts[field]
+			if !ok || salt == nil {
+				// Поле без соли не персональное или уже заменено хэшем
+				continue
+			}
+
+			replacement = hex.EncodeToString(fieldDigest(salt, field, value))
+			salts[field] = nil
+		}
+
+		encoded, err := json.Marshal(replacement)
+		if err != nil {
+			return models.AuditRecord{}, err
+		}
+
+		payload[field] = encoded
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return models.AuditRecord{}, err
+	}
+
+	r.Payload = string(data)
+	r.FieldSalts = salts
+	r.RedactedAt = redactedAt
+
+	return r, nil
+}
+
+// CheckpointDigest Возвращает данные чекпоинта, которые подписываются ключом сервера
+func CheckpointDigest(recordID int64, hash []byte) []byte {
+	h := sha256.New()
+
+	writeInt(h, recordID)
+	writeBytes(h, hash)
+
+	return h.Sum(nil)
+}
+
+// Хэш payload из хэшей полей по порядку имён. Если payload не объект JSON, хэшируется как есть
+func payloadDigest(r models.AuditRecord) []byte {
+	h := sha256.New()
+
+	var payload map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(r.Payload), &payload); err != nil && r.Payload != "" {
+		writeBytes(h, []byte(r.Payload))
+
+		return h.Sum(nil)
+	}
+
+	for _, field := range slices.Sorted(maps.Keys(payload)) {
+		writeBytes(h, []byte(field))
+		writeBytes(h, storedDigest(r.FieldSalts, field, payload[field]))
+	}
+
+	return h.Sum(nil)
+}
+
+// Хэш поля: у поля, заменённого Redact, это его значение, у остальных - хэш значения с солью поля
+func storedDigest(salts map[string][]byte, field string, value json.RawMessage) []byte {
+	salt, ok := salts[field]
+	if ok && salt == nil {
+		var encoded string
+		if err := json.Unmarshal(value, &encoded); err == nil {
+			if digest, err := hex.DecodeString(encoded); err == nil {
+				return digest
+			}
+		}
+	}
+
+	return fieldDigest(salt, field, value)
+}
+
+func fieldDigest(salt []byte, field string, value json.RawMessage) []byte {
+	h := sha256.New()
+
+	writeBytes(h, salt)
+	writeBytes(h, []byte(field))
+	writeBytes(h, value)
+
+	return h.Sum(nil)
+}
+
+func writeInt(w io.Writer, v int64) {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(v))
+	_, _ = w.Write(buf[:])
+}
+
+// Длина пишется перед данными, чтобы ("ab", "c") и ("a", "bc") давали разные хэши
+func writeBytes(w io.Writer, b []byte) {
+	writeInt(w, int64(len(b)))
+	_, _ = w.Write(b)
+}
@@ -0,0 +1,327 @@
+// Package backup Формат файла резервной копии бд: заголовок, затем снимок бд, по желанию сжатый gzip
+// и зашифрованный AES-256-GCM. Шифруется поблочно, поэтому копия любого размера не держится в памяти целиком
+package backup
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Options Как упаковать снимок. Key - ключ AES-256, без него копия не шифруется
+type Options struct {
+	Compress bool
+	Key      []byte
+}
+
+var (
+	ErrNotBackup   = errors.New("not a backup file")
+	ErrKeyRequired = errors.New("backup is encrypted, key is required")
+	ErrCorrupted   = errors.New("backup is corrupted or the key is wrong")
+)
+
+const (
+	magic   = "SSOBAK"
+	version = 1
+
+	flagCompressed = 1 << 0
+	flagEncrypted  = 1 << 1
+
+	// Сколько открытых данных шифруется в одном блоке
+	chunkSize = 64 << 10
+	keySize   = 32
+)
+
+// Write Упаковывает src в dst
+func Write(dst io.Writer, src io.Reader, opts Options) error {
+	header := []byte{magic[0], magic[1], magic[2], magic[3], magic[4], magic[5], version, 0}
+
+	var nonce []byte
+
+	if opts.Key != nil {
+		header[7] |= flagEncrypted
+
+		nonce = make([]byte, 12)
+		if _, err := rand.Read(nonce); err != nil {
+			return err
+		}
+	}
+
+	if opts.Compress {
+		header[7] |= flagCompressed
+	}
+
+	if _, err := dst.Write(append(header, nonce...)); err != nil {
+		return err
+	}
+
+	var w io.WriteCloser = nopCloser{dst}
+
+	if opts.Key != nil {
+		aead, err := newAEAD(opts.Key)
+		if err != nil {
+			return err
+		}
+
+		w = &sealWriter{dst: dst, aead: aead, nonce: nonce, header: header}
+	}
+
+	encrypted := w
+
+	if opts.Compress {
+		w = gzip.NewWriter(encrypted)
+	}
+
+	if _, err := io.Copy(w, src); err != nil {
+		return err
+	}
+
+	if opts.Compress {
+		if err := w.Close(); err != nil {
+			return err
+		}
+	}
+
+	return encrypted.Close()
+}
+
+// Read Распаковывает копию из src в dst. key нужен только для зашифрованной копии
+func Read(dst io.Writer, src io.Reader, key []byte) error {
+	header := make([]byte, len(magic)+2)
+	if _, err := io.ReadFull(src, header); err != nil || string(header[:len(magic)]) != magic {
+		return ErrNotBackup
+	}
+
+	if header[6] != version {
+		return fmt.Errorf("unsupported backup version %d", header[6])
+	}
+
+	flags := header[7]
+	r := src
+
+	if flags&flagEncrypted != 0 {
+		if key == nil {
+			return ErrKeyRequired
+		}
+
+		nonce := make([]byte, 12)
+		if _, err := io.ReadFull(src, nonce); err != nil {
+			return ErrCorrupted
+		}
+
+		aead, err := newAEAD(key)
+		if err != nil {
+			return err
+		}
+
+		r = &openReader{src: src, aead: aead, nonce: nonce, header: header}
+	}
+
+	if flags&flagCompressed != 0 {
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return corrupted(err)
+		}
+
+		r = zr
+	}
+
+	if _, err := io.Copy(dst, r); err != nil {
+		return corrupted(err)
+	}
+
+	return nil
+}
+
+// LoadKey Читает ключ из файла: 32 байта в hex, например из openssl rand -hex 32
+func LoadKey(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(key) != keySize {
+		return nil, fmt.Errorf("backup key must be %d hex-encoded bytes", keySize)
+	}
+
+	return key, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != keySize {
+		return nil, fmt.Errorf("backup key must be %d bytes", keySize)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// Ошибки формата gzip и обрезанный файл означают повреждённую копию, остальные возвращаются как есть
+func corrupted(err error) error {
+	if errors.Is(err, ErrCorrupted) || errors.Is(err, gzip.ErrHeader) || errors.Is(err, gzip.ErrChecksum) ||
+		errors.Is(err, io.ErrUnexpectedEOF) {
+		return ErrCorrupted
+	}
+
+	return err
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+// Nonce блока - nonce файла, последние 8 байт которого сложены по xor с номером блока.
+// В доп. данные блока входят заголовок и признак последнего блока, поэтому ни флаги, ни обрезку файла
+// нельзя подменить незаметно
+func chunkNonce(base []byte, counter uint64) []byte {
+	nonce := bytes.Clone(base)
+
+	var n [8]byte
+	binary.BigEndian.PutUint64(n[:], counter)
+
+	for i := range n {
+		nonce[4+i] ^= n[i]
+	}
+
+	return nonce
+}
+
+func chunkAD(header []byte, final bool) []byte {
+	ad := append(bytes.Clone(header), 0)
+	if final {
+		ad[len(ad)-1] = 1
+	}
+
+	return ad
+}
+
+// Каждый блок пишется как длина шифротекста (4 байта) и сам шифротекст.
+// Последний блок пишется всегда, даже пустой
+type sealWriter struct {
+	dst     io.Writer
+	aead    cipher.AEAD
+	nonce   []byte
+	header  []byte
+	counter uint64
+	buf     []byte
+}
+
+func (w *sealWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+
+	// Полный блок остаётся в буфере, пока не станет ясно, последний ли он
+	for len(w.buf) > chunkSize {
+		if err := w.seal(w.buf[:chunkSize], false); err != nil {
+			return 0, err
+		}
+
+		w.buf = w.buf[chunkSize:]
+	}
+
+	return len(p), nil
+}
+
+func (w *sealWriter) Close() error {
+	return w.seal(w.buf, true)
+}
+
+func (w *sealWriter) seal(chunk []byte, final bool) error {
+	sealed := w.aead.Seal(nil, chunkNonce(w.nonce, w.counter), chunk, chunkAD(w.header, final))
+	w.counter++
+
+	var size [4]byte
+	binary.BigEndian.PutUint32(size[:], uint32(len(sealed)))
+
+	if _, err := w.dst.Write(size[:]); err != nil {
+		return err
+	}
+
+	_, err := w.dst.Write(sealed)
+
+	return err
+}
+
+type openReader struct {
+	src     io.Reader
+	aead    cipher.AEAD
+	nonce   []byte
+	header  []byte
+	counter uint64
+	buf     []byte
+	final   bool
+}
+
+func (r *openReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.final {
+			// После последнего блока данных быть не должно
+			if n, _ := r.src.Read(make([]byte, 1)); n > 0 {
+				return 0, ErrCorrupted
+			}
+
+			return 0, io.EOF
+		}
+
+		if err := r.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+
+	return n, nil
+}
+
+func (r *openReader) open() error {
+	var size [4]byte
+	if _, err := io.ReadFull(r.src, size[:]); err != nil {
+		return ErrCorrupted
+	}
+
+	n := binary.BigEndian.Uint32(size[:])
+	if n > chunkSize+uint32(r.aead.Overhead()) {
+		return ErrCorrupted
+	}
+
+	sealed := make([]byte, n)
+	if _, err := io.ReadFull(r.src, sealed); err != nil {
+		return ErrCorrupted
+	}
+
+	nonce := chunkNonce(r.nonce, r.counter)
+	r.counter++
+
+	if plain, err := r.aead.Open(nil, nonce, sealed, chunkAD(r.header, false)); err == nil {
+		r.buf = plain
+		return nil
+	}
+
+	plain, err := r.aead.Open(nil, nonce, sealed, chunkAD(r.header, true))
+	if err != nil {
+		return ErrCorrupted
+	}
+
+	r.buf = plain
+	r.final = true
+
+	return nil
+}
@@ -0,0 +1,69 @@
+package backup
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestWriteRead(t *testing.T) {
+	key := make([]byte, keySize)
+	_, err := rand.Read(key)
+	require.NoError(t, err)
+
+	// Пустой файл, меньше блока, ровно блок и несколько блоков с хвостом
+	sizes := []int{0, 100, chunkSize, 3*chunkSize + 17}
+
+	for _, opts := range []Options{{}, {Compress: true}, {Key: key}, {Compress: true, Key: key}} {
+		for _, size := range sizes {
+			t.Run(fmt.Sprintf("compress=%t/encrypt=%t/%d", opts.Compress, opts.Key != nil, size), func(t *testing.T) {
+				data := make([]byte, size)
+				_, err := rand.Read(data)
+				require.NoError(t, err)
+
+				var packed bytes.Buffer
+				require.NoError(t, Write(&packed, bytes.NewReader(data), opts))
+
+				var unpacked bytes.Buffer
+				require.NoError(t, Read(&unpacked, bytes.NewReader(packed.Bytes()), opts.Key))
+				assert.True(t, bytes.Equal(data, unpacked.Bytes()))
+			})
+		}
+	}
+}
+
+func TestReadEncrypted(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, keySize)
+	data := bytes.Repeat([]byte("sqlite"), chunkSize)
+
+	var packed bytes.Buffer
+	require.NoError(t, Write(&packed, bytes.NewReader(data), Options{Key: key}))
+	archive := packed.Bytes()
+
+	read := func(archive []byte, key []byte) error {
+		var out bytes.Buffer
+		return Read(&out, bytes.NewReader(archive), key)
+	}
+
+	assert.ErrorIs(t, read(archive, nil), ErrKeyRequired)
+	assert.ErrorIs(t, read(archive, bytes.Repeat([]byte{2}, keySize)), ErrCorrupted)
+	assert.ErrorIs(t, read([]byte("SQLite format 3\x00"), key), ErrNotBackup)
+
+	// Обрезка по границе блока: все оставшиеся блоки целы, но последнего нет
+	firstChunk := 8 + 12 + 4 + chunkSize + 16
+	assert.ErrorIs(t, read(archive[:firstChunk], key), ErrCorrupted)
+	assert.ErrorIs(t, read(archive[:len(archive)-1], key), ErrCorrupted)
+	assert.ErrorIs(t, read(append(bytes.Clone(archive), 0), key), ErrCorrupted)
+
+	// Флаг сжатия входит в доп. данные блоков, подменить его нельзя
+	tampered := bytes.Clone(archive)
+	tampered[7] |= flagCompressed
+	assert.ErrorIs(t, read(tampered, key), ErrCorrupted)
+
+	tampered = bytes.Clone(archive)
+	tampered[len(tampered)/2] ^= 1
+	assert.ErrorIs(t, read(tampered, key), ErrCorrupted)
+}
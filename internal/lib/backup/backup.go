@@ -0,0 +1,131 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// Snapshotter Хранилище, которое умеет записать согласованный снимок бд в файл, не останавливая работу
+type Snapshotter interface {
+	Snapshot(ctx context.Context, path string) error
+}
+
+// Create Снимает бд во временный файл рядом с path и упаковывает его в path. Пока копия не записана целиком,
+// она лежит под временным именем, поэтому по path никогда не окажется недописанный файл.
+// Существующий файл не перезаписывается, вместо этого возвращается ошибка с fs.ErrExist.
+// Возвращает размер копии
+func Create(ctx context.Context, storage Snapshotter, path string, opts Options) (int64, error) {
+	dir := filepath.Dir(path)
+
+	snapshot, err := tempPath(dir, filepath.Base(path)+".snapshot-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(snapshot)
+
+	if err := storage.Snapshot(ctx, snapshot); err != nil {
+		return 0, err
+	}
+
+	src, err := os.Open(snapshot)
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+
+	dst, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(dst.Name())
+
+	if err := Write(dst, src, opts); err != nil {
+		dst.Close()
+		return 0, err
+	}
+
+	if err := syncClose(dst); err != nil {
+		return 0, err
+	}
+
+	info, err := os.Stat(dst.Name())
+	if err != nil {
+		return 0, err
+	}
+
+	// В отличие от rename, link не заменяет уже существующий path
+	if err := os.Link(dst.Name(), path); err != nil {
+		return 0, err
+	}
+
+	return info.Size(), nil
+}
+
+// Restore Распаковывает копию src рядом с бд dbPath, проверяет её через validate и подменяет ею бд.
+// Прежняя бд вместе с файлами -wal и -shm остаётся рядом с суффиксом .before-restore.
+// Сервис при этом должен быть остановлен
+func Restore(ctx context.Context, src string, dbPath string, key []byte, validate func(ctx context.Context, path string) error) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.CreateTemp(filepath.Dir(dbPath), filepath.Base(dbPath)+".restore-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(out.Name())
+
+	if err := Read(out, in, key); err != nil {
+		out.Close()
+		return err
+	}
+
+	if err := syncClose(out); err != nil {
+		return err
+	}
+
+	if err := validate(ctx, out.Name()); err != nil {
+		return err
+	}
+
+	for _, suffix := range []string{"", "-wal", "-shm"} {
+		previous := dbPath + ".before-restore" + suffix
+
+		if err := os.Remove(previous); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+
+		if err := os.Rename(dbPath+suffix, previous); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	return os.Rename(out.Name(), dbPath)
+}
+
+// Свободное имя файла в dir. Сам файл не создаётся: VACUUM INTO пишет только в несуществующий файл
+func tempPath(dir, pattern string) (string, error) {
+	f, err := os.CreateTemp(dir, pattern)
+	if err != nil {
+		return "", err
+	}
+
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+
+	return f.Name(), os.Remove(f.Name())
+}
+
+func syncClose(f *os.File) error {
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
@@ -0,0 +1,124 @@
+package backup_test
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"shilka-sso/internal/lib/backup"
+	"shilka-sso/internal/storage"
+	"shilka-sso/internal/storage/sqlite"
+	"shilka-sso/internal/storage/sqlite/sqlitetest"
+	"testing"
+)
+
+func TestCreateRestore(t *testing.T) {
+	ctx := context.Background()
+	st, path := sqlitetest.New(t)
+	key := make([]byte, 32)
+
+	_, err := st.SaveUser(ctx, "ivan", []byte("hash"))
+	require.NoError(t, err)
+
+	archive := filepath.Join(t.TempDir(), "sso.backup")
+
+	size, err := backup.Create(ctx, st, archive, backup.Options{Compress: true, Key: key})
+	require.NoError(t, err)
+
+	info, err := os.Stat(archive)
+	require.NoError(t, err)
+	assert.Equal(t, info.Size(), size)
+
+	// Изменения после копии пропадут при восстановлении
+	_, err = st.SaveUser(ctx, "petr", []byte("hash"))
+	require.NoError(t, err)
+	require.NoError(t, st.Close())
+
+	var schema sqlite.Schema
+
+	err = backup.Restore(ctx, archive, path, key, func(ctx context.Context, path string) error {
+		schema, err = sqlite.Inspect(ctx, path, "migrations")
+		return err
+	})
+	require.NoError(t, err)
+	assert.NotZero(t, schema.Version)
+	assert.False(t, schema.Dirty)
+
+	restored, err := sqlite.New(path, sqlite.Config{})
+	require.NoError(t, err)
+	defer restored.Close()
+
+	_, err = restored.GetUser(ctx, "ivan")
+	assert.NoError(t, err)
+
+	_, err = restored.GetUser(ctx, "petr")
+	assert.ErrorIs(t, err, storage.ErrUserNotFound)
+
+	_, err = os.Stat(path + ".before-restore")
+	assert.NoError(t, err)
+}
+
+func TestCreateExisting(t *testing.T) {
+	ctx := context.Background()
+	st, _ := sqlitetest.New(t)
+
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "sso.backup")
+
+	_, err := backup.Create(ctx, st, archive, backup.Options{})
+	require.NoError(t, err)
+
+	before, err := os.ReadFile(archive)
+	require.NoError(t, err)
+
+	_, err = backup.Create(ctx, st, archive, backup.Options{Compress: true})
+	assert.ErrorIs(t, err, fs.ErrExist)
+
+	// Прежняя копия цела, временных файлов не осталось
+	after, err := os.ReadFile(archive)
+	require.NoError(t, err)
+	assert.Equal(t, before, after)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestRestoreValidation(t *testing.T) {
+	ctx := context.Background()
+	st, path := sqlitetest.New(t)
+
+	archive := filepath.Join(t.TempDir(), "sso.backup")
+
+	_, err := backup.Create(ctx, st, archive, backup.Options{})
+	require.NoError(t, err)
+
+	_, err = st.SaveUser(ctx, "ivan", []byte("hash"))
+	require.NoError(t, err)
+
+	// Проверка не прошла - бд остаётся на месте, временных файлов рядом не остаётся
+	rejected := errors.New("rejected")
+
+	err = backup.Restore(ctx, archive, path, nil, func(context.Context, string) error { return rejected })
+	assert.ErrorIs(t, err, rejected)
+
+	_, err = st.GetUser(ctx, "ivan")
+	assert.NoError(t, err)
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+
+	for _, entry := range entries {
+		assert.NotContains(t, entry.Name(), ".restore-")
+	}
+
+	// Файл, который не является бд sqlite, не проходит проверку целостности
+	garbage := filepath.Join(t.TempDir(), "garbage.db")
+	require.NoError(t, os.WriteFile(garbage, []byte("not a database"), 0o600))
+
+	_, err = sqlite.Inspect(ctx, garbage, "migrations")
+	assert.Error(t, err)
+}
@@ -0,0 +1,99 @@
+// Package identifiers Разбор идентификаторов, по которым пользователь входит: имени, почты и телефона
+// Вид идентификатора определяется по записи: почта содержит "@", телефон начинается с "+",
+// всё остальное считается именем. В именах эти символы запрещены правилами usernames, поэтому виды не пересекаются
+package identifiers
+
+import (
+	"errors"
+	"golang.org/x/text/unicode/norm"
+	"net/mail"
+	"shilka-sso/internal/domain/models"
+	"strings"
+	"unicode/utf8"
+)
+
+// Ошибки разбора
+var (
+	ErrInvalidEmail = errors.New("invalid email address")
+	ErrInvalidPhone = errors.New("invalid phone number")
+)
+
+const (
+	maxEmailLength = 254
+	minPhoneDigits = 8
+	maxPhoneDigits = 15
+)
+
+// Kind Вид идентификатора, который ввёл пользователь
+func Kind(login string) string {
+	login = strings.TrimSpace(login)
+
+	switch {
+	case strings.Contains(login, "@"):
+		return models.IdentifierEmail
+	case strings.HasPrefix(login, "+"):
+		return models.IdentifierPhone
+	}
+
+	return models.IdentifierUsername
+}
+
+// Canonical Проверяет почту или телефон и возвращает каноническую форму для поиска и уникальности
+// Почта приводится к нижнему регистру целиком, телефон - к виду "+79991234567" без пробелов, скобок и дефисов
+func Canonical(kind string, value string) (string, error) {
+	switch kind {
+	case models.IdentifierEmail:
+		return email(value)
+	case models.IdentifierPhone:
+		return phone(value)
+	}
+
+	return "", errors.New("unknown identifier kind " + kind)
+}
+
+func email(value string) (string, error) {
+	value = strings.ToLower(norm.NFC.String(strings.TrimSpace(value)))
+
+	if utf8.RuneCountInString(value) > maxEmailLength {
+		return "", ErrInvalidEmail
+	}
+
+	// Имя отправителя и угловые скобки mail пропускает, но в идентификаторе им не место
+	addr, err := mail.ParseAddress(value)
+	if err != nil || addr.Name != "" || addr.Address != value {
+		return "", ErrInvalidEmail
+	}
+
+	at := strings.LastIndex(value, "@")
+	if at == 0 || !strings.Contains(value[at+1:], ".") {
+		return "", ErrInvalidEmail
+	}
+
+	return value, nil
+}
+
+func phone(value string) (string, error) {
+	value = strings.TrimSpace(value)
+
+	if !strings.HasPrefix(value, "+") {
+		return "", ErrInvalidPhone
+	}
+
+	digits := make([]byte, 0, maxPhoneDigits)
+
+	for _, r := range value[1:] {
+		switch {
+		case r >= '0' && r <= '9':
+			digits = append(digits, byte(r))
+		case r == ' ' || r == '-' || r == '(' || r == ')':
+		default:
+			return "", ErrInvalidPhone
+		}
+	}
+
+	if len(digits) < minPhoneDigits || len(digits) > maxPhoneDigits || digits[0] == '0' {
+		return "", ErrInvalidPhone
+	}
+
+	return "+" + string(digits), nil
+}
@@ -0,0 +1,44 @@
+package identifiers
+
+import (
+	"github.com/stretchr/testify/assert"
+	"shilka-sso/internal/domain/models"
+	"testing"
+)
+
+func TestKind(t *testing.T) {
+	assert.Equal(t, models.IdentifierEmail, Kind("ivan@example.com"))
+	assert.Equal(t, models.IdentifierPhone, Kind(" +7 999 123-45-67"))
+	assert.Equal(t, models.IdentifierUsername, Kind("ivan"))
+	assert.Equal(t, models.IdentifierUsername, Kind("79991234567"))
+}
+
+func TestCanonical(t *testing.T) {
+	tests := []struct {
+		kind      string
+		value     string
+		canonical string
+		err       error
+	}{
+		{kind: models.IdentifierEmail, value: " Ivan.Petrov@Example.COM ", canonical: "ivan.petrov@example.com"},
+		{kind: models.IdentifierEmail, value: "ivan@localhost", err: ErrInvalidEmail},
+		{kind: models.IdentifierEmail, value: "Ivan <ivan@example.com>", err: ErrInvalidEmail},
+		{kind: models.IdentifierEmail, value: "@example.com", err: ErrInvalidEmail},
+		{kind: models.IdentifierPhone, value: "+7 (999) 123-45-67", canonical: "+79991234567"},
+		{kind: models.IdentifierPhone, value: "89991234567", err: ErrInvalidPhone},
+		{kind: models.IdentifierPhone, value: "+7 999 CALL-NOW", err: ErrInvalidPhone},
+		{kind: models.IdentifierPhone, value: "+0123456789", err: ErrInvalidPhone},
+		{kind: models.IdentifierPhone, value: "+1234567", err: ErrInvalidPhone},
+	}
+
+	for _, tt := range tests {
+		canonical, err := Canonical(tt.kind, tt.value)
+		if tt.err != nil {
+			assert.ErrorIs(t, err, tt.err, tt.value)
+			continue
+		}
+
+		assert.NoError(t, err, tt.value)
+		assert.Equal(t, tt.canonical, canonical, tt.value)
+	}
+}
@@ -1,13 +1,25 @@
 package jwt
 
 import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
 	"github.com/golang-jwt/jwt/v5"
 	"shilka-sso/internal/domain/models"
+	"slices"
+	"strings"
 	"time"
 )
 
 // NewToken Создаёт  JWT токен, который хранит в себе инофрмацию о пользователе
 func NewToken(user models.User, app models.App, duration time.Duration) (string, error) {
+	return NewScopedToken(user, app, duration, "")
+}
+
+// NewScopedToken Создаёт токен как NewToken и записывает в него выданные через OAuth scope
+func NewScopedToken(user models.User, app models.App, duration time.Duration, scope string) (string, error) {
 
 	token := jwt.New(jwt.SigningMethodHS256)
 
@@ -17,6 +29,10 @@ func NewToken(user models.User, app models.App, duration time.Duration) (string,
 	claims["exp"] = time.Now().Add(duration).Unix()
 	claims["app_id"] = app.Id
 
+	if scope != "" {
+		claims["scope"] = scope
+	}
+
 	tokenString, err := token.SignedString([]byte(app.Secret))
 
 	if err != nil {
@@ -25,3 +41,249 @@ func NewToken(user models.User, app models.App, duration time.Duration) (string,
 
 	return tokenString, nil
 }
+
+// Способы входа для claim amr (RFC 8176)
+const (
+	AMRPassword    = "pwd"
+	AMRHardwareKey = "hwk"
+	AMRMultiFactor = "mfa"
+)
+
+// NewTokenWithAMR Создаёт токен как NewToken и записывает в него способы, которыми пользователь подтвердил вход
+// По amr приложение может потребовать второй фактор
+func NewTokenWithAMR(user models.User, app models.App, duration time.Duration, amr []string) (string, error) {
+	token := jwt.New(jwt.SigningMethodHS256)
+
+	claims := token.Claims.(jwt.MapClaims)
+	claims["user_id"] = user.Id
+	claims["username"] = user.Username
+	claims["exp"] = time.Now().Add(duration).Unix()
+	claims["app_id"] = app.Id
+	claims["amr"] = amr
+
+	return token.SignedString([]byte(app.Secret))
+}
+
+// NewServiceToken Создаёт токен сервисного аккаунта приложения
+// В токене нет user_id, вместо него service_account_id, по которому токен отличается от пользовательского
+func NewServiceToken(account models.ServiceAccount, app models.App, duration time.Duration, scope string) (string, error) {
+	token := jwt.New(jwt.SigningMethodHS256)
+
+	claims := token.Claims.(jwt.MapClaims)
+	claims["service_account_id"] = account.Id
+	claims["client_id"] = account.ClientId
+	claims["exp"] = time.Now().Add(duration).Unix()
+	claims["app_id"] = app.Id
+
+	if scope != "" {
+		claims["scope"] = scope
+	}
+
+	return token.SignedString([]byte(app.Secret))
+}
+
+// AdminAudience aud токенов для gRPC API самого sso. Только с такими токенами (и личными токенами
+// со scope admin) пускают к методам администрирования
+const AdminAudience = "sso-admin"
+
+// NewAdminToken Создаёт токен для gRPC API самого sso, подписанный ключом сервера алгоритмом RS256
+// В отличие от токенов приложений его не подделать, зная секрет какого-нибудь приложения
+func NewAdminToken(key *rsa.PrivateKey, keyID string, user models.User, duration time.Duration) (string, error) {
+	now := time.Now()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"aud":      AdminAudience,
+		"user_id":  user.Id,
+		"username": user.Username,
+		"iat":      now.Unix(),
+		"exp":      now.Add(duration).Unix(),
+	})
+	token.Header["kid"] = keyID
+
+	return token.SignedString(key)
+}
+
+// IsAdminToken Сообщает без проверки подписи, что токен подписан ключом сервера, а не секретом приложения
+// Нужен только чтобы выбрать, чем его проверять: ParseAdminToken или ParseToken
+func IsAdminToken(tokenString string) bool {
+	token, _, err := jwt.NewParser().ParseUnverified(tokenString, jwt.MapClaims{})
+
+	return err == nil && token.Method.Alg() == jwt.SigningMethodRS256.Alg()
+}
+
+// ParseAdminToken Проверяет подпись, aud и срок действия токена, выданного NewAdminToken
+func ParseAdminToken(tokenString string, key *rsa.PublicKey) (Claims, error) {
+	claims := jwt.MapClaims{}
+
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return key, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg()}),
+		jwt.WithAudience(AdminAudience),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return Claims{}, fmt.Errorf("%w: %s", ErrInvalidToken, err)
+	}
+
+	userID, _ := claims["user_id"].(float64)
+	username, _ := claims["username"].(string)
+
+	if userID == 0 {
+		return Claims{}, fmt.Errorf("%w: user_id claim is missing", ErrInvalidToken)
+	}
+
+	return Claims{
+		UserID:   int64(userID),
+		Username: username,
+		Audience: AdminAudience,
+	}, nil
+}
+
+// ErrInvalidToken токен не прошёл проверку
+var ErrInvalidToken = errors.New("invalid token")
+
+// Claims Данные о пользователе, которые хранятся в токене
+type Claims struct {
+	UserID   int64
+	Username string
+	AppID    int
+	// Scope через пробел, пустой у токенов, выданных не через OAuth
+	Scope string
+	// ServiceAccountID не равен 0 у токенов сервисных аккаунтов, UserID у них 0
+	ServiceAccountID int64
+	// PersonalTokenID не равен 0 у личных токенов доступа, AppID у них 0
+	PersonalTokenID int64
+	// AMR способы входа, пустой у токенов, выданных без NewTokenWithAMR
+	AMR []string
+	// Audience равен AdminAudience у токенов API самого sso, у токенов приложений пустой
+	Audience string
+}
+
+// IsServiceAccount Токен выдан сервисному аккаунту, а не пользователю
+func (c Claims) IsServiceAccount() bool {
+	return c.ServiceAccountID != 0
+}
+
+// IsPersonalToken Это личный токен доступа пользователя, а не токен, выданный при входе
+func (c Claims) IsPersonalToken() bool {
+	return c.PersonalTokenID != 0
+}
+
+// IsAdminAPI Токен выдан для gRPC API самого sso, а не для приложения
+func (c Claims) IsAdminAPI() bool {
+	return c.Audience == AdminAudience
+}
+
+// HasScope Проверяет, что токену выдан scope name
+func (c Claims) HasScope(name string) bool {
+	return slices.Contains(strings.Fields(c.Scope), name)
+}
+
+// AppID Достаёт id приложения из токена без проверки подписи
+// Нужен, чтобы найти секрет приложения, которым подписан токен
+func AppID(tokenString string) (int, error) {
+	claims := jwt.MapClaims{}
+
+	if _, _, err := jwt.NewParser().ParseUnverified(tokenString, claims); err != nil {
+		return 0, fmt.Errorf("%w: %s", ErrInvalidToken, err)
+	}
+
+	appID, ok := claims["app_id"].(float64)
+	if !ok {
+		return 0, fmt.Errorf("%w: app_id claim is missing", ErrInvalidToken)
+	}
+
+	return int(appID), nil
+}
+
+// ParseToken Проверяет подпись и срок действия токена, выданного для app
+func ParseToken(tokenString string, app models.App) (Claims, error) {
+	claims := jwt.MapClaims{}
+
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(app.Secret), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil {
+		return Claims{}, fmt.Errorf("%w: %s", ErrInvalidToken, err)
+	}
+
+	userID, _ := claims["user_id"].(float64)
+	username, _ := claims["username"].(string)
+	appID, _ := claims["app_id"].(float64)
+	scope, _ := claims["scope"].(string)
+	serviceAccountID, _ := claims["service_account_id"].(float64)
+
+	var amr []string
+	if values, ok := claims["amr"].([]any); ok {
+		for _, value := range values {
+			if method, ok := value.(string); ok {
+				amr = append(amr, method)
+			}
+		}
+	}
+
+	if int(appID) != app.Id {
+		return Claims{}, fmt.Errorf("%w: token was issued for another app", ErrInvalidToken)
+	}
+
+	return Claims{
+		UserID:           int64(userID),
+		Username:         username,
+		AppID:            int(appID),
+		Scope:            scope,
+		ServiceAccountID: int64(serviceAccountID),
+		AMR:              amr,
+	}, nil
+}
+
+// IDTokenClaims Данные ID токена OpenID Connect
+type IDTokenClaims struct {
+	Issuer   string
+	Subject  string
+	Audience string
+	Nonce    string
+	AuthTime time.Time
+	// Токен доступа, выданный вместе с ID токеном, от него считается at_hash
+	AccessToken string
+	// Дополнительные claims, которые зависят от выданных scope
+	Extra map[string]any
+}
+
+// NewIDToken Создаёт ID токен, подписанный ключом сервера алгоритмом RS256
+// keyID попадает в заголовок kid, по нему клиент находит ключ в JWKS
+func NewIDToken(key *rsa.PrivateKey, keyID string, idClaims IDTokenClaims, duration time.Duration) (string, error) {
+	now := time.Now()
+
+	claims := jwt.MapClaims{}
+	for name, value := range idClaims.Extra {
+		claims[name] = value
+	}
+
+	claims["iss"] = idClaims.Issuer
+	claims["sub"] = idClaims.Subject
+	claims["aud"] = idClaims.Audience
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(duration).Unix()
+	claims["auth_time"] = idClaims.AuthTime.Unix()
+
+	if idClaims.Nonce != "" {
+		claims["nonce"] = idClaims.Nonce
+	}
+
+	if idClaims.AccessToken != "" {
+		claims["at_hash"] = AtHash(idClaims.AccessToken)
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = keyID
+
+	return token.SignedString(key)
+}
+
+// AtHash Считает at_hash: левая половина SHA-256 от токена доступа в base64url
+func AtHash(accessToken string) string {
+	sum := sha256.Sum256([]byte(accessToken))
+
+	return base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2])
+}
@@ -0,0 +1,429 @@
+// Package passwords Хэши паролей. Новые пароли хэшируются bcrypt, а хэши, перенесённые из других систем,
+// хранятся в своём формате и проверяются при входе, пока пользователь не войдёт и не получит bcrypt-хэш.
+// Формат хэша определяется по его префиксу:
+//
+//	$2a$10$...                                    bcrypt
+//	$argon2id$v=19$m=65536,t=3,p=4$<соль>$<хэш>   argon2id и argon2i (PHC, base64 без паддинга)
+//	$pbkdf2-sha256$i=27500$<соль>$<хэш>           pbkdf2-sha256 и pbkdf2-sha512 (base64 без паддинга)
+//	$md5-salted$<соль>$<md5 hex>                  md5(соль + пароль) из старых PHP систем, соль в base64
+package passwords
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/pbkdf2"
+	"hash"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrUnsupportedHash = errors.New("unsupported password hash format")
+	ErrInvalidHash     = errors.New("invalid password hash")
+)
+
+// Меньше итераций pbkdf2 считается слабым хэшем (рекомендации OWASP)
+const (
+	minPBKDF2SHA256Iterations = 600000
+	minPBKDF2SHA512Iterations = 210000
+)
+
+// Предельные параметры argon2. Память задаётся в КиБ и тратится на каждую проверку пароля,
+// поэтому импортированный хэш с огромными m, t или p превратил бы каждый вход в отказ в обслуживании
+const (
+	maxArgon2Memory      = 1 << 20 // 1 ГиБ
+	maxArgon2Iterations  = 16
+	maxArgon2Parallelism = 16
+)
+
+var b64 = base64.RawStdEncoding
+
+// Hash Возвращает bcrypt-хэш нового пароля
+func Hash(password string) ([]byte, error) {
+	return bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+}
+
+// Verify Проверяет пароль по хэшу любого поддерживаемого формата
+// Пустой хэш у пользователей из внешних источников не подходит ни к какому паролю
+func Verify(hash []byte, password string) bool {
+	s, err := parse(string(hash))
+	if err != nil {
+		return false
+	}
+
+	return s.verify(password)
+}
+
+// NeedsUpgrade Сообщает, что хэш слабый и при следующем входе его нужно заменить на bcrypt:
+// salted md5, pbkdf2 с малым числом итераций и bcrypt с низкой стоимостью
+func NeedsUpgrade(hash []byte) bool {
+	s, err := parse(string(hash))
+	if err != nil {
+		return false
+	}
+
+	return s.weak()
+}
+
+// Import Приводит хэш из другой системы к формату, в котором он хранится, и проверяет, что его можно разобрать.
+// Кроме форматов пакета принимаются хэши passlib ($pbkdf2-sha256$29000$...) и Django (pbkdf2_sha256$...).
+// salt задаётся только для salted md5, тогда hash - md5(salt + пароль) в hex
+func Import(hash string, salt string) ([]byte, error) {
+	hash = strings.TrimSpace(hash)
+
+	if salt != "" {
+		digest, err := hex.DecodeString(hash)
+		if err != nil || len(digest) != md5.Size {
+			return nil, fmt.Errorf("%w: salt is only supported with md5 hex digest", ErrInvalidHash)
+		}
+
+		return []byte(md5Salted{salt: []byte(salt), digest: digest}.String()), nil
+	}
+
+	var s scheme
+
+	switch {
+	case strings.HasPrefix(hash, "$pbkdf2-sha256$"), strings.HasPrefix(hash, "$pbkdf2-sha512$"):
+		p, err := parsePasslib(hash)
+		if err != nil {
+			return nil, err
+		}
+
+		s = p
+	case strings.HasPrefix(hash, "pbkdf2_sha256$"):
+		p, err := parseDjango(hash)
+		if err != nil {
+			return nil, err
+		}
+
+		s = p
+	default:
+		p, err := parse(hash)
+		if err != nil {
+			return nil, err
+		}
+
+		s = p
+	}
+
+	return []byte(s.String()), nil
+}
+
+// PBKDF2 Хэш pbkdf2 из отдельных полей, как их хранит, например, Keycloak. algorithm - sha256 или sha512
+func PBKDF2(algorithm string, iterations int, salt []byte, key []byte) ([]byte, error) {
+	p := pbkdf2Hash{algorithm: algorithm, iterations: iterations, salt: salt, key: key}
+
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+
+	return []byte(p.String()), nil
+}
+
+// Argon2 Хэш argon2 из отдельных полей. variant - id или i
+func Argon2(variant string, memory uint32, iterations uint32, parallelism uint8, salt []byte, key []byte) ([]byte, error) {
+	a := argon2Hash{variant: variant, memory: memory, iterations: iterations, parallelism: parallelism, salt: salt, key: key}
+
+	if err := a.validate(); err != nil {
+		return nil, err
+	}
+
+	return []byte(a.String()), nil
+}
+
+// Разобранный хэш одного из форматов
+type scheme interface {
+	verify(password string) bool
+	weak() bool
+	// Хэш в формате хранения
+	String() string
+}
+
+func parse(hash string) (scheme, error) {
+	switch {
+	case hash == "":
+		return nil, ErrInvalidHash
+	case strings.HasPrefix(hash, "$2"):
+		return parseBcrypt(hash)
+	case strings.HasPrefix(hash, "$argon2"):
+		return parseArgon2(hash)
+	case strings.HasPrefix(hash, "$pbkdf2-"):
+		return parsePBKDF2(hash)
+	case strings.HasPrefix(hash, "$md5-salted$"):
+		return parseMD5Salted(hash)
+	}
+
+	return nil, ErrUnsupportedHash
+}
+
+type bcryptHash string
+
+func parseBcrypt(hash string) (scheme, error) {
+	if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidHash, err)
+	}
+
+	return bcryptHash(hash), nil
+}
+
+func (b bcryptHash) verify(password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(b), []byte(password)) == nil
+}
+
+func (b bcryptHash) weak() bool {
+	cost, _ := bcrypt.Cost([]byte(b))
+
+	return cost < bcrypt.DefaultCost
+}
+
+func (b bcryptHash) String() string {
+	return string(b)
+}
+
+type argon2Hash struct {
+	variant     string
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+	salt        []byte
+	key         []byte
+}
+
+func parseArgon2(hash string) (scheme, error) {
+	// "", argon2id, v=19, m=65536,t=3,p=4, соль, хэш
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[2] != fmt.Sprintf("v=%d", argon2.Version) {
+		return nil, ErrInvalidHash
+	}
+
+	a := argon2Hash{variant: strings.TrimPrefix(parts[1], "argon2")}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &a.memory, &a.iterations, &a.parallelism); err != nil {
+		return nil, ErrInvalidHash
+	}
+
+	var err error
+
+	if a.salt, err = decodeBase64(parts[4]); err != nil {
+		return nil, ErrInvalidHash
+	}
+
+	if a.key, err = decodeBase64(parts[5]); err != nil {
+		return nil, ErrInvalidHash
+	}
+
+	if err := a.validate(); err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+func (a argon2Hash) validate() error {
+	if a.variant != "id" && a.variant != "i" {
+		return fmt.Errorf("%w: argon2%s", ErrUnsupportedHash, a.variant)
+	}
+
+	if a.memory == 0 || a.iterations == 0 || a.parallelism == 0 || len(a.salt) == 0 || len(a.key) == 0 {
+		return ErrInvalidHash
+	}
+
+	if a.memory > maxArgon2Memory || a.iterations > maxArgon2Iterations || a.parallelism > maxArgon2Parallelism {
+		return fmt.Errorf("%w: argon2 parameters m=%d,t=%d,p=%d exceed m=%d,t=%d,p=%d",
+			ErrInvalidHash, a.memory, a.iterations, a.parallelism, maxArgon2Memory, maxArgon2Iterations, maxArgon2Parallelism)
+	}
+
+	return nil
+}
+
+func (a argon2Hash) verify(password string) bool {
+	derive := argon2.IDKey
+	if a.variant == "i" {
+		derive = argon2.Key
+	}
+
+	key := derive([]byte(password), a.salt, a.iterations, a.memory, a.parallelism, uint32(len(a.key)))
+
+	return subtle.ConstantTimeCompare(key, a.key) == 1
+}
+
+func (a argon2Hash) weak() bool {
+	return false
+}
+
+func (a argon2Hash) String() string {
+	return fmt.Sprintf("$argon2%s$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		a.variant, argon2.Version, a.memory, a.iterations, a.parallelism, b64.EncodeToString(a.salt), b64.EncodeToString(a.key))
+}
+
+type pbkdf2Hash struct {
+	// sha256 или sha512
+	algorithm  string
+	iterations int
+	salt       []byte
+	key        []byte
+}
+
+func parsePBKDF2(hash string) (scheme, error) {
+	// "", pbkdf2-sha256, i=27500, соль, хэш
+	parts := strings.Split(hash, "$")
+	if len(parts) != 5 || !strings.HasPrefix(parts[2], "i=") {
+		return nil, ErrInvalidHash
+	}
+
+	return newPBKDF2(parts[1], strings.TrimPrefix(parts[2], "i="), parts[3], parts[4], decodeBase64)
+}
+
+// passlib: $pbkdf2-sha256$29000$<соль>$<хэш>, base64 с "." вместо "+"
+func parsePasslib(hash string) (scheme, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) == 5 && strings.HasPrefix(parts[2], "i=") {
+		return parsePBKDF2(hash)
+	}
+
+	if len(parts) != 5 {
+		return nil, ErrInvalidHash
+	}
+
+	decode := func(s string) ([]byte, error) {
+		return decodeBase64(strings.ReplaceAll(s, ".", "+"))
+	}
+
+	return newPBKDF2(parts[1], parts[2], parts[3], parts[4], decode)
+}
+
+// Django: pbkdf2_sha256$260000$<соль>$<хэш>, соль хранится как есть, хэш в base64
+func parseDjango(hash string) (scheme, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 {
+		return nil, ErrInvalidHash
+	}
+
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return nil, ErrInvalidHash
+	}
+
+	key, err := decodeBase64(parts[3])
+	if err != nil {
+		return nil, ErrInvalidHash
+	}
+
+	p := pbkdf2Hash{algorithm: "sha256", iterations: iterations, salt: []byte(parts[2]), key: key}
+
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+func newPBKDF2(name, iterations, salt, key string, decode func(string) ([]byte, error)) (scheme, error) {
+	p := pbkdf2Hash{algorithm: strings.TrimPrefix(name, "pbkdf2-")}
+
+	var err error
+
+	if p.iterations, err = strconv.Atoi(iterations); err != nil {
+		return nil, ErrInvalidHash
+	}
+
+	if p.salt, err = decode(salt); err != nil {
+		return nil, ErrInvalidHash
+	}
+
+	if p.key, err = decode(key); err != nil {
+		return nil, ErrInvalidHash
+	}
+
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+func (p pbkdf2Hash) validate() error {
+	if p.algorithm != "sha256" && p.algorithm != "sha512" {
+		return fmt.Errorf("%w: pbkdf2-%s", ErrUnsupportedHash, p.algorithm)
+	}
+
+	if p.iterations <= 0 || len(p.salt) == 0 || len(p.key) == 0 {
+		return ErrInvalidHash
+	}
+
+	return nil
+}
+
+func (p pbkdf2Hash) verify(password string) bool {
+	h := sha256.New
+	if p.algorithm == "sha512" {
+		h = sha512.New
+	}
+
+	key := pbkdf2.Key([]byte(password), p.salt, p.iterations, len(p.key), func() hash.Hash { return h() })
+
+	return subtle.ConstantTimeCompare(key, p.key) == 1
+}
+
+func (p pbkdf2Hash) weak() bool {
+	if p.algorithm == "sha512" {
+		return p.iterations < minPBKDF2SHA512Iterations
+	}
+
+	return p.iterations < minPBKDF2SHA256Iterations
+}
+
+func (p pbkdf2Hash) String() string {
+	return fmt.Sprintf("$pbkdf2-%s$i=%d$%s$%s", p.algorithm, p.iterations, b64.EncodeToString(p.salt), b64.EncodeToString(p.key))
+}
+
+type md5Salted struct {
+	salt   []byte
+	digest []byte
+}
+
+func parseMD5Salted(hash string) (scheme, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 {
+		return nil, ErrInvalidHash
+	}
+
+	salt, err := decodeBase64(parts[2])
+	if err != nil {
+		return nil, ErrInvalidHash
+	}
+
+	digest, err := hex.DecodeString(parts[3])
+	if err != nil || len(digest) != md5.Size {
+		return nil, ErrInvalidHash
+	}
+
+	return md5Salted{salt: salt, digest: digest}, nil
+}
+
+func (m md5Salted) verify(password string) bool {
+	sum := md5.Sum(append(append([]byte{}, m.salt...), password...))
+
+	return subtle.ConstantTimeCompare(sum[:], m.digest) == 1
+}
+
+func (m md5Salted) weak() bool {
+	return true
+}
+
+func (m md5Salted) String() string {
+	return fmt.Sprintf("$md5-salted$%s$%s", b64.EncodeToString(m.salt), hex.EncodeToString(m.digest))
+}
+
+// base64 с паддингом и без
+func decodeBase64(s string) ([]byte, error) {
+	return b64.DecodeString(strings.TrimRight(s, "="))
+}
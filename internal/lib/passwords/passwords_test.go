@@ -0,0 +1,95 @@
+package passwords
+
+import (
+	"encoding/base64"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+	"testing"
+)
+
+func TestImportVerify(t *testing.T) {
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		password string
+		hash     string
+		salt     string
+		weak     bool
+	}{
+		{"bcrypt", "secret", string(bcryptHash), "", true},
+		// PHP password_hash пишет $2y$
+		{"bcrypt php", "secret", "$2y$" + strings.TrimPrefix(string(bcryptHash), "$2a$"), "", true},
+		// Пример из эталонной реализации argon2
+		{"argon2i", "password", "$argon2i$v=19$m=65536,t=2,p=4$c29tZXNhbHQ$RdescudvJCsgt3ub+b+dWRWJTmaaJObG", "", false},
+		{"django", "secret", "pbkdf2_sha256$1000$django-salt$35l30tZcKlYQmXDhoHfn+n8yaug27mp5jEKLPrKJK1k=", "", true},
+		{"passlib", "secret", "$pbkdf2-sha256$29000$AQIDBAUGBwg$T3ngZONakzx6wgHS8JTDOk2f5Qx4aWmXfC4ZMWNRdvQ", "", true},
+		{"md5", "secret", "afcd70a1438b9b8ce9be72e89ca602a8", "pepper", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hash, err := Import(tt.hash, tt.salt)
+			require.NoError(t, err)
+
+			assert.True(t, Verify(hash, tt.password))
+			assert.False(t, Verify(hash, tt.password+"x"))
+			assert.Equal(t, tt.weak, NeedsUpgrade(hash))
+
+			// Хэш в формате хранения импортируется сам в себя, поэтому выгрузку можно загрузить обратно
+			again, err := Import(string(hash), "")
+			require.NoError(t, err)
+			assert.Equal(t, hash, again)
+		})
+	}
+}
+
+func TestPBKDF2(t *testing.T) {
+	// Так хранит пароль Keycloak 24+: pbkdf2-sha512, 210000 итераций
+	salt, _ := base64.StdEncoding.DecodeString("a2Mtc2FsdC0xNi1ieXRlcw==")
+	key, _ := base64.StdEncoding.DecodeString("tYHHpQ48A6e4VTzzrfViyjHBCiXxAOe9RpdA9ujqMW2omxvbcnc5cqY0q2bMmbj/obT06e6LyHXp8R5ThWk7Gw==")
+
+	hash, err := PBKDF2("sha512", 210000, salt, key)
+	require.NoError(t, err)
+
+	assert.True(t, Verify(hash, "secret"))
+	assert.False(t, NeedsUpgrade(hash))
+
+	_, err = PBKDF2("sha1", 1000, salt, key)
+	assert.ErrorIs(t, err, ErrUnsupportedHash)
+}
+
+func TestInvalid(t *testing.T) {
+	for _, hash := range []string{"", "plain", "5f4dcc3b5aa765d61d8327deb882cf99", "$2a$10$short", "$argon2d$v=19$m=1,t=1,p=1$c2FsdA$a2V5"} {
+		_, err := Import(hash, "")
+		assert.Error(t, err, hash)
+		assert.False(t, Verify([]byte(hash), "password"), hash)
+		assert.False(t, NeedsUpgrade([]byte(hash)), hash)
+	}
+
+	_, err := Import("$2a$10$abc", "salt")
+	assert.ErrorIs(t, err, ErrInvalidHash)
+
+	fresh, err := Hash("secret")
+	require.NoError(t, err)
+	assert.True(t, Verify(fresh, "secret"))
+	assert.False(t, NeedsUpgrade(fresh))
+}
+
+func TestArgon2Limits(t *testing.T) {
+	for _, hash := range []string{
+		"$argon2id$v=19$m=4194304,t=3,p=4$c29tZXNhbHQ$RdescudvJCsgt3ub+b+dWRWJTmaaJObG",
+		"$argon2id$v=19$m=65536,t=1000,p=4$c29tZXNhbHQ$RdescudvJCsgt3ub+b+dWRWJTmaaJObG",
+		"$argon2id$v=19$m=65536,t=3,p=255$c29tZXNhbHQ$RdescudvJCsgt3ub+b+dWRWJTmaaJObG",
+	} {
+		_, err := Import(hash, "")
+		assert.ErrorIs(t, err, ErrInvalidHash, hash)
+		assert.False(t, Verify([]byte(hash), "password"), hash)
+	}
+
+	_, err := Argon2("id", 4194304, 3, 4, []byte("somesalt"), []byte("key"))
+	assert.ErrorIs(t, err, ErrInvalidHash)
+}
@@ -0,0 +1,174 @@
+// Package usernames Приведение имён пользователей к каноническому виду и правила для новых имён
+// Каноническая форма нужна для уникальности и поиска: "Admin", "ADMIN" и "аdmin" с кириллической "а"
+// дают одну и ту же форму. Показывается пользователю имя в том виде, в котором он его ввёл
+package usernames
+
+import (
+	"errors"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Ошибки проверки имени
+var (
+	ErrInvalidLength     = errors.New("username length is out of range")
+	ErrInvalidCharacters = errors.New("username contains forbidden characters")
+	ErrMixedScripts      = errors.New("username mixes characters of different scripts")
+	ErrReserved          = errors.New("username is reserved")
+)
+
+// Reason Причина, по которой имя не подошло, в виде, понятном клиенту
+func Reason(err error) string {
+	switch {
+	case errors.Is(err, ErrInvalidLength):
+		return "username length is out of range"
+	case errors.Is(err, ErrInvalidCharacters):
+		return "username may contain only letters, digits and . _ - between them"
+	case errors.Is(err, ErrMixedScripts):
+		return "username must not mix letters of different alphabets"
+	case errors.Is(err, ErrReserved):
+		return "username is reserved"
+	}
+
+	return "invalid username"
+}
+
+// Буквы кириллицы и греческого, которые не отличить от латинских.
+// Заменяются на латинские в канонической форме, чтобы имена из одних таких букв совпадали с латинскими.
+// Регистр к этому моменту уже свёрнут, поэтому если строчная и заглавная похожи на разные буквы,
+// берётся заглавная: "н" как "H", "ν" как "N"
+var confusables = map[rune]rune{
+	// Кириллица
+	'а': 'a', 'в': 'b', 'с': 'c', 'ԁ': 'd', 'е': 'e', 'һ': 'h', 'і': 'i', 'ј': 'j', 'к': 'k',
+	'м': 'm', 'н': 'h', 'о': 'o', 'р': 'p', 'ԛ': 'q', 'ѕ': 's', 'т': 't', 'у': 'y', 'ԝ': 'w',
+	'х': 'x', 'ё': 'e', 'ї': 'i', 'ӏ': 'l',
+	// Греческий
+	'α': 'a', 'β': 'b', 'ε': 'e', 'ζ': 'z', 'η': 'h', 'ι': 'i', 'κ': 'k', 'μ': 'm', 'ν': 'n',
+	'ο': 'o', 'ρ': 'p', 'τ': 't', 'υ': 'y', 'χ': 'x', 'ϲ': 'c', 'ϳ': 'j',
+}
+
+// Canonical Каноническая форма имени: NFKC, свёртка регистра и замена похожих букв на латинские
+func Canonical(name string) string {
+	folded := cases.Fold().String(norm.NFKC.String(strings.TrimSpace(name)))
+
+	return norm.NFKC.String(strings.Map(func(r rune) rune {
+		if latin, ok := confusables[r]; ok {
+			return latin
+		}
+
+		return r
+	}, folded))
+}
+
+// Display Имя для показа: без пробелов по краям и в NFC, чтобы одинаковые на вид имена хранились одинаково
+func Display(name string) string {
+	return norm.NFC.String(strings.TrimSpace(name))
+}
+
+// Policy правила для новых имён
+type Policy struct {
+	minLength int
+	maxLength int
+	reserved  map[string]bool
+}
+
+// NewPolicy возвращает правила с длиной имени от minLength до maxLength символов
+// и списком занятых системой имён, которые сравниваются в канонической форме
+func NewPolicy(minLength int, maxLength int, reserved []string) *Policy {
+	policy := &Policy{
+		minLength: minLength,
+		maxLength: maxLength,
+		reserved:  make(map[string]bool, len(reserved)),
+	}
+
+	for _, name := range reserved {
+		policy.reserved[Canonical(name)] = true
+	}
+
+	return policy
+}
+
+// Validate Проверяет имя, которое пользователь выбрал сам
+// Разрешены буквы, цифры и ".", "_", "-" между ними, буквы только одной письменности
+func (p *Policy) Validate(name string) error {
+	name = Display(name)
+
+	length := utf8.RuneCountInString(name)
+	if length < p.minLength || length > p.maxLength {
+		return ErrInvalidLength
+	}
+
+	runes := []rune(name)
+	for i, r := range runes {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			continue
+		}
+
+		// Знаки препинания только между буквами и цифрами
+		if strings.ContainsRune("._-", r) && i > 0 && i < len(runes)-1 && !strings.ContainsRune("._-", runes[i-1]) {
+			continue
+		}
+
+		return ErrInvalidCharacters
+	}
+
+	if mixedScripts(name) {
+		return ErrMixedScripts
+	}
+
+	if p.reserved[Canonical(name)] {
+		return ErrReserved
+	}
+
+	return nil
+}
+
+// Письменности, которые обычно смешиваются в одном имени, считаются одной
+var compatibleScripts = map[string]string{
+	"Hiragana": "Han",
+	"Katakana": "Han",
+}
+
+// Проверяет, что все буквы имени из одной письменности. Цифры и знаки ни к какой не относятся
+func mixedScripts(name string) bool {
+	var found string
+
+	for _, r := range name {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+
+		script := scriptOf(r)
+		if compatible, ok := compatibleScripts[script]; ok {
+			script = compatible
+		}
+
+		if found == "" {
+			found = script
+			continue
+		}
+
+		if script != found {
+			return true
+		}
+	}
+
+	return false
+}
+
+func scriptOf(r rune) string {
+	for name, table := range unicode.Scripts {
+		if name == "Common" || name == "Inherited" {
+			continue
+		}
+
+		if unicode.Is(table, r) {
+			return name
+		}
+	}
+
+	return "Common"
+}
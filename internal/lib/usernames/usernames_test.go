@@ -0,0 +1,65 @@
+package usernames
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCanonical(t *testing.T) {
+	same := []string{
+		"admin",
+		"Admin",
+		" ADMIN ",
+		"аdmin", // кириллическая "а"
+		"ａｄｍｉｎ", // полноширинные буквы
+	}
+
+	for _, name := range same {
+		assert.Equal(t, "admin", Canonical(name), name)
+	}
+
+	// Имя целиком из похожих кириллических букв совпадает с латинским
+	assert.Equal(t, Canonical("ace"), Canonical("АСЕ"))
+	assert.NotEqual(t, Canonical("ivan"), Canonical("иван"))
+}
+
+func TestValidate(t *testing.T) {
+	policy := NewPolicy(3, 16, []string{"Admin", "sso"})
+
+	tests := []struct {
+		name     string
+		username string
+		err      error
+	}{
+		{name: "latin", username: "ivan.petrov"},
+		{name: "cyrillic", username: "Иван_Петров"},
+		{name: "digits", username: "user-42"},
+		{name: "japanese", username: "やまだ太郎"},
+		{name: "too short", username: "ab", err: ErrInvalidLength},
+		{name: "too long", username: "abcdefghijklmnopq", err: ErrInvalidLength},
+		{name: "space", username: "ivan petrov", err: ErrInvalidCharacters},
+		{name: "leading dot", username: ".ivan", err: ErrInvalidCharacters},
+		{name: "double dot", username: "ivan..petrov", err: ErrInvalidCharacters},
+		{name: "email", username: "ivan@example.com", err: ErrInvalidCharacters},
+		{name: "mixed scripts", username: "pаypal", err: ErrMixedScripts},
+		{name: "reserved", username: "ADMIN", err: ErrReserved},
+		{name: "reserved lookalike", username: "ЅЅО", err: ErrReserved},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.ErrorIs(t, policy.Validate(tt.username), tt.err)
+		})
+	}
+}
+
+func TestReason(t *testing.T) {
+	policy := NewPolicy(3, 8, []string{"admin"})
+
+	assert.Equal(t, "username length is out of range", Reason(policy.Validate("ab")))
+	assert.Equal(t, "username may contain only letters, digits and . _ - between them", Reason(policy.Validate("a b c")))
+	assert.Equal(t, "username must not mix letters of different alphabets", Reason(policy.Validate("ivanиван")))
+	assert.Equal(t, "username is reserved", Reason(policy.Validate("Admin")))
+	assert.Equal(t, "invalid username", Reason(errors.New("unknown")))
+}
@@ -0,0 +1,184 @@
+// Package apps Сервис управления приложениями для администраторов
+package apps
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/lib/logger/sl"
+	"shilka-sso/internal/storage"
+	"strings"
+)
+
+type Apps struct {
+	log     *slog.Logger
+	storage Storage
+}
+
+// Storage Методы бд, нужные сервису
+type Storage interface {
+	SetAppRedirectURIs(ctx context.Context, appID int, redirectURIs []string) error
+	SetAppScopes(ctx context.Context, appID int, scopes []string) error
+	SetRelyingParty(ctx context.Context, rp models.RelyingParty) error
+}
+
+// Ошибки сервисного слоя
+var (
+	ErrAppNotFound         = errors.New("app not found")
+	ErrInvalidRedirectURI  = errors.New("invalid redirect uri")
+	ErrInvalidScope        = errors.New("invalid scope")
+	ErrInvalidRelyingParty = errors.New("invalid relying party")
+)
+
+// New возвращает новый объект сервиса Apps
+func New(
+	log *slog.Logger,
+	storage Storage,
+) *Apps {
+	return &Apps{
+		log:     log,
+		storage: storage,
+	}
+}
+
+// SetRedirectURIs Заменяет список redirect URI, на которые сервер авторизации может вернуть код приложения
+// URI должен быть абсолютным и без фрагмента, сравнивается с запросом посимвольно
+func (a *Apps) SetRedirectURIs(ctx context.Context, appID int, redirectURIs []string) error {
+	const operator = "apps.SetRedirectURIs"
+
+	log := a.log.With(
+		slog.String("operator", operator),
+		slog.Int("appID", appID),
+	)
+
+	log.Info("Setting redirect URIs")
+
+	for _, redirectURI := range redirectURIs {
+		parsed, err := url.Parse(redirectURI)
+		if err != nil || !parsed.IsAbs() || parsed.Fragment != "" {
+			return fmt.Errorf("%s: %w", operator, ErrInvalidRedirectURI)
+		}
+	}
+
+	if err := a.storage.SetAppRedirectURIs(ctx, appID, redirectURIs); err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return fmt.Errorf("%s: %w", operator, ErrAppNotFound)
+		}
+
+		log.Error("Failed to set redirect URIs", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", operator, err)
+	}
+
+	return nil
+}
+
+// SetScopes Заменяет список scope, которые приложение может запрашивать у сервера авторизации
+// Пустой список разрешает только openid и profile. Scope - непустая строка из видимых ASCII символов
+// без пробелов, кавычек и обратной косой черты (RFC 6749)
+func (a *Apps) SetScopes(ctx context.Context, appID int, scopes []string) error {
+	const operator = "apps.SetScopes"
+
+	log := a.log.With(
+		slog.String("operator", operator),
+		slog.Int("appID", appID),
+	)
+
+	log.Info("Setting scopes")
+
+	for _, scope := range scopes {
+		if !validScope(scope) {
+			return fmt.Errorf("%s: %w", operator, ErrInvalidScope)
+		}
+	}
+
+	if err := a.storage.SetAppScopes(ctx, appID, scopes); err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return fmt.Errorf("%s: %w", operator, ErrAppNotFound)
+		}
+
+		log.Error("Failed to set scopes", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", operator, err)
+	}
+
+	return nil
+}
+
+// SetRelyingParty Задаёт настройки WebAuthn приложения: домен ключей, название и адреса страниц
+// Домен - имя хоста без схемы и порта, каждый адрес должен быть https (http только для localhost)
+// и находиться на этом домене или его поддомене
+func (a *Apps) SetRelyingParty(ctx context.Context, appID int, rpID string, name string, origins []string) error {
+	const operator = "apps.SetRelyingParty"
+
+	log := a.log.With(
+		slog.String("operator", operator),
+		slog.Int("appID", appID),
+		slog.String("rpID", rpID),
+	)
+
+	log.Info("Setting relying party")
+
+	if !validRelyingParty(rpID, name, origins) {
+		return fmt.Errorf("%s: %w", operator, ErrInvalidRelyingParty)
+	}
+
+	err := a.storage.SetRelyingParty(ctx, models.RelyingParty{
+		AppId:   appID,
+		RPID:    rpID,
+		Name:    name,
+		Origins: origins,
+	})
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return fmt.Errorf("%s: %w", operator, ErrAppNotFound)
+		}
+
+		log.Error("Failed to set relying party", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", operator, err)
+	}
+
+	return nil
+}
+
+func validScope(scope string) bool {
+	if scope == "" {
+		return false
+	}
+
+	for _, c := range []byte(scope) {
+		if c <= ' ' || c > '~' || c == '"' || c == '\\' {
+			return false
+		}
+	}
+
+	return true
+}
+
+func validRelyingParty(rpID string, name string, origins []string) bool {
+	if rpID == "" || strings.TrimSpace(name) == "" || len(origins) == 0 || strings.ContainsAny(rpID, ":/ ") {
+		return false
+	}
+
+	for _, origin := range origins {
+		parsed, err := url.Parse(origin)
+		if err != nil || parsed.Path != "" || parsed.RawQuery != "" || parsed.Fragment != "" {
+			return false
+		}
+
+		host := parsed.Hostname()
+		if host != rpID && !strings.HasSuffix(host, "."+rpID) {
+			return false
+		}
+
+		if parsed.Scheme != "https" && (parsed.Scheme != "http" || host != "localhost") {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,314 @@
+// Package audit Сервис журнала аудита с цепочкой хэшей
+package audit
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/lib/auditchain"
+	"shilka-sso/internal/lib/logger/sl"
+	"shilka-sso/internal/storage"
+	"slices"
+	"time"
+)
+
+// Сколько записей читается из бд за один раз при проверке цепочки
+const verifyBatchSize = 500
+
+type Audit struct {
+	log        *slog.Logger
+	storage    Storage
+	signingKey *rsa.PrivateKey
+}
+
+// Storage Методы бд, нужные сервису аудита
+type Storage interface {
+	AppendAuditRecord(ctx context.Context, record models.AuditRecord) (models.AuditRecord, error)
+	AuditRecords(ctx context.Context, afterID int64, limit int) ([]models.AuditRecord, error)
+	LastAuditRecord(ctx context.Context) (models.AuditRecord, error)
+	SaveAuditCheckpoint(ctx context.Context, checkpoint models.AuditCheckpoint) (int64, error)
+	AuditCheckpoints(ctx context.Context) ([]models.AuditCheckpoint, error)
+}
+
+// Report результат проверки цепочки аудита
+// Если цепочка сломана, BrokenRecordId указывает на первую запись, с которой она не сходится
+// RecordsRedacted - сколько записей проверено только по ссылкам цепочки, потому что из них убраны персональные данные
+type Report struct {
+	Ok                 bool
+	RecordsChecked     int64
+	CheckpointsChecked int64
+	RecordsRedacted    int64
+	BrokenRecordId     int64
+	Reason             string
+}
+
+// New возвращает новый объект сервиса аудита
+func New(
+	log *slog.Logger,
+	storage Storage,
+	signingKey *rsa.PrivateKey,
+) *Audit {
+	return &Audit{
+		log:        log,
+		storage:    storage,
+		signingKey: signingKey,
+	}
+}
+
+// Record Добавляет событие в журнал аудита
+func (a *Audit) Record(ctx context.Context, event string, userID int64, appID int, payload map[string]any) error {
+	const operator = "audit.Record"
+
+	record, err := auditchain.NewRecord(event, userID, appID, payload, time.Now())
+	if err != nil {
+		return fmt.Errorf("%s: %w", operator, err)
+	}
+
+	if _, err := a.storage.AppendAuditRecord(ctx, record); err != nil {
+		return fmt.Errorf("%s: %w", operator, err)
+	}
+
+	return nil
+}
+
+// Checkpoint Подписывает ключом сервера текущий конец цепочки
+// Если с прошлого чекпоинта записей не появилось, ничего не делает
+func (a *Audit) Checkpoint(ctx context.Context) error {
+	const operator = "audit.Checkpoint"
+
+	log := a.log.With(slog.String("operator", operator))
+
+	last, err := a.storage.LastAuditRecord(ctx)
+	if err != nil {
+		if errors.Is(err, storage.ErrAuditRecordNotFound) {
+			return nil
+		}
+
+		return fmt.Errorf("%s: %w", operator, err)
+	}
+
+	checkpoints, err := a.storage.AuditCheckpoints(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operator, err)
+	}
+
+	if len(checkpoints) > 0 && checkpoints[len(checkpoints)-1].RecordId >= last.Id {
+		return nil
+	}
+
+	signature, err := rsa.SignPKCS1v15(rand.Reader, a.signingKey, crypto.SHA256, auditchain.CheckpointDigest(last.Id, last.Hash))
+	if err != nil {
+		return fmt.Errorf("%s: %w", operator, err)
+	}
+
+	_, err = a.storage.SaveAuditCheckpoint(ctx, models.AuditCheckpoint{
+		RecordId:  last.Id,
+		Hash:      last.Hash,
+		Signature: signature,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", operator, err)
+	}
+
+	log.Info("audit checkpoint saved", slog.Int64("record_id", last.Id))
+
+	return nil
+}
+
+// RunCheckpoints Раз в interval делает чекпоинт цепочки, пока не отменён ctx
+func (a *Audit) RunCheckpoints(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := a.Checkpoint(ctx); err != nil {
+				a.log.Error("Failed to save audit checkpoint", sl.Err(err))
+			}
+		}
+	}
+}
+
+// VerifyChain Проходит всю цепочку аудита и сообщает о первом сломанном звене
+func (a *Audit) VerifyChain(ctx context.Context) (Report, error) {
+	const operator = "audit.VerifyChain"
+
+	log := a.log.With(slog.String("operator", operator))
+
+	log.Info("Verifying audit chain")
+
+	checkpoints, err := a.storage.AuditCheckpoints(ctx)
+	if err != nil {
+		return Report{}, fmt.Errorf("%s: %w", operator, err)
+	}
+
+	checkpointsByRecord := make(map[int64][]models.AuditCheckpoint, len(checkpoints))
+	for _, checkpoint := range checkpoints {
+		checkpointsByRecord[checkpoint.RecordId] = append(checkpointsByRecord[checkpoint.RecordId], checkpoint)
+	}
+
+	var report Report
+	var lastID int64
+	prevHash := auditchain.GenesisHash
+
+	// Записи без персональных данных, которые ещё не подтверждены записью user.erased
+	unconfirmed := make(map[int64]models.AuditRecord)
+
+	for {
+		records, err := a.storage.AuditRecords(ctx, lastID, verifyBatchSize)
+		if err != nil {
+			return Report{}, fmt.Errorf("%s: %w", operator, err)
+		}
+
+		for _, record := range records {
+			if reason := a.verifyRecord(record, lastID, prevHash, checkpointsByRecord[record.Id], &report); reason != "" {
+				report.BrokenRecordId = record.Id
+				report.Reason = reason
+
+				log.Warn("audit chain is broken", slog.Int64("record_id", record.Id), slog.String("reason", reason))
+
+				return report, nil
+			}
+
+			if !record.RedactedAt.IsZero() {
+				unconfirmed[record.Id] = record
+			} else if record.Event == models.AuditUserErased {
+				confirmRedactions(record, unconfirmed)
+			}
+
+			report.RecordsChecked++
+			lastID = record.Id
+			prevHash = record.Hash
+		}
+
+		if len(records) < verifyBatchSize {
+			break
+		}
+	}
+
+	if len(unconfirmed) > 0 {
+		ids := slices.Sorted(maps.Keys(unconfirmed))
+
+		report.BrokenRecordId = ids[0]
+		report.Reason = "record content was redacted without a matching user.erased record"
+
+		log.Warn("audit chain has unconfirmed redactions", slog.Int64("record_id", report.BrokenRecordId))
+
+		return report, nil
+	}
+
+	// Чекпоинт на запись, которой уже нет, значит хвост цепочки удалён
+	for _, checkpoint := range checkpoints {
+		if checkpoint.RecordId > lastID {
+			report.BrokenRecordId = lastID + 1
+			report.Reason = fmt.Sprintf("checkpoint %d covers record %d, but the chain ends at %d", checkpoint.Id, checkpoint.RecordId, lastID)
+
+			log.Warn("audit chain is truncated", slog.Int64("record_id", report.BrokenRecordId))
+
+			return report, nil
+		}
+	}
+
+	report.Ok = true
+
+	log.Info("audit chain verified", slog.Int64("records", report.RecordsChecked))
+
+	return report, nil
+}
+
+// Проверяет одну запись цепочки, возвращает причину поломки или пустую строку
+func (a *Audit) verifyRecord(
+	record models.AuditRecord,
+	prevID int64,
+	prevHash []byte,
+	checkpoints []models.AuditCheckpoint,
+	report *Report,
+) string {
+	if record.Id != prevID+1 {
+		return fmt.Sprintf("records %d..%d are missing", prevID+1, record.Id-1)
+	}
+
+	if !bytes.Equal(record.PrevHash, prevHash) {
+		return "previous hash does not match the previous record"
+	}
+
+	if !record.RedactedAt.IsZero() {
+		report.RecordsRedacted++
+	}
+
+	// У записей с хэшами полей персональные данные заменены их хэшами, и запись сходится с Hash и после удаления.
+	// Старые записи без персональных данных с хэшем не сходятся, их подтверждает только запись user.erased
+	if record.RedactedAt.IsZero() || record.FieldSalts != nil {
+		if !bytes.Equal(record.Hash, auditchain.RecordHash(record)) {
+			return "record content does not match its hash"
+		}
+	}
+
+	for _, checkpoint := range checkpoints {
+		report.CheckpointsChecked++
+
+		digest := auditchain.CheckpointDigest(checkpoint.RecordId, checkpoint.Hash)
+		if err := rsa.VerifyPKCS1v15(&a.signingKey.PublicKey, crypto.SHA256, digest, checkpoint.Signature); err != nil {
+			return fmt.Sprintf("checkpoint %d has an invalid signature", checkpoint.Id)
+		}
+
+		if !bytes.Equal(checkpoint.Hash, record.Hash) {
+			return fmt.Sprintf("record hash differs from signed checkpoint %d", checkpoint.Id)
+		}
+	}
+
+	return ""
+}
+
+// Убирает из unconfirmed записи, которые подтверждает запись user.erased того же пользователя.
+// Запись без FieldSalts подтверждается, только если она перечислена среди legacy_records: иначе, стерев соли
+// у записи с хэшами полей, можно было бы выдать её за старую и обойти проверку хэша.
+// Записи user.erased, написанные до хэшей полей, сами без FieldSalts, и в них все записи старые
+func confirmRedactions(erased models.AuditRecord, unconfirmed map[int64]models.AuditRecord) {
+	legacy := make(map[int64]bool)
+
+	legacyField := models.AuditLegacyRecordsField
+	if erased.FieldSalts == nil {
+		legacyField = models.AuditRedactedRecordsField
+	}
+
+	for _, id := range redactedRecords(erased, legacyField) {
+		legacy[id] = true
+	}
+
+	for _, id := range redactedRecords(erased, models.AuditRedactedRecordsField) {
+		record, ok := unconfirmed[id]
+		if !ok || record.UserId != erased.UserId || legacy[id] != (record.FieldSalts == nil) {
+			continue
+		}
+
+		delete(unconfirmed, id)
+	}
+}
+
+// Id записей из поля field записи user.erased
+func redactedRecords(record models.AuditRecord, field string) []int64 {
+	var payload map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(record.Payload), &payload); err != nil {
+		return nil
+	}
+
+	var ids []int64
+	if err := json.Unmarshal(payload[field], &ids); err != nil {
+		return nil
+	}
+
+	return ids
+}
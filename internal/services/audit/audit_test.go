@@ -0,0 +1,295 @@
+package audit
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"log/slog"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/lib/auditchain"
+	"shilka-sso/internal/storage"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Хранит цепочку в памяти, чтобы тест мог портить записи напрямую
+type memoryStorage struct {
+	records     []models.AuditRecord
+	checkpoints []models.AuditCheckpoint
+}
+
+func (m *memoryStorage) AppendAuditRecord(_ context.Context, record models.AuditRecord) (models.AuditRecord, error) {
+	record.Id = int64(len(m.records) + 1)
+	record.PrevHash = auditchain.GenesisHash
+	if len(m.records) > 0 {
+		record.PrevHash = m.records[len(m.records)-1].Hash
+	}
+	record.Hash = auditchain.RecordHash(record)
+
+	m.records = append(m.records, record)
+
+	return record, nil
+}
+
+func (m *memoryStorage) AuditRecords(_ context.Context, afterID int64, limit int) ([]models.AuditRecord, error) {
+	var records []models.AuditRecord
+	for _, record := range m.records {
+		if record.Id > afterID && len(records) < limit {
+			records = append(records, record)
+		}
+	}
+
+	return records, nil
+}
+
+func (m *memoryStorage) LastAuditRecord(_ context.Context) (models.AuditRecord, error) {
+	if len(m.records) == 0 {
+		return models.AuditRecord{}, storage.ErrAuditRecordNotFound
+	}
+
+	return m.records[len(m.records)-1], nil
+}
+
+func (m *memoryStorage) SaveAuditCheckpoint(_ context.Context, checkpoint models.AuditCheckpoint) (int64, error) {
+	checkpoint.Id = int64(len(m.checkpoints) + 1)
+	m.checkpoints = append(m.checkpoints, checkpoint)
+
+	return checkpoint.Id, nil
+}
+
+func (m *memoryStorage) AuditCheckpoints(_ context.Context) ([]models.AuditCheckpoint, error) {
+	return m.checkpoints, nil
+}
+
+func newTestAudit(t *testing.T) (*Audit, *memoryStorage) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	st := &memoryStorage{}
+
+	return New(slog.New(slog.NewTextHandler(io.Discard, nil)), st, key), st
+}
+
+func fillChain(t *testing.T, a *Audit, n int) {
+	t.Helper()
+
+	for i := 0; i < n; i++ {
+		require.NoError(t, a.Record(context.Background(), models.AuditUserRegistered, int64(i+1), 0, map[string]any{"n": i}))
+	}
+}
+
+func TestVerifyChain_HappyPath(t *testing.T) {
+	a, _ := newTestAudit(t)
+
+	fillChain(t, a, 5)
+	require.NoError(t, a.Checkpoint(context.Background()))
+	fillChain(t, a, 3)
+
+	report, err := a.VerifyChain(context.Background())
+	require.NoError(t, err)
+
+	assert.True(t, report.Ok)
+	assert.EqualValues(t, 8, report.RecordsChecked)
+	assert.EqualValues(t, 1, report.CheckpointsChecked)
+}
+
+// Изменённая запись должна быть первым сломанным звеном
+func TestVerifyChain_EditedRecord(t *testing.T) {
+	a, st := newTestAudit(t)
+
+	fillChain(t, a, 5)
+	st.records[2].Payload = `{"n":100}`
+
+	report, err := a.VerifyChain(context.Background())
+	require.NoError(t, err)
+
+	assert.False(t, report.Ok)
+	assert.EqualValues(t, 3, report.BrokenRecordId)
+}
+
+// Удалённая из середины запись ломает ссылку следующей записи
+func TestVerifyChain_DeletedRecord(t *testing.T) {
+	a, st := newTestAudit(t)
+
+	fillChain(t, a, 5)
+	st.records = append(st.records[:1], st.records[2:]...)
+
+	report, err := a.VerifyChain(context.Background())
+	require.NoError(t, err)
+
+	assert.False(t, report.Ok)
+	assert.EqualValues(t, 3, report.BrokenRecordId)
+}
+
+// Пересчитанная после правки цепочка ловится подписанным чекпоинтом
+func TestVerifyChain_RehashedAfterCheckpoint(t *testing.T) {
+	a, st := newTestAudit(t)
+
+	fillChain(t, a, 5)
+	require.NoError(t, a.Checkpoint(context.Background()))
+
+	st.records[1].Payload = `{"n":100}`
+	for i := 1; i < len(st.records); i++ {
+		st.records[i].PrevHash = st.records[i-1].Hash
+		st.records[i].Hash = auditchain.RecordHash(st.records[i])
+	}
+
+	report, err := a.VerifyChain(context.Background())
+	require.NoError(t, err)
+
+	assert.False(t, report.Ok)
+	assert.EqualValues(t, 5, report.BrokenRecordId)
+}
+
+// Удалённый хвост цепочки ловится чекпоинтом на несуществующую запись
+func TestVerifyChain_TruncatedTail(t *testing.T) {
+	a, st := newTestAudit(t)
+
+	fillChain(t, a, 5)
+	require.NoError(t, a.Checkpoint(context.Background()))
+	st.records = st.records[:3]
+
+	report, err := a.VerifyChain(context.Background())
+	require.NoError(t, err)
+
+	assert.False(t, report.Ok)
+	assert.EqualValues(t, 4, report.BrokenRecordId)
+}
+
+// Запись без персональных данных проходит проверку, только если её подтверждает запись user.erased того же пользователя
+func TestVerifyChain_RedactedRecord(t *testing.T) {
+	ctx := context.Background()
+	a, st := newTestAudit(t)
+
+	fillChain(t, a, 1)
+	require.NoError(t, a.Record(ctx, models.AuditUserRegistered, 2, 0, map[string]any{"username": "ivan", "n": 1}))
+	fillChain(t, a, 3)
+
+	redacted, err := auditchain.Redact(st.records[1], "erased-2", time.Now())
+	require.NoError(t, err)
+	assert.NotContains(t, redacted.Payload, "ivan")
+	st.records[1] = redacted
+
+	report, err := a.VerifyChain(ctx)
+	require.NoError(t, err)
+
+	assert.False(t, report.Ok)
+	assert.EqualValues(t, 2, report.BrokenRecordId)
+
+	// Запись user.erased другого пользователя не подходит
+	require.NoError(t, a.Record(ctx, models.AuditUserErased, 3, 0, map[string]any{
+		models.AuditRedactedRecordsField: []int64{2},
+	}))
+
+	report, err = a.VerifyChain(ctx)
+	require.NoError(t, err)
+	assert.False(t, report.Ok)
+
+	require.NoError(t, a.Record(ctx, models.AuditUserErased, 2, 0, map[string]any{
+		models.AuditRedactedRecordsField: []int64{2},
+	}))
+
+	report, err = a.VerifyChain(ctx)
+	require.NoError(t, err)
+
+	assert.True(t, report.Ok, report.Reason)
+	assert.EqualValues(t, 1, report.RecordsRedacted)
+}
+
+// После удаления данных запись по-прежнему сверяется с хэшем, поэтому правка под видом удаления ловится
+func TestVerifyChain_TamperedRedactedRecord(t *testing.T) {
+	ctx := context.Background()
+	a, st := newTestAudit(t)
+
+	require.NoError(t, a.Record(ctx, models.AuditUserRegistered, 1, 0, map[string]any{"username": "ivan", "n": 1}))
+
+	redacted, err := auditchain.Redact(st.records[0], "erased-1", time.Now())
+	require.NoError(t, err)
+
+	require.NoError(t, a.Record(ctx, models.AuditUserErased, 1, 0, map[string]any{
+		models.AuditRedactedRecordsField: []int64{1},
+	}))
+
+	tests := []struct {
+		name   string
+		tamper func(r *models.AuditRecord)
+	}{
+		{"other field", func(r *models.AuditRecord) {
+			r.Payload = strings.Replace(r.Payload, `"n":1`, `"n":2`, 1)
+		}},
+		{"field digest", func(r *models.AuditRecord) {
+			r.Payload = strings.Replace(r.Payload, `"username":"`, `"username":"00`, 1)
+		}},
+		{"pseudonym instead of digest", func(r *models.AuditRecord) {
+			r.Payload = `{"n":1,"username":"erased-1"}`
+		}},
+		{"dropped salts", func(r *models.AuditRecord) {
+			r.FieldSalts = nil
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			record := redacted
+			tt.tamper(&record)
+			st.records[0] = record
+
+			report, err := a.VerifyChain(ctx)
+			require.NoError(t, err)
+
+			assert.False(t, report.Ok)
+			assert.EqualValues(t, 1, report.BrokenRecordId)
+		})
+	}
+
+	st.records[0] = redacted
+
+	report, err := a.VerifyChain(ctx)
+	require.NoError(t, err)
+	assert.True(t, report.Ok, report.Reason)
+}
+
+// Записи, написанные до хэшей полей, после удаления данных с хэшем не сходятся и держатся на записи user.erased
+func TestVerifyChain_LegacyRedactedRecord(t *testing.T) {
+	ctx := context.Background()
+	a, st := newTestAudit(t)
+
+	_, err := st.AppendAuditRecord(ctx, models.AuditRecord{
+		Event:     models.AuditUserRegistered,
+		UserId:    1,
+		Payload:   `{"username":"ivan"}`,
+		CreatedAt: time.Now(),
+	})
+	require.NoError(t, err)
+
+	redacted, err := auditchain.Redact(st.records[0], "erased-1", time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, `{"username":"erased-1"}`, redacted.Payload)
+	st.records[0] = redacted
+
+	// Новая запись user.erased подтверждает старую запись, только если перечисляет её среди legacy_records
+	require.NoError(t, a.Record(ctx, models.AuditUserErased, 1, 0, map[string]any{
+		models.AuditRedactedRecordsField: []int64{1},
+	}))
+
+	report, err := a.VerifyChain(ctx)
+	require.NoError(t, err)
+	assert.False(t, report.Ok)
+
+	require.NoError(t, a.Record(ctx, models.AuditUserErased, 1, 0, map[string]any{
+		models.AuditRedactedRecordsField: []int64{1},
+		models.AuditLegacyRecordsField:   []int64{1},
+	}))
+
+	report, err = a.VerifyChain(ctx)
+	require.NoError(t, err)
+
+	assert.True(t, report.Ok, report.Reason)
+	assert.EqualValues(t, 1, report.RecordsRedacted)
+}
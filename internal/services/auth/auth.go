@@ -3,23 +3,33 @@ package auth
 
 import (
 	"context"
+	"crypto/rsa"
 	"errors"
 	"fmt"
-	"golang.org/x/crypto/bcrypt"
 	"log/slog"
 	"shilka-sso/internal/domain/models"
 	"shilka-sso/internal/lib/jwt"
+	"shilka-sso/internal/lib/keys"
 	"shilka-sso/internal/lib/logger/sl"
+	"shilka-sso/internal/lib/passwords"
+	"shilka-sso/internal/lib/usernames"
 	"shilka-sso/internal/storage"
 	"time"
 )
 
 type Auth struct {
-	log        *slog.Logger
-	dbServices DbServices
-	tokenTTL   time.Duration
+	log            *slog.Logger
+	dbServices     DbServices
+	auditor        Auditor
+	authenticators []Authenticator
+	tokenTTL       time.Duration
+	usernames      *usernames.Policy
+	signingKey     *rsa.PrivateKey
 }
 
+// AdminAppID app_id, с которым Login выдаёт токен не приложению, а для gRPC API самого sso
+const AdminAppID = 0
+
 // DbServices TODO: Добавить методы для смены пароля и роли
 // DbServices Интерфейс, хранящий в себе методы, реализуемые бд
 type DbServices interface {
@@ -30,28 +40,62 @@ type DbServices interface {
 	) (userID int64, err error)
 
 	GetUser(ctx context.Context, username string) (models.User, error)
+	UserByIdentifier(ctx context.Context, login string) (models.User, error)
+	UserByID(ctx context.Context, userID int64) (models.User, error)
 	IsAdmin(ctx context.Context, userID int64) (bool, error)
+	SetPasswordHash(ctx context.Context, userID int64, passwordHash []byte) error
+	ServiceAccountByID(ctx context.Context, accountID int64) (models.ServiceAccount, error)
 
 	GetApp(ctx context.Context, appID int) (models.App, error)
 }
 
+// Authenticator источник, в котором проверяются логин и пароль пользователя
+// Если источник не знает пользователя или пароль не подошёл, возвращает ErrInvalidCredentials,
+// и Auth пробует следующий источник. Вместе с ErrInvalidCredentials можно вернуть найденного пользователя,
+// тогда его id попадёт в журнал аудита
+type Authenticator interface {
+	Authenticate(ctx context.Context, username string, password string) (models.User, error)
+}
+
+// Auditor Журнал аудита, в который пишутся события сервиса
+type Auditor interface {
+	Record(ctx context.Context, event string, userID int64, appID int, payload map[string]any) error
+}
+
 // Ошибки сервисного слоя
 var (
 	ErrInvalidCredentials = errors.New("invalid credentials")
 	ErrUserExists         = errors.New("user already exists")
 	ErrInvalidUserId      = errors.New("invalid user id")
+	ErrInvalidToken       = errors.New("invalid token")
+	ErrInvalidUsername    = errors.New("invalid username")
 )
 
 // New возвращает новый объект Auth сервиса
+// usernamePolicy - правила для имён при регистрации, signingKey - ключ сервера, которым подписываются
+// токены API самого sso, authenticators - источники, которые проверяются по порядку,
+// по умолчанию только локальный пароль из бд
 func New(
 	log *slog.Logger,
 	dbServices DbServices,
+	auditor Auditor,
 	tokenTTL time.Duration,
+	usernamePolicy *usernames.Policy,
+	signingKey *rsa.PrivateKey,
+	authenticators ...Authenticator,
 ) *Auth {
+	if len(authenticators) == 0 {
+		authenticators = []Authenticator{NewLocal(log, dbServices)}
+	}
+
 	return &Auth{
-		log:        log,
-		dbServices: dbServices,
-		tokenTTL:   tokenTTL,
+		log:            log,
+		dbServices:     dbServices,
+		auditor:        auditor,
+		authenticators: authenticators,
+		tokenTTL:       tokenTTL,
+		usernames:      usernamePolicy,
+		signingKey:     signingKey,
 	}
 }
 
@@ -60,6 +104,7 @@ func New(
 // Login проверяет существует ли пользователь с указанными данными в бд
 // Если не существует выдаёт ошибку
 // Если пароль не правильный выдаёт ошибку
+// С appID равным AdminAppID выдаёт токен для API самого sso, подписанный ключом сервера
 func (a *Auth) Login(
 	ctx context.Context,
 	username string,
@@ -75,26 +120,24 @@ func (a *Auth) Login(
 
 	log.Info("Trying to login user")
 
-	user, err := a.dbServices.GetUser(ctx, username)
-
-	// Идентефикация пользователя
+	user, err := a.Authenticate(ctx, username, password, appID)
 	if err != nil {
-		if errors.Is(err, storage.ErrUserNotFound) {
-			a.log.Error("GetUser not found with given username", sl.Err(err))
+		return "", fmt.Errorf("%s: %w", operator, err)
+	}
 
-			return "", fmt.Errorf("%s: %w", operator, ErrInvalidCredentials)
-		}
+	if appID == AdminAppID {
+		token, err := jwt.NewAdminToken(a.signingKey, keys.KeyID(&a.signingKey.PublicKey), user, a.tokenTTL)
+		if err != nil {
+			a.log.Error("Failed to create token", sl.Err(err))
 
-		a.log.Error("Failed to get user", sl.Err(err))
+			return "", fmt.Errorf("%s: %w", operator, err)
+		}
 
-		return "", fmt.Errorf("%s: %w", operator, err)
-	}
+		log.Info("Successfully logged in to sso")
 
-	// Авторизация
-	if err := bcrypt.CompareHashAndPassword(user.PasswordHash, []byte(password)); err != nil {
-		a.log.Error("Invalid password", sl.Err(err))
+		a.audit(ctx, models.AuditLoginSucceeded, user.Id, AdminAppID, map[string]any{"username": username})
 
-		return "", fmt.Errorf("%s: %w", operator, ErrInvalidCredentials)
+		return token, nil
 	}
 
 	// Проверяем приложение в которое пользователь пытается зайти
@@ -115,11 +158,52 @@ func (a *Auth) Login(
 		return "", fmt.Errorf("%s: %w", operator, ErrInvalidCredentials)
 	}
 
+	a.audit(ctx, models.AuditLoginSucceeded, user.Id, app.Id, map[string]any{"username": username})
+
 	return token, nil
 }
 
+// Authenticate проверяет логин и пароль пользователя по очереди во всех источниках и возвращает его
+// appID нужен только для журнала аудита, приложение здесь не проверяется.
+// Для неактивной учётной записи с верным паролем возвращает ошибку статуса, например models.ErrAccountSuspended
+func (a *Auth) Authenticate(
+	ctx context.Context,
+	username string,
+	password string,
+	appID int,
+) (models.User, error) {
+	const operator = "auth.Authenticate"
+
+	var userID int64
+
+	for _, authenticator := range a.authenticators {
+		user, err := authenticator.Authenticate(ctx, username, password)
+		if err == nil {
+			return a.active(ctx, user, appID)
+		}
+
+		if !errors.Is(err, ErrInvalidCredentials) {
+			a.log.Error("Failed to authenticate user", sl.Err(err))
+
+			return models.User{}, fmt.Errorf("%s: %w", operator, err)
+		}
+
+		if userID == 0 {
+			userID = user.Id
+		}
+	}
+
+	a.log.Info("Invalid credentials", slog.String("username", username))
+
+	a.audit(ctx, models.AuditLoginFailed, userID, appID, map[string]any{"username": username})
+
+	return models.User{}, fmt.Errorf("%s: %w", operator, ErrInvalidCredentials)
+}
+
 // Register создаёт пользователя с указанными данными
 // Если пользователь с данным ником уже существует выдавать ошибку
+// Ник проверяется по правилам и занят, если совпадает с чужим в канонической форме.
+// Ошибка ErrInvalidUsername оборачивает причину из пакета usernames
 func (a *Auth) Register(
 	ctx context.Context,
 	username string,
@@ -134,8 +218,16 @@ func (a *Auth) Register(
 
 	log.Info("Registering user")
 
+	if err := a.usernames.Validate(username); err != nil {
+		log.Info("Invalid username", sl.Err(err))
+
+		return 0, fmt.Errorf("%s: %w: %w", operator, ErrInvalidUsername, err)
+	}
+
+	username = usernames.Display(username)
+
 	// Хеширование пароля
-	passwordHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	passwordHash, err := passwords.Hash(password)
 
 	if err != nil {
 		log.Error("Failed to hash password", sl.Err(err))
@@ -143,7 +235,17 @@ func (a *Auth) Register(
 		return 0, fmt.Errorf("%s: %w", operator, err)
 	}
 
-	id, err := a.dbServices.SaveUser(ctx, username, passwordHash)
+	// Пользователь, событие user.registered в outbox и запись аудита сохраняются вместе или не сохраняются совсем
+	var id int64
+
+	err = storage.WithinTx(ctx, a.dbServices, func(ctx context.Context) error {
+		id, err = a.dbServices.SaveUser(ctx, username, passwordHash)
+		if err != nil {
+			return err
+		}
+
+		return a.auditor.Record(ctx, models.AuditUserRegistered, id, 0, map[string]any{"username": username})
+	})
 	if err != nil {
 		if errors.Is(err, storage.ErrUserExists) {
 			log.Error("GetUser already exists", sl.Err(err))
@@ -186,3 +288,105 @@ func (a *Auth) IsAdmin(ctx context.Context, userID int64) (bool, error) {
 
 	return isAdmin, nil
 }
+
+// ValidateToken проверяет токен, выданный сервисом, и возвращает данные из него
+// Токены API самого sso проверяются ключом сервера, токены приложений - секретом приложения из app_id
+func (a *Auth) ValidateToken(ctx context.Context, token string) (jwt.Claims, error) {
+	const operator = "auth.ValidateToken"
+
+	claims, err := a.parseToken(ctx, token)
+	if err != nil {
+		return jwt.Claims{}, fmt.Errorf("%s: %w", operator, err)
+	}
+
+	// Токен удалённого сервисного аккаунта тоже перестаёт приниматься сразу
+	if claims.IsServiceAccount() {
+		account, err := a.dbServices.ServiceAccountByID(ctx, claims.ServiceAccountID)
+		if err != nil {
+			if errors.Is(err, storage.ErrServiceAccountNotFound) {
+				return jwt.Claims{}, fmt.Errorf("%s: %w", operator, ErrInvalidToken)
+			}
+
+			return jwt.Claims{}, fmt.Errorf("%s: %w", operator, err)
+		}
+
+		if account.AppId != claims.AppID {
+			return jwt.Claims{}, fmt.Errorf("%s: %w", operator, ErrInvalidToken)
+		}
+
+		return claims, nil
+	}
+
+	// Токен перестаёт приниматься сразу после блокировки, не дожидаясь истечения срока
+	user, err := a.dbServices.UserByID(ctx, claims.UserID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return jwt.Claims{}, fmt.Errorf("%s: %w", operator, ErrInvalidToken)
+		}
+
+		return jwt.Claims{}, fmt.Errorf("%s: %w", operator, err)
+	}
+
+	if err := user.CheckActive(time.Now()); err != nil {
+		return jwt.Claims{}, fmt.Errorf("%s: %w", operator, err)
+	}
+
+	return claims, nil
+}
+
+func (a *Auth) parseToken(ctx context.Context, token string) (jwt.Claims, error) {
+	if jwt.IsAdminToken(token) {
+		claims, err := jwt.ParseAdminToken(token, &a.signingKey.PublicKey)
+		if err != nil {
+			return jwt.Claims{}, ErrInvalidToken
+		}
+
+		return claims, nil
+	}
+
+	appID, err := jwt.AppID(token)
+	if err != nil {
+		return jwt.Claims{}, ErrInvalidToken
+	}
+
+	app, err := a.dbServices.GetApp(ctx, appID)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return jwt.Claims{}, ErrInvalidToken
+		}
+
+		return jwt.Claims{}, err
+	}
+
+	claims, err := jwt.ParseToken(token, app)
+	if err != nil {
+		return jwt.Claims{}, ErrInvalidToken
+	}
+
+	return claims, nil
+}
+
+// Пропускает только активные учётные записи, отказ по статусу пишется в журнал аудита как неудачный вход
+func (a *Auth) active(ctx context.Context, user models.User, appID int) (models.User, error) {
+	const operator = "auth.Authenticate"
+
+	if err := user.CheckActive(time.Now()); err != nil {
+		a.log.Info("Login refused for inactive account", slog.Int64("userID", user.Id), slog.String("status", user.Status))
+
+		a.audit(ctx, models.AuditLoginFailed, user.Id, appID, map[string]any{
+			"username": user.Username,
+			"status":   user.Status,
+		})
+
+		return models.User{}, fmt.Errorf("%s: %w", operator, err)
+	}
+
+	return user, nil
+}
+
+// Пишет событие в журнал аудита. Ошибка аудита не должна ломать сам запрос, поэтому только логируется
+func (a *Auth) audit(ctx context.Context, event string, userID int64, appID int, payload map[string]any) {
+	if err := a.auditor.Record(ctx, event, userID, appID, payload); err != nil {
+		a.log.Error("Failed to write audit record", slog.String("event", event), sl.Err(err))
+	}
+}
@@ -0,0 +1,279 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"log/slog"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/lib/jwt"
+	"shilka-sso/internal/lib/passwords"
+	"shilka-sso/internal/lib/usernames"
+	"shilka-sso/internal/storage"
+	"shilka-sso/internal/storage/sqlite/sqlitetest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type nopAuditor struct{}
+
+func (nopAuditor) Record(context.Context, string, int64, int, map[string]any) error {
+	return nil
+}
+
+func TestRegisterUsernames(t *testing.T) {
+	ctx := context.Background()
+	storage, _ := sqlitetest.New(t)
+
+	service := New(
+		slog.New(slog.NewTextHandler(io.Discard, nil)),
+		storage,
+		nopAuditor{},
+		time.Hour,
+		usernames.NewPolicy(3, 32, []string{"admin"}),
+		nil,
+	)
+
+	id, err := service.Register(ctx, " Ivan.Petrov ", "password")
+	require.NoError(t, err)
+
+	// Имя хранится в том виде, в котором его ввели, а ищется в канонической форме
+	user, err := storage.GetUser(ctx, "IVAN.PETROV")
+	require.NoError(t, err)
+	assert.Equal(t, id, user.Id)
+	assert.Equal(t, "Ivan.Petrov", user.Username)
+
+	user, err = service.Authenticate(ctx, "ivan.petrov", "password", 0)
+	require.NoError(t, err)
+	assert.Equal(t, id, user.Id)
+
+	_, err = service.Register(ctx, "ivan.petrov", "password")
+	assert.ErrorIs(t, err, ErrUserExists)
+
+	_, err = service.Register(ctx, "Admin", "password")
+	assert.ErrorIs(t, err, ErrInvalidUsername)
+	assert.ErrorIs(t, err, usernames.ErrReserved)
+
+	_, err = service.Register(ctx, "ivan petrov", "password")
+	assert.ErrorIs(t, err, usernames.ErrInvalidCharacters)
+}
+
+func TestCanonicalizeExistingUsernames(t *testing.T) {
+	ctx := context.Background()
+	storage, path := sqlitetest.New(t)
+
+	// Пользователи, созданные до канонической формы
+	db, err := sql.Open("sqlite3", path)
+	require.NoError(t, err)
+	defer db.Close()
+
+	for _, username := range []string{"admin", "Admin", "аdmin", "ivan"} {
+		_, err := db.Exec("INSERT INTO users(username, pass_hash) VALUES (?, ?)", username, []byte("hash"))
+		require.NoError(t, err)
+	}
+
+	collisions, err := storage.CanonicalizeUsernames(ctx)
+	require.NoError(t, err)
+	require.Len(t, collisions, 2)
+	assert.Equal(t, "Admin", collisions[0].Username)
+	assert.Equal(t, "аdmin", collisions[1].Username)
+	assert.Equal(t, int64(1), collisions[0].ConflictsWith)
+
+	// Повторный запуск ничего не меняет
+	again, err := storage.CanonicalizeUsernames(ctx)
+	require.NoError(t, err)
+	assert.Len(t, again, 2)
+
+	// Первый пользователь находится по любому написанию, остальные - только по точному имени
+	user, err := storage.GetUser(ctx, "ADMIN")
+	require.NoError(t, err)
+	assert.Equal(t, "admin", user.Username)
+
+	user, err = storage.GetUser(ctx, "Admin")
+	require.NoError(t, err)
+	assert.Equal(t, "Admin", user.Username)
+
+	user, err = storage.GetUser(ctx, "IVAN")
+	require.NoError(t, err)
+	assert.Equal(t, "ivan", user.Username)
+
+	_, err = storage.SaveUser(ctx, "ADMIN", []byte("hash"))
+	assert.Error(t, err)
+}
+
+func TestInactiveAccounts(t *testing.T) {
+	ctx := context.Background()
+	storage, path := sqlitetest.New(t)
+	sqlitetest.SaveApp(t, path, models.App{Id: 1, Name: "app", Secret: "secret"})
+
+	service := New(
+		slog.New(slog.NewTextHandler(io.Discard, nil)),
+		storage,
+		nopAuditor{},
+		time.Hour,
+		usernames.NewPolicy(3, 32, nil),
+		nil,
+	)
+
+	id, err := service.Register(ctx, "ivan", "password")
+	require.NoError(t, err)
+
+	token, err := service.Login(ctx, "ivan", "password", 1)
+	require.NoError(t, err)
+
+	_, err = service.ValidateToken(ctx, token)
+	require.NoError(t, err)
+
+	tests := []struct {
+		status string
+		err    error
+	}{
+		{status: models.AccountSuspended, err: models.ErrAccountSuspended},
+		{status: models.AccountDisabled, err: models.ErrAccountDisabled},
+		{status: models.AccountPending, err: models.ErrAccountPending},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			require.NoError(t, storage.SetAccountStatus(ctx, models.AccountStatusChange{
+				UserId:    id,
+				Status:    tt.status,
+				Reason:    "test",
+				CreatedAt: time.Now(),
+			}))
+
+			_, err := service.Login(ctx, "ivan", "password", 1)
+			assert.ErrorIs(t, err, tt.err)
+
+			// Уже выданный токен тоже перестаёт приниматься
+			_, err = service.ValidateToken(ctx, token)
+			assert.ErrorIs(t, err, tt.err)
+
+			// С неверным паролем статус не раскрывается
+			_, err = service.Login(ctx, "ivan", "wrong", 1)
+			assert.ErrorIs(t, err, ErrInvalidCredentials)
+		})
+	}
+
+	require.NoError(t, storage.SetAccountStatus(ctx, models.AccountStatusChange{
+		UserId:    id,
+		Status:    models.AccountActive,
+		CreatedAt: time.Now(),
+	}))
+
+	claims, err := service.ValidateToken(ctx, token)
+	require.NoError(t, err)
+	assert.Equal(t, id, claims.UserID)
+}
+
+func TestLegacyHashUpgrade(t *testing.T) {
+	ctx := context.Background()
+	storage, _ := sqlitetest.New(t)
+
+	service := New(
+		slog.New(slog.NewTextHandler(io.Discard, nil)),
+		storage,
+		nopAuditor{},
+		time.Hour,
+		usernames.NewPolicy(3, 32, nil),
+		nil,
+	)
+
+	// md5("pepper" + "secret") из старой PHP системы
+	legacy, err := passwords.Import("afcd70a1438b9b8ce9be72e89ca602a8", "pepper")
+	require.NoError(t, err)
+
+	id, err := storage.SaveUser(ctx, "ivan", legacy)
+	require.NoError(t, err)
+
+	_, err = service.Authenticate(ctx, "ivan", "wrong", 0)
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+
+	user, err := storage.UserByID(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, legacy, user.PasswordHash)
+
+	_, err = service.Authenticate(ctx, "ivan", "secret", 0)
+	require.NoError(t, err)
+
+	// После входа хэш заменён на bcrypt, и старый пароль по-прежнему подходит
+	user, err = storage.UserByID(ctx, id)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(user.PasswordHash), "$2a$"))
+	assert.False(t, passwords.NeedsUpgrade(user.PasswordHash))
+
+	_, err = service.Authenticate(ctx, "ivan", "secret", 0)
+	assert.NoError(t, err)
+}
+
+// Журнал аудита, который не принимает записи
+type failingAuditor struct{}
+
+func (failingAuditor) Record(context.Context, string, int64, int, map[string]any) error {
+	return errors.New("audit log is unavailable")
+}
+
+// Пользователь, событие в outbox и запись аудита сохраняются одной транзакцией
+func TestRegisterRollback(t *testing.T) {
+	ctx := context.Background()
+	st, _ := sqlitetest.New(t)
+
+	service := New(
+		slog.New(slog.NewTextHandler(io.Discard, nil)),
+		st,
+		failingAuditor{},
+		time.Hour,
+		usernames.NewPolicy(3, 32, nil),
+		nil,
+	)
+
+	_, err := service.Register(ctx, "ivan", "password")
+	require.Error(t, err)
+
+	_, err = st.GetUser(ctx, "ivan")
+	assert.ErrorIs(t, err, storage.ErrUserNotFound)
+
+	events, err := st.PendingEvents(ctx, 10)
+	require.NoError(t, err)
+	assert.Empty(t, events)
+}
+
+// Токен удалённого сервисного аккаунта отклоняется сразу, хотя срок у него ещё не вышел
+func TestValidateTokenDeletedServiceAccount(t *testing.T) {
+	ctx := context.Background()
+	st, path := sqlitetest.New(t)
+
+	app := models.App{Id: 1, Name: "app", Secret: "secret"}
+	sqlitetest.SaveApp(t, path, app)
+
+	service := New(
+		slog.New(slog.NewTextHandler(io.Discard, nil)),
+		st,
+		nopAuditor{},
+		time.Hour,
+		usernames.NewPolicy(3, 32, nil),
+		nil,
+	)
+
+	account := models.ServiceAccount{AppId: app.Id, Name: "worker", ClientId: "sa_worker", SecretHash: "hash", CreatedAt: time.Now()}
+
+	var err error
+	account.Id, err = st.SaveServiceAccount(ctx, account)
+	require.NoError(t, err)
+
+	token, err := jwt.NewServiceToken(account, app, time.Hour, "")
+	require.NoError(t, err)
+
+	claims, err := service.ValidateToken(ctx, token)
+	require.NoError(t, err)
+	assert.Equal(t, account.Id, claims.ServiceAccountID)
+
+	require.NoError(t, st.DeleteServiceAccount(ctx, account.Id))
+
+	_, err = service.ValidateToken(ctx, token)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
@@ -0,0 +1,356 @@
+// Package ldap Проверка паролей через LDAP / Active Directory
+// Пользователи каталога создаются в бд при первом входе, роль администратора берётся из групп каталога.
+// С существующим пользователем бд запись каталога связывается только по настройке Links или подтверждённой почте
+package ldap
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"github.com/go-ldap/ldap/v3"
+	"log/slog"
+	"net"
+	"net/url"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/lib/identifiers"
+	"shilka-sso/internal/lib/usernames"
+	"shilka-sso/internal/services/auth"
+	"shilka-sso/internal/storage"
+	"strings"
+	"time"
+)
+
+// ConnectorID под этим id пользователи каталога хранятся среди внешних пользователей
+const ConnectorID = "ldap"
+
+// RoleAdmin роль, которую можно выдать группе каталога
+const RoleAdmin = "admin"
+
+// Config настройки подключения к каталогу
+type Config struct {
+	URL      string
+	StartTLS bool
+	// Учётная запись, под которой ищется пользователь. Если пустая, поиск идёт анонимно
+	BindDN       string
+	BindPassword string
+	BaseDN       string
+	// Фильтр поиска пользователя, %s заменяется на экранированное имя
+	UserFilter string
+	// Атрибут с DN групп пользователя
+	GroupAttribute string
+	// DN группы - роль в sso
+	GroupRoles map[string]string
+	// DN записи каталога - имя существующего пользователя бд, с которым её надо связать
+	Links map[string]string
+	// Атрибут с почтой. Запись связывается с пользователем бд, у которого эта почта подтверждена
+	EmailAttribute string
+	Timeout        time.Duration
+}
+
+type LDAP struct {
+	log        *slog.Logger
+	storage    Storage
+	usernames  *usernames.Policy
+	cfg        Config
+	adminGroup map[string]bool
+	links      map[string]string
+}
+
+// Storage методы бд, которые нужны для создания пользователей каталога
+type Storage interface {
+	GetUser(ctx context.Context, username string) (models.User, error)
+	UserByIdentifier(ctx context.Context, login string) (models.User, error)
+	Identifiers(ctx context.Context, userID int64) ([]models.Identifier, error)
+	FederatedUser(ctx context.Context, connectorID string, subject string) (models.User, error)
+	LinkFederatedIdentity(ctx context.Context, identity models.FederatedIdentity) error
+	SaveFederatedUser(ctx context.Context, username string, identity models.FederatedIdentity) (int64, error)
+	IsAdmin(ctx context.Context, userID int64) (bool, error)
+	SetAdmin(ctx context.Context, userID int64, isAdmin bool) error
+}
+
+// New возвращает источник, который проверяет пароль bind'ом в каталог
+// usernamePolicy проверяет имена пользователей, которые создаются при первом входе
+func New(log *slog.Logger, storage Storage, usernamePolicy *usernames.Policy, cfg Config) (*LDAP, error) {
+	const operator = "ldap.New"
+
+	if !strings.Contains(cfg.UserFilter, "%s") {
+		return nil, fmt.Errorf("%s: user filter must contain %%s", operator)
+	}
+
+	adminGroup := make(map[string]bool)
+	for group, role := range cfg.GroupRoles {
+		if role != RoleAdmin {
+			return nil, fmt.Errorf("%s: unknown role %q for group %s", operator, role, group)
+		}
+
+		adminGroup[normalizeDN(group)] = true
+	}
+
+	links := make(map[string]string, len(cfg.Links))
+	for dn, username := range cfg.Links {
+		links[normalizeDN(dn)] = username
+	}
+
+	return &LDAP{
+		log:        log,
+		storage:    storage,
+		usernames:  usernamePolicy,
+		cfg:        cfg,
+		adminGroup: adminGroup,
+		links:      links,
+	}, nil
+}
+
+// Authenticate Находит пользователя в каталоге и проверяет пароль bind'ом от его имени
+// Пользователь каталога при первом входе связывается с пользователем бд или создаётся без пароля.
+// Если имя уже занято пользователем бд, с которым запись не связана, вход не проходит с auth.ErrUserExists
+func (l *LDAP) Authenticate(ctx context.Context, username string, password string) (models.User, error) {
+	const operator = "ldap.Authenticate"
+
+	log := l.log.With(
+		slog.String("operator", operator),
+		slog.String("username", username),
+	)
+
+	// Bind с пустым паролем в LDAP анонимный и всегда успешен
+	if username == "" || password == "" {
+		return models.User{}, fmt.Errorf("%s: %w", operator, auth.ErrInvalidCredentials)
+	}
+
+	conn, err := l.dial()
+	if err != nil {
+		return models.User{}, fmt.Errorf("%s: %w", operator, err)
+	}
+	defer conn.Close()
+
+	entry, err := l.findUser(conn, username)
+	if err != nil {
+		return models.User{}, fmt.Errorf("%s: %w", operator, err)
+	}
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return models.User{}, fmt.Errorf("%s: %w", operator, auth.ErrInvalidCredentials)
+		}
+
+		return models.User{}, fmt.Errorf("%s: %w", operator, err)
+	}
+
+	user, err := l.user(ctx, entry, username)
+	if err != nil {
+		return models.User{}, fmt.Errorf("%s: %w", operator, err)
+	}
+
+	if err := l.syncRole(ctx, user, entry.GetAttributeValues(l.cfg.GroupAttribute)); err != nil {
+		return models.User{}, fmt.Errorf("%s: %w", operator, err)
+	}
+
+	log.Info("User authenticated by directory", slog.Int64("userID", user.Id))
+
+	return user, nil
+}
+
+func (l *LDAP) dial() (*ldap.Conn, error) {
+	conn, err := ldap.DialURL(l.cfg.URL, ldap.DialWithDialer(&net.Dialer{Timeout: l.cfg.Timeout}))
+	if err != nil {
+		return nil, err
+	}
+
+	conn.SetTimeout(l.cfg.Timeout)
+
+	if l.cfg.StartTLS {
+		u, err := url.Parse(l.cfg.URL)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+
+		if err := conn.StartTLS(&tls.Config{ServerName: u.Hostname()}); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	return conn, nil
+}
+
+// Ищет ровно одну запись пользователя, под служебной учётной записью если она задана
+func (l *LDAP) findUser(conn *ldap.Conn, username string) (*ldap.Entry, error) {
+	if l.cfg.BindDN != "" {
+		if err := conn.Bind(l.cfg.BindDN, l.cfg.BindPassword); err != nil {
+			return nil, fmt.Errorf("service bind: %w", err)
+		}
+	}
+
+	attributes := []string{"dn"}
+	if l.cfg.GroupAttribute != "" {
+		attributes = append(attributes, l.cfg.GroupAttribute)
+	}
+	if l.cfg.EmailAttribute != "" {
+		attributes = append(attributes, l.cfg.EmailAttribute)
+	}
+
+	res, err := conn.Search(ldap.NewSearchRequest(
+		l.cfg.BaseDN,
+		ldap.ScopeWholeSubtree,
+		ldap.NeverDerefAliases,
+		2,
+		int(l.cfg.Timeout.Seconds()),
+		false,
+		fmt.Sprintf(l.cfg.UserFilter, ldap.EscapeFilter(username)),
+		attributes,
+		nil,
+	))
+	if err != nil && !ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		return nil, err
+	}
+
+	// Если имя неоднозначно, входить нельзя ни под одной из записей
+	if res == nil || len(res.Entries) != 1 {
+		return nil, auth.ErrInvalidCredentials
+	}
+
+	return res.Entries[0], nil
+}
+
+// Находит пользователя бд, связанного с записью каталога, или связывает и создаёт его
+// Совпадение имени ничего не доказывает: локальный пользователь мог завести имя раньше,
+// и роль из групп каталога досталась бы ему. Поэтому по имени записи не связываются
+func (l *LDAP) user(ctx context.Context, entry *ldap.Entry, username string) (models.User, error) {
+	dn := normalizeDN(entry.DN)
+
+	user, err := l.storage.FederatedUser(ctx, ConnectorID, dn)
+	if err == nil {
+		return user, nil
+	}
+	if !errors.Is(err, storage.ErrFederatedIdentityNotFound) {
+		return models.User{}, err
+	}
+
+	identity := models.FederatedIdentity{
+		ConnectorId: ConnectorID,
+		Subject:     dn,
+		CreatedAt:   time.Now(),
+	}
+
+	user, err = l.linkedUser(ctx, entry)
+	if err == nil {
+		identity.UserId = user.Id
+		if err := l.storage.LinkFederatedIdentity(ctx, identity); err != nil {
+			return models.User{}, err
+		}
+
+		l.log.Info("Directory user linked", slog.String("dn", dn), slog.Int64("userID", user.Id))
+
+		return user, nil
+	}
+	if !errors.Is(err, storage.ErrUserNotFound) {
+		return models.User{}, err
+	}
+
+	if err := l.usernames.Validate(username); err != nil {
+		return models.User{}, fmt.Errorf("%w: %w", auth.ErrInvalidUsername, err)
+	}
+
+	id, err := l.storage.SaveFederatedUser(ctx, username, identity)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserExists) {
+			l.log.Warn("Directory username is taken by a local user", slog.String("dn", dn), slog.String("username", username))
+
+			return models.User{}, fmt.Errorf("username %s is taken: %w", username, auth.ErrUserExists)
+		}
+
+		return models.User{}, err
+	}
+
+	l.log.Info("Directory user provisioned", slog.String("username", username), slog.Int64("userID", id))
+
+	return models.User{Id: id, Username: username}, nil
+}
+
+// Пользователь бд, с которым запись каталога связана в Links или по подтверждённой почте,
+// или ErrUserNotFound, если такого нет
+func (l *LDAP) linkedUser(ctx context.Context, entry *ldap.Entry) (models.User, error) {
+	if username, ok := l.links[normalizeDN(entry.DN)]; ok {
+		return l.storage.GetUser(ctx, username)
+	}
+
+	if l.cfg.EmailAttribute == "" {
+		return models.User{}, storage.ErrUserNotFound
+	}
+
+	email := entry.GetAttributeValue(l.cfg.EmailAttribute)
+
+	canonical, err := identifiers.Canonical(models.IdentifierEmail, email)
+	if err != nil {
+		return models.User{}, storage.ErrUserNotFound
+	}
+
+	user, err := l.storage.UserByIdentifier(ctx, canonical)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	// UserByIdentifier находит и пользователя с таким именем, а связывать можно только по самой почте
+	userIdentifiers, err := l.storage.Identifiers(ctx, user.Id)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	for _, identifier := range userIdentifiers {
+		if identifier.Kind == models.IdentifierEmail && identifier.Canonical == canonical && identifier.Verified() {
+			return user, nil
+		}
+	}
+
+	return models.User{}, storage.ErrUserNotFound
+}
+
+// Приводит роль пользователя к ролям его групп. Без настроенных групп роли выдаются вручную
+func (l *LDAP) syncRole(ctx context.Context, user models.User, groups []string) error {
+	if len(l.adminGroup) == 0 {
+		return nil
+	}
+
+	shouldBeAdmin := false
+	for _, group := range groups {
+		if l.adminGroup[normalizeDN(group)] {
+			shouldBeAdmin = true
+			break
+		}
+	}
+
+	isAdmin, err := l.storage.IsAdmin(ctx, user.Id)
+	if err != nil {
+		return err
+	}
+
+	if isAdmin == shouldBeAdmin {
+		return nil
+	}
+
+	l.log.Info("Syncing user role from directory groups", slog.Int64("userID", user.Id), slog.Bool("isAdmin", shouldBeAdmin))
+
+	return l.storage.SetAdmin(ctx, user.Id, shouldBeAdmin)
+}
+
+// DN в каталоге регистронезависимы, а вокруг запятых бывают пробелы
+func normalizeDN(dn string) string {
+	parsed, err := ldap.ParseDN(dn)
+	if err != nil {
+		return strings.ToLower(dn)
+	}
+
+	rdns := make([]string, 0, len(parsed.RDNs))
+	for _, rdn := range parsed.RDNs {
+		attributes := make([]string, 0, len(rdn.Attributes))
+		for _, attribute := range rdn.Attributes {
+			attributes = append(attributes, strings.ToLower(attribute.Type)+"="+strings.ToLower(attribute.Value))
+		}
+
+		rdns = append(rdns, strings.Join(attributes, "+"))
+	}
+
+	return strings.Join(rdns, ",")
+}
@@ -0,0 +1,434 @@
+package ldap
+
+import (
+	"context"
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"io"
+	"log/slog"
+	"net"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/lib/usernames"
+	"shilka-sso/internal/services/auth"
+	"shilka-sso/internal/storage"
+	"shilka-sso/internal/storage/sqlite"
+	"shilka-sso/internal/storage/sqlite/sqlitetest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	baseDN          = "ou=people,dc=example,dc=com"
+	serviceDN       = "cn=sso,dc=example,dc=com"
+	servicePassword = "service"
+	adminsGroup     = "cn=sso-admins,ou=groups,dc=example,dc=com"
+)
+
+// Запись каталога тестового сервера
+type entry struct {
+	uid      string
+	password string
+	groups   []string
+	mail     string
+}
+
+func (e entry) dn() string {
+	return "uid=" + e.uid + "," + baseDN
+}
+
+// Минимальный LDAP сервер: простой bind, поиск по (uid=...) под служебной учётной записью и unbind
+type directory struct {
+	listener net.Listener
+	entries  []entry
+}
+
+func newDirectory(t *testing.T, entries ...entry) *directory {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	d := &directory{listener: listener, entries: entries}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go d.serve(conn)
+		}
+	}()
+
+	return d
+}
+
+func (d *directory) url() string {
+	return "ldap://" + d.listener.Addr().String()
+}
+
+func (d *directory) serve(conn net.Conn) {
+	defer conn.Close()
+
+	var boundDN string
+
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+
+		messageID := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			dn := op.Children[1].Data.String()
+			password := op.Children[2].Data.String()
+
+			code := uint16(ldap.LDAPResultInvalidCredentials)
+			if d.bind(dn, password) {
+				code, boundDN = ldap.LDAPResultSuccess, dn
+			}
+
+			d.write(conn, messageID, result(ldap.ApplicationBindResponse, code))
+		case ldap.ApplicationSearchRequest:
+			if boundDN != serviceDN {
+				d.write(conn, messageID, result(ldap.ApplicationSearchResultDone, ldap.LDAPResultInsufficientAccessRights))
+				continue
+			}
+
+			filter, err := ldap.DecompileFilter(op.Children[6])
+			if err != nil {
+				d.write(conn, messageID, result(ldap.ApplicationSearchResultDone, ldap.LDAPResultProtocolError))
+				continue
+			}
+
+			for _, e := range d.entries {
+				if filter == "(uid="+ldap.EscapeFilter(e.uid)+")" {
+					d.write(conn, messageID, searchEntry(e))
+				}
+			}
+
+			d.write(conn, messageID, result(ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess))
+		case ldap.ApplicationUnbindRequest:
+			return
+		}
+	}
+}
+
+func (d *directory) bind(dn string, password string) bool {
+	if dn == serviceDN {
+		return password == servicePassword
+	}
+
+	for _, e := range d.entries {
+		if strings.EqualFold(e.dn(), dn) {
+			return password != "" && e.password == password
+		}
+	}
+
+	return false
+}
+
+func (d *directory) write(conn net.Conn, messageID int64, op *ber.Packet) {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageID, "MessageID"))
+	packet.AppendChild(op)
+
+	_, _ = conn.Write(packet.Bytes())
+}
+
+func result(tag ber.Tag, code uint16) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Result")
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), "resultCode"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "matchedDN"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "diagnosticMessage"))
+
+	return op
+}
+
+func searchEntry(e entry) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Search Result Entry")
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, e.dn(), "objectName"))
+
+	attribute := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attribute")
+	attribute.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "memberOf", "type"))
+
+	values := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "vals")
+	for _, group := range e.groups {
+		values.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, group, "value"))
+	}
+	attribute.AppendChild(values)
+
+	attributes := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "attributes")
+	attributes.AppendChild(attribute)
+
+	if e.mail != "" {
+		mail := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attribute")
+		mail.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "mail", "type"))
+
+		values := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "vals")
+		values.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, e.mail, "value"))
+		mail.AppendChild(values)
+
+		attributes.AppendChild(mail)
+	}
+
+	op.AppendChild(attributes)
+
+	return op
+}
+
+type nopAuditor struct{}
+
+func (nopAuditor) Record(context.Context, string, int64, int, map[string]any) error {
+	return nil
+}
+
+func newTestLDAP(t *testing.T, d *directory) (*LDAP, *sqlite.Storage) {
+	t.Helper()
+
+	storage, _ := sqlitetest.New(t)
+
+	return newTestLDAPWithStorage(t, d, storage, nil), storage
+}
+
+// links - связи записей каталога с пользователями, которые заведены в storage заранее
+func newTestLDAPWithStorage(t *testing.T, d *directory, storage *sqlite.Storage, links map[string]string) *LDAP {
+	t.Helper()
+
+	directory, err := New(slog.New(slog.NewTextHandler(io.Discard, nil)), storage, usernames.NewPolicy(3, 32, nil), Config{
+		URL:            d.url(),
+		BindDN:         serviceDN,
+		BindPassword:   servicePassword,
+		BaseDN:         baseDN,
+		UserFilter:     "(uid=%s)",
+		GroupAttribute: "memberOf",
+		GroupRoles:     map[string]string{"CN=SSO-Admins, OU=Groups, DC=example, DC=com": RoleAdmin},
+		Links:          links,
+		EmailAttribute: "mail",
+		Timeout:        5 * time.Second,
+	})
+	require.NoError(t, err)
+
+	return directory
+}
+
+func TestAuthenticateProvisionsUser(t *testing.T) {
+	ctx := context.Background()
+
+	d := newDirectory(t, entry{uid: "ivan", password: "secret", groups: []string{adminsGroup}})
+	directory, storage := newTestLDAP(t, d)
+
+	user, err := directory.Authenticate(ctx, "ivan", "secret")
+	require.NoError(t, err)
+	assert.Equal(t, "ivan", user.Username)
+
+	saved, err := storage.GetUser(ctx, "ivan")
+	require.NoError(t, err)
+	assert.Equal(t, user.Id, saved.Id)
+	assert.Empty(t, saved.PasswordHash)
+
+	// Роль берётся из группы каталога
+	isAdmin, err := storage.IsAdmin(ctx, user.Id)
+	require.NoError(t, err)
+	assert.True(t, isAdmin)
+
+	again, err := directory.Authenticate(ctx, "ivan", "secret")
+	require.NoError(t, err)
+	assert.Equal(t, user.Id, again.Id)
+}
+
+func TestAuthenticateRejects(t *testing.T) {
+	d := newDirectory(t, entry{uid: "ivan", password: "secret"})
+	directory, _ := newTestLDAP(t, d)
+
+	tests := []struct {
+		name     string
+		username string
+		password string
+	}{
+		{name: "wrong password", username: "ivan", password: "wrong"},
+		{name: "unknown user", username: "petr", password: "secret"},
+		// Bind с пустым паролем анонимный, его нельзя считать входом
+		{name: "empty password", username: "ivan", password: ""},
+		{name: "filter injection", username: "*", password: "secret"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := directory.Authenticate(context.Background(), tt.username, tt.password)
+			assert.ErrorIs(t, err, auth.ErrInvalidCredentials)
+		})
+	}
+}
+
+func TestAuthenticateSyncsRole(t *testing.T) {
+	ctx := context.Background()
+
+	d := newDirectory(t, entry{uid: "petr", password: "secret"})
+	directory, storage := newTestLDAP(t, d)
+
+	user, err := directory.Authenticate(ctx, "petr", "secret")
+	require.NoError(t, err)
+
+	require.NoError(t, storage.SetAdmin(ctx, user.Id, true))
+
+	// Пользователя нет в группе администраторов, роль снимается при следующем входе
+	_, err = directory.Authenticate(ctx, "petr", "secret")
+	require.NoError(t, err)
+
+	isAdmin, err := storage.IsAdmin(ctx, user.Id)
+	require.NoError(t, err)
+	assert.False(t, isAdmin)
+}
+
+func TestAuthFallsBackToDirectory(t *testing.T) {
+	ctx := context.Background()
+
+	ivan := entry{uid: "ivan", password: "directory"}
+	d := newDirectory(t, ivan)
+	storage, _ := sqlitetest.New(t)
+
+	passHash, err := bcrypt.GenerateFromPassword([]byte("local"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	localID, err := storage.SaveUser(ctx, "ivan", passHash)
+	require.NoError(t, err)
+
+	directory := newTestLDAPWithStorage(t, d, storage, map[string]string{ivan.dn(): "ivan"})
+
+	authService := auth.New(
+		slog.New(slog.NewTextHandler(io.Discard, nil)),
+		storage,
+		nopAuditor{},
+		time.Hour,
+		usernames.NewPolicy(3, 32, nil),
+		nil,
+		auth.NewLocal(slog.New(slog.NewTextHandler(io.Discard, nil)), storage),
+		directory,
+	)
+
+	// Подходит и локальный пароль, и пароль из каталога, пользователь при этом один
+	for _, password := range []string{"local", "directory"} {
+		user, err := authService.Authenticate(ctx, "ivan", password, 0)
+		require.NoError(t, err, password)
+		assert.Equal(t, localID, user.Id)
+	}
+
+	_, err = authService.Authenticate(ctx, "ivan", "wrong", 0)
+	assert.ErrorIs(t, err, auth.ErrInvalidCredentials)
+}
+
+// Локальный пользователь с тем же именем не связывается с записью каталога, иначе роль из групп каталога
+// досталась бы чужой учётной записи
+func TestAuthenticateUsernameCollision(t *testing.T) {
+	ctx := context.Background()
+
+	d := newDirectory(t,
+		entry{uid: "ivan", password: "secret", groups: []string{adminsGroup}},
+		entry{uid: "petr", password: "secret"},
+	)
+	storage, _ := sqlitetest.New(t)
+	directory := newTestLDAPWithStorage(t, d, storage, nil)
+
+	ivanID, err := storage.SaveUser(ctx, "ivan", []byte("hash"))
+	require.NoError(t, err)
+
+	petrID, err := storage.SaveUser(ctx, "Petr", []byte("hash"))
+	require.NoError(t, err)
+	require.NoError(t, storage.SetAdmin(ctx, petrID, true))
+
+	_, err = directory.Authenticate(ctx, "ivan", "secret")
+	assert.ErrorIs(t, err, auth.ErrUserExists)
+
+	// Имя совпадает только в канонической форме, это тоже конфликт
+	_, err = directory.Authenticate(ctx, "petr", "secret")
+	assert.ErrorIs(t, err, auth.ErrUserExists)
+
+	isAdmin, err := storage.IsAdmin(ctx, ivanID)
+	require.NoError(t, err)
+	assert.False(t, isAdmin)
+
+	isAdmin, err = storage.IsAdmin(ctx, petrID)
+	require.NoError(t, err)
+	assert.True(t, isAdmin)
+
+	identities, err := storage.FederatedIdentities(ctx, ivanID)
+	require.NoError(t, err)
+	assert.Empty(t, identities)
+}
+
+func TestAuthenticateLinks(t *testing.T) {
+	ctx := context.Background()
+
+	ivan := entry{uid: "ivan", password: "secret", groups: []string{adminsGroup}}
+	petr := entry{uid: "petr", password: "secret", mail: "Petr@Example.com"}
+	anna := entry{uid: "anna", password: "secret", mail: "anna@example.com"}
+	d := newDirectory(t, ivan, petr, anna)
+	storage, _ := sqlitetest.New(t)
+
+	ivanID, err := storage.SaveUser(ctx, "ivan.local", []byte("hash"))
+	require.NoError(t, err)
+
+	petrID, err := storage.SaveUser(ctx, "petr.local", []byte("hash"))
+	require.NoError(t, err)
+
+	annaID, err := storage.SaveUser(ctx, "anna.local", []byte("hash"))
+	require.NoError(t, err)
+
+	now := time.Now()
+	for userID, email := range map[int64]string{petrID: "petr@example.com", annaID: "anna@example.com"} {
+		require.NoError(t, storage.SetIdentifier(ctx, models.Identifier{
+			UserId:        userID,
+			Kind:          models.IdentifierEmail,
+			Value:         email,
+			Canonical:     email,
+			CodeHash:      "code-hash",
+			CodeExpiresAt: now.Add(time.Hour),
+			CreatedAt:     now,
+		}))
+	}
+	require.NoError(t, storage.VerifyIdentifier(ctx, petrID, models.IdentifierEmail))
+
+	directory := newTestLDAPWithStorage(t, d, storage, map[string]string{ivan.dn(): "ivan.local"})
+
+	// Связь задана администратором
+	user, err := directory.Authenticate(ctx, "ivan", "secret")
+	require.NoError(t, err)
+	assert.Equal(t, ivanID, user.Id)
+
+	isAdmin, err := storage.IsAdmin(ctx, ivanID)
+	require.NoError(t, err)
+	assert.True(t, isAdmin)
+
+	// Почта из каталога подтверждена у пользователя sso
+	user, err = directory.Authenticate(ctx, "petr", "secret")
+	require.NoError(t, err)
+	assert.Equal(t, petrID, user.Id)
+
+	// Неподтверждённая почта ничего не доказывает, создаётся новый пользователь
+	user, err = directory.Authenticate(ctx, "anna", "secret")
+	require.NoError(t, err)
+	assert.NotEqual(t, annaID, user.Id)
+	assert.Equal(t, "anna", user.Username)
+}
+
+func TestAuthenticateInvalidUsername(t *testing.T) {
+	d := newDirectory(t, entry{uid: "iv", password: "secret"})
+	directory, st := newTestLDAP(t, d)
+
+	_, err := directory.Authenticate(context.Background(), "iv", "secret")
+	assert.ErrorIs(t, err, auth.ErrInvalidUsername)
+	assert.ErrorIs(t, err, usernames.ErrInvalidLength)
+
+	_, err = st.GetUser(context.Background(), "iv")
+	assert.ErrorIs(t, err, storage.ErrUserNotFound)
+}
@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/lib/logger/sl"
+	"shilka-sso/internal/lib/passwords"
+	"shilka-sso/internal/storage"
+)
+
+// Local проверяет пароль по хэшу из бд
+// Кроме bcrypt это могут быть хэши, перенесённые импортом из другой системы. Слабые из них
+// при успешном входе заменяются на bcrypt
+type Local struct {
+	log   *slog.Logger
+	users UserGetter
+}
+
+// UserGetter Методы бд, нужные Local
+type UserGetter interface {
+	UserByIdentifier(ctx context.Context, login string) (models.User, error)
+	SetPasswordHash(ctx context.Context, userID int64, passwordHash []byte) error
+}
+
+// NewLocal возвращает источник, который проверяет локальный пароль пользователя
+func NewLocal(log *slog.Logger, users UserGetter) *Local {
+	return &Local{log: log, users: users}
+}
+
+// Authenticate Идентефикация пользователя по имени, подтверждённой почте или телефону и проверка пароля
+// У пользователей из внешних источников хэш пустой, поэтому здесь они никогда не проходят
+func (l *Local) Authenticate(ctx context.Context, username string, password string) (models.User, error) {
+	const operator = "auth.Local.Authenticate"
+
+	user, err := l.users.UserByIdentifier(ctx, username)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return models.User{}, fmt.Errorf("%s: %w", operator, ErrInvalidCredentials)
+		}
+
+		return models.User{}, fmt.Errorf("%s: %w", operator, err)
+	}
+
+	if !passwords.Verify(user.PasswordHash, password) {
+		return models.User{Id: user.Id}, fmt.Errorf("%s: %w", operator, ErrInvalidCredentials)
+	}
+
+	if passwords.NeedsUpgrade(user.PasswordHash) {
+		l.upgrade(ctx, user.Id, password)
+	}
+
+	return user, nil
+}
+
+// Заменяет слабый хэш на bcrypt. Если не получилось, вход всё равно проходит, хэш заменится в следующий раз
+func (l *Local) upgrade(ctx context.Context, userID int64, password string) {
+	const operator = "auth.Local.upgrade"
+
+	log := l.log.With(
+		slog.String("operator", operator),
+		slog.Int64("userID", userID),
+	)
+
+	hash, err := passwords.Hash(password)
+	if err != nil {
+		log.Error("Failed to hash password", sl.Err(err))
+
+		return
+	}
+
+	if err := l.users.SetPasswordHash(ctx, userID, hash); err != nil {
+		log.Error("Failed to upgrade password hash", sl.Err(err))
+
+		return
+	}
+
+	log.Info("Legacy password hash upgraded")
+}
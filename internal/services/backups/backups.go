@@ -0,0 +1,119 @@
+// Package backups Сервис резервного копирования бд для администраторов
+package backups
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/lib/backup"
+	"shilka-sso/internal/lib/logger/sl"
+	"time"
+)
+
+type Backups struct {
+	log     *slog.Logger
+	storage backup.Snapshotter
+	auditor Auditor
+	dir     string
+	opts    backup.Options
+	now     func() time.Time
+}
+
+// Auditor Журнал аудита, в который пишутся действия администраторов
+type Auditor interface {
+	Record(ctx context.Context, event string, userID int64, appID int, payload map[string]any) error
+}
+
+// Ошибки сервисного слоя
+var (
+	ErrNotSupported = errors.New("storage does not support online backups")
+)
+
+// New возвращает новый объект сервиса Backups
+// storage равен nil, если хранилище не умеет делать снимки, например PostgreSQL: его копирует pg_dump
+func New(
+	log *slog.Logger,
+	storage backup.Snapshotter,
+	auditor Auditor,
+	dir string,
+	opts backup.Options,
+) *Backups {
+	return &Backups{
+		log:     log,
+		storage: storage,
+		auditor: auditor,
+		dir:     dir,
+		opts:    opts,
+		now:     time.Now,
+	}
+}
+
+// Create Пишет копию бд в каталог копий, пока сервис продолжает работать
+// actorID - администратор, который запросил копию
+func (b *Backups) Create(ctx context.Context, actorID int64) (models.Backup, error) {
+	const operator = "backups.Create"
+
+	log := b.log.With(
+		slog.String("operator", operator),
+		slog.Int64("actorID", actorID),
+	)
+
+	if b.storage == nil {
+		return models.Backup{}, fmt.Errorf("%s: %w", operator, ErrNotSupported)
+	}
+
+	log.Info("Creating backup")
+
+	if err := os.MkdirAll(b.dir, 0o700); err != nil {
+		log.Error("Failed to create backups directory", sl.Err(err))
+
+		return models.Backup{}, fmt.Errorf("%s: %w", operator, err)
+	}
+
+	createdAt := b.now().UTC()
+
+	// Копии, запрошенные в одну секунду, например по расписанию и вручную, различаются суффиксом.
+	// Если имя всё же совпадёт, backup.Create вернёт ошибку, а не перезапишет прежнюю копию
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		log.Error("Failed to generate backup name", sl.Err(err))
+
+		return models.Backup{}, fmt.Errorf("%s: %w", operator, err)
+	}
+
+	result := models.Backup{
+		Name:       "sso-" + createdAt.Format("20060102-150405") + "-" + hex.EncodeToString(suffix) + ".backup",
+		CreatedAt:  createdAt,
+		Compressed: b.opts.Compress,
+		Encrypted:  b.opts.Key != nil,
+	}
+
+	size, err := backup.Create(ctx, b.storage, filepath.Join(b.dir, result.Name), b.opts)
+	if err != nil {
+		log.Error("Failed to create backup", sl.Err(err))
+
+		return models.Backup{}, fmt.Errorf("%s: %w", operator, err)
+	}
+
+	result.Size = size
+
+	err = b.auditor.Record(ctx, models.AuditBackupCreated, actorID, 0, map[string]any{
+		"file":       result.Name,
+		"size":       result.Size,
+		"compressed": result.Compressed,
+		"encrypted":  result.Encrypted,
+	})
+	if err != nil {
+		log.Error("Failed to write audit record", sl.Err(err))
+	}
+
+	log.Info("Backup created", slog.String("name", result.Name), slog.Int64("size", result.Size))
+
+	return result, nil
+}
@@ -0,0 +1,60 @@
+package backups
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/lib/backup"
+	"shilka-sso/internal/storage/sqlite/sqlitetest"
+	"testing"
+	"time"
+)
+
+type recordingAuditor struct {
+	events []string
+}
+
+func (a *recordingAuditor) Record(_ context.Context, event string, _ int64, _ int, _ map[string]any) error {
+	a.events = append(a.events, event)
+	return nil
+}
+
+func TestCreate(t *testing.T) {
+	ctx := context.Background()
+	storage, _ := sqlitetest.New(t)
+	auditor := &recordingAuditor{}
+	dir := filepath.Join(t.TempDir(), "backups")
+
+	service := New(slog.New(slog.NewTextHandler(io.Discard, nil)), storage, auditor, dir, backup.Options{Compress: true})
+	service.now = func() time.Time { return time.Date(2026, 10, 19, 6, 30, 0, 0, time.UTC) }
+
+	result, err := service.Create(ctx, 1)
+	require.NoError(t, err)
+	assert.Regexp(t, `^sso-20261019-063000-[0-9a-f]{8}\.backup$`, result.Name)
+	assert.True(t, result.Compressed)
+	assert.False(t, result.Encrypted)
+
+	info, err := os.Stat(filepath.Join(dir, result.Name))
+	require.NoError(t, err)
+	assert.Equal(t, info.Size(), result.Size)
+	assert.Equal(t, []string{models.AuditBackupCreated}, auditor.events)
+
+	// Вторая копия в ту же секунду не затирает первую
+	second, err := service.Create(ctx, 1)
+	require.NoError(t, err)
+	assert.NotEqual(t, result.Name, second.Name)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+
+	unsupported := New(slog.New(slog.NewTextHandler(io.Discard, nil)), nil, auditor, dir, backup.Options{})
+
+	_, err = unsupported.Create(ctx, 1)
+	assert.ErrorIs(t, err, ErrNotSupported)
+}
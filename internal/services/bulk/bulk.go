@@ -0,0 +1,456 @@
+// Package bulk Массовый импорт пользователей из других систем и выгрузка пользователей в файл
+package bulk
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/lib/identifiers"
+	"shilka-sso/internal/lib/logger/sl"
+	"shilka-sso/internal/lib/passwords"
+	"shilka-sso/internal/lib/usernames"
+	"shilka-sso/internal/storage"
+	"slices"
+	"time"
+)
+
+type Bulk struct {
+	log       *slog.Logger
+	storage   Storage
+	usernames *usernames.Policy
+	now       func() time.Time
+}
+
+// Storage Методы бд, нужные импорту и выгрузке
+// Если хранилище реализует storage.TxManager, каждая пачка импортируется в одной транзакции
+type Storage interface {
+	SaveUser(ctx context.Context, username string, passwordHash []byte) (int64, error)
+	GetUser(ctx context.Context, username string) (models.User, error)
+	ListUsers(ctx context.Context, afterID int64, limit int) ([]models.User, error)
+	SetAccountStatus(ctx context.Context, change models.AccountStatusChange) error
+	Identifiers(ctx context.Context, userID int64) ([]models.Identifier, error)
+	SetIdentifier(ctx context.Context, identifier models.Identifier) error
+	VerifyIdentifier(ctx context.Context, userID int64, kind string) error
+}
+
+// Ошибки сервисного слоя
+var (
+	ErrUsernameRequired = errors.New("username is required")
+	ErrUserExists       = errors.New("user already exists")
+	ErrEmailExists      = errors.New("email is already used by another user")
+	ErrDuplicateRow     = errors.New("username repeats an earlier row")
+)
+
+// Причина в истории статусов у пользователей, выключенных в исходной системе
+const disabledReason = "disabled before import"
+
+// Размер пачки по умолчанию и размер страницы выгрузки
+const (
+	DefaultBatchSize = 500
+	exportPageSize   = 500
+)
+
+// ImportOptions DryRun - только проверить записи, ничего не записывая в бд
+type ImportOptions struct {
+	DryRun    bool
+	BatchSize int
+}
+
+// ImportReport Итоги импорта
+type ImportReport struct {
+	Total    int
+	Imported int
+	Failed   int
+	// Сколько импортированных пользователей со слабыми хэшами получат bcrypt при следующем входе
+	Upgrade int
+	Errors  []*RowError
+}
+
+// New возвращает новый объект сервиса Bulk
+// usernamePolicy - те же правила для имён, что и при регистрации
+func New(
+	log *slog.Logger,
+	storage Storage,
+	usernamePolicy *usernames.Policy,
+) *Bulk {
+	return &Bulk{
+		log:       log,
+		storage:   storage,
+		usernames: usernamePolicy,
+		now:       time.Now,
+	}
+}
+
+// Подготовленная к записи строка
+type row struct {
+	record       Record
+	username     string
+	passwordHash []byte
+	email        models.Identifier
+}
+
+// Import Читает записи из r и сохраняет пользователей пачками по opts.BatchSize
+// Ошибка в записи не останавливает импорт, она попадает в отчёт. Возвращаемая ошибка означает,
+// что импорт прерван: файл не читается дальше или бд недоступна
+func (b *Bulk) Import(ctx context.Context, r Reader, opts ImportOptions) (ImportReport, error) {
+	const operator = "bulk.Import"
+
+	log := b.log.With(
+		slog.String("operator", operator),
+		slog.Bool("dryRun", opts.DryRun),
+	)
+
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+
+	log.Info("Importing users")
+
+	var report ImportReport
+
+	// Канонические имена и почты из уже прочитанных строк, чтобы повтор в файле не дошёл до бд
+	seenUsernames := make(map[string]int)
+	seenEmails := make(map[string]int)
+
+	batch := make([]row, 0, opts.BatchSize)
+
+	fail := func(rowErr *RowError) {
+		report.Failed++
+		report.Errors = append(report.Errors, rowErr)
+	}
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+
+		if err := b.importBatch(ctx, batch, opts.DryRun, &report, fail); err != nil {
+			return err
+		}
+
+		batch = batch[:0]
+
+		return nil
+	}
+
+	for {
+		record, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			var rowErr *RowError
+			if errors.As(err, &rowErr) {
+				report.Total++
+				fail(rowErr)
+
+				continue
+			}
+
+			log.Error("Failed to read import file", sl.Err(err))
+
+			return report, fmt.Errorf("%s: %w", operator, err)
+		}
+
+		report.Total++
+
+		prepared, err := b.prepare(record)
+		if err == nil {
+			err = checkSeen(seenUsernames, usernames.Canonical(prepared.username), record.Line, ErrDuplicateRow)
+		}
+
+		if err == nil && prepared.email.Canonical != "" {
+			err = checkSeen(seenEmails, prepared.email.Canonical, record.Line, ErrEmailExists)
+		}
+
+		if err != nil {
+			fail(&RowError{Line: record.Line, Username: record.Username, Err: err})
+
+			continue
+		}
+
+		batch = append(batch, prepared)
+
+		if len(batch) == opts.BatchSize {
+			if err := flush(); err != nil {
+				log.Error("Failed to import batch", sl.Err(err))
+
+				return report, fmt.Errorf("%s: %w", operator, err)
+			}
+		}
+	}
+
+	if err := flush(); err != nil {
+		log.Error("Failed to import batch", sl.Err(err))
+
+		return report, fmt.Errorf("%s: %w", operator, err)
+	}
+
+	// Ошибки проверки строк появляются раньше ошибок записи их пачки
+	slices.SortStableFunc(report.Errors, func(a, b *RowError) int {
+		return cmp.Compare(a.Line, b.Line)
+	})
+
+	log.Info("Users imported",
+		slog.Int("total", report.Total),
+		slog.Int("imported", report.Imported),
+		slog.Int("failed", report.Failed),
+		slog.Int("upgrade", report.Upgrade),
+	)
+
+	return report, nil
+}
+
+func checkSeen(seen map[string]int, key string, line int, err error) error {
+	if first, ok := seen[key]; ok {
+		return fmt.Errorf("%w (line %d)", err, first)
+	}
+
+	seen[key] = line
+
+	return nil
+}
+
+// Проверяет запись без обращения к бд
+func (b *Bulk) prepare(record Record) (row, error) {
+	// Пустой хэш, как у пользователей из внешних источников: войти по паролю нельзя
+	prepared := row{record: record, username: usernames.Display(record.Username), passwordHash: []byte{}}
+
+	if prepared.username == "" {
+		return row{}, ErrUsernameRequired
+	}
+
+	if err := b.usernames.Validate(record.Username); err != nil {
+		return row{}, err
+	}
+
+	if record.PasswordHash != "" || record.Salt != "" {
+		hash, err := passwords.Import(record.PasswordHash, record.Salt)
+		if err != nil {
+			return row{}, err
+		}
+
+		prepared.passwordHash = hash
+	}
+
+	if record.Email != "" {
+		canonical, err := identifiers.Canonical(models.IdentifierEmail, record.Email)
+		if err != nil {
+			return row{}, err
+		}
+
+		prepared.email = models.Identifier{
+			Kind:      models.IdentifierEmail,
+			Value:     record.Email,
+			Canonical: canonical,
+			CreatedAt: b.now(),
+		}
+	}
+
+	return prepared, nil
+}
+
+// Сохраняет пачку. В хранилище с транзакциями пачка пишется в одной транзакции, а каждая строка -
+// в своей точке сохранения, поэтому ошибка строки откатывает только её
+func (b *Bulk) importBatch(ctx context.Context, batch []row, dryRun bool, report *ImportReport, fail func(*RowError)) error {
+	imported := make([]row, 0, len(batch))
+
+	importRow := func(ctx context.Context, r row) {
+		var err error
+
+		if dryRun {
+			err = b.checkRow(ctx, r)
+		} else {
+			err = b.importRow(ctx, r)
+		}
+
+		if err != nil {
+			fail(&RowError{Line: r.record.Line, Username: r.record.Username, Err: err})
+
+			return
+		}
+
+		imported = append(imported, r)
+	}
+
+	txManager, ok := b.storage.(storage.TxManager)
+	if !ok || dryRun {
+		for _, r := range batch {
+			importRow(ctx, r)
+		}
+	} else {
+		err := txManager.WithinTx(ctx, func(ctx context.Context) error {
+			for _, r := range batch {
+				_ = txManager.WithinTx(ctx, func(ctx context.Context) error {
+					before := len(imported)
+					importRow(ctx, r)
+
+					if len(imported) == before {
+						return errRowFailed
+					}
+
+					return nil
+				})
+			}
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, r := range imported {
+		report.Imported++
+
+		if passwords.NeedsUpgrade(r.passwordHash) {
+			report.Upgrade++
+		}
+	}
+
+	return nil
+}
+
+// Откатывает точку сохранения строки, сама ошибка уже в отчёте
+var errRowFailed = errors.New("row failed")
+
+func (b *Bulk) checkRow(ctx context.Context, r row) error {
+	_, err := b.storage.GetUser(ctx, r.username)
+	if err == nil {
+		return ErrUserExists
+	}
+
+	if !errors.Is(err, storage.ErrUserNotFound) {
+		return err
+	}
+
+	return nil
+}
+
+func (b *Bulk) importRow(ctx context.Context, r row) error {
+	userID, err := b.storage.SaveUser(ctx, r.username, r.passwordHash)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserExists) {
+			return ErrUserExists
+		}
+
+		return err
+	}
+
+	if r.email.Canonical != "" {
+		r.email.UserId = userID
+
+		if err := b.storage.SetIdentifier(ctx, r.email); err != nil {
+			if errors.Is(err, storage.ErrIdentifierExists) {
+				return ErrEmailExists
+			}
+
+			return err
+		}
+
+		if r.record.EmailVerified {
+			if err := b.storage.VerifyIdentifier(ctx, userID, models.IdentifierEmail); err != nil {
+				if errors.Is(err, storage.ErrIdentifierExists) {
+					return ErrEmailExists
+				}
+
+				return err
+			}
+		}
+	}
+
+	if r.record.Disabled {
+		err := b.storage.SetAccountStatus(ctx, models.AccountStatusChange{
+			UserId:    userID,
+			Status:    models.AccountDisabled,
+			Reason:    disabledReason,
+			CreatedAt: b.now(),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Export Выгружает всех пользователей, кроме удалённых, в w. Хэши паролей выгружаются в формате хранения,
+// поэтому выгрузку можно импортировать обратно. Возвращает число выгруженных пользователей
+func (b *Bulk) Export(ctx context.Context, w Writer) (int, error) {
+	const operator = "bulk.Export"
+
+	log := b.log.With(slog.String("operator", operator))
+
+	log.Info("Exporting users")
+
+	count := 0
+
+	for afterID := int64(0); ; {
+		users, err := b.storage.ListUsers(ctx, afterID, exportPageSize)
+		if err != nil {
+			log.Error("Failed to list users", sl.Err(err))
+
+			return count, fmt.Errorf("%s: %w", operator, err)
+		}
+
+		if len(users) == 0 {
+			break
+		}
+
+		for _, user := range users {
+			if user.Status == models.AccountErased {
+				continue
+			}
+
+			record, err := b.exportRecord(ctx, user)
+			if err != nil {
+				log.Error("Failed to export user", slog.Int64("userID", user.Id), sl.Err(err))
+
+				return count, fmt.Errorf("%s: %w", operator, err)
+			}
+
+			if err := w.Write(record); err != nil {
+				return count, fmt.Errorf("%s: %w", operator, err)
+			}
+
+			count++
+		}
+
+		afterID = users[len(users)-1].Id
+	}
+
+	if err := w.Flush(); err != nil {
+		return count, fmt.Errorf("%s: %w", operator, err)
+	}
+
+	log.Info("Users exported", slog.Int("count", count))
+
+	return count, nil
+}
+
+func (b *Bulk) exportRecord(ctx context.Context, user models.User) (Record, error) {
+	record := Record{
+		Username:     user.Username,
+		PasswordHash: string(user.PasswordHash),
+		Disabled:     user.Status == models.AccountDisabled,
+	}
+
+	userIdentifiers, err := b.storage.Identifiers(ctx, user.Id)
+	if err != nil {
+		return Record{}, err
+	}
+
+	for _, identifier := range userIdentifiers {
+		if identifier.Kind == models.IdentifierEmail {
+			record.Email = identifier.Value
+			record.EmailVerified = identifier.Verified()
+		}
+	}
+
+	return record, nil
+}
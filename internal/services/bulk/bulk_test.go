@@ -0,0 +1,232 @@
+package bulk
+
+import (
+	"bytes"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"log/slog"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/lib/passwords"
+	"shilka-sso/internal/lib/usernames"
+	"shilka-sso/internal/storage/memory"
+	"shilka-sso/internal/storage/sqlite/sqlitetest"
+	"strings"
+	"testing"
+)
+
+const importCSV = `username,password_hash,salt,email,email_verified,disabled
+alice,afcd70a1438b9b8ce9be72e89ca602a8,pepper,alice@example.com,true,
+bob,,,bob@example.com,false,true
+ALICE,,,,,
+carol,plain,,,,
+dave,,,alice@example.com,,
+,,,,,
+erin,,,,maybe,
+`
+
+// Пароль secret, pbkdf2-sha512 с 210000 итерациями, как хранит Keycloak 24+
+const importKeycloak = `{
+  "realm": "demo",
+  "roles": {"realm": []},
+  "users": [
+    {
+      "username": "frank",
+      "email": "frank@example.com",
+      "emailVerified": true,
+      "enabled": true,
+      "credentials": [{
+        "type": "password",
+        "secretData": "{\"value\":\"tYHHpQ48A6e4VTzzrfViyjHBCiXxAOe9RpdA9ujqMW2omxvbcnc5cqY0q2bMmbj/obT06e6LyHXp8R5ThWk7Gw==\",\"salt\":\"a2Mtc2FsdC0xNi1ieXRlcw==\"}",
+        "credentialData": "{\"hashIterations\":210000,\"algorithm\":\"pbkdf2-sha512\"}"
+      }]
+    },
+    {
+      "username": "grace",
+      "enabled": false,
+      "credentials": [{"type": "password", "secretData": "{\"value\":\"a2V5\",\"salt\":\"c2FsdA==\"}", "credentialData": "{\"hashIterations\":1,\"algorithm\":\"md4\"}"}]
+    }
+  ]
+}`
+
+func newBulk(storage Storage) *Bulk {
+	return New(slog.New(slog.NewTextHandler(io.Discard, nil)), storage, usernames.NewPolicy(3, 32, []string{"admin"}))
+}
+
+func importString(t *testing.T, b *Bulk, format string, data string, opts ImportOptions) ImportReport {
+	t.Helper()
+
+	reader, err := NewReader(format, strings.NewReader(data))
+	require.NoError(t, err)
+
+	report, err := b.Import(context.Background(), reader, opts)
+	require.NoError(t, err)
+
+	return report
+}
+
+func errorLines(report ImportReport) []int {
+	lines := make([]int, 0, len(report.Errors))
+	for _, rowErr := range report.Errors {
+		lines = append(lines, rowErr.Line)
+	}
+
+	return lines
+}
+
+func TestImportCSV(t *testing.T) {
+	ctx := context.Background()
+	storage, _ := sqlitetest.New(t)
+	b := newBulk(storage)
+
+	// Пачка по две строки: ошибка строки откатывает только её точку сохранения
+	report := importString(t, b, FormatCSV, importCSV, ImportOptions{BatchSize: 2})
+
+	assert.Equal(t, 7, report.Total)
+	assert.Equal(t, 2, report.Imported)
+	assert.Equal(t, 5, report.Failed)
+	assert.Equal(t, 1, report.Upgrade)
+	assert.Equal(t, []int{4, 5, 6, 7, 8}, errorLines(report))
+	assert.ErrorIs(t, report.Errors[0], ErrDuplicateRow)
+	assert.ErrorIs(t, report.Errors[1], passwords.ErrUnsupportedHash)
+	assert.ErrorIs(t, report.Errors[2], ErrEmailExists)
+	assert.ErrorIs(t, report.Errors[3], ErrUsernameRequired)
+
+	alice, err := storage.UserByIdentifier(ctx, "alice@example.com")
+	require.NoError(t, err)
+	assert.True(t, passwords.Verify(alice.PasswordHash, "secret"))
+	assert.True(t, passwords.NeedsUpgrade(alice.PasswordHash))
+
+	bob, err := storage.GetUser(ctx, "bob")
+	require.NoError(t, err)
+	assert.Equal(t, models.AccountDisabled, bob.Status)
+	assert.Empty(t, bob.PasswordHash)
+
+	// Неподтверждённая почта не годится как логин
+	_, err = storage.UserByIdentifier(ctx, "bob@example.com")
+	assert.Error(t, err)
+
+	// Повторный импорт того же файла: все пользователи уже есть
+	report = importString(t, b, FormatCSV, importCSV, ImportOptions{})
+	assert.Equal(t, 0, report.Imported)
+	assert.ErrorIs(t, report.Errors[0], ErrUserExists)
+}
+
+func TestImportDryRun(t *testing.T) {
+	ctx := context.Background()
+	storage, err := memory.New()
+	require.NoError(t, err)
+
+	_, err = storage.SaveUser(ctx, "bob", nil)
+	require.NoError(t, err)
+
+	b := newBulk(storage)
+
+	report := importString(t, b, FormatCSV, importCSV, ImportOptions{DryRun: true})
+
+	assert.Equal(t, 1, report.Imported)
+	assert.Equal(t, 6, report.Failed)
+	assert.Equal(t, []int{3, 4, 5, 6, 7, 8}, errorLines(report))
+	assert.ErrorIs(t, report.Errors[0], ErrUserExists)
+
+	_, err = storage.GetUser(ctx, "alice")
+	assert.Error(t, err)
+}
+
+func TestImportKeycloak(t *testing.T) {
+	ctx := context.Background()
+	storage, _ := sqlitetest.New(t)
+	b := newBulk(storage)
+
+	report := importString(t, b, FormatKeycloak, importKeycloak, ImportOptions{})
+
+	assert.Equal(t, 2, report.Total)
+	assert.Equal(t, 1, report.Imported)
+	assert.Equal(t, 0, report.Upgrade)
+	require.Len(t, report.Errors, 1)
+	assert.Equal(t, "grace", report.Errors[0].Username)
+
+	frank, err := storage.UserByIdentifier(ctx, "frank@example.com")
+	require.NoError(t, err)
+	assert.True(t, passwords.Verify(frank.PasswordHash, "secret"))
+}
+
+func TestImportJSONL(t *testing.T) {
+	storage, err := memory.New()
+	require.NoError(t, err)
+
+	data := `{"username": "alice", "email": "alice@example.com", "email_verified": true}
+
+{"username": "bob", "role": "admin"}
+{"username": "carol"`
+
+	report := importString(t, newBulk(storage), FormatJSONL, data, ImportOptions{})
+
+	assert.Equal(t, 1, report.Imported)
+	assert.Equal(t, []int{3, 4}, errorLines(report))
+}
+
+func TestImportUsernamePolicy(t *testing.T) {
+	ctx := context.Background()
+	storage, err := memory.New()
+	require.NoError(t, err)
+
+	data := `username
+alice
+admin
+аlice
+al
+bad name
+`
+
+	report := importString(t, newBulk(storage), FormatCSV, data, ImportOptions{})
+
+	assert.Equal(t, 1, report.Imported)
+	assert.Equal(t, []int{3, 4, 5, 6}, errorLines(report))
+	assert.ErrorIs(t, report.Errors[0], usernames.ErrReserved)
+	assert.ErrorIs(t, report.Errors[1], usernames.ErrMixedScripts)
+	assert.ErrorIs(t, report.Errors[2], usernames.ErrInvalidLength)
+	assert.ErrorIs(t, report.Errors[3], usernames.ErrInvalidCharacters)
+
+	_, err = storage.GetUser(ctx, "admin")
+	assert.Error(t, err)
+}
+
+func TestExportRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	source, _ := sqlitetest.New(t)
+
+	importString(t, newBulk(source), FormatCSV, importCSV, ImportOptions{})
+
+	for _, format := range []string{FormatCSV, FormatJSONL} {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+
+			writer, err := NewWriter(format, &buf)
+			require.NoError(t, err)
+
+			count, err := newBulk(source).Export(ctx, writer)
+			require.NoError(t, err)
+			assert.Equal(t, 2, count)
+
+			target, err := memory.New()
+			require.NoError(t, err)
+
+			report := importString(t, newBulk(target), format, buf.String(), ImportOptions{})
+			assert.Equal(t, 2, report.Imported)
+			assert.Empty(t, report.Errors)
+
+			alice, err := target.UserByIdentifier(ctx, "alice@example.com")
+			require.NoError(t, err)
+			assert.True(t, passwords.Verify(alice.PasswordHash, "secret"))
+
+			bob, err := target.GetUser(ctx, "bob")
+			require.NoError(t, err)
+			assert.Equal(t, models.AccountDisabled, bob.Status)
+		})
+	}
+
+	_, err := NewWriter(FormatKeycloak, io.Discard)
+	assert.ErrorIs(t, err, ErrUnknownFormat)
+}
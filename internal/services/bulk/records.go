@@ -0,0 +1,463 @@
+package bulk
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"shilka-sso/internal/lib/passwords"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Форматы файлов импорта и выгрузки
+const (
+	FormatCSV   = "csv"
+	FormatJSONL = "jsonl"
+	// Выгрузка realm Keycloak ({"users": [...]}), только для импорта
+	FormatKeycloak = "keycloak"
+)
+
+// Record пользователь в файле импорта или выгрузки
+type Record struct {
+	// Номер строки в файле, для Keycloak - номер пользователя в users. Нужен для отчёта об ошибках
+	Line     int    `json:"-"`
+	Username string `json:"username"`
+	// Хэш пароля в любом формате, который понимает passwords.Import. Пустой - пользователь без пароля
+	PasswordHash string `json:"password_hash,omitempty"`
+	// Соль salted md5, для остальных форматов соль входит в хэш
+	Salt          string `json:"salt,omitempty"`
+	Email         string `json:"email,omitempty"`
+	EmailVerified bool   `json:"email_verified,omitempty"`
+	Disabled      bool   `json:"disabled,omitempty"`
+}
+
+// RowError ошибка в одной записи. Остальные записи при этом обрабатываются дальше
+type RowError struct {
+	Line     int
+	Username string
+	Err      error
+}
+
+func (e *RowError) Error() string {
+	if e.Username == "" {
+		return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+	}
+
+	return fmt.Sprintf("line %d (%s): %v", e.Line, e.Username, e.Err)
+}
+
+func (e *RowError) Unwrap() error {
+	return e.Err
+}
+
+// Reader Источник записей для импорта
+// Next возвращает io.EOF, когда записи кончились, и *RowError, если запись не удалось разобрать:
+// после такой ошибки чтение можно продолжать. Остальные ошибки означают, что файл дальше не читается
+type Reader interface {
+	Next() (Record, error)
+}
+
+// Writer Получатель записей при выгрузке
+type Writer interface {
+	Write(record Record) error
+	Flush() error
+}
+
+var ErrUnknownFormat = errors.New("unknown format")
+
+// Колонки CSV в порядке выгрузки. При импорте порядок любой, обязательна только username
+var csvColumns = []string{"username", "password_hash", "salt", "email", "email_verified", "disabled"}
+
+// NewReader Возвращает читателя файла в формате format
+func NewReader(format string, r io.Reader) (Reader, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVReader(r)
+	case FormatJSONL:
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64<<10), 1<<20)
+
+		return &jsonlReader{scanner: scanner}, nil
+	case FormatKeycloak:
+		return &keycloakReader{decoder: json.NewDecoder(r)}, nil
+	}
+
+	return nil, fmt.Errorf("%w: %q", ErrUnknownFormat, format)
+}
+
+// NewWriter Возвращает писателя файла в формате format
+func NewWriter(format string, w io.Writer) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+
+		if err := cw.Write(csvColumns); err != nil {
+			return nil, err
+		}
+
+		return &csvWriter{w: cw}, nil
+	case FormatJSONL:
+		bw := bufio.NewWriter(w)
+
+		return &jsonlWriter{w: bw, encoder: json.NewEncoder(bw)}, nil
+	}
+
+	return nil, fmt.Errorf("%w: %q", ErrUnknownFormat, format)
+}
+
+type csvReader struct {
+	r       *csv.Reader
+	columns map[string]int
+}
+
+func newCSVReader(r io.Reader) (*csvReader, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read csv header: %w", err)
+	}
+
+	columns := make(map[string]int, len(header))
+
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+
+		if !slices.Contains(csvColumns, name) {
+			return nil, fmt.Errorf("unknown csv column %q", name)
+		}
+
+		columns[name] = i
+	}
+
+	if _, ok := columns["username"]; !ok {
+		return nil, errors.New("csv header must contain username column")
+	}
+
+	return &csvReader{r: cr, columns: columns}, nil
+}
+
+func (c *csvReader) Next() (Record, error) {
+	row, err := c.r.Read()
+	if err != nil {
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			return Record{}, &RowError{Line: parseErr.StartLine, Err: parseErr.Err}
+		}
+
+		return Record{}, err
+	}
+
+	line, _ := c.r.FieldPos(0)
+
+	field := func(name string) string {
+		if i, ok := c.columns[name]; ok {
+			return strings.TrimSpace(row[i])
+		}
+
+		return ""
+	}
+
+	record := Record{
+		Line:         line,
+		Username:     field("username"),
+		PasswordHash: field("password_hash"),
+		Salt:         field("salt"),
+		Email:        field("email"),
+	}
+
+	for name, value := range map[string]*bool{"email_verified": &record.EmailVerified, "disabled": &record.Disabled} {
+		if field(name) == "" {
+			continue
+		}
+
+		if *value, err = strconv.ParseBool(field(name)); err != nil {
+			return Record{}, &RowError{Line: line, Username: record.Username, Err: fmt.Errorf("invalid %s: %q", name, field(name))}
+		}
+	}
+
+	return record, nil
+}
+
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func (c *csvWriter) Write(record Record) error {
+	return c.w.Write([]string{
+		record.Username,
+		record.PasswordHash,
+		record.Salt,
+		record.Email,
+		strconv.FormatBool(record.EmailVerified),
+		strconv.FormatBool(record.Disabled),
+	})
+}
+
+func (c *csvWriter) Flush() error {
+	c.w.Flush()
+
+	return c.w.Error()
+}
+
+type jsonlReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func (j *jsonlReader) Next() (Record, error) {
+	for j.scanner.Scan() {
+		j.line++
+
+		text := strings.TrimSpace(j.scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		decoder := json.NewDecoder(strings.NewReader(text))
+		decoder.DisallowUnknownFields()
+
+		var record Record
+		if err := decoder.Decode(&record); err != nil {
+			return Record{}, &RowError{Line: j.line, Err: err}
+		}
+
+		record.Line = j.line
+
+		return record, nil
+	}
+
+	if err := j.scanner.Err(); err != nil {
+		return Record{}, err
+	}
+
+	return Record{}, io.EOF
+}
+
+type jsonlWriter struct {
+	w       *bufio.Writer
+	encoder *json.Encoder
+}
+
+func (j *jsonlWriter) Write(record Record) error {
+	return j.encoder.Encode(record)
+}
+
+func (j *jsonlWriter) Flush() error {
+	return j.w.Flush()
+}
+
+// Пользователь из выгрузки realm Keycloak
+type keycloakUser struct {
+	Username      string               `json:"username"`
+	Email         string               `json:"email"`
+	EmailVerified bool                 `json:"emailVerified"`
+	Enabled       *bool                `json:"enabled"`
+	Credentials   []keycloakCredential `json:"credentials"`
+}
+
+// Пароль Keycloak 12+ лежит в secretData и credentialData, это JSON в строках.
+// Старые выгрузки хранят те же поля прямо в credential
+type keycloakCredential struct {
+	Type           string `json:"type"`
+	SecretData     string `json:"secretData"`
+	CredentialData string `json:"credentialData"`
+
+	HashedSaltedValue string `json:"hashedSaltedValue"`
+	Salt              string `json:"salt"`
+	HashIterations    int    `json:"hashIterations"`
+	Algorithm         string `json:"algorithm"`
+}
+
+type keycloakSecret struct {
+	Value string `json:"value"`
+	Salt  string `json:"salt"`
+}
+
+type keycloakCredentialData struct {
+	HashIterations int    `json:"hashIterations"`
+	Algorithm      string `json:"algorithm"`
+	// Параметры argon2, каждое значение - массив из одной строки
+	AdditionalParameters map[string][]string `json:"additionalParameters"`
+}
+
+// Читает пользователей по одному, не загружая выгрузку целиком
+type keycloakReader struct {
+	decoder *json.Decoder
+	// Внутри массива users
+	inUsers bool
+	done    bool
+	index   int
+}
+
+func (k *keycloakReader) Next() (Record, error) {
+	if k.done {
+		return Record{}, io.EOF
+	}
+
+	if !k.inUsers {
+		if err := k.findUsers(); err != nil {
+			return Record{}, err
+		}
+	}
+
+	if !k.decoder.More() {
+		k.done = true
+
+		return Record{}, io.EOF
+	}
+
+	k.index++
+
+	var user keycloakUser
+	if err := k.decoder.Decode(&user); err != nil {
+		// После ошибки декодирования позиция в потоке неизвестна, читать дальше нельзя
+		return Record{}, fmt.Errorf("user %d: %w", k.index, err)
+	}
+
+	record := Record{
+		Line:          k.index,
+		Username:      user.Username,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
+		Disabled:      user.Enabled != nil && !*user.Enabled,
+	}
+
+	for _, credential := range user.Credentials {
+		if credential.Type != "password" {
+			continue
+		}
+
+		hash, err := keycloakHash(credential)
+		if err != nil {
+			return Record{}, &RowError{Line: k.index, Username: user.Username, Err: err}
+		}
+
+		record.PasswordHash = hash
+	}
+
+	return record, nil
+}
+
+// Пропускает поля выгрузки до массива users
+func (k *keycloakReader) findUsers() error {
+	if err := k.expect(json.Delim('{')); err != nil {
+		return err
+	}
+
+	for k.decoder.More() {
+		token, err := k.decoder.Token()
+		if err != nil {
+			return err
+		}
+
+		if token == "users" {
+			if err := k.expect(json.Delim('[')); err != nil {
+				return err
+			}
+
+			k.inUsers = true
+
+			return nil
+		}
+
+		var skip json.RawMessage
+		if err := k.decoder.Decode(&skip); err != nil {
+			return err
+		}
+	}
+
+	return errors.New("keycloak export has no users")
+}
+
+func (k *keycloakReader) expect(delim json.Delim) error {
+	token, err := k.decoder.Token()
+	if err != nil {
+		return err
+	}
+
+	if token != delim {
+		return fmt.Errorf("invalid keycloak export: expected %q", delim)
+	}
+
+	return nil
+}
+
+func keycloakHash(credential keycloakCredential) (string, error) {
+	secret := keycloakSecret{Value: credential.HashedSaltedValue, Salt: credential.Salt}
+	data := keycloakCredentialData{HashIterations: credential.HashIterations, Algorithm: credential.Algorithm}
+
+	if credential.SecretData != "" {
+		if err := json.Unmarshal([]byte(credential.SecretData), &secret); err != nil {
+			return "", fmt.Errorf("invalid secretData: %w", err)
+		}
+
+		if err := json.Unmarshal([]byte(credential.CredentialData), &data); err != nil {
+			return "", fmt.Errorf("invalid credentialData: %w", err)
+		}
+	}
+
+	salt, err := base64.StdEncoding.DecodeString(secret.Salt)
+	if err != nil {
+		return "", fmt.Errorf("invalid salt: %w", err)
+	}
+
+	key, err := base64.StdEncoding.DecodeString(secret.Value)
+	if err != nil {
+		return "", fmt.Errorf("invalid hash: %w", err)
+	}
+
+	var hash []byte
+
+	switch data.Algorithm {
+	case "pbkdf2-sha256", "pbkdf2-sha512":
+		hash, err = passwords.PBKDF2(strings.TrimPrefix(data.Algorithm, "pbkdf2-"), data.HashIterations, salt, key)
+	case "argon2":
+		hash, err = keycloakArgon2(data, salt, key)
+	default:
+		return "", fmt.Errorf("%w: keycloak %s", passwords.ErrUnsupportedHash, data.Algorithm)
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	return string(hash), nil
+}
+
+func keycloakArgon2(data keycloakCredentialData, salt []byte, key []byte) ([]byte, error) {
+	param := func(name string) string {
+		if values := data.AdditionalParameters[name]; len(values) > 0 {
+			return values[0]
+		}
+
+		return ""
+	}
+
+	if version := param("version"); version != "" && version != "1.3" {
+		return nil, fmt.Errorf("%w: argon2 version %s", passwords.ErrUnsupportedHash, version)
+	}
+
+	memory, err := strconv.ParseUint(param("memory"), 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("%w: argon2 memory", passwords.ErrInvalidHash)
+	}
+
+	parallelism, err := strconv.ParseUint(param("parallelism"), 10, 8)
+	if err != nil {
+		return nil, fmt.Errorf("%w: argon2 parallelism", passwords.ErrInvalidHash)
+	}
+
+	variant := param("type")
+	if variant == "" {
+		variant = "id"
+	}
+
+	return passwords.Argon2(variant, uint32(memory), uint32(data.HashIterations), uint8(parallelism), salt, key)
+}
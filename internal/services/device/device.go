@@ -0,0 +1,392 @@
+// Package device Вход устройств без браузера по RFC 8628 (device authorization grant)
+package device
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/lib/jwt"
+	"shilka-sso/internal/lib/logger/sl"
+	"shilka-sso/internal/storage"
+	"strings"
+	"time"
+)
+
+// GrantType тип гранта, с которым устройство опрашивает /token
+const GrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+// Алфавит user code без гласных и похожих символов, как советует RFC 8628
+const (
+	userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+	userCodeLength   = 8
+)
+
+// Насколько увеличивается интервал опроса после slow_down
+const slowDownStep = 5 * time.Second
+
+// Ошибки сервисного слоя, кроме ErrUnknownClient и ErrInvalidUserCode соответствуют ошибкам RFC 8628 и RFC 6749
+var (
+	ErrUnknownClient        = errors.New("unknown client")
+	ErrInvalidUserCode      = errors.New("invalid or expired user code")
+	ErrInvalidCredentials   = errors.New("invalid credentials")
+	ErrAccountInactive      = errors.New("account is not active")
+	ErrAuthorizationPending = errors.New("authorization_pending")
+	ErrSlowDown             = errors.New("slow_down")
+	ErrAccessDenied         = errors.New("access_denied")
+	ErrExpiredToken         = errors.New("expired_token")
+	ErrInvalidGrant         = errors.New("invalid_grant")
+	ErrInvalidScope         = errors.New("invalid_scope")
+)
+
+type Device struct {
+	log          *slog.Logger
+	users        UserAuthenticator
+	storage      Storage
+	codeTTL      time.Duration
+	pollInterval time.Duration
+	tokenTTL     time.Duration
+	slowDownStep time.Duration
+}
+
+// UserAuthenticator проверяет логин и пароль пользователя
+type UserAuthenticator interface {
+	Authenticate(ctx context.Context, username string, password string, appID int) (models.User, error)
+}
+
+// Storage Методы бд, нужные сервису
+type Storage interface {
+	GetApp(ctx context.Context, appID int) (models.App, error)
+	UserByID(ctx context.Context, userID int64) (models.User, error)
+	SaveDeviceCode(ctx context.Context, code models.DeviceCode) error
+	DeviceCode(ctx context.Context, deviceCodeHash string) (models.DeviceCode, error)
+	PendingDeviceCode(ctx context.Context, userCode string) (models.DeviceCode, error)
+	ResolveDeviceCode(ctx context.Context, userCode string, userID int64, approved bool) error
+	UpdateDevicePoll(ctx context.Context, deviceCodeHash string, polledAt time.Time, interval time.Duration) error
+	ConsumeDeviceCode(ctx context.Context, deviceCodeHash string) error
+}
+
+// Authorization ответ на запрос авторизации устройства
+type Authorization struct {
+	DeviceCode string
+	UserCode   string
+	ExpiresIn  int64
+	Interval   int64
+}
+
+// Token токен, выданный устройству
+type Token struct {
+	AccessToken string
+	ExpiresIn   int64
+	Scope       string
+}
+
+// New возвращает новый объект сервиса
+// codeTTL - сколько живёт запрос, pollInterval - минимальный интервал опроса /token устройством
+func New(
+	log *slog.Logger,
+	users UserAuthenticator,
+	storage Storage,
+	codeTTL time.Duration,
+	pollInterval time.Duration,
+	tokenTTL time.Duration,
+) *Device {
+	return &Device{
+		log:          log,
+		users:        users,
+		storage:      storage,
+		codeTTL:      codeTTL,
+		pollInterval: pollInterval,
+		tokenTTL:     tokenTTL,
+		slowDownStep: slowDownStep,
+	}
+}
+
+// Authorize Создаёт запрос на вход устройства приложения clientID
+func (d *Device) Authorize(ctx context.Context, clientID int, scope string) (Authorization, error) {
+	const operator = "device.Authorize"
+
+	log := d.log.With(
+		slog.String("operator", operator),
+		slog.Int("clientID", clientID),
+	)
+
+	app, err := d.storage.GetApp(ctx, clientID)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return Authorization{}, fmt.Errorf("%s: %w", operator, ErrUnknownClient)
+		}
+
+		return Authorization{}, fmt.Errorf("%s: %w", operator, err)
+	}
+
+	// Те же ограничения, что и у /authorize: приложение запрашивает только scope из своего списка
+	if name, ok := app.DisallowedScope(scope); ok {
+		log.Info("Requested scope is not allowed", slog.String("scope", name))
+
+		return Authorization{}, fmt.Errorf("%s: %w", operator, ErrInvalidScope)
+	}
+
+	deviceCode, err := randomDeviceCode()
+	if err != nil {
+		return Authorization{}, fmt.Errorf("%s: %w", operator, err)
+	}
+
+	userCode, err := randomUserCode()
+	if err != nil {
+		return Authorization{}, fmt.Errorf("%s: %w", operator, err)
+	}
+
+	now := time.Now()
+
+	err = d.storage.SaveDeviceCode(ctx, models.DeviceCode{
+		DeviceCodeHash: hashCode(deviceCode),
+		UserCode:       userCode,
+		AppId:          clientID,
+		Scope:          scope,
+		Status:         models.DeviceCodePending,
+		Interval:       d.pollInterval,
+		ExpiresAt:      now.Add(d.codeTTL),
+		CreatedAt:      now,
+	})
+	if err != nil {
+		log.Error("Failed to save device code", sl.Err(err))
+
+		return Authorization{}, fmt.Errorf("%s: %w", operator, err)
+	}
+
+	log.Info("Device authorization started")
+
+	return Authorization{
+		DeviceCode: deviceCode,
+		UserCode:   FormatUserCode(userCode),
+		ExpiresIn:  int64(d.codeTTL.Seconds()),
+		Interval:   int64(d.pollInterval.Seconds()),
+	}, nil
+}
+
+// Approve Подтверждает вход устройства от имени уже авторизованного пользователя
+func (d *Device) Approve(ctx context.Context, userCode string, userID int64) error {
+	return d.resolve(ctx, "device.Approve", userCode, userID, true)
+}
+
+// Deny Отклоняет вход устройства
+func (d *Device) Deny(ctx context.Context, userCode string, userID int64) error {
+	return d.resolve(ctx, "device.Deny", userCode, userID, false)
+}
+
+// ApproveWithPassword Проверяет пароль пользователя на странице подтверждения и подтверждает или отклоняет вход
+// Возвращает приложение, в которое входит устройство, чтобы показать его пользователю
+func (d *Device) ApproveWithPassword(
+	ctx context.Context,
+	userCode string,
+	username string,
+	password string,
+	approved bool,
+) (models.App, error) {
+	const operator = "device.ApproveWithPassword"
+
+	code, err := d.storage.PendingDeviceCode(ctx, NormalizeUserCode(userCode))
+	if err != nil {
+		if errors.Is(err, storage.ErrDeviceCodeNotFound) {
+			return models.App{}, fmt.Errorf("%s: %w", operator, ErrInvalidUserCode)
+		}
+
+		return models.App{}, fmt.Errorf("%s: %w", operator, err)
+	}
+
+	user, err := d.users.Authenticate(ctx, username, password, code.AppId)
+	if err != nil {
+		if errors.Is(err, models.ErrAccountInactive) {
+			return models.App{}, fmt.Errorf("%s: %w: %w", operator, ErrAccountInactive, err)
+		}
+
+		return models.App{}, fmt.Errorf("%s: %w", operator, ErrInvalidCredentials)
+	}
+
+	app, err := d.storage.GetApp(ctx, code.AppId)
+	if err != nil {
+		return models.App{}, fmt.Errorf("%s: %w", operator, err)
+	}
+
+	if err := d.resolve(ctx, operator, userCode, user.Id, approved); err != nil {
+		return models.App{}, err
+	}
+
+	return app, nil
+}
+
+func (d *Device) resolve(ctx context.Context, operator string, userCode string, userID int64, approved bool) error {
+	log := d.log.With(
+		slog.String("operator", operator),
+		slog.Int64("userID", userID),
+		slog.Bool("approved", approved),
+	)
+
+	if err := d.storage.ResolveDeviceCode(ctx, NormalizeUserCode(userCode), userID, approved); err != nil {
+		if errors.Is(err, storage.ErrDeviceCodeNotFound) {
+			return fmt.Errorf("%s: %w", operator, ErrInvalidUserCode)
+		}
+
+		log.Error("Failed to resolve device code", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", operator, err)
+	}
+
+	log.Info("Device authorization resolved")
+
+	return nil
+}
+
+// Poll Отвечает на опрос устройства: токен, если вход подтверждён, иначе ошибка из RFC 8628
+func (d *Device) Poll(ctx context.Context, clientID int, deviceCode string) (Token, error) {
+	const operator = "device.Poll"
+
+	log := d.log.With(
+		slog.String("operator", operator),
+		slog.Int("clientID", clientID),
+	)
+
+	codeHash := hashCode(deviceCode)
+
+	code, err := d.storage.DeviceCode(ctx, codeHash)
+	if err != nil {
+		if errors.Is(err, storage.ErrDeviceCodeNotFound) {
+			return Token{}, fmt.Errorf("%s: %w", operator, ErrInvalidGrant)
+		}
+
+		return Token{}, fmt.Errorf("%s: %w", operator, err)
+	}
+
+	if code.AppId != clientID || code.Status == models.DeviceCodeConsumed {
+		return Token{}, fmt.Errorf("%s: %w", operator, ErrInvalidGrant)
+	}
+
+	now := time.Now()
+
+	if code.Status == models.DeviceCodeDenied {
+		return Token{}, fmt.Errorf("%s: %w", operator, ErrAccessDenied)
+	}
+
+	if now.After(code.ExpiresAt) {
+		return Token{}, fmt.Errorf("%s: %w", operator, ErrExpiredToken)
+	}
+
+	// Устройство опрашивает чаще, чем разрешено: увеличиваем интервал для всех следующих опросов
+	interval := code.Interval
+	tooFast := !code.LastPolledAt.IsZero() && now.Sub(code.LastPolledAt) < code.Interval
+	if tooFast {
+		interval += d.slowDownStep
+	}
+
+	if err := d.storage.UpdateDevicePoll(ctx, codeHash, now, interval); err != nil {
+		return Token{}, fmt.Errorf("%s: %w", operator, err)
+	}
+
+	if tooFast {
+		return Token{}, fmt.Errorf("%s: %w", operator, ErrSlowDown)
+	}
+
+	if code.Status == models.DeviceCodePending {
+		return Token{}, fmt.Errorf("%s: %w", operator, ErrAuthorizationPending)
+	}
+
+	if err := d.storage.ConsumeDeviceCode(ctx, codeHash); err != nil {
+		if errors.Is(err, storage.ErrDeviceCodeNotFound) {
+			return Token{}, fmt.Errorf("%s: %w", operator, ErrInvalidGrant)
+		}
+
+		return Token{}, fmt.Errorf("%s: %w", operator, err)
+	}
+
+	user, err := d.storage.UserByID(ctx, code.UserId)
+	if err != nil {
+		return Token{}, fmt.Errorf("%s: %w", operator, err)
+	}
+
+	// Пока устройство ждало, учётную запись могли заблокировать
+	if err := user.CheckActive(time.Now()); err != nil {
+		log.Info("Device token refused for inactive account", slog.Int64("userID", user.Id))
+
+		return Token{}, fmt.Errorf("%s: %w: %w", operator, ErrAccessDenied, err)
+	}
+
+	app, err := d.storage.GetApp(ctx, code.AppId)
+	if err != nil {
+		return Token{}, fmt.Errorf("%s: %w", operator, err)
+	}
+
+	// Пока устройство ждало, у приложения могли сократить список scope
+	if _, ok := app.DisallowedScope(code.Scope); ok {
+		return Token{}, fmt.Errorf("%s: %w", operator, ErrInvalidScope)
+	}
+
+	accessToken, err := jwt.NewScopedToken(user, app, d.tokenTTL, code.Scope)
+	if err != nil {
+		log.Error("Failed to create token", sl.Err(err))
+
+		return Token{}, fmt.Errorf("%s: %w", operator, err)
+	}
+
+	log.Info("Device token issued", slog.Int64("userID", user.Id))
+
+	return Token{
+		AccessToken: accessToken,
+		ExpiresIn:   int64(d.tokenTTL.Seconds()),
+		Scope:       code.Scope,
+	}, nil
+}
+
+// FormatUserCode Делит user code дефисом пополам, чтобы его было проще читать с экрана
+func FormatUserCode(userCode string) string {
+	return userCode[:len(userCode)/2] + "-" + userCode[len(userCode)/2:]
+}
+
+// NormalizeUserCode Приводит введённый пользователем код к виду, в котором он хранится
+func NormalizeUserCode(userCode string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+
+		return r
+	}, strings.ToUpper(userCode))
+}
+
+func randomUserCode() (string, error) {
+	code := make([]byte, userCodeLength)
+	alphabetSize := big.NewInt(int64(len(userCodeAlphabet)))
+
+	for i := range code {
+		n, err := rand.Int(rand.Reader, alphabetSize)
+		if err != nil {
+			return "", err
+		}
+
+		code[i] = userCodeAlphabet[n.Int64()]
+	}
+
+	return string(code), nil
+}
+
+func randomDeviceCode() (string, error) {
+	buf := make([]byte, 32)
+
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func hashCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+
+	return hex.EncodeToString(sum[:])
+}
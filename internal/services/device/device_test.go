@@ -0,0 +1,152 @@
+package device
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"log/slog"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/storage/sqlite"
+	"shilka-sso/internal/storage/sqlite/sqlitetest"
+	"testing"
+	"time"
+)
+
+const appID = 1
+
+// Пускает любого пользователя с паролем "password"
+type fakeUsers struct {
+	user models.User
+}
+
+func (f fakeUsers) Authenticate(_ context.Context, _ string, password string, _ int) (models.User, error) {
+	if password != "password" {
+		return models.User{}, ErrInvalidCredentials
+	}
+
+	return f.user, nil
+}
+
+func newTestDevice(t *testing.T, codeTTL time.Duration, pollInterval time.Duration) (*Device, *sqlite.Storage) {
+	t.Helper()
+
+	storage, path := sqlitetest.New(t)
+	sqlitetest.SaveApp(t, path, models.App{Id: appID, Name: "tv", Secret: "secret"})
+
+	userID, err := storage.SaveUser(context.Background(), "shilka", []byte("hash"))
+	require.NoError(t, err)
+
+	d := New(
+		slog.New(slog.NewTextHandler(io.Discard, nil)),
+		fakeUsers{user: models.User{Id: userID, Username: "shilka"}},
+		storage,
+		codeTTL,
+		pollInterval,
+		time.Hour,
+	)
+
+	return d, storage
+}
+
+// Слишком частый опрос получает slow_down, и интервал для следующих опросов растёт
+func TestPoll_SlowDown(t *testing.T) {
+	ctx := context.Background()
+	d, storage := newTestDevice(t, time.Minute, 100*time.Millisecond)
+	d.slowDownStep = 100 * time.Millisecond
+
+	authorization, err := d.Authorize(ctx, appID, "")
+	require.NoError(t, err)
+
+	_, err = d.Poll(ctx, appID, authorization.DeviceCode)
+	require.ErrorIs(t, err, ErrAuthorizationPending)
+
+	_, err = d.Poll(ctx, appID, authorization.DeviceCode)
+	require.ErrorIs(t, err, ErrSlowDown)
+
+	code, err := storage.DeviceCode(ctx, hashCode(authorization.DeviceCode))
+	require.NoError(t, err)
+	assert.Equal(t, 200*time.Millisecond, code.Interval)
+
+	// Старого интервала уже недостаточно
+	time.Sleep(120 * time.Millisecond)
+	_, err = d.Poll(ctx, appID, authorization.DeviceCode)
+	require.ErrorIs(t, err, ErrSlowDown)
+
+	time.Sleep(320 * time.Millisecond)
+	_, err = d.Poll(ctx, appID, authorization.DeviceCode)
+	require.ErrorIs(t, err, ErrAuthorizationPending)
+}
+
+func TestPoll_Denied(t *testing.T) {
+	ctx := context.Background()
+	d, _ := newTestDevice(t, time.Minute, 0)
+
+	authorization, err := d.Authorize(ctx, appID, "")
+	require.NoError(t, err)
+
+	_, err = d.ApproveWithPassword(ctx, authorization.UserCode, "shilka", "password", false)
+	require.NoError(t, err)
+
+	_, err = d.Poll(ctx, appID, authorization.DeviceCode)
+	require.ErrorIs(t, err, ErrAccessDenied)
+
+	// Решение принимается один раз
+	require.ErrorIs(t, d.Approve(ctx, authorization.UserCode, 1), ErrInvalidUserCode)
+}
+
+func TestPoll_Expired(t *testing.T) {
+	ctx := context.Background()
+	d, _ := newTestDevice(t, 10*time.Millisecond, 0)
+
+	authorization, err := d.Authorize(ctx, appID, "")
+	require.NoError(t, err)
+
+	time.Sleep(20 * time.Millisecond)
+
+	_, err = d.Poll(ctx, appID, authorization.DeviceCode)
+	require.ErrorIs(t, err, ErrExpiredToken)
+
+	require.ErrorIs(t, d.Approve(ctx, authorization.UserCode, 1), ErrInvalidUserCode)
+}
+
+func TestPoll_WrongClient(t *testing.T) {
+	ctx := context.Background()
+	d, _ := newTestDevice(t, time.Minute, 0)
+
+	authorization, err := d.Authorize(ctx, appID, "")
+	require.NoError(t, err)
+
+	_, err = d.Poll(ctx, appID+1, authorization.DeviceCode)
+	require.ErrorIs(t, err, ErrInvalidGrant)
+
+	_, err = d.Authorize(ctx, appID+1, "")
+	require.ErrorIs(t, err, ErrUnknownClient)
+}
+
+// Устройство, как и /authorize, получает только scope из списка приложения
+func TestAuthorize_InvalidScope(t *testing.T) {
+	ctx := context.Background()
+	d, storage := newTestDevice(t, time.Minute, 0)
+
+	_, err := d.Authorize(ctx, appID, "openid admin")
+	require.ErrorIs(t, err, ErrInvalidScope)
+
+	authorization, err := d.Authorize(ctx, appID, "openid profile")
+	require.NoError(t, err)
+
+	_, err = d.ApproveWithPassword(ctx, authorization.UserCode, "shilka", "password", true)
+	require.NoError(t, err)
+
+	// Список сократили, пока устройство ждало подтверждения
+	require.NoError(t, storage.SetAppScopes(ctx, appID, []string{"openid"}))
+
+	_, err = d.Poll(ctx, appID, authorization.DeviceCode)
+	require.ErrorIs(t, err, ErrInvalidScope)
+}
+
+func TestNormalizeUserCode(t *testing.T) {
+	assert.Equal(t, "BCDFGHJK", NormalizeUserCode("bcdf-ghjk"))
+	assert.Equal(t, "BCDFGHJK", NormalizeUserCode(" BCDF GHJK "))
+	assert.Equal(t, "BCDF-GHJK", FormatUserCode("BCDFGHJK"))
+}
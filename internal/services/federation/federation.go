@@ -0,0 +1,510 @@
+// Package federation Вход через внешние провайдеры OpenID Connect (коннекторы)
+// Пользователь проходит вход у провайдера, после чего получает обычный код авторизации sso
+package federation
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+	"log/slog"
+	"net/http"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/lib/identifiers"
+	"shilka-sso/internal/lib/logger/sl"
+	"shilka-sso/internal/lib/usernames"
+	"shilka-sso/internal/services/oauth"
+	"shilka-sso/internal/storage"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Claim с именем пользователя, если в коннекторе не указан другой
+const defaultUsernameClaim = "preferred_username"
+
+// Ошибки сервисного слоя
+var (
+	ErrUnknownConnector = errors.New("unknown connector")
+	ErrInvalidState     = errors.New("invalid or expired state")
+	// ErrAccessDenied пользователь отказался от входа у провайдера или вход через коннектор ему не разрешён
+	ErrAccessDenied = errors.New("access denied")
+	// ErrUpstream провайдер недоступен или вернул некорректный ответ
+	ErrUpstream = errors.New("upstream provider error")
+)
+
+// Connector настройки внешнего провайдера
+type Connector struct {
+	ID            string
+	Name          string
+	Issuer        string
+	ClientID      string
+	ClientSecret  string
+	Scopes        []string
+	UsernameClaim string
+	AutoProvision bool
+	// Связывать вход с пользователем, у которого подтверждена та же почта, что провайдер вернул
+	// в email с email_verified. По имени вход не связывается: имя у провайдера выбирает сам пользователь
+	LinkByEmail bool
+}
+
+type Federation struct {
+	log        *slog.Logger
+	authorizer Authorizer
+	storage    Storage
+	auditor    Auditor
+	usernames  *usernames.Policy
+	connectors []*connector
+	issuer     string
+	stateTTL   time.Duration
+	httpClient *http.Client
+}
+
+// Провайдер коннектора получаем из discovery при первом входе, чтобы недоступный провайдер не мешал запуску
+type connector struct {
+	Connector
+
+	mu       sync.Mutex
+	provider *oidc.Provider
+}
+
+// Authorizer выдаёт код авторизации sso пользователю, вошедшему через коннектор
+type Authorizer interface {
+	ValidateAuthorizeRequest(ctx context.Context, req oauth.AuthorizeRequest) (models.App, error)
+	AuthorizeUser(ctx context.Context, req oauth.AuthorizeRequest, user models.User) (string, error)
+}
+
+// Storage методы бд, которые нужны сервису
+type Storage interface {
+	UserByIdentifier(ctx context.Context, login string) (models.User, error)
+	Identifiers(ctx context.Context, userID int64) ([]models.Identifier, error)
+	FederatedUser(ctx context.Context, connectorID string, subject string) (models.User, error)
+	LinkFederatedIdentity(ctx context.Context, identity models.FederatedIdentity) error
+	SaveFederatedUser(ctx context.Context, username string, identity models.FederatedIdentity) (int64, error)
+	SaveConnectorState(ctx context.Context, state models.ConnectorState) error
+	ConsumeConnectorState(ctx context.Context, stateHash string) (models.ConnectorState, error)
+}
+
+// Auditor Журнал аудита, в который пишутся события сервиса
+type Auditor interface {
+	Record(ctx context.Context, event string, userID int64, appID int, payload map[string]any) error
+}
+
+// New возвращает новый объект Federation сервиса
+// issuer - внешний адрес sso, от него строится redirect uri коннекторов.
+// Имена создаваемых при входе пользователей проверяются по тем же правилам usernamePolicy, что и при регистрации
+func New(
+	log *slog.Logger,
+	authorizer Authorizer,
+	storage Storage,
+	auditor Auditor,
+	usernamePolicy *usernames.Policy,
+	connectors []Connector,
+	issuer string,
+	stateTTL time.Duration,
+	httpClient *http.Client,
+) *Federation {
+	f := &Federation{
+		log:        log,
+		authorizer: authorizer,
+		storage:    storage,
+		auditor:    auditor,
+		usernames:  usernamePolicy,
+		issuer:     strings.TrimSuffix(issuer, "/"),
+		stateTTL:   stateTTL,
+		httpClient: httpClient,
+	}
+
+	for _, c := range connectors {
+		if c.UsernameClaim == "" {
+			c.UsernameClaim = defaultUsernameClaim
+		}
+
+		f.connectors = append(f.connectors, &connector{Connector: c})
+	}
+
+	return f
+}
+
+// Connectors Возвращает настроенные коннекторы в порядке из конфига
+func (f *Federation) Connectors() []Connector {
+	connectors := make([]Connector, 0, len(f.connectors))
+	for _, c := range f.connectors {
+		connectors = append(connectors, c.Connector)
+	}
+
+	return connectors
+}
+
+// RedirectURI Адрес, на который провайдер возвращает пользователя после входа
+func (f *Federation) RedirectURI(connectorID string) string {
+	return f.issuer + "/connectors/" + connectorID + "/callback"
+}
+
+// Start Проверяет запрос /authorize и начинает вход через коннектор
+// Возвращает адрес входа у провайдера и state, который нужно привязать к браузеру пользователя
+func (f *Federation) Start(ctx context.Context, connectorID string, req oauth.AuthorizeRequest) (string, string, error) {
+	const operator = "federation.Start"
+
+	log := f.log.With(
+		slog.String("operator", operator),
+		slog.String("connectorID", connectorID),
+		slog.Int("clientID", req.ClientID),
+	)
+
+	c, err := f.connector(connectorID)
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %w", operator, err)
+	}
+
+	if _, err := f.authorizer.ValidateAuthorizeRequest(ctx, req); err != nil {
+		return "", "", fmt.Errorf("%s: %w", operator, err)
+	}
+
+	provider, err := f.provider(ctx, c)
+	if err != nil {
+		log.Error("Failed to discover provider", sl.Err(err))
+
+		return "", "", fmt.Errorf("%s: %w", operator, ErrUpstream)
+	}
+
+	state, err := randomString()
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %w", operator, err)
+	}
+
+	nonce, err := randomString()
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %w", operator, err)
+	}
+
+	request, err := json.Marshal(req)
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %w", operator, err)
+	}
+
+	verifier := oauth2.GenerateVerifier()
+
+	err = f.storage.SaveConnectorState(ctx, models.ConnectorState{
+		StateHash:    hashState(state),
+		ConnectorId:  c.ID,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		Request:      request,
+		ExpiresAt:    time.Now().Add(f.stateTTL),
+	})
+	if err != nil {
+		log.Error("Failed to save connector state", sl.Err(err))
+
+		return "", "", fmt.Errorf("%s: %w", operator, err)
+	}
+
+	authURL := f.oauth2Config(c, provider).AuthCodeURL(
+		state,
+		oidc.Nonce(nonce),
+		oauth2.S256ChallengeOption(verifier),
+	)
+
+	log.Info("Connector login started")
+
+	return authURL, state, nil
+}
+
+// Callback Завершает вход через коннектор и выдаёт код авторизации sso
+// Возвращает исходный запрос /authorize, чтобы вызывающий мог отправить результат или ошибку на redirect_uri приложения.
+// Если state не найден, запрос пустой
+// upstreamErr - ошибка, которую провайдер вернул вместо кода
+func (f *Federation) Callback(
+	ctx context.Context,
+	connectorID string,
+	state string,
+	code string,
+	upstreamErr string,
+) (oauth.AuthorizeRequest, string, error) {
+	const operator = "federation.Callback"
+
+	log := f.log.With(
+		slog.String("operator", operator),
+		slog.String("connectorID", connectorID),
+	)
+
+	c, err := f.connector(connectorID)
+	if err != nil {
+		return oauth.AuthorizeRequest{}, "", fmt.Errorf("%s: %w", operator, err)
+	}
+
+	saved, err := f.storage.ConsumeConnectorState(ctx, hashState(state))
+	if err != nil {
+		if errors.Is(err, storage.ErrConnectorStateNotFound) {
+			return oauth.AuthorizeRequest{}, "", fmt.Errorf("%s: %w", operator, ErrInvalidState)
+		}
+
+		return oauth.AuthorizeRequest{}, "", fmt.Errorf("%s: %w", operator, err)
+	}
+
+	if saved.ConnectorId != c.ID {
+		return oauth.AuthorizeRequest{}, "", fmt.Errorf("%s: %w", operator, ErrInvalidState)
+	}
+
+	var req oauth.AuthorizeRequest
+	if err := json.Unmarshal(saved.Request, &req); err != nil {
+		return oauth.AuthorizeRequest{}, "", fmt.Errorf("%s: %w", operator, err)
+	}
+
+	log = log.With(slog.Int("clientID", req.ClientID))
+
+	if upstreamErr != "" || code == "" {
+		log.Info("Provider denied login", slog.String("error", upstreamErr))
+
+		return req, "", fmt.Errorf("%s: %w", operator, ErrAccessDenied)
+	}
+
+	upstream, err := f.exchange(ctx, c, code, saved)
+	if err != nil {
+		log.Error("Failed to complete provider login", sl.Err(err))
+
+		return req, "", fmt.Errorf("%s: %w", operator, ErrUpstream)
+	}
+
+	user, err := f.user(ctx, c, upstream, req.ClientID)
+	if err != nil {
+		log.Info("Connector login denied", slog.String("subject", upstream.subject), sl.Err(err))
+
+		return req, "", fmt.Errorf("%s: %w", operator, err)
+	}
+
+	authCode, err := f.authorizer.AuthorizeUser(ctx, req, user)
+	if err != nil {
+		return req, "", fmt.Errorf("%s: %w", operator, err)
+	}
+
+	f.audit(ctx, models.AuditLoginSucceeded, user.Id, req.ClientID, map[string]any{
+		"username":  user.Username,
+		"connector": c.ID,
+	})
+
+	log.Info("Connector login completed", slog.Int64("userID", user.Id))
+
+	return req, authCode, nil
+}
+
+// Пользователь провайдера из ID токена
+type upstreamUser struct {
+	subject  string
+	username string
+	// Почта, только если провайдер подтвердил её в email_verified
+	email string
+}
+
+// Меняет код провайдера на токены и проверяет ID токен
+func (f *Federation) exchange(ctx context.Context, c *connector, code string, saved models.ConnectorState) (upstreamUser, error) {
+	provider, err := f.provider(ctx, c)
+	if err != nil {
+		return upstreamUser{}, err
+	}
+
+	ctx = oidc.ClientContext(ctx, f.httpClient)
+
+	token, err := f.oauth2Config(c, provider).Exchange(ctx, code, oauth2.VerifierOption(saved.CodeVerifier))
+	if err != nil {
+		return upstreamUser{}, err
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return upstreamUser{}, errors.New("id_token is missing in token response")
+	}
+
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: c.ClientID}).Verify(ctx, rawIDToken)
+	if err != nil {
+		return upstreamUser{}, err
+	}
+
+	if idToken.Nonce != saved.Nonce {
+		return upstreamUser{}, errors.New("id_token nonce mismatch")
+	}
+
+	var claims map[string]any
+	if err := idToken.Claims(&claims); err != nil {
+		return upstreamUser{}, err
+	}
+
+	upstream := upstreamUser{subject: idToken.Subject}
+	upstream.username, _ = claims[c.UsernameClaim].(string)
+
+	if verified, _ := claims["email_verified"].(bool); verified {
+		upstream.email, _ = claims["email"].(string)
+	}
+
+	return upstream, nil
+}
+
+// Находит пользователя sso, связанного с пользователем провайдера
+// Если связи нет, связывает по подтверждённой почте или создаёт нового пользователя, если это разрешено в коннекторе
+func (f *Federation) user(ctx context.Context, c *connector, upstream upstreamUser, appID int) (models.User, error) {
+	user, err := f.storage.FederatedUser(ctx, c.ID, upstream.subject)
+	if err == nil {
+		return user, nil
+	}
+	if !errors.Is(err, storage.ErrFederatedIdentityNotFound) {
+		return models.User{}, err
+	}
+
+	identity := models.FederatedIdentity{
+		ConnectorId: c.ID,
+		Subject:     upstream.subject,
+		CreatedAt:   time.Now(),
+	}
+
+	if c.LinkByEmail {
+		user, err := f.userByEmail(ctx, upstream.email)
+		if err == nil {
+			identity.UserId = user.Id
+			if err := f.storage.LinkFederatedIdentity(ctx, identity); err != nil {
+				return models.User{}, err
+			}
+
+			return user, nil
+		}
+		if !errors.Is(err, storage.ErrUserNotFound) {
+			return models.User{}, err
+		}
+	}
+
+	if !c.AutoProvision {
+		return models.User{}, fmt.Errorf("user is not linked: %w", ErrAccessDenied)
+	}
+
+	username := upstream.username
+	if username == "" {
+		return models.User{}, fmt.Errorf("claim %s is empty: %w", c.UsernameClaim, ErrAccessDenied)
+	}
+
+	if err := f.usernames.Validate(username); err != nil {
+		return models.User{}, fmt.Errorf("username %s from claim %s: %w: %w", username, c.UsernameClaim, ErrAccessDenied, err)
+	}
+
+	username = usernames.Display(username)
+
+	id, err := f.storage.SaveFederatedUser(ctx, username, identity)
+	if err != nil {
+		// Имя уже занято локальным пользователем, связывать с ним по имени нельзя
+		if errors.Is(err, storage.ErrUserExists) {
+			return models.User{}, fmt.Errorf("username %s is taken: %w", username, ErrAccessDenied)
+		}
+
+		return models.User{}, err
+	}
+
+	f.audit(ctx, models.AuditUserRegistered, id, appID, map[string]any{
+		"username":  username,
+		"connector": c.ID,
+	})
+
+	return models.User{Id: id, Username: username}, nil
+}
+
+// Пользователь, у которого подтверждена почта email, или ErrUserNotFound, если такого нет
+func (f *Federation) userByEmail(ctx context.Context, email string) (models.User, error) {
+	canonical, err := identifiers.Canonical(models.IdentifierEmail, email)
+	if err != nil {
+		return models.User{}, storage.ErrUserNotFound
+	}
+
+	user, err := f.storage.UserByIdentifier(ctx, canonical)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	// UserByIdentifier находит и пользователя с таким именем, а связывать можно только по самой почте
+	userIdentifiers, err := f.storage.Identifiers(ctx, user.Id)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	for _, identifier := range userIdentifiers {
+		if identifier.Kind == models.IdentifierEmail && identifier.Canonical == canonical && identifier.Verified() {
+			return user, nil
+		}
+	}
+
+	return models.User{}, storage.ErrUserNotFound
+}
+
+func (f *Federation) connector(connectorID string) (*connector, error) {
+	for _, c := range f.connectors {
+		if c.ID == connectorID {
+			return c, nil
+		}
+	}
+
+	return nil, ErrUnknownConnector
+}
+
+// Неудачный discovery не запоминается, следующий вход попробует снова
+func (f *Federation) provider(ctx context.Context, c *connector) (*oidc.Provider, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.provider != nil {
+		return c.provider, nil
+	}
+
+	provider, err := oidc.NewProvider(oidc.ClientContext(ctx, f.httpClient), c.Issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	c.provider = provider
+
+	return provider, nil
+}
+
+func (f *Federation) oauth2Config(c *connector, provider *oidc.Provider) *oauth2.Config {
+	scopes := c.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{oidc.ScopeOpenID, "profile"}
+	}
+
+	// Без openid провайдер не выдаст ID токен
+	if !slices.Contains(scopes, oidc.ScopeOpenID) {
+		scopes = append([]string{oidc.ScopeOpenID}, scopes...)
+	}
+
+	return &oauth2.Config{
+		ClientID:     c.ClientID,
+		ClientSecret: c.ClientSecret,
+		Endpoint:     provider.Endpoint(),
+		RedirectURL:  f.RedirectURI(c.ID),
+		Scopes:       scopes,
+	}
+}
+
+// Пишет событие в журнал аудита. Ошибка аудита не должна ломать сам запрос, поэтому только логируется
+func (f *Federation) audit(ctx context.Context, event string, userID int64, appID int, payload map[string]any) {
+	if err := f.auditor.Record(ctx, event, userID, appID, payload); err != nil {
+		f.log.Error("Failed to write audit record", slog.String("event", event), sl.Err(err))
+	}
+}
+
+func randomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashState(state string) string {
+	sum := sha256.Sum256([]byte(state))
+
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,205 @@
+// Package mockoidc Провайдер OpenID Connect для тестов коннекторов
+// Сразу пропускает пользователя без формы входа и выдаёт ID токен с заданными claims
+package mockoidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"shilka-sso/internal/lib/jwt"
+	"shilka-sso/internal/lib/keys"
+	"sync"
+	"testing"
+	"time"
+)
+
+type Provider struct {
+	server       *httptest.Server
+	key          *rsa.PrivateKey
+	clientID     string
+	clientSecret string
+
+	mu      sync.Mutex
+	subject string
+	claims  map[string]any
+	deny    bool
+	codes   map[string]authorization
+}
+
+// Запрос на вход, сохранённый до обмена кода на токены
+type authorization struct {
+	redirectURI   string
+	nonce         string
+	codeChallenge string
+}
+
+// New Запускает провайдер, который закрывается вместе с тестом
+func New(t *testing.T, clientID string, clientSecret string) *Provider {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := &Provider{
+		key:          key,
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		codes:        make(map[string]authorization),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", p.discovery)
+	mux.HandleFunc("GET /jwks", p.jwks)
+	mux.HandleFunc("GET /authorize", p.authorize)
+	mux.HandleFunc("POST /token", p.token)
+
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+
+	return p
+}
+
+// Issuer адрес провайдера, он же iss в ID токенах
+func (p *Provider) Issuer() string {
+	return p.server.URL
+}
+
+// SetUser Задаёт пользователя, который войдёт при следующем входе
+func (p *Provider) SetUser(subject string, claims map[string]any) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.subject, p.claims = subject, claims
+}
+
+// Deny Провайдер будет возвращать access_denied вместо кода
+func (p *Provider) Deny(deny bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.deny = deny
+}
+
+func (p *Provider) discovery(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"issuer":                                p.server.URL,
+		"authorization_endpoint":                p.server.URL + "/authorize",
+		"token_endpoint":                        p.server.URL + "/token",
+		"jwks_uri":                              p.server.URL + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+	})
+}
+
+func (p *Provider) jwks(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"keys": []keys.JWK{keys.PublicJWK(&p.key.PublicKey)},
+	})
+}
+
+func (p *Provider) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	if query.Get("client_id") != p.clientID {
+		http.Error(w, "unknown client", http.StatusBadRequest)
+		return
+	}
+
+	target, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	params := url.Values{"state": {query.Get("state")}}
+
+	p.mu.Lock()
+	if p.deny {
+		params.Set("error", "access_denied")
+	} else {
+		code := randomString()
+		p.codes[code] = authorization{
+			redirectURI:   target.String(),
+			nonce:         query.Get("nonce"),
+			codeChallenge: query.Get("code_challenge"),
+		}
+		params.Set("code", code)
+	}
+	p.mu.Unlock()
+
+	target.RawQuery = params.Encode()
+
+	http.Redirect(w, r, target.String(), http.StatusFound)
+}
+
+func (p *Provider) token(w http.ResponseWriter, r *http.Request) {
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		clientID, clientSecret = r.PostFormValue("client_id"), r.PostFormValue("client_secret")
+	}
+
+	if clientID != p.clientID || clientSecret != p.clientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	p.mu.Lock()
+	code, ok := p.codes[r.PostFormValue("code")]
+	delete(p.codes, r.PostFormValue("code"))
+	subject, claims := p.subject, p.claims
+	p.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+
+	if !ok ||
+		code.redirectURI != r.PostFormValue("redirect_uri") ||
+		code.codeChallenge != base64.RawURLEncoding.EncodeToString(sum[:]) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	accessToken := randomString()
+
+	idToken, err := jwt.NewIDToken(p.key, keys.KeyID(&p.key.PublicKey), jwt.IDTokenClaims{
+		Issuer:      p.server.URL,
+		Subject:     subject,
+		Audience:    p.clientID,
+		Nonce:       code.nonce,
+		AuthTime:    time.Now(),
+		AccessToken: accessToken,
+		Extra:       claims,
+	}, time.Hour)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func randomString() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+
+	return base64.RawURLEncoding.EncodeToString(b)
+}
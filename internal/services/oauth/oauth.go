@@ -0,0 +1,523 @@
+// Package oauth Сервер авторизации OAuth 2.1 (код авторизации с PKCE) и провайдер OpenID Connect
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/lib/jwt"
+	"shilka-sso/internal/lib/keys"
+	"shilka-sso/internal/lib/logger/sl"
+	"shilka-sso/internal/storage"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Коды ошибок из RFC 6749
+const (
+	CodeInvalidRequest          = "invalid_request"
+	CodeInvalidClient           = "invalid_client"
+	CodeInvalidGrant            = "invalid_grant"
+	CodeInvalidScope            = "invalid_scope"
+	CodeUnsupportedGrantType    = "unsupported_grant_type"
+	CodeUnsupportedResponseType = "unsupported_response_type"
+	CodeAccessDenied            = "access_denied"
+	CodeServerError             = "server_error"
+)
+
+const (
+	ResponseTypeCode           = "code"
+	GrantTypeAuthorization     = "authorization_code"
+	GrantTypeClientCredentials = "client_credentials"
+	ChallengeMethodS256        = "S256"
+)
+
+// Scope OpenID Connect
+const (
+	// ScopeOpenID включает выдачу ID токена и доступ к /userinfo
+	ScopeOpenID = "openid"
+	// ScopeProfile добавляет в /userinfo имя пользователя
+	ScopeProfile = "profile"
+)
+
+// Ограничения на code_verifier из RFC 7636
+const (
+	minVerifierLen = 43
+	maxVerifierLen = 128
+)
+
+// Error ошибка протокола OAuth
+// Code - код ошибки из RFC 6749, Description - пояснение, которое можно показать клиенту
+type Error struct {
+	Code        string
+	Description string
+}
+
+func (e *Error) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+func newError(code string, description string) *Error {
+	return &Error{Code: code, Description: description}
+}
+
+// Ошибки сервисного слоя
+var (
+	// ErrInvalidCredentials неверный логин или пароль на странице входа
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	// ErrInvalidToken токен доступа для /userinfo не прошёл проверку
+	ErrInvalidToken = errors.New("invalid token")
+	// ErrInsufficientScope токен доступа выдан без scope openid
+	ErrInsufficientScope = errors.New("insufficient scope")
+)
+
+type OAuth struct {
+	log        *slog.Logger
+	users      UserAuthenticator
+	tokens     TokenValidator
+	storage    Storage
+	signingKey *rsa.PrivateKey
+	issuer     string
+	codeTTL    time.Duration
+	tokenTTL   time.Duration
+}
+
+// UserAuthenticator проверяет логин и пароль пользователя
+type UserAuthenticator interface {
+	Authenticate(ctx context.Context, username string, password string, appID int) (models.User, error)
+}
+
+// TokenValidator проверяет токены доступа, выданные сервером
+type TokenValidator interface {
+	ValidateToken(ctx context.Context, token string) (jwt.Claims, error)
+}
+
+// Storage Методы бд, нужные серверу авторизации
+type Storage interface {
+	GetApp(ctx context.Context, appID int) (models.App, error)
+	UserByID(ctx context.Context, userID int64) (models.User, error)
+	SaveAuthCode(ctx context.Context, code models.AuthCode) error
+	ConsumeAuthCode(ctx context.Context, codeHash string) (models.AuthCode, error)
+}
+
+// AuthorizeRequest параметры запроса на /authorize
+type AuthorizeRequest struct {
+	ResponseType        string
+	ClientID            int
+	RedirectURI         string
+	Scope               string
+	State               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	Nonce               string
+}
+
+// TokenRequest параметры запроса на /token
+type TokenRequest struct {
+	GrantType    string
+	Code         string
+	RedirectURI  string
+	ClientID     int
+	ClientSecret string
+	CodeVerifier string
+}
+
+// Token ответ /token
+// IDToken выдаётся только если запрошен scope openid
+type Token struct {
+	AccessToken string
+	TokenType   string
+	ExpiresIn   int64
+	Scope       string
+	IDToken     string
+}
+
+// New возвращает новый объект сервера авторизации
+// ID токены подписываются signingKey, issuer - внешний адрес HTTP сервера, он же iss в токенах
+func New(
+	log *slog.Logger,
+	users UserAuthenticator,
+	tokens TokenValidator,
+	storage Storage,
+	signingKey *rsa.PrivateKey,
+	issuer string,
+	codeTTL time.Duration,
+	tokenTTL time.Duration,
+) *OAuth {
+	return &OAuth{
+		log:        log,
+		users:      users,
+		tokens:     tokens,
+		storage:    storage,
+		signingKey: signingKey,
+		issuer:     strings.TrimSuffix(issuer, "/"),
+		codeTTL:    codeTTL,
+		tokenTTL:   tokenTTL,
+	}
+}
+
+// Issuer Возвращает идентификатор провайдера OpenID Connect
+func (o *OAuth) Issuer() string {
+	return o.issuer
+}
+
+// JWKS Возвращает открытые ключи, которыми можно проверить ID токены
+func (o *OAuth) JWKS() []keys.JWK {
+	return []keys.JWK{keys.PublicJWK(&o.signingKey.PublicKey)}
+}
+
+// Client Проверяет, что приложение существует и redirectURI у него зарегистрирован
+// Пока это не проверено, ошибку нельзя отправлять на redirectURI
+func (o *OAuth) Client(ctx context.Context, clientID int, redirectURI string) (models.App, error) {
+	const operator = "oauth.Client"
+
+	app, err := o.storage.GetApp(ctx, clientID)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return models.App{}, fmt.Errorf("%s: %w", operator, newError(CodeInvalidClient, "unknown client"))
+		}
+
+		return models.App{}, fmt.Errorf("%s: %w", operator, err)
+	}
+
+	if !slices.Contains(app.RedirectURIs, redirectURI) {
+		return models.App{}, fmt.Errorf("%s: %w", operator, newError(CodeInvalidRequest, "redirect_uri is not registered for the client"))
+	}
+
+	return app, nil
+}
+
+// ValidateAuthorizeRequest Проверяет параметры /authorize до того, как пользователь введёт пароль
+func (o *OAuth) ValidateAuthorizeRequest(ctx context.Context, req AuthorizeRequest) (models.App, error) {
+	const operator = "oauth.ValidateAuthorizeRequest"
+
+	app, err := o.Client(ctx, req.ClientID, req.RedirectURI)
+	if err != nil {
+		return models.App{}, fmt.Errorf("%s: %w", operator, err)
+	}
+
+	if req.ResponseType != ResponseTypeCode {
+		return models.App{}, fmt.Errorf("%s: %w", operator, newError(CodeUnsupportedResponseType, "only response_type=code is supported"))
+	}
+
+	if req.CodeChallenge == "" {
+		return models.App{}, fmt.Errorf("%s: %w", operator, newError(CodeInvalidRequest, "code_challenge is required"))
+	}
+
+	if req.CodeChallengeMethod != ChallengeMethodS256 {
+		return models.App{}, fmt.Errorf("%s: %w", operator, newError(CodeInvalidRequest, "code_challenge_method must be S256"))
+	}
+
+	if err := checkScope(app, req.Scope); err != nil {
+		return models.App{}, fmt.Errorf("%s: %w", operator, err)
+	}
+
+	return app, nil
+}
+
+// Authorize Проверяет запрос и пароль пользователя и выдаёт код авторизации
+func (o *OAuth) Authorize(ctx context.Context, req AuthorizeRequest, username string, password string) (string, error) {
+	const operator = "oauth.Authorize"
+
+	log := o.log.With(
+		slog.String("operator", operator),
+		slog.Int("clientID", req.ClientID),
+		slog.String("username", username),
+	)
+
+	app, err := o.ValidateAuthorizeRequest(ctx, req)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", operator, err)
+	}
+
+	user, err := o.users.Authenticate(ctx, username, password, app.Id)
+	if err != nil {
+		log.Info("Authorization denied", sl.Err(err))
+
+		if errors.Is(err, models.ErrAccountInactive) {
+			return "", fmt.Errorf("%s: %w", operator, newError(CodeAccessDenied, accountStatusDescription(err)))
+		}
+
+		return "", fmt.Errorf("%s: %w", operator, ErrInvalidCredentials)
+	}
+
+	code, err := o.issueCode(ctx, app, req, user)
+	if err != nil {
+		log.Error("Failed to save authorization code", sl.Err(err))
+
+		return "", fmt.Errorf("%s: %w", operator, err)
+	}
+
+	log.Info("Authorization code issued")
+
+	return code, nil
+}
+
+// AuthorizeUser Выдаёт код авторизации пользователю, которого уже проверил кто-то другой,
+// например внешний провайдер OpenID Connect
+func (o *OAuth) AuthorizeUser(ctx context.Context, req AuthorizeRequest, user models.User) (string, error) {
+	const operator = "oauth.AuthorizeUser"
+
+	log := o.log.With(
+		slog.String("operator", operator),
+		slog.Int("clientID", req.ClientID),
+		slog.Int64("userID", user.Id),
+	)
+
+	app, err := o.ValidateAuthorizeRequest(ctx, req)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", operator, err)
+	}
+
+	if err := user.CheckActive(time.Now()); err != nil {
+		log.Info("Authorization denied for inactive account")
+
+		return "", fmt.Errorf("%s: %w", operator, newError(CodeAccessDenied, accountStatusDescription(err)))
+	}
+
+	code, err := o.issueCode(ctx, app, req, user)
+	if err != nil {
+		log.Error("Failed to save authorization code", sl.Err(err))
+
+		return "", fmt.Errorf("%s: %w", operator, err)
+	}
+
+	log.Info("Authorization code issued")
+
+	return code, nil
+}
+
+// Создаёт и сохраняет код авторизации для проверенного запроса
+func (o *OAuth) issueCode(ctx context.Context, app models.App, req AuthorizeRequest, user models.User) (string, error) {
+	code, err := randomCode()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+
+	err = o.storage.SaveAuthCode(ctx, models.AuthCode{
+		CodeHash:      hashCode(code),
+		AppId:         app.Id,
+		UserId:        user.Id,
+		RedirectURI:   req.RedirectURI,
+		CodeChallenge: req.CodeChallenge,
+		Scope:         req.Scope,
+		Nonce:         req.Nonce,
+		AuthTime:      now,
+		ExpiresAt:     now.Add(o.codeTTL),
+		CreatedAt:     now,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return code, nil
+}
+
+// Exchange Меняет код авторизации на токен доступа
+func (o *OAuth) Exchange(ctx context.Context, req TokenRequest) (Token, error) {
+	const operator = "oauth.Exchange"
+
+	log := o.log.With(
+		slog.String("operator", operator),
+		slog.Int("clientID", req.ClientID),
+	)
+
+	if req.GrantType != GrantTypeAuthorization {
+		return Token{}, fmt.Errorf("%s: %w", operator, newError(CodeUnsupportedGrantType, "unsupported grant_type"))
+	}
+
+	if req.Code == "" || req.CodeVerifier == "" {
+		return Token{}, fmt.Errorf("%s: %w", operator, newError(CodeInvalidRequest, "code and code_verifier are required"))
+	}
+
+	if len(req.CodeVerifier) < minVerifierLen || len(req.CodeVerifier) > maxVerifierLen {
+		return Token{}, fmt.Errorf("%s: %w", operator, newError(CodeInvalidRequest, "code_verifier must be 43 to 128 characters long"))
+	}
+
+	app, err := o.storage.GetApp(ctx, req.ClientID)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return Token{}, fmt.Errorf("%s: %w", operator, newError(CodeInvalidClient, "unknown client"))
+		}
+
+		return Token{}, fmt.Errorf("%s: %w", operator, err)
+	}
+
+	// Публичные клиенты защищены PKCE, конфиденциальные дополнительно передают секрет
+	if req.ClientSecret != "" && subtle.ConstantTimeCompare([]byte(req.ClientSecret), []byte(app.Secret)) != 1 {
+		return Token{}, fmt.Errorf("%s: %w", operator, newError(CodeInvalidClient, "client authentication failed"))
+	}
+
+	code, err := o.storage.ConsumeAuthCode(ctx, hashCode(req.Code))
+	if err != nil {
+		if errors.Is(err, storage.ErrAuthCodeNotFound) {
+			return Token{}, fmt.Errorf("%s: %w", operator, newError(CodeInvalidGrant, "authorization code is invalid, expired or already used"))
+		}
+
+		return Token{}, fmt.Errorf("%s: %w", operator, err)
+	}
+
+	if code.AppId != app.Id || code.RedirectURI != req.RedirectURI {
+		return Token{}, fmt.Errorf("%s: %w", operator, newError(CodeInvalidGrant, "authorization code was issued for another client or redirect_uri"))
+	}
+
+	if subtle.ConstantTimeCompare([]byte(challengeS256(req.CodeVerifier)), []byte(code.CodeChallenge)) != 1 {
+		return Token{}, fmt.Errorf("%s: %w", operator, newError(CodeInvalidGrant, "code_verifier does not match code_challenge"))
+	}
+
+	// Пока код ждал обмена, администратор мог сузить scope приложения
+	if err := checkScope(app, code.Scope); err != nil {
+		return Token{}, fmt.Errorf("%s: %w", operator, err)
+	}
+
+	user, err := o.storage.UserByID(ctx, code.UserId)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return Token{}, fmt.Errorf("%s: %w", operator, newError(CodeInvalidGrant, "user no longer exists"))
+		}
+
+		return Token{}, fmt.Errorf("%s: %w", operator, err)
+	}
+
+	if err := user.CheckActive(time.Now()); err != nil {
+		return Token{}, fmt.Errorf("%s: %w", operator, newError(CodeInvalidGrant, accountStatusDescription(err)))
+	}
+
+	accessToken, err := jwt.NewScopedToken(user, app, o.tokenTTL, code.Scope)
+	if err != nil {
+		log.Error("Failed to create token", sl.Err(err))
+
+		return Token{}, fmt.Errorf("%s: %w", operator, err)
+	}
+
+	token := Token{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(o.tokenTTL.Seconds()),
+		Scope:       code.Scope,
+	}
+
+	if hasScope(code.Scope, ScopeOpenID) {
+		token.IDToken, err = jwt.NewIDToken(o.signingKey, keys.KeyID(&o.signingKey.PublicKey), jwt.IDTokenClaims{
+			Issuer:      o.issuer,
+			Subject:     subject(user.Id),
+			Audience:    strconv.Itoa(app.Id),
+			Nonce:       code.Nonce,
+			AuthTime:    code.AuthTime,
+			AccessToken: accessToken,
+		}, o.tokenTTL)
+		if err != nil {
+			log.Error("Failed to create ID token", sl.Err(err))
+
+			return Token{}, fmt.Errorf("%s: %w", operator, err)
+		}
+	}
+
+	log.Info("Authorization code exchanged", slog.Int64("userID", user.Id))
+
+	return token, nil
+}
+
+// UserInfo Возвращает claims пользователя, которому выдан токен доступа
+// Набор claims зависит от scope, выданных вместе с токеном
+func (o *OAuth) UserInfo(ctx context.Context, accessToken string) (map[string]any, error) {
+	const operator = "oauth.UserInfo"
+
+	claims, err := o.tokens.ValidateToken(ctx, accessToken)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operator, ErrInvalidToken)
+	}
+
+	// У сервисного аккаунта нет пользователя, о котором можно рассказать
+	if claims.IsServiceAccount() {
+		return nil, fmt.Errorf("%s: %w", operator, ErrInvalidToken)
+	}
+
+	if !hasScope(claims.Scope, ScopeOpenID) {
+		return nil, fmt.Errorf("%s: %w", operator, ErrInsufficientScope)
+	}
+
+	user, err := o.storage.UserByID(ctx, claims.UserID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return nil, fmt.Errorf("%s: %w", operator, ErrInvalidToken)
+		}
+
+		return nil, fmt.Errorf("%s: %w", operator, err)
+	}
+
+	info := map[string]any{
+		"sub": subject(user.Id),
+	}
+
+	if hasScope(claims.Scope, ScopeProfile) {
+		info["preferred_username"] = user.Username
+		info["name"] = user.Username
+	}
+
+	return info, nil
+}
+
+// Пояснение для клиента: сообщение ошибки статуса без префиксов операций
+func accountStatusDescription(err error) string {
+	for _, known := range []error{models.ErrAccountSuspended, models.ErrAccountDisabled, models.ErrAccountPending} {
+		if errors.Is(err, known) {
+			return known.Error()
+		}
+	}
+
+	return models.ErrAccountInactive.Error()
+}
+
+// Каждый запрошенный scope должен быть в списке приложения, а без списка - среди openid и profile
+func checkScope(app models.App, scope string) error {
+	if name, ok := app.DisallowedScope(scope); ok {
+		return newError(CodeInvalidScope, fmt.Sprintf("scope %q is not allowed for the client", name))
+	}
+
+	return nil
+}
+
+func hasScope(scope string, name string) bool {
+	return slices.Contains(strings.Fields(scope), name)
+}
+
+// sub в ID токене и /userinfo - id пользователя, он не меняется в отличие от имени
+func subject(userID int64) string {
+	return strconv.FormatInt(userID, 10)
+}
+
+// Код авторизации - 32 случайных байта, в бд хранится только его хэш
+func randomCode() (string, error) {
+	buf := make([]byte, 32)
+
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func hashCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+
+	return hex.EncodeToString(sum[:])
+}
+
+func challengeS256(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,163 @@
+// Package outbox Доставка доменных событий из таблицы outbox во внешние системы
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/lib/logger/sl"
+	"shilka-sso/internal/services/outbox/publisher"
+	"time"
+)
+
+// Publisher отправляет событие получателям
+// Если Publish вернул ошибку, событие будет отправлено повторно. Ошибка с publisher.ErrUnavailable
+// не тратит попытки события
+type Publisher interface {
+	Publish(ctx context.Context, event models.Event) error
+	Close() error
+}
+
+// Storage Методы бд, нужные диспетчеру
+type Storage interface {
+	PendingEvents(ctx context.Context, limit int) ([]models.Event, error)
+	MarkEventDelivered(ctx context.Context, eventID int64) error
+	MarkEventFailed(ctx context.Context, eventID int64, reason string, nextAttemptAt time.Time, dead bool) error
+}
+
+// Dispatcher Фоновая задача, которая публикует события из outbox
+type Dispatcher struct {
+	log            *slog.Logger
+	storage        Storage
+	publisher      Publisher
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	pollInterval   time.Duration
+	batchSize      int
+}
+
+// New возвращает новый диспетчер событий
+// Неудачная публикация повторяется с задержкой initialBackoff, которая удваивается с каждой попыткой
+// до maxBackoff. После maxAttempts неудачных попыток событие считается недоставляемым
+// и больше не задерживает следующие
+func New(
+	log *slog.Logger,
+	storage Storage,
+	publisher Publisher,
+	maxAttempts int,
+	initialBackoff time.Duration,
+	maxBackoff time.Duration,
+	pollInterval time.Duration,
+	batchSize int,
+) *Dispatcher {
+	return &Dispatcher{
+		log:            log,
+		storage:        storage,
+		publisher:      publisher,
+		maxAttempts:    maxAttempts,
+		initialBackoff: initialBackoff,
+		maxBackoff:     maxBackoff,
+		pollInterval:   pollInterval,
+		batchSize:      batchSize,
+	}
+}
+
+// Run Раз в pollInterval публикует накопившиеся события, пока не отменён ctx
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := d.Dispatch(ctx); err != nil {
+				d.log.Error("Failed to dispatch events", sl.Err(err))
+			}
+		}
+	}
+}
+
+// Dispatch Публикует недоставленные события по порядку и возвращает число доставленных
+// На первой ошибке публикации останавливается, чтобы не нарушить порядок событий, а до времени
+// повтора неудавшегося события не публикует и следующие. Если попытки события закончились,
+// оно отмечается недоставляемым, и публикация продолжается со следующего.
+// Событие отмечается доставленным только после успешной публикации, поэтому при падении
+// между публикацией и отметкой событие уйдёт ещё раз
+func (d *Dispatcher) Dispatch(ctx context.Context) (int, error) {
+	const operator = "outbox.Dispatch"
+
+	log := d.log.With(slog.String("operator", operator))
+
+	delivered := 0
+
+	for {
+		events, err := d.storage.PendingEvents(ctx, d.batchSize)
+		if err != nil {
+			return delivered, fmt.Errorf("%s: %w", operator, err)
+		}
+
+		for _, event := range events {
+			if event.NextAttemptAt.After(time.Now()) {
+				return delivered, nil
+			}
+
+			if err := d.publisher.Publish(ctx, event); err != nil {
+				if errors.Is(err, publisher.ErrUnavailable) {
+					log.Warn("publisher is unavailable", slog.Int64("event_id", event.Id), sl.Err(err))
+
+					return delivered, nil
+				}
+
+				attempts := event.Attempts + 1
+				dead := d.maxAttempts > 0 && attempts >= d.maxAttempts
+				nextAttemptAt := time.Now().Add(d.backoff(attempts))
+
+				log.Warn("failed to publish event",
+					slog.Int64("event_id", event.Id),
+					slog.String("type", event.Type),
+					slog.Int("attempts", attempts),
+					slog.Bool("dead", dead),
+					sl.Err(err),
+				)
+
+				if err := d.storage.MarkEventFailed(ctx, event.Id, err.Error(), nextAttemptAt, dead); err != nil {
+					return delivered, fmt.Errorf("%s: %w", operator, err)
+				}
+
+				if !dead {
+					return delivered, nil
+				}
+
+				log.Error("event moved to dead letters", slog.Int64("event_id", event.Id), slog.String("type", event.Type))
+
+				continue
+			}
+
+			if err := d.storage.MarkEventDelivered(ctx, event.Id); err != nil {
+				return delivered, fmt.Errorf("%s: %w", operator, err)
+			}
+
+			delivered++
+		}
+
+		if len(events) < d.batchSize {
+			return delivered, nil
+		}
+	}
+}
+
+// Задержка перед следующей попыткой после attempts неудачных
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := d.initialBackoff
+
+	for i := 1; i < attempts && delay < d.maxBackoff; i++ {
+		delay *= 2
+	}
+
+	return min(delay, d.maxBackoff)
+}
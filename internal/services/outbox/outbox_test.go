@@ -0,0 +1,268 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"log/slog"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/services/outbox/publisher"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Outbox в памяти. failMarks раз подряд не даёт отметить событие доставленным,
+// как будто сервис упал сразу после публикации
+type memoryStorage struct {
+	mu        sync.Mutex
+	events    []models.Event
+	delivered map[int64]bool
+	dead      map[int64]bool
+	failMarks int
+}
+
+func (m *memoryStorage) PendingEvents(_ context.Context, limit int) ([]models.Event, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var events []models.Event
+	for _, event := range m.events {
+		if !m.delivered[event.Id] && !m.dead[event.Id] && len(events) < limit {
+			events = append(events, event)
+		}
+	}
+
+	return events, nil
+}
+
+func (m *memoryStorage) MarkEventDelivered(_ context.Context, eventID int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.failMarks > 0 {
+		m.failMarks--
+
+		return errors.New("storage is down")
+	}
+
+	m.delivered[eventID] = true
+
+	return nil
+}
+
+func (m *memoryStorage) MarkEventFailed(_ context.Context, eventID int64, _ string, nextAttemptAt time.Time, dead bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.events {
+		if m.events[i].Id == eventID {
+			m.events[i].Attempts++
+			m.events[i].NextAttemptAt = nextAttemptAt
+		}
+	}
+
+	if dead {
+		m.dead[eventID] = true
+	}
+
+	return nil
+}
+
+// Брокер в памяти процесса, который отклоняет каждую failEvery-ю публикацию
+// и все публикации события poison. Пока down, брокер недоступен
+type broker struct {
+	mu        sync.Mutex
+	received  []int64
+	calls     int
+	failEvery int
+	poison    int64
+	down      bool
+}
+
+func (b *broker) Publish(_ context.Context, event models.Event) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.calls++
+	if b.down {
+		return fmt.Errorf("%w: connection refused", publisher.ErrUnavailable)
+	}
+
+	if b.failEvery > 0 && b.calls%b.failEvery == 0 {
+		return errors.New("broker is unavailable")
+	}
+
+	if event.Id == b.poison {
+		return errors.New("event is rejected")
+	}
+
+	b.received = append(b.received, event.Id)
+
+	return nil
+}
+
+func (b *broker) Close() error {
+	return nil
+}
+
+func newStorage(n int) *memoryStorage {
+	st := &memoryStorage{delivered: map[int64]bool{}, dead: map[int64]bool{}}
+	for i := 1; i <= n; i++ {
+		st.events = append(st.events, models.Event{Id: int64(i), Type: models.EventUserRegistered})
+	}
+
+	return st
+}
+
+func discardLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+// Каждое событие должно дойти до брокера, несмотря на сбои публикации, и в исходном порядке
+func TestDispatch_RetriesFailedPublishes(t *testing.T) {
+	st := newStorage(25)
+	b := &broker{failEvery: 3}
+
+	d := New(discardLogger(), st, b, 0, 0, 0, time.Millisecond, 10)
+
+	for i := 0; i < 50 && len(st.delivered) < 25; i++ {
+		_, err := d.Dispatch(context.Background())
+		require.NoError(t, err)
+	}
+
+	require.Len(t, st.delivered, 25)
+
+	expected := make([]int64, 0, 25)
+	for i := 1; i <= 25; i++ {
+		expected = append(expected, int64(i))
+	}
+	assert.Equal(t, expected, b.received)
+}
+
+// Событие, которое не публикуется никогда, после maxAttempts попыток перестаёт задерживать следующие
+func TestDispatch_DeadLetters(t *testing.T) {
+	st := newStorage(5)
+	b := &broker{poison: 2}
+
+	d := New(discardLogger(), st, b, 3, 0, 0, time.Millisecond, 10)
+
+	// Пока попытки не кончились, порядок важнее: события после 2 ждут
+	for _, expected := range []int{1, 0} {
+		delivered, err := d.Dispatch(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, expected, delivered)
+		assert.Equal(t, []int64{1}, b.received)
+	}
+
+	delivered, err := d.Dispatch(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 3, delivered)
+
+	assert.Equal(t, []int64{1, 3, 4, 5}, b.received)
+	assert.True(t, st.dead[2])
+	assert.False(t, st.delivered[2])
+
+	// Недоставляемое событие больше не публикуется
+	calls := b.calls
+
+	_, err = d.Dispatch(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, calls, b.calls)
+}
+
+// До времени повтора неудавшееся событие не публикуется, и следующие за ним ждут
+func TestDispatch_Backoff(t *testing.T) {
+	st := newStorage(3)
+	b := &broker{poison: 1}
+
+	d := New(discardLogger(), st, b, 3, time.Hour, 4*time.Hour, time.Millisecond, 10)
+
+	delivered, err := d.Dispatch(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, delivered)
+	assert.Equal(t, 1, b.calls)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), st.events[0].NextAttemptAt, time.Minute)
+
+	delivered, err = d.Dispatch(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, delivered)
+	assert.Equal(t, 1, b.calls)
+	assert.Empty(t, b.received)
+
+	assert.Equal(t, time.Hour, d.backoff(1))
+	assert.Equal(t, 2*time.Hour, d.backoff(2))
+	assert.Equal(t, 4*time.Hour, d.backoff(3))
+	assert.Equal(t, 4*time.Hour, d.backoff(10))
+}
+
+// Пока брокер недоступен, попытки событий не тратятся и ничего не становится недоставляемым
+func TestDispatch_PublisherUnavailable(t *testing.T) {
+	st := newStorage(3)
+	b := &broker{down: true}
+
+	d := New(discardLogger(), st, b, 1, time.Hour, time.Hour, time.Millisecond, 10)
+
+	for range 3 {
+		delivered, err := d.Dispatch(context.Background())
+		require.NoError(t, err)
+		assert.Zero(t, delivered)
+	}
+
+	assert.Empty(t, st.dead)
+	assert.Zero(t, st.events[0].Attempts)
+
+	b.down = false
+
+	delivered, err := d.Dispatch(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 3, delivered)
+	assert.Equal(t, []int64{1, 2, 3}, b.received)
+}
+
+// Если событие опубликовано, но не отмечено доставленным, оно уходит ещё раз
+func TestDispatch_RedeliversUnmarkedEvents(t *testing.T) {
+	st := newStorage(3)
+	st.failMarks = 1
+	b := &broker{}
+
+	d := New(discardLogger(), st, b, 0, 0, 0, time.Millisecond, 10)
+
+	_, err := d.Dispatch(context.Background())
+	require.Error(t, err)
+
+	delivered, err := d.Dispatch(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, 3, delivered)
+	assert.Equal(t, []int64{1, 1, 2, 3}, b.received)
+}
+
+// Run доставляет события в фоне и останавливается по отмене контекста
+func TestRun_DeliversInBackground(t *testing.T) {
+	st := newStorage(5)
+	b := &broker{}
+
+	d := New(discardLogger(), st, b, 0, 0, 0, time.Millisecond, 2)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		d.Run(ctx)
+		close(done)
+	}()
+
+	require.Eventually(t, func() bool {
+		st.mu.Lock()
+		defer st.mu.Unlock()
+
+		return len(st.delivered) == 5
+	}, time.Second, time.Millisecond)
+
+	cancel()
+	<-done
+}
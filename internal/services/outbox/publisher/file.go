@@ -0,0 +1,57 @@
+package publisher
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"shilka-sso/internal/domain/models"
+	"sync"
+)
+
+// File Дописывает события в файл в формате JSON lines
+type File struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFile открывает (или создаёт) файл, в который будут дописываться события
+func NewFile(path string) (*File, error) {
+	const operation = "publisher.NewFile"
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return &File{file: file}, nil
+}
+
+// Publish Дописывает событие и сбрасывает файл на диск, чтобы событие не потерялось после отметки о доставке
+func (f *File) Publish(_ context.Context, event models.Event) error {
+	const operation = "publisher.File.Publish"
+
+	data, err := Encode(event)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, err := f.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("%s: %w: %w", operation, ErrUnavailable, err)
+	}
+
+	if err := f.file.Sync(); err != nil {
+		return fmt.Errorf("%s: %w: %w", operation, ErrUnavailable, err)
+	}
+
+	return nil
+}
+
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.file.Close()
+}
@@ -0,0 +1,31 @@
+package publisher
+
+import (
+	"context"
+	"log/slog"
+	"shilka-sso/internal/domain/models"
+)
+
+// Log Пишет события в лог. Подходит для локальной разработки
+type Log struct {
+	log *slog.Logger
+}
+
+// NewLog возвращает publisher, который пишет события в лог
+func NewLog(log *slog.Logger) *Log {
+	return &Log{log: log}
+}
+
+func (l *Log) Publish(_ context.Context, event models.Event) error {
+	l.log.Info("domain event",
+		slog.Int64("id", event.Id),
+		slog.String("type", event.Type),
+		slog.String("payload", string(event.Payload)),
+	)
+
+	return nil
+}
+
+func (l *Log) Close() error {
+	return nil
+}
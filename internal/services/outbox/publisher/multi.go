@@ -0,0 +1,47 @@
+package publisher
+
+import (
+	"context"
+	"errors"
+	"shilka-sso/internal/domain/models"
+)
+
+// Publisher то же, что outbox.Publisher. Объявлен здесь, чтобы не импортировать outbox
+type Publisher interface {
+	Publish(ctx context.Context, event models.Event) error
+	Close() error
+}
+
+// Multi Отправляет событие во все publisher по очереди
+// Если хоть один вернул ошибку, событие будет отправлено повторно во все,
+// поэтому каждый из них должен выдерживать повторы
+type Multi struct {
+	publishers []Publisher
+}
+
+// NewMulti возвращает publisher, который отправляет события во все publishers
+func NewMulti(publishers ...Publisher) *Multi {
+	return &Multi{publishers: publishers}
+}
+
+func (m *Multi) Publish(ctx context.Context, event models.Event) error {
+	for _, p := range m.publishers {
+		if err := p.Publish(ctx, event); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *Multi) Close() error {
+	var errs []error
+
+	for _, p := range m.publishers {
+		if err := p.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
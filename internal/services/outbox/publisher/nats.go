@@ -0,0 +1,58 @@
+package publisher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/nats-io/nats.go"
+	"shilka-sso/internal/domain/models"
+)
+
+// NATS Публикует события в NATS в тему <subjectPrefix><тип события>
+type NATS struct {
+	conn          *nats.Conn
+	subjectPrefix string
+}
+
+// NewNATS подключается к серверу NATS по url
+func NewNATS(url string, subjectPrefix string) (*NATS, error) {
+	const operation = "publisher.NewNATS"
+
+	conn, err := nats.Connect(url, nats.Name("shilka-sso"))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return &NATS{conn: conn, subjectPrefix: subjectPrefix}, nil
+}
+
+// Publish Отправляет событие и дожидается, пока сервер его примет
+func (n *NATS) Publish(ctx context.Context, event models.Event) error {
+	const operation = "publisher.NATS.Publish"
+
+	data, err := Encode(event)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	// Сервер отклоняет только слишком большие сообщения, остальные ошибки - про соединение
+	if err := n.conn.Publish(n.subjectPrefix+event.Type, data); err != nil {
+		if errors.Is(err, nats.ErrMaxPayload) {
+			return fmt.Errorf("%s: %w", operation, err)
+		}
+
+		return fmt.Errorf("%s: %w: %w", operation, ErrUnavailable, err)
+	}
+
+	if err := n.conn.FlushWithContext(ctx); err != nil {
+		return fmt.Errorf("%s: %w: %w", operation, ErrUnavailable, err)
+	}
+
+	return nil
+}
+
+func (n *NATS) Close() error {
+	n.conn.Close()
+
+	return nil
+}
@@ -0,0 +1,143 @@
+package publisher
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net"
+	"shilka-sso/internal/domain/models"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type publishedMessage struct {
+	subject string
+	data    []byte
+}
+
+// Минимальный брокер NATS внутри процесса: понимает CONNECT, PING и PUB,
+// этого достаточно, чтобы проверить publisher без внешнего сервера
+type testBroker struct {
+	listener net.Listener
+
+	mu       sync.Mutex
+	messages []publishedMessage
+}
+
+func startTestBroker(t *testing.T) *testBroker {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	b := &testBroker{listener: listener}
+
+	go b.serve()
+
+	t.Cleanup(func() {
+		_ = listener.Close()
+	})
+
+	return b
+}
+
+func (b *testBroker) url() string {
+	return "nats://" + b.listener.Addr().String()
+}
+
+func (b *testBroker) published() []publishedMessage {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return append([]publishedMessage(nil), b.messages...)
+}
+
+func (b *testBroker) serve() {
+	for {
+		conn, err := b.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		go b.handle(conn)
+	}
+}
+
+func (b *testBroker) handle(conn net.Conn) {
+	defer conn.Close()
+
+	addr := b.listener.Addr().(*net.TCPAddr)
+	fmt.Fprintf(conn, "INFO {\"server_id\":\"test\",\"version\":\"2.10.0\",\"host\":\"127.0.0.1\",\"port\":%d,\"max_payload\":1048576,\"proto\":1}\r\n", addr.Port)
+
+	reader := bufio.NewReader(conn)
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch strings.ToUpper(fields[0]) {
+		case "PING":
+			fmt.Fprint(conn, "PONG\r\n")
+		case "PUB":
+			size, err := strconv.Atoi(fields[len(fields)-1])
+			if err != nil {
+				return
+			}
+
+			data := make([]byte, size+2)
+			if _, err := io.ReadFull(reader, data); err != nil {
+				return
+			}
+
+			b.mu.Lock()
+			b.messages = append(b.messages, publishedMessage{subject: fields[1], data: data[:size]})
+			b.mu.Unlock()
+		}
+	}
+}
+
+func TestNATS_Publish(t *testing.T) {
+	broker := startTestBroker(t)
+
+	p, err := NewNATS(broker.url(), "sso.")
+	require.NoError(t, err)
+	defer p.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	event := models.Event{
+		Id:        7,
+		Type:      models.EventUserRegistered,
+		Payload:   []byte(`{"user_id":42,"username":"shilka"}`),
+		CreatedAt: time.Now(),
+	}
+
+	require.NoError(t, p.Publish(ctx, event))
+
+	// Publish дожидается PONG на flush, поэтому сообщение уже у брокера
+	messages := broker.published()
+	require.Len(t, messages, 1)
+	assert.Equal(t, "sso.user.registered", messages[0].subject)
+
+	var message Message
+	require.NoError(t, json.Unmarshal(messages[0].data, &message))
+
+	assert.Equal(t, event.Id, message.Id)
+	assert.Equal(t, event.Type, message.Type)
+	assert.JSONEq(t, string(event.Payload), string(message.Payload))
+}
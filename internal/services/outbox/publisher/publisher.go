@@ -0,0 +1,31 @@
+// Package publisher Реализации outbox.Publisher
+package publisher
+
+import (
+	"encoding/json"
+	"errors"
+	"shilka-sso/internal/domain/models"
+	"time"
+)
+
+// ErrUnavailable Получатель временно недоступен, само событие не виновато
+// Такие ошибки не тратят попытки события: пока получатель не поднимется, его всё равно никто не примет
+var ErrUnavailable = errors.New("publisher is unavailable")
+
+// Message вид, в котором событие уходит получателям
+type Message struct {
+	Id        int64           `json:"id"`
+	Type      string          `json:"type"`
+	Payload   json.RawMessage `json:"payload"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// Encode Кодирует событие в JSON в том виде, в котором его получают подписчики
+func Encode(event models.Event) ([]byte, error) {
+	return json.Marshal(Message{
+		Id:        event.Id,
+		Type:      event.Type,
+		Payload:   event.Payload,
+		CreatedAt: event.CreatedAt,
+	})
+}
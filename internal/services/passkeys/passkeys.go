@@ -0,0 +1,718 @@
+// Package passkeys Регистрация ключей WebAuthn и вход по ним
+// Ключ подходит и для входа без пароля, и как второй фактор после пароля.
+// Домен и адреса страниц задаются отдельно для каждого приложения
+package passkeys
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"log/slog"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/lib/jwt"
+	"shilka-sso/internal/lib/logger/sl"
+	"shilka-sso/internal/services/auth"
+	"shilka-sso/internal/storage"
+	"strings"
+	"time"
+)
+
+const maxNameLength = 100
+
+type Passkeys struct {
+	log           *slog.Logger
+	storage       Storage
+	auditor       Auditor
+	authenticator PasswordAuthenticator
+	sessionTTL    time.Duration
+	tokenTTL      time.Duration
+}
+
+// Storage Методы бд, нужные сервису
+type Storage interface {
+	UserByIdentifier(ctx context.Context, login string) (models.User, error)
+	UserByID(ctx context.Context, userID int64) (models.User, error)
+	GetApp(ctx context.Context, appID int) (models.App, error)
+	RelyingParty(ctx context.Context, appID int) (models.RelyingParty, error)
+	SavePasskey(ctx context.Context, passkey models.Passkey) (int64, error)
+	Passkeys(ctx context.Context, userID int64) ([]models.Passkey, error)
+	PasskeyByCredentialID(ctx context.Context, credentialID []byte) (models.Passkey, error)
+	UpdatePasskeyUsage(ctx context.Context, passkeyID int64, signCount uint32, usedAt time.Time) error
+	DeletePasskey(ctx context.Context, userID int64, passkeyID int64) error
+	SavePasskeySession(ctx context.Context, session models.PasskeySession) error
+	ConsumePasskeySession(ctx context.Context, sessionID string) (models.PasskeySession, error)
+}
+
+// Auditor Журнал аудита, в который пишутся события сервиса
+type Auditor interface {
+	Record(ctx context.Context, event string, userID int64, appID int, payload map[string]any) error
+}
+
+// PasswordAuthenticator проверяет пароль, когда ключ используется как второй фактор
+type PasswordAuthenticator interface {
+	Authenticate(ctx context.Context, username string, password string, appID int) (models.User, error)
+}
+
+// Ошибки сервисного слоя
+var (
+	ErrAppNotFound          = errors.New("app not found")
+	ErrPasskeysDisabled     = errors.New("passkeys are not configured for app")
+	ErrInvalidName          = errors.New("invalid passkey name")
+	ErrInvalidSession       = errors.New("invalid or expired passkey session")
+	ErrInvalidCredential    = errors.New("invalid passkey credential")
+	ErrPasskeyExists        = errors.New("passkey already registered")
+	ErrPasskeyNotFound      = errors.New("passkey not found")
+	ErrNoPasskeys           = errors.New("user has no passkeys")
+	ErrInvalidCredentials   = errors.New("invalid credentials")
+	ErrAuthenticationFailed = errors.New("passkey authentication failed")
+)
+
+// New возвращает новый объект сервиса ключей WebAuthn
+// sessionTTL - сколько живёт начатая церемония, tokenTTL - срок выданного после входа токена
+func New(
+	log *slog.Logger,
+	storage Storage,
+	auditor Auditor,
+	authenticator PasswordAuthenticator,
+	sessionTTL time.Duration,
+	tokenTTL time.Duration,
+) *Passkeys {
+	return &Passkeys{
+		log:           log,
+		storage:       storage,
+		auditor:       auditor,
+		authenticator: authenticator,
+		sessionTTL:    sessionTTL,
+		tokenTTL:      tokenTTL,
+	}
+}
+
+// BeginRegistration Начинает регистрацию ключа пользователя для домена приложения
+// Возвращает id церемонии и опции для navigator.credentials.create в JSON
+// Если password не пустой, сначала проверяется пароль пользователя
+func (p *Passkeys) BeginRegistration(ctx context.Context, userID int64, appID int, password string) (string, []byte, error) {
+	const operator = "passkeys.BeginRegistration"
+
+	log := p.log.With(
+		slog.String("operator", operator),
+		slog.Int64("userID", userID),
+		slog.Int("appID", appID),
+	)
+
+	rp, wa, err := p.relyingParty(ctx, appID)
+	if err != nil {
+		return "", nil, fmt.Errorf("%s: %w", operator, err)
+	}
+
+	if password != "" {
+		if err := p.checkPassword(ctx, userID, password, appID); err != nil {
+			log.Info("Password check before passkey registration failed")
+
+			return "", nil, fmt.Errorf("%s: %w", operator, err)
+		}
+	}
+
+	user, err := p.user(ctx, userID, rp.RPID)
+	if err != nil {
+		return "", nil, fmt.Errorf("%s: %w", operator, err)
+	}
+
+	// Уже зарегистрированные ключи аутентификатор не должен создавать повторно
+	exclusions := make([]protocol.CredentialDescriptor, 0, len(user.credentials))
+	for _, credential := range user.credentials {
+		exclusions = append(exclusions, credential.Descriptor())
+	}
+
+	creation, data, err := wa.BeginRegistration(
+		user,
+		webauthn.WithExclusions(exclusions),
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementPreferred),
+	)
+	if err != nil {
+		return "", nil, fmt.Errorf("%s: %w", operator, err)
+	}
+
+	sessionID, err := p.saveSession(ctx, models.PasskeyRegistration, userID, appID, false, data)
+	if err != nil {
+		log.Error("Failed to save passkey session", sl.Err(err))
+
+		return "", nil, fmt.Errorf("%s: %w", operator, err)
+	}
+
+	options, err := json.Marshal(creation)
+	if err != nil {
+		return "", nil, fmt.Errorf("%s: %w", operator, err)
+	}
+
+	log.Info("Passkey registration started")
+
+	return sessionID, options, nil
+}
+
+// FinishRegistration Проверяет ответ аутентификатора и сохраняет ключ под именем name
+func (p *Passkeys) FinishRegistration(
+	ctx context.Context,
+	userID int64,
+	sessionID string,
+	name string,
+	response []byte,
+) (models.Passkey, error) {
+	const operator = "passkeys.FinishRegistration"
+
+	log := p.log.With(
+		slog.String("operator", operator),
+		slog.Int64("userID", userID),
+	)
+
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > maxNameLength {
+		return models.Passkey{}, fmt.Errorf("%s: %w", operator, ErrInvalidName)
+	}
+
+	session, data, err := p.consumeSession(ctx, sessionID, models.PasskeyRegistration)
+	if err != nil {
+		return models.Passkey{}, fmt.Errorf("%s: %w", operator, err)
+	}
+
+	if session.UserId != userID {
+		return models.Passkey{}, fmt.Errorf("%s: %w", operator, ErrInvalidSession)
+	}
+
+	rp, wa, err := p.relyingParty(ctx, session.AppId)
+	if err != nil {
+		return models.Passkey{}, fmt.Errorf("%s: %w", operator, err)
+	}
+
+	user, err := p.user(ctx, userID, rp.RPID)
+	if err != nil {
+		return models.Passkey{}, fmt.Errorf("%s: %w", operator, err)
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBody(bytes.NewReader(response))
+	if err != nil {
+		log.Info("Failed to parse passkey registration", sl.Err(err))
+
+		return models.Passkey{}, fmt.Errorf("%s: %w", operator, ErrInvalidCredential)
+	}
+
+	credential, err := wa.CreateCredential(user, data, parsed)
+	if err != nil {
+		log.Info("Passkey registration rejected", sl.Err(err))
+
+		return models.Passkey{}, fmt.Errorf("%s: %w", operator, ErrInvalidCredential)
+	}
+
+	transports := make([]string, 0, len(credential.Transport))
+	for _, transport := range credential.Transport {
+		transports = append(transports, string(transport))
+	}
+
+	passkey := models.Passkey{
+		UserId:          userID,
+		RPID:            rp.RPID,
+		CredentialId:    credential.ID,
+		PublicKey:       credential.PublicKey,
+		AttestationType: credential.AttestationType,
+		AAGUID:          credential.Authenticator.AAGUID,
+		SignCount:       credential.Authenticator.SignCount,
+		Transports:      transports,
+		BackupEligible:  credential.Flags.BackupEligible,
+		Name:            name,
+		CreatedAt:       time.Now(),
+	}
+
+	passkey.Id, err = p.storage.SavePasskey(ctx, passkey)
+	if err != nil {
+		if errors.Is(err, storage.ErrPasskeyExists) {
+			return models.Passkey{}, fmt.Errorf("%s: %w", operator, ErrPasskeyExists)
+		}
+
+		log.Error("Failed to save passkey", sl.Err(err))
+
+		return models.Passkey{}, fmt.Errorf("%s: %w", operator, err)
+	}
+
+	p.audit(ctx, models.AuditPasskeyRegistered, userID, session.AppId, map[string]any{
+		"passkey_id": passkey.Id,
+		"name":       name,
+		"rp_id":      rp.RPID,
+	})
+
+	log.Info("Passkey registered", slog.Int64("passkeyID", passkey.Id))
+
+	return passkey, nil
+}
+
+// BeginLogin Начинает вход по ключу и возвращает id церемонии и опции для navigator.credentials.get в JSON
+// Без имени пользователя ключ сам определяет, кто входит. С паролем ключ становится вторым фактором.
+// Если у пользователя без пароля нет ключей или его нет вообще, вход идёт как без имени,
+// чтобы по ответу нельзя было узнать, зарегистрирован ли пользователь. Вместо имени подходит подтверждённая почта или телефон
+func (p *Passkeys) BeginLogin(ctx context.Context, username string, password string, appID int) (string, []byte, error) {
+	const operator = "passkeys.BeginLogin"
+
+	log := p.log.With(
+		slog.String("operator", operator),
+		slog.String("username", username),
+		slog.Int("appID", appID),
+	)
+
+	rp, wa, err := p.relyingParty(ctx, appID)
+	if err != nil {
+		return "", nil, fmt.Errorf("%s: %w", operator, err)
+	}
+
+	var user *webauthnUser
+	passwordVerified := false
+
+	switch {
+	case password != "":
+		verified, err := p.authenticator.Authenticate(ctx, username, password, appID)
+		if err != nil {
+			if errors.Is(err, auth.ErrInvalidCredentials) {
+				return "", nil, fmt.Errorf("%s: %w", operator, ErrInvalidCredentials)
+			}
+
+			return "", nil, fmt.Errorf("%s: %w", operator, err)
+		}
+
+		user, err = p.user(ctx, verified.Id, rp.RPID)
+		if err != nil {
+			return "", nil, fmt.Errorf("%s: %w", operator, err)
+		}
+
+		if len(user.credentials) == 0 {
+			return "", nil, fmt.Errorf("%s: %w", operator, ErrNoPasskeys)
+		}
+
+		passwordVerified = true
+	case username != "":
+		found, err := p.storage.UserByIdentifier(ctx, username)
+		if err != nil && !errors.Is(err, storage.ErrUserNotFound) {
+			return "", nil, fmt.Errorf("%s: %w", operator, err)
+		}
+
+		if err == nil {
+			user, err = p.user(ctx, found.Id, rp.RPID)
+			if err != nil {
+				return "", nil, fmt.Errorf("%s: %w", operator, err)
+			}
+
+			if len(user.credentials) == 0 {
+				user = nil
+			}
+		}
+	}
+
+	var assertion *protocol.CredentialAssertion
+	var data *webauthn.SessionData
+
+	if user != nil {
+		// Второму фактору проверка пользователя на ключе не обязательна, первому - обязательна
+		verification := protocol.VerificationRequired
+		if passwordVerified {
+			verification = protocol.VerificationPreferred
+		}
+
+		assertion, data, err = wa.BeginLogin(user, webauthn.WithUserVerification(verification))
+	} else {
+		assertion, data, err = wa.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationRequired))
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("%s: %w", operator, err)
+	}
+
+	var userID int64
+	if user != nil {
+		userID = user.user.Id
+	}
+
+	sessionID, err := p.saveSession(ctx, models.PasskeyLogin, userID, appID, passwordVerified, data)
+	if err != nil {
+		log.Error("Failed to save passkey session", sl.Err(err))
+
+		return "", nil, fmt.Errorf("%s: %w", operator, err)
+	}
+
+	options, err := json.Marshal(assertion)
+	if err != nil {
+		return "", nil, fmt.Errorf("%s: %w", operator, err)
+	}
+
+	log.Info("Passkey login started", slog.Bool("secondFactor", passwordVerified))
+
+	return sessionID, options, nil
+}
+
+// FinishLogin Проверяет подпись ключа и выдаёт токен приложения
+// В claim amr токена записывается, был ли ключ единственным фактором или вторым после пароля
+func (p *Passkeys) FinishLogin(ctx context.Context, sessionID string, appID int, response []byte) (string, error) {
+	const operator = "passkeys.FinishLogin"
+
+	log := p.log.With(
+		slog.String("operator", operator),
+		slog.Int("appID", appID),
+	)
+
+	session, data, err := p.consumeSession(ctx, sessionID, models.PasskeyLogin)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", operator, err)
+	}
+
+	if session.AppId != appID {
+		return "", fmt.Errorf("%s: %w", operator, ErrInvalidSession)
+	}
+
+	rp, wa, err := p.relyingParty(ctx, appID)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", operator, err)
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBody(bytes.NewReader(response))
+	if err != nil {
+		log.Info("Failed to parse passkey assertion", sl.Err(err))
+
+		return "", fmt.Errorf("%s: %w", operator, ErrAuthenticationFailed)
+	}
+
+	passkey, err := p.storage.PasskeyByCredentialID(ctx, parsed.RawID)
+	if err != nil {
+		if errors.Is(err, storage.ErrPasskeyNotFound) {
+			log.Info("Unknown passkey")
+
+			return "", p.failLogin(ctx, operator, session.UserId, appID)
+		}
+
+		return "", fmt.Errorf("%s: %w", operator, err)
+	}
+
+	if passkey.RPID != rp.RPID || (session.UserId != 0 && passkey.UserId != session.UserId) {
+		log.Info("Passkey does not match login session", slog.Int64("passkeyID", passkey.Id))
+
+		return "", p.failLogin(ctx, operator, passkey.UserId, appID)
+	}
+
+	user, err := p.user(ctx, passkey.UserId, rp.RPID)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", operator, err)
+	}
+
+	var credential *webauthn.Credential
+	if session.UserId == 0 {
+		credential, err = wa.ValidateDiscoverableLogin(func(_, userHandle []byte) (webauthn.User, error) {
+			if !bytes.Equal(userHandle, user.WebAuthnID()) {
+				return nil, ErrAuthenticationFailed
+			}
+
+			return user, nil
+		}, data, parsed)
+	} else {
+		credential, err = wa.ValidateLogin(user, data, parsed)
+	}
+	if err != nil {
+		log.Info("Passkey assertion rejected", slog.Int64("passkeyID", passkey.Id), sl.Err(err))
+
+		return "", p.failLogin(ctx, operator, passkey.UserId, appID)
+	}
+
+	// Счётчик не вырос - подписал другой экземпляр того же ключа
+	if credential.Authenticator.CloneWarning {
+		log.Warn("Passkey sign counter went backwards, possible cloned authenticator", slog.Int64("passkeyID", passkey.Id))
+
+		return "", p.failLogin(ctx, operator, passkey.UserId, appID)
+	}
+
+	if err := p.storage.UpdatePasskeyUsage(ctx, passkey.Id, credential.Authenticator.SignCount, time.Now()); err != nil {
+		log.Error("Failed to update passkey usage", sl.Err(err))
+
+		return "", fmt.Errorf("%s: %w", operator, err)
+	}
+
+	// Статус проверяется после подписи, чтобы без ключа по ответу нельзя было узнать о блокировке
+	if err := user.user.CheckActive(time.Now()); err != nil {
+		log.Info("Passkey login refused for inactive account", slog.Int64("userID", user.user.Id))
+
+		p.audit(ctx, models.AuditLoginFailed, user.user.Id, appID, map[string]any{
+			"method": "passkey",
+			"status": user.user.Status,
+		})
+
+		return "", fmt.Errorf("%s: %w", operator, err)
+	}
+
+	app, err := p.storage.GetApp(ctx, appID)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", operator, err)
+	}
+
+	amr := []string{jwt.AMRHardwareKey}
+	if session.PasswordVerified {
+		amr = []string{jwt.AMRPassword, jwt.AMRHardwareKey, jwt.AMRMultiFactor}
+	}
+
+	token, err := jwt.NewTokenWithAMR(user.user, app, p.tokenTTL, amr)
+	if err != nil {
+		log.Error("Failed to create token", sl.Err(err))
+
+		return "", fmt.Errorf("%s: %w", operator, err)
+	}
+
+	p.audit(ctx, models.AuditLoginSucceeded, user.user.Id, appID, map[string]any{
+		"username":   user.user.Username,
+		"method":     "passkey",
+		"passkey_id": passkey.Id,
+		"amr":        amr,
+	})
+
+	log.Info("Passkey login completed", slog.Int64("userID", user.user.Id))
+
+	return token, nil
+}
+
+// Passkeys Возвращает ключи пользователя
+func (p *Passkeys) Passkeys(ctx context.Context, userID int64) ([]models.Passkey, error) {
+	const operator = "passkeys.Passkeys"
+
+	passkeys, err := p.storage.Passkeys(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operator, err)
+	}
+
+	return passkeys, nil
+}
+
+// Delete Удаляет ключ пользователя, войти им после этого нельзя
+func (p *Passkeys) Delete(ctx context.Context, userID int64, passkeyID int64) error {
+	const operator = "passkeys.Delete"
+
+	p.log.Info("Deleting passkey", slog.String("operator", operator), slog.Int64("passkeyID", passkeyID))
+
+	if err := p.storage.DeletePasskey(ctx, userID, passkeyID); err != nil {
+		if errors.Is(err, storage.ErrPasskeyNotFound) {
+			return fmt.Errorf("%s: %w", operator, ErrPasskeyNotFound)
+		}
+
+		return fmt.Errorf("%s: %w", operator, err)
+	}
+
+	p.audit(ctx, models.AuditPasskeyDeleted, userID, 0, map[string]any{"passkey_id": passkeyID})
+
+	return nil
+}
+
+// Проверяет, что password - текущий пароль пользователя userID
+func (p *Passkeys) checkPassword(ctx context.Context, userID int64, password string, appID int) error {
+	user, err := p.storage.UserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	verified, err := p.authenticator.Authenticate(ctx, user.Username, password, appID)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidCredentials) {
+			return ErrInvalidCredentials
+		}
+
+		return err
+	}
+
+	if verified.Id != userID {
+		return ErrInvalidCredentials
+	}
+
+	return nil
+}
+
+// Настройки WebAuthn приложения и проверяющий по ним объект библиотеки
+func (p *Passkeys) relyingParty(ctx context.Context, appID int) (models.RelyingParty, *webauthn.WebAuthn, error) {
+	rp, err := p.storage.RelyingParty(ctx, appID)
+	if err != nil {
+		if errors.Is(err, storage.ErrRelyingPartyNotFound) {
+			if _, err := p.storage.GetApp(ctx, appID); errors.Is(err, storage.ErrAppNotFound) {
+				return models.RelyingParty{}, nil, ErrAppNotFound
+			}
+
+			return models.RelyingParty{}, nil, ErrPasskeysDisabled
+		}
+
+		return models.RelyingParty{}, nil, err
+	}
+
+	wa, err := webauthn.New(&webauthn.Config{
+		RPID:          rp.RPID,
+		RPDisplayName: rp.Name,
+		RPOrigins:     rp.Origins,
+		Timeouts: webauthn.TimeoutsConfig{
+			Login:        webauthn.TimeoutConfig{Enforce: true, Timeout: p.sessionTTL, TimeoutUVD: p.sessionTTL},
+			Registration: webauthn.TimeoutConfig{Enforce: true, Timeout: p.sessionTTL, TimeoutUVD: p.sessionTTL},
+		},
+	})
+	if err != nil {
+		return models.RelyingParty{}, nil, err
+	}
+
+	return rp, wa, nil
+}
+
+// Пользователь вместе с его ключами для домена rpID
+func (p *Passkeys) user(ctx context.Context, userID int64, rpID string) (*webauthnUser, error) {
+	user, err := p.storage.UserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return nil, ErrAuthenticationFailed
+		}
+
+		return nil, err
+	}
+
+	passkeys, err := p.storage.Passkeys(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &webauthnUser{user: user}
+	for _, passkey := range passkeys {
+		if passkey.RPID == rpID {
+			result.credentials = append(result.credentials, toCredential(passkey))
+		}
+	}
+
+	return result, nil
+}
+
+func (p *Passkeys) saveSession(
+	ctx context.Context,
+	ceremony string,
+	userID int64,
+	appID int,
+	passwordVerified bool,
+	data *webauthn.SessionData,
+) (string, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return "", err
+	}
+
+	sessionID, err := randomString(16)
+	if err != nil {
+		return "", err
+	}
+
+	err = p.storage.SavePasskeySession(ctx, models.PasskeySession{
+		Id:               sessionID,
+		Ceremony:         ceremony,
+		UserId:           userID,
+		AppId:            appID,
+		PasswordVerified: passwordVerified,
+		Data:             raw,
+		ExpiresAt:        time.Now().Add(p.sessionTTL),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return sessionID, nil
+}
+
+// Церемонию можно завершить только один раз и только той же операцией, которой она начата
+func (p *Passkeys) consumeSession(
+	ctx context.Context,
+	sessionID string,
+	ceremony string,
+) (models.PasskeySession, webauthn.SessionData, error) {
+	session, err := p.storage.ConsumePasskeySession(ctx, sessionID)
+	if err != nil {
+		if errors.Is(err, storage.ErrPasskeySessionNotFound) {
+			return models.PasskeySession{}, webauthn.SessionData{}, ErrInvalidSession
+		}
+
+		return models.PasskeySession{}, webauthn.SessionData{}, err
+	}
+
+	if session.Ceremony != ceremony {
+		return models.PasskeySession{}, webauthn.SessionData{}, ErrInvalidSession
+	}
+
+	var data webauthn.SessionData
+	if err := json.Unmarshal(session.Data, &data); err != nil {
+		return models.PasskeySession{}, webauthn.SessionData{}, err
+	}
+
+	return session, data, nil
+}
+
+// Пишет неудачный вход в журнал аудита и возвращает ошибку для клиента
+func (p *Passkeys) failLogin(ctx context.Context, operator string, userID int64, appID int) error {
+	p.audit(ctx, models.AuditLoginFailed, userID, appID, map[string]any{"method": "passkey"})
+
+	return fmt.Errorf("%s: %w", operator, ErrAuthenticationFailed)
+}
+
+// Пишет событие в журнал аудита. Ошибка аудита не должна ломать сам запрос, поэтому только логируется
+func (p *Passkeys) audit(ctx context.Context, event string, userID int64, appID int, payload map[string]any) {
+	if err := p.auditor.Record(ctx, event, userID, appID, payload); err != nil {
+		p.log.Error("Failed to write audit record", slog.String("event", event), sl.Err(err))
+	}
+}
+
+// webauthnUser пользователь в том виде, в котором его ждёт библиотека WebAuthn
+type webauthnUser struct {
+	user        models.User
+	credentials []webauthn.Credential
+}
+
+// WebAuthnID user handle - id пользователя, чтобы ключ не хранил его имя
+func (u *webauthnUser) WebAuthnID() []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(u.user.Id))
+}
+
+func (u *webauthnUser) WebAuthnName() string {
+	return u.user.Username
+}
+
+func (u *webauthnUser) WebAuthnDisplayName() string {
+	return u.user.Username
+}
+
+func (u *webauthnUser) WebAuthnCredentials() []webauthn.Credential {
+	return u.credentials
+}
+
+func (u *webauthnUser) WebAuthnIcon() string {
+	return ""
+}
+
+func toCredential(passkey models.Passkey) webauthn.Credential {
+	transports := make([]protocol.AuthenticatorTransport, 0, len(passkey.Transports))
+	for _, transport := range passkey.Transports {
+		transports = append(transports, protocol.AuthenticatorTransport(transport))
+	}
+
+	return webauthn.Credential{
+		ID:              passkey.CredentialId,
+		PublicKey:       passkey.PublicKey,
+		AttestationType: passkey.AttestationType,
+		Transport:       transports,
+		Flags:           webauthn.CredentialFlags{BackupEligible: passkey.BackupEligible},
+		Authenticator: webauthn.Authenticator{
+			AAGUID:    passkey.AAGUID,
+			SignCount: passkey.SignCount,
+		},
+	}
+}
+
+func randomString(size int) (string, error) {
+	buf := make([]byte, size)
+
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
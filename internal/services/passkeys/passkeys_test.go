@@ -0,0 +1,303 @@
+package passkeys
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"io"
+	"log/slog"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/lib/jwt"
+	"shilka-sso/internal/lib/usernames"
+	"shilka-sso/internal/services/auth"
+	"shilka-sso/internal/services/passkeys/virtualauthn"
+	"shilka-sso/internal/storage/sqlite"
+	"shilka-sso/internal/storage/sqlite/sqlitetest"
+	"testing"
+	"time"
+)
+
+const (
+	appID     = 1
+	otherApp  = 2
+	appSecret = "secret"
+	origin    = "https://app.example.com"
+)
+
+type nopAuditor struct{}
+
+func (nopAuditor) Record(context.Context, string, int64, int, map[string]any) error {
+	return nil
+}
+
+func newTestService(t *testing.T) (*Passkeys, *sqlite.Storage, int64) {
+	t.Helper()
+
+	ctx := context.Background()
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	storage, path := sqlitetest.New(t)
+	sqlitetest.SaveApp(t, path, models.App{Id: appID, Name: "shilka", Secret: appSecret})
+	sqlitetest.SaveApp(t, path, models.App{Id: otherApp, Name: "other", Secret: "other"})
+
+	for _, id := range []int{appID, otherApp} {
+		require.NoError(t, storage.SetRelyingParty(ctx, models.RelyingParty{
+			AppId:   id,
+			RPID:    "example.com",
+			Name:    "Shilka",
+			Origins: []string{origin},
+		}))
+	}
+
+	passHash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	userID, err := storage.SaveUser(ctx, "ivan", passHash)
+	require.NoError(t, err)
+
+	service := New(
+		log,
+		storage,
+		nopAuditor{},
+		auth.New(log, storage, nopAuditor{}, time.Hour, usernames.NewPolicy(3, 32, nil), nil),
+		time.Minute,
+		time.Hour,
+	)
+
+	return service, storage, userID
+}
+
+func register(t *testing.T, service *Passkeys, authenticator *virtualauthn.Authenticator, userID int64) models.Passkey {
+	t.Helper()
+
+	ctx := context.Background()
+
+	sessionID, options, err := service.BeginRegistration(ctx, userID, appID, "")
+	require.NoError(t, err)
+
+	response, err := authenticator.Create(options)
+	require.NoError(t, err)
+
+	passkey, err := service.FinishRegistration(ctx, userID, sessionID, "laptop", response)
+	require.NoError(t, err)
+
+	return passkey
+}
+
+func login(service *Passkeys, authenticator *virtualauthn.Authenticator, username string, password string) (string, error) {
+	ctx := context.Background()
+
+	sessionID, options, err := service.BeginLogin(ctx, username, password, appID)
+	if err != nil {
+		return "", err
+	}
+
+	response, err := authenticator.Get(options)
+	if err != nil {
+		return "", err
+	}
+
+	return service.FinishLogin(ctx, sessionID, appID, response)
+}
+
+func claims(t *testing.T, token string) jwt.Claims {
+	t.Helper()
+
+	claims, err := jwt.ParseToken(token, models.App{Id: appID, Secret: appSecret})
+	require.NoError(t, err)
+
+	return claims
+}
+
+func TestRegisterAndLogin(t *testing.T) {
+	ctx := context.Background()
+	service, _, userID := newTestService(t)
+	authenticator := virtualauthn.New(origin)
+
+	passkey := register(t, service, authenticator, userID)
+	assert.Equal(t, "example.com", passkey.RPID)
+	assert.Equal(t, virtualauthn.AAGUID, passkey.AAGUID)
+	assert.Equal(t, []string{"internal"}, passkey.Transports)
+	assert.Equal(t, uint32(1), passkey.SignCount)
+
+	// Ключ сам определяет пользователя
+	token, err := login(service, authenticator, "", "")
+	require.NoError(t, err)
+	assert.Equal(t, userID, claims(t, token).UserID)
+	assert.Equal(t, []string{jwt.AMRHardwareKey}, claims(t, token).AMR)
+
+	token, err = login(service, authenticator, "ivan", "")
+	require.NoError(t, err)
+	assert.Equal(t, userID, claims(t, token).UserID)
+
+	list, err := service.Passkeys(ctx, userID)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, uint32(3), list[0].SignCount)
+	assert.False(t, list[0].LastUsedAt.IsZero())
+
+	// Тот же ключ повторно не регистрируется
+	sessionID, options, err := service.BeginRegistration(ctx, userID, appID, "")
+	require.NoError(t, err)
+	assert.Contains(t, string(options), "excludeCredentials")
+
+	_, err = service.FinishRegistration(ctx, userID, sessionID, " ", nil)
+	assert.ErrorIs(t, err, ErrInvalidName)
+}
+
+func TestSecondFactor(t *testing.T) {
+	service, storage, userID := newTestService(t)
+	authenticator := virtualauthn.New(origin)
+
+	// Без ключей второй фактор проверить нечем
+	_, err := login(service, authenticator, "ivan", "password")
+	assert.ErrorIs(t, err, ErrNoPasskeys)
+
+	register(t, service, authenticator, userID)
+
+	token, err := login(service, authenticator, "ivan", "password")
+	require.NoError(t, err)
+	assert.Equal(t, []string{jwt.AMRPassword, jwt.AMRHardwareKey, jwt.AMRMultiFactor}, claims(t, token).AMR)
+
+	_, err = login(service, authenticator, "ivan", "wrong")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+
+	// Как единственный фактор ключ обязан проверить пользователя, как второй - нет
+	authenticator.UserVerification = false
+
+	_, err = login(service, authenticator, "", "")
+	assert.ErrorIs(t, err, ErrAuthenticationFailed)
+
+	_, err = login(service, authenticator, "ivan", "password")
+	require.NoError(t, err)
+
+	// Чужой ключ не подходит ко входу конкретного пользователя
+	otherID, err := storage.SaveUser(context.Background(), "petr", []byte("hash"))
+	require.NoError(t, err)
+
+	other := virtualauthn.New(origin)
+	register(t, service, other, otherID)
+
+	ctx := context.Background()
+	sessionID, _, err := service.BeginLogin(ctx, "ivan", "", appID)
+	require.NoError(t, err)
+
+	_, foreignOptions, err := service.BeginLogin(ctx, "", "", appID)
+	require.NoError(t, err)
+
+	response, err := other.Get(foreignOptions)
+	require.NoError(t, err)
+
+	_, err = service.FinishLogin(ctx, sessionID, appID, response)
+	assert.ErrorIs(t, err, ErrAuthenticationFailed)
+}
+
+func TestLoginRejects(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("cloned authenticator", func(t *testing.T) {
+		service, _, userID := newTestService(t)
+		authenticator := virtualauthn.New(origin)
+		register(t, service, authenticator, userID)
+
+		clone := authenticator.Clone()
+
+		_, err := login(service, authenticator, "", "")
+		require.NoError(t, err)
+
+		_, err = login(service, clone, "", "")
+		assert.ErrorIs(t, err, ErrAuthenticationFailed)
+	})
+
+	t.Run("session reuse and other app", func(t *testing.T) {
+		service, _, userID := newTestService(t)
+		authenticator := virtualauthn.New(origin)
+		register(t, service, authenticator, userID)
+
+		sessionID, options, err := service.BeginLogin(ctx, "", "", appID)
+		require.NoError(t, err)
+
+		response, err := authenticator.Get(options)
+		require.NoError(t, err)
+
+		_, err = service.FinishLogin(ctx, sessionID, otherApp, response)
+		assert.ErrorIs(t, err, ErrInvalidSession)
+
+		_, err = service.FinishLogin(ctx, sessionID, appID, response)
+		assert.ErrorIs(t, err, ErrInvalidSession)
+	})
+
+	t.Run("deleted passkey", func(t *testing.T) {
+		service, _, userID := newTestService(t)
+		authenticator := virtualauthn.New(origin)
+		passkey := register(t, service, authenticator, userID)
+
+		require.NoError(t, service.Delete(ctx, userID, passkey.Id))
+		assert.ErrorIs(t, service.Delete(ctx, userID, passkey.Id), ErrPasskeyNotFound)
+
+		_, err := login(service, authenticator, "", "")
+		assert.ErrorIs(t, err, ErrAuthenticationFailed)
+	})
+}
+
+func TestRegistrationRejects(t *testing.T) {
+	ctx := context.Background()
+	service, storage, userID := newTestService(t)
+
+	// Страница с чужого адреса
+	phishing := virtualauthn.New("https://example.org")
+
+	sessionID, options, err := service.BeginRegistration(ctx, userID, appID, "")
+	require.NoError(t, err)
+
+	response, err := phishing.Create(options)
+	require.NoError(t, err)
+
+	_, err = service.FinishRegistration(ctx, userID, sessionID, "laptop", response)
+	assert.ErrorIs(t, err, ErrInvalidCredential)
+
+	// Церемонию нельзя завершить от имени другого пользователя
+	otherID, err := storage.SaveUser(ctx, "petr", []byte("hash"))
+	require.NoError(t, err)
+
+	sessionID, options, err = service.BeginRegistration(ctx, userID, appID, "")
+	require.NoError(t, err)
+
+	response, err = virtualauthn.New(origin).Create(options)
+	require.NoError(t, err)
+
+	_, err = service.FinishRegistration(ctx, otherID, sessionID, "laptop", response)
+	assert.ErrorIs(t, err, ErrInvalidSession)
+
+	_, _, err = service.BeginRegistration(ctx, userID, 42, "")
+	assert.ErrorIs(t, err, ErrAppNotFound)
+}
+
+// С токеном приложения ключ регистрируется только после проверки текущего пароля
+func TestRegistrationWithPassword(t *testing.T) {
+	ctx := context.Background()
+	service, storage, userID := newTestService(t)
+
+	_, _, err := service.BeginRegistration(ctx, userID, appID, "wrong")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+
+	// Верный пароль другого пользователя тоже не подходит
+	otherHash, err := bcrypt.GenerateFromPassword([]byte("other-password"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	_, err = storage.SaveUser(ctx, "petr", otherHash)
+	require.NoError(t, err)
+
+	_, _, err = service.BeginRegistration(ctx, userID, appID, "other-password")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+
+	sessionID, options, err := service.BeginRegistration(ctx, userID, appID, "password")
+	require.NoError(t, err)
+
+	response, err := virtualauthn.New(origin).Create(options)
+	require.NoError(t, err)
+
+	_, err = service.FinishRegistration(ctx, userID, sessionID, "laptop", response)
+	require.NoError(t, err)
+}
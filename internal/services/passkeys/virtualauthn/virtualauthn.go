@@ -0,0 +1,245 @@
+// Package virtualauthn Программный аутентификатор WebAuthn для тестов
+// Делает то же, что браузер вместе с ключом: по опциям церемонии возвращает JSON ответа
+// для navigator.credentials.create и navigator.credentials.get. Аттестация всегда "none"
+package virtualauthn
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+)
+
+// Флаги данных аутентификатора
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttestedData = 0x40
+)
+
+// AAGUID модели аутентификатора, под которым регистрируются его ключи
+var AAGUID = []byte("shilka-virtual-a")
+
+// Authenticator хранит созданные ключи и счётчик подписей
+type Authenticator struct {
+	// Origin страницы, с которой браузер якобы вызывает церемонию
+	Origin string
+	// UserVerification аутентификатор подтверждает, что пользователь ввёл PIN или приложил палец
+	UserVerification bool
+
+	credentials []*credential
+	signCount   uint32
+}
+
+type credential struct {
+	id         []byte
+	rpID       string
+	userHandle []byte
+	key        *ecdsa.PrivateKey
+}
+
+// New возвращает пустой аутентификатор с проверкой пользователя
+func New(origin string) *Authenticator {
+	return &Authenticator{Origin: origin, UserVerification: true}
+}
+
+// Clone Копия с теми же ключами и счётчиком, как у склонированного ключа
+func (a *Authenticator) Clone() *Authenticator {
+	clone := *a
+	clone.credentials = append([]*credential(nil), a.credentials...)
+
+	return &clone
+}
+
+type creationOptions struct {
+	PublicKey struct {
+		Challenge string `json:"challenge"`
+		RP        struct {
+			ID string `json:"id"`
+		} `json:"rp"`
+		User struct {
+			ID string `json:"id"`
+		} `json:"user"`
+	} `json:"publicKey"`
+}
+
+// Create Создаёт ключ по опциям регистрации и возвращает ответ для завершения регистрации
+func (a *Authenticator) Create(options []byte) ([]byte, error) {
+	var opts creationOptions
+	if err := json.Unmarshal(options, &opts); err != nil {
+		return nil, err
+	}
+
+	userHandle, err := base64.RawURLEncoding.DecodeString(opts.PublicKey.User.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	cred := &credential{id: id, rpID: opts.PublicKey.RP.ID, userHandle: userHandle, key: key}
+	a.credentials = append(a.credentials, cred)
+
+	publicKey, err := webauthncbor.Marshal(map[int]any{
+		1:  2,  // kty: EC2
+		3:  -7, // alg: ES256
+		-1: 1,  // crv: P-256
+		-2: key.PublicKey.X.FillBytes(make([]byte, 32)),
+		-3: key.PublicKey.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	attested := append([]byte{}, AAGUID...)
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(id)))
+	attested = append(attested, id...)
+	attested = append(attested, publicKey...)
+
+	authData := a.authData(cred.rpID, flagAttestedData)
+	authData = append(authData, attested...)
+
+	attestationObject, err := webauthncbor.Marshal(map[string]any{
+		"fmt":      "none",
+		"attStmt":  map[string]any{},
+		"authData": authData,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	clientData, err := a.clientData("webauthn.create", opts.PublicKey.Challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(map[string]any{
+		"id":    encode(id),
+		"rawId": encode(id),
+		"type":  "public-key",
+		"response": map[string]any{
+			"clientDataJSON":    encode(clientData),
+			"attestationObject": encode(attestationObject),
+			"transports":        []string{"internal"},
+		},
+	})
+}
+
+type requestOptions struct {
+	PublicKey struct {
+		Challenge        string `json:"challenge"`
+		RPID             string `json:"rpId"`
+		AllowCredentials []struct {
+			ID string `json:"id"`
+		} `json:"allowCredentials"`
+	} `json:"publicKey"`
+}
+
+// ErrNoCredential у аутентификатора нет подходящего ключа
+var ErrNoCredential = errors.New("no matching credential")
+
+// Get Подписывает вызов входа подходящим ключом и возвращает ответ для завершения входа
+func (a *Authenticator) Get(options []byte) ([]byte, error) {
+	var opts requestOptions
+	if err := json.Unmarshal(options, &opts); err != nil {
+		return nil, err
+	}
+
+	cred := a.find(opts.PublicKey.RPID, opts.PublicKey.AllowCredentials)
+	if cred == nil {
+		return nil, ErrNoCredential
+	}
+
+	authData := a.authData(cred.rpID, 0)
+
+	clientData, err := a.clientData("webauthn.get", opts.PublicKey.Challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+
+	signature, err := ecdsa.SignASN1(rand.Reader, cred.key, digest[:])
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(map[string]any{
+		"id":    encode(cred.id),
+		"rawId": encode(cred.id),
+		"type":  "public-key",
+		"response": map[string]any{
+			"clientDataJSON":    encode(clientData),
+			"authenticatorData": encode(authData),
+			"signature":         encode(signature),
+			"userHandle":        encode(cred.userHandle),
+		},
+	})
+}
+
+// Ищет последний ключ домена, а если указан список разрешённых ключей, то только среди них
+func (a *Authenticator) find(rpID string, allowed []struct {
+	ID string `json:"id"`
+}) *credential {
+	for i := len(a.credentials) - 1; i >= 0; i-- {
+		cred := a.credentials[i]
+		if cred.rpID != rpID {
+			continue
+		}
+
+		if len(allowed) == 0 {
+			return cred
+		}
+
+		for _, descriptor := range allowed {
+			if descriptor.ID == encode(cred.id) {
+				return cred
+			}
+		}
+	}
+
+	return nil
+}
+
+// Хэш домена, флаги и увеличенный счётчик подписей
+func (a *Authenticator) authData(rpID string, flags byte) []byte {
+	a.signCount++
+
+	flags |= flagUserPresent
+	if a.UserVerification {
+		flags |= flagUserVerified
+	}
+
+	rpIDHash := sha256.Sum256([]byte(rpID))
+
+	data := append([]byte{}, rpIDHash[:]...)
+	data = append(data, flags)
+
+	return binary.BigEndian.AppendUint32(data, a.signCount)
+}
+
+func (a *Authenticator) clientData(ceremony string, challenge string) ([]byte, error) {
+	return json.Marshal(map[string]any{
+		"type":      ceremony,
+		"challenge": challenge,
+		"origin":    a.Origin,
+	})
+}
+
+func encode(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
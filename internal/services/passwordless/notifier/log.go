@@ -0,0 +1,28 @@
+package notifier
+
+import (
+	"context"
+	"log/slog"
+)
+
+// Log Пишет коды в лог. Подходит только для локальной разработки
+type Log struct {
+	log *slog.Logger
+}
+
+// NewLog возвращает notifier, который пишет сообщения в лог
+func NewLog(log *slog.Logger) *Log {
+	return &Log{log: log}
+}
+
+func (l *Log) Notify(_ context.Context, msg Message) error {
+	l.log.Info("one-time code",
+		slog.String("to", msg.To),
+		slog.Bool("verification", msg.Verification),
+		slog.String("app", msg.AppName),
+		slog.String("code", msg.Code),
+		slog.String("link", msg.Link),
+	)
+
+	return nil
+}
@@ -0,0 +1,21 @@
+// Package notifier Доставка одноразовых кодов входа без пароля и подтверждения почты и телефона
+package notifier
+
+import "context"
+
+// Message сообщение с кодом или ссылкой для входа
+// Link пустая, если пользователь вводит Code сам
+type Message struct {
+	// Адрес получателя
+	To      string
+	AppName string
+	Code    string
+	Link    string
+	// Код подтверждает почту или телефон, а не вход в приложение
+	Verification bool
+}
+
+// Notifier доставляет сообщение пользователю
+type Notifier interface {
+	Notify(ctx context.Context, msg Message) error
+}
@@ -0,0 +1,66 @@
+package notifier
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+)
+
+// SMTP Отправляет коды письмом
+type SMTP struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+// NewSMTP возвращает notifier, который отправляет письма через SMTP сервер host:port
+// Если username пустой, сервер используется без авторизации
+func NewSMTP(host string, port int, username string, password string, from string) *SMTP {
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+
+	return &SMTP{
+		addr: net.JoinHostPort(host, strconv.Itoa(port)),
+		auth: auth,
+		from: from,
+	}
+}
+
+func (s *SMTP) Notify(_ context.Context, msg Message) error {
+	const operation = "notifier.SMTP.Notify"
+
+	// Переводы строк в адресе позволили бы дописать свои заголовки письма
+	if !strings.Contains(msg.To, "@") || strings.ContainsAny(msg.To, "\r\n") {
+		return fmt.Errorf("%s: invalid recipient address %q", operation, msg.To)
+	}
+
+	subject := "Вход в " + msg.AppName
+	body := "Код для входа в " + msg.AppName + ": " + msg.Code + "\r\n"
+	if msg.Link != "" {
+		body = "Ссылка для входа в " + msg.AppName + ": " + msg.Link + "\r\n"
+	}
+
+	if msg.Verification {
+		subject = "Подтверждение адреса"
+		body = "Код подтверждения адреса: " + msg.Code + "\r\n"
+	}
+
+	letter := "From: " + s.from + "\r\n" +
+		"To: " + msg.To + "\r\n" +
+		"Subject: " + mime.QEncoding.Encode("utf-8", subject) + "\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"\r\n" + body
+
+	if err := smtp.SendMail(s.addr, s.auth, s.from, []string{msg.To}, []byte(letter)); err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return nil
+}
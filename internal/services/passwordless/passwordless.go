@@ -0,0 +1,349 @@
+// Package passwordless Вход без пароля по одноразовому коду или ссылке
+package passwordless
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net/url"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/lib/identifiers"
+	"shilka-sso/internal/lib/jwt"
+	"shilka-sso/internal/lib/logger/sl"
+	"shilka-sso/internal/services/passwordless/notifier"
+	"shilka-sso/internal/storage"
+	"time"
+)
+
+const codeDigits = 6
+
+type Passwordless struct {
+	log         *slog.Logger
+	storage     Storage
+	auditor     Auditor
+	notifier    Notifier
+	codeTTL     time.Duration
+	maxAttempts int
+	linkURL     string
+	tokenTTL    time.Duration
+}
+
+// Storage Методы бд, нужные сервису
+type Storage interface {
+	UserByIdentifier(ctx context.Context, login string) (models.User, error)
+	Identifiers(ctx context.Context, userID int64) ([]models.Identifier, error)
+	UserByID(ctx context.Context, userID int64) (models.User, error)
+	GetApp(ctx context.Context, appID int) (models.App, error)
+	SavePasswordlessChallenge(ctx context.Context, challenge models.PasswordlessChallenge) error
+	UsePasswordlessAttempt(ctx context.Context, challengeID string, maxAttempts int) (models.PasswordlessChallenge, error)
+	DeletePasswordlessChallenge(ctx context.Context, challengeID string) error
+}
+
+// Auditor Журнал аудита, в который пишутся события сервиса
+type Auditor interface {
+	Record(ctx context.Context, event string, userID int64, appID int, payload map[string]any) error
+}
+
+// Notifier доставляет код пользователю
+type Notifier interface {
+	Notify(ctx context.Context, msg notifier.Message) error
+}
+
+// Ошибки сервисного слоя
+var (
+	ErrAppNotFound       = errors.New("app not found")
+	ErrUnsupportedMethod = errors.New("unsupported delivery method")
+	ErrInvalidCode       = errors.New("invalid or expired code")
+)
+
+// New возвращает новый объект сервиса входа без пароля
+// linkURL - страница приложения, которая принимает ссылку для входа. Если пустая, вход по ссылке выключен
+func New(
+	log *slog.Logger,
+	storage Storage,
+	auditor Auditor,
+	notifier Notifier,
+	codeTTL time.Duration,
+	maxAttempts int,
+	linkURL string,
+	tokenTTL time.Duration,
+) *Passwordless {
+	return &Passwordless{
+		log:         log,
+		storage:     storage,
+		auditor:     auditor,
+		notifier:    notifier,
+		codeTTL:     codeTTL,
+		maxAttempts: maxAttempts,
+		linkURL:     linkURL,
+		tokenTTL:    tokenTTL,
+	}
+}
+
+// Start Начинает вход без пароля и отправляет пользователю код или ссылку
+// Возвращает id входа, который нужно передать в Complete вместе с кодом.
+// Для неизвестного пользователя и пользователя без подтверждённых почты или телефона возвращается такой же ответ,
+// но ничего не отправляется, чтобы по ответу нельзя было узнать, зарегистрирован ли пользователь
+func (p *Passwordless) Start(ctx context.Context, username string, appID int, method string) (string, error) {
+	const operator = "passwordless.Start"
+
+	log := p.log.With(
+		slog.String("operator", operator),
+		slog.String("username", username),
+		slog.Int("appID", appID),
+		slog.String("method", method),
+	)
+
+	if method != models.PasswordlessCode && (method != models.PasswordlessLink || p.linkURL == "") {
+		return "", fmt.Errorf("%s: %w", operator, ErrUnsupportedMethod)
+	}
+
+	app, err := p.storage.GetApp(ctx, appID)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return "", fmt.Errorf("%s: %w", operator, ErrAppNotFound)
+		}
+
+		return "", fmt.Errorf("%s: %w", operator, err)
+	}
+
+	challengeID, err := randomString(16)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", operator, err)
+	}
+
+	user, err := p.storage.UserByIdentifier(ctx, username)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Info("Passwordless login requested for unknown user")
+
+			return challengeID, nil
+		}
+
+		return "", fmt.Errorf("%s: %w", operator, err)
+	}
+
+	to, err := p.recipient(ctx, username, user)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", operator, err)
+	}
+
+	if to == "" {
+		log.Info("Passwordless login requested for user without verified identifiers")
+
+		return challengeID, nil
+	}
+
+	code, err := newCode(method)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", operator, err)
+	}
+
+	now := time.Now()
+
+	err = p.storage.SavePasswordlessChallenge(ctx, models.PasswordlessChallenge{
+		Id:        challengeID,
+		UserId:    user.Id,
+		AppId:     app.Id,
+		Method:    method,
+		CodeHash:  hashCode(challengeID, code),
+		ExpiresAt: now.Add(p.codeTTL),
+		CreatedAt: now,
+	})
+	if err != nil {
+		log.Error("Failed to save passwordless challenge", sl.Err(err))
+
+		return "", fmt.Errorf("%s: %w", operator, err)
+	}
+
+	msg := notifier.Message{
+		To:      to,
+		AppName: app.Name,
+		Code:    code,
+	}
+
+	if method == models.PasswordlessLink {
+		msg.Link = p.link(challengeID, code)
+	}
+
+	if err := p.notifier.Notify(ctx, msg); err != nil {
+		log.Error("Failed to deliver passwordless code", sl.Err(err))
+
+		return "", fmt.Errorf("%s: %w", operator, err)
+	}
+
+	log.Info("Passwordless code sent")
+
+	return challengeID, nil
+}
+
+// Complete Проверяет код и выдаёт обычный токен приложения
+// Код одноразовый, действует codeTTL и только для приложения, которое начало вход.
+// После maxAttempts неверных кодов вход нужно начать заново
+func (p *Passwordless) Complete(ctx context.Context, challengeID string, code string, appID int) (string, error) {
+	const operator = "passwordless.Complete"
+
+	log := p.log.With(
+		slog.String("operator", operator),
+		slog.Int("appID", appID),
+	)
+
+	challenge, err := p.storage.UsePasswordlessAttempt(ctx, challengeID, p.maxAttempts)
+	if err != nil {
+		if errors.Is(err, storage.ErrPasswordlessChallengeNotFound) {
+			log.Info("Unknown, expired or exhausted passwordless challenge")
+
+			return "", fmt.Errorf("%s: %w", operator, ErrInvalidCode)
+		}
+
+		return "", fmt.Errorf("%s: %w", operator, err)
+	}
+
+	valid := subtle.ConstantTimeCompare([]byte(hashCode(challengeID, code)), []byte(challenge.CodeHash)) == 1
+
+	if !valid || challenge.AppId != appID {
+		log.Info("Invalid passwordless code", slog.Int("attempts", challenge.Attempts))
+
+		p.audit(ctx, models.AuditLoginFailed, challenge.UserId, appID, map[string]any{"method": challenge.Method})
+
+		return "", fmt.Errorf("%s: %w", operator, ErrInvalidCode)
+	}
+
+	// Удаление и есть использование кода: из двух параллельных запросов пройдёт только один
+	if err := p.storage.DeletePasswordlessChallenge(ctx, challengeID); err != nil {
+		if errors.Is(err, storage.ErrPasswordlessChallengeNotFound) {
+			return "", fmt.Errorf("%s: %w", operator, ErrInvalidCode)
+		}
+
+		return "", fmt.Errorf("%s: %w", operator, err)
+	}
+
+	user, err := p.storage.UserByID(ctx, challenge.UserId)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return "", fmt.Errorf("%s: %w", operator, ErrInvalidCode)
+		}
+
+		return "", fmt.Errorf("%s: %w", operator, err)
+	}
+
+	if err := user.CheckActive(time.Now()); err != nil {
+		log.Info("Passwordless login refused for inactive account", slog.Int64("userID", user.Id))
+
+		p.audit(ctx, models.AuditLoginFailed, user.Id, appID, map[string]any{
+			"method": challenge.Method,
+			"status": user.Status,
+		})
+
+		return "", fmt.Errorf("%s: %w", operator, err)
+	}
+
+	app, err := p.storage.GetApp(ctx, appID)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", operator, err)
+	}
+
+	token, err := jwt.NewToken(user, app, p.tokenTTL)
+	if err != nil {
+		log.Error("Failed to create token", sl.Err(err))
+
+		return "", fmt.Errorf("%s: %w", operator, err)
+	}
+
+	p.audit(ctx, models.AuditLoginSucceeded, user.Id, app.Id, map[string]any{
+		"username": user.Username,
+		"method":   challenge.Method,
+	})
+
+	log.Info("Passwordless login completed", slog.Int64("userID", user.Id))
+
+	return token, nil
+}
+
+// Адрес, на который отправляется код: почта или телефон, по которым пользователь входит,
+// иначе его подтверждённая почта. Пустой, если подтверждённой почты нет: имя пользователя адресом не считается
+func (p *Passwordless) recipient(ctx context.Context, login string, user models.User) (string, error) {
+	list, err := p.storage.Identifiers(ctx, user.Id)
+	if err != nil {
+		return "", err
+	}
+
+	kind := identifiers.Kind(login)
+
+	var to string
+
+	for _, identifier := range list {
+		if !identifier.Verified() {
+			continue
+		}
+
+		if identifier.Kind == kind {
+			return identifier.Canonical, nil
+		}
+
+		if identifier.Kind == models.IdentifierEmail {
+			to = identifier.Canonical
+		}
+	}
+
+	return to, nil
+}
+
+func (p *Passwordless) link(challengeID string, code string) string {
+	link, err := url.Parse(p.linkURL)
+	if err != nil {
+		return p.linkURL
+	}
+
+	query := link.Query()
+	query.Set("challenge_id", challengeID)
+	query.Set("code", code)
+	link.RawQuery = query.Encode()
+
+	return link.String()
+}
+
+// Пишет событие в журнал аудита. Ошибка аудита не должна ломать сам запрос, поэтому только логируется
+func (p *Passwordless) audit(ctx context.Context, event string, userID int64, appID int, payload map[string]any) {
+	if err := p.auditor.Record(ctx, event, userID, appID, payload); err != nil {
+		p.log.Error("Failed to write audit record", slog.String("event", event), sl.Err(err))
+	}
+}
+
+// Шестизначный код для ввода руками или длинный для ссылки
+func newCode(method string) (string, error) {
+	if method == models.PasswordlessLink {
+		return randomString(32)
+	}
+
+	n, err := rand.Int(rand.Reader, big.NewInt(1_000_000))
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%0*d", codeDigits, n.Int64()), nil
+}
+
+func randomString(size int) (string, error) {
+	buf := make([]byte, size)
+
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// id входа в хэше не даёт переиспользовать таблицу хэшей шестизначных кодов между входами
+func hashCode(challengeID string, code string) string {
+	sum := sha256.Sum256([]byte(challengeID + ":" + code))
+
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,237 @@
+package passwordless
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"log/slog"
+	"net/url"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/lib/jwt"
+	"shilka-sso/internal/services/passwordless/notifier"
+	"shilka-sso/internal/storage/sqlite/sqlitetest"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	appID     = 1
+	otherApp  = 2
+	appSecret = "secret"
+)
+
+type nopAuditor struct{}
+
+func (nopAuditor) Record(context.Context, string, int64, int, map[string]any) error {
+	return nil
+}
+
+// Запоминает отправленные сообщения вместо доставки
+type recorder struct {
+	mu       sync.Mutex
+	messages []notifier.Message
+}
+
+func (r *recorder) Notify(_ context.Context, msg notifier.Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.messages = append(r.messages, msg)
+
+	return nil
+}
+
+func (r *recorder) last(t *testing.T) notifier.Message {
+	t.Helper()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	require.NotEmpty(t, r.messages)
+
+	return r.messages[len(r.messages)-1]
+}
+
+func newTestService(t *testing.T, codeTTL time.Duration) (*Passwordless, *recorder, int64) {
+	t.Helper()
+
+	storage, path := sqlitetest.New(t)
+	sqlitetest.SaveApp(t, path, models.App{Id: appID, Name: "shilka", Secret: appSecret})
+	sqlitetest.SaveApp(t, path, models.App{Id: otherApp, Name: "other", Secret: "other"})
+
+	ctx := context.Background()
+
+	userID, err := storage.SaveUser(ctx, "ivan", []byte("hash"))
+	require.NoError(t, err)
+
+	now := time.Now()
+	require.NoError(t, storage.SetIdentifier(ctx, models.Identifier{
+		UserId:        userID,
+		Kind:          models.IdentifierEmail,
+		Value:         "ivan@example.com",
+		Canonical:     "ivan@example.com",
+		CodeExpiresAt: now.Add(time.Minute),
+		CreatedAt:     now,
+	}))
+	require.NoError(t, storage.VerifyIdentifier(ctx, userID, models.IdentifierEmail))
+
+	r := &recorder{}
+
+	service := New(
+		slog.New(slog.NewTextHandler(io.Discard, nil)),
+		storage,
+		nopAuditor{},
+		r,
+		codeTTL,
+		3,
+		"https://app.example.com/login",
+		time.Hour,
+	)
+
+	return service, r, userID
+}
+
+func TestCodeLogin(t *testing.T) {
+	ctx := context.Background()
+	service, r, userID := newTestService(t, time.Minute)
+
+	challengeID, err := service.Start(ctx, "ivan@example.com", appID, models.PasswordlessCode)
+	require.NoError(t, err)
+
+	msg := r.last(t)
+	assert.Equal(t, "ivan@example.com", msg.To)
+	assert.Equal(t, "shilka", msg.AppName)
+	assert.Len(t, msg.Code, codeDigits)
+	assert.Empty(t, msg.Link)
+
+	token, err := service.Complete(ctx, challengeID, msg.Code, appID)
+	require.NoError(t, err)
+
+	claims, err := jwt.ParseToken(token, models.App{Id: appID, Secret: appSecret})
+	require.NoError(t, err)
+	assert.Equal(t, userID, claims.UserID)
+
+	// Код одноразовый
+	_, err = service.Complete(ctx, challengeID, msg.Code, appID)
+	assert.ErrorIs(t, err, ErrInvalidCode)
+}
+
+func TestLinkLogin(t *testing.T) {
+	ctx := context.Background()
+	service, r, _ := newTestService(t, time.Minute)
+
+	challengeID, err := service.Start(ctx, "ivan@example.com", appID, models.PasswordlessLink)
+	require.NoError(t, err)
+
+	link, err := url.Parse(r.last(t).Link)
+	require.NoError(t, err)
+	assert.Equal(t, "app.example.com", link.Host)
+	assert.Equal(t, challengeID, link.Query().Get("challenge_id"))
+
+	_, err = service.Complete(ctx, challengeID, link.Query().Get("code"), appID)
+	require.NoError(t, err)
+}
+
+func TestCompleteRejects(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("other app", func(t *testing.T) {
+		service, r, _ := newTestService(t, time.Minute)
+
+		challengeID, err := service.Start(ctx, "ivan@example.com", appID, models.PasswordlessCode)
+		require.NoError(t, err)
+
+		_, err = service.Complete(ctx, challengeID, r.last(t).Code, otherApp)
+		assert.ErrorIs(t, err, ErrInvalidCode)
+	})
+
+	t.Run("attempts exhausted", func(t *testing.T) {
+		service, r, _ := newTestService(t, time.Minute)
+
+		challengeID, err := service.Start(ctx, "ivan@example.com", appID, models.PasswordlessCode)
+		require.NoError(t, err)
+
+		for range 3 {
+			_, err = service.Complete(ctx, challengeID, "wrong", appID)
+			assert.ErrorIs(t, err, ErrInvalidCode)
+		}
+
+		// После исчерпания попыток не подходит даже верный код
+		_, err = service.Complete(ctx, challengeID, r.last(t).Code, appID)
+		assert.ErrorIs(t, err, ErrInvalidCode)
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		service, r, _ := newTestService(t, time.Millisecond)
+
+		challengeID, err := service.Start(ctx, "ivan@example.com", appID, models.PasswordlessCode)
+		require.NoError(t, err)
+
+		time.Sleep(5 * time.Millisecond)
+
+		_, err = service.Complete(ctx, challengeID, r.last(t).Code, appID)
+		assert.ErrorIs(t, err, ErrInvalidCode)
+	})
+}
+
+func TestStartUnknownUser(t *testing.T) {
+	ctx := context.Background()
+	service, r, _ := newTestService(t, time.Minute)
+
+	challengeID, err := service.Start(ctx, "nobody@example.com", appID, models.PasswordlessCode)
+	require.NoError(t, err)
+	assert.NotEmpty(t, challengeID)
+	assert.Empty(t, r.messages)
+
+	_, err = service.Start(ctx, "ivan@example.com", 42, models.PasswordlessCode)
+	assert.ErrorIs(t, err, ErrAppNotFound)
+
+	_, err = service.Start(ctx, "ivan@example.com", appID, "sms")
+	assert.ErrorIs(t, err, ErrUnsupportedMethod)
+}
+
+func TestStartByVerifiedEmail(t *testing.T) {
+	ctx := context.Background()
+	storage, path := sqlitetest.New(t)
+	sqlitetest.SaveApp(t, path, models.App{Id: appID, Name: "shilka", Secret: appSecret})
+
+	userID, err := storage.SaveUser(ctx, "ivan", []byte("hash"))
+	require.NoError(t, err)
+
+	now := time.Now()
+	require.NoError(t, storage.SetIdentifier(ctx, models.Identifier{
+		UserId:        userID,
+		Kind:          models.IdentifierEmail,
+		Value:         "Ivan@Example.com",
+		Canonical:     "ivan@example.com",
+		CodeExpiresAt: now.Add(time.Minute),
+		CreatedAt:     now,
+	}))
+
+	r := &recorder{}
+	service := New(slog.New(slog.NewTextHandler(io.Discard, nil)), storage, nopAuditor{}, r, time.Minute, 3, "", time.Hour)
+
+	// Неподтверждённая почта не подходит ни для входа, ни для доставки, а на имя код не отправить.
+	// Ответ при этом такой же, как для неизвестного пользователя
+	for _, login := range []string{"ivan@example.com", "ivan"} {
+		challengeID, err := service.Start(ctx, login, appID, models.PasswordlessCode)
+		require.NoError(t, err)
+		assert.NotEmpty(t, challengeID)
+		assert.Empty(t, r.messages)
+	}
+
+	require.NoError(t, storage.VerifyIdentifier(ctx, userID, models.IdentifierEmail))
+
+	for _, login := range []string{"ivan", "IVAN@example.com"} {
+		challengeID, err := service.Start(ctx, login, appID, models.PasswordlessCode)
+		require.NoError(t, err)
+
+		msg := r.last(t)
+		assert.Equal(t, "ivan@example.com", msg.To)
+
+		_, err = service.Complete(ctx, challengeID, msg.Code, appID)
+		require.NoError(t, err)
+	}
+}
@@ -0,0 +1,276 @@
+// Package personaltokens Личные токены доступа пользователей для скриптов и утилит
+// Токен непрозрачный, в бд хранится только его хэш. Сервис проверяет такие токены
+// и передаёт все остальные следующему валидатору
+package personaltokens
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/lib/jwt"
+	"shilka-sso/internal/lib/logger/sl"
+	"shilka-sso/internal/storage"
+	"strings"
+	"time"
+)
+
+// Prefix начало каждого личного токена, по нему токен отличается от JWT и находится сканерами секретов
+const Prefix = "sso_pat_"
+
+// Как часто обновляется время последнего использования, чтобы не писать в бд на каждый запрос
+const touchInterval = time.Minute
+
+const maxNameLength = 100
+
+type PersonalTokens struct {
+	log        *slog.Logger
+	storage    Storage
+	auditor    Auditor
+	next       TokenValidator
+	defaultTTL time.Duration
+	maxTTL     time.Duration
+}
+
+// Storage Методы бд, нужные сервису
+type Storage interface {
+	SavePersonalToken(ctx context.Context, token models.PersonalToken) (int64, error)
+	PersonalTokenByHash(ctx context.Context, tokenHash string) (models.PersonalToken, error)
+	PersonalTokens(ctx context.Context, userID int64) ([]models.PersonalToken, error)
+	DeletePersonalToken(ctx context.Context, userID int64, tokenID int64) error
+	TouchPersonalToken(ctx context.Context, tokenID int64, usedAt time.Time) error
+	UserByID(ctx context.Context, userID int64) (models.User, error)
+}
+
+// Auditor Журнал аудита, в который пишутся события сервиса
+type Auditor interface {
+	Record(ctx context.Context, event string, userID int64, appID int, payload map[string]any) error
+}
+
+// TokenValidator проверяет токены, которые не являются личными
+type TokenValidator interface {
+	ValidateToken(ctx context.Context, token string) (jwt.Claims, error)
+	IsAdmin(ctx context.Context, userID int64) (bool, error)
+}
+
+// Ошибки сервисного слоя
+var (
+	ErrInvalidName   = errors.New("invalid token name")
+	ErrInvalidScope  = errors.New("invalid scope")
+	ErrInvalidExpiry = errors.New("invalid token expiry")
+	ErrTokenExists   = errors.New("personal token already exists")
+	ErrTokenNotFound = errors.New("personal token not found")
+	ErrInvalidToken  = errors.New("invalid token")
+)
+
+// New возвращает новый объект сервиса личных токенов
+// next - валидатор остальных токенов, defaultTTL - срок токена, если пользователь его не указал
+func New(
+	log *slog.Logger,
+	storage Storage,
+	auditor Auditor,
+	next TokenValidator,
+	defaultTTL time.Duration,
+	maxTTL time.Duration,
+) *PersonalTokens {
+	return &PersonalTokens{
+		log:        log,
+		storage:    storage,
+		auditor:    auditor,
+		next:       next,
+		defaultTTL: defaultTTL,
+		maxTTL:     maxTTL,
+	}
+}
+
+// Create Создаёт личный токен пользователя и возвращает его вместе с самим токеном
+// Токен показывается только один раз, в бд хранится его хэш
+func (p *PersonalTokens) Create(
+	ctx context.Context,
+	userID int64,
+	name string,
+	scopes []string,
+	ttl time.Duration,
+) (models.PersonalToken, string, error) {
+	const operator = "personaltokens.Create"
+
+	log := p.log.With(
+		slog.String("operator", operator),
+		slog.Int64("userID", userID),
+		slog.String("name", name),
+	)
+
+	log.Info("Creating personal token")
+
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > maxNameLength {
+		return models.PersonalToken{}, "", fmt.Errorf("%s: %w", operator, ErrInvalidName)
+	}
+
+	for _, scope := range scopes {
+		if scope == "" || strings.ContainsAny(scope, " \t\n\"\\") {
+			return models.PersonalToken{}, "", fmt.Errorf("%s: %w", operator, ErrInvalidScope)
+		}
+	}
+
+	if ttl == 0 {
+		ttl = p.defaultTTL
+	}
+
+	if ttl < 0 || ttl > p.maxTTL {
+		return models.PersonalToken{}, "", fmt.Errorf("%s: %w", operator, ErrInvalidExpiry)
+	}
+
+	secret, err := randomString(32)
+	if err != nil {
+		return models.PersonalToken{}, "", fmt.Errorf("%s: %w", operator, err)
+	}
+
+	raw := Prefix + secret
+	now := time.Now()
+
+	token := models.PersonalToken{
+		UserId:    userID,
+		Name:      name,
+		TokenHash: hashToken(raw),
+		Scopes:    scopes,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}
+
+	token.Id, err = p.storage.SavePersonalToken(ctx, token)
+	if err != nil {
+		if errors.Is(err, storage.ErrPersonalTokenExists) {
+			return models.PersonalToken{}, "", fmt.Errorf("%s: %w", operator, ErrTokenExists)
+		}
+
+		log.Error("Failed to save personal token", sl.Err(err))
+
+		return models.PersonalToken{}, "", fmt.Errorf("%s: %w", operator, err)
+	}
+
+	p.audit(ctx, models.AuditPersonalTokenCreated, userID, map[string]any{
+		"personal_token_id": token.Id,
+		"name":              name,
+		"scopes":            scopes,
+		"expires_at":        token.ExpiresAt.Unix(),
+	})
+
+	log.Info("Personal token created", slog.Int64("tokenID", token.Id))
+
+	return token, raw, nil
+}
+
+// PersonalTokens Возвращает токены пользователя, включая просроченные
+func (p *PersonalTokens) PersonalTokens(ctx context.Context, userID int64) ([]models.PersonalToken, error) {
+	const operator = "personaltokens.PersonalTokens"
+
+	tokens, err := p.storage.PersonalTokens(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operator, err)
+	}
+
+	return tokens, nil
+}
+
+// Revoke Отзывает токен пользователя, после этого токен сразу перестаёт проходить проверку
+func (p *PersonalTokens) Revoke(ctx context.Context, userID int64, tokenID int64) error {
+	const operator = "personaltokens.Revoke"
+
+	p.log.Info("Revoking personal token", slog.String("operator", operator), slog.Int64("tokenID", tokenID))
+
+	if err := p.storage.DeletePersonalToken(ctx, userID, tokenID); err != nil {
+		if errors.Is(err, storage.ErrPersonalTokenNotFound) {
+			return fmt.Errorf("%s: %w", operator, ErrTokenNotFound)
+		}
+
+		return fmt.Errorf("%s: %w", operator, err)
+	}
+
+	p.audit(ctx, models.AuditPersonalTokenRevoked, userID, map[string]any{"personal_token_id": tokenID})
+
+	return nil
+}
+
+// ValidateToken Проверяет личный токен, остальные токены передаёт следующему валидатору
+func (p *PersonalTokens) ValidateToken(ctx context.Context, token string) (jwt.Claims, error) {
+	const operator = "personaltokens.ValidateToken"
+
+	if !strings.HasPrefix(token, Prefix) {
+		return p.next.ValidateToken(ctx, token)
+	}
+
+	saved, err := p.storage.PersonalTokenByHash(ctx, hashToken(token))
+	if err != nil {
+		if errors.Is(err, storage.ErrPersonalTokenNotFound) {
+			return jwt.Claims{}, fmt.Errorf("%s: %w", operator, ErrInvalidToken)
+		}
+
+		return jwt.Claims{}, fmt.Errorf("%s: %w", operator, err)
+	}
+
+	now := time.Now()
+	if now.After(saved.ExpiresAt) {
+		return jwt.Claims{}, fmt.Errorf("%s: %w", operator, ErrInvalidToken)
+	}
+
+	user, err := p.storage.UserByID(ctx, saved.UserId)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return jwt.Claims{}, fmt.Errorf("%s: %w", operator, ErrInvalidToken)
+		}
+
+		return jwt.Claims{}, fmt.Errorf("%s: %w", operator, err)
+	}
+
+	if err := user.CheckActive(now); err != nil {
+		return jwt.Claims{}, fmt.Errorf("%s: %w", operator, err)
+	}
+
+	if now.Sub(saved.LastUsedAt) >= touchInterval {
+		if err := p.storage.TouchPersonalToken(ctx, saved.Id, now); err != nil {
+			p.log.Error("Failed to update personal token last use", sl.Err(err))
+		}
+	}
+
+	return jwt.Claims{
+		UserID:          user.Id,
+		Username:        user.Username,
+		Scope:           strings.Join(saved.Scopes, " "),
+		PersonalTokenID: saved.Id,
+	}, nil
+}
+
+// IsAdmin Проверка роли не зависит от вида токена
+func (p *PersonalTokens) IsAdmin(ctx context.Context, userID int64) (bool, error) {
+	return p.next.IsAdmin(ctx, userID)
+}
+
+// Пишет событие в журнал аудита. Ошибка аудита не должна ломать сам запрос, поэтому только логируется
+func (p *PersonalTokens) audit(ctx context.Context, event string, userID int64, payload map[string]any) {
+	if err := p.auditor.Record(ctx, event, userID, 0, payload); err != nil {
+		p.log.Error("Failed to write audit record", slog.String("event", event), sl.Err(err))
+	}
+}
+
+func randomString(size int) (string, error) {
+	buf := make([]byte, size)
+
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// Токен случайный и длинный, поэтому достаточно SHA-256 без соли
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+
+	return hex.EncodeToString(sum[:])
+}
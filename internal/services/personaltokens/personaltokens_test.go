@@ -0,0 +1,139 @@
+package personaltokens
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"log/slog"
+	"shilka-sso/internal/lib/jwt"
+	"shilka-sso/internal/storage/sqlite"
+	"shilka-sso/internal/storage/sqlite/sqlitetest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type nopAuditor struct{}
+
+func (nopAuditor) Record(context.Context, string, int64, int, map[string]any) error {
+	return nil
+}
+
+// Следующий валидатор принимает только токен "jwt"
+type fakeValidator struct{}
+
+func (fakeValidator) ValidateToken(_ context.Context, token string) (jwt.Claims, error) {
+	if token != "jwt" {
+		return jwt.Claims{}, jwt.ErrInvalidToken
+	}
+
+	return jwt.Claims{UserID: 42, AppID: 1}, nil
+}
+
+func (fakeValidator) IsAdmin(context.Context, int64) (bool, error) {
+	return false, nil
+}
+
+func newTestService(t *testing.T) (*PersonalTokens, *sqlite.Storage, int64) {
+	t.Helper()
+
+	storage, _ := sqlitetest.New(t)
+
+	userID, err := storage.SaveUser(context.Background(), "shilka", []byte("hash"))
+	require.NoError(t, err)
+
+	service := New(
+		slog.New(slog.NewTextHandler(io.Discard, nil)),
+		storage,
+		nopAuditor{},
+		fakeValidator{},
+		24*time.Hour,
+		30*24*time.Hour,
+	)
+
+	return service, storage, userID
+}
+
+func TestCreateAndValidate(t *testing.T) {
+	ctx := context.Background()
+	service, _, userID := newTestService(t)
+
+	token, raw, err := service.Create(ctx, userID, "ci", []string{"read", "write"}, 0)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(raw, Prefix))
+	assert.NotContains(t, token.TokenHash, raw)
+	assert.WithinDuration(t, time.Now().Add(24*time.Hour), token.ExpiresAt, time.Minute)
+
+	tokens, err := service.PersonalTokens(ctx, userID)
+	require.NoError(t, err)
+	require.Len(t, tokens, 1)
+	assert.True(t, tokens[0].LastUsedAt.IsZero())
+
+	claims, err := service.ValidateToken(ctx, raw)
+	require.NoError(t, err)
+	assert.Equal(t, userID, claims.UserID)
+	assert.Equal(t, "shilka", claims.Username)
+	assert.Equal(t, token.Id, claims.PersonalTokenID)
+	assert.True(t, claims.IsPersonalToken())
+	assert.True(t, claims.HasScope("write"))
+
+	tokens, err = service.PersonalTokens(ctx, userID)
+	require.NoError(t, err)
+	assert.False(t, tokens[0].LastUsedAt.IsZero())
+
+	// Остальные токены проверяет следующий валидатор
+	claims, err = service.ValidateToken(ctx, "jwt")
+	require.NoError(t, err)
+	assert.Equal(t, int64(42), claims.UserID)
+
+	_, err = service.ValidateToken(ctx, Prefix+"unknown")
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestCreateRejects(t *testing.T) {
+	ctx := context.Background()
+	service, _, userID := newTestService(t)
+
+	_, _, err := service.Create(ctx, userID, "ci", nil, 0)
+	require.NoError(t, err)
+
+	_, _, err = service.Create(ctx, userID, "ci", nil, 0)
+	assert.ErrorIs(t, err, ErrTokenExists)
+
+	_, _, err = service.Create(ctx, userID, " ", nil, 0)
+	assert.ErrorIs(t, err, ErrInvalidName)
+
+	_, _, err = service.Create(ctx, userID, "bad scope", []string{"a b"}, 0)
+	assert.ErrorIs(t, err, ErrInvalidScope)
+
+	_, _, err = service.Create(ctx, userID, "forever", nil, 365*24*time.Hour)
+	assert.ErrorIs(t, err, ErrInvalidExpiry)
+}
+
+func TestRevokeAndExpiry(t *testing.T) {
+	ctx := context.Background()
+	service, storage, userID := newTestService(t)
+
+	otherID, err := storage.SaveUser(ctx, "other", []byte("hash"))
+	require.NoError(t, err)
+
+	token, raw, err := service.Create(ctx, userID, "ci", nil, 0)
+	require.NoError(t, err)
+
+	// Чужой токен отозвать нельзя
+	assert.ErrorIs(t, service.Revoke(ctx, otherID, token.Id), ErrTokenNotFound)
+
+	require.NoError(t, service.Revoke(ctx, userID, token.Id))
+
+	_, err = service.ValidateToken(ctx, raw)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	_, raw, err = service.Create(ctx, userID, "short", nil, time.Millisecond)
+	require.NoError(t, err)
+
+	time.Sleep(5 * time.Millisecond)
+
+	_, err = service.ValidateToken(ctx, raw)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
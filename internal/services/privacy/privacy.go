@@ -0,0 +1,514 @@
+// Package privacy Сервис для запросов субъектов данных: выгрузка всех данных пользователя и их удаление
+// Удаление откладывается на срок, в течение которого запрос можно отменить
+package privacy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/lib/auditchain"
+	"shilka-sso/internal/lib/logger/sl"
+	"shilka-sso/internal/storage"
+	"strings"
+	"time"
+)
+
+type Privacy struct {
+	log         *slog.Logger
+	storage     Storage
+	auditor     Auditor
+	gracePeriod time.Duration
+}
+
+// Storage Методы бд, нужные сервису
+type Storage interface {
+	UserByID(ctx context.Context, userID int64) (models.User, error)
+	IsAdmin(ctx context.Context, userID int64) (bool, error)
+	Identifiers(ctx context.Context, userID int64) ([]models.Identifier, error)
+	AccountStatusHistory(ctx context.Context, userID int64) ([]models.AccountStatusChange, error)
+	PersonalTokens(ctx context.Context, userID int64) ([]models.PersonalToken, error)
+	Passkeys(ctx context.Context, userID int64) ([]models.Passkey, error)
+	FederatedIdentities(ctx context.Context, userID int64) ([]models.FederatedIdentity, error)
+	UserAuditRecords(ctx context.Context, userID int64) ([]models.AuditRecord, error)
+	SaveErasureRequest(ctx context.Context, request models.ErasureRequest) error
+	ErasureRequest(ctx context.Context, userID int64) (models.ErasureRequest, error)
+	DeleteErasureRequest(ctx context.Context, userID int64) error
+	DueErasureRequests(ctx context.Context, now time.Time) ([]models.ErasureRequest, error)
+	EraseUser(ctx context.Context, userID int64, auditRecordIDs []int64, erased models.AuditRecord) error
+}
+
+// Auditor Журнал аудита, в который пишутся выгрузки и удаления
+type Auditor interface {
+	Record(ctx context.Context, event string, userID int64, appID int, payload map[string]any) error
+}
+
+// Ошибки сервисного слоя
+var (
+	ErrUserNotFound     = errors.New("user not found")
+	ErrErasureRequested = errors.New("erasure already requested")
+	ErrErasureNotFound  = errors.New("erasure request not found")
+	ErrOwnErasure       = errors.New("administrators cannot erase their own data")
+)
+
+// New возвращает новый объект сервиса Privacy
+// gracePeriod - сколько запрос на удаление можно отменить
+func New(
+	log *slog.Logger,
+	storage Storage,
+	auditor Auditor,
+	gracePeriod time.Duration,
+) *Privacy {
+	return &Privacy{
+		log:         log,
+		storage:     storage,
+		auditor:     auditor,
+		gracePeriod: gracePeriod,
+	}
+}
+
+// Export Собирает в JSON всё, что сервис хранит о пользователе: профиль, идентификаторы, роли,
+// долгоживущие способы входа и записи аудита. Секреты (хэши паролей, токенов и ключи) в выгрузку не попадают.
+// actorID - администратор, который делает выгрузку
+func (p *Privacy) Export(ctx context.Context, actorID int64, userID int64) ([]byte, error) {
+	const operator = "privacy.Export"
+
+	log := p.log.With(
+		slog.String("operator", operator),
+		slog.Int64("userID", userID),
+	)
+
+	user, err := p.user(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operator, err)
+	}
+
+	data, err := p.collect(ctx, user)
+	if err != nil {
+		log.Error("Failed to collect user data", sl.Err(err))
+
+		return nil, fmt.Errorf("%s: %w", operator, err)
+	}
+
+	result, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operator, err)
+	}
+
+	p.audit(ctx, models.AuditDataExported, userID, map[string]any{"actor_id": actorID})
+
+	log.Info("User data exported")
+
+	return result, nil
+}
+
+// RequestErasure Планирует удаление данных пользователя через gracePeriod
+// До этого момента запрос можно отменить через CancelErasure, пользователь всё это время может входить
+func (p *Privacy) RequestErasure(
+	ctx context.Context,
+	actorID int64,
+	userID int64,
+	reason string,
+) (models.ErasureRequest, error) {
+	const operator = "privacy.RequestErasure"
+
+	log := p.log.With(
+		slog.String("operator", operator),
+		slog.Int64("userID", userID),
+	)
+
+	if actorID == userID {
+		return models.ErasureRequest{}, fmt.Errorf("%s: %w", operator, ErrOwnErasure)
+	}
+
+	now := time.Now()
+
+	request := models.ErasureRequest{
+		UserId:      userID,
+		ActorId:     actorID,
+		Reason:      strings.TrimSpace(reason),
+		RequestedAt: now,
+		EraseAt:     now.Add(p.gracePeriod),
+	}
+
+	if err := p.storage.SaveErasureRequest(ctx, request); err != nil {
+		switch {
+		case errors.Is(err, storage.ErrUserNotFound):
+			return models.ErasureRequest{}, fmt.Errorf("%s: %w", operator, ErrUserNotFound)
+		case errors.Is(err, storage.ErrErasureRequestExists):
+			return models.ErasureRequest{}, fmt.Errorf("%s: %w", operator, ErrErasureRequested)
+		}
+
+		log.Error("Failed to save erasure request", sl.Err(err))
+
+		return models.ErasureRequest{}, fmt.Errorf("%s: %w", operator, err)
+	}
+
+	p.audit(ctx, models.AuditErasureRequested, userID, map[string]any{
+		"actor_id": actorID,
+		"erase_at": request.EraseAt.UTC().Format(time.RFC3339),
+	})
+
+	log.Info("Erasure requested", slog.Time("eraseAt", request.EraseAt))
+
+	return request, nil
+}
+
+// CancelErasure Отменяет запрос на удаление, пока не истёк срок отмены
+func (p *Privacy) CancelErasure(ctx context.Context, actorID int64, userID int64) error {
+	const operator = "privacy.CancelErasure"
+
+	log := p.log.With(
+		slog.String("operator", operator),
+		slog.Int64("userID", userID),
+	)
+
+	if err := p.storage.DeleteErasureRequest(ctx, userID); err != nil {
+		if errors.Is(err, storage.ErrErasureRequestNotFound) {
+			return fmt.Errorf("%s: %w", operator, ErrErasureNotFound)
+		}
+
+		log.Error("Failed to cancel erasure", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", operator, err)
+	}
+
+	p.audit(ctx, models.AuditErasureCancelled, userID, map[string]any{"actor_id": actorID})
+
+	log.Info("Erasure cancelled")
+
+	return nil
+}
+
+// EraseDue Удаляет данные пользователей, у которых истёк срок отмены запроса
+// Ошибка с одним пользователем не мешает остальным, его удаление повторится при следующем запуске
+func (p *Privacy) EraseDue(ctx context.Context) error {
+	const operator = "privacy.EraseDue"
+
+	requests, err := p.storage.DueErasureRequests(ctx, time.Now())
+	if err != nil {
+		return fmt.Errorf("%s: %w", operator, err)
+	}
+
+	for _, request := range requests {
+		if err := p.erase(ctx, request); err != nil {
+			p.log.Error("Failed to erase user", slog.Int64("userID", request.UserId), sl.Err(err))
+		}
+	}
+
+	return nil
+}
+
+// RunErasure Раз в interval удаляет данные пользователей с истёкшим сроком отмены, пока не отменён ctx
+func (p *Privacy) RunErasure(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := p.EraseDue(ctx); err != nil {
+				p.log.Error("Failed to erase users", sl.Err(err))
+			}
+		}
+	}
+}
+
+// Записи аудита остаются в цепочке, но без персональных данных. Запись user.erased со списком таких записей
+// пишется в той же транзакции, что и удаление: без неё проверка цепочки сочтёт изменённые записи подделкой
+func (p *Privacy) erase(ctx context.Context, request models.ErasureRequest) error {
+	log := p.log.With(slog.Int64("userID", request.UserId))
+
+	records, err := p.storage.UserAuditRecords(ctx, request.UserId)
+	if err != nil {
+		return err
+	}
+
+	ids := make([]int64, 0, len(records))
+	legacyIDs := make([]int64, 0)
+
+	for _, record := range records {
+		ids = append(ids, record.Id)
+
+		if record.FieldSalts == nil {
+			legacyIDs = append(legacyIDs, record.Id)
+		}
+	}
+
+	erased, err := auditchain.NewRecord(models.AuditUserErased, request.UserId, 0, map[string]any{
+		"actor_id":                       request.ActorId,
+		models.AuditRedactedRecordsField: ids,
+		models.AuditLegacyRecordsField:   legacyIDs,
+	}, time.Now())
+	if err != nil {
+		return err
+	}
+
+	if err := p.storage.EraseUser(ctx, request.UserId, ids, erased); err != nil {
+		// Пользователя уже нет, запрос больше не нужен
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return p.storage.DeleteErasureRequest(ctx, request.UserId)
+		}
+
+		return err
+	}
+
+	log.Info("User data erased", slog.Int("auditRecords", len(ids)))
+
+	return nil
+}
+
+// Удалённый пользователь считается не найденным
+func (p *Privacy) user(ctx context.Context, userID int64) (models.User, error) {
+	user, err := p.storage.UserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return models.User{}, ErrUserNotFound
+		}
+
+		return models.User{}, err
+	}
+
+	if user.Status == models.AccountErased {
+		return models.User{}, ErrUserNotFound
+	}
+
+	return user, nil
+}
+
+// Пишет событие в журнал аудита. Ошибка аудита не должна ломать сам запрос, поэтому только логируется
+func (p *Privacy) audit(ctx context.Context, event string, userID int64, payload map[string]any) {
+	if err := p.auditor.Record(ctx, event, userID, 0, payload); err != nil {
+		p.log.Error("Failed to write audit record", slog.String("event", event), sl.Err(err))
+	}
+}
+
+// UserData выгрузка данных пользователя
+// Токены доступа не хранятся на сервере, поэтому в sessions попадают только долгоживущие способы входа
+type UserData struct {
+	ExportedAt     time.Time        `json:"exported_at"`
+	Profile        ProfileData      `json:"profile"`
+	Roles          []string         `json:"roles"`
+	Identifiers    []IdentifierData `json:"identifiers"`
+	StatusHistory  []StatusData     `json:"status_history"`
+	Sessions       SessionsData     `json:"sessions"`
+	ErasureRequest *ErasureData     `json:"erasure_request,omitempty"`
+	AuditEvents    []AuditData      `json:"audit_events"`
+}
+
+type ProfileData struct {
+	Id             int64      `json:"id"`
+	Username       string     `json:"username"`
+	Status         string     `json:"status"`
+	StatusReason   string     `json:"status_reason,omitempty"`
+	SuspendedUntil *time.Time `json:"suspended_until,omitempty"`
+}
+
+type IdentifierData struct {
+	Kind       string     `json:"kind"`
+	Value      string     `json:"value"`
+	VerifiedAt *time.Time `json:"verified_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+type StatusData struct {
+	Status         string     `json:"status"`
+	Reason         string     `json:"reason"`
+	SuspendedUntil *time.Time `json:"suspended_until,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+type SessionsData struct {
+	PersonalTokens      []PersonalTokenData     `json:"personal_tokens"`
+	Passkeys            []PasskeyData           `json:"passkeys"`
+	FederatedIdentities []FederatedIdentityData `json:"federated_identities"`
+}
+
+type PersonalTokenData struct {
+	Id         int64      `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+type PasskeyData struct {
+	Id         int64      `json:"id"`
+	Name       string     `json:"name"`
+	RPID       string     `json:"rp_id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+type FederatedIdentityData struct {
+	Connector string    `json:"connector"`
+	Subject   string    `json:"subject"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type ErasureData struct {
+	Reason      string    `json:"reason,omitempty"`
+	RequestedAt time.Time `json:"requested_at"`
+	EraseAt     time.Time `json:"erase_at"`
+}
+
+type AuditData struct {
+	Id        int64           `json:"id"`
+	Event     string          `json:"event"`
+	AppId     int             `json:"app_id,omitempty"`
+	Payload   json.RawMessage `json:"payload,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// Собирает данные пользователя из всех таблиц
+func (p *Privacy) collect(ctx context.Context, user models.User) (UserData, error) {
+	data := UserData{
+		ExportedAt: time.Now().UTC(),
+		Profile: ProfileData{
+			Id:             user.Id,
+			Username:       user.Username,
+			Status:         user.Status,
+			StatusReason:   user.StatusReason,
+			SuspendedUntil: optionalTime(user.SuspendedUntil),
+		},
+		Roles:         []string{"user"},
+		Identifiers:   []IdentifierData{},
+		StatusHistory: []StatusData{},
+		Sessions: SessionsData{
+			PersonalTokens:      []PersonalTokenData{},
+			Passkeys:            []PasskeyData{},
+			FederatedIdentities: []FederatedIdentityData{},
+		},
+		AuditEvents: []AuditData{},
+	}
+
+	isAdmin, err := p.storage.IsAdmin(ctx, user.Id)
+	if err != nil {
+		return UserData{}, err
+	}
+
+	if isAdmin {
+		data.Roles = append(data.Roles, "admin")
+	}
+
+	identifiers, err := p.storage.Identifiers(ctx, user.Id)
+	if err != nil {
+		return UserData{}, err
+	}
+
+	for _, identifier := range identifiers {
+		data.Identifiers = append(data.Identifiers, IdentifierData{
+			Kind:       identifier.Kind,
+			Value:      identifier.Value,
+			VerifiedAt: optionalTime(identifier.VerifiedAt),
+			CreatedAt:  identifier.CreatedAt.UTC(),
+		})
+	}
+
+	history, err := p.storage.AccountStatusHistory(ctx, user.Id)
+	if err != nil {
+		return UserData{}, err
+	}
+
+	for _, change := range history {
+		data.StatusHistory = append(data.StatusHistory, StatusData{
+			Status:         change.Status,
+			Reason:         change.Reason,
+			SuspendedUntil: optionalTime(change.SuspendedUntil),
+			CreatedAt:      change.CreatedAt.UTC(),
+		})
+	}
+
+	tokens, err := p.storage.PersonalTokens(ctx, user.Id)
+	if err != nil {
+		return UserData{}, err
+	}
+
+	for _, token := range tokens {
+		data.Sessions.PersonalTokens = append(data.Sessions.PersonalTokens, PersonalTokenData{
+			Id:         token.Id,
+			Name:       token.Name,
+			Scopes:     token.Scopes,
+			CreatedAt:  token.CreatedAt.UTC(),
+			ExpiresAt:  optionalTime(token.ExpiresAt),
+			LastUsedAt: optionalTime(token.LastUsedAt),
+		})
+	}
+
+	passkeys, err := p.storage.Passkeys(ctx, user.Id)
+	if err != nil {
+		return UserData{}, err
+	}
+
+	for _, passkey := range passkeys {
+		data.Sessions.Passkeys = append(data.Sessions.Passkeys, PasskeyData{
+			Id:         passkey.Id,
+			Name:       passkey.Name,
+			RPID:       passkey.RPID,
+			CreatedAt:  passkey.CreatedAt.UTC(),
+			LastUsedAt: optionalTime(passkey.LastUsedAt),
+		})
+	}
+
+	identities, err := p.storage.FederatedIdentities(ctx, user.Id)
+	if err != nil {
+		return UserData{}, err
+	}
+
+	for _, identity := range identities {
+		data.Sessions.FederatedIdentities = append(data.Sessions.FederatedIdentities, FederatedIdentityData{
+			Connector: identity.ConnectorId,
+			Subject:   identity.Subject,
+			CreatedAt: identity.CreatedAt.UTC(),
+		})
+	}
+
+	request, err := p.storage.ErasureRequest(ctx, user.Id)
+	switch {
+	case err == nil:
+		data.ErasureRequest = &ErasureData{
+			Reason:      request.Reason,
+			RequestedAt: request.RequestedAt.UTC(),
+			EraseAt:     request.EraseAt.UTC(),
+		}
+	case !errors.Is(err, storage.ErrErasureRequestNotFound):
+		return UserData{}, err
+	}
+
+	records, err := p.storage.UserAuditRecords(ctx, user.Id)
+	if err != nil {
+		return UserData{}, err
+	}
+
+	for _, record := range records {
+		item := AuditData{
+			Id:        record.Id,
+			Event:     record.Event,
+			AppId:     record.AppId,
+			CreatedAt: record.CreatedAt.UTC(),
+		}
+
+		if json.Valid([]byte(record.Payload)) {
+			item.Payload = json.RawMessage(record.Payload)
+		}
+
+		data.AuditEvents = append(data.AuditEvents, item)
+	}
+
+	return data, nil
+}
+
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+
+	t = t.UTC()
+
+	return &t
+}
@@ -0,0 +1,269 @@
+package privacy
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"database/sql"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"log/slog"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/services/audit"
+	"shilka-sso/internal/storage"
+	"shilka-sso/internal/storage/sqlite"
+	"shilka-sso/internal/storage/sqlite/sqlitetest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const adminID = 1
+
+type testEnv struct {
+	storage *sqlite.Storage
+	path    string
+	audit   *audit.Audit
+	userID  int64
+}
+
+// Пользователь с подтверждённой почтой, личным токеном и записями в журнале аудита
+func newTestEnv(t *testing.T) testEnv {
+	t.Helper()
+
+	ctx := context.Background()
+	st, path := sqlitetest.New(t)
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	_, err = st.SaveUser(ctx, "admin", []byte("hash"))
+	require.NoError(t, err)
+
+	userID, err := st.SaveUser(ctx, "ivan", []byte("hash"))
+	require.NoError(t, err)
+
+	now := time.Now()
+
+	require.NoError(t, st.SetIdentifier(ctx, models.Identifier{
+		UserId:        userID,
+		Kind:          models.IdentifierEmail,
+		Value:         "Ivan@example.com",
+		Canonical:     "ivan@example.com",
+		CodeHash:      "code-hash",
+		CodeExpiresAt: now.Add(time.Hour),
+		CreatedAt:     now,
+	}))
+	require.NoError(t, st.VerifyIdentifier(ctx, userID, models.IdentifierEmail))
+
+	_, err = st.SavePersonalToken(ctx, models.PersonalToken{
+		UserId:    userID,
+		Name:      "laptop",
+		TokenHash: "secret-token-hash",
+		Scopes:    []string{"profile"},
+		CreatedAt: now,
+	})
+	require.NoError(t, err)
+
+	auditService := audit.New(log, st, key)
+	require.NoError(t, auditService.Record(ctx, models.AuditUserRegistered, userID, 0, map[string]any{"username": "ivan"}))
+	require.NoError(t, auditService.Record(ctx, models.AuditIdentifierVerified, userID, 0, map[string]any{
+		"kind":  models.IdentifierEmail,
+		"value": "Ivan@example.com",
+	}))
+	require.NoError(t, auditService.Record(ctx, models.AuditUserRegistered, adminID, 0, map[string]any{"username": "admin"}))
+	require.NoError(t, auditService.Checkpoint(ctx))
+
+	return testEnv{
+		storage: st,
+		path:    path,
+		audit:   auditService,
+		userID:  userID,
+	}
+}
+
+func (e testEnv) service(gracePeriod time.Duration) *Privacy {
+	return New(slog.New(slog.NewTextHandler(io.Discard, nil)), e.storage, e.audit, gracePeriod)
+}
+
+func TestExport(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	service := env.service(time.Hour)
+
+	_, err := service.RequestErasure(ctx, adminID, env.userID, "user request")
+	require.NoError(t, err)
+
+	raw, err := service.Export(ctx, adminID, env.userID)
+	require.NoError(t, err)
+
+	// Хэши паролей и токенов в выгрузку не попадают
+	assert.NotContains(t, string(raw), "secret-token-hash")
+	assert.NotContains(t, string(raw), "code-hash")
+
+	var data UserData
+	require.NoError(t, json.Unmarshal(raw, &data))
+
+	assert.Equal(t, env.userID, data.Profile.Id)
+	assert.Equal(t, "ivan", data.Profile.Username)
+	assert.Equal(t, []string{"user"}, data.Roles)
+	require.Len(t, data.Identifiers, 1)
+	assert.Equal(t, "Ivan@example.com", data.Identifiers[0].Value)
+	assert.NotNil(t, data.Identifiers[0].VerifiedAt)
+	require.Len(t, data.Sessions.PersonalTokens, 1)
+	assert.Equal(t, "laptop", data.Sessions.PersonalTokens[0].Name)
+	require.NotNil(t, data.ErasureRequest)
+	assert.Equal(t, "user request", data.ErasureRequest.Reason)
+
+	events := make([]string, 0, len(data.AuditEvents))
+	for _, event := range data.AuditEvents {
+		events = append(events, event.Event)
+	}
+	assert.Equal(t, []string{
+		models.AuditUserRegistered,
+		models.AuditIdentifierVerified,
+		models.AuditErasureRequested,
+	}, events)
+
+	_, err = service.Export(ctx, adminID, 42)
+	assert.ErrorIs(t, err, ErrUserNotFound)
+}
+
+func TestErasure(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	service := env.service(0)
+
+	_, err := service.RequestErasure(ctx, adminID, adminID, "")
+	assert.ErrorIs(t, err, ErrOwnErasure)
+
+	_, err = service.RequestErasure(ctx, adminID, env.userID, "user request")
+	require.NoError(t, err)
+
+	_, err = service.RequestErasure(ctx, adminID, env.userID, "again")
+	assert.ErrorIs(t, err, ErrErasureRequested)
+
+	// Недоставляемые события удаляются вместе с данными пользователя
+	events, err := env.storage.PendingEvents(ctx, 100)
+	require.NoError(t, err)
+
+	for _, event := range events {
+		require.NoError(t, env.storage.MarkEventFailed(ctx, event.Id, "event is rejected", time.Now(), true))
+	}
+
+	require.NoError(t, service.EraseDue(ctx))
+
+	dead, err := env.storage.DeadEvents(ctx)
+	require.NoError(t, err)
+	require.NotEmpty(t, dead)
+
+	for _, event := range dead {
+		assert.NotContains(t, string(event.Payload), "ivan", event.Type)
+	}
+
+	user, err := env.storage.UserByID(ctx, env.userID)
+	require.NoError(t, err)
+	assert.Equal(t, models.ErasedUsername(env.userID), user.Username)
+	assert.Equal(t, models.AccountErased, user.Status)
+	assert.Empty(t, user.PasswordHash)
+	assert.Error(t, user.CheckActive(time.Now()))
+
+	_, err = env.storage.UserByIdentifier(ctx, "ivan")
+	assert.ErrorIs(t, err, storage.ErrUserNotFound)
+	_, err = env.storage.UserByIdentifier(ctx, "ivan@example.com")
+	assert.ErrorIs(t, err, storage.ErrUserNotFound)
+
+	tokens, err := env.storage.PersonalTokens(ctx, env.userID)
+	require.NoError(t, err)
+	assert.Empty(t, tokens)
+
+	// Записи аудита остаются, но без имени и почты
+	records, err := env.storage.UserAuditRecords(ctx, env.userID)
+	require.NoError(t, err)
+
+	for _, record := range records {
+		assert.NotContains(t, strings.ToLower(record.Payload), "ivan", record.Event)
+	}
+
+	// Цепочка по-прежнему сходится, изменённые записи подтверждены записью user.erased
+	report, err := env.audit.VerifyChain(ctx)
+	require.NoError(t, err)
+	assert.True(t, report.Ok, report.Reason)
+	assert.EqualValues(t, 3, report.RecordsRedacted)
+
+	_, err = service.Export(ctx, adminID, env.userID)
+	assert.ErrorIs(t, err, ErrUserNotFound)
+
+	_, err = service.RequestErasure(ctx, adminID, env.userID, "again")
+	assert.ErrorIs(t, err, ErrUserNotFound)
+}
+
+// Запись user.erased и удаление данных идут одной транзакцией: если не записалась она, данные остаются
+func TestErasureRollback(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	service := env.service(0)
+
+	_, err := service.RequestErasure(ctx, adminID, env.userID, "user request")
+	require.NoError(t, err)
+
+	before, err := env.storage.UserAuditRecords(ctx, env.userID)
+	require.NoError(t, err)
+
+	db, err := sql.Open("sqlite3", env.path)
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.Exec(`
+		CREATE TRIGGER fail_user_erased BEFORE INSERT ON audit_log WHEN NEW.event = 'user.erased'
+		BEGIN SELECT RAISE(ABORT, 'audit log is unavailable'); END`)
+	require.NoError(t, err)
+
+	// Ошибка по одному пользователю только пишется в лог, остальные запросы обрабатываются дальше
+	require.NoError(t, service.EraseDue(ctx))
+
+	user, err := env.storage.UserByID(ctx, env.userID)
+	require.NoError(t, err)
+	assert.Equal(t, "ivan", user.Username)
+
+	after, err := env.storage.UserAuditRecords(ctx, env.userID)
+	require.NoError(t, err)
+	assert.Equal(t, before, after)
+
+	tokens, err := env.storage.PersonalTokens(ctx, env.userID)
+	require.NoError(t, err)
+	assert.Len(t, tokens, 1)
+
+	_, err = db.Exec("DROP TRIGGER fail_user_erased")
+	require.NoError(t, err)
+
+	// Запрос остался, следующий проход удаляет данные
+	require.NoError(t, service.EraseDue(ctx))
+
+	report, err := env.audit.VerifyChain(ctx)
+	require.NoError(t, err)
+	assert.True(t, report.Ok, report.Reason)
+}
+
+func TestCancelErasure(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	service := env.service(time.Hour)
+
+	request, err := service.RequestErasure(ctx, adminID, env.userID, "")
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), request.EraseAt, time.Minute)
+
+	// До конца срока отмены данные не удаляются
+	require.NoError(t, service.EraseDue(ctx))
+
+	user, err := env.storage.UserByID(ctx, env.userID)
+	require.NoError(t, err)
+	assert.Equal(t, "ivan", user.Username)
+
+	require.NoError(t, service.CancelErasure(ctx, adminID, env.userID))
+	assert.ErrorIs(t, service.CancelErasure(ctx, adminID, env.userID), ErrErasureNotFound)
+}
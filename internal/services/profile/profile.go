@@ -0,0 +1,459 @@
+// Package profile Сервис, через который пользователь меняет своё имя, почту, телефон и пароль
+// Почта и телефон становятся идентификаторами для входа только после подтверждения кодом
+package profile
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/lib/identifiers"
+	"shilka-sso/internal/lib/logger/sl"
+	"shilka-sso/internal/lib/passwords"
+	"shilka-sso/internal/lib/usernames"
+	"shilka-sso/internal/services/passwordless/notifier"
+	"shilka-sso/internal/storage"
+	"strings"
+	"time"
+)
+
+const codeDigits = 6
+
+type Profile struct {
+	log         *slog.Logger
+	storage     Storage
+	auditor     Auditor
+	notifier    Notifier
+	usernames   *usernames.Policy
+	codeTTL     time.Duration
+	maxAttempts int
+}
+
+// Storage Методы бд, нужные сервису
+type Storage interface {
+	UserByID(ctx context.Context, userID int64) (models.User, error)
+	SetUsername(ctx context.Context, userID int64, username string) error
+	Identifiers(ctx context.Context, userID int64) ([]models.Identifier, error)
+	SetIdentifier(ctx context.Context, identifier models.Identifier) error
+	UseIdentifierAttempt(ctx context.Context, userID int64, kind string, maxAttempts int) (models.Identifier, error)
+	VerifyIdentifier(ctx context.Context, userID int64, kind string) error
+	DeleteIdentifier(ctx context.Context, userID int64, kind string) error
+	SetPasswordHash(ctx context.Context, userID int64, passwordHash []byte) error
+	DeletePersonalTokens(ctx context.Context, userID int64) (int64, error)
+}
+
+// Auditor Журнал аудита, в который пишутся события сервиса
+type Auditor interface {
+	Record(ctx context.Context, event string, userID int64, appID int, payload map[string]any) error
+}
+
+// Notifier доставляет код подтверждения на новую почту или телефон
+type Notifier interface {
+	Notify(ctx context.Context, msg notifier.Message) error
+}
+
+// Ошибки сервисного слоя
+var (
+	ErrUserNotFound    = errors.New("user not found")
+	ErrInvalidUsername = errors.New("invalid username")
+	ErrUsernameTaken   = errors.New("username already taken")
+	ErrInvalidEmail    = errors.New("invalid email address")
+	ErrInvalidPhone    = errors.New("invalid phone number")
+	ErrIdentifierTaken = errors.New("identifier already taken")
+	ErrInvalidKind     = errors.New("unknown identifier kind")
+	ErrInvalidCode     = errors.New("invalid or expired code")
+	ErrDeliveryFailed  = errors.New("failed to deliver verification code")
+	ErrInvalidPassword = errors.New("invalid current password")
+)
+
+// New возвращает новый объект сервиса Profile
+// usernamePolicy - те же правила для имён, что и при регистрации
+func New(
+	log *slog.Logger,
+	storage Storage,
+	auditor Auditor,
+	notifier Notifier,
+	usernamePolicy *usernames.Policy,
+	codeTTL time.Duration,
+	maxAttempts int,
+) *Profile {
+	return &Profile{
+		log:         log,
+		storage:     storage,
+		auditor:     auditor,
+		notifier:    notifier,
+		usernames:   usernamePolicy,
+		codeTTL:     codeTTL,
+		maxAttempts: maxAttempts,
+	}
+}
+
+// Profile Возвращает имя пользователя, его почту и телефон
+func (p *Profile) Profile(ctx context.Context, userID int64) (models.Profile, error) {
+	const operator = "profile.Profile"
+
+	user, err := p.storage.UserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return models.Profile{}, fmt.Errorf("%s: %w", operator, ErrUserNotFound)
+		}
+
+		return models.Profile{}, fmt.Errorf("%s: %w", operator, err)
+	}
+
+	list, err := p.storage.Identifiers(ctx, userID)
+	if err != nil {
+		return models.Profile{}, fmt.Errorf("%s: %w", operator, err)
+	}
+
+	return models.Profile{
+		UserId:      user.Id,
+		Username:    user.Username,
+		Identifiers: list,
+	}, nil
+}
+
+// UpdateProfile Меняет имя, почту и телефон пользователя
+// Сначала проверяются все поля, поэтому из-за ошибки формата не меняется ничего.
+// На новую почту или телефон отправляется код, до подтверждения через VerifyIdentifier по ним нельзя войти.
+// Если адрес не изменился и уже подтверждён, код повторно не отправляется
+func (p *Profile) UpdateProfile(ctx context.Context, userID int64, update models.ProfileUpdate) error {
+	const operator = "profile.UpdateProfile"
+
+	log := p.log.With(
+		slog.String("operator", operator),
+		slog.Int64("userID", userID),
+	)
+
+	var username string
+	if update.Username != nil {
+		if err := p.usernames.Validate(*update.Username); err != nil {
+			return fmt.Errorf("%s: %w: %w", operator, ErrInvalidUsername, err)
+		}
+
+		username = usernames.Display(*update.Username)
+	}
+
+	// Пустое значение означает удаление
+	changes := make(map[string]models.Identifier)
+
+	for kind, value := range map[string]*string{
+		models.IdentifierEmail: update.Email,
+		models.IdentifierPhone: update.Phone,
+	} {
+		if value == nil {
+			continue
+		}
+
+		changes[kind] = models.Identifier{}
+		if *value == "" {
+			continue
+		}
+
+		canonical, err := identifiers.Canonical(kind, *value)
+		if err != nil {
+			if kind == models.IdentifierEmail {
+				return fmt.Errorf("%s: %w", operator, ErrInvalidEmail)
+			}
+
+			return fmt.Errorf("%s: %w", operator, ErrInvalidPhone)
+		}
+
+		changes[kind] = models.Identifier{
+			Value:     strings.TrimSpace(*value),
+			Canonical: canonical,
+		}
+	}
+
+	// Имя и идентификаторы меняются одной транзакцией, чтобы обновление не применилось наполовину.
+	// Коды отправляются уже после неё: отправленное письмо откатить нельзя
+	var messages []notifier.Message
+
+	err := storage.WithinTx(ctx, p.storage, func(ctx context.Context) error {
+		messages = nil
+
+		if update.Username != nil {
+			if err := p.storage.SetUsername(ctx, userID, username); err != nil {
+				switch {
+				case errors.Is(err, storage.ErrUserNotFound):
+					return ErrUserNotFound
+				case errors.Is(err, storage.ErrUserExists):
+					return ErrUsernameTaken
+				}
+
+				log.Error("Failed to change username", sl.Err(err))
+
+				return err
+			}
+
+			err := p.auditor.Record(ctx, models.AuditUserRenamed, userID, 0, map[string]any{"username": username})
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(changes) == 0 {
+			return nil
+		}
+
+		current, err := p.storage.Identifiers(ctx, userID)
+		if err != nil {
+			return err
+		}
+
+		for _, kind := range []string{models.IdentifierEmail, models.IdentifierPhone} {
+			change, ok := changes[kind]
+			if !ok {
+				continue
+			}
+
+			msg, err := p.setIdentifier(ctx, userID, kind, change, current)
+			if err != nil {
+				return err
+			}
+
+			if msg != nil {
+				messages = append(messages, *msg)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", operator, err)
+	}
+
+	if update.Username != nil {
+		log.Info("Username changed")
+	}
+
+	for _, msg := range messages {
+		if err := p.notifier.Notify(ctx, msg); err != nil {
+			log.Error("Failed to deliver verification code", sl.Err(err))
+
+			return fmt.Errorf("%s: %w: %w", operator, ErrDeliveryFailed, err)
+		}
+
+		log.Info("Verification code sent")
+	}
+
+	return nil
+}
+
+// VerifyIdentifier Подтверждает почту или телефон кодом, который пришёл на них
+// После maxAttempts неверных кодов или по истечении codeTTL код нужно запросить заново через UpdateProfile
+func (p *Profile) VerifyIdentifier(ctx context.Context, userID int64, kind string, code string) error {
+	const operator = "profile.VerifyIdentifier"
+
+	log := p.log.With(
+		slog.String("operator", operator),
+		slog.Int64("userID", userID),
+		slog.String("kind", kind),
+	)
+
+	if kind != models.IdentifierEmail && kind != models.IdentifierPhone {
+		return fmt.Errorf("%s: %w", operator, ErrInvalidKind)
+	}
+
+	identifier, err := p.storage.UseIdentifierAttempt(ctx, userID, kind, p.maxAttempts)
+	if err != nil {
+		if errors.Is(err, storage.ErrIdentifierNotFound) {
+			log.Info("Nothing to verify or code expired")
+
+			return fmt.Errorf("%s: %w", operator, ErrInvalidCode)
+		}
+
+		return fmt.Errorf("%s: %w", operator, err)
+	}
+
+	expected := hashCode(identifier, code)
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(identifier.CodeHash)) != 1 {
+		log.Info("Invalid verification code", slog.Int("attempts", identifier.Attempts))
+
+		return fmt.Errorf("%s: %w", operator, ErrInvalidCode)
+	}
+
+	if err := p.storage.VerifyIdentifier(ctx, userID, kind); err != nil {
+		switch {
+		case errors.Is(err, storage.ErrIdentifierNotFound):
+			return fmt.Errorf("%s: %w", operator, ErrInvalidCode)
+		case errors.Is(err, storage.ErrIdentifierExists):
+			return fmt.Errorf("%s: %w", operator, ErrIdentifierTaken)
+		}
+
+		log.Error("Failed to verify identifier", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", operator, err)
+	}
+
+	p.audit(ctx, models.AuditIdentifierVerified, userID, map[string]any{
+		"kind":  kind,
+		"value": identifier.Value,
+	})
+
+	log.Info("Identifier verified")
+
+	return nil
+}
+
+// Меняет или удаляет идентификатор одного вида
+// Возвращает код подтверждения, который нужно отправить на новый адрес, nil - если отправлять нечего
+func (p *Profile) setIdentifier(
+	ctx context.Context,
+	userID int64,
+	kind string,
+	change models.Identifier,
+	current []models.Identifier,
+) (*notifier.Message, error) {
+	log := p.log.With(
+		slog.Int64("userID", userID),
+		slog.String("kind", kind),
+	)
+
+	if change.Canonical == "" {
+		err := p.storage.DeleteIdentifier(ctx, userID, kind)
+		if errors.Is(err, storage.ErrIdentifierNotFound) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if err := p.auditor.Record(ctx, models.AuditIdentifierRemoved, userID, 0, map[string]any{"kind": kind}); err != nil {
+			return nil, err
+		}
+
+		log.Info("Identifier removed")
+
+		return nil, nil
+	}
+
+	for _, identifier := range current {
+		if identifier.Kind == kind && identifier.Canonical == change.Canonical && identifier.Verified() {
+			return nil, nil
+		}
+	}
+
+	code, err := newCode()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+
+	identifier := models.Identifier{
+		UserId:        userID,
+		Kind:          kind,
+		Value:         change.Value,
+		Canonical:     change.Canonical,
+		CodeExpiresAt: now.Add(p.codeTTL),
+		CreatedAt:     now,
+	}
+	identifier.CodeHash = hashCode(identifier, code)
+
+	if err := p.storage.SetIdentifier(ctx, identifier); err != nil {
+		switch {
+		case errors.Is(err, storage.ErrUserNotFound):
+			return nil, ErrUserNotFound
+		case errors.Is(err, storage.ErrIdentifierExists):
+			return nil, ErrIdentifierTaken
+		}
+
+		log.Error("Failed to save identifier", sl.Err(err))
+
+		return nil, err
+	}
+
+	return &notifier.Message{
+		To:           identifier.Canonical,
+		Code:         code,
+		Verification: true,
+	}, nil
+}
+
+// Пишет событие в журнал аудита. Ошибка аудита не должна ломать сам запрос, поэтому только логируется
+func (p *Profile) audit(ctx context.Context, event string, userID int64, payload map[string]any) {
+	if err := p.auditor.Record(ctx, event, userID, 0, payload); err != nil {
+		p.log.Error("Failed to write audit record", slog.String("event", event), sl.Err(err))
+	}
+}
+
+func newCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1_000_000))
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%0*d", codeDigits, n.Int64()), nil
+}
+
+// Пользователь, вид и время отправки в хэше не дают переиспользовать таблицу хэшей шестизначных кодов
+func hashCode(identifier models.Identifier, code string) string {
+	salt := fmt.Sprintf("%d:%s:%d:", identifier.UserId, identifier.Kind, identifier.CreatedAt.UnixNano())
+	sum := sha256.Sum256([]byte(salt + code))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// ChangePassword Меняет пароль, если текущий пароль верный, и отзывает все личные токены пользователя.
+// Возвращает число отозванных токенов. Пароль, токены и запись аудита меняются одной транзакцией:
+// если токены не удалось отозвать, старый пароль остаётся в силе
+func (p *Profile) ChangePassword(ctx context.Context, userID int64, currentPassword string, newPassword string) (int64, error) {
+	const operator = "profile.ChangePassword"
+
+	log := p.log.With(
+		slog.String("operator", operator),
+		slog.Int64("userID", userID),
+	)
+
+	user, err := p.storage.UserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return 0, fmt.Errorf("%s: %w", operator, ErrUserNotFound)
+		}
+
+		return 0, fmt.Errorf("%s: %w", operator, err)
+	}
+
+	// У пользователей каталога и внешних провайдеров пароля в бд нет, менять его здесь нечего
+	if !passwords.Verify(user.PasswordHash, currentPassword) {
+		log.Info("Invalid current password")
+
+		return 0, fmt.Errorf("%s: %w", operator, ErrInvalidPassword)
+	}
+
+	passwordHash, err := passwords.Hash(newPassword)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", operator, err)
+	}
+
+	var revoked int64
+
+	err = storage.WithinTx(ctx, p.storage, func(ctx context.Context) error {
+		if err := p.storage.SetPasswordHash(ctx, userID, passwordHash); err != nil {
+			return err
+		}
+
+		revoked, err = p.storage.DeletePersonalTokens(ctx, userID)
+		if err != nil {
+			return err
+		}
+
+		return p.auditor.Record(ctx, models.AuditPasswordChanged, userID, 0, map[string]any{"revoked_tokens": revoked})
+	})
+	if err != nil {
+		log.Error("Failed to change password", sl.Err(err))
+
+		return 0, fmt.Errorf("%s: %w", operator, err)
+	}
+
+	log.Info("Password changed", slog.Int64("revokedTokens", revoked))
+
+	return revoked, nil
+}
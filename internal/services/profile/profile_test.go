@@ -0,0 +1,337 @@
+package profile
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"io"
+	"log/slog"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/lib/usernames"
+	"shilka-sso/internal/services/auth"
+	"shilka-sso/internal/services/passwordless/notifier"
+	"shilka-sso/internal/storage/sqlite"
+	"shilka-sso/internal/storage/sqlite/sqlitetest"
+	"sync"
+	"testing"
+	"time"
+)
+
+type nopAuditor struct{}
+
+func (nopAuditor) Record(context.Context, string, int64, int, map[string]any) error {
+	return nil
+}
+
+// Запоминает отправленные коды вместо доставки
+type recorder struct {
+	mu       sync.Mutex
+	messages []notifier.Message
+}
+
+func (r *recorder) Notify(_ context.Context, msg notifier.Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.messages = append(r.messages, msg)
+
+	return nil
+}
+
+func (r *recorder) last(t *testing.T) notifier.Message {
+	t.Helper()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	require.NotEmpty(t, r.messages)
+
+	return r.messages[len(r.messages)-1]
+}
+
+func ptr(s string) *string {
+	return &s
+}
+
+type testEnv struct {
+	service  *Profile
+	auth     *auth.Auth
+	storage  *sqlite.Storage
+	notifier *recorder
+}
+
+func newTestEnv(t *testing.T) testEnv {
+	t.Helper()
+
+	storage, _ := sqlitetest.New(t)
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	policy := usernames.NewPolicy(3, 32, []string{"admin"})
+	r := &recorder{}
+
+	return testEnv{
+		service:  New(log, storage, nopAuditor{}, r, policy, time.Minute, 3),
+		auth:     auth.New(log, storage, nopAuditor{}, time.Hour, policy, nil),
+		storage:  storage,
+		notifier: r,
+	}
+}
+
+func (e testEnv) register(t *testing.T, username string) int64 {
+	t.Helper()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	id, err := e.storage.SaveUser(context.Background(), username, hash)
+	require.NoError(t, err)
+
+	return id
+}
+
+func TestLoginWithVerifiedIdentifiers(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	userID := env.register(t, "ivan")
+
+	err := env.service.UpdateProfile(ctx, userID, models.ProfileUpdate{
+		Email: ptr(" Ivan@Example.com "),
+		Phone: ptr("+7 (999) 123-45-67"),
+	})
+	require.NoError(t, err)
+
+	// До подтверждения по почте войти нельзя
+	_, err = env.auth.Authenticate(ctx, "ivan@example.com", "password", 0)
+	assert.ErrorIs(t, err, auth.ErrInvalidCredentials)
+
+	msg := env.notifier.last(t)
+	assert.Equal(t, "+79991234567", msg.To)
+	assert.True(t, msg.Verification)
+	require.NoError(t, env.service.VerifyIdentifier(ctx, userID, models.IdentifierPhone, msg.Code))
+
+	email := env.notifier.messages[0]
+	assert.Equal(t, "ivan@example.com", email.To)
+	require.NoError(t, env.service.VerifyIdentifier(ctx, userID, models.IdentifierEmail, email.Code))
+
+	for _, login := range []string{"ivan", "IVAN@example.COM", "+79991234567", "+7 999 123 45 67"} {
+		user, err := env.auth.Authenticate(ctx, login, "password", 0)
+		require.NoError(t, err, login)
+		assert.Equal(t, userID, user.Id, login)
+	}
+
+	profile, err := env.service.Profile(ctx, userID)
+	require.NoError(t, err)
+	require.Len(t, profile.Identifiers, 2)
+	assert.Equal(t, "Ivan@Example.com", profile.Identifiers[0].Value)
+	assert.True(t, profile.Identifiers[0].Verified())
+
+	// Новая почта снова требует подтверждения, а старая перестаёт работать
+	err = env.service.UpdateProfile(ctx, userID, models.ProfileUpdate{Email: ptr("ivan@example.org")})
+	require.NoError(t, err)
+
+	_, err = env.auth.Authenticate(ctx, "ivan@example.com", "password", 0)
+	assert.ErrorIs(t, err, auth.ErrInvalidCredentials)
+
+	// Пустая строка удаляет телефон
+	err = env.service.UpdateProfile(ctx, userID, models.ProfileUpdate{Phone: ptr("")})
+	require.NoError(t, err)
+
+	_, err = env.auth.Authenticate(ctx, "+79991234567", "password", 0)
+	assert.ErrorIs(t, err, auth.ErrInvalidCredentials)
+}
+
+func TestIdentifierUniqueness(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	ivan := env.register(t, "ivan")
+	petr := env.register(t, "petr")
+	// Имя из тех времён, когда на имена не было правил
+	legacy := env.register(t, "old@example.com")
+
+	update := models.ProfileUpdate{Email: ptr("shared@example.com")}
+
+	// Неподтверждённый адрес не занимает его: подтвердит тот, у кого есть доступ к почте
+	require.NoError(t, env.service.UpdateProfile(ctx, ivan, update))
+	ivanCode := env.notifier.last(t).Code
+
+	require.NoError(t, env.service.UpdateProfile(ctx, petr, update))
+	require.NoError(t, env.service.VerifyIdentifier(ctx, petr, models.IdentifierEmail, env.notifier.last(t).Code))
+
+	err := env.service.VerifyIdentifier(ctx, ivan, models.IdentifierEmail, ivanCode)
+	assert.ErrorIs(t, err, ErrIdentifierTaken)
+
+	err = env.service.UpdateProfile(ctx, ivan, models.ProfileUpdate{Email: ptr("SHARED@example.com")})
+	assert.ErrorIs(t, err, ErrIdentifierTaken)
+
+	err = env.service.UpdateProfile(ctx, ivan, models.ProfileUpdate{Email: ptr("old@example.com")})
+	assert.ErrorIs(t, err, ErrIdentifierTaken)
+
+	// Старое имя, похожее на почту, по-прежнему работает для входа
+	user, err := env.auth.Authenticate(ctx, "old@example.com", "password", 0)
+	require.NoError(t, err)
+	assert.Equal(t, legacy, user.Id)
+}
+
+func TestUpdateUsername(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	ivan := env.register(t, "ivan")
+	env.register(t, "petr")
+
+	err := env.service.UpdateProfile(ctx, ivan, models.ProfileUpdate{Username: ptr(" Ivan.Petrov ")})
+	require.NoError(t, err)
+
+	user, err := env.auth.Authenticate(ctx, "ivan.petrov", "password", 0)
+	require.NoError(t, err)
+	assert.Equal(t, "Ivan.Petrov", user.Username)
+
+	err = env.service.UpdateProfile(ctx, ivan, models.ProfileUpdate{Username: ptr("PETR")})
+	assert.ErrorIs(t, err, ErrUsernameTaken)
+
+	err = env.service.UpdateProfile(ctx, ivan, models.ProfileUpdate{Username: ptr("Admin")})
+	assert.ErrorIs(t, err, ErrInvalidUsername)
+	assert.ErrorIs(t, err, usernames.ErrReserved)
+
+	// Ошибка в одном поле не даёт применить остальные
+	err = env.service.UpdateProfile(ctx, ivan, models.ProfileUpdate{
+		Username: ptr("ivan2"),
+		Phone:    ptr("89991234567"),
+	})
+	assert.ErrorIs(t, err, ErrInvalidPhone)
+
+	_, err = env.auth.Authenticate(ctx, "ivan2", "password", 0)
+	assert.ErrorIs(t, err, auth.ErrInvalidCredentials)
+}
+
+// Имя и идентификаторы меняются одной транзакцией: если почта занята, новое имя тоже не сохраняется
+func TestUpdateProfileRollback(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	ivan := env.register(t, "ivan")
+	petr := env.register(t, "petr")
+
+	require.NoError(t, env.service.UpdateProfile(ctx, petr, models.ProfileUpdate{Email: ptr("petr@example.com")}))
+	require.NoError(t, env.service.VerifyIdentifier(ctx, petr, models.IdentifierEmail, env.notifier.last(t).Code))
+	sent := len(env.notifier.messages)
+
+	err := env.service.UpdateProfile(ctx, ivan, models.ProfileUpdate{
+		Username: ptr("ivan2"),
+		Phone:    ptr("+7 999 123-45-67"),
+		Email:    ptr("petr@example.com"),
+	})
+	assert.ErrorIs(t, err, ErrIdentifierTaken)
+
+	user, err := env.storage.UserByID(ctx, ivan)
+	require.NoError(t, err)
+	assert.Equal(t, "ivan", user.Username)
+
+	identifiers, err := env.storage.Identifiers(ctx, ivan)
+	require.NoError(t, err)
+	assert.Empty(t, identifiers)
+
+	// Код на телефон из отменённого обновления не отправляется
+	assert.Len(t, env.notifier.messages, sent)
+}
+
+func TestVerifyIdentifierRejects(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	userID := env.register(t, "ivan")
+
+	err := env.service.VerifyIdentifier(ctx, userID, models.IdentifierEmail, "000000")
+	assert.ErrorIs(t, err, ErrInvalidCode)
+
+	require.NoError(t, env.service.UpdateProfile(ctx, userID, models.ProfileUpdate{Email: ptr("ivan@example.com")}))
+	code := env.notifier.last(t).Code
+
+	for range 3 {
+		err = env.service.VerifyIdentifier(ctx, userID, models.IdentifierEmail, "wrong")
+		assert.ErrorIs(t, err, ErrInvalidCode)
+	}
+
+	// После исчерпания попыток не подходит даже верный код
+	err = env.service.VerifyIdentifier(ctx, userID, models.IdentifierEmail, code)
+	assert.ErrorIs(t, err, ErrInvalidCode)
+
+	// Повторное указание того же адреса отправляет новый код
+	require.NoError(t, env.service.UpdateProfile(ctx, userID, models.ProfileUpdate{Email: ptr("ivan@example.com")}))
+	require.NoError(t, env.service.VerifyIdentifier(ctx, userID, models.IdentifierEmail, env.notifier.last(t).Code))
+
+	err = env.service.VerifyIdentifier(ctx, userID, "username", "000000")
+	assert.ErrorIs(t, err, ErrInvalidKind)
+}
+
+// Журнал аудита, который не принимает записи
+type failingAuditor struct{}
+
+func (failingAuditor) Record(context.Context, string, int64, int, map[string]any) error {
+	return errors.New("audit log is unavailable")
+}
+
+func (e testEnv) savePersonalToken(t *testing.T, userID int64, name string) {
+	t.Helper()
+
+	_, err := e.storage.SavePersonalToken(context.Background(), models.PersonalToken{
+		UserId:    userID,
+		Name:      name,
+		TokenHash: fmt.Sprintf("%d-%s-hash", userID, name),
+		CreatedAt: time.Now(),
+	})
+	require.NoError(t, err)
+}
+
+func TestChangePassword(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+
+	ivanID := env.register(t, "ivan")
+	petrID := env.register(t, "petr")
+	env.savePersonalToken(t, ivanID, "laptop")
+	env.savePersonalToken(t, ivanID, "ci")
+	env.savePersonalToken(t, petrID, "laptop")
+
+	_, err := env.service.ChangePassword(ctx, ivanID, "wrong", "new-password")
+	assert.ErrorIs(t, err, ErrInvalidPassword)
+
+	revoked, err := env.service.ChangePassword(ctx, ivanID, "password", "new-password")
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, revoked)
+
+	_, err = env.auth.Authenticate(ctx, "ivan", "password", 0)
+	assert.ErrorIs(t, err, auth.ErrInvalidCredentials)
+
+	_, err = env.auth.Authenticate(ctx, "ivan", "new-password", 0)
+	require.NoError(t, err)
+
+	tokens, err := env.storage.PersonalTokens(ctx, ivanID)
+	require.NoError(t, err)
+	assert.Empty(t, tokens)
+
+	// Токены других пользователей не трогаются
+	tokens, err = env.storage.PersonalTokens(ctx, petrID)
+	require.NoError(t, err)
+	assert.Len(t, tokens, 1)
+}
+
+// Пароль и отзыв токенов идут одной транзакцией, поэтому ошибка на последнем шаге откатывает всё
+func TestChangePasswordRollback(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	service := New(slog.New(slog.NewTextHandler(io.Discard, nil)), env.storage, failingAuditor{}, env.notifier,
+		usernames.NewPolicy(3, 32, nil), time.Minute, 3)
+
+	userID := env.register(t, "ivan")
+	env.savePersonalToken(t, userID, "laptop")
+
+	_, err := service.ChangePassword(ctx, userID, "password", "new-password")
+	require.Error(t, err)
+
+	_, err = env.auth.Authenticate(ctx, "ivan", "password", 0)
+	require.NoError(t, err)
+
+	tokens, err := env.storage.PersonalTokens(ctx, userID)
+	require.NoError(t, err)
+	assert.Len(t, tokens, 1)
+}
@@ -0,0 +1,269 @@
+// Package serviceaccounts Сервисные аккаунты приложений и выдача им токенов по client credentials
+package serviceaccounts
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/lib/jwt"
+	"shilka-sso/internal/lib/logger/sl"
+	"shilka-sso/internal/storage"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Префикс client id, чтобы его нельзя было спутать с id приложения
+const clientIDPrefix = "sa_"
+
+type ServiceAccounts struct {
+	log      *slog.Logger
+	storage  Storage
+	auditor  Auditor
+	tokenTTL time.Duration
+}
+
+// Storage Методы бд, нужные сервису
+type Storage interface {
+	SaveServiceAccount(ctx context.Context, account models.ServiceAccount) (int64, error)
+	ServiceAccountByClientID(ctx context.Context, clientID string) (models.ServiceAccount, error)
+	ServiceAccounts(ctx context.Context, appID int) ([]models.ServiceAccount, error)
+	DeleteServiceAccount(ctx context.Context, accountID int64) error
+	GetApp(ctx context.Context, appID int) (models.App, error)
+}
+
+// Auditor Журнал аудита, в который пишутся действия администраторов
+type Auditor interface {
+	Record(ctx context.Context, event string, userID int64, appID int, payload map[string]any) error
+}
+
+// Ошибки сервисного слоя
+var (
+	ErrAppNotFound            = errors.New("app not found")
+	ErrInvalidName            = errors.New("invalid service account name")
+	ErrInvalidScope           = errors.New("invalid scope")
+	ErrServiceAccountExists   = errors.New("service account already exists")
+	ErrServiceAccountNotFound = errors.New("service account not found")
+	ErrInvalidClient          = errors.New("invalid client credentials")
+)
+
+// Token токен доступа сервисного аккаунта
+type Token struct {
+	AccessToken string
+	ExpiresIn   int64
+	Scope       string
+}
+
+// New возвращает новый объект сервиса сервисных аккаунтов
+func New(
+	log *slog.Logger,
+	storage Storage,
+	auditor Auditor,
+	tokenTTL time.Duration,
+) *ServiceAccounts {
+	return &ServiceAccounts{
+		log:      log,
+		storage:  storage,
+		auditor:  auditor,
+		tokenTTL: tokenTTL,
+	}
+}
+
+// Create Создаёт сервисный аккаунт приложения и возвращает его вместе с секретом
+// Секрет показывается только один раз, в бд хранится его хэш
+// actorID - администратор, который создаёт аккаунт
+func (s *ServiceAccounts) Create(
+	ctx context.Context,
+	actorID int64,
+	appID int,
+	name string,
+	scopes []string,
+) (models.ServiceAccount, string, error) {
+	const operator = "serviceaccounts.Create"
+
+	log := s.log.With(
+		slog.String("operator", operator),
+		slog.Int("appID", appID),
+		slog.String("name", name),
+	)
+
+	log.Info("Creating service account")
+
+	if strings.TrimSpace(name) == "" {
+		return models.ServiceAccount{}, "", fmt.Errorf("%s: %w", operator, ErrInvalidName)
+	}
+
+	for _, scope := range scopes {
+		if scope == "" || strings.ContainsAny(scope, " \t\n\"\\") {
+			return models.ServiceAccount{}, "", fmt.Errorf("%s: %w", operator, ErrInvalidScope)
+		}
+	}
+
+	clientID, err := randomString(12)
+	if err != nil {
+		return models.ServiceAccount{}, "", fmt.Errorf("%s: %w", operator, err)
+	}
+
+	secret, err := randomString(32)
+	if err != nil {
+		return models.ServiceAccount{}, "", fmt.Errorf("%s: %w", operator, err)
+	}
+
+	account := models.ServiceAccount{
+		AppId:      appID,
+		Name:       name,
+		ClientId:   clientIDPrefix + clientID,
+		SecretHash: hashSecret(secret),
+		Scopes:     scopes,
+		CreatedAt:  time.Now(),
+	}
+
+	account.Id, err = s.storage.SaveServiceAccount(ctx, account)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return models.ServiceAccount{}, "", fmt.Errorf("%s: %w", operator, ErrAppNotFound)
+		}
+
+		if errors.Is(err, storage.ErrServiceAccountExists) {
+			return models.ServiceAccount{}, "", fmt.Errorf("%s: %w", operator, ErrServiceAccountExists)
+		}
+
+		log.Error("Failed to save service account", sl.Err(err))
+
+		return models.ServiceAccount{}, "", fmt.Errorf("%s: %w", operator, err)
+	}
+
+	s.audit(ctx, models.AuditServiceAccountCreated, actorID, appID, map[string]any{
+		"service_account_id": account.Id,
+		"client_id":          account.ClientId,
+		"scopes":             scopes,
+	})
+
+	log.Info("Service account created", slog.String("clientID", account.ClientId))
+
+	return account, secret, nil
+}
+
+// ServiceAccounts Возвращает сервисные аккаунты приложения
+func (s *ServiceAccounts) ServiceAccounts(ctx context.Context, appID int) ([]models.ServiceAccount, error) {
+	const operator = "serviceaccounts.ServiceAccounts"
+
+	accounts, err := s.storage.ServiceAccounts(ctx, appID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operator, err)
+	}
+
+	return accounts, nil
+}
+
+// Delete Удаляет сервисный аккаунт
+// Уже выданные токены ValidateToken после этого не принимает
+func (s *ServiceAccounts) Delete(ctx context.Context, actorID int64, accountID int64) error {
+	const operator = "serviceaccounts.Delete"
+
+	s.log.Info("Deleting service account", slog.String("operator", operator), slog.Int64("accountID", accountID))
+
+	if err := s.storage.DeleteServiceAccount(ctx, accountID); err != nil {
+		if errors.Is(err, storage.ErrServiceAccountNotFound) {
+			return fmt.Errorf("%s: %w", operator, ErrServiceAccountNotFound)
+		}
+
+		return fmt.Errorf("%s: %w", operator, err)
+	}
+
+	s.audit(ctx, models.AuditServiceAccountDeleted, actorID, 0, map[string]any{"service_account_id": accountID})
+
+	return nil
+}
+
+// IssueToken Выдаёт токен доступа по client credentials
+// Если scope пустой, выдаются все scope аккаунта, иначе каждый запрошенный должен быть разрешён
+func (s *ServiceAccounts) IssueToken(ctx context.Context, clientID string, clientSecret string, scope string) (Token, error) {
+	const operator = "serviceaccounts.IssueToken"
+
+	log := s.log.With(
+		slog.String("operator", operator),
+		slog.String("clientID", clientID),
+	)
+
+	account, err := s.storage.ServiceAccountByClientID(ctx, clientID)
+	if err != nil {
+		if errors.Is(err, storage.ErrServiceAccountNotFound) {
+			log.Info("Unknown service account")
+
+			return Token{}, fmt.Errorf("%s: %w", operator, ErrInvalidClient)
+		}
+
+		return Token{}, fmt.Errorf("%s: %w", operator, err)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashSecret(clientSecret)), []byte(account.SecretHash)) != 1 {
+		log.Info("Invalid service account secret")
+
+		return Token{}, fmt.Errorf("%s: %w", operator, ErrInvalidClient)
+	}
+
+	requested := strings.Fields(scope)
+	if len(requested) == 0 {
+		requested = account.Scopes
+	}
+
+	for _, name := range requested {
+		if !slices.Contains(account.Scopes, name) {
+			return Token{}, fmt.Errorf("%s: %w", operator, ErrInvalidScope)
+		}
+	}
+
+	app, err := s.storage.GetApp(ctx, account.AppId)
+	if err != nil {
+		return Token{}, fmt.Errorf("%s: %w", operator, err)
+	}
+
+	granted := strings.Join(requested, " ")
+
+	accessToken, err := jwt.NewServiceToken(account, app, s.tokenTTL, granted)
+	if err != nil {
+		log.Error("Failed to create token", sl.Err(err))
+
+		return Token{}, fmt.Errorf("%s: %w", operator, err)
+	}
+
+	log.Info("Service account token issued")
+
+	return Token{
+		AccessToken: accessToken,
+		ExpiresIn:   int64(s.tokenTTL.Seconds()),
+		Scope:       granted,
+	}, nil
+}
+
+// Пишет событие в журнал аудита. Ошибка аудита не должна ломать сам запрос, поэтому только логируется
+func (s *ServiceAccounts) audit(ctx context.Context, event string, userID int64, appID int, payload map[string]any) {
+	if err := s.auditor.Record(ctx, event, userID, appID, payload); err != nil {
+		s.log.Error("Failed to write audit record", slog.String("event", event), sl.Err(err))
+	}
+}
+
+func randomString(size int) (string, error) {
+	buf := make([]byte, size)
+
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// Секрет случайный и длинный, поэтому достаточно SHA-256 без соли
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,108 @@
+package serviceaccounts
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"log/slog"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/lib/jwt"
+	"shilka-sso/internal/storage/sqlite/sqlitetest"
+	"testing"
+	"time"
+)
+
+type nopAuditor struct{}
+
+func (nopAuditor) Record(context.Context, string, int64, int, map[string]any) error {
+	return nil
+}
+
+var testApp = models.App{Id: 1, Name: "shop", Secret: "shop-secret"}
+
+func newTestService(t *testing.T) *ServiceAccounts {
+	t.Helper()
+
+	storage, path := sqlitetest.New(t)
+	sqlitetest.SaveApp(t, path, testApp)
+
+	return New(slog.New(slog.NewTextHandler(io.Discard, nil)), storage, nopAuditor{}, time.Hour)
+}
+
+func TestIssueTokenSecret(t *testing.T) {
+	ctx := context.Background()
+	service := newTestService(t)
+
+	account, secret, err := service.Create(ctx, 1, testApp.Id, "worker", []string{"read"})
+	require.NoError(t, err)
+
+	token, err := service.IssueToken(ctx, account.ClientId, secret, "")
+	require.NoError(t, err)
+
+	claims, err := jwt.ParseToken(token.AccessToken, testApp)
+	require.NoError(t, err)
+	assert.Equal(t, account.Id, claims.ServiceAccountID)
+	assert.Zero(t, claims.UserID)
+
+	_, err = service.IssueToken(ctx, account.ClientId, secret+"x", "")
+	assert.ErrorIs(t, err, ErrInvalidClient)
+
+	_, err = service.IssueToken(ctx, account.ClientId, "", "")
+	assert.ErrorIs(t, err, ErrInvalidClient)
+
+	_, err = service.IssueToken(ctx, "sa_unknown", secret, "")
+	assert.ErrorIs(t, err, ErrInvalidClient)
+}
+
+func TestIssueTokenScopes(t *testing.T) {
+	ctx := context.Background()
+	service := newTestService(t)
+
+	account, secret, err := service.Create(ctx, 1, testApp.Id, "worker", []string{"read", "write"})
+	require.NoError(t, err)
+
+	// Без scope выдаются все разрешённые
+	token, err := service.IssueToken(ctx, account.ClientId, secret, "")
+	require.NoError(t, err)
+	assert.Equal(t, "read write", token.Scope)
+
+	token, err = service.IssueToken(ctx, account.ClientId, secret, "write")
+	require.NoError(t, err)
+	assert.Equal(t, "write", token.Scope)
+
+	claims, err := jwt.ParseToken(token.AccessToken, testApp)
+	require.NoError(t, err)
+	assert.Equal(t, "write", claims.Scope)
+
+	// Хотя бы один неразрешённый scope отклоняет весь запрос
+	_, err = service.IssueToken(ctx, account.ClientId, secret, "read admin")
+	assert.ErrorIs(t, err, ErrInvalidScope)
+
+	_, _, err = service.Create(ctx, 1, testApp.Id, "broken", []string{"read write"})
+	assert.ErrorIs(t, err, ErrInvalidScope)
+}
+
+func TestDelete(t *testing.T) {
+	ctx := context.Background()
+	service := newTestService(t)
+
+	account, secret, err := service.Create(ctx, 1, testApp.Id, "worker", []string{"read"})
+	require.NoError(t, err)
+
+	require.NoError(t, service.Delete(ctx, 1, account.Id))
+
+	accounts, err := service.ServiceAccounts(ctx, testApp.Id)
+	require.NoError(t, err)
+	assert.Empty(t, accounts)
+
+	_, err = service.IssueToken(ctx, account.ClientId, secret, "")
+	assert.ErrorIs(t, err, ErrInvalidClient)
+
+	err = service.Delete(ctx, 1, account.Id)
+	assert.ErrorIs(t, err, ErrServiceAccountNotFound)
+
+	// Имя освободилось, аккаунт можно создать заново
+	_, _, err = service.Create(ctx, 1, testApp.Id, "worker", []string{"read"})
+	require.NoError(t, err)
+}
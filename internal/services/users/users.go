@@ -0,0 +1,225 @@
+// Package users Сервис управления пользователями для администраторов
+package users
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/lib/logger/sl"
+	"shilka-sso/internal/storage"
+	"strings"
+	"time"
+)
+
+type Users struct {
+	log     *slog.Logger
+	storage Storage
+	auditor Auditor
+}
+
+// Storage Методы бд, нужные сервису
+type Storage interface {
+	SetAdmin(ctx context.Context, userID int64, isAdmin bool) error
+	SetAccountStatus(ctx context.Context, change models.AccountStatusChange) error
+	AccountStatusHistory(ctx context.Context, userID int64) ([]models.AccountStatusChange, error)
+	ReactivateSuspended(ctx context.Context, now time.Time) ([]int64, error)
+}
+
+// Auditor Журнал аудита, в который пишутся действия администраторов
+type Auditor interface {
+	Record(ctx context.Context, event string, userID int64, appID int, payload map[string]any) error
+}
+
+// Ошибки сервисного слоя
+var (
+	ErrUserNotFound      = errors.New("user not found")
+	ErrInvalidStatus     = errors.New("invalid account status")
+	ErrReasonRequired    = errors.New("reason is required")
+	ErrInvalidSuspension = errors.New("suspended_until must be in the future and is allowed only for suspension")
+	ErrOwnStatus         = errors.New("administrators cannot change their own status")
+)
+
+// New возвращает новый объект сервиса Users
+func New(
+	log *slog.Logger,
+	storage Storage,
+	auditor Auditor,
+) *Users {
+	return &Users{
+		log:     log,
+		storage: storage,
+		auditor: auditor,
+	}
+}
+
+// SetAdmin Выдаёт или забирает у пользователя права администратора
+// actorID - администратор, который меняет роль
+func (u *Users) SetAdmin(ctx context.Context, actorID int64, userID int64, isAdmin bool) error {
+	const operator = "users.SetAdmin"
+
+	log := u.log.With(
+		slog.String("operator", operator),
+		slog.Int64("userID", userID),
+		slog.Bool("isAdmin", isAdmin),
+	)
+
+	log.Info("Changing user role")
+
+	if err := u.storage.SetAdmin(ctx, userID, isAdmin); err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Error("User not found", sl.Err(err))
+
+			return fmt.Errorf("%s: %w", operator, ErrUserNotFound)
+		}
+
+		log.Error("Failed to change user role", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", operator, err)
+	}
+
+	err := u.auditor.Record(ctx, models.AuditRoleChanged, userID, 0, map[string]any{
+		"actor_id": actorID,
+		"is_admin": isAdmin,
+	})
+	if err != nil {
+		log.Error("Failed to write audit record", sl.Err(err))
+	}
+
+	log.Info("User role changed")
+
+	return nil
+}
+
+// SetStatus Меняет статус учётной записи. Для всех статусов, кроме active, нужна причина.
+// suspendedUntil задаётся только для suspended, по его истечении учётная запись снова становится активной.
+// Свой статус администратор поменять не может, чтобы случайно не закрыть себе доступ
+func (u *Users) SetStatus(
+	ctx context.Context,
+	actorID int64,
+	userID int64,
+	status string,
+	reason string,
+	suspendedUntil time.Time,
+) error {
+	const operator = "users.SetStatus"
+
+	log := u.log.With(
+		slog.String("operator", operator),
+		slog.Int64("userID", userID),
+		slog.String("status", status),
+	)
+
+	reason = strings.TrimSpace(reason)
+
+	switch status {
+	case models.AccountActive, models.AccountSuspended, models.AccountDisabled, models.AccountPending:
+	default:
+		return fmt.Errorf("%s: %w", operator, ErrInvalidStatus)
+	}
+
+	if status != models.AccountActive && reason == "" {
+		return fmt.Errorf("%s: %w", operator, ErrReasonRequired)
+	}
+
+	now := time.Now()
+
+	if !suspendedUntil.IsZero() && (status != models.AccountSuspended || !suspendedUntil.After(now)) {
+		return fmt.Errorf("%s: %w", operator, ErrInvalidSuspension)
+	}
+
+	if actorID == userID {
+		return fmt.Errorf("%s: %w", operator, ErrOwnStatus)
+	}
+
+	log.Info("Changing account status")
+
+	err := u.storage.SetAccountStatus(ctx, models.AccountStatusChange{
+		UserId:         userID,
+		Status:         status,
+		Reason:         reason,
+		SuspendedUntil: suspendedUntil,
+		ActorId:        actorID,
+		CreatedAt:      now,
+	})
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return fmt.Errorf("%s: %w", operator, ErrUserNotFound)
+		}
+
+		log.Error("Failed to change account status", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", operator, err)
+	}
+
+	payload := map[string]any{
+		"actor_id": actorID,
+		"status":   status,
+		"reason":   reason,
+	}
+	if !suspendedUntil.IsZero() {
+		payload["suspended_until"] = suspendedUntil.UTC().Format(time.RFC3339)
+	}
+
+	if err := u.auditor.Record(ctx, models.AuditStatusChanged, userID, 0, payload); err != nil {
+		log.Error("Failed to write audit record", sl.Err(err))
+	}
+
+	log.Info("Account status changed")
+
+	return nil
+}
+
+// StatusHistory Возвращает историю статусов учётной записи от старых записей к новым
+func (u *Users) StatusHistory(ctx context.Context, userID int64) ([]models.AccountStatusChange, error) {
+	const operator = "users.StatusHistory"
+
+	history, err := u.storage.AccountStatusHistory(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operator, err)
+	}
+
+	return history, nil
+}
+
+// ReactivateExpired Возвращает статус active учётным записям, у которых закончилась приостановка
+func (u *Users) ReactivateExpired(ctx context.Context) error {
+	const operator = "users.ReactivateExpired"
+
+	ids, err := u.storage.ReactivateSuspended(ctx, time.Now())
+	if err != nil {
+		return fmt.Errorf("%s: %w", operator, err)
+	}
+
+	for _, id := range ids {
+		u.log.Info("Suspension expired, account reactivated", slog.Int64("userID", id))
+
+		err := u.auditor.Record(ctx, models.AuditStatusChanged, id, 0, map[string]any{
+			"status": models.AccountActive,
+			"reason": "suspension expired",
+		})
+		if err != nil {
+			u.log.Error("Failed to write audit record", sl.Err(err))
+		}
+	}
+
+	return nil
+}
+
+// RunReactivation Раз в interval реактивирует учётные записи с истёкшей приостановкой, пока не отменён ctx
+func (u *Users) RunReactivation(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := u.ReactivateExpired(ctx); err != nil {
+				u.log.Error("Failed to reactivate accounts", sl.Err(err))
+			}
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package users
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"log/slog"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/storage/sqlite"
+	"shilka-sso/internal/storage/sqlite/sqlitetest"
+	"testing"
+	"time"
+)
+
+const adminID = 1
+
+type nopAuditor struct{}
+
+func (nopAuditor) Record(context.Context, string, int64, int, map[string]any) error {
+	return nil
+}
+
+func newTestService(t *testing.T) (*Users, *sqlite.Storage, int64) {
+	t.Helper()
+
+	storage, _ := sqlitetest.New(t)
+
+	_, err := storage.SaveUser(context.Background(), "admin", []byte("hash"))
+	require.NoError(t, err)
+
+	userID, err := storage.SaveUser(context.Background(), "ivan", []byte("hash"))
+	require.NoError(t, err)
+
+	return New(slog.New(slog.NewTextHandler(io.Discard, nil)), storage, nopAuditor{}), storage, userID
+}
+
+func TestSetStatus(t *testing.T) {
+	ctx := context.Background()
+	service, storage, userID := newTestService(t)
+
+	require.NoError(t, service.SetStatus(ctx, adminID, userID, models.AccountDisabled, "spam", time.Time{}))
+
+	user, err := storage.UserByID(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, models.AccountDisabled, user.Status)
+	assert.Equal(t, "spam", user.StatusReason)
+	assert.ErrorIs(t, user.CheckActive(time.Now()), models.ErrAccountDisabled)
+
+	require.NoError(t, service.SetStatus(ctx, adminID, userID, models.AccountActive, "", time.Time{}))
+
+	history, err := service.StatusHistory(ctx, userID)
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.Equal(t, models.AccountDisabled, history[0].Status)
+	assert.Equal(t, int64(adminID), history[0].ActorId)
+	assert.Equal(t, models.AccountActive, history[1].Status)
+
+	tests := []struct {
+		name           string
+		userID         int64
+		status         string
+		reason         string
+		suspendedUntil time.Time
+		err            error
+	}{
+		{name: "unknown status", userID: userID, status: "banned", reason: "spam", err: ErrInvalidStatus},
+		{name: "no reason", userID: userID, status: models.AccountSuspended, err: ErrReasonRequired},
+		{name: "past until", userID: userID, status: models.AccountSuspended, reason: "spam",
+			suspendedUntil: time.Now().Add(-time.Hour), err: ErrInvalidSuspension},
+		{name: "until without suspension", userID: userID, status: models.AccountDisabled, reason: "spam",
+			suspendedUntil: time.Now().Add(time.Hour), err: ErrInvalidSuspension},
+		{name: "own status", userID: adminID, status: models.AccountDisabled, reason: "oops", err: ErrOwnStatus},
+		{name: "unknown user", userID: 42, status: models.AccountDisabled, reason: "spam", err: ErrUserNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := service.SetStatus(ctx, adminID, tt.userID, tt.status, tt.reason, tt.suspendedUntil)
+			assert.ErrorIs(t, err, tt.err)
+		})
+	}
+}
+
+func TestSuspensionExpires(t *testing.T) {
+	ctx := context.Background()
+	service, storage, userID := newTestService(t)
+
+	until := time.Now().Add(50 * time.Millisecond)
+	require.NoError(t, service.SetStatus(ctx, adminID, userID, models.AccountSuspended, "cooldown", until))
+
+	user, err := storage.UserByID(ctx, userID)
+	require.NoError(t, err)
+	assert.ErrorIs(t, user.CheckActive(time.Now()), models.ErrAccountSuspended)
+
+	// Пока срок не вышел, реактивация ничего не делает
+	require.NoError(t, service.ReactivateExpired(ctx))
+
+	user, err = storage.UserByID(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, models.AccountSuspended, user.Status)
+
+	time.Sleep(60 * time.Millisecond)
+
+	// Истёкшая приостановка не действует ещё до того, как её снимет фоновая задача
+	assert.NoError(t, user.CheckActive(time.Now()))
+
+	require.NoError(t, service.ReactivateExpired(ctx))
+
+	user, err = storage.UserByID(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, models.AccountActive, user.Status)
+	assert.True(t, user.SuspendedUntil.IsZero())
+
+	history, err := service.StatusHistory(ctx, userID)
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.Equal(t, models.AccountActive, history[1].Status)
+	assert.Equal(t, int64(0), history[1].ActorId)
+}
@@ -0,0 +1,331 @@
+// Package webhooks Подписанные вебхуки о событиях пользователей для приложений
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/lib/logger/sl"
+	"shilka-sso/internal/services/outbox/publisher"
+	"shilka-sso/internal/storage"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// Заголовки запроса вебхука
+const (
+	HeaderSignature = "X-Shilka-Signature"
+	HeaderTimestamp = "X-Shilka-Timestamp"
+	HeaderEvent     = "X-Shilka-Event"
+	HeaderDelivery  = "X-Shilka-Delivery"
+)
+
+type Webhooks struct {
+	log            *slog.Logger
+	storage        Storage
+	client         *http.Client
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	pollInterval   time.Duration
+	batchSize      int
+}
+
+// Storage Методы бд, нужные сервису вебхуков
+type Storage interface {
+	SaveWebhook(ctx context.Context, webhook models.Webhook) (int64, error)
+	Webhooks(ctx context.Context, appID int) ([]models.Webhook, error)
+	DeleteWebhook(ctx context.Context, webhookID int64) error
+
+	EnqueueWebhookDeliveries(ctx context.Context, event models.Event, body []byte) (int64, error)
+	DueWebhookDeliveries(ctx context.Context, now time.Time, limit int) ([]models.WebhookDelivery, error)
+	DeadWebhookDeliveries(ctx context.Context, appID int) ([]models.WebhookDelivery, error)
+	MarkWebhookDelivered(ctx context.Context, deliveryID int64) error
+	MarkWebhookFailed(ctx context.Context, deliveryID int64, reason string, nextAttemptAt time.Time, dead bool) error
+	ReplayWebhookDelivery(ctx context.Context, deliveryID int64) error
+}
+
+// Ошибки сервисного слоя
+var (
+	ErrAppNotFound        = errors.New("app not found")
+	ErrUnknownEventType   = errors.New("unknown event type")
+	ErrInvalidURL         = errors.New("invalid webhook url")
+	ErrWebhookExists      = errors.New("webhook already exists")
+	ErrWebhookNotFound    = errors.New("webhook not found")
+	ErrDeadLetterNotFound = errors.New("dead letter not found")
+)
+
+// New возвращает новый объект сервиса вебхуков
+// Неудачная доставка повторяется с задержкой initialBackoff, которая удваивается
+// с каждой попыткой до maxBackoff. После maxAttempts попыток доставка попадает в список недоставленных
+func New(
+	log *slog.Logger,
+	storage Storage,
+	client *http.Client,
+	maxAttempts int,
+	initialBackoff time.Duration,
+	maxBackoff time.Duration,
+	pollInterval time.Duration,
+	batchSize int,
+) *Webhooks {
+	return &Webhooks{
+		log:            log,
+		storage:        storage,
+		client:         client,
+		maxAttempts:    maxAttempts,
+		initialBackoff: initialBackoff,
+		maxBackoff:     maxBackoff,
+		pollInterval:   pollInterval,
+		batchSize:      batchSize,
+	}
+}
+
+// CreateWebhook Подписывает url приложения на события типа eventType
+func (w *Webhooks) CreateWebhook(ctx context.Context, appID int, eventType string, rawURL string) (int64, error) {
+	const operator = "webhooks.CreateWebhook"
+
+	log := w.log.With(
+		slog.String("operator", operator),
+		slog.Int("appID", appID),
+		slog.String("eventType", eventType),
+	)
+
+	log.Info("Creating webhook")
+
+	if !slices.Contains(models.EventTypes, eventType) {
+		return 0, fmt.Errorf("%s: %w", operator, ErrUnknownEventType)
+	}
+
+	parsed, err := url.Parse(rawURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return 0, fmt.Errorf("%s: %w", operator, ErrInvalidURL)
+	}
+
+	id, err := w.storage.SaveWebhook(ctx, models.Webhook{
+		AppId:     appID,
+		EventType: eventType,
+		URL:       rawURL,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return 0, fmt.Errorf("%s: %w", operator, ErrAppNotFound)
+		}
+
+		if errors.Is(err, storage.ErrWebhookExists) {
+			return 0, fmt.Errorf("%s: %w", operator, ErrWebhookExists)
+		}
+
+		log.Error("Failed to save webhook", sl.Err(err))
+
+		return 0, fmt.Errorf("%s: %w", operator, err)
+	}
+
+	log.Info("Webhook created", slog.Int64("webhookID", id))
+
+	return id, nil
+}
+
+// Webhooks Возвращает вебхуки приложения
+func (w *Webhooks) Webhooks(ctx context.Context, appID int) ([]models.Webhook, error) {
+	const operator = "webhooks.Webhooks"
+
+	webhooks, err := w.storage.Webhooks(ctx, appID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operator, err)
+	}
+
+	return webhooks, nil
+}
+
+// DeleteWebhook Удаляет вебхук и все его доставки
+func (w *Webhooks) DeleteWebhook(ctx context.Context, webhookID int64) error {
+	const operator = "webhooks.DeleteWebhook"
+
+	w.log.Info("Deleting webhook", slog.String("operator", operator), slog.Int64("webhookID", webhookID))
+
+	if err := w.storage.DeleteWebhook(ctx, webhookID); err != nil {
+		if errors.Is(err, storage.ErrWebhookNotFound) {
+			return fmt.Errorf("%s: %w", operator, ErrWebhookNotFound)
+		}
+
+		return fmt.Errorf("%s: %w", operator, err)
+	}
+
+	return nil
+}
+
+// DeadLetters Возвращает доставки, попытки которых закончились
+// Если appID равен 0, возвращаются доставки всех приложений
+func (w *Webhooks) DeadLetters(ctx context.Context, appID int) ([]models.WebhookDelivery, error) {
+	const operator = "webhooks.DeadLetters"
+
+	deliveries, err := w.storage.DeadWebhookDeliveries(ctx, appID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operator, err)
+	}
+
+	return deliveries, nil
+}
+
+// ReplayDeadLetter Возвращает недоставленное событие в очередь доставки
+func (w *Webhooks) ReplayDeadLetter(ctx context.Context, deliveryID int64) error {
+	const operator = "webhooks.ReplayDeadLetter"
+
+	w.log.Info("Replaying dead letter", slog.String("operator", operator), slog.Int64("deliveryID", deliveryID))
+
+	if err := w.storage.ReplayWebhookDelivery(ctx, deliveryID); err != nil {
+		if errors.Is(err, storage.ErrWebhookDeliveryNotFound) {
+			return fmt.Errorf("%s: %w", operator, ErrDeadLetterNotFound)
+		}
+
+		return fmt.Errorf("%s: %w", operator, err)
+	}
+
+	return nil
+}
+
+// Publish Ставит событие из outbox в очередь на доставку во все подписанные вебхуки
+// Так сервис работает как outbox.Publisher
+func (w *Webhooks) Publish(ctx context.Context, event models.Event) error {
+	const operator = "webhooks.Publish"
+
+	body, err := publisher.Encode(event)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operator, err)
+	}
+
+	// Ошибка бд не значит, что событие плохое, попытки на неё не тратятся
+	if _, err := w.storage.EnqueueWebhookDeliveries(ctx, event, body); err != nil {
+		return fmt.Errorf("%s: %w: %w", operator, publisher.ErrUnavailable, err)
+	}
+
+	return nil
+}
+
+func (w *Webhooks) Close() error {
+	return nil
+}
+
+// Run Раз в pollInterval отправляет доставки, время которых наступило, пока не отменён ctx
+func (w *Webhooks) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := w.Deliver(ctx); err != nil {
+				w.log.Error("Failed to deliver webhooks", sl.Err(err))
+			}
+		}
+	}
+}
+
+// Deliver Отправляет доставки, время которых наступило, и возвращает число успешных
+func (w *Webhooks) Deliver(ctx context.Context) (int, error) {
+	const operator = "webhooks.Deliver"
+
+	log := w.log.With(slog.String("operator", operator))
+
+	deliveries, err := w.storage.DueWebhookDeliveries(ctx, time.Now(), w.batchSize)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", operator, err)
+	}
+
+	delivered := 0
+
+	for _, delivery := range deliveries {
+		sendErr := w.send(ctx, delivery)
+		if sendErr == nil {
+			if err := w.storage.MarkWebhookDelivered(ctx, delivery.Id); err != nil {
+				return delivered, fmt.Errorf("%s: %w", operator, err)
+			}
+
+			delivered++
+
+			continue
+		}
+
+		attempts := delivery.Attempts + 1
+		dead := attempts >= w.maxAttempts
+		nextAttemptAt := time.Now().Add(w.backoff(attempts))
+
+		log.Warn("failed to deliver webhook",
+			slog.Int64("deliveryID", delivery.Id),
+			slog.Int("attempts", attempts),
+			slog.Bool("dead", dead),
+			sl.Err(sendErr),
+		)
+
+		if err := w.storage.MarkWebhookFailed(ctx, delivery.Id, sendErr.Error(), nextAttemptAt, dead); err != nil {
+			return delivered, fmt.Errorf("%s: %w", operator, err)
+		}
+	}
+
+	return delivered, nil
+}
+
+// Задержка перед следующей попыткой после attempts неудачных
+func (w *Webhooks) backoff(attempts int) time.Duration {
+	delay := w.initialBackoff
+
+	for i := 1; i < attempts && delay < w.maxBackoff; i++ {
+		delay *= 2
+	}
+
+	return min(delay, w.maxBackoff)
+}
+
+func (w *Webhooks) send(ctx context.Context, delivery models.WebhookDelivery) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Body))
+	if err != nil {
+		return err
+	}
+
+	timestamp := time.Now().Unix()
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, delivery.EventType)
+	req.Header.Set(HeaderDelivery, strconv.FormatInt(delivery.Id, 10))
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(delivery.Secret, timestamp, delivery.Body))
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// Sign Считает подпись запроса вебхука: HMAC-SHA256 секретом приложения от "<timestamp>.<тело>"
+// Получатель должен посчитать ту же подпись и сравнить её с заголовком X-Shilka-Signature
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,216 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/services/outbox/publisher"
+	"shilka-sso/internal/storage/sqlite/sqlitetest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const (
+	appID     = 1
+	appSecret = "4urka"
+)
+
+// Получатель вебхуков, который проверяет подпись каждого запроса
+type receiver struct {
+	t       *testing.T
+	healthy atomic.Bool
+
+	mu       sync.Mutex
+	received []publisher.Message
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, err := io.ReadAll(req.Body)
+	require.NoError(r.t, err)
+
+	timestamp, err := strconv.ParseInt(req.Header.Get(HeaderTimestamp), 10, 64)
+	require.NoError(r.t, err)
+	assert.Equal(r.t, Sign(appSecret, timestamp, body), req.Header.Get(HeaderSignature))
+	assert.Equal(r.t, models.EventUserRegistered, req.Header.Get(HeaderEvent))
+
+	if !r.healthy.Load() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	var message publisher.Message
+	require.NoError(r.t, json.Unmarshal(body, &message))
+
+	r.mu.Lock()
+	r.received = append(r.received, message)
+	r.mu.Unlock()
+}
+
+func (r *receiver) messages() []publisher.Message {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]publisher.Message(nil), r.received...)
+}
+
+func newTestWebhooks(t *testing.T, maxAttempts int) (*Webhooks, *receiver, string) {
+	t.Helper()
+
+	storage, path := sqlitetest.New(t)
+	sqlitetest.SaveApp(t, path, models.App{Id: appID, Name: "test", Secret: appSecret})
+
+	r := &receiver{t: t}
+	r.healthy.Store(true)
+
+	server := httptest.NewServer(r)
+	t.Cleanup(server.Close)
+
+	w := New(
+		slog.New(slog.NewTextHandler(io.Discard, nil)),
+		storage,
+		server.Client(),
+		maxAttempts,
+		time.Millisecond,
+		4*time.Millisecond,
+		time.Millisecond,
+		10,
+	)
+
+	return w, r, server.URL
+}
+
+func registeredEvent(id int64) models.Event {
+	return models.Event{
+		Id:        id,
+		Type:      models.EventUserRegistered,
+		Payload:   []byte(`{"user_id":42,"username":"shilka"}`),
+		CreatedAt: time.Now(),
+	}
+}
+
+func TestDeliver_SignedRequest(t *testing.T) {
+	ctx := context.Background()
+	w, r, url := newTestWebhooks(t, 3)
+
+	_, err := w.CreateWebhook(ctx, appID, models.EventUserRegistered, url)
+	require.NoError(t, err)
+
+	require.NoError(t, w.Publish(ctx, registeredEvent(1)))
+	// Повторная публикация того же события из outbox не должна дублировать доставку
+	require.NoError(t, w.Publish(ctx, registeredEvent(1)))
+
+	delivered, err := w.Deliver(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, delivered)
+
+	messages := r.messages()
+	require.Len(t, messages, 1)
+	assert.EqualValues(t, 1, messages[0].Id)
+	assert.JSONEq(t, `{"user_id":42,"username":"shilka"}`, string(messages[0].Payload))
+}
+
+// Событие доставляется только на вебхуки своего типа
+func TestDeliver_OnlyMatchingEventType(t *testing.T) {
+	ctx := context.Background()
+	w, r, url := newTestWebhooks(t, 3)
+
+	_, err := w.CreateWebhook(ctx, appID, models.EventUserDeleted, url)
+	require.NoError(t, err)
+
+	require.NoError(t, w.Publish(ctx, registeredEvent(1)))
+
+	delivered, err := w.Deliver(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, delivered)
+	assert.Empty(t, r.messages())
+}
+
+// Неудачная доставка повторяется, после maxAttempts попадает в недоставленные и может быть переотправлена
+func TestDeliver_RetriesThenDeadLetterThenReplay(t *testing.T) {
+	ctx := context.Background()
+	w, r, url := newTestWebhooks(t, 3)
+
+	_, err := w.CreateWebhook(ctx, appID, models.EventUserRegistered, url)
+	require.NoError(t, err)
+
+	r.healthy.Store(false)
+	require.NoError(t, w.Publish(ctx, registeredEvent(1)))
+
+	require.Eventually(t, func() bool {
+		_, err := w.Deliver(ctx)
+		require.NoError(t, err)
+
+		dead, err := w.DeadLetters(ctx, appID)
+		require.NoError(t, err)
+
+		return len(dead) == 1
+	}, 5*time.Second, 5*time.Millisecond)
+
+	dead, err := w.DeadLetters(ctx, 0)
+	require.NoError(t, err)
+	require.Len(t, dead, 1)
+	assert.Equal(t, 3, dead[0].Attempts)
+	assert.Equal(t, "unexpected status 503", dead[0].LastError)
+
+	// Недоставленное событие больше не отправляется само
+	time.Sleep(10 * time.Millisecond)
+	delivered, err := w.Deliver(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, delivered)
+
+	deliveryID := dead[0].Id
+
+	r.healthy.Store(true)
+	require.NoError(t, w.ReplayDeadLetter(ctx, deliveryID))
+
+	delivered, err = w.Deliver(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, delivered)
+	assert.Len(t, r.messages(), 1)
+
+	dead, err = w.DeadLetters(ctx, appID)
+	require.NoError(t, err)
+	assert.Empty(t, dead)
+
+	// Доставленное событие переотправить нельзя
+	require.ErrorIs(t, w.ReplayDeadLetter(ctx, deliveryID), ErrDeadLetterNotFound)
+}
+
+func TestCreateWebhook_Validation(t *testing.T) {
+	ctx := context.Background()
+	w, _, url := newTestWebhooks(t, 3)
+
+	_, err := w.CreateWebhook(ctx, appID, "user.unknown", url)
+	assert.ErrorIs(t, err, ErrUnknownEventType)
+
+	_, err = w.CreateWebhook(ctx, appID, models.EventUserRegistered, "ftp://example.com")
+	assert.ErrorIs(t, err, ErrInvalidURL)
+
+	_, err = w.CreateWebhook(ctx, 100, models.EventUserRegistered, url)
+	assert.ErrorIs(t, err, ErrAppNotFound)
+
+	_, err = w.CreateWebhook(ctx, appID, models.EventUserRegistered, url)
+	require.NoError(t, err)
+
+	_, err = w.CreateWebhook(ctx, appID, models.EventUserRegistered, url)
+	assert.ErrorIs(t, err, ErrWebhookExists)
+}
+
+func TestBackoff(t *testing.T) {
+	w := &Webhooks{initialBackoff: time.Second, maxBackoff: 10 * time.Second}
+
+	assert.Equal(t, time.Second, w.backoff(1))
+	assert.Equal(t, 2*time.Second, w.backoff(2))
+	assert.Equal(t, 8*time.Second, w.backoff(4))
+	assert.Equal(t, 10*time.Second, w.backoff(5))
+	assert.Equal(t, 10*time.Second, w.backoff(30))
+}
@@ -0,0 +1,222 @@
+// Package cache Кэш приложений и прав администратора поверх хранилища
+// GetApp вызывается на каждый вход, а IsAdmin на каждый запрос администратора, при этом приложения
+// и роли меняются редко. Записи через Storage сбрасывают затронутые записи кэша, а записи в транзакции
+// WithinTx - ещё раз после её завершения
+package cache
+
+import (
+	"context"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/storage"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Backend Методы хранилища, которые читает кэш, и записи, после которых он сбрасывается
+type Backend interface {
+	GetApp(ctx context.Context, appID int) (models.App, error)
+	SetAppRedirectURIs(ctx context.Context, appID int, redirectURIs []string) error
+	SetAppScopes(ctx context.Context, appID int, scopes []string) error
+
+	IsAdmin(ctx context.Context, userID int64) (bool, error)
+	SetAdmin(ctx context.Context, userID int64, isAdmin bool) error
+	EraseUser(ctx context.Context, userID int64, auditRecordIDs []int64, erased models.AuditRecord) error
+}
+
+// Config Настройки кэша для каждого вида записей
+type Config struct {
+	Apps  EntityConfig
+	Roles EntityConfig
+}
+
+// EntityConfig Size - сколько записей хранится, 0 выключает кэш. TTL - сколько живёт запись, 0 - без ограничения
+// TTL нужен для изменений в обход сервиса, например приложений, добавленных прямо в бд
+type EntityConfig struct {
+	Size int
+	TTL  time.Duration
+}
+
+// Stats Счётчики кэша с момента запуска
+type Stats struct {
+	Apps  EntityStats `json:"apps"`
+	Roles EntityStats `json:"roles"`
+}
+
+type EntityStats struct {
+	Hits      int64 `json:"hits"`
+	Misses    int64 `json:"misses"`
+	Evictions int64 `json:"evictions"`
+	// Сколько записей сейчас в кэше
+	Len int `json:"len"`
+}
+
+// Storage Хранилище с кэшем. Ошибки хранилища возвращаются как есть и не кэшируются,
+// поэтому новое приложение или пользователь видны сразу
+type Storage struct {
+	backend Backend
+	apps    *lru[int, models.App]
+	roles   *lru[int64, bool]
+	now     func() time.Time
+}
+
+func New(backend Backend, cfg Config) *Storage {
+	return &Storage{
+		backend: backend,
+		apps:    newLRU[int, models.App](cfg.Apps.Size, cfg.Apps.TTL),
+		roles:   newLRU[int64, bool](cfg.Roles.Size, cfg.Roles.TTL),
+		now:     time.Now,
+	}
+}
+
+type pendingKey struct{}
+
+// Записи кэша, изменённые в текущей транзакции WithinTx
+type pending struct {
+	mu    sync.Mutex
+	apps  []int
+	roles []int64
+}
+
+// WithinTx Выполняет fn в транзакции хранилища, если оно их поддерживает.
+// Запись в транзакции сбрасывает кэш сразу, но до коммита другие запросы ещё читают из бд старое значение
+// и могут вернуть его в кэш. Поэтому изменённые в fn записи сбрасываются ещё раз, когда транзакция закончилась.
+// Чтения внутри транзакции идут мимо кэша: они видят изменения, которые ещё могут откатиться
+func (s *Storage) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	// Вложенная транзакция: сбросом займётся внешняя
+	if _, ok := ctx.Value(pendingKey{}).(*pending); ok {
+		return storage.WithinTx(ctx, s.backend, fn)
+	}
+
+	changed := &pending{}
+	err := storage.WithinTx(context.WithValue(ctx, pendingKey{}, changed), s.backend, fn)
+
+	changed.mu.Lock()
+	defer changed.mu.Unlock()
+
+	for _, appID := range changed.apps {
+		s.apps.remove(appID)
+	}
+
+	for _, userID := range changed.roles {
+		s.roles.remove(userID)
+	}
+
+	return err
+}
+
+// Сбрасывает приложение и, если идёт транзакция, запоминает его для сброса после неё
+func (s *Storage) forgetApp(ctx context.Context, appID int) {
+	s.apps.remove(appID)
+
+	if changed, ok := ctx.Value(pendingKey{}).(*pending); ok {
+		changed.mu.Lock()
+		changed.apps = append(changed.apps, appID)
+		changed.mu.Unlock()
+	}
+}
+
+// Сбрасывает права пользователя и, если идёт транзакция, запоминает их для сброса после неё
+func (s *Storage) forgetRole(ctx context.Context, userID int64) {
+	s.roles.remove(userID)
+
+	if changed, ok := ctx.Value(pendingKey{}).(*pending); ok {
+		changed.mu.Lock()
+		changed.roles = append(changed.roles, userID)
+		changed.mu.Unlock()
+	}
+}
+
+func inTx(ctx context.Context) bool {
+	_, ok := ctx.Value(pendingKey{}).(*pending)
+
+	return ok
+}
+
+// GetApp Возвращает приложение из кэша или из хранилища
+func (s *Storage) GetApp(ctx context.Context, appID int) (models.App, error) {
+	if !s.apps.enabled() || inTx(ctx) {
+		return s.backend.GetApp(ctx, appID)
+	}
+
+	app, version, ok := s.apps.get(appID, s.now())
+	if ok {
+		app.RedirectURIs = slices.Clone(app.RedirectURIs)
+		app.Scopes = slices.Clone(app.Scopes)
+		return app, nil
+	}
+
+	app, err := s.backend.GetApp(ctx, appID)
+	if err != nil {
+		return models.App{}, err
+	}
+
+	cached := app
+	cached.RedirectURIs = slices.Clone(app.RedirectURIs)
+	cached.Scopes = slices.Clone(app.Scopes)
+	s.apps.add(appID, cached, version, s.now())
+
+	return app, nil
+}
+
+// SetAppRedirectURIs Меняет адреса возврата и сбрасывает приложение в кэше
+func (s *Storage) SetAppRedirectURIs(ctx context.Context, appID int, redirectURIs []string) error {
+	// Сброс и до, и после записи: чтение, начатое во время записи, не вернёт в кэш старое значение
+	s.apps.remove(appID)
+	defer s.forgetApp(ctx, appID)
+
+	return s.backend.SetAppRedirectURIs(ctx, appID, redirectURIs)
+}
+
+// SetAppScopes Меняет разрешённые scope и сбрасывает приложение в кэше
+func (s *Storage) SetAppScopes(ctx context.Context, appID int, scopes []string) error {
+	s.apps.remove(appID)
+	defer s.forgetApp(ctx, appID)
+
+	return s.backend.SetAppScopes(ctx, appID, scopes)
+}
+
+// IsAdmin Возвращает права администратора из кэша или из хранилища
+func (s *Storage) IsAdmin(ctx context.Context, userID int64) (bool, error) {
+	if !s.roles.enabled() || inTx(ctx) {
+		return s.backend.IsAdmin(ctx, userID)
+	}
+
+	isAdmin, version, ok := s.roles.get(userID, s.now())
+	if ok {
+		return isAdmin, nil
+	}
+
+	isAdmin, err := s.backend.IsAdmin(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+
+	s.roles.add(userID, isAdmin, version, s.now())
+
+	return isAdmin, nil
+}
+
+// SetAdmin Меняет права администратора и сбрасывает их в кэше
+func (s *Storage) SetAdmin(ctx context.Context, userID int64, isAdmin bool) error {
+	s.roles.remove(userID)
+	defer s.forgetRole(ctx, userID)
+
+	return s.backend.SetAdmin(ctx, userID, isAdmin)
+}
+
+// EraseUser Удаляет данные пользователя, вместе с ними пропадают и права администратора
+func (s *Storage) EraseUser(ctx context.Context, userID int64, auditRecordIDs []int64, erased models.AuditRecord) error {
+	s.roles.remove(userID)
+	defer s.forgetRole(ctx, userID)
+
+	return s.backend.EraseUser(ctx, userID, auditRecordIDs, erased)
+}
+
+// Stats Возвращает счётчики попаданий и промахов
+func (s *Storage) Stats() Stats {
+	return Stats{
+		Apps:  s.apps.stats(),
+		Roles: s.roles.stats(),
+	}
+}
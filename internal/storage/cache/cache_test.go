@@ -0,0 +1,282 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/storage"
+	"shilka-sso/internal/storage/memory"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Хранилище, которое считает обращения к бд
+type countingBackend struct {
+	*memory.Storage
+	getApp  atomic.Int64
+	isAdmin atomic.Int64
+}
+
+func (b *countingBackend) GetApp(ctx context.Context, appID int) (models.App, error) {
+	b.getApp.Add(1)
+	return b.Storage.GetApp(ctx, appID)
+}
+
+func (b *countingBackend) IsAdmin(ctx context.Context, userID int64) (bool, error) {
+	b.isAdmin.Add(1)
+	return b.Storage.IsAdmin(ctx, userID)
+}
+
+var enabled = Config{
+	Apps:  EntityConfig{Size: 10, TTL: time.Minute},
+	Roles: EntityConfig{Size: 10, TTL: time.Minute},
+}
+
+func newTestCache(t *testing.T, cfg Config) (*Storage, *countingBackend, int64) {
+	t.Helper()
+
+	st, err := memory.New(models.App{Id: 1, Name: "test", Secret: "secret", RedirectURIs: []string{"https://a"}})
+	require.NoError(t, err)
+
+	userID, err := st.SaveUser(context.Background(), "ivan", []byte("hash"))
+	require.NoError(t, err)
+
+	backend := &countingBackend{Storage: st}
+
+	return New(backend, cfg), backend, userID
+}
+
+func TestGetApp(t *testing.T) {
+	ctx := context.Background()
+	c, backend, _ := newTestCache(t, enabled)
+
+	for range 3 {
+		app, err := c.GetApp(ctx, 1)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"https://a"}, app.RedirectURIs)
+
+		// Изменение полученной копии не портит кэш
+		app.RedirectURIs[0] = "https://evil"
+	}
+
+	assert.Equal(t, int64(1), backend.getApp.Load())
+	assert.Equal(t, EntityStats{Hits: 2, Misses: 1, Len: 1}, c.Stats().Apps)
+
+	require.NoError(t, c.SetAppRedirectURIs(ctx, 1, []string{"https://b"}))
+
+	app, err := c.GetApp(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"https://b"}, app.RedirectURIs)
+	assert.Equal(t, int64(2), backend.getApp.Load())
+
+	require.NoError(t, c.SetAppScopes(ctx, 1, []string{"openid"}))
+
+	app, err = c.GetApp(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"openid"}, app.Scopes)
+	assert.Equal(t, int64(3), backend.getApp.Load())
+
+	// Отсутствие приложения не кэшируется
+	for range 2 {
+		_, err = c.GetApp(ctx, 2)
+		assert.ErrorIs(t, err, storage.ErrAppNotFound)
+	}
+
+	assert.Equal(t, int64(5), backend.getApp.Load())
+}
+
+func TestIsAdmin(t *testing.T) {
+	ctx := context.Background()
+	c, backend, userID := newTestCache(t, enabled)
+
+	isAdmin, err := c.IsAdmin(ctx, userID)
+	require.NoError(t, err)
+	assert.False(t, isAdmin)
+
+	require.NoError(t, c.SetAdmin(ctx, userID, true))
+
+	for range 2 {
+		isAdmin, err = c.IsAdmin(ctx, userID)
+		require.NoError(t, err)
+		assert.True(t, isAdmin)
+	}
+
+	assert.Equal(t, int64(2), backend.isAdmin.Load())
+
+	require.NoError(t, c.EraseUser(ctx, userID, nil, models.AuditRecord{Event: models.AuditUserErased, UserId: userID, CreatedAt: time.Now()}))
+
+	_, err = c.IsAdmin(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), backend.isAdmin.Load())
+
+	_, err = c.IsAdmin(ctx, userID+1)
+	assert.ErrorIs(t, err, storage.ErrUserNotFound)
+}
+
+type txKey struct{}
+
+// Хранилище с транзакциями: права, записанные в транзакции, остальные запросы видят только после коммита
+type txBackend struct {
+	*memory.Storage
+	admins  map[int64]bool
+	pending map[int64]bool
+}
+
+func (b *txBackend) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	b.pending = map[int64]bool{}
+
+	if err := fn(context.WithValue(ctx, txKey{}, true)); err != nil {
+		return err
+	}
+
+	for userID, isAdmin := range b.pending {
+		b.admins[userID] = isAdmin
+	}
+
+	return nil
+}
+
+func (b *txBackend) SetAdmin(ctx context.Context, userID int64, isAdmin bool) error {
+	if ctx.Value(txKey{}) != nil {
+		b.pending[userID] = isAdmin
+		return nil
+	}
+
+	b.admins[userID] = isAdmin
+
+	return nil
+}
+
+func (b *txBackend) IsAdmin(ctx context.Context, userID int64) (bool, error) {
+	if isAdmin, ok := b.pending[userID]; ok && ctx.Value(txKey{}) != nil {
+		return isAdmin, nil
+	}
+
+	return b.admins[userID], nil
+}
+
+// Запрос, прочитавший права между записью в транзакции и коммитом, не оставляет в кэше старое значение
+func TestWithinTx(t *testing.T) {
+	ctx := context.Background()
+
+	st, err := memory.New()
+	require.NoError(t, err)
+
+	backend := &txBackend{Storage: st, admins: map[int64]bool{1: true}}
+	c := New(backend, enabled)
+
+	err = c.WithinTx(ctx, func(txCtx context.Context) error {
+		require.NoError(t, c.SetAdmin(txCtx, 1, false))
+
+		// Параллельный запрос вне транзакции ещё видит права и кладёт их в кэш
+		isAdmin, err := c.IsAdmin(ctx, 1)
+		require.NoError(t, err)
+		assert.True(t, isAdmin)
+
+		// Внутри транзакции видно несохранённое значение, в кэш оно не попадает
+		isAdmin, err = c.IsAdmin(txCtx, 1)
+		require.NoError(t, err)
+		assert.False(t, isAdmin)
+
+		return nil
+	})
+	require.NoError(t, err)
+
+	isAdmin, err := c.IsAdmin(ctx, 1)
+	require.NoError(t, err)
+	assert.False(t, isAdmin)
+
+	// После отката в кэше остаётся сохранённое значение, а не прочитанное в транзакции
+	err = c.WithinTx(ctx, func(txCtx context.Context) error {
+		require.NoError(t, c.SetAdmin(txCtx, 1, true))
+
+		isAdmin, err := c.IsAdmin(txCtx, 1)
+		require.NoError(t, err)
+		assert.True(t, isAdmin)
+
+		return errors.New("rollback")
+	})
+	require.Error(t, err)
+
+	isAdmin, err = c.IsAdmin(ctx, 1)
+	require.NoError(t, err)
+	assert.False(t, isAdmin)
+}
+
+func TestTTL(t *testing.T) {
+	ctx := context.Background()
+	c, backend, _ := newTestCache(t, enabled)
+
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	_, err := c.GetApp(ctx, 1)
+	require.NoError(t, err)
+
+	now = now.Add(time.Minute - time.Second)
+
+	_, err = c.GetApp(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), backend.getApp.Load())
+
+	now = now.Add(time.Second)
+
+	_, err = c.GetApp(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), backend.getApp.Load())
+}
+
+func TestDisabled(t *testing.T) {
+	ctx := context.Background()
+	c, backend, userID := newTestCache(t, Config{})
+
+	for range 2 {
+		_, err := c.GetApp(ctx, 1)
+		require.NoError(t, err)
+
+		_, err = c.IsAdmin(ctx, userID)
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, int64(2), backend.getApp.Load())
+	assert.Equal(t, int64(2), backend.isAdmin.Load())
+	assert.Equal(t, Stats{}, c.Stats())
+}
+
+func TestLRU(t *testing.T) {
+	now := time.Now()
+	c := newLRU[int, string](2, 0)
+
+	for key, value := range map[int]string{1: "a", 2: "b"} {
+		_, version, _ := c.get(key, now)
+		c.add(key, value, version, now)
+	}
+
+	// 1 прочитана позже 2, поэтому при переполнении вытесняется 2
+	_, _, ok := c.get(1, now)
+	require.True(t, ok)
+
+	_, version, _ := c.get(3, now)
+	c.add(3, "c", version, now)
+
+	_, _, ok = c.get(2, now)
+	assert.False(t, ok)
+
+	value, _, ok := c.get(1, now.Add(time.Hour))
+	assert.True(t, ok)
+	assert.Equal(t, "a", value)
+
+	assert.Equal(t, int64(1), c.stats().Evictions)
+	assert.Equal(t, 2, c.stats().Len)
+
+	// Значение, прочитанное до сброса, в кэш не попадает
+	_, version, _ = c.get(4, now)
+	c.remove(4)
+	c.add(4, "stale", version, now)
+
+	_, _, ok = c.get(4, now)
+	assert.False(t, ok)
+}
@@ -0,0 +1,127 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Кэш ограниченного размера: при переполнении вытесняется запись, которую дольше всех не читали,
+// а запись старше ttl считается отсутствующей
+type lru[K comparable, V any] struct {
+	mu    sync.Mutex
+	size  int
+	ttl   time.Duration
+	items map[K]*list.Element
+	// Спереди недавно прочитанные записи, сзади кандидаты на вытеснение
+	order *list.List
+
+	// Растёт при каждом сбросе. Значение, прочитанное из хранилища до сброса, в кэш уже не попадёт
+	version uint64
+
+	hits      int64
+	misses    int64
+	evictions int64
+}
+
+type entry[K comparable, V any] struct {
+	key       K
+	value     V
+	expiresAt time.Time
+}
+
+// size <= 0 выключает кэш, ttl <= 0 - записи живут до вытеснения или сброса
+func newLRU[K comparable, V any](size int, ttl time.Duration) *lru[K, V] {
+	return &lru[K, V]{
+		size:  size,
+		ttl:   ttl,
+		items: make(map[K]*list.Element),
+		order: list.New(),
+	}
+}
+
+func (c *lru[K, V]) enabled() bool {
+	return c.size > 0
+}
+
+// Возвращает запись и версию кэша, с которой нужно вызвать add после чтения из хранилища
+func (c *lru[K, V]) get(key K, now time.Time) (V, uint64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		e := el.Value.(*entry[K, V])
+
+		if e.expiresAt.IsZero() || now.Before(e.expiresAt) {
+			c.order.MoveToFront(el)
+			c.hits++
+
+			return e.value, c.version, true
+		}
+
+		c.order.Remove(el)
+		delete(c.items, key)
+	}
+
+	c.misses++
+
+	var zero V
+
+	return zero, c.version, false
+}
+
+// Кладёт запись, если с момента get кэш не сбрасывали
+func (c *lru[K, V]) add(key K, value V, version uint64, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if version != c.version {
+		return
+	}
+
+	e := &entry[K, V]{key: key, value: value}
+	if c.ttl > 0 {
+		e.expiresAt = now.Add(c.ttl)
+	}
+
+	if el, ok := c.items[key]; ok {
+		el.Value = e
+		c.order.MoveToFront(el)
+
+		return
+	}
+
+	c.items[key] = c.order.PushFront(e)
+
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*entry[K, V]).key)
+		c.evictions++
+	}
+}
+
+// Удаляет запись после изменения в хранилище
+func (c *lru[K, V]) remove(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.version++
+
+	if el, ok := c.items[key]; ok {
+		c.order.Remove(el)
+		delete(c.items, key)
+	}
+}
+
+func (c *lru[K, V]) stats() EntityStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return EntityStats{
+		Hits:      c.hits,
+		Misses:    c.misses,
+		Evictions: c.evictions,
+		Len:       c.order.Len(),
+	}
+}
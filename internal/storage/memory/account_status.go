@@ -0,0 +1,109 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/storage"
+	"time"
+)
+
+// Причина в истории, когда приостановка закончилась сама
+const suspensionExpiredReason = "suspension expired"
+
+// SetAccountStatus Меняет статус учётной записи и добавляет запись в историю статусов
+// Вместе с изменением в outbox пишется событие user.enabled или user.disabled
+func (s *Storage) SetAccountStatus(ctx context.Context, change models.AccountStatusChange) error {
+	const operation = "storage.memory.SetAccountStatus"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.setAccountStatus(change); err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return nil
+}
+
+// AccountStatusHistory Возвращает историю статусов пользователя от старых записей к новым
+func (s *Storage) AccountStatusHistory(ctx context.Context, userID int64) ([]models.AccountStatusChange, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var history []models.AccountStatusChange
+
+	for _, change := range s.statusHistory {
+		if change.UserId == userID {
+			history = append(history, change)
+		}
+	}
+
+	return history, nil
+}
+
+// ReactivateSuspended Возвращает статус active пользователям, у которых к now закончилась приостановка
+// Возвращает id реактивированных пользователей
+func (s *Storage) ReactivateSuspended(ctx context.Context, now time.Time) ([]int64, error) {
+	const operation = "storage.memory.ReactivateSuspended"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var ids []int64
+
+	for _, id := range sortedKeys(s.users) {
+		u := s.users[id]
+
+		if u.Status != models.AccountSuspended || u.SuspendedUntil.IsZero() || u.SuspendedUntil.After(now) {
+			continue
+		}
+
+		err := s.setAccountStatus(models.AccountStatusChange{
+			UserId:    id,
+			Status:    models.AccountActive,
+			Reason:    suspensionExpiredReason,
+			CreatedAt: now,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", operation, err)
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+// Меняет статус, пишет историю и событие, вызывается под s.mu
+// Статус удалённого пользователя не меняется, такой пользователь считается не найденным
+func (s *Storage) setAccountStatus(change models.AccountStatusChange) error {
+	u, ok := s.users[change.UserId]
+	if !ok || u.Status == models.AccountErased {
+		return storage.ErrUserNotFound
+	}
+
+	event := models.EventUserDisabled
+	if change.Status == models.AccountActive {
+		event = models.EventUserEnabled
+	}
+
+	err := s.insertEvent(event, models.UserEventPayload{
+		UserId: change.UserId,
+		Status: change.Status,
+		Reason: change.Reason,
+	})
+	if err != nil {
+		return err
+	}
+
+	u.Status = change.Status
+	u.StatusReason = change.Reason
+	u.SuspendedUntil = change.SuspendedUntil
+
+	s.lastStatusChangeID++
+	change.Id = s.lastStatusChangeID
+	s.statusHistory = append(s.statusHistory, change)
+
+	return nil
+}
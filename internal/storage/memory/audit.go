@@ -0,0 +1,125 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/lib/auditchain"
+	"shilka-sso/internal/storage"
+	"slices"
+)
+
+// AppendAuditRecord Добавляет запись в конец цепочки аудита
+// Id, PrevHash и Hash записи вычисляются здесь, поэтому добавление идёт строго по одной записи
+func (s *Storage) AppendAuditRecord(ctx context.Context, record models.AuditRecord) (models.AuditRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.appendAuditRecord(record), nil
+}
+
+// Добавляет запись в конец цепочки, вызывается под s.mu
+func (s *Storage) appendAuditRecord(record models.AuditRecord) models.AuditRecord {
+	record.Id = 1
+	record.PrevHash = auditchain.GenesisHash
+
+	if n := len(s.auditRecords); n > 0 {
+		record.Id = s.auditRecords[n-1].Id + 1
+		record.PrevHash = slices.Clone(s.auditRecords[n-1].Hash)
+	}
+
+	record.Hash = auditchain.RecordHash(record)
+
+	s.auditRecords = append(s.auditRecords, copyAuditRecord(record))
+
+	return record
+}
+
+// AuditRecords Возвращает до limit записей аудита с id больше afterID по порядку
+func (s *Storage) AuditRecords(ctx context.Context, afterID int64, limit int) ([]models.AuditRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var records []models.AuditRecord
+
+	for _, record := range s.auditRecords {
+		if len(records) == limit {
+			break
+		}
+
+		if record.Id > afterID {
+			records = append(records, copyAuditRecord(record))
+		}
+	}
+
+	return records, nil
+}
+
+// UserAuditRecords Возвращает все записи аудита о пользователе по порядку
+func (s *Storage) UserAuditRecords(ctx context.Context, userID int64) ([]models.AuditRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var records []models.AuditRecord
+
+	for _, record := range s.auditRecords {
+		if record.UserId == userID {
+			records = append(records, copyAuditRecord(record))
+		}
+	}
+
+	return records, nil
+}
+
+// LastAuditRecord Возвращает последнюю запись цепочки аудита
+func (s *Storage) LastAuditRecord(ctx context.Context) (models.AuditRecord, error) {
+	const operation = "storage.memory.LastAuditRecord"
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if len(s.auditRecords) == 0 {
+		return models.AuditRecord{}, fmt.Errorf("%s: %w", operation, storage.ErrAuditRecordNotFound)
+	}
+
+	return copyAuditRecord(s.auditRecords[len(s.auditRecords)-1]), nil
+}
+
+// SaveAuditCheckpoint Сохраняет подписанный чекпоинт цепочки аудита
+func (s *Storage) SaveAuditCheckpoint(ctx context.Context, checkpoint models.AuditCheckpoint) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	checkpoint.Id = int64(len(s.auditCheckpoints)) + 1
+	checkpoint.Hash = slices.Clone(checkpoint.Hash)
+	checkpoint.Signature = slices.Clone(checkpoint.Signature)
+
+	s.auditCheckpoints = append(s.auditCheckpoints, checkpoint)
+
+	return checkpoint.Id, nil
+}
+
+// AuditCheckpoints Возвращает все чекпоинты цепочки аудита по порядку
+func (s *Storage) AuditCheckpoints(ctx context.Context) ([]models.AuditCheckpoint, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var checkpoints []models.AuditCheckpoint
+
+	for _, checkpoint := range s.auditCheckpoints {
+		checkpoint.Hash = slices.Clone(checkpoint.Hash)
+		checkpoint.Signature = slices.Clone(checkpoint.Signature)
+		checkpoints = append(checkpoints, checkpoint)
+	}
+
+	return checkpoints, nil
+}
+
+func copyAuditRecord(record models.AuditRecord) models.AuditRecord {
+	record.PrevHash = slices.Clone(record.PrevHash)
+	record.Hash = slices.Clone(record.Hash)
+	record.FieldSalts = maps.Clone(record.FieldSalts)
+
+	return record
+}
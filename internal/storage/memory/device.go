@@ -0,0 +1,133 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/storage"
+	"time"
+)
+
+// SaveDeviceCode Сохраняет запрос на вход устройства
+// Хэш device code и user code уникальны, как и в sqlite
+func (s *Storage) SaveDeviceCode(ctx context.Context, code models.DeviceCode) error {
+	const operation = "storage.memory.SaveDeviceCode"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.deviceCodes[code.DeviceCodeHash]; ok {
+		return fmt.Errorf("%s: %w", operation, errors.New("device code already exists"))
+	}
+
+	for _, existing := range s.deviceCodes {
+		if existing.UserCode == code.UserCode {
+			return fmt.Errorf("%s: %w", operation, errors.New("user code already exists"))
+		}
+	}
+
+	code.UserId = 0
+	code.LastPolledAt = time.Time{}
+	s.deviceCodes[code.DeviceCodeHash] = code
+
+	return nil
+}
+
+// DeviceCode Возвращает запрос по хэшу device code в любом статусе
+func (s *Storage) DeviceCode(ctx context.Context, deviceCodeHash string) (models.DeviceCode, error) {
+	const operation = "storage.memory.DeviceCode"
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	code, ok := s.deviceCodes[deviceCodeHash]
+	if !ok {
+		return models.DeviceCode{}, fmt.Errorf("%s: %w", operation, storage.ErrDeviceCodeNotFound)
+	}
+
+	return code, nil
+}
+
+// PendingDeviceCode Возвращает ожидающий подтверждения и не просроченный запрос по user code
+func (s *Storage) PendingDeviceCode(ctx context.Context, userCode string) (models.DeviceCode, error) {
+	const operation = "storage.memory.PendingDeviceCode"
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	code, ok := s.pendingDeviceCode(userCode)
+	if !ok {
+		return models.DeviceCode{}, fmt.Errorf("%s: %w", operation, storage.ErrDeviceCodeNotFound)
+	}
+
+	return code, nil
+}
+
+// ResolveDeviceCode Подтверждает или отклоняет ожидающий запрос от имени пользователя
+func (s *Storage) ResolveDeviceCode(ctx context.Context, userCode string, userID int64, approved bool) error {
+	const operation = "storage.memory.ResolveDeviceCode"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	code, ok := s.pendingDeviceCode(userCode)
+	if !ok {
+		return fmt.Errorf("%s: %w", operation, storage.ErrDeviceCodeNotFound)
+	}
+
+	code.Status = models.DeviceCodeDenied
+	if approved {
+		code.Status = models.DeviceCodeApproved
+	}
+
+	code.UserId = userID
+	s.deviceCodes[code.DeviceCodeHash] = code
+
+	return nil
+}
+
+// UpdateDevicePoll Запоминает время опроса и интервал, с которым устройство должно опрашивать дальше
+func (s *Storage) UpdateDevicePoll(ctx context.Context, deviceCodeHash string, polledAt time.Time, interval time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if code, ok := s.deviceCodes[deviceCodeHash]; ok {
+		code.LastPolledAt = polledAt
+		code.Interval = interval
+		s.deviceCodes[deviceCodeHash] = code
+	}
+
+	return nil
+}
+
+// ConsumeDeviceCode Помечает подтверждённый запрос использованным, чтобы токен по нему выдавался один раз
+func (s *Storage) ConsumeDeviceCode(ctx context.Context, deviceCodeHash string) error {
+	const operation = "storage.memory.ConsumeDeviceCode"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	code, ok := s.deviceCodes[deviceCodeHash]
+	if !ok || code.Status != models.DeviceCodeApproved {
+		return fmt.Errorf("%s: %w", operation, storage.ErrDeviceCodeNotFound)
+	}
+
+	code.Status = models.DeviceCodeConsumed
+	s.deviceCodes[deviceCodeHash] = code
+
+	return nil
+}
+
+// Ожидающий подтверждения и не просроченный запрос по user code, вызывается под s.mu
+func (s *Storage) pendingDeviceCode(userCode string) (models.DeviceCode, bool) {
+	now := time.Now()
+
+	for _, code := range s.deviceCodes {
+		if code.UserCode == userCode && code.Status == models.DeviceCodePending && !expired(code.ExpiresAt, now) {
+			return code, true
+		}
+	}
+
+	return models.DeviceCode{}, false
+}
@@ -0,0 +1,219 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/lib/auditchain"
+	"shilka-sso/internal/storage"
+	"slices"
+	"time"
+)
+
+// SaveErasureRequest Сохраняет запрос на удаление данных пользователя
+// Удалённый пользователь считается не найденным, второй запрос для того же пользователя - ErrErasureRequestExists
+func (s *Storage) SaveErasureRequest(ctx context.Context, request models.ErasureRequest) error {
+	const operation = "storage.memory.SaveErasureRequest"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkNotErased(request.UserId); err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if _, ok := s.erasureRequests[request.UserId]; ok {
+		return fmt.Errorf("%s: %w", operation, storage.ErrErasureRequestExists)
+	}
+
+	s.erasureRequests[request.UserId] = request
+
+	return nil
+}
+
+// ErasureRequest Возвращает запрос на удаление данных пользователя
+func (s *Storage) ErasureRequest(ctx context.Context, userID int64) (models.ErasureRequest, error) {
+	const operation = "storage.memory.ErasureRequest"
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	request, ok := s.erasureRequests[userID]
+	if !ok {
+		return models.ErasureRequest{}, fmt.Errorf("%s: %w", operation, storage.ErrErasureRequestNotFound)
+	}
+
+	return request, nil
+}
+
+// DeleteErasureRequest Отменяет запрос на удаление данных пользователя
+func (s *Storage) DeleteErasureRequest(ctx context.Context, userID int64) error {
+	const operation = "storage.memory.DeleteErasureRequest"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.erasureRequests[userID]; !ok {
+		return fmt.Errorf("%s: %w", operation, storage.ErrErasureRequestNotFound)
+	}
+
+	delete(s.erasureRequests, userID)
+
+	return nil
+}
+
+// DueErasureRequests Возвращает запросы на удаление, срок отмены которых истёк к now
+func (s *Storage) DueErasureRequests(ctx context.Context, now time.Time) ([]models.ErasureRequest, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var requests []models.ErasureRequest
+
+	for _, request := range s.erasureRequests {
+		if !request.EraseAt.After(now) {
+			requests = append(requests, request)
+		}
+	}
+
+	slices.SortFunc(requests, func(a, b models.ErasureRequest) int {
+		return a.EraseAt.Compare(b.EraseAt)
+	})
+
+	return requests, nil
+}
+
+// EraseUser Удаляет данные пользователя во всех коллекциях
+// Пользователь остаётся под псевдонимом и без пароля, как и в sqlite. Из записей аудита auditRecordIDs
+// персональные поля заменяются хэшами, доставленные и недоставляемые события о пользователе удаляются
+// из outbox вместе с отправками вебхуков. В outbox пишется событие user.deleted, в цепочку аудита - запись erased
+func (s *Storage) EraseUser(ctx context.Context, userID int64, auditRecordIDs []int64, erased models.AuditRecord) error {
+	const operation = "storage.memory.EraseUser"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkNotErased(userID); err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	// Записи аудита меняются первыми: только здесь может случиться ошибка, и до неё ничего не должно удалиться
+	pseudonym := models.ErasedUsername(userID)
+
+	records := make(map[int]models.AuditRecord, len(auditRecordIDs))
+
+	for _, recordID := range auditRecordIDs {
+		i, ok := slices.BinarySearchFunc(s.auditRecords, recordID, func(record models.AuditRecord, id int64) int {
+			return cmp.Compare(record.Id, id)
+		})
+		if !ok || s.auditRecords[i].UserId != userID {
+			continue
+		}
+
+		record, err := auditchain.Redact(s.auditRecords[i], pseudonym, erased.CreatedAt)
+		if err != nil {
+			return fmt.Errorf("%s: %w", operation, err)
+		}
+
+		records[i] = record
+	}
+
+	if err := s.insertEvent(models.EventUserDeleted, models.UserEventPayload{UserId: userID}); err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	for i, record := range records {
+		s.auditRecords[i] = record
+	}
+
+	s.appendAuditRecord(erased)
+
+	s.deleteUserRows(userID)
+
+	u := s.users[userID]
+	s.rename(u, pseudonym)
+	u.PasswordHash = []byte{}
+	u.isAdmin = false
+	u.Status = models.AccountErased
+	u.StatusReason = ""
+	u.SuspendedUntil = time.Time{}
+
+	// Ожидающие отправки события остаются, иначе подписчики не узнают о последних изменениях.
+	// Недоставляемые удаляются: сами они уже не уйдут, а имя пользователя в них осталось бы
+	erasedEvents := make(map[int64]bool)
+
+	s.events = slices.DeleteFunc(s.events, func(e *event) bool {
+		if (e.deliveredAt.IsZero() && e.DeadAt.IsZero()) || eventUserID(e.Payload) != userID {
+			return false
+		}
+
+		erasedEvents[e.Id] = true
+
+		return true
+	})
+
+	maps.DeleteFunc(s.deliveries, func(_ int64, delivery *models.WebhookDelivery) bool {
+		return erasedEvents[delivery.EventId] && delivery.Status != models.WebhookDeliveryPending
+	})
+
+	return nil
+}
+
+// Удаляет все строки пользователя, кроме самого пользователя, вызывается под s.mu
+func (s *Storage) deleteUserRows(userID int64) {
+	maps.DeleteFunc(s.personalTokens, func(_ int64, token models.PersonalToken) bool {
+		return token.UserId == userID
+	})
+	maps.DeleteFunc(s.passkeys, func(_ int64, passkey models.Passkey) bool {
+		return passkey.UserId == userID
+	})
+	maps.DeleteFunc(s.passkeySessions, func(_ string, session models.PasskeySession) bool {
+		return session.UserId == userID
+	})
+	maps.DeleteFunc(s.challenges, func(_ string, challenge models.PasswordlessChallenge) bool {
+		return challenge.UserId == userID
+	})
+	maps.DeleteFunc(s.federatedIdentities, func(_ federatedKey, identity models.FederatedIdentity) bool {
+		return identity.UserId == userID
+	})
+	maps.DeleteFunc(s.identifiers, func(key identifierKey, _ models.Identifier) bool {
+		return key.userID == userID
+	})
+	maps.DeleteFunc(s.authCodes, func(_ string, code authCode) bool {
+		return code.UserId == userID
+	})
+	maps.DeleteFunc(s.deviceCodes, func(_ string, code models.DeviceCode) bool {
+		return code.UserId == userID
+	})
+
+	s.statusHistory = slices.DeleteFunc(s.statusHistory, func(change models.AccountStatusChange) bool {
+		return change.UserId == userID
+	})
+
+	delete(s.erasureRequests, userID)
+}
+
+// Возвращает ErrUserNotFound, если пользователя нет или его данные уже удалены. Вызывается под s.mu
+func (s *Storage) checkNotErased(userID int64) error {
+	u, ok := s.users[userID]
+	if !ok || u.Status == models.AccountErased {
+		return storage.ErrUserNotFound
+	}
+
+	return nil
+}
+
+// Id пользователя из тела события или 0, если его там нет
+func eventUserID(payload []byte) int64 {
+	var event struct {
+		UserId int64 `json:"user_id"`
+	}
+
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return 0
+	}
+
+	return event.UserId
+}
@@ -0,0 +1,152 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/storage"
+	"slices"
+	"time"
+)
+
+// Первичный ключ federated_identities
+type federatedKey struct {
+	connectorID string
+	subject     string
+}
+
+// Связь с пользователем внешнего провайдера уже есть
+var errFederatedIdentityExists = errors.New("federated identity already exists")
+
+// FederatedUser Возвращает пользователя, связанного с пользователем subject внешнего провайдера
+func (s *Storage) FederatedUser(ctx context.Context, connectorID string, subject string) (models.User, error) {
+	const operation = "storage.memory.FederatedUser"
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	identity, ok := s.federatedIdentities[federatedKey{connectorID: connectorID, subject: subject}]
+	if !ok {
+		return models.User{}, fmt.Errorf("%s: %w", operation, storage.ErrFederatedIdentityNotFound)
+	}
+
+	u, ok := s.users[identity.UserId]
+	if !ok {
+		return models.User{}, fmt.Errorf("%s: %w", operation, storage.ErrFederatedIdentityNotFound)
+	}
+
+	return u.copy(), nil
+}
+
+// LinkFederatedIdentity Связывает существующего пользователя с пользователем внешнего провайдера
+func (s *Storage) LinkFederatedIdentity(ctx context.Context, identity models.FederatedIdentity) error {
+	const operation = "storage.memory.LinkFederatedIdentity"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := federatedKey{connectorID: identity.ConnectorId, subject: identity.Subject}
+
+	if _, ok := s.federatedIdentities[key]; ok {
+		return fmt.Errorf("%s: %w", operation, errFederatedIdentityExists)
+	}
+
+	s.federatedIdentities[key] = identity
+
+	return nil
+}
+
+// FederatedIdentities Возвращает связи пользователя с внешними провайдерами
+func (s *Storage) FederatedIdentities(ctx context.Context, userID int64) ([]models.FederatedIdentity, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var identities []models.FederatedIdentity
+
+	for _, identity := range s.federatedIdentities {
+		if identity.UserId == userID {
+			identities = append(identities, identity)
+		}
+	}
+
+	slices.SortFunc(identities, func(a, b models.FederatedIdentity) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+
+	return identities, nil
+}
+
+// SaveFederatedUser Создаёт пользователя без пароля и сразу связывает его с пользователем внешнего провайдера
+func (s *Storage) SaveFederatedUser(ctx context.Context, username string, identity models.FederatedIdentity) (int64, error) {
+	const operation = "storage.memory.SaveFederatedUser"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := federatedKey{connectorID: identity.ConnectorId, subject: identity.Subject}
+
+	// Связь проверяется до создания пользователя, чтобы при ошибке ничего не сохранилось
+	if _, ok := s.federatedIdentities[key]; ok {
+		return 0, fmt.Errorf("%s: %w", operation, errFederatedIdentityExists)
+	}
+
+	// Пустой хэш не совпадает ни с одним паролем, поэтому войти можно только через провайдера
+	id, err := s.insertUser(username, []byte{})
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	identity.UserId = id
+	s.federatedIdentities[key] = identity
+
+	return id, nil
+}
+
+// SaveConnectorState Сохраняет незавершённый вход через внешний провайдер
+func (s *Storage) SaveConnectorState(ctx context.Context, state models.ConnectorState) error {
+	const operation = "storage.memory.SaveConnectorState"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.connectorStates[state.StateHash]; ok {
+		return fmt.Errorf("%s: %w", operation, errors.New("connector state already exists"))
+	}
+
+	state.Request = slices.Clone(state.Request)
+	s.connectorStates[state.StateHash] = state
+
+	return nil
+}
+
+// ConsumeConnectorState Возвращает незавершённый вход и удаляет его, чтобы state нельзя было использовать повторно
+// Просроченный вход считается не найденным
+func (s *Storage) ConsumeConnectorState(ctx context.Context, stateHash string) (models.ConnectorState, error) {
+	const operation = "storage.memory.ConsumeConnectorState"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state, ok := s.connectorStates[stateHash]
+	if !ok {
+		return models.ConnectorState{}, fmt.Errorf("%s: %w", operation, storage.ErrConnectorStateNotFound)
+	}
+
+	// Заодно удаляем все просроченные входы
+	now := time.Now()
+
+	delete(s.connectorStates, stateHash)
+
+	for hash, other := range s.connectorStates {
+		if expired(other.ExpiresAt, now) {
+			delete(s.connectorStates, hash)
+		}
+	}
+
+	if now.After(state.ExpiresAt) {
+		return models.ConnectorState{}, fmt.Errorf("%s: %w", operation, storage.ErrConnectorStateNotFound)
+	}
+
+	return state, nil
+}
@@ -0,0 +1,182 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/lib/identifiers"
+	"shilka-sso/internal/lib/usernames"
+	"shilka-sso/internal/storage"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Первичный ключ user_identifiers
+type identifierKey struct {
+	userID int64
+	kind   string
+}
+
+// UserByIdentifier Находит пользователя по имени, подтверждённой почте или телефону
+// Вид определяется по записи login, совпадение с именем важнее совпадения с идентификатором
+func (s *Storage) UserByIdentifier(ctx context.Context, login string) (models.User, error) {
+	const operation = "storage.memory.UserByIdentifier"
+
+	user, err := s.GetUser(ctx, login)
+
+	kind := identifiers.Kind(login)
+	if kind == models.IdentifierUsername || !errors.Is(err, storage.ErrUserNotFound) {
+		return user, err
+	}
+
+	canonical, err := identifiers.Canonical(kind, login)
+	if err != nil {
+		return models.User{}, fmt.Errorf("%s: %w", operation, storage.ErrUserNotFound)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, identifier := range s.identifiers {
+		if identifier.Kind != kind || identifier.Canonical != canonical || !identifier.Verified() {
+			continue
+		}
+
+		if u, ok := s.users[identifier.UserId]; ok {
+			return u.copy(), nil
+		}
+	}
+
+	return models.User{}, fmt.Errorf("%s: %w", operation, storage.ErrUserNotFound)
+}
+
+// Identifiers Возвращает почту и телефон пользователя, подтверждённые и нет
+func (s *Storage) Identifiers(ctx context.Context, userID int64) ([]models.Identifier, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var result []models.Identifier
+
+	for key, identifier := range s.identifiers {
+		if key.userID == userID {
+			result = append(result, identifier)
+		}
+	}
+
+	slices.SortFunc(result, func(a, b models.Identifier) int {
+		return strings.Compare(a.Kind, b.Kind)
+	})
+
+	return result, nil
+}
+
+// SetIdentifier Сохраняет новую неподтверждённую почту или телефон вместо прежних того же вида
+// Если идентификатор уже подтвердил другой пользователь или он совпадает с чужим именем, возвращает ErrIdentifierExists
+func (s *Storage) SetIdentifier(ctx context.Context, identifier models.Identifier) error {
+	const operation = "storage.memory.SetIdentifier"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[identifier.UserId]; !ok {
+		return fmt.Errorf("%s: %w", operation, storage.ErrUserNotFound)
+	}
+
+	if s.identifierTaken(identifier) {
+		return fmt.Errorf("%s: %w", operation, storage.ErrIdentifierExists)
+	}
+
+	identifier.VerifiedAt = time.Time{}
+	identifier.Attempts = 0
+
+	s.identifiers[identifierKey{userID: identifier.UserId, kind: identifier.Kind}] = identifier
+
+	return nil
+}
+
+// UseIdentifierAttempt Тратит одну попытку ввода кода подтверждения и возвращает идентификатор
+// Подтверждённый идентификатор, просроченный код или исчерпанные попытки считаются не найденными
+func (s *Storage) UseIdentifierAttempt(
+	ctx context.Context,
+	userID int64,
+	kind string,
+	maxAttempts int,
+) (models.Identifier, error) {
+	const operation = "storage.memory.UseIdentifierAttempt"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := identifierKey{userID: userID, kind: kind}
+
+	identifier, ok := s.identifiers[key]
+	if !ok || identifier.Verified() || identifier.Attempts >= maxAttempts || expired(identifier.CodeExpiresAt, time.Now()) {
+		return models.Identifier{}, fmt.Errorf("%s: %w", operation, storage.ErrIdentifierNotFound)
+	}
+
+	identifier.Attempts++
+	s.identifiers[key] = identifier
+
+	return identifier, nil
+}
+
+// VerifyIdentifier Отмечает идентификатор подтверждённым и стирает код
+// Пока код шёл к пользователю, тот же адрес мог подтвердить кто-то другой, тогда возвращается ErrIdentifierExists
+func (s *Storage) VerifyIdentifier(ctx context.Context, userID int64, kind string) error {
+	const operation = "storage.memory.VerifyIdentifier"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := identifierKey{userID: userID, kind: kind}
+
+	identifier, ok := s.identifiers[key]
+	if !ok {
+		return fmt.Errorf("%s: %w", operation, storage.ErrIdentifierNotFound)
+	}
+
+	if s.identifierTaken(identifier) {
+		return fmt.Errorf("%s: %w", operation, storage.ErrIdentifierExists)
+	}
+
+	identifier.VerifiedAt = time.Now()
+	identifier.CodeHash = ""
+	s.identifiers[key] = identifier
+
+	return nil
+}
+
+// DeleteIdentifier Удаляет почту или телефон пользователя
+func (s *Storage) DeleteIdentifier(ctx context.Context, userID int64, kind string) error {
+	const operation = "storage.memory.DeleteIdentifier"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := identifierKey{userID: userID, kind: kind}
+
+	if _, ok := s.identifiers[key]; !ok {
+		return fmt.Errorf("%s: %w", operation, storage.ErrIdentifierNotFound)
+	}
+
+	delete(s.identifiers, key)
+
+	return nil
+}
+
+// Занят ли идентификатор другим пользователем: подтверждён им или совпадает с его именем.
+// Вызывается под s.mu
+func (s *Storage) identifierTaken(identifier models.Identifier) bool {
+	for key, other := range s.identifiers {
+		if key.userID != identifier.UserId && other.Kind == identifier.Kind &&
+			other.Canonical == identifier.Canonical && other.Verified() {
+			return true
+		}
+	}
+
+	id, ok := s.byCanonical[usernames.Canonical(identifier.Value)]
+
+	return ok && id != identifier.UserId
+}
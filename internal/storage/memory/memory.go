@@ -0,0 +1,399 @@
+// Package memory Хранилище в памяти процесса для тестов и временных окружений
+// Поведение и ошибки повторяют хранилище sqlite, данные пропадают вместе с процессом
+package memory
+
+import (
+	"context"
+	"fmt"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/lib/usernames"
+	"shilka-sso/internal/storage"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Storage Все данные лежат в map'ах и срезах под одним мьютексом, поэтому каждый метод
+// видит и меняет их целиком, как транзакция в бд
+type Storage struct {
+	mu sync.RWMutex
+
+	users       map[int64]*user
+	byCanonical map[string]int64
+	lastUserID  int64
+
+	apps map[int]models.App
+
+	identifiers        map[identifierKey]models.Identifier
+	statusHistory      []models.AccountStatusChange
+	lastStatusChangeID int64
+	erasureRequests    map[int64]models.ErasureRequest
+
+	auditRecords     []models.AuditRecord
+	auditCheckpoints []models.AuditCheckpoint
+
+	events      []*event
+	lastEventID int64
+
+	webhooks           map[int64]models.Webhook
+	lastWebhookID      int64
+	deliveries         map[int64]*models.WebhookDelivery
+	lastDeliveryID     int64
+	authCodes          map[string]authCode
+	serviceAccounts    map[int64]models.ServiceAccount
+	lastServiceAccount int64
+	deviceCodes        map[string]models.DeviceCode
+
+	federatedIdentities map[federatedKey]models.FederatedIdentity
+	connectorStates     map[string]models.ConnectorState
+
+	personalTokens    map[int64]models.PersonalToken
+	lastPersonalToken int64
+
+	challenges map[string]models.PasswordlessChallenge
+
+	relyingParties  map[int]models.RelyingParty
+	passkeys        map[int64]models.Passkey
+	lastPasskeyID   int64
+	passkeySessions map[string]models.PasskeySession
+}
+
+// Строка users: кроме полей пользователя хранит каноническую форму имени и права администратора
+type user struct {
+	models.User
+	canonical string
+	isAdmin   bool
+}
+
+// New Создаёт пустое хранилище с приложениями apps
+// Приложения в sqlite добавляются напрямую в бд, здесь их можно передать только при создании
+func New(apps ...models.App) (*Storage, error) {
+	const operation = "storage.memory.New"
+
+	s := &Storage{
+		users:               make(map[int64]*user),
+		byCanonical:         make(map[string]int64),
+		apps:                make(map[int]models.App),
+		identifiers:         make(map[identifierKey]models.Identifier),
+		erasureRequests:     make(map[int64]models.ErasureRequest),
+		webhooks:            make(map[int64]models.Webhook),
+		deliveries:          make(map[int64]*models.WebhookDelivery),
+		authCodes:           make(map[string]authCode),
+		serviceAccounts:     make(map[int64]models.ServiceAccount),
+		deviceCodes:         make(map[string]models.DeviceCode),
+		federatedIdentities: make(map[federatedKey]models.FederatedIdentity),
+		connectorStates:     make(map[string]models.ConnectorState),
+		personalTokens:      make(map[int64]models.PersonalToken),
+		challenges:          make(map[string]models.PasswordlessChallenge),
+		relyingParties:      make(map[int]models.RelyingParty),
+		passkeys:            make(map[int64]models.Passkey),
+		passkeySessions:     make(map[string]models.PasskeySession),
+	}
+
+	for _, app := range apps {
+		// Как и в sqlite, id, имя и секрет приложения уникальны
+		for _, existing := range s.apps {
+			if existing.Id == app.Id || existing.Name == app.Name || existing.Secret == app.Secret {
+				return nil, fmt.Errorf("%s: app %d: %w", operation, app.Id, storage.ErrAppExists)
+			}
+		}
+
+		app.RedirectURIs = slices.Clone(app.RedirectURIs)
+		s.apps[app.Id] = app
+	}
+
+	return s, nil
+}
+
+// Close Ничего не делает, нужен для совместимости с остальными хранилищами
+func (s *Storage) Close() error {
+	return nil
+}
+
+// SaveUser Сохрарняет пользователя
+// Вместе с пользователем в outbox пишется событие о регистрации
+func (s *Storage) SaveUser(ctx context.Context, username string, passwordHash []byte) (int64, error) {
+	const operation = "storage.memory.SaveUser"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id, err := s.insertUser(username, passwordHash)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return id, nil
+}
+
+// Добавляет пользователя и событие о его регистрации, вызывается под s.mu
+// Имя уникально в канонической форме, поэтому "Admin" не получится создать рядом с "admin"
+func (s *Storage) insertUser(username string, passwordHash []byte) (int64, error) {
+	canonical := usernames.Canonical(username)
+
+	if _, ok := s.byCanonical[canonical]; ok {
+		return 0, storage.ErrUserExists
+	}
+
+	s.lastUserID++
+	id := s.lastUserID
+
+	s.users[id] = &user{
+		User: models.User{
+			Id:           id,
+			Username:     username,
+			PasswordHash: slices.Clone(passwordHash),
+			Status:       models.AccountActive,
+		},
+		canonical: canonical,
+	}
+	s.byCanonical[canonical] = id
+
+	err := s.insertEvent(models.EventUserRegistered, models.UserEventPayload{
+		UserId:   id,
+		Username: username,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// GetUser Получает информацию о пользователе по username.
+// Имя сравнивается в канонической форме
+func (s *Storage) GetUser(ctx context.Context, username string) (models.User, error) {
+	const operation = "storage.memory.GetUser"
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	id, ok := s.byCanonical[usernames.Canonical(username)]
+	if !ok {
+		return models.User{}, fmt.Errorf("%s: %w", operation, storage.ErrUserNotFound)
+	}
+
+	return s.users[id].copy(), nil
+}
+
+// UserByID Получает информацию о пользователе по id.
+func (s *Storage) UserByID(ctx context.Context, userID int64) (models.User, error) {
+	const operation = "storage.memory.UserByID"
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	u, ok := s.users[userID]
+	if !ok {
+		return models.User{}, fmt.Errorf("%s: %w", operation, storage.ErrUserNotFound)
+	}
+
+	return u.copy(), nil
+}
+
+// IsAdmin Определяет является ли пользователь админом.
+func (s *Storage) IsAdmin(ctx context.Context, userID int64) (bool, error) {
+	const operation = "storage.memory.IsAdmin"
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	u, ok := s.users[userID]
+	if !ok {
+		return false, fmt.Errorf("%s: %w", operation, storage.ErrUserNotFound)
+	}
+
+	return u.isAdmin, nil
+}
+
+// SetAdmin Выдаёт или забирает у пользователя права администратора
+// Вместе с изменением в outbox пишется событие о смене роли
+func (s *Storage) SetAdmin(ctx context.Context, userID int64, isAdmin bool) error {
+	const operation = "storage.memory.SetAdmin"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[userID]
+	if !ok {
+		return fmt.Errorf("%s: %w", operation, storage.ErrUserNotFound)
+	}
+
+	err := s.insertEvent(models.EventUserRoleChanged, models.UserEventPayload{
+		UserId:  userID,
+		IsAdmin: &isAdmin,
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	u.isAdmin = isAdmin
+
+	return nil
+}
+
+// SetUsername Меняет имя пользователя
+// Имя уникально в канонической форме, как и при регистрации. Вместе с изменением в outbox пишется событие
+func (s *Storage) SetUsername(ctx context.Context, userID int64, username string) error {
+	const operation = "storage.memory.SetUsername"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	canonical := usernames.Canonical(username)
+
+	if id, ok := s.byCanonical[canonical]; ok && id != userID {
+		return fmt.Errorf("%s: %w", operation, storage.ErrUserExists)
+	}
+
+	u, ok := s.users[userID]
+	if !ok {
+		return fmt.Errorf("%s: %w", operation, storage.ErrUserNotFound)
+	}
+
+	err := s.insertEvent(models.EventUserRenamed, models.UserEventPayload{
+		UserId:   userID,
+		Username: username,
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	s.rename(u, username)
+
+	return nil
+}
+
+// Меняет имя и каноническую форму пользователя, вызывается под s.mu
+func (s *Storage) rename(u *user, username string) {
+	delete(s.byCanonical, u.canonical)
+
+	u.Username = username
+	u.canonical = usernames.Canonical(username)
+	s.byCanonical[u.canonical] = u.Id
+}
+
+// SetPasswordHash Меняет хэш пароля пользователя
+func (s *Storage) SetPasswordHash(ctx context.Context, userID int64, passwordHash []byte) error {
+	const operation = "storage.memory.SetPasswordHash"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[userID]
+	if !ok {
+		return fmt.Errorf("%s: %w", operation, storage.ErrUserNotFound)
+	}
+
+	u.PasswordHash = slices.Clone(passwordHash)
+
+	return nil
+}
+
+// ListUsers Возвращает до limit пользователей с id больше afterID по возрастанию id
+// Чтобы пройти всех пользователей, следующую страницу запрашивают с id последнего пользователя
+func (s *Storage) ListUsers(ctx context.Context, afterID int64, limit int) ([]models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var result []models.User
+
+	for _, id := range sortedKeys(s.users) {
+		if len(result) == limit {
+			break
+		}
+
+		if id > afterID {
+			result = append(result, s.users[id].copy())
+		}
+	}
+
+	return result, nil
+}
+
+// GetApp Взвращает приложение по айди
+func (s *Storage) GetApp(ctx context.Context, appID int) (models.App, error) {
+	const operation = "storage.memory.GetApp"
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	app, ok := s.apps[appID]
+	if !ok {
+		return models.App{}, fmt.Errorf("%s: %w", operation, storage.ErrAppNotFound)
+	}
+
+	app.RedirectURIs = slices.Clone(app.RedirectURIs)
+	app.Scopes = slices.Clone(app.Scopes)
+
+	return app, nil
+}
+
+// SetAppRedirectURIs Заменяет список адресов возврата приложения
+func (s *Storage) SetAppRedirectURIs(ctx context.Context, appID int, redirectURIs []string) error {
+	const operation = "storage.memory.SetAppRedirectURIs"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	app, ok := s.apps[appID]
+	if !ok {
+		return fmt.Errorf("%s: %w", operation, storage.ErrAppNotFound)
+	}
+
+	app.RedirectURIs = nil
+	if len(redirectURIs) > 0 {
+		app.RedirectURIs = slices.Clone(redirectURIs)
+	}
+
+	s.apps[appID] = app
+
+	return nil
+}
+
+// SetAppScopes Заменяет список scope, которые приложение может запрашивать
+func (s *Storage) SetAppScopes(ctx context.Context, appID int, scopes []string) error {
+	const operation = "storage.memory.SetAppScopes"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	app, ok := s.apps[appID]
+	if !ok {
+		return fmt.Errorf("%s: %w", operation, storage.ErrAppNotFound)
+	}
+
+	app.Scopes = nil
+	if len(scopes) > 0 {
+		app.Scopes = slices.Clone(scopes)
+	}
+
+	s.apps[appID] = app
+
+	return nil
+}
+
+// Возвращает копию пользователя, которую вызывающий может менять
+func (u *user) copy() models.User {
+	result := u.User
+	result.PasswordHash = slices.Clone(u.PasswordHash)
+
+	return result
+}
+
+// Отсортированные по возрастанию ключи map
+func sortedKeys[K int | int64 | string, V any](m map[K]V) []K {
+	keys := make([]K, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+
+	slices.Sort(keys)
+
+	return keys
+}
+
+// Истекло ли время expiresAt к now. Граница считается истёкшей, как expires_at <= now в sqlite
+func expired(expiresAt time.Time, now time.Time) bool {
+	return !expiresAt.After(now)
+}
@@ -0,0 +1,220 @@
+package memory_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"log/slog"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/lib/auditchain"
+	"shilka-sso/internal/services/audit"
+	"shilka-sso/internal/storage"
+	"shilka-sso/internal/storage/memory"
+	"shilka-sso/internal/storage/storagetest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T, apps ...models.App) storagetest.Storage {
+		st, err := memory.New(apps...)
+		require.NoError(t, err)
+
+		return st
+	})
+}
+
+func TestUsers(t *testing.T) {
+	ctx := context.Background()
+	st, err := memory.New()
+	require.NoError(t, err)
+
+	id, err := st.SaveUser(ctx, "Ivan", []byte("hash"))
+	require.NoError(t, err)
+
+	// Имена уникальны в канонической форме
+	_, err = st.SaveUser(ctx, "ivan", []byte("hash"))
+	assert.ErrorIs(t, err, storage.ErrUserExists)
+
+	user, err := st.GetUser(ctx, "IVAN")
+	require.NoError(t, err)
+	assert.Equal(t, id, user.Id)
+	assert.Equal(t, "Ivan", user.Username)
+	assert.Equal(t, []byte("hash"), user.PasswordHash)
+	assert.Equal(t, models.AccountActive, user.Status)
+
+	// Вызывающий получает копию и не может поменять хранилище
+	user.PasswordHash[0] = 'x'
+
+	user, err = st.UserByID(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("hash"), user.PasswordHash)
+
+	_, err = st.GetUser(ctx, "petr")
+	assert.ErrorIs(t, err, storage.ErrUserNotFound)
+
+	_, err = st.UserByID(ctx, id+1)
+	assert.ErrorIs(t, err, storage.ErrUserNotFound)
+
+	require.NoError(t, st.SetAdmin(ctx, id, true))
+
+	isAdmin, err := st.IsAdmin(ctx, id)
+	require.NoError(t, err)
+	assert.True(t, isAdmin)
+
+	_, err = st.IsAdmin(ctx, id+1)
+	assert.ErrorIs(t, err, storage.ErrUserNotFound)
+
+	events, err := st.PendingEvents(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, models.EventUserRegistered, events[0].Type)
+	assert.Equal(t, models.EventUserRoleChanged, events[1].Type)
+}
+
+func TestApps(t *testing.T) {
+	ctx := context.Background()
+
+	_, err := memory.New(
+		models.App{Id: 1, Name: "test", Secret: "secret"},
+		models.App{Id: 2, Name: "test", Secret: "other"},
+	)
+	assert.ErrorIs(t, err, storage.ErrAppExists)
+
+	st, err := memory.New(models.App{Id: 1, Name: "test", Secret: "secret"})
+	require.NoError(t, err)
+
+	require.NoError(t, st.SetAppRedirectURIs(ctx, 1, []string{"https://a.example/cb"}))
+
+	app, err := st.GetApp(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "test", app.Name)
+	assert.Equal(t, []string{"https://a.example/cb"}, app.RedirectURIs)
+
+	_, err = st.GetApp(ctx, 2)
+	assert.ErrorIs(t, err, storage.ErrAppNotFound)
+
+	_, err = st.SaveWebhook(ctx, models.Webhook{AppId: 2, EventType: models.EventUserRegistered, URL: "https://a.example/hook"})
+	assert.ErrorIs(t, err, storage.ErrAppNotFound)
+}
+
+func TestConcurrentSaveUser(t *testing.T) {
+	ctx := context.Background()
+	st, err := memory.New()
+	require.NoError(t, err)
+
+	const workers = 20
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers*2)
+
+	for i := range workers {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			// Каждое имя регистрируют дважды, ровно одна попытка должна упасть
+			for range 2 {
+				_, err := st.SaveUser(ctx, fmt.Sprintf("user%d", i), []byte("hash"))
+				errs <- err
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+
+	var failed int
+
+	for err := range errs {
+		if err != nil {
+			assert.ErrorIs(t, err, storage.ErrUserExists)
+			failed++
+		}
+	}
+
+	assert.Equal(t, workers, failed)
+
+	events, err := st.PendingEvents(ctx, workers*2)
+	require.NoError(t, err)
+	assert.Len(t, events, workers)
+}
+
+func TestAuditChainAndErasure(t *testing.T) {
+	ctx := context.Background()
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	st, err := memory.New()
+	require.NoError(t, err)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	userID, err := st.SaveUser(ctx, "ivan", []byte("hash"))
+	require.NoError(t, err)
+
+	auditService := audit.New(log, st, key)
+	require.NoError(t, auditService.Record(ctx, models.AuditUserRegistered, userID, 0, map[string]any{"username": "ivan"}))
+	require.NoError(t, auditService.Checkpoint(ctx))
+
+	records, err := st.UserAuditRecords(ctx, userID)
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+
+	events, err := st.PendingEvents(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	require.NoError(t, st.MarkEventDelivered(ctx, events[0].Id))
+
+	// Недоставляемое событие тоже хранит имя и удаляется
+	require.NoError(t, st.SetAdmin(ctx, userID, true))
+
+	events, err = st.PendingEvents(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	require.NoError(t, st.MarkEventFailed(ctx, events[0].Id, "event is rejected", time.Now(), true))
+
+	erased, err := auditchain.NewRecord(models.AuditUserErased, userID, 0, map[string]any{
+		models.AuditRedactedRecordsField: []int64{records[0].Id},
+	}, time.Now())
+	require.NoError(t, err)
+
+	require.NoError(t, st.EraseUser(ctx, userID, []int64{records[0].Id}, erased))
+
+	user, err := st.UserByID(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, models.ErasedUsername(userID), user.Username)
+
+	dead, err := st.DeadEvents(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, dead)
+
+	// Имя освобождается и может достаться новому пользователю
+	_, err = st.SaveUser(ctx, "ivan", []byte("hash"))
+	require.NoError(t, err)
+
+	events, err = st.PendingEvents(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, models.EventUserDeleted, events[0].Type)
+
+	// Запись user.erased пишется вместе с удалением, и цепочка по-прежнему сходится
+	records, err = st.UserAuditRecords(ctx, userID)
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	assert.NotContains(t, records[0].Payload, "ivan")
+	assert.False(t, records[0].RedactedAt.IsZero())
+	assert.Equal(t, models.AuditUserErased, records[1].Event)
+
+	report, err := auditService.VerifyChain(ctx)
+	require.NoError(t, err)
+	assert.True(t, report.Ok, report.Reason)
+
+	assert.ErrorIs(t, st.EraseUser(ctx, userID, nil, erased), storage.ErrUserNotFound)
+}
@@ -0,0 +1,51 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/storage"
+	"time"
+)
+
+// Строка oauth_codes
+type authCode struct {
+	models.AuthCode
+	used bool
+}
+
+// SaveAuthCode Сохраняет код авторизации OAuth
+func (s *Storage) SaveAuthCode(ctx context.Context, code models.AuthCode) error {
+	const operation = "storage.memory.SaveAuthCode"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.authCodes[code.CodeHash]; ok {
+		return fmt.Errorf("%s: %w", operation, errors.New("auth code already exists"))
+	}
+
+	s.authCodes[code.CodeHash] = authCode{AuthCode: code}
+
+	return nil
+}
+
+// ConsumeAuthCode Возвращает код авторизации и сразу помечает его использованным
+// Использованный или просроченный код считается не найденным
+func (s *Storage) ConsumeAuthCode(ctx context.Context, codeHash string) (models.AuthCode, error) {
+	const operation = "storage.memory.ConsumeAuthCode"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	code, ok := s.authCodes[codeHash]
+	if !ok || code.used || expired(code.ExpiresAt, time.Now()) {
+		return models.AuthCode{}, fmt.Errorf("%s: %w", operation, storage.ErrAuthCodeNotFound)
+	}
+
+	code.used = true
+	s.authCodes[codeHash] = code
+
+	return code.AuthCode, nil
+}
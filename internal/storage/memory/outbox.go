@@ -0,0 +1,148 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/storage"
+	"slices"
+	"time"
+)
+
+// Строка outbox
+type event struct {
+	models.Event
+	deliveredAt time.Time
+}
+
+// Кладёт событие в outbox, вызывается под s.mu вместе с изменением данных пользователя
+func (s *Storage) insertEvent(eventType string, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	s.lastEventID++
+
+	s.events = append(s.events, &event{
+		Event: models.Event{
+			Id:        s.lastEventID,
+			Type:      eventType,
+			Payload:   data,
+			CreatedAt: time.Now(),
+		},
+	})
+
+	return nil
+}
+
+// PendingEvents Возвращает до limit ещё не доставленных событий по порядку, кроме недоставляемых
+// Событие отдаётся и до наступления NextAttemptAt, чтобы диспетчер не опубликовал следующие раньше него
+func (s *Storage) PendingEvents(ctx context.Context, limit int) ([]models.Event, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var events []models.Event
+
+	for _, e := range s.events {
+		if len(events) == limit {
+			break
+		}
+
+		if !e.deliveredAt.IsZero() || !e.DeadAt.IsZero() {
+			continue
+		}
+
+		result := e.Event
+		result.Payload = slices.Clone(e.Payload)
+		events = append(events, result)
+	}
+
+	return events, nil
+}
+
+// DeadEvents Возвращает недоставляемые события по порядку
+func (s *Storage) DeadEvents(ctx context.Context) ([]models.Event, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var events []models.Event
+
+	for _, e := range s.events {
+		if e.DeadAt.IsZero() {
+			continue
+		}
+
+		result := e.Event
+		result.Payload = slices.Clone(e.Payload)
+		events = append(events, result)
+	}
+
+	return events, nil
+}
+
+// MarkEventDelivered Отмечает событие доставленным
+func (s *Storage) MarkEventDelivered(ctx context.Context, eventID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e := s.event(eventID); e != nil {
+		e.deliveredAt = time.Now()
+		e.Attempts++
+		e.LastError = ""
+	}
+
+	return nil
+}
+
+// MarkEventFailed Запоминает неудачную попытку доставки события и время следующей
+// Если dead, событие больше не отдаётся PendingEvents
+func (s *Storage) MarkEventFailed(ctx context.Context, eventID int64, reason string, nextAttemptAt time.Time, dead bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e := s.event(eventID); e != nil {
+		e.Attempts++
+		e.LastError = reason
+		e.NextAttemptAt = nextAttemptAt
+
+		if dead {
+			e.DeadAt = time.Now()
+		}
+	}
+
+	return nil
+}
+
+// ReplayDeadEvent Возвращает недоставляемое событие в очередь с обнулёнными попытками
+func (s *Storage) ReplayDeadEvent(ctx context.Context, eventID int64) error {
+	const operation = "storage.memory.ReplayDeadEvent"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e := s.event(eventID)
+	if e == nil || e.DeadAt.IsZero() {
+		return fmt.Errorf("%s: %w", operation, storage.ErrEventNotFound)
+	}
+
+	e.Attempts = 0
+	e.NextAttemptAt = time.Time{}
+	e.DeadAt = time.Time{}
+
+	return nil
+}
+
+// Событие по id или nil, вызывается под s.mu
+func (s *Storage) event(eventID int64) *event {
+	i, ok := slices.BinarySearchFunc(s.events, eventID, func(e *event, id int64) int {
+		return cmp.Compare(e.Id, id)
+	})
+	if !ok {
+		return nil
+	}
+
+	return s.events[i]
+}
@@ -0,0 +1,195 @@
+package memory
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/storage"
+	"slices"
+	"time"
+)
+
+// RelyingParty Возвращает настройки WebAuthn приложения
+func (s *Storage) RelyingParty(ctx context.Context, appID int) (models.RelyingParty, error) {
+	const operation = "storage.memory.RelyingParty"
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rp, ok := s.relyingParties[appID]
+	if !ok {
+		return models.RelyingParty{}, fmt.Errorf("%s: %w", operation, storage.ErrRelyingPartyNotFound)
+	}
+
+	rp.Origins = slices.Clone(rp.Origins)
+
+	return rp, nil
+}
+
+// SetRelyingParty Сохраняет или заменяет настройки WebAuthn приложения
+func (s *Storage) SetRelyingParty(ctx context.Context, rp models.RelyingParty) error {
+	const operation = "storage.memory.SetRelyingParty"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.apps[rp.AppId]; !ok {
+		return fmt.Errorf("%s: %w", operation, storage.ErrAppNotFound)
+	}
+
+	rp.Origins = slices.Clone(rp.Origins)
+	s.relyingParties[rp.AppId] = rp
+
+	return nil
+}
+
+// SavePasskey Сохраняет ключ WebAuthn пользователя
+func (s *Storage) SavePasskey(ctx context.Context, passkey models.Passkey) (int64, error) {
+	const operation = "storage.memory.SavePasskey"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.passkeyByCredentialID(passkey.CredentialId); ok {
+		return 0, fmt.Errorf("%s: %w", operation, storage.ErrPasskeyExists)
+	}
+
+	s.lastPasskeyID++
+	passkey.Id = s.lastPasskeyID
+	passkey.LastUsedAt = time.Time{}
+	s.passkeys[passkey.Id] = copyPasskey(passkey)
+
+	return passkey.Id, nil
+}
+
+// Passkeys Возвращает ключи пользователя для всех доменов
+func (s *Storage) Passkeys(ctx context.Context, userID int64) ([]models.Passkey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var passkeys []models.Passkey
+
+	for _, id := range sortedKeys(s.passkeys) {
+		if passkey := s.passkeys[id]; passkey.UserId == userID {
+			passkeys = append(passkeys, copyPasskey(passkey))
+		}
+	}
+
+	return passkeys, nil
+}
+
+// PasskeyByCredentialID Возвращает ключ по id, который выдал аутентификатор
+func (s *Storage) PasskeyByCredentialID(ctx context.Context, credentialID []byte) (models.Passkey, error) {
+	const operation = "storage.memory.PasskeyByCredentialID"
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	passkey, ok := s.passkeyByCredentialID(credentialID)
+	if !ok {
+		return models.Passkey{}, fmt.Errorf("%s: %w", operation, storage.ErrPasskeyNotFound)
+	}
+
+	return copyPasskey(passkey), nil
+}
+
+// UpdatePasskeyUsage Запоминает новый счётчик подписей и время входа
+func (s *Storage) UpdatePasskeyUsage(ctx context.Context, passkeyID int64, signCount uint32, usedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if passkey, ok := s.passkeys[passkeyID]; ok {
+		passkey.SignCount = signCount
+		passkey.LastUsedAt = usedAt
+		s.passkeys[passkeyID] = passkey
+	}
+
+	return nil
+}
+
+// DeletePasskey Удаляет ключ пользователя, чужой ключ считается не найденным
+func (s *Storage) DeletePasskey(ctx context.Context, userID int64, passkeyID int64) error {
+	const operation = "storage.memory.DeletePasskey"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	passkey, ok := s.passkeys[passkeyID]
+	if !ok || passkey.UserId != userID {
+		return fmt.Errorf("%s: %w", operation, storage.ErrPasskeyNotFound)
+	}
+
+	delete(s.passkeys, passkeyID)
+
+	return nil
+}
+
+// SavePasskeySession Сохраняет начатую церемонию WebAuthn
+func (s *Storage) SavePasskeySession(ctx context.Context, session models.PasskeySession) error {
+	const operation = "storage.memory.SavePasskeySession"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.passkeySessions[session.Id]; ok {
+		return fmt.Errorf("%s: %w", operation, errors.New("passkey session already exists"))
+	}
+
+	session.Data = slices.Clone(session.Data)
+	s.passkeySessions[session.Id] = session
+
+	return nil
+}
+
+// ConsumePasskeySession Возвращает и удаляет церемонию, каждую можно завершить только один раз
+// Просроченная церемония считается не найденной
+func (s *Storage) ConsumePasskeySession(ctx context.Context, sessionID string) (models.PasskeySession, error) {
+	const operation = "storage.memory.ConsumePasskeySession"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.passkeySessions[sessionID]
+	if !ok {
+		return models.PasskeySession{}, fmt.Errorf("%s: %w", operation, storage.ErrPasskeySessionNotFound)
+	}
+
+	// Заодно удаляем все просроченные церемонии
+	now := time.Now()
+
+	delete(s.passkeySessions, sessionID)
+
+	for id, other := range s.passkeySessions {
+		if expired(other.ExpiresAt, now) {
+			delete(s.passkeySessions, id)
+		}
+	}
+
+	if now.After(session.ExpiresAt) {
+		return models.PasskeySession{}, fmt.Errorf("%s: %w", operation, storage.ErrPasskeySessionNotFound)
+	}
+
+	return session, nil
+}
+
+// Ключ по id аутентификатора, вызывается под s.mu
+func (s *Storage) passkeyByCredentialID(credentialID []byte) (models.Passkey, bool) {
+	for _, passkey := range s.passkeys {
+		if bytes.Equal(passkey.CredentialId, credentialID) {
+			return passkey, true
+		}
+	}
+
+	return models.Passkey{}, false
+}
+
+func copyPasskey(passkey models.Passkey) models.Passkey {
+	passkey.CredentialId = slices.Clone(passkey.CredentialId)
+	passkey.PublicKey = slices.Clone(passkey.PublicKey)
+	passkey.AAGUID = slices.Clone(passkey.AAGUID)
+	passkey.Transports = slices.Clone(passkey.Transports)
+
+	return passkey
+}
@@ -0,0 +1,76 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/storage"
+	"time"
+)
+
+// SavePasswordlessChallenge Сохраняет вход без пароля
+func (s *Storage) SavePasswordlessChallenge(ctx context.Context, challenge models.PasswordlessChallenge) error {
+	const operation = "storage.memory.SavePasswordlessChallenge"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.challenges[challenge.Id]; ok {
+		return fmt.Errorf("%s: %w", operation, errors.New("passwordless challenge already exists"))
+	}
+
+	challenge.Attempts = 0
+	s.challenges[challenge.Id] = challenge
+
+	return nil
+}
+
+// UsePasswordlessAttempt Тратит одну попытку ввода кода и возвращает вход
+// Если попытки кончились или вход просрочен, он считается не найденным
+func (s *Storage) UsePasswordlessAttempt(
+	ctx context.Context,
+	challengeID string,
+	maxAttempts int,
+) (models.PasswordlessChallenge, error) {
+	const operation = "storage.memory.UsePasswordlessAttempt"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	challenge, ok := s.challenges[challengeID]
+	if !ok || challenge.Attempts >= maxAttempts || expired(challenge.ExpiresAt, time.Now()) {
+		return models.PasswordlessChallenge{}, fmt.Errorf("%s: %w", operation, storage.ErrPasswordlessChallengeNotFound)
+	}
+
+	challenge.Attempts++
+	s.challenges[challengeID] = challenge
+
+	return challenge, nil
+}
+
+// DeletePasswordlessChallenge Удаляет вход после успешного ввода кода
+// Если вход уже удалён параллельным запросом, он считается не найденным, так код нельзя использовать дважды
+func (s *Storage) DeletePasswordlessChallenge(ctx context.Context, challengeID string) error {
+	const operation = "storage.memory.DeletePasswordlessChallenge"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.challenges[challengeID]; !ok {
+		return fmt.Errorf("%s: %w", operation, storage.ErrPasswordlessChallengeNotFound)
+	}
+
+	delete(s.challenges, challengeID)
+
+	// Заодно удаляем все просроченные входы
+	now := time.Now()
+
+	for id, challenge := range s.challenges {
+		if expired(challenge.ExpiresAt, now) {
+			delete(s.challenges, id)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,126 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/storage"
+	"slices"
+	"time"
+)
+
+// SavePersonalToken Сохраняет токен доступа пользователя
+// Хэш токена уникален, имя уникально в пределах пользователя
+func (s *Storage) SavePersonalToken(ctx context.Context, token models.PersonalToken) (int64, error) {
+	const operation = "storage.memory.SavePersonalToken"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.personalTokens {
+		if existing.TokenHash == token.TokenHash || existing.UserId == token.UserId && existing.Name == token.Name {
+			return 0, fmt.Errorf("%s: %w", operation, storage.ErrPersonalTokenExists)
+		}
+	}
+
+	s.lastPersonalToken++
+	token.Id = s.lastPersonalToken
+	token.Scopes = copyScopes(token.Scopes)
+	token.LastUsedAt = time.Time{}
+	s.personalTokens[token.Id] = token
+
+	return token.Id, nil
+}
+
+// PersonalTokenByHash Возвращает токен доступа по хэшу
+func (s *Storage) PersonalTokenByHash(ctx context.Context, tokenHash string) (models.PersonalToken, error) {
+	const operation = "storage.memory.PersonalTokenByHash"
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, token := range s.personalTokens {
+		if token.TokenHash == tokenHash {
+			token.Scopes = copyScopes(token.Scopes)
+			return token, nil
+		}
+	}
+
+	return models.PersonalToken{}, fmt.Errorf("%s: %w", operation, storage.ErrPersonalTokenNotFound)
+}
+
+// PersonalTokens Возвращает токены доступа пользователя
+func (s *Storage) PersonalTokens(ctx context.Context, userID int64) ([]models.PersonalToken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var tokens []models.PersonalToken
+
+	for _, id := range sortedKeys(s.personalTokens) {
+		token := s.personalTokens[id]
+		if token.UserId != userID {
+			continue
+		}
+
+		token.Scopes = copyScopes(token.Scopes)
+		tokens = append(tokens, token)
+	}
+
+	return tokens, nil
+}
+
+// DeletePersonalToken Удаляет токен доступа пользователя, чужой токен считается не найденным
+func (s *Storage) DeletePersonalToken(ctx context.Context, userID int64, tokenID int64) error {
+	const operation = "storage.memory.DeletePersonalToken"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.personalTokens[tokenID]
+	if !ok || token.UserId != userID {
+		return fmt.Errorf("%s: %w", operation, storage.ErrPersonalTokenNotFound)
+	}
+
+	delete(s.personalTokens, tokenID)
+
+	return nil
+}
+
+// DeletePersonalTokens Удаляет все токены доступа пользователя и возвращает их число
+func (s *Storage) DeletePersonalTokens(ctx context.Context, userID int64) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var deleted int64
+
+	for id, token := range s.personalTokens {
+		if token.UserId == userID {
+			delete(s.personalTokens, id)
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
+
+// TouchPersonalToken Запоминает время последнего использования токена
+func (s *Storage) TouchPersonalToken(ctx context.Context, tokenID int64, usedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if token, ok := s.personalTokens[tokenID]; ok {
+		token.LastUsedAt = usedAt
+		s.personalTokens[tokenID] = token
+	}
+
+	return nil
+}
+
+// Копия списка scope. Пустой список возвращается как nil, как после чтения из sqlite
+func copyScopes(scopes []string) []string {
+	if len(scopes) == 0 {
+		return nil
+	}
+
+	return slices.Clone(scopes)
+}
@@ -0,0 +1,104 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/storage"
+)
+
+// SaveServiceAccount Сохраняет сервисный аккаунт приложения
+// Client id уникален, имя уникально в пределах приложения
+func (s *Storage) SaveServiceAccount(ctx context.Context, account models.ServiceAccount) (int64, error) {
+	const operation = "storage.memory.SaveServiceAccount"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.apps[account.AppId]; !ok {
+		return 0, fmt.Errorf("%s: %w", operation, storage.ErrAppNotFound)
+	}
+
+	for _, existing := range s.serviceAccounts {
+		if existing.ClientId == account.ClientId || existing.AppId == account.AppId && existing.Name == account.Name {
+			return 0, fmt.Errorf("%s: %w", operation, storage.ErrServiceAccountExists)
+		}
+	}
+
+	s.lastServiceAccount++
+	account.Id = s.lastServiceAccount
+	account.Scopes = copyScopes(account.Scopes)
+	s.serviceAccounts[account.Id] = account
+
+	return account.Id, nil
+}
+
+// ServiceAccountByClientID Возвращает сервисный аккаунт по его client id
+func (s *Storage) ServiceAccountByClientID(ctx context.Context, clientID string) (models.ServiceAccount, error) {
+	const operation = "storage.memory.ServiceAccountByClientID"
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, account := range s.serviceAccounts {
+		if account.ClientId == clientID {
+			account.Scopes = copyScopes(account.Scopes)
+			return account, nil
+		}
+	}
+
+	return models.ServiceAccount{}, fmt.Errorf("%s: %w", operation, storage.ErrServiceAccountNotFound)
+}
+
+// ServiceAccountByID Возвращает сервисный аккаунт по id
+func (s *Storage) ServiceAccountByID(ctx context.Context, accountID int64) (models.ServiceAccount, error) {
+	const operation = "storage.memory.ServiceAccountByID"
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	account, ok := s.serviceAccounts[accountID]
+	if !ok {
+		return models.ServiceAccount{}, fmt.Errorf("%s: %w", operation, storage.ErrServiceAccountNotFound)
+	}
+
+	account.Scopes = copyScopes(account.Scopes)
+
+	return account, nil
+}
+
+// ServiceAccounts Возвращает сервисные аккаунты приложения
+func (s *Storage) ServiceAccounts(ctx context.Context, appID int) ([]models.ServiceAccount, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var accounts []models.ServiceAccount
+
+	for _, id := range sortedKeys(s.serviceAccounts) {
+		account := s.serviceAccounts[id]
+		if account.AppId != appID {
+			continue
+		}
+
+		account.Scopes = copyScopes(account.Scopes)
+		accounts = append(accounts, account)
+	}
+
+	return accounts, nil
+}
+
+// DeleteServiceAccount Удаляет сервисный аккаунт, после этого он не может получить новые токены
+func (s *Storage) DeleteServiceAccount(ctx context.Context, accountID int64) error {
+	const operation = "storage.memory.DeleteServiceAccount"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.serviceAccounts[accountID]; !ok {
+		return fmt.Errorf("%s: %w", operation, storage.ErrServiceAccountNotFound)
+	}
+
+	delete(s.serviceAccounts, accountID)
+
+	return nil
+}
@@ -0,0 +1,18 @@
+package memory
+
+import (
+	"context"
+	"shilka-sso/internal/domain/models"
+)
+
+// CanonicalizeUsernames Заполняет каноническую форму имён пользователей, у которых её ещё нет
+// В памяти пользователи всегда сохраняются вместе с канонической формой, поэтому заполнять нечего
+func (s *Storage) CanonicalizeUsernames(ctx context.Context) ([]models.UsernameCollision, error) {
+	return s.UsernameCollisions(ctx)
+}
+
+// UsernameCollisions Возвращает пользователей, чьё имя совпало с чужим в канонической форме
+// Совпадения остаются только от пользователей, созданных до канонической формы, в памяти их не бывает
+func (s *Storage) UsernameCollisions(ctx context.Context) ([]models.UsernameCollision, error) {
+	return nil, nil
+}
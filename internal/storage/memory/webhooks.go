@@ -0,0 +1,241 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/storage"
+	"slices"
+	"time"
+)
+
+// SaveWebhook Сохраняет вебхук приложения
+// Тип события и адрес уникальны в пределах приложения, как и в sqlite
+func (s *Storage) SaveWebhook(ctx context.Context, webhook models.Webhook) (int64, error) {
+	const operation = "storage.memory.SaveWebhook"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.apps[webhook.AppId]; !ok {
+		return 0, fmt.Errorf("%s: %w", operation, storage.ErrAppNotFound)
+	}
+
+	for _, existing := range s.webhooks {
+		if existing.AppId == webhook.AppId && existing.EventType == webhook.EventType && existing.URL == webhook.URL {
+			return 0, fmt.Errorf("%s: %w", operation, storage.ErrWebhookExists)
+		}
+	}
+
+	s.lastWebhookID++
+	webhook.Id = s.lastWebhookID
+	s.webhooks[webhook.Id] = webhook
+
+	return webhook.Id, nil
+}
+
+// Webhooks Возвращает вебхуки приложения
+func (s *Storage) Webhooks(ctx context.Context, appID int) ([]models.Webhook, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var webhooks []models.Webhook
+
+	for _, id := range sortedKeys(s.webhooks) {
+		if webhook := s.webhooks[id]; webhook.AppId == appID {
+			webhooks = append(webhooks, webhook)
+		}
+	}
+
+	return webhooks, nil
+}
+
+// DeleteWebhook Удаляет вебхук вместе с его доставками
+func (s *Storage) DeleteWebhook(ctx context.Context, webhookID int64) error {
+	const operation = "storage.memory.DeleteWebhook"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.webhooks[webhookID]; !ok {
+		return fmt.Errorf("%s: %w", operation, storage.ErrWebhookNotFound)
+	}
+
+	delete(s.webhooks, webhookID)
+
+	for id, delivery := range s.deliveries {
+		if delivery.WebhookId == webhookID {
+			delete(s.deliveries, id)
+		}
+	}
+
+	return nil
+}
+
+// EnqueueWebhookDeliveries Ставит событие в очередь на доставку во все вебхуки его типа
+// Повторная постановка того же события ничего не делает
+func (s *Storage) EnqueueWebhookDeliveries(ctx context.Context, event models.Event, body []byte) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+
+	queued := make(map[int64]bool)
+	for _, delivery := range s.deliveries {
+		if delivery.EventId == event.Id {
+			queued[delivery.WebhookId] = true
+		}
+	}
+
+	var affected int64
+
+	for _, id := range sortedKeys(s.webhooks) {
+		if s.webhooks[id].EventType != event.Type || queued[id] {
+			continue
+		}
+
+		s.lastDeliveryID++
+		s.deliveries[s.lastDeliveryID] = &models.WebhookDelivery{
+			Id:            s.lastDeliveryID,
+			WebhookId:     id,
+			EventId:       event.Id,
+			EventType:     event.Type,
+			Body:          slices.Clone(body),
+			Status:        models.WebhookDeliveryPending,
+			NextAttemptAt: now,
+			CreatedAt:     now,
+		}
+
+		affected++
+	}
+
+	return affected, nil
+}
+
+// DueWebhookDeliveries Возвращает до limit доставок, время попытки которых уже наступило
+func (s *Storage) DueWebhookDeliveries(ctx context.Context, now time.Time, limit int) ([]models.WebhookDelivery, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	deliveries := s.webhookDeliveries(func(delivery *models.WebhookDelivery) bool {
+		return delivery.Status == models.WebhookDeliveryPending && !delivery.NextAttemptAt.After(now)
+	})
+
+	slices.SortStableFunc(deliveries, func(a, b models.WebhookDelivery) int {
+		return a.NextAttemptAt.Compare(b.NextAttemptAt)
+	})
+
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+
+	return deliveries, nil
+}
+
+// DeadWebhookDeliveries Возвращает доставки, попытки которых закончились
+// Если appID равен 0, возвращаются доставки всех приложений
+func (s *Storage) DeadWebhookDeliveries(ctx context.Context, appID int) ([]models.WebhookDelivery, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	deliveries := s.webhookDeliveries(func(delivery *models.WebhookDelivery) bool {
+		return delivery.Status == models.WebhookDeliveryDead
+	})
+
+	if appID != 0 {
+		deliveries = slices.DeleteFunc(deliveries, func(delivery models.WebhookDelivery) bool {
+			return delivery.AppId != appID
+		})
+	}
+
+	return deliveries, nil
+}
+
+// MarkWebhookDelivered Отмечает доставку успешной
+func (s *Storage) MarkWebhookDelivered(ctx context.Context, deliveryID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if delivery, ok := s.deliveries[deliveryID]; ok {
+		delivery.Status = models.WebhookDeliveryDelivered
+		delivery.Attempts++
+		delivery.LastError = ""
+	}
+
+	return nil
+}
+
+// MarkWebhookFailed Запоминает неудачную попытку доставки
+// Если dead, доставка больше не повторяется и попадает в список недоставленных
+func (s *Storage) MarkWebhookFailed(ctx context.Context, deliveryID int64, reason string, nextAttemptAt time.Time, dead bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delivery, ok := s.deliveries[deliveryID]
+	if !ok {
+		return nil
+	}
+
+	delivery.Status = models.WebhookDeliveryPending
+	if dead {
+		delivery.Status = models.WebhookDeliveryDead
+	}
+
+	delivery.Attempts++
+	delivery.LastError = reason
+	delivery.NextAttemptAt = nextAttemptAt
+
+	return nil
+}
+
+// ReplayWebhookDelivery Возвращает недоставленную доставку в очередь с обнулёнными попытками
+func (s *Storage) ReplayWebhookDelivery(ctx context.Context, deliveryID int64) error {
+	const operation = "storage.memory.ReplayWebhookDelivery"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delivery, ok := s.deliveries[deliveryID]
+	if !ok || delivery.Status != models.WebhookDeliveryDead {
+		return fmt.Errorf("%s: %w", operation, storage.ErrWebhookDeliveryNotFound)
+	}
+
+	delivery.Status = models.WebhookDeliveryPending
+	delivery.Attempts = 0
+	delivery.NextAttemptAt = time.Now()
+
+	return nil
+}
+
+// Доставки, подходящие под match, по возрастанию id. Адрес и секрет берутся из вебхука и приложения,
+// доставки без них пропускаются, как при JOIN в sqlite. Вызывается под s.mu
+func (s *Storage) webhookDeliveries(match func(delivery *models.WebhookDelivery) bool) []models.WebhookDelivery {
+	var deliveries []models.WebhookDelivery
+
+	for _, id := range sortedKeys(s.deliveries) {
+		delivery := s.deliveries[id]
+		if !match(delivery) {
+			continue
+		}
+
+		webhook, ok := s.webhooks[delivery.WebhookId]
+		if !ok {
+			continue
+		}
+
+		app, ok := s.apps[webhook.AppId]
+		if !ok {
+			continue
+		}
+
+		result := *delivery
+		result.AppId = webhook.AppId
+		result.URL = webhook.URL
+		result.Secret = app.Secret
+		result.Body = slices.Clone(delivery.Body)
+
+		deliveries = append(deliveries, result)
+	}
+
+	return deliveries
+}
@@ -0,0 +1,180 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/storage"
+	"time"
+)
+
+// Причина в истории, когда приостановка закончилась сама
+const suspensionExpiredReason = "suspension expired"
+
+// SetAccountStatus Меняет статус учётной записи и добавляет запись в историю статусов
+// Вместе с изменением в outbox пишется событие user.enabled или user.disabled
+func (s *Storage) SetAccountStatus(ctx context.Context, change models.AccountStatusChange) error {
+	const operation = "storage.postgres.SetAccountStatus"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+	defer tx.Rollback()
+
+	if err := setAccountStatus(ctx, tx, change); err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return nil
+}
+
+// AccountStatusHistory Возвращает историю статусов пользователя от старых записей к новым
+func (s *Storage) AccountStatusHistory(ctx context.Context, userID int64) ([]models.AccountStatusChange, error) {
+	const operation = "storage.postgres.AccountStatusHistory"
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, user_id, status, reason, suspended_until, actor_id, created_at
+		FROM account_status_history WHERE user_id = $1 ORDER BY id`,
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+	defer rows.Close()
+
+	var history []models.AccountStatusChange
+
+	for rows.Next() {
+		var change models.AccountStatusChange
+		var suspendedUntil sql.NullInt64
+		var createdAt int64
+
+		err := rows.Scan(&change.Id, &change.UserId, &change.Status, &change.Reason, &suspendedUntil,
+			&change.ActorId, &createdAt)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", operation, err)
+		}
+
+		if suspendedUntil.Valid {
+			change.SuspendedUntil = time.Unix(0, suspendedUntil.Int64)
+		}
+
+		change.CreatedAt = time.Unix(0, createdAt)
+
+		history = append(history, change)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return history, nil
+}
+
+// ReactivateSuspended Возвращает статус active пользователям, у которых к now закончилась приостановка
+// Возвращает id реактивированных пользователей
+func (s *Storage) ReactivateSuspended(ctx context.Context, now time.Time) ([]int64, error) {
+	const operation = "storage.postgres.ReactivateSuspended"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx,
+		"SELECT id FROM users WHERE status = $1 AND suspended_until <= $2 ORDER BY id",
+		models.AccountSuspended, now.UnixNano(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	var ids []int64
+
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("%s: %w", operation, err)
+		}
+
+		ids = append(ids, id)
+	}
+
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	for _, id := range ids {
+		err := setAccountStatus(ctx, tx, models.AccountStatusChange{
+			UserId:    id,
+			Status:    models.AccountActive,
+			Reason:    suspensionExpiredReason,
+			CreatedAt: now,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", operation, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return ids, nil
+}
+
+// Меняет статус, пишет историю и событие в рамках транзакции tx
+// Статус удалённого пользователя не меняется, такой пользователь считается не найденным
+func setAccountStatus(ctx context.Context, tx *sql.Tx, change models.AccountStatusChange) error {
+	var suspendedUntil sql.NullInt64
+	if !change.SuspendedUntil.IsZero() {
+		suspendedUntil = sql.NullInt64{Int64: change.SuspendedUntil.UnixNano(), Valid: true}
+	}
+
+	res, err := tx.ExecContext(ctx,
+		"UPDATE users SET status = $1, status_reason = $2, suspended_until = $3 WHERE id = $4 AND status != $5",
+		change.Status, change.Reason, suspendedUntil, change.UserId, models.AccountErased,
+	)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return storage.ErrUserNotFound
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO account_status_history(user_id, status, reason, suspended_until, actor_id, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		change.UserId, change.Status, change.Reason, suspendedUntil, change.ActorId, change.CreatedAt.UnixNano(),
+	)
+	if err != nil {
+		return err
+	}
+
+	event := models.EventUserDisabled
+	if change.Status == models.AccountActive {
+		event = models.EventUserEnabled
+	}
+
+	return insertEvent(ctx, tx, event, models.UserEventPayload{
+		UserId: change.UserId,
+		Status: change.Status,
+		Reason: change.Reason,
+	})
+}
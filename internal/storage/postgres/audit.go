@@ -0,0 +1,244 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/lib/auditchain"
+	"shilka-sso/internal/storage"
+	"time"
+)
+
+// Ключ advisory lock, под которым добавляются записи аудита
+const auditLockKey = 7_311_001
+
+// AppendAuditRecord Добавляет запись в конец цепочки аудита
+// Id, PrevHash и Hash записи вычисляются здесь, поэтому добавление идёт строго по одной записи.
+// Бд могут пользоваться несколько экземпляров сервера, поэтому вместо мьютекса берётся advisory lock
+func (s *Storage) AppendAuditRecord(ctx context.Context, record models.AuditRecord) (models.AuditRecord, error) {
+	const operation = "storage.postgres.AppendAuditRecord"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.AuditRecord{}, fmt.Errorf("%s: %w", operation, err)
+	}
+	defer tx.Rollback()
+
+	record, err = appendAuditRecord(ctx, tx, record)
+	if err != nil {
+		return models.AuditRecord{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.AuditRecord{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return record, nil
+}
+
+// Добавляет запись в конец цепочки внутри tx. Advisory lock держится до конца tx
+func appendAuditRecord(ctx context.Context, tx *sql.Tx, record models.AuditRecord) (models.AuditRecord, error) {
+	// Блокировка снимается вместе с окончанием транзакции
+	if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1)", auditLockKey); err != nil {
+		return models.AuditRecord{}, err
+	}
+
+	var lastID int64
+	prevHash := auditchain.GenesisHash
+
+	err := tx.QueryRowContext(ctx, "SELECT id, hash FROM audit_log ORDER BY id DESC LIMIT 1").Scan(&lastID, &prevHash)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return models.AuditRecord{}, err
+	}
+
+	record.Id = lastID + 1
+	record.PrevHash = prevHash
+	record.Hash = auditchain.RecordHash(record)
+
+	salts, err := encodeFieldSalts(record.FieldSalts)
+	if err != nil {
+		return models.AuditRecord{}, err
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO audit_log(id, event, user_id, app_id, payload, created_at, prev_hash, hash, field_salts) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)",
+		record.Id, record.Event, record.UserId, record.AppId, record.Payload, record.CreatedAt.UnixNano(), record.PrevHash, record.Hash, salts,
+	)
+	if err != nil {
+		return models.AuditRecord{}, err
+	}
+
+	return record, nil
+}
+
+// AuditRecords Возвращает до limit записей аудита с id больше afterID по порядку
+func (s *Storage) AuditRecords(ctx context.Context, afterID int64, limit int) ([]models.AuditRecord, error) {
+	const operation = "storage.postgres.AuditRecords"
+
+	records, err := s.queryAuditRecords(ctx,
+		"SELECT "+auditRecordColumns+" FROM audit_log WHERE id > $1 ORDER BY id LIMIT $2",
+		afterID, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return records, nil
+}
+
+// UserAuditRecords Возвращает все записи аудита о пользователе по порядку
+func (s *Storage) UserAuditRecords(ctx context.Context, userID int64) ([]models.AuditRecord, error) {
+	const operation = "storage.postgres.UserAuditRecords"
+
+	records, err := s.queryAuditRecords(ctx,
+		"SELECT "+auditRecordColumns+" FROM audit_log WHERE user_id = $1 ORDER BY id",
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return records, nil
+}
+
+// LastAuditRecord Возвращает последнюю запись цепочки аудита
+func (s *Storage) LastAuditRecord(ctx context.Context) (models.AuditRecord, error) {
+	const operation = "storage.postgres.LastAuditRecord"
+
+	row := s.db.QueryRowContext(ctx,
+		"SELECT "+auditRecordColumns+" FROM audit_log ORDER BY id DESC LIMIT 1",
+	)
+
+	record, err := scanAuditRecord(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.AuditRecord{}, fmt.Errorf("%s: %w", operation, storage.ErrAuditRecordNotFound)
+		}
+
+		return models.AuditRecord{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return record, nil
+}
+
+// SaveAuditCheckpoint Сохраняет подписанный чекпоинт цепочки аудита
+func (s *Storage) SaveAuditCheckpoint(ctx context.Context, checkpoint models.AuditCheckpoint) (int64, error) {
+	const operation = "storage.postgres.SaveAuditCheckpoint"
+
+	var id int64
+
+	err := s.db.QueryRowContext(ctx,
+		"INSERT INTO audit_checkpoints(record_id, hash, signature, created_at) VALUES ($1, $2, $3, $4) RETURNING id",
+		checkpoint.RecordId, checkpoint.Hash, checkpoint.Signature, checkpoint.CreatedAt.UnixNano(),
+	).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return id, nil
+}
+
+// AuditCheckpoints Возвращает все чекпоинты цепочки аудита по порядку
+func (s *Storage) AuditCheckpoints(ctx context.Context) ([]models.AuditCheckpoint, error) {
+	const operation = "storage.postgres.AuditCheckpoints"
+
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT id, record_id, hash, signature, created_at FROM audit_checkpoints ORDER BY id",
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+	defer rows.Close()
+
+	var checkpoints []models.AuditCheckpoint
+
+	for rows.Next() {
+		var checkpoint models.AuditCheckpoint
+		var createdAt int64
+
+		err := rows.Scan(&checkpoint.Id, &checkpoint.RecordId, &checkpoint.Hash, &checkpoint.Signature, &createdAt)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", operation, err)
+		}
+
+		checkpoint.CreatedAt = time.Unix(0, createdAt)
+		checkpoints = append(checkpoints, checkpoint)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return checkpoints, nil
+}
+
+const auditRecordColumns = "id, event, user_id, app_id, payload, created_at, prev_hash, hash, redacted_at, field_salts"
+
+func (s *Storage) queryAuditRecords(ctx context.Context, query string, args ...any) ([]models.AuditRecord, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []models.AuditRecord
+
+	for rows.Next() {
+		record, err := scanAuditRecord(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		records = append(records, record)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+func scanAuditRecord(row scanner) (models.AuditRecord, error) {
+	var record models.AuditRecord
+	var createdAt int64
+	var redactedAt sql.NullInt64
+	var salts sql.NullString
+
+	err := row.Scan(&record.Id, &record.Event, &record.UserId, &record.AppId, &record.Payload,
+		&createdAt, &record.PrevHash, &record.Hash, &redactedAt, &salts)
+	if err != nil {
+		return models.AuditRecord{}, err
+	}
+
+	if salts.Valid {
+		if err := json.Unmarshal([]byte(salts.String), &record.FieldSalts); err != nil {
+			return models.AuditRecord{}, fmt.Errorf("audit record %d: %w", record.Id, err)
+		}
+	}
+
+	record.CreatedAt = time.Unix(0, createdAt)
+
+	if redactedAt.Valid {
+		record.RedactedAt = time.Unix(0, redactedAt.Int64)
+	}
+
+	return record, nil
+}
+
+// Соли хранятся в JSON, у записей без солей в колонке NULL
+func encodeFieldSalts(salts map[string][]byte) (sql.NullString, error) {
+	if salts == nil {
+		return sql.NullString{}, nil
+	}
+
+	data, err := json.Marshal(salts)
+	if err != nil {
+		return sql.NullString{}, err
+	}
+
+	return sql.NullString{String: string(data), Valid: true}, nil
+}
@@ -0,0 +1,161 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/storage"
+	"time"
+)
+
+// SaveDeviceCode Сохраняет запрос на вход устройства
+func (s *Storage) SaveDeviceCode(ctx context.Context, code models.DeviceCode) error {
+	const operation = "storage.postgres.SaveDeviceCode"
+
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO device_codes(device_code_hash, user_code, app_id, scope, status, "interval", expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		code.DeviceCodeHash, code.UserCode, code.AppId, code.Scope, code.Status, int64(code.Interval),
+		code.ExpiresAt.UnixNano(), code.CreatedAt.UnixNano(),
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return nil
+}
+
+const deviceCodeColumns = `
+	device_code_hash, user_code, app_id, scope, status, user_id, "interval", last_polled_at, expires_at, created_at`
+
+// DeviceCode Возвращает запрос по хэшу device code в любом статусе
+func (s *Storage) DeviceCode(ctx context.Context, deviceCodeHash string) (models.DeviceCode, error) {
+	const operation = "storage.postgres.DeviceCode"
+
+	row := s.db.QueryRowContext(ctx,
+		"SELECT"+deviceCodeColumns+" FROM device_codes WHERE device_code_hash = $1",
+		deviceCodeHash,
+	)
+
+	code, err := scanDeviceCode(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.DeviceCode{}, fmt.Errorf("%s: %w", operation, storage.ErrDeviceCodeNotFound)
+		}
+
+		return models.DeviceCode{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return code, nil
+}
+
+// PendingDeviceCode Возвращает ожидающий подтверждения и не просроченный запрос по user code
+func (s *Storage) PendingDeviceCode(ctx context.Context, userCode string) (models.DeviceCode, error) {
+	const operation = "storage.postgres.PendingDeviceCode"
+
+	row := s.db.QueryRowContext(ctx,
+		"SELECT"+deviceCodeColumns+" FROM device_codes WHERE user_code = $1 AND status = $2 AND expires_at > $3",
+		userCode, models.DeviceCodePending, time.Now().UnixNano(),
+	)
+
+	code, err := scanDeviceCode(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.DeviceCode{}, fmt.Errorf("%s: %w", operation, storage.ErrDeviceCodeNotFound)
+		}
+
+		return models.DeviceCode{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return code, nil
+}
+
+// ResolveDeviceCode Подтверждает или отклоняет ожидающий запрос от имени пользователя
+func (s *Storage) ResolveDeviceCode(ctx context.Context, userCode string, userID int64, approved bool) error {
+	const operation = "storage.postgres.ResolveDeviceCode"
+
+	status := models.DeviceCodeDenied
+	if approved {
+		status = models.DeviceCodeApproved
+	}
+
+	res, err := s.db.ExecContext(ctx,
+		"UPDATE device_codes SET status = $1, user_id = $2 WHERE user_code = $3 AND status = $4 AND expires_at > $5",
+		status, userID, userCode, models.DeviceCodePending, time.Now().UnixNano(),
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if affected == 0 {
+		return fmt.Errorf("%s: %w", operation, storage.ErrDeviceCodeNotFound)
+	}
+
+	return nil
+}
+
+// UpdateDevicePoll Запоминает время опроса и интервал, с которым устройство должно опрашивать дальше
+func (s *Storage) UpdateDevicePoll(ctx context.Context, deviceCodeHash string, polledAt time.Time, interval time.Duration) error {
+	const operation = "storage.postgres.UpdateDevicePoll"
+
+	_, err := s.db.ExecContext(ctx,
+		"UPDATE device_codes SET last_polled_at = $1, \"interval\" = $2 WHERE device_code_hash = $3",
+		polledAt.UnixNano(), int64(interval), deviceCodeHash,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return nil
+}
+
+// ConsumeDeviceCode Помечает подтверждённый запрос использованным, чтобы токен по нему выдавался один раз
+func (s *Storage) ConsumeDeviceCode(ctx context.Context, deviceCodeHash string) error {
+	const operation = "storage.postgres.ConsumeDeviceCode"
+
+	res, err := s.db.ExecContext(ctx,
+		"UPDATE device_codes SET status = $1 WHERE device_code_hash = $2 AND status = $3",
+		models.DeviceCodeConsumed, deviceCodeHash, models.DeviceCodeApproved,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if affected == 0 {
+		return fmt.Errorf("%s: %w", operation, storage.ErrDeviceCodeNotFound)
+	}
+
+	return nil
+}
+
+func scanDeviceCode(row scanner) (models.DeviceCode, error) {
+	var code models.DeviceCode
+	var interval, lastPolledAt, expiresAt, createdAt int64
+
+	err := row.Scan(&code.DeviceCodeHash, &code.UserCode, &code.AppId, &code.Scope, &code.Status, &code.UserId,
+		&interval, &lastPolledAt, &expiresAt, &createdAt)
+	if err != nil {
+		return models.DeviceCode{}, err
+	}
+
+	code.Interval = time.Duration(interval)
+	if lastPolledAt != 0 {
+		code.LastPolledAt = time.Unix(0, lastPolledAt)
+	}
+	code.ExpiresAt = time.Unix(0, expiresAt)
+	code.CreatedAt = time.Unix(0, createdAt)
+
+	return code, nil
+}
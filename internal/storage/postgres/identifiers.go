@@ -0,0 +1,305 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/lib/identifiers"
+	"shilka-sso/internal/lib/usernames"
+	"shilka-sso/internal/storage"
+	"time"
+)
+
+// UserByIdentifier Находит пользователя по имени, подтверждённой почте или телефону
+// Вид определяется по записи login. Старые имена, похожие на почту, по-прежнему находятся по имени,
+// и совпадение с именем важнее совпадения с идентификатором
+func (s *Storage) UserByIdentifier(ctx context.Context, login string) (models.User, error) {
+	const operation = "storage.postgres.UserByIdentifier"
+
+	user, err := s.GetUser(ctx, login)
+
+	kind := identifiers.Kind(login)
+	if kind == models.IdentifierUsername || !errors.Is(err, storage.ErrUserNotFound) {
+		return user, err
+	}
+
+	canonical, err := identifiers.Canonical(kind, login)
+	if err != nil {
+		return models.User{}, fmt.Errorf("%s: %w", operation, storage.ErrUserNotFound)
+	}
+
+	row := s.db.QueryRowContext(ctx, `
+		SELECT `+userColumns+` FROM users
+		WHERE id = (SELECT user_id FROM user_identifiers WHERE kind = $1 AND canonical = $2 AND verified_at IS NOT NULL)`,
+		kind, canonical,
+	)
+
+	user, err = scanUser(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.User{}, fmt.Errorf("%s: %w", operation, storage.ErrUserNotFound)
+		}
+
+		return models.User{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return user, nil
+}
+
+// Identifiers Возвращает почту и телефон пользователя, подтверждённые и нет
+func (s *Storage) Identifiers(ctx context.Context, userID int64) ([]models.Identifier, error) {
+	const operation = "storage.postgres.Identifiers"
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT user_id, kind, value, canonical, verified_at, code_hash, attempts, code_expires_at, created_at
+		FROM user_identifiers WHERE user_id = $1 ORDER BY kind`,
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+	defer rows.Close()
+
+	var result []models.Identifier
+
+	for rows.Next() {
+		identifier, err := scanIdentifier(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", operation, err)
+		}
+
+		result = append(result, identifier)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return result, nil
+}
+
+// SetIdentifier Сохраняет новую неподтверждённую почту или телефон вместо прежних того же вида
+// Если идентификатор уже подтвердил другой пользователь или он совпадает с чужим именем, возвращает ErrIdentifierExists
+func (s *Storage) SetIdentifier(ctx context.Context, identifier models.Identifier) error {
+	const operation = "storage.postgres.SetIdentifier"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+	defer tx.Rollback()
+
+	var exists bool
+
+	err = tx.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM users WHERE id = $1)", identifier.UserId).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if !exists {
+		return fmt.Errorf("%s: %w", operation, storage.ErrUserNotFound)
+	}
+
+	taken, err := identifierTaken(ctx, tx, identifier)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if taken {
+		return fmt.Errorf("%s: %w", operation, storage.ErrIdentifierExists)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO user_identifiers(user_id, kind, value, canonical, verified_at, code_hash, attempts, code_expires_at, created_at)
+		VALUES ($1, $2, $3, $4, NULL, $5, 0, $6, $7)
+		ON CONFLICT(user_id, kind) DO UPDATE SET
+			value = excluded.value,
+			canonical = excluded.canonical,
+			verified_at = NULL,
+			code_hash = excluded.code_hash,
+			attempts = 0,
+			code_expires_at = excluded.code_expires_at,
+			created_at = excluded.created_at`,
+		identifier.UserId, identifier.Kind, identifier.Value, identifier.Canonical,
+		identifier.CodeHash, identifier.CodeExpiresAt.UnixNano(), identifier.CreatedAt.UnixNano(),
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return nil
+}
+
+// UseIdentifierAttempt Тратит одну попытку ввода кода подтверждения и возвращает идентификатор
+// Подтверждённый идентификатор, просроченный код или исчерпанные попытки считаются не найденными
+func (s *Storage) UseIdentifierAttempt(
+	ctx context.Context,
+	userID int64,
+	kind string,
+	maxAttempts int,
+) (models.Identifier, error) {
+	const operation = "storage.postgres.UseIdentifierAttempt"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Identifier{}, fmt.Errorf("%s: %w", operation, err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `
+		UPDATE user_identifiers SET attempts = attempts + 1
+		WHERE user_id = $1 AND kind = $2 AND verified_at IS NULL AND attempts < $3 AND code_expires_at > $4`,
+		userID, kind, maxAttempts, time.Now().UnixNano(),
+	)
+	if err != nil {
+		return models.Identifier{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return models.Identifier{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if affected == 0 {
+		return models.Identifier{}, fmt.Errorf("%s: %w", operation, storage.ErrIdentifierNotFound)
+	}
+
+	row := tx.QueryRowContext(ctx, `
+		SELECT user_id, kind, value, canonical, verified_at, code_hash, attempts, code_expires_at, created_at
+		FROM user_identifiers WHERE user_id = $1 AND kind = $2`,
+		userID, kind,
+	)
+
+	identifier, err := scanIdentifier(row)
+	if err != nil {
+		return models.Identifier{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.Identifier{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return identifier, nil
+}
+
+// VerifyIdentifier Отмечает идентификатор подтверждённым и стирает код
+// Пока код шёл к пользователю, тот же адрес мог подтвердить кто-то другой, тогда возвращается ErrIdentifierExists
+func (s *Storage) VerifyIdentifier(ctx context.Context, userID int64, kind string) error {
+	const operation = "storage.postgres.VerifyIdentifier"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+	defer tx.Rollback()
+
+	row := tx.QueryRowContext(ctx, `
+		SELECT user_id, kind, value, canonical, verified_at, code_hash, attempts, code_expires_at, created_at
+		FROM user_identifiers WHERE user_id = $1 AND kind = $2`,
+		userID, kind,
+	)
+
+	identifier, err := scanIdentifier(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%s: %w", operation, storage.ErrIdentifierNotFound)
+		}
+
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	taken, err := identifierTaken(ctx, tx, identifier)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if taken {
+		return fmt.Errorf("%s: %w", operation, storage.ErrIdentifierExists)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"UPDATE user_identifiers SET verified_at = $1, code_hash = '' WHERE user_id = $2 AND kind = $3",
+		time.Now().UnixNano(), userID, kind,
+	)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return fmt.Errorf("%s: %w", operation, storage.ErrIdentifierExists)
+		}
+
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return nil
+}
+
+// DeleteIdentifier Удаляет почту или телефон пользователя
+func (s *Storage) DeleteIdentifier(ctx context.Context, userID int64, kind string) error {
+	const operation = "storage.postgres.DeleteIdentifier"
+
+	res, err := s.db.ExecContext(ctx, "DELETE FROM user_identifiers WHERE user_id = $1 AND kind = $2", userID, kind)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if affected == 0 {
+		return fmt.Errorf("%s: %w", operation, storage.ErrIdentifierNotFound)
+	}
+
+	return nil
+}
+
+// Занят ли идентификатор другим пользователем: подтверждён им или совпадает с его именем.
+// Имена, похожие на почту, остались от пользователей, зарегистрированных до правил для имён
+func identifierTaken(ctx context.Context, tx *sql.Tx, identifier models.Identifier) (bool, error) {
+	var taken bool
+
+	err := tx.QueryRowContext(ctx, `
+		SELECT EXISTS(
+			SELECT 1 FROM user_identifiers
+			WHERE kind = $1 AND canonical = $2 AND verified_at IS NOT NULL AND user_id != $3
+		) OR EXISTS(
+			SELECT 1 FROM users
+			WHERE (username_canonical = $4 OR username = $5) AND id != $6
+		)`,
+		identifier.Kind, identifier.Canonical, identifier.UserId,
+		usernames.Canonical(identifier.Value), identifier.Value, identifier.UserId,
+	).Scan(&taken)
+
+	return taken, err
+}
+
+func scanIdentifier(row scanner) (models.Identifier, error) {
+	var identifier models.Identifier
+	var verifiedAt sql.NullInt64
+	var codeExpiresAt, createdAt int64
+
+	err := row.Scan(&identifier.UserId, &identifier.Kind, &identifier.Value, &identifier.Canonical, &verifiedAt,
+		&identifier.CodeHash, &identifier.Attempts, &codeExpiresAt, &createdAt)
+	if err != nil {
+		return models.Identifier{}, err
+	}
+
+	if verifiedAt.Valid {
+		identifier.VerifiedAt = time.Unix(0, verifiedAt.Int64)
+	}
+
+	identifier.CodeExpiresAt = time.Unix(0, codeExpiresAt)
+	identifier.CreatedAt = time.Unix(0, createdAt)
+
+	return identifier, nil
+}
@@ -0,0 +1,262 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/storage"
+	"strings"
+	"time"
+)
+
+// RelyingParty Возвращает настройки WebAuthn приложения
+func (s *Storage) RelyingParty(ctx context.Context, appID int) (models.RelyingParty, error) {
+	const operation = "storage.postgres.RelyingParty"
+
+	row := s.db.QueryRowContext(ctx, "SELECT app_id, rp_id, name, origins FROM relying_parties WHERE app_id = $1", appID)
+
+	var rp models.RelyingParty
+	var origins string
+
+	if err := row.Scan(&rp.AppId, &rp.RPID, &rp.Name, &origins); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.RelyingParty{}, fmt.Errorf("%s: %w", operation, storage.ErrRelyingPartyNotFound)
+		}
+
+		return models.RelyingParty{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	rp.Origins = strings.Split(origins, "\n")
+
+	return rp, nil
+}
+
+// SetRelyingParty Сохраняет или заменяет настройки WebAuthn приложения
+func (s *Storage) SetRelyingParty(ctx context.Context, rp models.RelyingParty) error {
+	const operation = "storage.postgres.SetRelyingParty"
+
+	res, err := s.db.ExecContext(ctx, `
+		INSERT INTO relying_parties(app_id, rp_id, name, origins)
+		SELECT $1::integer, $2::text, $3::text, $4::text WHERE EXISTS (SELECT 1 FROM apps WHERE id = $5)
+		ON CONFLICT(app_id) DO UPDATE SET rp_id = excluded.rp_id, name = excluded.name, origins = excluded.origins`,
+		rp.AppId, rp.RPID, rp.Name, strings.Join(rp.Origins, "\n"), rp.AppId,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if affected == 0 {
+		return fmt.Errorf("%s: %w", operation, storage.ErrAppNotFound)
+	}
+
+	return nil
+}
+
+// SavePasskey Сохраняет ключ WebAuthn пользователя
+func (s *Storage) SavePasskey(ctx context.Context, passkey models.Passkey) (int64, error) {
+	const operation = "storage.postgres.SavePasskey"
+
+	var id int64
+
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO passkeys(user_id, rp_id, credential_id, public_key, attestation_type, aaguid,
+		                     sign_count, transports, backup_eligible, name, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		RETURNING id`,
+		passkey.UserId, passkey.RPID, passkey.CredentialId, passkey.PublicKey, passkey.AttestationType,
+		passkey.AAGUID, passkey.SignCount, strings.Join(passkey.Transports, " "), passkey.BackupEligible,
+		passkey.Name, passkey.CreatedAt.UnixNano(),
+	).Scan(&id)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return 0, fmt.Errorf("%s: %w", operation, storage.ErrPasskeyExists)
+		}
+
+		return 0, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return id, nil
+}
+
+const passkeyColumns = `id, user_id, rp_id, credential_id, public_key, attestation_type, aaguid,
+	sign_count, transports, backup_eligible, name, created_at, last_used_at`
+
+// Passkeys Возвращает ключи пользователя для всех доменов
+func (s *Storage) Passkeys(ctx context.Context, userID int64) ([]models.Passkey, error) {
+	const operation = "storage.postgres.Passkeys"
+
+	rows, err := s.db.QueryContext(ctx, "SELECT "+passkeyColumns+" FROM passkeys WHERE user_id = $1 ORDER BY id", userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+	defer rows.Close()
+
+	var passkeys []models.Passkey
+
+	for rows.Next() {
+		passkey, err := scanPasskey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", operation, err)
+		}
+
+		passkeys = append(passkeys, passkey)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return passkeys, nil
+}
+
+// PasskeyByCredentialID Возвращает ключ по id, который выдал аутентификатор
+func (s *Storage) PasskeyByCredentialID(ctx context.Context, credentialID []byte) (models.Passkey, error) {
+	const operation = "storage.postgres.PasskeyByCredentialID"
+
+	row := s.db.QueryRowContext(ctx, "SELECT "+passkeyColumns+" FROM passkeys WHERE credential_id = $1", credentialID)
+
+	passkey, err := scanPasskey(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Passkey{}, fmt.Errorf("%s: %w", operation, storage.ErrPasskeyNotFound)
+		}
+
+		return models.Passkey{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return passkey, nil
+}
+
+// UpdatePasskeyUsage Запоминает новый счётчик подписей и время входа
+func (s *Storage) UpdatePasskeyUsage(ctx context.Context, passkeyID int64, signCount uint32, usedAt time.Time) error {
+	const operation = "storage.postgres.UpdatePasskeyUsage"
+
+	_, err := s.db.ExecContext(ctx,
+		"UPDATE passkeys SET sign_count = $1, last_used_at = $2 WHERE id = $3",
+		signCount, usedAt.UnixNano(), passkeyID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return nil
+}
+
+// DeletePasskey Удаляет ключ пользователя, чужой ключ считается не найденным
+func (s *Storage) DeletePasskey(ctx context.Context, userID int64, passkeyID int64) error {
+	const operation = "storage.postgres.DeletePasskey"
+
+	res, err := s.db.ExecContext(ctx, "DELETE FROM passkeys WHERE id = $1 AND user_id = $2", passkeyID, userID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if affected == 0 {
+		return fmt.Errorf("%s: %w", operation, storage.ErrPasskeyNotFound)
+	}
+
+	return nil
+}
+
+// SavePasskeySession Сохраняет начатую церемонию WebAuthn
+func (s *Storage) SavePasskeySession(ctx context.Context, session models.PasskeySession) error {
+	const operation = "storage.postgres.SavePasskeySession"
+
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO passkey_sessions(id, ceremony, user_id, app_id, password_verified, data, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		session.Id, session.Ceremony, session.UserId, session.AppId, session.PasswordVerified,
+		string(session.Data), session.ExpiresAt.UnixNano(),
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return nil
+}
+
+// ConsumePasskeySession Возвращает и удаляет церемонию, каждую можно завершить только один раз
+// Просроченная церемония считается не найденной
+func (s *Storage) ConsumePasskeySession(ctx context.Context, sessionID string) (models.PasskeySession, error) {
+	const operation = "storage.postgres.ConsumePasskeySession"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.PasskeySession{}, fmt.Errorf("%s: %w", operation, err)
+	}
+	defer tx.Rollback()
+
+	row := tx.QueryRowContext(ctx,
+		"SELECT id, ceremony, user_id, app_id, password_verified, data, expires_at FROM passkey_sessions WHERE id = $1",
+		sessionID,
+	)
+
+	var session models.PasskeySession
+	var data string
+	var expiresAt int64
+
+	err = row.Scan(&session.Id, &session.Ceremony, &session.UserId, &session.AppId, &session.PasswordVerified, &data, &expiresAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.PasskeySession{}, fmt.Errorf("%s: %w", operation, storage.ErrPasskeySessionNotFound)
+		}
+
+		return models.PasskeySession{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	// Заодно удаляем все просроченные церемонии
+	_, err = tx.ExecContext(ctx,
+		"DELETE FROM passkey_sessions WHERE id = $1 OR expires_at <= $2",
+		sessionID, time.Now().UnixNano(),
+	)
+	if err != nil {
+		return models.PasskeySession{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.PasskeySession{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	session.Data = []byte(data)
+	session.ExpiresAt = time.Unix(0, expiresAt)
+
+	if time.Now().After(session.ExpiresAt) {
+		return models.PasskeySession{}, fmt.Errorf("%s: %w", operation, storage.ErrPasskeySessionNotFound)
+	}
+
+	return session, nil
+}
+
+func scanPasskey(row scanner) (models.Passkey, error) {
+	var passkey models.Passkey
+	var transports string
+	var createdAt, lastUsedAt int64
+
+	err := row.Scan(&passkey.Id, &passkey.UserId, &passkey.RPID, &passkey.CredentialId, &passkey.PublicKey,
+		&passkey.AttestationType, &passkey.AAGUID, &passkey.SignCount, &transports, &passkey.BackupEligible,
+		&passkey.Name, &createdAt, &lastUsedAt)
+	if err != nil {
+		return models.Passkey{}, err
+	}
+
+	passkey.Transports = strings.Fields(transports)
+	passkey.CreatedAt = time.Unix(0, createdAt)
+
+	if lastUsedAt != 0 {
+		passkey.LastUsedAt = time.Unix(0, lastUsedAt)
+	}
+
+	return passkey, nil
+}
@@ -0,0 +1,386 @@
+// Package postgres Слой работы с базой данных PostgreSQL
+// Схема и поведение повторяют хранилище sqlite, ошибки приводятся к тем же storage.Err*
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/lib/usernames"
+	"shilka-sso/internal/storage"
+	"strings"
+	"time"
+)
+
+// Код ошибки PostgreSQL при нарушении уникальности
+const uniqueViolation = "23505"
+
+type Storage struct {
+	db *sql.DB
+}
+
+// New Подключается к PostgreSQL по строке подключения dsn
+func New(dsn string) (*Storage, error) {
+	const operation = "storage.postgres.New"
+
+	// Подключение к бд
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return &Storage{db: db}, nil
+}
+
+// Close Закрывает подключения к бд
+func (s *Storage) Close() error {
+	return s.db.Close()
+}
+
+// Нарушено ли ограничение уникальности или первичного ключа
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+
+	return errors.As(err, &pqErr) && pqErr.Code == uniqueViolation
+}
+
+// SaveUser Сохрарняет пользователя в бд
+// Вместе с пользователем в outbox пишется событие о регистрации
+func (s *Storage) SaveUser(ctx context.Context, username string, passwordHash []byte) (int64, error) {
+	const operation = "storage.postgres.SaveUser"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", operation, err)
+	}
+	defer tx.Rollback()
+
+	id, err := insertUser(ctx, tx, username, passwordHash)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return id, nil
+}
+
+// Добавляет пользователя и событие о его регистрации в рамках транзакции tx
+// Имя уникально в канонической форме, поэтому "Admin" не получится создать рядом с "admin"
+func insertUser(ctx context.Context, tx *sql.Tx, username string, passwordHash []byte) (int64, error) {
+	var id int64
+
+	err := tx.QueryRowContext(ctx,
+		"INSERT INTO users(username, username_canonical, pass_hash) VALUES ($1, $2, $3) RETURNING id",
+		username, usernames.Canonical(username), passwordHash,
+	).Scan(&id)
+
+	if err != nil {
+		if isUniqueViolation(err) {
+			return 0, storage.ErrUserExists
+		}
+
+		return 0, err
+	}
+
+	err = insertEvent(ctx, tx, models.EventUserRegistered, models.UserEventPayload{
+		UserId:   id,
+		Username: username,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// GetUser Получает информацию о пользователе по username.
+// Имя сравнивается в канонической форме. Пользователи со старыми совпадающими именами
+// без канонической формы находятся только по точному имени, и оно важнее совпадения по форме
+func (s *Storage) GetUser(ctx context.Context, username string) (models.User, error) {
+	const operation = "storage.postgres.GetUser"
+
+	row := s.db.QueryRowContext(ctx, `
+		SELECT `+userColumns+` FROM users
+		WHERE username_canonical = $1 OR username = $2
+		ORDER BY username = $2 DESC
+		LIMIT 1`,
+		usernames.Canonical(username), username,
+	)
+
+	user, err := scanUser(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.User{}, fmt.Errorf("%s: %w", operation, storage.ErrUserNotFound)
+		}
+
+		return models.User{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return user, nil
+}
+
+// Колонки users, которые читает scanUser
+const userColumns = "id, username, pass_hash, status, status_reason, suspended_until"
+
+func scanUser(row scanner) (models.User, error) {
+	var user models.User
+	var suspendedUntil sql.NullInt64
+
+	err := row.Scan(&user.Id, &user.Username, &user.PasswordHash, &user.Status, &user.StatusReason, &suspendedUntil)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	if suspendedUntil.Valid {
+		user.SuspendedUntil = time.Unix(0, suspendedUntil.Int64)
+	}
+
+	return user, nil
+}
+
+// UserByID Получает информацию о пользователе по id.
+func (s *Storage) UserByID(ctx context.Context, userID int64) (models.User, error) {
+	const operation = "storage.postgres.UserByID"
+
+	row := s.db.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE id = $1", userID)
+
+	user, err := scanUser(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.User{}, fmt.Errorf("%s: %w", operation, storage.ErrUserNotFound)
+		}
+
+		return models.User{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return user, nil
+}
+
+// IsAdmin Определяет является ли пользователь админом.
+func (s *Storage) IsAdmin(ctx context.Context, userID int64) (bool, error) {
+	const operation = "storage.postgres.IsAdmin"
+
+	row := s.db.QueryRowContext(ctx, "SELECT is_admin FROM users WHERE id = $1", userID)
+
+	var isAdmin bool
+
+	err := row.Scan(&isAdmin)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, fmt.Errorf("%s: %w", operation, storage.ErrUserNotFound)
+		}
+		return false, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return isAdmin, nil
+}
+
+// SetAdmin Выдаёт или забирает у пользователя права администратора
+// Вместе с изменением в outbox пишется событие о смене роли
+func (s *Storage) SetAdmin(ctx context.Context, userID int64, isAdmin bool) error {
+	const operation = "storage.postgres.SetAdmin"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, "UPDATE users SET is_admin = $1 WHERE id = $2", isAdmin, userID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if affected == 0 {
+		return fmt.Errorf("%s: %w", operation, storage.ErrUserNotFound)
+	}
+
+	err = insertEvent(ctx, tx, models.EventUserRoleChanged, models.UserEventPayload{
+		UserId:  userID,
+		IsAdmin: &isAdmin,
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return nil
+}
+
+// SetUsername Меняет имя пользователя
+// Имя уникально в канонической форме, как и при регистрации. Вместе с изменением в outbox пишется событие
+func (s *Storage) SetUsername(ctx context.Context, userID int64, username string) error {
+	const operation = "storage.postgres.SetUsername"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx,
+		"UPDATE users SET username = $1, username_canonical = $2 WHERE id = $3",
+		username, usernames.Canonical(username), userID,
+	)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return fmt.Errorf("%s: %w", operation, storage.ErrUserExists)
+		}
+
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if affected == 0 {
+		return fmt.Errorf("%s: %w", operation, storage.ErrUserNotFound)
+	}
+
+	err = insertEvent(ctx, tx, models.EventUserRenamed, models.UserEventPayload{
+		UserId:   userID,
+		Username: username,
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return nil
+}
+
+// SetPasswordHash Меняет хэш пароля пользователя
+func (s *Storage) SetPasswordHash(ctx context.Context, userID int64, passwordHash []byte) error {
+	const operation = "storage.postgres.SetPasswordHash"
+
+	res, err := s.db.ExecContext(ctx, "UPDATE users SET pass_hash = $1 WHERE id = $2", passwordHash, userID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if affected == 0 {
+		return fmt.Errorf("%s: %w", operation, storage.ErrUserNotFound)
+	}
+
+	return nil
+}
+
+// ListUsers Возвращает до limit пользователей с id больше afterID по возрастанию id
+// Чтобы пройти всех пользователей, следующую страницу запрашивают с id последнего пользователя
+func (s *Storage) ListUsers(ctx context.Context, afterID int64, limit int) ([]models.User, error) {
+	const operation = "storage.postgres.ListUsers"
+
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT "+userColumns+" FROM users WHERE id > $1 ORDER BY id LIMIT $2",
+		afterID, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+	defer rows.Close()
+
+	var result []models.User
+
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", operation, err)
+		}
+
+		result = append(result, user)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return result, nil
+}
+
+// GetApp Взвращает приложение по фйди из бд
+func (s *Storage) GetApp(ctx context.Context, appID int) (models.App, error) {
+	const operation = "storage.postgres.GetApp"
+
+	row := s.db.QueryRowContext(ctx, "SELECT id, name, secret, redirect_uris, scopes FROM apps WHERE id = $1", appID)
+
+	var app models.App
+	var redirectURIs, scopes string
+	err := row.Scan(&app.Id, &app.Name, &app.Secret, &redirectURIs, &scopes)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.App{}, fmt.Errorf("%s: %w", operation, storage.ErrAppNotFound)
+		}
+		return models.App{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if redirectURIs != "" {
+		app.RedirectURIs = strings.Split(redirectURIs, "\n")
+	}
+
+	if scopes != "" {
+		app.Scopes = strings.Split(scopes, "\n")
+	}
+
+	return app, nil
+}
+
+// SetAppRedirectURIs Заменяет список адресов возврата приложения
+func (s *Storage) SetAppRedirectURIs(ctx context.Context, appID int, redirectURIs []string) error {
+	const operation = "storage.postgres.SetAppRedirectURIs"
+
+	return s.setAppList(ctx, operation, "redirect_uris", appID, redirectURIs)
+}
+
+// SetAppScopes Заменяет список scope, которые приложение может запрашивать
+func (s *Storage) SetAppScopes(ctx context.Context, appID int, scopes []string) error {
+	const operation = "storage.postgres.SetAppScopes"
+
+	return s.setAppList(ctx, operation, "scopes", appID, scopes)
+}
+
+// Записывает список в колонку приложения через перевод строки
+func (s *Storage) setAppList(ctx context.Context, operation string, column string, appID int, values []string) error {
+	res, err := s.db.ExecContext(ctx,
+		"UPDATE apps SET "+column+" = $1 WHERE id = $2",
+		strings.Join(values, "\n"), appID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if affected == 0 {
+		return fmt.Errorf("%s: %w", operation, storage.ErrAppNotFound)
+	}
+
+	return nil
+}
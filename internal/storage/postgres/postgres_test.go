@@ -0,0 +1,170 @@
+package postgres_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"log/slog"
+	"os"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/lib/auditchain"
+	"shilka-sso/internal/services/audit"
+	"shilka-sso/internal/storage"
+	"shilka-sso/internal/storage/postgres/postgrestest"
+	"shilka-sso/internal/storage/storagetest"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(postgrestest.Main(m))
+}
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T, apps ...models.App) storagetest.Storage {
+		st, dsn := postgrestest.New(t)
+
+		for _, app := range apps {
+			postgrestest.SaveApp(t, dsn, app)
+		}
+
+		return st
+	})
+}
+
+func TestUsers(t *testing.T) {
+	ctx := context.Background()
+	st, _ := postgrestest.New(t)
+
+	id, err := st.SaveUser(ctx, "Ivan", []byte("hash"))
+	require.NoError(t, err)
+
+	// Имена уникальны в канонической форме
+	_, err = st.SaveUser(ctx, "ivan", []byte("hash"))
+	assert.ErrorIs(t, err, storage.ErrUserExists)
+
+	user, err := st.GetUser(ctx, "IVAN")
+	require.NoError(t, err)
+	assert.Equal(t, id, user.Id)
+	assert.Equal(t, "Ivan", user.Username)
+	assert.Equal(t, []byte("hash"), user.PasswordHash)
+	assert.Equal(t, models.AccountActive, user.Status)
+
+	_, err = st.GetUser(ctx, "petr")
+	assert.ErrorIs(t, err, storage.ErrUserNotFound)
+
+	_, err = st.UserByID(ctx, id+1)
+	assert.ErrorIs(t, err, storage.ErrUserNotFound)
+
+	_, err = st.UserByIdentifier(ctx, "ivan@example.com")
+	assert.ErrorIs(t, err, storage.ErrUserNotFound)
+
+	isAdmin, err := st.IsAdmin(ctx, id)
+	require.NoError(t, err)
+	assert.False(t, isAdmin)
+
+	require.NoError(t, st.SetAdmin(ctx, id, true))
+
+	isAdmin, err = st.IsAdmin(ctx, id)
+	require.NoError(t, err)
+	assert.True(t, isAdmin)
+
+	_, err = st.IsAdmin(ctx, id+1)
+	assert.ErrorIs(t, err, storage.ErrUserNotFound)
+
+	events, err := st.PendingEvents(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, models.EventUserRegistered, events[0].Type)
+	assert.Equal(t, models.EventUserRoleChanged, events[1].Type)
+}
+
+func TestApps(t *testing.T) {
+	ctx := context.Background()
+	st, dsn := postgrestest.New(t)
+
+	postgrestest.SaveApp(t, dsn, models.App{Id: 1, Name: "test", Secret: "secret"})
+
+	require.NoError(t, st.SetAppRedirectURIs(ctx, 1, []string{"https://a.example/cb", "https://b.example/cb"}))
+
+	app, err := st.GetApp(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "test", app.Name)
+	assert.Equal(t, []string{"https://a.example/cb", "https://b.example/cb"}, app.RedirectURIs)
+
+	_, err = st.GetApp(ctx, 2)
+	assert.ErrorIs(t, err, storage.ErrAppNotFound)
+
+	assert.ErrorIs(t, st.SetAppRedirectURIs(ctx, 2, nil), storage.ErrAppNotFound)
+}
+
+func TestAuditChainAndErasure(t *testing.T) {
+	ctx := context.Background()
+	st, _ := postgrestest.New(t)
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	userID, err := st.SaveUser(ctx, "ivan", []byte("hash"))
+	require.NoError(t, err)
+
+	auditService := audit.New(log, st, key)
+	require.NoError(t, auditService.Record(ctx, models.AuditUserRegistered, userID, 0, map[string]any{"username": "ivan"}))
+	require.NoError(t, auditService.Checkpoint(ctx))
+
+	records, err := st.UserAuditRecords(ctx, userID)
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+
+	// Доставленное событие о пользователе удаляется из outbox вместе с его данными
+	events, err := st.PendingEvents(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	require.NoError(t, st.MarkEventDelivered(ctx, events[0].Id))
+
+	// Недоставляемое событие тоже хранит имя и удаляется
+	require.NoError(t, st.SetAdmin(ctx, userID, true))
+
+	events, err = st.PendingEvents(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	require.NoError(t, st.MarkEventFailed(ctx, events[0].Id, "event is rejected", time.Now(), true))
+
+	erased, err := auditchain.NewRecord(models.AuditUserErased, userID, 0, map[string]any{
+		models.AuditRedactedRecordsField: []int64{records[0].Id},
+	}, time.Now())
+	require.NoError(t, err)
+
+	require.NoError(t, st.EraseUser(ctx, userID, []int64{records[0].Id}, erased))
+
+	user, err := st.UserByID(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, models.ErasedUsername(userID), user.Username)
+
+	dead, err := st.DeadEvents(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, dead)
+
+	events, err = st.PendingEvents(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, models.EventUserDeleted, events[0].Type)
+
+	// Запись user.erased пишется вместе с удалением, и цепочка по-прежнему сходится
+	records, err = st.UserAuditRecords(ctx, userID)
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	assert.NotContains(t, records[0].Payload, "ivan")
+	assert.False(t, records[0].RedactedAt.IsZero())
+	assert.Equal(t, models.AuditUserErased, records[1].Event)
+
+	report, err := auditService.VerifyChain(ctx)
+	require.NoError(t, err)
+	assert.True(t, report.Ok, report.Reason)
+
+	assert.ErrorIs(t, st.EraseUser(ctx, userID, nil, erased), storage.ErrUserNotFound)
+}
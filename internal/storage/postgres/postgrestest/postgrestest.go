@@ -0,0 +1,194 @@
+// Package postgrestest Бд PostgreSQL с применёнными миграциями для тестов
+package postgrestest
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	embeddedpostgres "github.com/fergusstrange/embedded-postgres"
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/postgres"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/storage/postgres"
+	"sync"
+	"testing"
+)
+
+// DSNEnv Переменная окружения со строкой подключения к PostgreSQL в виде URL.
+// Если она не задана, тесты поднимают встроенный PostgreSQL, один на процесс, а если он не запустился - пропускаются
+const DSNEnv = "SSO_TEST_POSTGRES_DSN"
+
+var (
+	embeddedOnce sync.Once
+	embedded     *embeddedpostgres.EmbeddedPostgres
+	embeddedDSN  string
+	embeddedErr  error
+)
+
+// Main Запускает тесты пакета и останавливает встроенный PostgreSQL, если он поднимался.
+// Вызывается из TestMain: os.Exit(postgrestest.Main(m))
+func Main(m *testing.M) int {
+	code := m.Run()
+
+	if embedded != nil {
+		if err := embedded.Stop(); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to stop embedded postgres: %v\n", err)
+		}
+	}
+
+	return code
+}
+
+// New Создаёт для теста отдельную схему, применяет к ней миграции из migrations/postgres
+// и возвращает хранилище вместе со строкой подключения к этой схеме. Схема удаляется после теста
+func New(t *testing.T) (*postgres.Storage, string) {
+	t.Helper()
+
+	base := os.Getenv(DSNEnv)
+	if base == "" {
+		embeddedOnce.Do(startEmbedded)
+		if embeddedErr != nil {
+			t.Skipf("%s is not set and embedded postgres failed to start: %v", DSNEnv, embeddedErr)
+		}
+
+		base = embeddedDSN
+	}
+
+	db, err := sql.Open("postgres", base)
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	schema := "test_" + randomSuffix(t)
+
+	if _, err := db.Exec("CREATE SCHEMA " + schema); err != nil {
+		t.Fatalf("failed to create schema: %v", err)
+	}
+	t.Cleanup(func() {
+		if _, err := db.Exec("DROP SCHEMA " + schema + " CASCADE"); err != nil {
+			t.Errorf("failed to drop schema: %v", err)
+		}
+	})
+
+	dsn, err := withSearchPath(base, schema)
+	if err != nil {
+		t.Fatalf("failed to build dsn: %v", err)
+	}
+
+	m, err := migrate.New("file://"+migrationsPath(), dsn+"&x-migrations-table=migrations")
+	if err != nil {
+		t.Fatalf("failed to init migrations: %v", err)
+	}
+
+	if err := m.Up(); err != nil {
+		t.Fatalf("failed to apply migrations: %v", err)
+	}
+
+	if srcErr, dbErr := m.Close(); srcErr != nil || dbErr != nil {
+		t.Fatalf("failed to close migrations: %v, %v", srcErr, dbErr)
+	}
+
+	storage, err := postgres.New(dsn)
+	if err != nil {
+		t.Fatalf("failed to open storage: %v", err)
+	}
+	t.Cleanup(func() { storage.Close() })
+
+	return storage, dsn
+}
+
+// SaveApp Добавляет приложение напрямую в бд, у хранилища нет метода для этого
+func SaveApp(t *testing.T, dsn string, app models.App) {
+	t.Helper()
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	defer db.Close()
+
+	if _, err := db.Exec("INSERT INTO apps(id, name, secret) VALUES ($1, $2, $3)", app.Id, app.Name, app.Secret); err != nil {
+		t.Fatalf("failed to save app: %v", err)
+	}
+}
+
+// Поднимает PostgreSQL из бинарников embedded-postgres на свободном порту. Бинарники
+// скачиваются при первом запуске и кешируются, данные лежат во временном каталоге
+func startEmbedded() {
+	port, err := freePort()
+	if err != nil {
+		embeddedErr = err
+		return
+	}
+
+	runtimePath, err := os.MkdirTemp("", "sso-postgres-")
+	if err != nil {
+		embeddedErr = err
+		return
+	}
+
+	config := embeddedpostgres.DefaultConfig().
+		Port(port).
+		RuntimePath(runtimePath).
+		Logger(io.Discard)
+
+	db := embeddedpostgres.NewDatabase(config)
+	if err := db.Start(); err != nil {
+		os.RemoveAll(runtimePath)
+		embeddedErr = err
+		return
+	}
+
+	embedded = db
+	embeddedDSN = config.GetConnectionURL() + "?sslmode=disable"
+}
+
+func freePort() (uint32, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer listener.Close()
+
+	return uint32(listener.Addr().(*net.TCPAddr).Port), nil
+}
+
+// Добавляет к строке подключения схему, в которой работают запросы
+func withSearchPath(dsn string, schema string) (string, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return "", err
+	}
+
+	query := u.Query()
+	query.Set("search_path", schema)
+	u.RawQuery = query.Encode()
+
+	return u.String(), nil
+}
+
+func randomSuffix(t *testing.T) string {
+	t.Helper()
+
+	buf := make([]byte, 6)
+	if _, err := rand.Read(buf); err != nil {
+		t.Fatalf("failed to generate schema name: %v", err)
+	}
+
+	return hex.EncodeToString(buf)
+}
+
+func migrationsPath() string {
+	_, file, _, _ := runtime.Caller(0)
+
+	return filepath.Join(filepath.Dir(file), "..", "..", "..", "..", "migrations", "postgres")
+}
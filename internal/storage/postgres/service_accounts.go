@@ -0,0 +1,162 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/storage"
+	"strings"
+	"time"
+)
+
+// SaveServiceAccount Сохраняет сервисный аккаунт приложения
+func (s *Storage) SaveServiceAccount(ctx context.Context, account models.ServiceAccount) (int64, error) {
+	const operation = "storage.postgres.SaveServiceAccount"
+
+	var exists bool
+	err := s.db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM apps WHERE id = $1)", account.AppId).Scan(&exists)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if !exists {
+		return 0, fmt.Errorf("%s: %w", operation, storage.ErrAppNotFound)
+	}
+
+	var id int64
+
+	err = s.db.QueryRowContext(ctx,
+		"INSERT INTO service_accounts(app_id, name, client_id, secret_hash, scopes, created_at) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id",
+		account.AppId, account.Name, account.ClientId, account.SecretHash, strings.Join(account.Scopes, " "),
+		account.CreatedAt.UnixNano(),
+	).Scan(&id)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return 0, fmt.Errorf("%s: %w", operation, storage.ErrServiceAccountExists)
+		}
+
+		return 0, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return id, nil
+}
+
+const serviceAccountColumns = "id, app_id, name, client_id, secret_hash, scopes, created_at"
+
+// ServiceAccountByClientID Возвращает сервисный аккаунт по его client id
+func (s *Storage) ServiceAccountByClientID(ctx context.Context, clientID string) (models.ServiceAccount, error) {
+	const operation = "storage.postgres.ServiceAccountByClientID"
+
+	row := s.db.QueryRowContext(ctx,
+		"SELECT "+serviceAccountColumns+" FROM service_accounts WHERE client_id = $1",
+		clientID,
+	)
+
+	account, err := scanServiceAccount(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.ServiceAccount{}, fmt.Errorf("%s: %w", operation, storage.ErrServiceAccountNotFound)
+		}
+
+		return models.ServiceAccount{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return account, nil
+}
+
+// ServiceAccountByID Возвращает сервисный аккаунт по id
+func (s *Storage) ServiceAccountByID(ctx context.Context, accountID int64) (models.ServiceAccount, error) {
+	const operation = "storage.postgres.ServiceAccountByID"
+
+	row := s.db.QueryRowContext(ctx,
+		"SELECT "+serviceAccountColumns+" FROM service_accounts WHERE id = $1",
+		accountID,
+	)
+
+	account, err := scanServiceAccount(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.ServiceAccount{}, fmt.Errorf("%s: %w", operation, storage.ErrServiceAccountNotFound)
+		}
+
+		return models.ServiceAccount{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return account, nil
+}
+
+// ServiceAccounts Возвращает сервисные аккаунты приложения
+func (s *Storage) ServiceAccounts(ctx context.Context, appID int) ([]models.ServiceAccount, error) {
+	const operation = "storage.postgres.ServiceAccounts"
+
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT "+serviceAccountColumns+" FROM service_accounts WHERE app_id = $1 ORDER BY id",
+		appID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+	defer rows.Close()
+
+	var accounts []models.ServiceAccount
+
+	for rows.Next() {
+		account, err := scanServiceAccount(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", operation, err)
+		}
+
+		accounts = append(accounts, account)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return accounts, nil
+}
+
+// DeleteServiceAccount Удаляет сервисный аккаунт, после этого он не может получить новые токены
+func (s *Storage) DeleteServiceAccount(ctx context.Context, accountID int64) error {
+	const operation = "storage.postgres.DeleteServiceAccount"
+
+	res, err := s.db.ExecContext(ctx, "DELETE FROM service_accounts WHERE id = $1", accountID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if affected == 0 {
+		return fmt.Errorf("%s: %w", operation, storage.ErrServiceAccountNotFound)
+	}
+
+	return nil
+}
+
+// Общий интерфейс *sql.Row и *sql.Rows
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanServiceAccount(row scanner) (models.ServiceAccount, error) {
+	var account models.ServiceAccount
+	var scopes string
+	var createdAt int64
+
+	err := row.Scan(&account.Id, &account.AppId, &account.Name, &account.ClientId, &account.SecretHash,
+		&scopes, &createdAt)
+	if err != nil {
+		return models.ServiceAccount{}, err
+	}
+
+	account.Scopes = strings.Fields(scopes)
+	account.CreatedAt = time.Unix(0, createdAt)
+
+	return account, nil
+}
@@ -0,0 +1,113 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/lib/usernames"
+	"time"
+)
+
+// CanonicalizeUsernames Заполняет каноническую форму имён пользователей, у которых её ещё нет
+// Если форма уже занята другим пользователем, она остаётся пустой, а совпадение записывается
+// в username_collisions. Возвращает все известные совпадения
+func (s *Storage) CanonicalizeUsernames(ctx context.Context) ([]models.UsernameCollision, error) {
+	const operation = "storage.postgres.CanonicalizeUsernames"
+
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT id, username FROM users WHERE username_canonical IS NULL ORDER BY id",
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	type pending struct {
+		id       int64
+		username string
+	}
+
+	var users []pending
+
+	for rows.Next() {
+		var user pending
+		if err := rows.Scan(&user.id, &user.username); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("%s: %w", operation, err)
+		}
+
+		users = append(users, user)
+	}
+
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	// Пользователи обходятся по id, поэтому форму получает тот, кто зарегистрировался раньше
+	for _, user := range users {
+		canonical := usernames.Canonical(user.username)
+
+		_, err := s.db.ExecContext(ctx, "UPDATE users SET username_canonical = $1 WHERE id = $2", canonical, user.id)
+		if err == nil {
+			continue
+		}
+
+		if !isUniqueViolation(err) {
+			return nil, fmt.Errorf("%s: %w", operation, err)
+		}
+
+		_, err = s.db.ExecContext(ctx, `
+			INSERT INTO username_collisions(user_id, canonical, conflicts_with, detected_at)
+			SELECT $1::bigint, $2::text, id, $3::bigint FROM users WHERE username_canonical = $4
+			ON CONFLICT DO NOTHING`,
+			user.id, canonical, time.Now().UnixNano(), canonical,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", operation, err)
+		}
+	}
+
+	collisions, err := s.UsernameCollisions(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return collisions, nil
+}
+
+// UsernameCollisions Возвращает пользователей, чьё имя совпало с чужим в канонической форме
+func (s *Storage) UsernameCollisions(ctx context.Context) ([]models.UsernameCollision, error) {
+	const operation = "storage.postgres.UsernameCollisions"
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT c.user_id, u.username, c.canonical, c.conflicts_with, c.detected_at
+		FROM username_collisions c
+		JOIN users u ON u.id = c.user_id
+		ORDER BY c.user_id`)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+	defer rows.Close()
+
+	var collisions []models.UsernameCollision
+
+	for rows.Next() {
+		var collision models.UsernameCollision
+		var detectedAt int64
+
+		err := rows.Scan(&collision.UserId, &collision.Username, &collision.Canonical, &collision.ConflictsWith, &detectedAt)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", operation, err)
+		}
+
+		collision.DetectedAt = time.Unix(0, detectedAt)
+		collisions = append(collisions, collision)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return collisions, nil
+}
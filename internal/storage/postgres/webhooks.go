@@ -0,0 +1,277 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/storage"
+	"time"
+)
+
+// SaveWebhook Сохраняет вебхук приложения
+func (s *Storage) SaveWebhook(ctx context.Context, webhook models.Webhook) (int64, error) {
+	const operation = "storage.postgres.SaveWebhook"
+
+	var exists bool
+	err := s.db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM apps WHERE id = $1)", webhook.AppId).Scan(&exists)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if !exists {
+		return 0, fmt.Errorf("%s: %w", operation, storage.ErrAppNotFound)
+	}
+
+	var id int64
+
+	err = s.db.QueryRowContext(ctx,
+		"INSERT INTO webhooks(app_id, event_type, url, created_at) VALUES ($1, $2, $3, $4) RETURNING id",
+		webhook.AppId, webhook.EventType, webhook.URL, webhook.CreatedAt.UnixNano(),
+	).Scan(&id)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return 0, fmt.Errorf("%s: %w", operation, storage.ErrWebhookExists)
+		}
+
+		return 0, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return id, nil
+}
+
+// Webhooks Возвращает вебхуки приложения
+func (s *Storage) Webhooks(ctx context.Context, appID int) ([]models.Webhook, error) {
+	const operation = "storage.postgres.Webhooks"
+
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT id, app_id, event_type, url, created_at FROM webhooks WHERE app_id = $1 ORDER BY id",
+		appID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+	defer rows.Close()
+
+	var webhooks []models.Webhook
+
+	for rows.Next() {
+		var webhook models.Webhook
+		var createdAt int64
+
+		if err := rows.Scan(&webhook.Id, &webhook.AppId, &webhook.EventType, &webhook.URL, &createdAt); err != nil {
+			return nil, fmt.Errorf("%s: %w", operation, err)
+		}
+
+		webhook.CreatedAt = time.Unix(0, createdAt)
+		webhooks = append(webhooks, webhook)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return webhooks, nil
+}
+
+// DeleteWebhook Удаляет вебхук вместе с его доставками
+func (s *Storage) DeleteWebhook(ctx context.Context, webhookID int64) error {
+	const operation = "storage.postgres.DeleteWebhook"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, "DELETE FROM webhooks WHERE id = $1", webhookID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if affected == 0 {
+		return fmt.Errorf("%s: %w", operation, storage.ErrWebhookNotFound)
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM webhook_deliveries WHERE webhook_id = $1", webhookID); err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return nil
+}
+
+// EnqueueWebhookDeliveries Ставит событие в очередь на доставку во все вебхуки его типа
+// Повторная постановка того же события ничего не делает
+func (s *Storage) EnqueueWebhookDeliveries(ctx context.Context, event models.Event, body []byte) (int64, error) {
+	const operation = "storage.postgres.EnqueueWebhookDeliveries"
+
+	now := time.Now().UnixNano()
+
+	res, err := s.db.ExecContext(ctx, `
+		INSERT INTO webhook_deliveries(webhook_id, event_id, event_type, body, next_attempt_at, created_at)
+		SELECT id, $1::bigint, $2::text, $3::bytea, $4::bigint, $5::bigint FROM webhooks WHERE event_type = $6
+		ON CONFLICT DO NOTHING`,
+		event.Id, event.Type, body, now, now, event.Type,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return affected, nil
+}
+
+const webhookDeliveryColumns = `
+	d.id, d.webhook_id, w.app_id, w.url, a.secret, d.event_id, d.event_type, d.body,
+	d.status, d.attempts, d.last_error, d.next_attempt_at, d.created_at`
+
+const webhookDeliveryJoins = `
+	FROM webhook_deliveries d
+	JOIN webhooks w ON w.id = d.webhook_id
+	JOIN apps a ON a.id = w.app_id`
+
+// DueWebhookDeliveries Возвращает до limit доставок, время попытки которых уже наступило
+func (s *Storage) DueWebhookDeliveries(ctx context.Context, now time.Time, limit int) ([]models.WebhookDelivery, error) {
+	const operation = "storage.postgres.DueWebhookDeliveries"
+
+	deliveries, err := s.queryWebhookDeliveries(ctx,
+		"SELECT"+webhookDeliveryColumns+webhookDeliveryJoins+" WHERE d.status = $1 AND d.next_attempt_at <= $2 ORDER BY d.next_attempt_at, d.id LIMIT $3",
+		models.WebhookDeliveryPending, now.UnixNano(), limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return deliveries, nil
+}
+
+// DeadWebhookDeliveries Возвращает доставки, попытки которых закончились
+// Если appID равен 0, возвращаются доставки всех приложений
+func (s *Storage) DeadWebhookDeliveries(ctx context.Context, appID int) ([]models.WebhookDelivery, error) {
+	const operation = "storage.postgres.DeadWebhookDeliveries"
+
+	deliveries, err := s.queryWebhookDeliveries(ctx,
+		"SELECT"+webhookDeliveryColumns+webhookDeliveryJoins+" WHERE d.status = $1 AND ($2 = 0 OR w.app_id = $3) ORDER BY d.id",
+		models.WebhookDeliveryDead, appID, appID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return deliveries, nil
+}
+
+// MarkWebhookDelivered Отмечает доставку успешной
+func (s *Storage) MarkWebhookDelivered(ctx context.Context, deliveryID int64) error {
+	const operation = "storage.postgres.MarkWebhookDelivered"
+
+	_, err := s.db.ExecContext(ctx,
+		"UPDATE webhook_deliveries SET status = $1, attempts = attempts + 1, last_error = '' WHERE id = $2",
+		models.WebhookDeliveryDelivered, deliveryID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return nil
+}
+
+// MarkWebhookFailed Запоминает неудачную попытку доставки
+// Если dead, доставка больше не повторяется и попадает в список недоставленных
+func (s *Storage) MarkWebhookFailed(ctx context.Context, deliveryID int64, reason string, nextAttemptAt time.Time, dead bool) error {
+	const operation = "storage.postgres.MarkWebhookFailed"
+
+	status := models.WebhookDeliveryPending
+	if dead {
+		status = models.WebhookDeliveryDead
+	}
+
+	_, err := s.db.ExecContext(ctx,
+		"UPDATE webhook_deliveries SET status = $1, attempts = attempts + 1, last_error = $2, next_attempt_at = $3 WHERE id = $4",
+		status, reason, nextAttemptAt.UnixNano(), deliveryID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return nil
+}
+
+// ReplayWebhookDelivery Возвращает недоставленную доставку в очередь с обнулёнными попытками
+func (s *Storage) ReplayWebhookDelivery(ctx context.Context, deliveryID int64) error {
+	const operation = "storage.postgres.ReplayWebhookDelivery"
+
+	res, err := s.db.ExecContext(ctx,
+		"UPDATE webhook_deliveries SET status = $1, attempts = 0, next_attempt_at = $2 WHERE id = $3 AND status = $4",
+		models.WebhookDeliveryPending, time.Now().UnixNano(), deliveryID, models.WebhookDeliveryDead,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if affected == 0 {
+		return fmt.Errorf("%s: %w", operation, storage.ErrWebhookDeliveryNotFound)
+	}
+
+	return nil
+}
+
+func (s *Storage) queryWebhookDeliveries(ctx context.Context, query string, args ...any) ([]models.WebhookDelivery, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []models.WebhookDelivery
+
+	for rows.Next() {
+		delivery, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		deliveries = append(deliveries, delivery)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+func scanWebhookDelivery(rows *sql.Rows) (models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+	var nextAttemptAt, createdAt int64
+
+	err := rows.Scan(&delivery.Id, &delivery.WebhookId, &delivery.AppId, &delivery.URL, &delivery.Secret,
+		&delivery.EventId, &delivery.EventType, &delivery.Body, &delivery.Status, &delivery.Attempts,
+		&delivery.LastError, &nextAttemptAt, &createdAt)
+	if err != nil {
+		return models.WebhookDelivery{}, err
+	}
+
+	delivery.NextAttemptAt = time.Unix(0, nextAttemptAt)
+	delivery.CreatedAt = time.Unix(0, createdAt)
+
+	return delivery, nil
+}
@@ -0,0 +1,65 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Schema Версия миграций бд
+type Schema struct {
+	Version uint
+	// Миграция упала на середине, бд в неизвестном состоянии
+	Dirty bool
+}
+
+// Snapshot Пишет согласованную копию бд в файл path через VACUUM INTO, не останавливая запись в бд.
+// Файла path ещё не должно быть
+func (s *Storage) Snapshot(ctx context.Context, path string) error {
+	const operation = "storage.sqlite.Snapshot"
+
+	if _, err := s.db.ExecContext(ctx, "VACUUM INTO ?", path); err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return nil
+}
+
+// Inspect Открывает файл бд только на чтение, проверяет его целостность и возвращает версию миграций
+// из таблицы migrationsTable
+func Inspect(ctx context.Context, path string, migrationsTable string) (Schema, error) {
+	const operation = "storage.sqlite.Inspect"
+
+	db, err := sql.Open("sqlite3", "file:"+(&url.URL{Path: path}).EscapedPath()+"?mode=ro")
+	if err != nil {
+		return Schema{}, fmt.Errorf("%s: %w", operation, err)
+	}
+	defer db.Close()
+
+	var result string
+	if err := db.QueryRowContext(ctx, "PRAGMA integrity_check").Scan(&result); err != nil {
+		return Schema{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if result != "ok" {
+		return Schema{}, fmt.Errorf("%s: integrity check failed: %s", operation, result)
+	}
+
+	var schema Schema
+
+	table := `"` + strings.ReplaceAll(migrationsTable, `"`, `""`) + `"`
+
+	err = db.QueryRowContext(ctx, "SELECT version, dirty FROM "+table+" LIMIT 1").Scan(&schema.Version, &schema.Dirty)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Schema{}, fmt.Errorf("%s: no migrations applied", operation)
+	}
+
+	if err != nil {
+		return Schema{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return schema, nil
+}
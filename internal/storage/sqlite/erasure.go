@@ -0,0 +1,289 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/mattn/go-sqlite3"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/lib/auditchain"
+	"shilka-sso/internal/lib/usernames"
+	"shilka-sso/internal/storage"
+	"time"
+)
+
+// Таблицы, из которых при удалении пользователя стираются все его строки
+var erasedTables = []string{
+	"personal_tokens",
+	"passkeys",
+	"passkey_sessions",
+	"passwordless_challenges",
+	"federated_identities",
+	"user_identifiers",
+	"oauth_codes",
+	"device_codes",
+	"username_collisions",
+	"account_status_history",
+	"erasure_requests",
+}
+
+// SaveErasureRequest Сохраняет запрос на удаление данных пользователя
+// Удалённый пользователь считается не найденным, второй запрос для того же пользователя - ErrErasureRequestExists
+func (s *Storage) SaveErasureRequest(ctx context.Context, request models.ErasureRequest) error {
+	const operation = "storage.sqlite.SaveErasureRequest"
+
+	tx, err := s.beginTx(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+	defer tx.Rollback()
+
+	if err := checkNotErased(ctx, tx, request.UserId); err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO erasure_requests(user_id, actor_id, reason, requested_at, erase_at) VALUES (?, ?, ?, ?, ?)",
+		request.UserId, request.ActorId, request.Reason, request.RequestedAt.UnixNano(), request.EraseAt.UnixNano(),
+	)
+	if err != nil {
+		var sqliteErr sqlite3.Error
+
+		if errors.As(err, &sqliteErr) && errors.Is(sqliteErr.ExtendedCode, sqlite3.ErrConstraintPrimaryKey) {
+			return fmt.Errorf("%s: %w", operation, storage.ErrErasureRequestExists)
+		}
+
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return nil
+}
+
+// ErasureRequest Возвращает запрос на удаление данных пользователя
+func (s *Storage) ErasureRequest(ctx context.Context, userID int64) (models.ErasureRequest, error) {
+	const operation = "storage.sqlite.ErasureRequest"
+
+	row := s.conn(ctx).QueryRowContext(ctx,
+		"SELECT user_id, actor_id, reason, requested_at, erase_at FROM erasure_requests WHERE user_id = ?",
+		userID,
+	)
+
+	request, err := scanErasureRequest(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.ErasureRequest{}, fmt.Errorf("%s: %w", operation, storage.ErrErasureRequestNotFound)
+		}
+
+		return models.ErasureRequest{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return request, nil
+}
+
+// DeleteErasureRequest Отменяет запрос на удаление данных пользователя
+func (s *Storage) DeleteErasureRequest(ctx context.Context, userID int64) error {
+	const operation = "storage.sqlite.DeleteErasureRequest"
+
+	res, err := s.conn(ctx).ExecContext(ctx, "DELETE FROM erasure_requests WHERE user_id = ?", userID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if affected == 0 {
+		return fmt.Errorf("%s: %w", operation, storage.ErrErasureRequestNotFound)
+	}
+
+	return nil
+}
+
+// DueErasureRequests Возвращает запросы на удаление, срок отмены которых истёк к now
+func (s *Storage) DueErasureRequests(ctx context.Context, now time.Time) ([]models.ErasureRequest, error) {
+	const operation = "storage.sqlite.DueErasureRequests"
+
+	rows, err := s.conn(ctx).QueryContext(ctx,
+		"SELECT user_id, actor_id, reason, requested_at, erase_at FROM erasure_requests WHERE erase_at <= ? ORDER BY erase_at",
+		now.UnixNano(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+	defer rows.Close()
+
+	var requests []models.ErasureRequest
+
+	for rows.Next() {
+		request, err := scanErasureRequest(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", operation, err)
+		}
+
+		requests = append(requests, request)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return requests, nil
+}
+
+// EraseUser Удаляет данные пользователя во всех таблицах
+// Строка в users остаётся под псевдонимом и без пароля, чтобы id не достался новому пользователю
+// и записи аудита не начали указывать на другого человека. Из записей аудита auditRecordIDs персональные
+// поля заменяются хэшами, доставленные и недоставляемые события о пользователе удаляются из outbox
+// вместе с отправками вебхуков. В outbox пишется событие user.deleted, в цепочку аудита - запись erased
+// в той же транзакции, время записи erased считается временем удаления данных
+func (s *Storage) EraseUser(ctx context.Context, userID int64, auditRecordIDs []int64, erased models.AuditRecord) error {
+	const operation = "storage.sqlite.EraseUser"
+
+	defer s.lockAudit(ctx)()
+
+	tx, err := s.beginTx(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+	defer tx.Rollback()
+
+	if err := checkNotErased(ctx, tx, userID); err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	for _, table := range erasedTables {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM "+table+" WHERE user_id = ?", userID); err != nil {
+			return fmt.Errorf("%s: %s: %w", operation, table, err)
+		}
+	}
+
+	pseudonym := models.ErasedUsername(userID)
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE users SET username = ?, username_canonical = ?, pass_hash = ?, is_admin = FALSE,
+			status = ?, status_reason = '', suspended_until = NULL
+		WHERE id = ?`,
+		pseudonym, usernames.Canonical(pseudonym), []byte{}, models.AccountErased, userID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	// Ожидающие отправки события остаются, иначе подписчики не узнают о последних изменениях.
+	// Недоставляемые удаляются: сами они уже не уйдут, а имя пользователя в них осталось бы
+	_, err = tx.ExecContext(ctx, `
+		DELETE FROM webhook_deliveries WHERE status != ? AND event_id IN (
+			SELECT id FROM outbox WHERE (delivered_at IS NOT NULL OR dead_at IS NOT NULL) AND json_extract(CAST(payload AS TEXT), '$.user_id') = ?
+		)`,
+		models.WebhookDeliveryPending, userID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"DELETE FROM outbox WHERE (delivered_at IS NOT NULL OR dead_at IS NOT NULL) AND json_extract(CAST(payload AS TEXT), '$.user_id') = ?",
+		userID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	for _, recordID := range auditRecordIDs {
+		if err := redactAuditRecord(ctx, tx, recordID, userID, pseudonym, erased.CreatedAt); err != nil {
+			return fmt.Errorf("%s: %w", operation, err)
+		}
+	}
+
+	if _, err := appendAuditRecord(ctx, tx, erased); err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if err := insertEvent(ctx, tx, models.EventUserDeleted, models.UserEventPayload{UserId: userID}); err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return nil
+}
+
+// Возвращает ErrUserNotFound, если пользователя нет или его данные уже удалены
+func checkNotErased(ctx context.Context, tx *transaction, userID int64) error {
+	var status string
+
+	err := tx.QueryRowContext(ctx, "SELECT status FROM users WHERE id = ?", userID).Scan(&status)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return storage.ErrUserNotFound
+		}
+
+		return err
+	}
+
+	if status == models.AccountErased {
+		return storage.ErrUserNotFound
+	}
+
+	return nil
+}
+
+// Убирает персональные поля из записи аудита, см. auditchain.Redact. Запись чужого пользователя не трогается
+func redactAuditRecord(
+	ctx context.Context,
+	tx *transaction,
+	recordID int64,
+	userID int64,
+	pseudonym string,
+	redactedAt time.Time,
+) error {
+	record, err := scanAuditRecord(tx.QueryRowContext(ctx, "SELECT "+auditRecordColumns+" FROM audit_log WHERE id = ? AND user_id = ?", recordID, userID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+
+		return err
+	}
+
+	record, err = auditchain.Redact(record, pseudonym, redactedAt)
+	if err != nil {
+		return err
+	}
+
+	salts, err := encodeFieldSalts(record.FieldSalts)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"UPDATE audit_log SET payload = ?, field_salts = ?, redacted_at = ? WHERE id = ?",
+		record.Payload, salts, redactedAt.UnixNano(), recordID,
+	)
+
+	return err
+}
+
+func scanErasureRequest(row scanner) (models.ErasureRequest, error) {
+	var request models.ErasureRequest
+	var requestedAt, eraseAt int64
+
+	err := row.Scan(&request.UserId, &request.ActorId, &request.Reason, &requestedAt, &eraseAt)
+	if err != nil {
+		return models.ErasureRequest{}, err
+	}
+
+	request.RequestedAt = time.Unix(0, requestedAt)
+	request.EraseAt = time.Unix(0, eraseAt)
+
+	return request, nil
+}
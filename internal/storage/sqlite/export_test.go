@@ -0,0 +1,46 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/lib/usernames"
+	"shilka-sso/internal/storage"
+)
+
+// Те же запросы, что в GetUser и SaveUser, но без подготовленных запросов.
+// Нужны бенчмаркам, чтобы измерить выигрыш от подготовки
+
+// GetUserUnprepared То же, что GetUser, но через db.QueryRowContext
+func (s *Storage) GetUserUnprepared(ctx context.Context, username string) (models.User, error) {
+	row := s.db.QueryRowContext(ctx, getUserQuery, usernames.Canonical(username), username, username)
+
+	user, err := scanUser(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.User{}, storage.ErrUserNotFound
+	}
+
+	return user, err
+}
+
+// SaveUserUnprepared То же, что SaveUser, но вставка через tx.ExecContext
+func (s *Storage) SaveUserUnprepared(ctx context.Context, username string, passwordHash []byte) (int64, error) {
+	tx, err := s.beginTx(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	exec := func(ctx context.Context, args ...any) (sql.Result, error) {
+		return tx.ExecContext(ctx, insertUserQuery, args...)
+	}
+
+	id, err := insertUserWith(ctx, tx, exec, username, passwordHash)
+	if err != nil {
+		return 0, fmt.Errorf("insert user: %w", err)
+	}
+
+	return id, tx.Commit()
+}
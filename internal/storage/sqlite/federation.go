@@ -0,0 +1,178 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/storage"
+	"time"
+)
+
+// FederatedUser Возвращает пользователя, связанного с пользователем subject внешнего провайдера
+func (s *Storage) FederatedUser(ctx context.Context, connectorID string, subject string) (models.User, error) {
+	const operation = "storage.sqlite.FederatedUser"
+
+	row := s.conn(ctx).QueryRowContext(ctx, `
+		SELECT `+userColumns+` FROM users
+		WHERE id = (SELECT user_id FROM federated_identities WHERE connector_id = ? AND subject = ?)`,
+		connectorID, subject,
+	)
+
+	user, err := scanUser(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.User{}, fmt.Errorf("%s: %w", operation, storage.ErrFederatedIdentityNotFound)
+		}
+
+		return models.User{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return user, nil
+}
+
+// LinkFederatedIdentity Связывает существующего пользователя с пользователем внешнего провайдера
+func (s *Storage) LinkFederatedIdentity(ctx context.Context, identity models.FederatedIdentity) error {
+	const operation = "storage.sqlite.LinkFederatedIdentity"
+
+	_, err := s.conn(ctx).ExecContext(ctx,
+		"INSERT INTO federated_identities(connector_id, subject, user_id, created_at) VALUES (?, ?, ?, ?)",
+		identity.ConnectorId, identity.Subject, identity.UserId, identity.CreatedAt.UnixNano(),
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return nil
+}
+
+// FederatedIdentities Возвращает связи пользователя с внешними провайдерами
+func (s *Storage) FederatedIdentities(ctx context.Context, userID int64) ([]models.FederatedIdentity, error) {
+	const operation = "storage.sqlite.FederatedIdentities"
+
+	rows, err := s.conn(ctx).QueryContext(ctx,
+		"SELECT connector_id, subject, user_id, created_at FROM federated_identities WHERE user_id = ? ORDER BY created_at",
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+	defer rows.Close()
+
+	var identities []models.FederatedIdentity
+
+	for rows.Next() {
+		var identity models.FederatedIdentity
+		var createdAt int64
+
+		if err := rows.Scan(&identity.ConnectorId, &identity.Subject, &identity.UserId, &createdAt); err != nil {
+			return nil, fmt.Errorf("%s: %w", operation, err)
+		}
+
+		identity.CreatedAt = time.Unix(0, createdAt)
+		identities = append(identities, identity)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return identities, nil
+}
+
+// SaveFederatedUser Создаёт пользователя без пароля и сразу связывает его с пользователем внешнего провайдера
+func (s *Storage) SaveFederatedUser(ctx context.Context, username string, identity models.FederatedIdentity) (int64, error) {
+	const operation = "storage.sqlite.SaveFederatedUser"
+
+	tx, err := s.beginTx(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", operation, err)
+	}
+	defer tx.Rollback()
+
+	// Пустой хэш не совпадает ни с одним паролем, поэтому войти можно только через провайдера
+	id, err := s.insertUser(ctx, tx, username, []byte{})
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO federated_identities(connector_id, subject, user_id, created_at) VALUES (?, ?, ?, ?)",
+		identity.ConnectorId, identity.Subject, id, identity.CreatedAt.UnixNano(),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return id, nil
+}
+
+// SaveConnectorState Сохраняет незавершённый вход через внешний провайдер
+func (s *Storage) SaveConnectorState(ctx context.Context, state models.ConnectorState) error {
+	const operation = "storage.sqlite.SaveConnectorState"
+
+	_, err := s.conn(ctx).ExecContext(ctx, `
+		INSERT INTO connector_states(state_hash, connector_id, nonce, code_verifier, request, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		state.StateHash, state.ConnectorId, state.Nonce, state.CodeVerifier, state.Request, state.ExpiresAt.UnixNano(),
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return nil
+}
+
+// ConsumeConnectorState Возвращает незавершённый вход и удаляет его, чтобы state нельзя было использовать повторно
+// Просроченный вход считается не найденным
+func (s *Storage) ConsumeConnectorState(ctx context.Context, stateHash string) (models.ConnectorState, error) {
+	const operation = "storage.sqlite.ConsumeConnectorState"
+
+	tx, err := s.beginTx(ctx)
+	if err != nil {
+		return models.ConnectorState{}, fmt.Errorf("%s: %w", operation, err)
+	}
+	defer tx.Rollback()
+
+	row := tx.QueryRowContext(ctx,
+		"SELECT state_hash, connector_id, nonce, code_verifier, request, expires_at FROM connector_states WHERE state_hash = ?",
+		stateHash,
+	)
+
+	var state models.ConnectorState
+	var expiresAt int64
+
+	err = row.Scan(&state.StateHash, &state.ConnectorId, &state.Nonce, &state.CodeVerifier, &state.Request, &expiresAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.ConnectorState{}, fmt.Errorf("%s: %w", operation, storage.ErrConnectorStateNotFound)
+		}
+
+		return models.ConnectorState{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	// Заодно удаляем все просроченные входы
+	_, err = tx.ExecContext(ctx,
+		"DELETE FROM connector_states WHERE state_hash = ? OR expires_at <= ?",
+		stateHash, time.Now().UnixNano(),
+	)
+	if err != nil {
+		return models.ConnectorState{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.ConnectorState{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	state.ExpiresAt = time.Unix(0, expiresAt)
+	if time.Now().After(state.ExpiresAt) {
+		return models.ConnectorState{}, fmt.Errorf("%s: %w", operation, storage.ErrConnectorStateNotFound)
+	}
+
+	return state, nil
+}
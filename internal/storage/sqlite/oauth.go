@@ -0,0 +1,86 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/storage"
+	"time"
+)
+
+// SaveAuthCode Сохраняет код авторизации OAuth
+func (s *Storage) SaveAuthCode(ctx context.Context, code models.AuthCode) error {
+	const operation = "storage.sqlite.SaveAuthCode"
+
+	_, err := s.conn(ctx).ExecContext(ctx, `
+		INSERT INTO oauth_codes(code_hash, app_id, user_id, redirect_uri, code_challenge, scope, nonce, auth_time, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		code.CodeHash, code.AppId, code.UserId, code.RedirectURI, code.CodeChallenge, code.Scope, code.Nonce,
+		code.AuthTime.UnixNano(), code.ExpiresAt.UnixNano(), code.CreatedAt.UnixNano(),
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return nil
+}
+
+// ConsumeAuthCode Возвращает код авторизации и сразу помечает его использованным
+// Использованный или просроченный код считается не найденным
+func (s *Storage) ConsumeAuthCode(ctx context.Context, codeHash string) (models.AuthCode, error) {
+	const operation = "storage.sqlite.ConsumeAuthCode"
+
+	tx, err := s.beginTx(ctx)
+	if err != nil {
+		return models.AuthCode{}, fmt.Errorf("%s: %w", operation, err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx,
+		"UPDATE oauth_codes SET used = TRUE WHERE code_hash = ? AND used = FALSE AND expires_at > ?",
+		codeHash, time.Now().UnixNano(),
+	)
+	if err != nil {
+		return models.AuthCode{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return models.AuthCode{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if affected == 0 {
+		return models.AuthCode{}, fmt.Errorf("%s: %w", operation, storage.ErrAuthCodeNotFound)
+	}
+
+	row := tx.QueryRowContext(ctx, `
+		SELECT code_hash, app_id, user_id, redirect_uri, code_challenge, scope, nonce, auth_time, expires_at, created_at
+		FROM oauth_codes WHERE code_hash = ?`,
+		codeHash,
+	)
+
+	var code models.AuthCode
+	var authTime, expiresAt, createdAt int64
+
+	err = row.Scan(&code.CodeHash, &code.AppId, &code.UserId, &code.RedirectURI, &code.CodeChallenge,
+		&code.Scope, &code.Nonce, &authTime, &expiresAt, &createdAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.AuthCode{}, fmt.Errorf("%s: %w", operation, storage.ErrAuthCodeNotFound)
+		}
+
+		return models.AuthCode{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.AuthCode{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	code.AuthTime = time.Unix(0, authTime)
+	code.ExpiresAt = time.Unix(0, expiresAt)
+	code.CreatedAt = time.Unix(0, createdAt)
+
+	return code, nil
+}
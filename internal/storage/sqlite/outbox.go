@@ -0,0 +1,165 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/storage"
+	"time"
+)
+
+// Кладёт событие в outbox в рамках транзакции, которая меняет данные пользователя
+func insertEvent(ctx context.Context, tx *transaction, eventType string, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO outbox(event_type, payload, created_at) VALUES (?, ?, ?)",
+		eventType, data, time.Now().UnixNano(),
+	)
+
+	return err
+}
+
+// PendingEvents Возвращает до limit ещё не доставленных событий по порядку, кроме недоставляемых
+// Событие отдаётся и до наступления NextAttemptAt, чтобы диспетчер не опубликовал следующие раньше него
+func (s *Storage) PendingEvents(ctx context.Context, limit int) ([]models.Event, error) {
+	const operation = "storage.sqlite.PendingEvents"
+
+	events, err := s.queryEvents(ctx,
+		"SELECT"+eventColumns+"FROM outbox WHERE delivered_at IS NULL AND dead_at IS NULL ORDER BY id LIMIT ?",
+		limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return events, nil
+}
+
+// DeadEvents Возвращает недоставляемые события по порядку
+func (s *Storage) DeadEvents(ctx context.Context) ([]models.Event, error) {
+	const operation = "storage.sqlite.DeadEvents"
+
+	events, err := s.queryEvents(ctx, "SELECT"+eventColumns+"FROM outbox WHERE dead_at IS NOT NULL ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return events, nil
+}
+
+// MarkEventDelivered Отмечает событие доставленным
+func (s *Storage) MarkEventDelivered(ctx context.Context, eventID int64) error {
+	const operation = "storage.sqlite.MarkEventDelivered"
+
+	_, err := s.conn(ctx).ExecContext(ctx,
+		"UPDATE outbox SET delivered_at = ?, attempts = attempts + 1, last_error = '' WHERE id = ?",
+		time.Now().UnixNano(), eventID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return nil
+}
+
+// MarkEventFailed Запоминает неудачную попытку доставки события и время следующей
+// Если dead, событие больше не отдаётся PendingEvents и остаётся в outbox с последней ошибкой
+func (s *Storage) MarkEventFailed(ctx context.Context, eventID int64, reason string, nextAttemptAt time.Time, dead bool) error {
+	const operation = "storage.sqlite.MarkEventFailed"
+
+	var deadAt sql.NullInt64
+	if dead {
+		deadAt = sql.NullInt64{Int64: time.Now().UnixNano(), Valid: true}
+	}
+
+	_, err := s.conn(ctx).ExecContext(ctx,
+		"UPDATE outbox SET attempts = attempts + 1, last_error = ?, next_attempt_at = ?, dead_at = ? WHERE id = ?",
+		reason, nextAttemptAt.UnixNano(), deadAt, eventID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return nil
+}
+
+// ReplayDeadEvent Возвращает недоставляемое событие в очередь с обнулёнными попытками
+func (s *Storage) ReplayDeadEvent(ctx context.Context, eventID int64) error {
+	const operation = "storage.sqlite.ReplayDeadEvent"
+
+	res, err := s.conn(ctx).ExecContext(ctx,
+		"UPDATE outbox SET attempts = 0, next_attempt_at = NULL, dead_at = NULL WHERE id = ? AND dead_at IS NOT NULL",
+		eventID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if affected == 0 {
+		return fmt.Errorf("%s: %w", operation, storage.ErrEventNotFound)
+	}
+
+	return nil
+}
+
+const eventColumns = " id, event_type, payload, created_at, attempts, last_error, next_attempt_at, dead_at "
+
+func (s *Storage) queryEvents(ctx context.Context, query string, args ...any) ([]models.Event, error) {
+	rows, err := s.conn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []models.Event
+
+	for rows.Next() {
+		event, err := scanEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		events = append(events, event)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+func scanEvent(rows *sql.Rows) (models.Event, error) {
+	var event models.Event
+	var createdAt int64
+	var nextAttemptAt, deadAt sql.NullInt64
+
+	err := rows.Scan(&event.Id, &event.Type, &event.Payload, &createdAt, &event.Attempts,
+		&event.LastError, &nextAttemptAt, &deadAt)
+	if err != nil {
+		return models.Event{}, err
+	}
+
+	event.CreatedAt = time.Unix(0, createdAt)
+
+	if nextAttemptAt.Valid {
+		event.NextAttemptAt = time.Unix(0, nextAttemptAt.Int64)
+	}
+
+	if deadAt.Valid {
+		event.DeadAt = time.Unix(0, deadAt.Int64)
+	}
+
+	return event, nil
+}
@@ -0,0 +1,118 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/storage"
+	"time"
+)
+
+// SavePasswordlessChallenge Сохраняет вход без пароля
+func (s *Storage) SavePasswordlessChallenge(ctx context.Context, challenge models.PasswordlessChallenge) error {
+	const operation = "storage.sqlite.SavePasswordlessChallenge"
+
+	_, err := s.conn(ctx).ExecContext(ctx, `
+		INSERT INTO passwordless_challenges(id, user_id, app_id, method, code_hash, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		challenge.Id, challenge.UserId, challenge.AppId, challenge.Method, challenge.CodeHash,
+		challenge.ExpiresAt.UnixNano(), challenge.CreatedAt.UnixNano(),
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return nil
+}
+
+// UsePasswordlessAttempt Тратит одну попытку ввода кода и возвращает вход
+// Если попытки кончились или вход просрочен, он считается не найденным.
+// Попытка списывается до проверки кода, поэтому параллельные запросы не дают перебрать больше maxAttempts кодов
+func (s *Storage) UsePasswordlessAttempt(
+	ctx context.Context,
+	challengeID string,
+	maxAttempts int,
+) (models.PasswordlessChallenge, error) {
+	const operation = "storage.sqlite.UsePasswordlessAttempt"
+
+	tx, err := s.beginTx(ctx)
+	if err != nil {
+		return models.PasswordlessChallenge{}, fmt.Errorf("%s: %w", operation, err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx,
+		"UPDATE passwordless_challenges SET attempts = attempts + 1 WHERE id = ? AND attempts < ? AND expires_at > ?",
+		challengeID, maxAttempts, time.Now().UnixNano(),
+	)
+	if err != nil {
+		return models.PasswordlessChallenge{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return models.PasswordlessChallenge{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if affected == 0 {
+		return models.PasswordlessChallenge{}, fmt.Errorf("%s: %w", operation, storage.ErrPasswordlessChallengeNotFound)
+	}
+
+	row := tx.QueryRowContext(ctx, `
+		SELECT id, user_id, app_id, method, code_hash, attempts, expires_at, created_at
+		FROM passwordless_challenges WHERE id = ?`,
+		challengeID,
+	)
+
+	var challenge models.PasswordlessChallenge
+	var expiresAt, createdAt int64
+
+	err = row.Scan(&challenge.Id, &challenge.UserId, &challenge.AppId, &challenge.Method, &challenge.CodeHash,
+		&challenge.Attempts, &expiresAt, &createdAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.PasswordlessChallenge{}, fmt.Errorf("%s: %w", operation, storage.ErrPasswordlessChallengeNotFound)
+		}
+
+		return models.PasswordlessChallenge{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.PasswordlessChallenge{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	challenge.ExpiresAt = time.Unix(0, expiresAt)
+	challenge.CreatedAt = time.Unix(0, createdAt)
+
+	return challenge, nil
+}
+
+// DeletePasswordlessChallenge Удаляет вход после успешного ввода кода
+// Если вход уже удалён параллельным запросом, он считается не найденным, так код нельзя использовать дважды
+func (s *Storage) DeletePasswordlessChallenge(ctx context.Context, challengeID string) error {
+	const operation = "storage.sqlite.DeletePasswordlessChallenge"
+
+	res, err := s.conn(ctx).ExecContext(ctx, "DELETE FROM passwordless_challenges WHERE id = ?", challengeID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if affected == 0 {
+		return fmt.Errorf("%s: %w", operation, storage.ErrPasswordlessChallengeNotFound)
+	}
+
+	// Заодно удаляем все просроченные входы
+	_, err = s.conn(ctx).ExecContext(ctx, "DELETE FROM passwordless_challenges WHERE expires_at <= ?", time.Now().UnixNano())
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return nil
+}
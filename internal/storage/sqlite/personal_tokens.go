@@ -0,0 +1,166 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/mattn/go-sqlite3"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/storage"
+	"strings"
+	"time"
+)
+
+// SavePersonalToken Сохраняет токен доступа пользователя
+func (s *Storage) SavePersonalToken(ctx context.Context, token models.PersonalToken) (int64, error) {
+	const operation = "storage.sqlite.SavePersonalToken"
+
+	res, err := s.conn(ctx).ExecContext(ctx,
+		"INSERT INTO personal_tokens(user_id, name, token_hash, scopes, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?)",
+		token.UserId, token.Name, token.TokenHash, strings.Join(token.Scopes, " "),
+		token.CreatedAt.UnixNano(), token.ExpiresAt.UnixNano(),
+	)
+	if err != nil {
+		var sqliteErr sqlite3.Error
+
+		if errors.As(err, &sqliteErr) && errors.Is(sqliteErr.ExtendedCode, sqlite3.ErrConstraintUnique) {
+			return 0, fmt.Errorf("%s: %w", operation, storage.ErrPersonalTokenExists)
+		}
+
+		return 0, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return id, nil
+}
+
+const personalTokenColumns = "id, user_id, name, token_hash, scopes, created_at, expires_at, last_used_at"
+
+// PersonalTokenByHash Возвращает токен доступа по хэшу
+func (s *Storage) PersonalTokenByHash(ctx context.Context, tokenHash string) (models.PersonalToken, error) {
+	const operation = "storage.sqlite.PersonalTokenByHash"
+
+	row := s.conn(ctx).QueryRowContext(ctx,
+		"SELECT "+personalTokenColumns+" FROM personal_tokens WHERE token_hash = ?",
+		tokenHash,
+	)
+
+	token, err := scanPersonalToken(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.PersonalToken{}, fmt.Errorf("%s: %w", operation, storage.ErrPersonalTokenNotFound)
+		}
+
+		return models.PersonalToken{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return token, nil
+}
+
+// PersonalTokens Возвращает токены доступа пользователя
+func (s *Storage) PersonalTokens(ctx context.Context, userID int64) ([]models.PersonalToken, error) {
+	const operation = "storage.sqlite.PersonalTokens"
+
+	rows, err := s.conn(ctx).QueryContext(ctx,
+		"SELECT "+personalTokenColumns+" FROM personal_tokens WHERE user_id = ? ORDER BY id",
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+	defer rows.Close()
+
+	var tokens []models.PersonalToken
+
+	for rows.Next() {
+		token, err := scanPersonalToken(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", operation, err)
+		}
+
+		tokens = append(tokens, token)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return tokens, nil
+}
+
+// DeletePersonalToken Удаляет токен доступа пользователя, чужой токен считается не найденным
+func (s *Storage) DeletePersonalToken(ctx context.Context, userID int64, tokenID int64) error {
+	const operation = "storage.sqlite.DeletePersonalToken"
+
+	res, err := s.conn(ctx).ExecContext(ctx, "DELETE FROM personal_tokens WHERE id = ? AND user_id = ?", tokenID, userID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if affected == 0 {
+		return fmt.Errorf("%s: %w", operation, storage.ErrPersonalTokenNotFound)
+	}
+
+	return nil
+}
+
+// DeletePersonalTokens Удаляет все токены доступа пользователя и возвращает их число
+func (s *Storage) DeletePersonalTokens(ctx context.Context, userID int64) (int64, error) {
+	const operation = "storage.sqlite.DeletePersonalTokens"
+
+	res, err := s.conn(ctx).ExecContext(ctx, "DELETE FROM personal_tokens WHERE user_id = ?", userID)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return affected, nil
+}
+
+// TouchPersonalToken Запоминает время последнего использования токена
+func (s *Storage) TouchPersonalToken(ctx context.Context, tokenID int64, usedAt time.Time) error {
+	const operation = "storage.sqlite.TouchPersonalToken"
+
+	_, err := s.conn(ctx).ExecContext(ctx, "UPDATE personal_tokens SET last_used_at = ? WHERE id = ?", usedAt.UnixNano(), tokenID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return nil
+}
+
+func scanPersonalToken(row scanner) (models.PersonalToken, error) {
+	var token models.PersonalToken
+	var scopes string
+	var createdAt, expiresAt, lastUsedAt int64
+
+	err := row.Scan(&token.Id, &token.UserId, &token.Name, &token.TokenHash, &scopes,
+		&createdAt, &expiresAt, &lastUsedAt)
+	if err != nil {
+		return models.PersonalToken{}, err
+	}
+
+	token.Scopes = strings.Fields(scopes)
+	token.CreatedAt = time.Unix(0, createdAt)
+	token.ExpiresAt = time.Unix(0, expiresAt)
+
+	if lastUsedAt != 0 {
+		token.LastUsedAt = time.Unix(0, lastUsedAt)
+	}
+
+	return token, nil
+}
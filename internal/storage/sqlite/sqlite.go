@@ -7,70 +7,278 @@ import (
 	"errors"
 	"fmt"
 	"github.com/mattn/go-sqlite3"
+	"net/url"
 	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/lib/usernames"
 	"shilka-sso/internal/storage"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type Storage struct {
-	db *sql.DB
+	db    *sql.DB
+	stmts statements
+
+	// Счётчик для имён точек сохранения во вложенных транзакциях
+	savepoints atomic.Int64
+
+	// Записи аудита ссылаются на хэш предыдущей записи, поэтому добавляются по одной
+	auditMu sync.Mutex
+}
+
+// Config Настройки подключения к бд. Пустые поля оставляют значения драйвера и database/sql по умолчанию
+type Config struct {
+	// Режим журнала: WAL, DELETE, TRUNCATE, PERSIST, MEMORY или OFF
+	JournalMode string
+	// Сколько соединение ждёт блокировку бд, прежде чем вернуть SQLITE_BUSY.
+	// Вместе с ним транзакции сразу берут блокировку на запись: иначе транзакция, которая начала с чтения,
+	// получает SQLITE_BUSY при первой записи без всякого ожидания
+	BusyTimeout time.Duration
+	// Режим записи на диск: OFF, NORMAL, FULL или EXTRA
+	Synchronous  string
+	MaxOpenConns int
+	MaxIdleConns int
+}
+
+// Запросы, которые выполняются на каждый вход и регистрацию
+// Готовятся один раз в New и закрываются в Close
+type statements struct {
+	getUser    *sql.Stmt
+	userByID   *sql.Stmt
+	isAdmin    *sql.Stmt
+	getApp     *sql.Stmt
+	insertUser *sql.Stmt
 }
 
-func New(path string) (*Storage, error) {
+// New Открывает бд по пути path и готовит запросы, поэтому к бд уже должны быть применены миграции
+func New(path string, cfg Config) (*Storage, error) {
 	const operation = "storage.sqlite.New"
 
 	// Подключение к бд
-	db, err := sql.Open("sqlite3", path)
+	db, err := sql.Open("sqlite3", dsn(path, cfg))
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", operation, err)
 	}
 
-	return &Storage{db: db}, nil
+	if cfg.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(cfg.MaxOpenConns)
+	}
+
+	if cfg.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(cfg.MaxIdleConns)
+	}
+
+	s := &Storage{db: db}
+
+	if err := s.prepare(); err != nil {
+		s.Close()
+
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return s, nil
+}
+
+// Close Закрывает подготовленные запросы и подключение к бд
+func (s *Storage) Close() error {
+	var errs []error
+
+	for _, stmt := range s.stmts.all() {
+		// После ошибки в prepare часть запросов ещё не готова
+		if stmt != nil {
+			errs = append(errs, stmt.Close())
+		}
+	}
+
+	errs = append(errs, s.db.Close())
+
+	return errors.Join(errs...)
+}
+
+func (st statements) all() []*sql.Stmt {
+	return []*sql.Stmt{st.getUser, st.userByID, st.isAdmin, st.getApp, st.insertUser}
+}
+
+// Тексты запросов из statements
+const (
+	getUserQuery = `
+		SELECT ` + userColumns + ` FROM users
+		WHERE username_canonical = ? OR username = ?
+		ORDER BY username = ? DESC
+		LIMIT 1`
+	userByIDQuery   = "SELECT " + userColumns + " FROM users WHERE id = ?"
+	isAdminQuery    = "SELECT is_admin FROM users WHERE id = ?"
+	getAppQuery     = "SELECT id, name, secret, redirect_uris, scopes FROM apps WHERE id = ?"
+	insertUserQuery = "INSERT INTO users(username, username_canonical, pass_hash) VALUES (?, ?, ?)"
+)
+
+func (s *Storage) prepare() error {
+	queries := []struct {
+		stmt  **sql.Stmt
+		query string
+	}{
+		{&s.stmts.getUser, getUserQuery},
+		{&s.stmts.userByID, userByIDQuery},
+		{&s.stmts.isAdmin, isAdminQuery},
+		{&s.stmts.getApp, getAppQuery},
+		{&s.stmts.insertUser, insertUserQuery},
+	}
+
+	for _, q := range queries {
+		stmt, err := s.db.Prepare(q.query)
+		if err != nil {
+			return fmt.Errorf("prepare %q: %w", strings.TrimSpace(q.query), err)
+		}
+
+		*q.stmt = stmt
+	}
+
+	return nil
+}
+
+// Добавляет к пути до бд параметры драйвера из cfg
+func dsn(path string, cfg Config) string {
+	params := url.Values{}
+
+	if cfg.JournalMode != "" {
+		params.Set("_journal_mode", cfg.JournalMode)
+	}
+
+	if cfg.BusyTimeout > 0 {
+		params.Set("_busy_timeout", strconv.FormatInt(cfg.BusyTimeout.Milliseconds(), 10))
+		params.Set("_txlock", "immediate")
+	}
+
+	if cfg.Synchronous != "" {
+		params.Set("_synchronous", cfg.Synchronous)
+	}
+
+	if len(params) == 0 {
+		return path
+	}
+
+	separator := "?"
+	if strings.Contains(path, "?") {
+		separator = "&"
+	}
+
+	return path + separator + params.Encode()
 }
 
 // SaveUser Сохрарняет пользователя в бд
+// Вместе с пользователем в outbox пишется событие о регистрации
 func (s *Storage) SaveUser(ctx context.Context, username string, passwordHash []byte) (int64, error) {
 	const operation = "storage.sqlite.SaveUser"
 
-	stmt, err := s.db.Prepare("INSERT INTO users(username, pass_hash) VALUES (?, ?)")
+	tx, err := s.beginTx(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", operation, err)
+	}
+	defer tx.Rollback()
 
+	id, err := s.insertUser(ctx, tx, username, passwordHash)
 	if err != nil {
 		return 0, fmt.Errorf("%s: %w", operation, err)
 	}
 
-	res, err := stmt.ExecContext(ctx, username, passwordHash)
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return id, nil
+}
+
+// Добавляет пользователя и событие о его регистрации в рамках транзакции tx
+// Имя уникально в канонической форме, поэтому "Admin" не получится создать рядом с "admin"
+func (s *Storage) insertUser(ctx context.Context, tx *transaction, username string, passwordHash []byte) (int64, error) {
+	return insertUserWith(ctx, tx, tx.StmtContext(ctx, s.stmts.insertUser).ExecContext, username, passwordHash)
+}
+
+// Вставка пользователя через exec: подготовленный запрос или, в бенчмарках, обычный ExecContext
+func insertUserWith(
+	ctx context.Context,
+	tx *transaction,
+	exec func(ctx context.Context, args ...any) (sql.Result, error),
+	username string,
+	passwordHash []byte,
+) (int64, error) {
+	res, err := exec(ctx, username, usernames.Canonical(username), passwordHash)
 
 	if err != nil {
 		var sqliteErr sqlite3.Error
 
 		if errors.As(err, &sqliteErr) && errors.Is(sqliteErr.ExtendedCode, sqlite3.ErrConstraintUnique) {
-			return 0, fmt.Errorf("%s: %w", operation, storage.ErrUserExists)
+			return 0, storage.ErrUserExists
 		}
 
-		return 0, fmt.Errorf("%s: %w", operation, err)
+		return 0, err
 	}
 
 	id, err := res.LastInsertId()
 	if err != nil {
-		return 0, fmt.Errorf("%s: %w", operation, err)
+		return 0, err
+	}
+
+	err = insertEvent(ctx, tx, models.EventUserRegistered, models.UserEventPayload{
+		UserId:   id,
+		Username: username,
+	})
+	if err != nil {
+		return 0, err
 	}
 
 	return id, nil
 }
 
 // GetUser Получает информацию о пользователе по username.
+// Имя сравнивается в канонической форме. Пользователи со старыми совпадающими именами
+// без канонической формы находятся только по точному имени, и оно важнее совпадения по форме
 func (s *Storage) GetUser(ctx context.Context, username string) (models.User, error) {
 	const operation = "storage.sqlite.GetUser"
 
-	stmt, err := s.db.Prepare("SELECT id, username, pass_hash FROM users WHERE username = ?")
+	row := s.stmt(ctx, s.stmts.getUser).QueryRowContext(ctx, usernames.Canonical(username), username, username)
 
+	user, err := scanUser(row)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.User{}, fmt.Errorf("%s: %w", operation, storage.ErrUserNotFound)
+		}
+
 		return models.User{}, fmt.Errorf("%s: %w", operation, err)
 	}
 
-	row := stmt.QueryRowContext(ctx, username)
+	return user, nil
+}
+
+// Колонки users, которые читает scanUser
+const userColumns = "id, username, pass_hash, status, status_reason, suspended_until"
 
+func scanUser(row scanner) (models.User, error) {
 	var user models.User
-	err = row.Scan(&user.Id, &user.Username, &user.PasswordHash)
+	var suspendedUntil sql.NullInt64
+
+	err := row.Scan(&user.Id, &user.Username, &user.PasswordHash, &user.Status, &user.StatusReason, &suspendedUntil)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	if suspendedUntil.Valid {
+		user.SuspendedUntil = time.Unix(0, suspendedUntil.Int64)
+	}
+
+	return user, nil
+}
+
+// UserByID Получает информацию о пользователе по id.
+func (s *Storage) UserByID(ctx context.Context, userID int64) (models.User, error) {
+	const operation = "storage.sqlite.UserByID"
+
+	row := s.stmt(ctx, s.stmts.userByID).QueryRowContext(ctx, userID)
+
+	user, err := scanUser(row)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return models.User{}, fmt.Errorf("%s: %w", operation, storage.ErrUserNotFound)
@@ -86,17 +294,11 @@ func (s *Storage) GetUser(ctx context.Context, username string) (models.User, er
 func (s *Storage) IsAdmin(ctx context.Context, userID int64) (bool, error) {
 	const operation = "storage.sqlite.IsAdmin"
 
-	stmt, err := s.db.Prepare("SELECT is_admin FROM users WHERE id = ?")
-
-	if err != nil {
-		return false, fmt.Errorf("%s: %w", operation, err)
-	}
-
-	row := stmt.QueryRowContext(ctx, userID)
+	row := s.stmt(ctx, s.stmts.isAdmin).QueryRowContext(ctx, userID)
 
 	var isAdmin bool
 
-	err = row.Scan(&isAdmin)
+	err := row.Scan(&isAdmin)
 
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -108,25 +310,207 @@ func (s *Storage) IsAdmin(ctx context.Context, userID int64) (bool, error) {
 	return isAdmin, nil
 }
 
-// GetApp Взвращает приложение по фйди из бд
-func (s *Storage) GetApp(ctx context.Context, appID int) (models.App, error) {
-	const operation = "storage.sqlite.GetApp"
+// SetAdmin Выдаёт или забирает у пользователя права администратора
+// Вместе с изменением в outbox пишется событие о смене роли
+func (s *Storage) SetAdmin(ctx context.Context, userID int64, isAdmin bool) error {
+	const operation = "storage.sqlite.SetAdmin"
 
-	stmt, err := s.db.Prepare("SELECT id, name, secret FROM apps WHERE id = ?")
+	tx, err := s.beginTx(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+	defer tx.Rollback()
 
+	res, err := tx.ExecContext(ctx, "UPDATE users SET is_admin = ? WHERE id = ?", isAdmin, userID)
 	if err != nil {
-		return models.App{}, fmt.Errorf("%s: %w", operation, err)
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if affected == 0 {
+		return fmt.Errorf("%s: %w", operation, storage.ErrUserNotFound)
+	}
+
+	err = insertEvent(ctx, tx, models.EventUserRoleChanged, models.UserEventPayload{
+		UserId:  userID,
+		IsAdmin: &isAdmin,
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
 	}
 
-	row := stmt.QueryRowContext(ctx, appID)
+	return nil
+}
+
+// SetUsername Меняет имя пользователя
+// Имя уникально в канонической форме, как и при регистрации. Вместе с изменением в outbox пишется событие
+func (s *Storage) SetUsername(ctx context.Context, userID int64, username string) error {
+	const operation = "storage.sqlite.SetUsername"
+
+	tx, err := s.beginTx(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx,
+		"UPDATE users SET username = ?, username_canonical = ? WHERE id = ?",
+		username, usernames.Canonical(username), userID,
+	)
+	if err != nil {
+		var sqliteErr sqlite3.Error
+
+		if errors.As(err, &sqliteErr) && errors.Is(sqliteErr.ExtendedCode, sqlite3.ErrConstraintUnique) {
+			return fmt.Errorf("%s: %w", operation, storage.ErrUserExists)
+		}
+
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if affected == 0 {
+		return fmt.Errorf("%s: %w", operation, storage.ErrUserNotFound)
+	}
+
+	err = insertEvent(ctx, tx, models.EventUserRenamed, models.UserEventPayload{
+		UserId:   userID,
+		Username: username,
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return nil
+}
+
+// SetPasswordHash Меняет хэш пароля пользователя
+func (s *Storage) SetPasswordHash(ctx context.Context, userID int64, passwordHash []byte) error {
+	const operation = "storage.sqlite.SetPasswordHash"
+
+	res, err := s.conn(ctx).ExecContext(ctx, "UPDATE users SET pass_hash = ? WHERE id = ?", passwordHash, userID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if affected == 0 {
+		return fmt.Errorf("%s: %w", operation, storage.ErrUserNotFound)
+	}
+
+	return nil
+}
+
+// ListUsers Возвращает до limit пользователей с id больше afterID по возрастанию id
+// Чтобы пройти всех пользователей, следующую страницу запрашивают с id последнего пользователя
+func (s *Storage) ListUsers(ctx context.Context, afterID int64, limit int) ([]models.User, error) {
+	const operation = "storage.sqlite.ListUsers"
+
+	rows, err := s.conn(ctx).QueryContext(ctx,
+		"SELECT "+userColumns+" FROM users WHERE id > ? ORDER BY id LIMIT ?",
+		afterID, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+	defer rows.Close()
+
+	var result []models.User
+
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", operation, err)
+		}
+
+		result = append(result, user)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return result, nil
+}
+
+// GetApp Взвращает приложение по фйди из бд
+func (s *Storage) GetApp(ctx context.Context, appID int) (models.App, error) {
+	const operation = "storage.sqlite.GetApp"
+
+	row := s.stmt(ctx, s.stmts.getApp).QueryRowContext(ctx, appID)
 
 	var app models.App
-	err = row.Scan(&app.Id, &app.Name, &app.Secret)
+	var redirectURIs, scopes string
+	err := row.Scan(&app.Id, &app.Name, &app.Secret, &redirectURIs, &scopes)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return models.App{}, fmt.Errorf("%s: %w", operation, storage.ErrAppNotFound)
 		}
 		return models.App{}, fmt.Errorf("%s: %w", operation, err)
 	}
+
+	if redirectURIs != "" {
+		app.RedirectURIs = strings.Split(redirectURIs, "\n")
+	}
+
+	if scopes != "" {
+		app.Scopes = strings.Split(scopes, "\n")
+	}
+
 	return app, nil
 }
+
+// SetAppRedirectURIs Заменяет список адресов возврата приложения
+func (s *Storage) SetAppRedirectURIs(ctx context.Context, appID int, redirectURIs []string) error {
+	const operation = "storage.sqlite.SetAppRedirectURIs"
+
+	return s.setAppList(ctx, operation, "redirect_uris", appID, redirectURIs)
+}
+
+// SetAppScopes Заменяет список scope, которые приложение может запрашивать
+func (s *Storage) SetAppScopes(ctx context.Context, appID int, scopes []string) error {
+	const operation = "storage.sqlite.SetAppScopes"
+
+	return s.setAppList(ctx, operation, "scopes", appID, scopes)
+}
+
+// Записывает список в колонку приложения через перевод строки
+func (s *Storage) setAppList(ctx context.Context, operation string, column string, appID int, values []string) error {
+	res, err := s.conn(ctx).ExecContext(ctx,
+		"UPDATE apps SET "+column+" = ? WHERE id = ?",
+		strings.Join(values, "\n"), appID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if affected == 0 {
+		return fmt.Errorf("%s: %w", operation, storage.ErrAppNotFound)
+	}
+
+	return nil
+}
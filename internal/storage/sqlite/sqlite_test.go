@@ -0,0 +1,135 @@
+package sqlite_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/storage/sqlite"
+	"shilka-sso/internal/storage/sqlite/sqlitetest"
+	"shilka-sso/internal/storage/storagetest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Настройки, с которыми сервис открывает бд по умолчанию
+var tuned = sqlite.Config{
+	JournalMode:  "WAL",
+	BusyTimeout:  5 * time.Second,
+	Synchronous:  "NORMAL",
+	MaxOpenConns: 10,
+	MaxIdleConns: 10,
+}
+
+func TestConformance(t *testing.T) {
+	for name, cfg := range map[string]sqlite.Config{"defaults": {}, "tuned": tuned} {
+		t.Run(name, func(t *testing.T) {
+			storagetest.Run(t, func(t *testing.T, apps ...models.App) storagetest.Storage {
+				st, path := sqlitetest.NewWithConfig(t, cfg)
+
+				for _, app := range apps {
+					sqlitetest.SaveApp(t, path, app)
+				}
+
+				return st
+			})
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	// Запросы готовятся при открытии, поэтому бд без миграций не откроется
+	_, err := sqlite.New(filepath.Join(t.TempDir(), "empty.db"), sqlite.Config{})
+	assert.Error(t, err)
+
+	_, path := sqlitetest.New(t)
+
+	_, err = sqlite.New(path, sqlite.Config{JournalMode: "fast"})
+	assert.Error(t, err)
+
+	st, err := sqlite.New(path, tuned)
+	require.NoError(t, err)
+	require.NoError(t, st.Close())
+
+	_, err = st.GetUser(context.Background(), "ivan")
+	assert.Error(t, err)
+}
+
+// Параллельная регистрация с настройками драйвера по умолчанию и с настройками сервиса
+// Ошибки SQLITE_BUSY не роняют бенчмарк, а считаются в errors/op
+func BenchmarkSaveUser(b *testing.B) {
+	for _, bench := range []struct {
+		name       string
+		cfg        sqlite.Config
+		unprepared bool
+	}{
+		{"defaults", sqlite.Config{}, false},
+		{"tuned", tuned, false},
+		// Настройки сервиса, но вставка без подготовленного запроса: разница с tuned - выигрыш от подготовки
+		{"tuned-unprepared", tuned, true},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			st, _ := sqlitetest.NewWithConfig(b, bench.cfg)
+			ctx := context.Background()
+
+			save := st.SaveUser
+			if bench.unprepared {
+				save = st.SaveUserUnprepared
+			}
+
+			var seq, failed atomic.Int64
+
+			b.ResetTimer()
+
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if _, err := save(ctx, fmt.Sprintf("user%d", seq.Add(1)), []byte("hash")); err != nil {
+						failed.Add(1)
+					}
+				}
+			})
+
+			b.ReportMetric(float64(failed.Load())/float64(b.N), "errors/op")
+		})
+	}
+}
+
+// Параллельный поиск пользователя, как при входе
+func BenchmarkGetUser(b *testing.B) {
+	for _, bench := range []struct {
+		name       string
+		cfg        sqlite.Config
+		unprepared bool
+	}{
+		{"defaults", sqlite.Config{}, false},
+		{"tuned", tuned, false},
+		{"tuned-unprepared", tuned, true},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			st, _ := sqlitetest.NewWithConfig(b, bench.cfg)
+			ctx := context.Background()
+
+			get := st.GetUser
+			if bench.unprepared {
+				get = st.GetUserUnprepared
+			}
+
+			_, err := st.SaveUser(ctx, "ivan", []byte("hash"))
+			require.NoError(b, err)
+
+			b.ResetTimer()
+
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if _, err := get(ctx, "ivan"); err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,75 @@
+// Package sqlitetest Временная бд sqlite с применёнными миграциями для тестов
+package sqlitetest
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/sqlite3"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"path/filepath"
+	"runtime"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/storage/sqlite"
+	"testing"
+)
+
+// New Создаёт бд во временной папке теста, применяет к ней миграции из migrations
+// и возвращает хранилище вместе с путём до файла бд. Хранилище закрывается после теста
+func New(t testing.TB) (*sqlite.Storage, string) {
+	t.Helper()
+
+	return NewWithConfig(t, sqlite.Config{})
+}
+
+// NewWithConfig То же, что New, но хранилище открывается с настройками cfg
+func NewWithConfig(t testing.TB, cfg sqlite.Config) (*sqlite.Storage, string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "sso.db")
+
+	m, err := migrate.New(
+		"file://"+migrationsPath(),
+		fmt.Sprintf("sqlite3://%s?x-migrations-table=migrations", path),
+	)
+	if err != nil {
+		t.Fatalf("failed to init migrations: %v", err)
+	}
+
+	if err := m.Up(); err != nil {
+		t.Fatalf("failed to apply migrations: %v", err)
+	}
+
+	if srcErr, dbErr := m.Close(); srcErr != nil || dbErr != nil {
+		t.Fatalf("failed to close migrations: %v, %v", srcErr, dbErr)
+	}
+
+	storage, err := sqlite.New(path, cfg)
+	if err != nil {
+		t.Fatalf("failed to open storage: %v", err)
+	}
+	t.Cleanup(func() { storage.Close() })
+
+	return storage, path
+}
+
+// SaveApp Добавляет приложение напрямую в бд, у хранилища нет метода для этого
+func SaveApp(t testing.TB, path string, app models.App) {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	defer db.Close()
+
+	if _, err := db.Exec("INSERT INTO apps(id, name, secret) VALUES (?, ?, ?)", app.Id, app.Name, app.Secret); err != nil {
+		t.Fatalf("failed to save app: %v", err)
+	}
+}
+
+func migrationsPath() string {
+	_, file, _, _ := runtime.Caller(0)
+
+	return filepath.Join(filepath.Dir(file), "..", "..", "..", "..", "migrations")
+}
@@ -0,0 +1,124 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Ключ контекста, под которым WithinTx кладёт общую транзакцию
+type txKey struct{}
+
+// Общий интерфейс *sql.DB и *sql.Tx
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// WithinTx Выполняет fn в одной транзакции: методы хранилища, вызванные с контекстом fn, работают в ней.
+// Если fn вернула ошибку или запаниковала, все изменения откатываются, ошибка fn возвращается как есть.
+// Вложенный вызов не открывает новую транзакцию, а ставит точку сохранения в общей
+func (s *Storage) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	const operation = "storage.sqlite.WithinTx"
+
+	tx, err := s.beginTx(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(context.WithValue(ctx, txKey{}, tx.Tx)); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return nil
+}
+
+// Транзакция метода хранилища
+// Внутри WithinTx это точка сохранения в общей транзакции: Commit отпускает её, Rollback откатывает
+// только изменения метода, а завершает общую транзакцию сам WithinTx
+type transaction struct {
+	*sql.Tx
+	savepoint string
+	done      bool
+}
+
+// Открывает транзакцию или точку сохранения, если в ctx уже есть общая транзакция
+func (s *Storage) beginTx(ctx context.Context) (*transaction, error) {
+	if tx, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		name := fmt.Sprintf("sp%d", s.savepoints.Add(1))
+
+		if _, err := tx.ExecContext(ctx, "SAVEPOINT "+name); err != nil {
+			return nil, err
+		}
+
+		return &transaction{Tx: tx, savepoint: name}, nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &transaction{Tx: tx}, nil
+}
+
+func (t *transaction) Commit() error {
+	if t.savepoint == "" {
+		return t.Tx.Commit()
+	}
+
+	if t.done {
+		return sql.ErrTxDone
+	}
+
+	t.done = true
+
+	_, err := t.Exec("RELEASE SAVEPOINT " + t.savepoint)
+
+	return err
+}
+
+// Rollback после Commit ничего не делает, поэтому его можно откладывать через defer
+func (t *transaction) Rollback() error {
+	if t.savepoint == "" {
+		return t.Tx.Rollback()
+	}
+
+	if t.done {
+		return sql.ErrTxDone
+	}
+
+	t.done = true
+
+	if _, err := t.Exec("ROLLBACK TO SAVEPOINT " + t.savepoint); err != nil {
+		return err
+	}
+
+	_, err := t.Exec("RELEASE SAVEPOINT " + t.savepoint)
+
+	return err
+}
+
+// Подключение для запроса вне транзакции метода: общая транзакция из ctx или пул соединений
+func (s *Storage) conn(ctx context.Context) querier {
+	if tx, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return tx
+	}
+
+	return s.db
+}
+
+// Подготовленный запрос, привязанный к общей транзакции из ctx, если она есть
+func (s *Storage) stmt(ctx context.Context, stmt *sql.Stmt) *sql.Stmt {
+	if tx, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return tx.StmtContext(ctx, stmt)
+	}
+
+	return stmt
+}
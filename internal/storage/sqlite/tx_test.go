@@ -0,0 +1,156 @@
+package sqlite_test
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/storage"
+	"shilka-sso/internal/storage/sqlite"
+	"shilka-sso/internal/storage/sqlite/sqlitetest"
+	"testing"
+)
+
+var _ storage.TxManager = (*sqlite.Storage)(nil)
+
+var errAbort = errors.New("abort")
+
+func TestWithinTxCommit(t *testing.T) {
+	ctx := context.Background()
+	st, _ := sqlitetest.NewWithConfig(t, tuned)
+
+	var id int64
+
+	err := st.WithinTx(ctx, func(ctx context.Context) error {
+		var err error
+
+		id, err = st.SaveUser(ctx, "ivan", []byte("hash"))
+		if err != nil {
+			return err
+		}
+
+		// Внутри транзакции видны её же изменения
+		user, err := st.GetUser(ctx, "ivan")
+		if err != nil {
+			return err
+		}
+
+		return st.SetAdmin(ctx, user.Id, true)
+	})
+	require.NoError(t, err)
+
+	isAdmin, err := st.IsAdmin(ctx, id)
+	require.NoError(t, err)
+	assert.True(t, isAdmin)
+
+	events, err := st.PendingEvents(ctx, 10)
+	require.NoError(t, err)
+	assert.Len(t, events, 2)
+}
+
+func TestWithinTxRollback(t *testing.T) {
+	ctx := context.Background()
+	st, _ := sqlitetest.NewWithConfig(t, tuned)
+
+	err := st.WithinTx(ctx, func(ctx context.Context) error {
+		id, err := st.SaveUser(ctx, "ivan", []byte("hash"))
+		if err != nil {
+			return err
+		}
+
+		if err := st.SetAdmin(ctx, id, true); err != nil {
+			return err
+		}
+
+		return errAbort
+	})
+	assert.ErrorIs(t, err, errAbort)
+
+	_, err = st.GetUser(ctx, "ivan")
+	assert.ErrorIs(t, err, storage.ErrUserNotFound)
+
+	// Событие о регистрации откатилось вместе с пользователем
+	events, err := st.PendingEvents(ctx, 10)
+	require.NoError(t, err)
+	assert.Empty(t, events)
+}
+
+func TestWithinTxPanic(t *testing.T) {
+	ctx := context.Background()
+	st, _ := sqlitetest.NewWithConfig(t, tuned)
+
+	assert.Panics(t, func() {
+		_ = st.WithinTx(ctx, func(ctx context.Context) error {
+			if _, err := st.SaveUser(ctx, "ivan", []byte("hash")); err != nil {
+				return err
+			}
+
+			panic("boom")
+		})
+	})
+
+	_, err := st.GetUser(ctx, "ivan")
+	assert.ErrorIs(t, err, storage.ErrUserNotFound)
+
+	// После паники соединение вернулось в пул и бд не заблокирована
+	_, err = st.SaveUser(ctx, "petr", []byte("hash"))
+	assert.NoError(t, err)
+}
+
+func TestWithinTxFailedMethod(t *testing.T) {
+	ctx := context.Background()
+	st, _ := sqlitetest.NewWithConfig(t, tuned)
+
+	// Ошибка метода откатывает только его изменения, остальное решает fn
+	err := st.WithinTx(ctx, func(ctx context.Context) error {
+		if _, err := st.SaveUser(ctx, "ivan", []byte("hash")); err != nil {
+			return err
+		}
+
+		_, err := st.SaveUser(ctx, "IVAN", []byte("hash"))
+		assert.ErrorIs(t, err, storage.ErrUserExists)
+
+		err = st.SetAccountStatus(ctx, models.AccountStatusChange{UserId: 100, Status: models.AccountDisabled})
+		assert.ErrorIs(t, err, storage.ErrUserNotFound)
+
+		return nil
+	})
+	require.NoError(t, err)
+
+	_, err = st.GetUser(ctx, "ivan")
+	require.NoError(t, err)
+
+	events, err := st.PendingEvents(ctx, 10)
+	require.NoError(t, err)
+	assert.Len(t, events, 1)
+}
+
+func TestWithinTxNested(t *testing.T) {
+	ctx := context.Background()
+	st, _ := sqlitetest.NewWithConfig(t, tuned)
+
+	err := st.WithinTx(ctx, func(ctx context.Context) error {
+		if _, err := st.SaveUser(ctx, "ivan", []byte("hash")); err != nil {
+			return err
+		}
+
+		err := st.WithinTx(ctx, func(ctx context.Context) error {
+			if _, err := st.SaveUser(ctx, "petr", []byte("hash")); err != nil {
+				return err
+			}
+
+			return errAbort
+		})
+		assert.ErrorIs(t, err, errAbort)
+
+		return nil
+	})
+	require.NoError(t, err)
+
+	_, err = st.GetUser(ctx, "ivan")
+	assert.NoError(t, err)
+
+	_, err = st.GetUser(ctx, "petr")
+	assert.ErrorIs(t, err, storage.ErrUserNotFound)
+}
@@ -0,0 +1,115 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/mattn/go-sqlite3"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/lib/usernames"
+	"time"
+)
+
+// CanonicalizeUsernames Заполняет каноническую форму имён пользователей, у которых её ещё нет
+// Если форма уже занята другим пользователем, она остаётся пустой, а совпадение записывается
+// в username_collisions. Возвращает все известные совпадения
+func (s *Storage) CanonicalizeUsernames(ctx context.Context) ([]models.UsernameCollision, error) {
+	const operation = "storage.sqlite.CanonicalizeUsernames"
+
+	rows, err := s.conn(ctx).QueryContext(ctx,
+		"SELECT id, username FROM users WHERE username_canonical IS NULL ORDER BY id",
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	type pending struct {
+		id       int64
+		username string
+	}
+
+	var users []pending
+
+	for rows.Next() {
+		var user pending
+		if err := rows.Scan(&user.id, &user.username); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("%s: %w", operation, err)
+		}
+
+		users = append(users, user)
+	}
+
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	// Пользователи обходятся по id, поэтому форму получает тот, кто зарегистрировался раньше
+	for _, user := range users {
+		canonical := usernames.Canonical(user.username)
+
+		_, err := s.conn(ctx).ExecContext(ctx, "UPDATE users SET username_canonical = ? WHERE id = ?", canonical, user.id)
+		if err == nil {
+			continue
+		}
+
+		var sqliteErr sqlite3.Error
+		if !errors.As(err, &sqliteErr) || !errors.Is(sqliteErr.ExtendedCode, sqlite3.ErrConstraintUnique) {
+			return nil, fmt.Errorf("%s: %w", operation, err)
+		}
+
+		_, err = s.conn(ctx).ExecContext(ctx, `
+			INSERT OR IGNORE INTO username_collisions(user_id, canonical, conflicts_with, detected_at)
+			SELECT ?, ?, id, ? FROM users WHERE username_canonical = ?`,
+			user.id, canonical, time.Now().UnixNano(), canonical,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", operation, err)
+		}
+	}
+
+	collisions, err := s.UsernameCollisions(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return collisions, nil
+}
+
+// UsernameCollisions Возвращает пользователей, чьё имя совпало с чужим в канонической форме
+func (s *Storage) UsernameCollisions(ctx context.Context) ([]models.UsernameCollision, error) {
+	const operation = "storage.sqlite.UsernameCollisions"
+
+	rows, err := s.conn(ctx).QueryContext(ctx, `
+		SELECT c.user_id, u.username, c.canonical, c.conflicts_with, c.detected_at
+		FROM username_collisions c
+		JOIN users u ON u.id = c.user_id
+		ORDER BY c.user_id`)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+	defer rows.Close()
+
+	var collisions []models.UsernameCollision
+
+	for rows.Next() {
+		var collision models.UsernameCollision
+		var detectedAt int64
+
+		err := rows.Scan(&collision.UserId, &collision.Username, &collision.Canonical, &collision.ConflictsWith, &detectedAt)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", operation, err)
+		}
+
+		collision.DetectedAt = time.Unix(0, detectedAt)
+		collisions = append(collisions, collision)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return collisions, nil
+}
@@ -0,0 +1,283 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/mattn/go-sqlite3"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/storage"
+	"time"
+)
+
+// SaveWebhook Сохраняет вебхук приложения
+func (s *Storage) SaveWebhook(ctx context.Context, webhook models.Webhook) (int64, error) {
+	const operation = "storage.sqlite.SaveWebhook"
+
+	var exists bool
+	err := s.conn(ctx).QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM apps WHERE id = ?)", webhook.AppId).Scan(&exists)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if !exists {
+		return 0, fmt.Errorf("%s: %w", operation, storage.ErrAppNotFound)
+	}
+
+	res, err := s.conn(ctx).ExecContext(ctx,
+		"INSERT INTO webhooks(app_id, event_type, url, created_at) VALUES (?, ?, ?, ?)",
+		webhook.AppId, webhook.EventType, webhook.URL, webhook.CreatedAt.UnixNano(),
+	)
+	if err != nil {
+		var sqliteErr sqlite3.Error
+
+		if errors.As(err, &sqliteErr) && errors.Is(sqliteErr.ExtendedCode, sqlite3.ErrConstraintUnique) {
+			return 0, fmt.Errorf("%s: %w", operation, storage.ErrWebhookExists)
+		}
+
+		return 0, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return id, nil
+}
+
+// Webhooks Возвращает вебхуки приложения
+func (s *Storage) Webhooks(ctx context.Context, appID int) ([]models.Webhook, error) {
+	const operation = "storage.sqlite.Webhooks"
+
+	rows, err := s.conn(ctx).QueryContext(ctx,
+		"SELECT id, app_id, event_type, url, created_at FROM webhooks WHERE app_id = ? ORDER BY id",
+		appID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+	defer rows.Close()
+
+	var webhooks []models.Webhook
+
+	for rows.Next() {
+		var webhook models.Webhook
+		var createdAt int64
+
+		if err := rows.Scan(&webhook.Id, &webhook.AppId, &webhook.EventType, &webhook.URL, &createdAt); err != nil {
+			return nil, fmt.Errorf("%s: %w", operation, err)
+		}
+
+		webhook.CreatedAt = time.Unix(0, createdAt)
+		webhooks = append(webhooks, webhook)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return webhooks, nil
+}
+
+// DeleteWebhook Удаляет вебхук вместе с его доставками
+func (s *Storage) DeleteWebhook(ctx context.Context, webhookID int64) error {
+	const operation = "storage.sqlite.DeleteWebhook"
+
+	tx, err := s.beginTx(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, "DELETE FROM webhooks WHERE id = ?", webhookID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if affected == 0 {
+		return fmt.Errorf("%s: %w", operation, storage.ErrWebhookNotFound)
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM webhook_deliveries WHERE webhook_id = ?", webhookID); err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return nil
+}
+
+// EnqueueWebhookDeliveries Ставит событие в очередь на доставку во все вебхуки его типа
+// Повторная постановка того же события ничего не делает
+func (s *Storage) EnqueueWebhookDeliveries(ctx context.Context, event models.Event, body []byte) (int64, error) {
+	const operation = "storage.sqlite.EnqueueWebhookDeliveries"
+
+	now := time.Now().UnixNano()
+
+	res, err := s.conn(ctx).ExecContext(ctx, `
+		INSERT OR IGNORE INTO webhook_deliveries(webhook_id, event_id, event_type, body, next_attempt_at, created_at)
+		SELECT id, ?, ?, ?, ?, ? FROM webhooks WHERE event_type = ?`,
+		event.Id, event.Type, body, now, now, event.Type,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return affected, nil
+}
+
+const webhookDeliveryColumns = `
+	d.id, d.webhook_id, w.app_id, w.url, a.secret, d.event_id, d.event_type, d.body,
+	d.status, d.attempts, d.last_error, d.next_attempt_at, d.created_at`
+
+const webhookDeliveryJoins = `
+	FROM webhook_deliveries d
+	JOIN webhooks w ON w.id = d.webhook_id
+	JOIN apps a ON a.id = w.app_id`
+
+// DueWebhookDeliveries Возвращает до limit доставок, время попытки которых уже наступило
+func (s *Storage) DueWebhookDeliveries(ctx context.Context, now time.Time, limit int) ([]models.WebhookDelivery, error) {
+	const operation = "storage.sqlite.DueWebhookDeliveries"
+
+	deliveries, err := s.queryWebhookDeliveries(ctx,
+		"SELECT"+webhookDeliveryColumns+webhookDeliveryJoins+" WHERE d.status = ? AND d.next_attempt_at <= ? ORDER BY d.next_attempt_at, d.id LIMIT ?",
+		models.WebhookDeliveryPending, now.UnixNano(), limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return deliveries, nil
+}
+
+// DeadWebhookDeliveries Возвращает доставки, попытки которых закончились
+// Если appID равен 0, возвращаются доставки всех приложений
+func (s *Storage) DeadWebhookDeliveries(ctx context.Context, appID int) ([]models.WebhookDelivery, error) {
+	const operation = "storage.sqlite.DeadWebhookDeliveries"
+
+	deliveries, err := s.queryWebhookDeliveries(ctx,
+		"SELECT"+webhookDeliveryColumns+webhookDeliveryJoins+" WHERE d.status = ? AND (? = 0 OR w.app_id = ?) ORDER BY d.id",
+		models.WebhookDeliveryDead, appID, appID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return deliveries, nil
+}
+
+// MarkWebhookDelivered Отмечает доставку успешной
+func (s *Storage) MarkWebhookDelivered(ctx context.Context, deliveryID int64) error {
+	const operation = "storage.sqlite.MarkWebhookDelivered"
+
+	_, err := s.conn(ctx).ExecContext(ctx,
+		"UPDATE webhook_deliveries SET status = ?, attempts = attempts + 1, last_error = '' WHERE id = ?",
+		models.WebhookDeliveryDelivered, deliveryID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return nil
+}
+
+// MarkWebhookFailed Запоминает неудачную попытку доставки
+// Если dead, доставка больше не повторяется и попадает в список недоставленных
+func (s *Storage) MarkWebhookFailed(ctx context.Context, deliveryID int64, reason string, nextAttemptAt time.Time, dead bool) error {
+	const operation = "storage.sqlite.MarkWebhookFailed"
+
+	status := models.WebhookDeliveryPending
+	if dead {
+		status = models.WebhookDeliveryDead
+	}
+
+	_, err := s.conn(ctx).ExecContext(ctx,
+		"UPDATE webhook_deliveries SET status = ?, attempts = attempts + 1, last_error = ?, next_attempt_at = ? WHERE id = ?",
+		status, reason, nextAttemptAt.UnixNano(), deliveryID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return nil
+}
+
+// ReplayWebhookDelivery Возвращает недоставленную доставку в очередь с обнулёнными попытками
+func (s *Storage) ReplayWebhookDelivery(ctx context.Context, deliveryID int64) error {
+	const operation = "storage.sqlite.ReplayWebhookDelivery"
+
+	res, err := s.conn(ctx).ExecContext(ctx,
+		"UPDATE webhook_deliveries SET status = ?, attempts = 0, next_attempt_at = ? WHERE id = ? AND status = ?",
+		models.WebhookDeliveryPending, time.Now().UnixNano(), deliveryID, models.WebhookDeliveryDead,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if affected == 0 {
+		return fmt.Errorf("%s: %w", operation, storage.ErrWebhookDeliveryNotFound)
+	}
+
+	return nil
+}
+
+func (s *Storage) queryWebhookDeliveries(ctx context.Context, query string, args ...any) ([]models.WebhookDelivery, error) {
+	rows, err := s.conn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []models.WebhookDelivery
+
+	for rows.Next() {
+		delivery, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		deliveries = append(deliveries, delivery)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+func scanWebhookDelivery(rows *sql.Rows) (models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+	var nextAttemptAt, createdAt int64
+
+	err := rows.Scan(&delivery.Id, &delivery.WebhookId, &delivery.AppId, &delivery.URL, &delivery.Secret,
+		&delivery.EventId, &delivery.EventType, &delivery.Body, &delivery.Status, &delivery.Attempts,
+		&delivery.LastError, &nextAttemptAt, &createdAt)
+	if err != nil {
+		return models.WebhookDelivery{}, err
+	}
+
+	delivery.NextAttemptAt = time.Unix(0, nextAttemptAt)
+	delivery.CreatedAt = time.Unix(0, createdAt)
+
+	return delivery, nil
+}
@@ -7,4 +7,39 @@ var (
 	ErrUserExists   = errors.New("user already exists")
 	ErrUserNotFound = errors.New("user not found")
 	ErrAppNotFound  = errors.New("app not found")
+	ErrAppExists    = errors.New("app already exists")
+
+	ErrAuditRecordNotFound = errors.New("audit record not found")
+
+	ErrWebhookExists           = errors.New("webhook already exists")
+	ErrWebhookNotFound         = errors.New("webhook not found")
+	ErrWebhookDeliveryNotFound = errors.New("webhook delivery not found")
+
+	ErrEventNotFound = errors.New("event not found")
+
+	ErrAuthCodeNotFound = errors.New("authorization code not found")
+
+	ErrServiceAccountExists   = errors.New("service account already exists")
+	ErrServiceAccountNotFound = errors.New("service account not found")
+
+	ErrDeviceCodeNotFound = errors.New("device code not found")
+
+	ErrFederatedIdentityNotFound = errors.New("federated identity not found")
+	ErrConnectorStateNotFound    = errors.New("connector state not found")
+
+	ErrPersonalTokenExists   = errors.New("personal token already exists")
+	ErrPersonalTokenNotFound = errors.New("personal token not found")
+
+	ErrPasswordlessChallengeNotFound = errors.New("passwordless challenge not found")
+
+	ErrRelyingPartyNotFound   = errors.New("relying party not found")
+	ErrPasskeyExists          = errors.New("passkey already exists")
+	ErrPasskeyNotFound        = errors.New("passkey not found")
+	ErrPasskeySessionNotFound = errors.New("passkey session not found")
+
+	ErrIdentifierExists   = errors.New("identifier already exists")
+	ErrIdentifierNotFound = errors.New("identifier not found")
+
+	ErrErasureRequestExists   = errors.New("erasure request already exists")
+	ErrErasureRequestNotFound = errors.New("erasure request not found")
 )
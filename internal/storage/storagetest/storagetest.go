@@ -0,0 +1,392 @@
+// Package storagetest Общий набор тестов, который должно проходить каждое хранилище
+// Набор проверяет контракт auth.DbServices: ошибки storage.Err*, права администратора, приложения
+// и параллельную регистрацию. Хранилище подключается через Factory
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"shilka-sso/internal/domain/models"
+	"shilka-sso/internal/services/auth"
+	"shilka-sso/internal/services/outbox"
+	"shilka-sso/internal/storage"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Storage Методы хранилища, которые проверяет набор
+// Кроме auth.DbServices нужен SetAdmin, иначе права администратора не проверить,
+// ListUsers, по которому выгружаются пользователи, outbox.Storage диспетчера событий с разбором
+// недоставляемых событий и SetAppScopes, без которого не проверить scope приложения
+type Storage interface {
+	auth.DbServices
+	outbox.Storage
+	DeadEvents(ctx context.Context) ([]models.Event, error)
+	ReplayDeadEvent(ctx context.Context, eventID int64) error
+	SetAppScopes(ctx context.Context, appID int, scopes []string) error
+	SetAdmin(ctx context.Context, userID int64, isAdmin bool) error
+	ListUsers(ctx context.Context, afterID int64, limit int) ([]models.User, error)
+}
+
+// Factory Создаёт пустое хранилище с приложениями apps для одного теста
+// Если хранилище недоступно, фабрика пропускает тест через t.Skip
+type Factory func(t *testing.T, apps ...models.App) Storage
+
+// Число параллельных регистраций в ConcurrentInserts и ConcurrentDuplicates
+const workers = 16
+
+// Run Прогоняет весь набор на хранилищах, созданных newStorage
+func Run(t *testing.T, newStorage Factory) {
+	t.Run("SaveAndGetUser", func(t *testing.T) { testSaveAndGetUser(t, newStorage) })
+	t.Run("DuplicateUsername", func(t *testing.T) { testDuplicateUsername(t, newStorage) })
+	t.Run("MissingRows", func(t *testing.T) { testMissingRows(t, newStorage) })
+	t.Run("Admin", func(t *testing.T) { testAdmin(t, newStorage) })
+	t.Run("Apps", func(t *testing.T) { testApps(t, newStorage) })
+	t.Run("PasswordHash", func(t *testing.T) { testPasswordHash(t, newStorage) })
+	t.Run("ListUsers", func(t *testing.T) { testListUsers(t, newStorage) })
+	t.Run("DeadEvents", func(t *testing.T) { testDeadEvents(t, newStorage) })
+	t.Run("ConcurrentInserts", func(t *testing.T) { testConcurrentInserts(t, newStorage) })
+	t.Run("ConcurrentDuplicates", func(t *testing.T) { testConcurrentDuplicates(t, newStorage) })
+}
+
+func testSaveAndGetUser(t *testing.T, newStorage Factory) {
+	ctx := context.Background()
+	st := newStorage(t)
+
+	ivanID, err := st.SaveUser(ctx, "Ivan", []byte("ivan-hash"))
+	require.NoError(t, err)
+
+	petrID, err := st.SaveUser(ctx, "petr", []byte("petr-hash"))
+	require.NoError(t, err)
+	assert.NotEqual(t, ivanID, petrID)
+
+	// Имя ищется в канонической форме, но возвращается как его ввели при регистрации
+	user, err := st.GetUser(ctx, "IVAN")
+	require.NoError(t, err)
+	assert.Equal(t, ivanID, user.Id)
+	assert.Equal(t, "Ivan", user.Username)
+	assert.Equal(t, []byte("ivan-hash"), user.PasswordHash)
+	assert.Equal(t, models.AccountActive, user.Status)
+
+	user, err = st.UserByID(ctx, petrID)
+	require.NoError(t, err)
+	assert.Equal(t, "petr", user.Username)
+	assert.Equal(t, []byte("petr-hash"), user.PasswordHash)
+
+	user, err = st.UserByIdentifier(ctx, "petr")
+	require.NoError(t, err)
+	assert.Equal(t, petrID, user.Id)
+}
+
+func testDuplicateUsername(t *testing.T, newStorage Factory) {
+	ctx := context.Background()
+	st := newStorage(t)
+
+	id, err := st.SaveUser(ctx, "ivan", []byte("hash"))
+	require.NoError(t, err)
+
+	for _, username := range []string{"ivan", "Ivan", "IVAN"} {
+		_, err := st.SaveUser(ctx, username, []byte("other"))
+		assert.ErrorIs(t, err, storage.ErrUserExists, username)
+	}
+
+	// Неудачная регистрация не меняет существующего пользователя
+	user, err := st.GetUser(ctx, "ivan")
+	require.NoError(t, err)
+	assert.Equal(t, id, user.Id)
+	assert.Equal(t, []byte("hash"), user.PasswordHash)
+}
+
+func testMissingRows(t *testing.T, newStorage Factory) {
+	ctx := context.Background()
+	st := newStorage(t)
+
+	id, err := st.SaveUser(ctx, "ivan", []byte("hash"))
+	require.NoError(t, err)
+
+	_, err = st.GetUser(ctx, "petr")
+	assert.ErrorIs(t, err, storage.ErrUserNotFound)
+
+	_, err = st.UserByID(ctx, id+1)
+	assert.ErrorIs(t, err, storage.ErrUserNotFound)
+
+	_, err = st.UserByIdentifier(ctx, "petr")
+	assert.ErrorIs(t, err, storage.ErrUserNotFound)
+
+	_, err = st.UserByIdentifier(ctx, "ivan@example.com")
+	assert.ErrorIs(t, err, storage.ErrUserNotFound)
+
+	_, err = st.IsAdmin(ctx, id+1)
+	assert.ErrorIs(t, err, storage.ErrUserNotFound)
+
+	assert.ErrorIs(t, st.SetAdmin(ctx, id+1, true), storage.ErrUserNotFound)
+
+	_, err = st.GetApp(ctx, 1)
+	assert.ErrorIs(t, err, storage.ErrAppNotFound)
+}
+
+func testAdmin(t *testing.T, newStorage Factory) {
+	ctx := context.Background()
+	st := newStorage(t)
+
+	ivanID, err := st.SaveUser(ctx, "ivan", []byte("hash"))
+	require.NoError(t, err)
+
+	petrID, err := st.SaveUser(ctx, "petr", []byte("hash"))
+	require.NoError(t, err)
+
+	isAdmin, err := st.IsAdmin(ctx, ivanID)
+	require.NoError(t, err)
+	assert.False(t, isAdmin, "new user must not be admin")
+
+	require.NoError(t, st.SetAdmin(ctx, ivanID, true))
+
+	isAdmin, err = st.IsAdmin(ctx, ivanID)
+	require.NoError(t, err)
+	assert.True(t, isAdmin)
+
+	// Права выдаются только одному пользователю
+	isAdmin, err = st.IsAdmin(ctx, petrID)
+	require.NoError(t, err)
+	assert.False(t, isAdmin)
+
+	require.NoError(t, st.SetAdmin(ctx, ivanID, false))
+
+	isAdmin, err = st.IsAdmin(ctx, ivanID)
+	require.NoError(t, err)
+	assert.False(t, isAdmin)
+}
+
+func testApps(t *testing.T, newStorage Factory) {
+	ctx := context.Background()
+	st := newStorage(t,
+		models.App{Id: 1, Name: "first", Secret: "first-secret"},
+		models.App{Id: 2, Name: "second", Secret: "second-secret"},
+	)
+
+	app, err := st.GetApp(ctx, 2)
+	require.NoError(t, err)
+	assert.Equal(t, 2, app.Id)
+	assert.Equal(t, "second", app.Name)
+	assert.Equal(t, "second-secret", app.Secret)
+	assert.Empty(t, app.RedirectURIs)
+	assert.Empty(t, app.Scopes)
+
+	require.NoError(t, st.SetAppScopes(ctx, 1, []string{"openid", "orders:read"}))
+
+	app, err = st.GetApp(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "first", app.Name)
+	assert.Equal(t, []string{"openid", "orders:read"}, app.Scopes)
+
+	require.NoError(t, st.SetAppScopes(ctx, 1, nil))
+
+	app, err = st.GetApp(ctx, 1)
+	require.NoError(t, err)
+	assert.Empty(t, app.Scopes)
+
+	_, err = st.GetApp(ctx, 3)
+	assert.ErrorIs(t, err, storage.ErrAppNotFound)
+	assert.ErrorIs(t, st.SetAppScopes(ctx, 3, []string{"openid"}), storage.ErrAppNotFound)
+}
+
+func testPasswordHash(t *testing.T, newStorage Factory) {
+	ctx := context.Background()
+	st := newStorage(t)
+
+	id, err := st.SaveUser(ctx, "ivan", []byte("legacy-hash"))
+	require.NoError(t, err)
+
+	require.NoError(t, st.SetPasswordHash(ctx, id, []byte("new-hash")))
+
+	user, err := st.GetUser(ctx, "ivan")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("new-hash"), user.PasswordHash)
+
+	assert.ErrorIs(t, st.SetPasswordHash(ctx, id+1, []byte("hash")), storage.ErrUserNotFound)
+}
+
+func testListUsers(t *testing.T, newStorage Factory) {
+	ctx := context.Background()
+	st := newStorage(t)
+
+	users, err := st.ListUsers(ctx, 0, 10)
+	require.NoError(t, err)
+	assert.Empty(t, users)
+
+	var ids []int64
+
+	for i := range 5 {
+		id, err := st.SaveUser(ctx, fmt.Sprintf("user%d", i), []byte("hash"))
+		require.NoError(t, err)
+
+		ids = append(ids, id)
+	}
+
+	// Страницы по 2 пользователя идут подряд по возрастанию id
+	var listed []int64
+
+	for afterID := int64(0); ; {
+		page, err := st.ListUsers(ctx, afterID, 2)
+		require.NoError(t, err)
+		require.LessOrEqual(t, len(page), 2)
+
+		if len(page) == 0 {
+			break
+		}
+
+		for _, user := range page {
+			listed = append(listed, user.Id)
+		}
+
+		afterID = page[len(page)-1].Id
+	}
+
+	assert.Equal(t, ids, listed)
+
+	users, err = st.ListUsers(ctx, ids[3], 10)
+	require.NoError(t, err)
+	require.Len(t, users, 1)
+	assert.Equal(t, "user4", users[0].Username)
+	assert.Equal(t, []byte("hash"), users[0].PasswordHash)
+}
+
+func testConcurrentInserts(t *testing.T, newStorage Factory) {
+	ctx := context.Background()
+	st := newStorage(t)
+
+	ids := make([]int64, workers)
+	errs := make([]error, workers)
+
+	var wg sync.WaitGroup
+
+	for i := range workers {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			ids[i], errs[i] = st.SaveUser(ctx, fmt.Sprintf("user%d", i), []byte("hash"))
+		}()
+	}
+
+	wg.Wait()
+
+	seen := make(map[int64]bool)
+
+	for i := range workers {
+		require.NoError(t, errs[i])
+		assert.False(t, seen[ids[i]], "duplicate id %d", ids[i])
+		seen[ids[i]] = true
+
+		user, err := st.UserByID(ctx, ids[i])
+		require.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("user%d", i), user.Username)
+	}
+}
+
+func testConcurrentDuplicates(t *testing.T, newStorage Factory) {
+	ctx := context.Background()
+	st := newStorage(t)
+
+	errs := make([]error, workers)
+
+	var wg sync.WaitGroup
+
+	// Одно имя в разном регистре, зарегистрироваться должен ровно один
+	for i := range workers {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			username := "ivan"
+			if i%2 == 1 {
+				username = "Ivan"
+			}
+
+			_, errs[i] = st.SaveUser(ctx, username, []byte("hash"))
+		}()
+	}
+
+	wg.Wait()
+
+	var saved int
+
+	for _, err := range errs {
+		if err == nil {
+			saved++
+			continue
+		}
+
+		if !errors.Is(err, storage.ErrUserExists) {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+
+	assert.Equal(t, 1, saved)
+}
+
+// Неудачная попытка оставляет событие в очереди до времени повтора, недоставляемое событие из неё уходит
+// и возвращается в неё только вручную
+func testDeadEvents(t *testing.T, newStorage Factory) {
+	ctx := context.Background()
+	st := newStorage(t)
+
+	for _, username := range []string{"ivan", "petr"} {
+		_, err := st.SaveUser(ctx, username, []byte("hash"))
+		require.NoError(t, err)
+	}
+
+	events, err := st.PendingEvents(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+
+	first := events[0].Id
+
+	retryAt := time.Now().Add(time.Minute)
+
+	require.NoError(t, st.MarkEventFailed(ctx, first, "event is rejected", retryAt, false))
+
+	events, err = st.PendingEvents(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, first, events[0].Id)
+	assert.Equal(t, 1, events[0].Attempts)
+	assert.Equal(t, "event is rejected", events[0].LastError)
+	assert.True(t, retryAt.Equal(events[0].NextAttemptAt))
+
+	require.NoError(t, st.MarkEventFailed(ctx, first, "event is rejected", retryAt, true))
+
+	events, err = st.PendingEvents(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.NotEqual(t, first, events[0].Id)
+
+	dead, err := st.DeadEvents(ctx)
+	require.NoError(t, err)
+	require.Len(t, dead, 1)
+	assert.Equal(t, first, dead[0].Id)
+	assert.Equal(t, 2, dead[0].Attempts)
+	assert.False(t, dead[0].DeadAt.IsZero())
+
+	// Повтор возвращает событие в очередь с обнулёнными попытками, ещё раз повторить его нельзя
+	require.NoError(t, st.ReplayDeadEvent(ctx, first))
+	assert.ErrorIs(t, st.ReplayDeadEvent(ctx, first), storage.ErrEventNotFound)
+	assert.ErrorIs(t, st.ReplayDeadEvent(ctx, events[0].Id), storage.ErrEventNotFound)
+
+	events, err = st.PendingEvents(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, first, events[0].Id)
+	assert.Zero(t, events[0].Attempts)
+	assert.True(t, events[0].NextAttemptAt.IsZero())
+
+	dead, err = st.DeadEvents(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, dead)
+}
@@ -0,0 +1,20 @@
+package storage
+
+import "context"
+
+// TxManager Выполняет fn в одной транзакции хранилища
+// Методы хранилища, вызванные с контекстом fn, работают в этой транзакции. Если fn вернула ошибку,
+// все их изменения откатываются
+type TxManager interface {
+	WithinTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+// WithinTx Выполняет fn в транзакции st, если хранилище реализует TxManager.
+// Хранилище без транзакций выполняет fn как есть, и при ошибке сделанные изменения остаются
+func WithinTx(ctx context.Context, st any, fn func(ctx context.Context) error) error {
+	if txManager, ok := st.(TxManager); ok {
+		return txManager.WithinTx(ctx, fn)
+	}
+
+	return fn(ctx)
+}
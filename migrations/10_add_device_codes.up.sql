@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS device_codes
+(
+    device_code_hash TEXT PRIMARY KEY,
+    user_code        TEXT    NOT NULL UNIQUE,
+    app_id           INTEGER NOT NULL,
+    scope            TEXT    NOT NULL DEFAULT '',
+    status           TEXT    NOT NULL DEFAULT 'pending',
+    user_id          INTEGER NOT NULL DEFAULT 0,
+    interval         INTEGER NOT NULL,
+    last_polled_at   INTEGER NOT NULL DEFAULT 0,
+    expires_at       INTEGER NOT NULL,
+    created_at       INTEGER NOT NULL
+);
@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS federated_identities
+(
+    connector_id TEXT    NOT NULL,
+    subject      TEXT    NOT NULL,
+    user_id      INTEGER NOT NULL,
+    created_at   INTEGER NOT NULL,
+    PRIMARY KEY (connector_id, subject)
+);
+CREATE INDEX IF NOT EXISTS idx_federated_identities_user_id ON federated_identities (user_id);
+
+CREATE TABLE IF NOT EXISTS connector_states
+(
+    state_hash    TEXT PRIMARY KEY,
+    connector_id  TEXT    NOT NULL,
+    nonce         TEXT    NOT NULL,
+    code_verifier TEXT    NOT NULL,
+    request       BLOB    NOT NULL,
+    expires_at    INTEGER NOT NULL
+);
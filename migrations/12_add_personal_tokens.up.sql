@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS personal_tokens
+(
+    id           INTEGER PRIMARY KEY,
+    user_id      INTEGER NOT NULL,
+    name         TEXT    NOT NULL,
+    token_hash   TEXT    NOT NULL UNIQUE,
+    scopes       TEXT    NOT NULL DEFAULT '',
+    created_at   INTEGER NOT NULL,
+    expires_at   INTEGER NOT NULL,
+    last_used_at INTEGER NOT NULL DEFAULT 0,
+    UNIQUE (user_id, name)
+);
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS passwordless_challenges
+(
+    id         TEXT PRIMARY KEY,
+    user_id    INTEGER NOT NULL,
+    app_id     INTEGER NOT NULL,
+    method     TEXT    NOT NULL,
+    code_hash  TEXT    NOT NULL,
+    attempts   INTEGER NOT NULL DEFAULT 0,
+    expires_at INTEGER NOT NULL,
+    created_at INTEGER NOT NULL
+);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS passkey_sessions;
+DROP INDEX IF EXISTS idx_passkeys_user_id;
+DROP TABLE IF EXISTS passkeys;
+DROP TABLE IF EXISTS relying_parties;
@@ -0,0 +1,37 @@
+CREATE TABLE IF NOT EXISTS relying_parties
+(
+    app_id  INTEGER PRIMARY KEY,
+    rp_id   TEXT NOT NULL,
+    name    TEXT NOT NULL,
+    origins TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS passkeys
+(
+    id               INTEGER PRIMARY KEY,
+    user_id          INTEGER NOT NULL,
+    rp_id            TEXT    NOT NULL,
+    credential_id    BLOB    NOT NULL UNIQUE,
+    public_key       BLOB    NOT NULL,
+    attestation_type TEXT    NOT NULL,
+    aaguid           BLOB    NOT NULL,
+    sign_count       INTEGER NOT NULL DEFAULT 0,
+    transports       TEXT    NOT NULL DEFAULT '',
+    backup_eligible  INTEGER NOT NULL DEFAULT 0,
+    name             TEXT    NOT NULL,
+    created_at       INTEGER NOT NULL,
+    last_used_at     INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS idx_passkeys_user_id ON passkeys (user_id);
+
+CREATE TABLE IF NOT EXISTS passkey_sessions
+(
+    id                TEXT    PRIMARY KEY,
+    ceremony          TEXT    NOT NULL,
+    user_id           INTEGER NOT NULL,
+    app_id            INTEGER NOT NULL,
+    password_verified INTEGER NOT NULL DEFAULT 0,
+    data              TEXT    NOT NULL,
+    expires_at        INTEGER NOT NULL
+);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS username_collisions;
+DROP INDEX IF EXISTS idx_users_username_canonical;
+ALTER TABLE users DROP COLUMN username_canonical;
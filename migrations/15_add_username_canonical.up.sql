@@ -0,0 +1,16 @@
+-- Каноническую форму (NFKC, регистр, похожие буквы) в sql не посчитать. У существующих пользователей её
+-- заполняет cmd/migrator сразу после up, а если миграции применялись другим инструментом - сервис при запуске
+ALTER TABLE users
+    ADD COLUMN username_canonical TEXT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_username_canonical ON users (username_canonical);
+
+-- Пользователи, чьё имя в канонической форме совпало с именем другого пользователя.
+-- Они входят только по точному имени, пока администратор не разберётся
+CREATE TABLE IF NOT EXISTS username_collisions
+(
+    user_id        INTEGER PRIMARY KEY,
+    canonical      TEXT    NOT NULL,
+    conflicts_with INTEGER NOT NULL,
+    detected_at    INTEGER NOT NULL
+);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_user_identifiers_verified;
+DROP TABLE IF EXISTS user_identifiers;
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS user_identifiers
+(
+    user_id         INTEGER NOT NULL,
+    kind            TEXT    NOT NULL,
+    value           TEXT    NOT NULL,
+    canonical       TEXT    NOT NULL,
+    verified_at     INTEGER,
+    code_hash       TEXT    NOT NULL DEFAULT '',
+    attempts        INTEGER NOT NULL DEFAULT 0,
+    code_expires_at INTEGER NOT NULL DEFAULT 0,
+    created_at      INTEGER NOT NULL,
+    PRIMARY KEY (user_id, kind)
+);
+
+-- Неподтверждённый адрес может указать кто угодно, поэтому уникальны только подтверждённые
+CREATE UNIQUE INDEX IF NOT EXISTS idx_user_identifiers_verified ON user_identifiers (kind, canonical) WHERE verified_at IS NOT NULL;
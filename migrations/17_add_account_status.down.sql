@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_users_suspended_until;
+DROP INDEX IF EXISTS idx_account_status_history_user_id;
+DROP TABLE IF EXISTS account_status_history;
+ALTER TABLE users DROP COLUMN suspended_until;
+ALTER TABLE users DROP COLUMN status_reason;
+ALTER TABLE users DROP COLUMN status;
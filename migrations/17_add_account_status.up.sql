@@ -0,0 +1,19 @@
+ALTER TABLE users ADD COLUMN status TEXT NOT NULL DEFAULT 'active';
+ALTER TABLE users ADD COLUMN status_reason TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN suspended_until INTEGER;
+
+CREATE TABLE IF NOT EXISTS account_status_history
+(
+    id              INTEGER PRIMARY KEY,
+    user_id         INTEGER NOT NULL,
+    status          TEXT    NOT NULL,
+    reason          TEXT    NOT NULL,
+    suspended_until INTEGER,
+    actor_id        INTEGER NOT NULL,
+    created_at      INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_account_status_history_user_id ON account_status_history (user_id);
+
+-- По нему фоновая задача находит приостановки, срок которых истёк
+CREATE INDEX IF NOT EXISTS idx_users_suspended_until ON users (suspended_until) WHERE status = 'suspended';
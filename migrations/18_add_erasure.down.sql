@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_audit_log_user_id;
+ALTER TABLE audit_log DROP COLUMN field_salts;
+ALTER TABLE audit_log DROP COLUMN redacted_at;
+DROP INDEX IF EXISTS idx_erasure_requests_erase_at;
+DROP TABLE IF EXISTS erasure_requests;
@@ -0,0 +1,21 @@
+-- Запросы на удаление данных пользователя, которые ждут окончания срока на отмену
+CREATE TABLE IF NOT EXISTS erasure_requests
+(
+    user_id      INTEGER PRIMARY KEY,
+    actor_id     INTEGER NOT NULL,
+    reason       TEXT    NOT NULL DEFAULT '',
+    requested_at INTEGER NOT NULL,
+    erase_at     INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_erasure_requests_erase_at ON erasure_requests (erase_at);
+
+-- Когда из записи аудита убрали персональные данные
+ALTER TABLE audit_log
+    ADD COLUMN redacted_at INTEGER;
+
+-- Соли персональных полей payload в JSON. У записей, написанных раньше, NULL
+ALTER TABLE audit_log
+    ADD COLUMN field_salts TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_user_id ON audit_log (user_id);
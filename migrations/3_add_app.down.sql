@@ -0,0 +1 @@
+-- Таблица apps создаётся в 1_init, миграция 3 ничего не меняет
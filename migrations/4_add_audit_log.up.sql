@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS audit_log
+(
+    id         INTEGER PRIMARY KEY,
+    event      TEXT    NOT NULL,
+    user_id    INTEGER NOT NULL DEFAULT 0,
+    app_id     INTEGER NOT NULL DEFAULT 0,
+    payload    TEXT    NOT NULL DEFAULT '',
+    created_at INTEGER NOT NULL,
+    prev_hash  BLOB    NOT NULL,
+    hash       BLOB    NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS audit_checkpoints
+(
+    id         INTEGER PRIMARY KEY,
+    record_id  INTEGER NOT NULL,
+    hash       BLOB    NOT NULL,
+    signature  BLOB    NOT NULL,
+    created_at INTEGER NOT NULL
+);
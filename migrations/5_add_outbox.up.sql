@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS outbox
+(
+    id           INTEGER PRIMARY KEY,
+    event_type   TEXT    NOT NULL,
+    payload      BLOB    NOT NULL,
+    created_at   INTEGER NOT NULL,
+    attempts     INTEGER NOT NULL DEFAULT 0,
+    last_error   TEXT    NOT NULL DEFAULT '',
+    delivered_at INTEGER,
+    -- Раньше этого времени событие после неудачной попытки не публикуется
+    next_attempt_at INTEGER,
+    -- Когда событие перестали доставлять после events.max_attempts неудачных попыток
+    dead_at      INTEGER
+);
+CREATE INDEX IF NOT EXISTS idx_outbox_pending ON outbox (delivered_at, dead_at, id);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_webhook_deliveries_due;
+DROP TABLE IF EXISTS webhook_deliveries;
+DROP INDEX IF EXISTS idx_webhooks_event_type;
+DROP TABLE IF EXISTS webhooks;
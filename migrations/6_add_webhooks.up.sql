@@ -0,0 +1,26 @@
+CREATE TABLE IF NOT EXISTS webhooks
+(
+    id         INTEGER PRIMARY KEY,
+    app_id     INTEGER NOT NULL,
+    event_type TEXT    NOT NULL,
+    url        TEXT    NOT NULL,
+    created_at INTEGER NOT NULL,
+    UNIQUE (app_id, event_type, url)
+);
+CREATE INDEX IF NOT EXISTS idx_webhooks_event_type ON webhooks (event_type);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries
+(
+    id              INTEGER PRIMARY KEY,
+    webhook_id      INTEGER NOT NULL,
+    event_id        INTEGER NOT NULL,
+    event_type      TEXT    NOT NULL,
+    body            BLOB    NOT NULL,
+    status          TEXT    NOT NULL DEFAULT 'pending',
+    attempts        INTEGER NOT NULL DEFAULT 0,
+    last_error      TEXT    NOT NULL DEFAULT '',
+    next_attempt_at INTEGER NOT NULL,
+    created_at      INTEGER NOT NULL,
+    UNIQUE (webhook_id, event_id)
+);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries (status, next_attempt_at);
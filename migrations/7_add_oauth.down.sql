@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS oauth_codes;
+
+ALTER TABLE apps DROP COLUMN scopes;
+ALTER TABLE apps DROP COLUMN redirect_uris;
@@ -0,0 +1,19 @@
+ALTER TABLE apps
+    ADD COLUMN redirect_uris TEXT NOT NULL DEFAULT '';
+
+-- Scope, которые приложение может запрашивать через OAuth, через перевод строки. Пусто - openid и profile
+ALTER TABLE apps
+    ADD COLUMN scopes TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS oauth_codes
+(
+    code_hash      TEXT PRIMARY KEY,
+    app_id         INTEGER NOT NULL,
+    user_id        INTEGER NOT NULL,
+    redirect_uri   TEXT    NOT NULL,
+    code_challenge TEXT    NOT NULL,
+    scope          TEXT    NOT NULL DEFAULT '',
+    expires_at     INTEGER NOT NULL,
+    created_at     INTEGER NOT NULL,
+    used           BOOLEAN NOT NULL DEFAULT FALSE
+);
@@ -0,0 +1,3 @@
+ALTER TABLE oauth_codes DROP COLUMN auth_time;
+
+ALTER TABLE oauth_codes DROP COLUMN nonce;
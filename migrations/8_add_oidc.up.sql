@@ -0,0 +1,5 @@
+ALTER TABLE oauth_codes
+    ADD COLUMN nonce TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE oauth_codes
+    ADD COLUMN auth_time INTEGER NOT NULL DEFAULT 0;
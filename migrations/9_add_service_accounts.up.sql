@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS service_accounts
+(
+    id          INTEGER PRIMARY KEY,
+    app_id      INTEGER NOT NULL,
+    name        TEXT    NOT NULL,
+    client_id   TEXT    NOT NULL UNIQUE,
+    secret_hash TEXT    NOT NULL,
+    scopes      TEXT    NOT NULL DEFAULT '',
+    created_at  INTEGER NOT NULL,
+    UNIQUE (app_id, name)
+);
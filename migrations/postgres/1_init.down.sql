@@ -0,0 +1,21 @@
+DROP TABLE IF EXISTS passkey_sessions;
+DROP TABLE IF EXISTS passkeys;
+DROP TABLE IF EXISTS relying_parties;
+DROP TABLE IF EXISTS passwordless_challenges;
+DROP TABLE IF EXISTS personal_tokens;
+DROP TABLE IF EXISTS connector_states;
+DROP TABLE IF EXISTS federated_identities;
+DROP TABLE IF EXISTS device_codes;
+DROP TABLE IF EXISTS service_accounts;
+DROP TABLE IF EXISTS oauth_codes;
+DROP TABLE IF EXISTS webhook_deliveries;
+DROP TABLE IF EXISTS webhooks;
+DROP TABLE IF EXISTS outbox;
+DROP TABLE IF EXISTS audit_checkpoints;
+DROP TABLE IF EXISTS audit_log;
+DROP TABLE IF EXISTS erasure_requests;
+DROP TABLE IF EXISTS account_status_history;
+DROP TABLE IF EXISTS user_identifiers;
+DROP TABLE IF EXISTS username_collisions;
+DROP TABLE IF EXISTS apps;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,262 @@
+-- Схема PostgreSQL повторяет итоговую схему миграций sqlite.
+-- Время хранится в наносекундах Unix, как и в sqlite
+CREATE TABLE IF NOT EXISTS users
+(
+    id                 BIGSERIAL PRIMARY KEY,
+    username           TEXT    NOT NULL UNIQUE,
+    username_canonical TEXT,
+    pass_hash          BYTEA   NOT NULL,
+    is_admin           BOOLEAN NOT NULL DEFAULT FALSE,
+    status             TEXT    NOT NULL DEFAULT 'active',
+    status_reason      TEXT    NOT NULL DEFAULT '',
+    suspended_until    BIGINT
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_username_canonical ON users (username_canonical);
+CREATE INDEX IF NOT EXISTS idx_users_suspended_until ON users (suspended_until) WHERE status = 'suspended';
+
+CREATE TABLE IF NOT EXISTS apps
+(
+    id            INTEGER PRIMARY KEY,
+    name          TEXT NOT NULL UNIQUE,
+    secret        TEXT NOT NULL UNIQUE,
+    redirect_uris TEXT NOT NULL DEFAULT '',
+    -- Scope, которые приложение может запрашивать через OAuth, через перевод строки. Пусто - openid и profile
+    scopes        TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS username_collisions
+(
+    user_id        BIGINT PRIMARY KEY,
+    canonical      TEXT   NOT NULL,
+    conflicts_with BIGINT NOT NULL,
+    detected_at    BIGINT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS user_identifiers
+(
+    user_id         BIGINT  NOT NULL,
+    kind            TEXT    NOT NULL,
+    value           TEXT    NOT NULL,
+    canonical       TEXT    NOT NULL,
+    verified_at     BIGINT,
+    code_hash       TEXT    NOT NULL DEFAULT '',
+    attempts        INTEGER NOT NULL DEFAULT 0,
+    code_expires_at BIGINT  NOT NULL DEFAULT 0,
+    created_at      BIGINT  NOT NULL,
+    PRIMARY KEY (user_id, kind)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_user_identifiers_verified ON user_identifiers (kind, canonical) WHERE verified_at IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS account_status_history
+(
+    id              BIGSERIAL PRIMARY KEY,
+    user_id         BIGINT NOT NULL,
+    status          TEXT   NOT NULL,
+    reason          TEXT   NOT NULL,
+    suspended_until BIGINT,
+    actor_id        BIGINT NOT NULL,
+    created_at      BIGINT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_account_status_history_user_id ON account_status_history (user_id);
+
+CREATE TABLE IF NOT EXISTS erasure_requests
+(
+    user_id      BIGINT PRIMARY KEY,
+    actor_id     BIGINT NOT NULL,
+    reason       TEXT   NOT NULL DEFAULT '',
+    requested_at BIGINT NOT NULL,
+    erase_at     BIGINT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_erasure_requests_erase_at ON erasure_requests (erase_at);
+
+-- Id записей аудита назначает хранилище, они идут подряд без пропусков
+CREATE TABLE IF NOT EXISTS audit_log
+(
+    id          BIGINT PRIMARY KEY,
+    event       TEXT   NOT NULL,
+    user_id     BIGINT NOT NULL DEFAULT 0,
+    app_id      BIGINT NOT NULL DEFAULT 0,
+    payload     TEXT   NOT NULL DEFAULT '',
+    created_at  BIGINT NOT NULL,
+    prev_hash   BYTEA  NOT NULL,
+    hash        BYTEA  NOT NULL,
+    redacted_at BIGINT,
+    -- Соли персональных полей payload в JSON
+    field_salts TEXT
+);
+CREATE INDEX IF NOT EXISTS idx_audit_log_user_id ON audit_log (user_id);
+
+CREATE TABLE IF NOT EXISTS audit_checkpoints
+(
+    id         BIGSERIAL PRIMARY KEY,
+    record_id  BIGINT NOT NULL,
+    hash       BYTEA  NOT NULL,
+    signature  BYTEA  NOT NULL,
+    created_at BIGINT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS outbox
+(
+    id           BIGSERIAL PRIMARY KEY,
+    event_type   TEXT    NOT NULL,
+    payload      BYTEA   NOT NULL,
+    created_at   BIGINT  NOT NULL,
+    attempts     INTEGER NOT NULL DEFAULT 0,
+    last_error   TEXT    NOT NULL DEFAULT '',
+    delivered_at BIGINT,
+    -- Раньше этого времени событие после неудачной попытки не публикуется
+    next_attempt_at BIGINT,
+    -- Когда событие перестали доставлять после events.max_attempts неудачных попыток
+    dead_at      BIGINT
+);
+CREATE INDEX IF NOT EXISTS idx_outbox_pending ON outbox (delivered_at, dead_at, id);
+
+CREATE TABLE IF NOT EXISTS webhooks
+(
+    id         BIGSERIAL PRIMARY KEY,
+    app_id     INTEGER NOT NULL,
+    event_type TEXT    NOT NULL,
+    url        TEXT    NOT NULL,
+    created_at BIGINT  NOT NULL,
+    UNIQUE (app_id, event_type, url)
+);
+CREATE INDEX IF NOT EXISTS idx_webhooks_event_type ON webhooks (event_type);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries
+(
+    id              BIGSERIAL PRIMARY KEY,
+    webhook_id      BIGINT  NOT NULL,
+    event_id        BIGINT  NOT NULL,
+    event_type      TEXT    NOT NULL,
+    body            BYTEA   NOT NULL,
+    status          TEXT    NOT NULL DEFAULT 'pending',
+    attempts        INTEGER NOT NULL DEFAULT 0,
+    last_error      TEXT    NOT NULL DEFAULT '',
+    next_attempt_at BIGINT  NOT NULL,
+    created_at      BIGINT  NOT NULL,
+    UNIQUE (webhook_id, event_id)
+);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries (status, next_attempt_at);
+
+CREATE TABLE IF NOT EXISTS oauth_codes
+(
+    code_hash      TEXT PRIMARY KEY,
+    app_id         INTEGER NOT NULL,
+    user_id        BIGINT  NOT NULL,
+    redirect_uri   TEXT    NOT NULL,
+    code_challenge TEXT    NOT NULL,
+    scope          TEXT    NOT NULL DEFAULT '',
+    nonce          TEXT    NOT NULL DEFAULT '',
+    auth_time      BIGINT  NOT NULL DEFAULT 0,
+    expires_at     BIGINT  NOT NULL,
+    created_at     BIGINT  NOT NULL,
+    used           BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+CREATE TABLE IF NOT EXISTS service_accounts
+(
+    id          BIGSERIAL PRIMARY KEY,
+    app_id      INTEGER NOT NULL,
+    name        TEXT    NOT NULL,
+    client_id   TEXT    NOT NULL UNIQUE,
+    secret_hash TEXT    NOT NULL,
+    scopes      TEXT    NOT NULL DEFAULT '',
+    created_at  BIGINT  NOT NULL,
+    UNIQUE (app_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS device_codes
+(
+    device_code_hash TEXT PRIMARY KEY,
+    user_code        TEXT    NOT NULL UNIQUE,
+    app_id           INTEGER NOT NULL,
+    scope            TEXT    NOT NULL DEFAULT '',
+    status           TEXT    NOT NULL DEFAULT 'pending',
+    user_id          BIGINT  NOT NULL DEFAULT 0,
+    "interval"       BIGINT  NOT NULL,
+    last_polled_at   BIGINT  NOT NULL DEFAULT 0,
+    expires_at       BIGINT  NOT NULL,
+    created_at       BIGINT  NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS federated_identities
+(
+    connector_id TEXT   NOT NULL,
+    subject      TEXT   NOT NULL,
+    user_id      BIGINT NOT NULL,
+    created_at   BIGINT NOT NULL,
+    PRIMARY KEY (connector_id, subject)
+);
+CREATE INDEX IF NOT EXISTS idx_federated_identities_user_id ON federated_identities (user_id);
+
+CREATE TABLE IF NOT EXISTS connector_states
+(
+    state_hash    TEXT PRIMARY KEY,
+    connector_id  TEXT   NOT NULL,
+    nonce         TEXT   NOT NULL,
+    code_verifier TEXT   NOT NULL,
+    request       BYTEA  NOT NULL,
+    expires_at    BIGINT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS personal_tokens
+(
+    id           BIGSERIAL PRIMARY KEY,
+    user_id      BIGINT NOT NULL,
+    name         TEXT   NOT NULL,
+    token_hash   TEXT   NOT NULL UNIQUE,
+    scopes       TEXT   NOT NULL DEFAULT '',
+    created_at   BIGINT NOT NULL,
+    expires_at   BIGINT NOT NULL,
+    last_used_at BIGINT NOT NULL DEFAULT 0,
+    UNIQUE (user_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS passwordless_challenges
+(
+    id         TEXT PRIMARY KEY,
+    user_id    BIGINT  NOT NULL,
+    app_id     INTEGER NOT NULL,
+    method     TEXT    NOT NULL,
+    code_hash  TEXT    NOT NULL,
+    attempts   INTEGER NOT NULL DEFAULT 0,
+    expires_at BIGINT  NOT NULL,
+    created_at BIGINT  NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS relying_parties
+(
+    app_id  INTEGER PRIMARY KEY,
+    rp_id   TEXT NOT NULL,
+    name    TEXT NOT NULL,
+    origins TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS passkeys
+(
+    id               BIGSERIAL PRIMARY KEY,
+    user_id          BIGINT  NOT NULL,
+    rp_id            TEXT    NOT NULL,
+    credential_id    BYTEA   NOT NULL UNIQUE,
+    public_key       BYTEA   NOT NULL,
+    attestation_type TEXT    NOT NULL,
+    aaguid           BYTEA   NOT NULL,
+    sign_count       BIGINT  NOT NULL DEFAULT 0,
+    transports       TEXT    NOT NULL DEFAULT '',
+    backup_eligible  BOOLEAN NOT NULL DEFAULT FALSE,
+    name             TEXT    NOT NULL,
+    created_at       BIGINT  NOT NULL,
+    last_used_at     BIGINT  NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS idx_passkeys_user_id ON passkeys (user_id);
+
+CREATE TABLE IF NOT EXISTS passkey_sessions
+(
+    id                TEXT PRIMARY KEY,
+    ceremony          TEXT    NOT NULL,
+    user_id           BIGINT  NOT NULL,
+    app_id            INTEGER NOT NULL,
+    password_verified BOOLEAN NOT NULL DEFAULT FALSE,
+    data              TEXT    NOT NULL,
+    expires_at        BIGINT  NOT NULL
+);
@@ -0,0 +1,201 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v5.28.2
+// source: apps/apps.proto
+
+package appsv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Apps_SetRedirectURIs_FullMethodName = "/apps.Apps/SetRedirectURIs"
+	Apps_SetScopes_FullMethodName       = "/apps.Apps/SetScopes"
+	Apps_SetRelyingParty_FullMethodName = "/apps.Apps/SetRelyingParty"
+)
+
+// AppsClient is the client API for Apps service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type AppsClient interface {
+	SetRedirectURIs(ctx context.Context, in *SetRedirectURIsRequest, opts ...grpc.CallOption) (*SetRedirectURIsResponse, error)
+	// Scope, которые приложение может запрашивать через OAuth. Пустой список - только openid и profile
+	SetScopes(ctx context.Context, in *SetScopesRequest, opts ...grpc.CallOption) (*SetScopesResponse, error)
+	// Настройки WebAuthn приложения, без них ключи в приложении не работают
+	SetRelyingParty(ctx context.Context, in *SetRelyingPartyRequest, opts ...grpc.CallOption) (*SetRelyingPartyResponse, error)
+}
+
+type appsClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewAppsClient(cc grpc.ClientConnInterface) AppsClient {
+	return &appsClient{cc}
+}
+
+func (c *appsClient) SetRedirectURIs(ctx context.Context, in *SetRedirectURIsRequest, opts ...grpc.CallOption) (*SetRedirectURIsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SetRedirectURIsResponse)
+	err := c.cc.Invoke(ctx, Apps_SetRedirectURIs_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *appsClient) SetScopes(ctx context.Context, in *SetScopesRequest, opts ...grpc.CallOption) (*SetScopesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SetScopesResponse)
+	err := c.cc.Invoke(ctx, Apps_SetScopes_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *appsClient) SetRelyingParty(ctx context.Context, in *SetRelyingPartyRequest, opts ...grpc.CallOption) (*SetRelyingPartyResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SetRelyingPartyResponse)
+	err := c.cc.Invoke(ctx, Apps_SetRelyingParty_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// AppsServer is the server API for Apps service.
+// All implementations must embed UnimplementedAppsServer
+// for forward compatibility.
+type AppsServer interface {
+	SetRedirectURIs(context.Context, *SetRedirectURIsRequest) (*SetRedirectURIsResponse, error)
+	// Scope, которые приложение может запрашивать через OAuth. Пустой список - только openid и profile
+	SetScopes(context.Context, *SetScopesRequest) (*SetScopesResponse, error)
+	// Настройки WebAuthn приложения, без них ключи в приложении не работают
+	SetRelyingParty(context.Context, *SetRelyingPartyRequest) (*SetRelyingPartyResponse, error)
+	mustEmbedUnimplementedAppsServer()
+}
+
+// UnimplementedAppsServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedAppsServer struct{}
+
+func (UnimplementedAppsServer) SetRedirectURIs(context.Context, *SetRedirectURIsRequest) (*SetRedirectURIsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetRedirectURIs not implemented")
+}
+func (UnimplementedAppsServer) SetScopes(context.Context, *SetScopesRequest) (*SetScopesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetScopes not implemented")
+}
+func (UnimplementedAppsServer) SetRelyingParty(context.Context, *SetRelyingPartyRequest) (*SetRelyingPartyResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetRelyingParty not implemented")
+}
+func (UnimplementedAppsServer) mustEmbedUnimplementedAppsServer() {}
+func (UnimplementedAppsServer) testEmbeddedByValue()              {}
+
+// UnsafeAppsServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to AppsServer will
+// result in compilation errors.
+type UnsafeAppsServer interface {
+	mustEmbedUnimplementedAppsServer()
+}
+
+func RegisterAppsServer(s grpc.ServiceRegistrar, srv AppsServer) {
+	// If the following call pancis, it indicates UnimplementedAppsServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Apps_ServiceDesc, srv)
+}
+
+func _Apps_SetRedirectURIs_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetRedirectURIsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AppsServer).SetRedirectURIs(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Apps_SetRedirectURIs_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AppsServer).SetRedirectURIs(ctx, req.(*SetRedirectURIsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Apps_SetScopes_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetScopesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AppsServer).SetScopes(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Apps_SetScopes_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AppsServer).SetScopes(ctx, req.(*SetScopesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Apps_SetRelyingParty_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetRelyingPartyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AppsServer).SetRelyingParty(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Apps_SetRelyingParty_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AppsServer).SetRelyingParty(ctx, req.(*SetRelyingPartyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Apps_ServiceDesc is the grpc.ServiceDesc for Apps service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Apps_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "apps.Apps",
+	HandlerType: (*AppsServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "SetRedirectURIs",
+			Handler:    _Apps_SetRedirectURIs_Handler,
+		},
+		{
+			MethodName: "SetScopes",
+			Handler:    _Apps_SetScopes_Handler,
+		},
+		{
+			MethodName: "SetRelyingParty",
+			Handler:    _Apps_SetRelyingParty_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "apps/apps.proto",
+}
@@ -0,0 +1,127 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v5.28.2
+// source: backups/backups.proto
+
+package backupsv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Backups_CreateBackup_FullMethodName = "/backups.Backups/CreateBackup"
+)
+
+// BackupsClient is the client API for Backups service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Резервные копии бд. Доступно только администраторам
+type BackupsClient interface {
+	// Пишет согласованную копию бд в каталог копий на сервере, не останавливая сервис
+	CreateBackup(ctx context.Context, in *CreateBackupRequest, opts ...grpc.CallOption) (*CreateBackupResponse, error)
+}
+
+type backupsClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewBackupsClient(cc grpc.ClientConnInterface) BackupsClient {
+	return &backupsClient{cc}
+}
+
+func (c *backupsClient) CreateBackup(ctx context.Context, in *CreateBackupRequest, opts ...grpc.CallOption) (*CreateBackupResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CreateBackupResponse)
+	err := c.cc.Invoke(ctx, Backups_CreateBackup_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// BackupsServer is the server API for Backups service.
+// All implementations must embed UnimplementedBackupsServer
+// for forward compatibility.
+//
+// Резервные копии бд. Доступно только администраторам
+type BackupsServer interface {
+	// Пишет согласованную копию бд в каталог копий на сервере, не останавливая сервис
+	CreateBackup(context.Context, *CreateBackupRequest) (*CreateBackupResponse, error)
+	mustEmbedUnimplementedBackupsServer()
+}
+
+// UnimplementedBackupsServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedBackupsServer struct{}
+
+func (UnimplementedBackupsServer) CreateBackup(context.Context, *CreateBackupRequest) (*CreateBackupResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateBackup not implemented")
+}
+func (UnimplementedBackupsServer) mustEmbedUnimplementedBackupsServer() {}
+func (UnimplementedBackupsServer) testEmbeddedByValue()                 {}
+
+// UnsafeBackupsServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to BackupsServer will
+// result in compilation errors.
+type UnsafeBackupsServer interface {
+	mustEmbedUnimplementedBackupsServer()
+}
+
+func RegisterBackupsServer(s grpc.ServiceRegistrar, srv BackupsServer) {
+	// If the following call pancis, it indicates UnimplementedBackupsServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Backups_ServiceDesc, srv)
+}
+
+func _Backups_CreateBackup_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateBackupRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BackupsServer).CreateBackup(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Backups_CreateBackup_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BackupsServer).CreateBackup(ctx, req.(*CreateBackupRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Backups_ServiceDesc is the grpc.ServiceDesc for Backups service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Backups_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "backups.Backups",
+	HandlerType: (*BackupsServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "CreateBackup",
+			Handler:    _Backups_CreateBackup_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "backups/backups.proto",
+}
@@ -0,0 +1,201 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v5.28.2
+// source: privacy/privacy.proto
+
+package privacyv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Privacy_ExportUserData_FullMethodName    = "/privacy.Privacy/ExportUserData"
+	Privacy_EraseUser_FullMethodName         = "/privacy.Privacy/EraseUser"
+	Privacy_CancelUserErasure_FullMethodName = "/privacy.Privacy/CancelUserErasure"
+)
+
+// PrivacyClient is the client API for Privacy service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Запросы субъектов данных. Доступно только администраторам
+type PrivacyClient interface {
+	ExportUserData(ctx context.Context, in *ExportUserDataRequest, opts ...grpc.CallOption) (*ExportUserDataResponse, error)
+	EraseUser(ctx context.Context, in *EraseUserRequest, opts ...grpc.CallOption) (*EraseUserResponse, error)
+	CancelUserErasure(ctx context.Context, in *CancelUserErasureRequest, opts ...grpc.CallOption) (*CancelUserErasureResponse, error)
+}
+
+type privacyClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewPrivacyClient(cc grpc.ClientConnInterface) PrivacyClient {
+	return &privacyClient{cc}
+}
+
+func (c *privacyClient) ExportUserData(ctx context.Context, in *ExportUserDataRequest, opts ...grpc.CallOption) (*ExportUserDataResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ExportUserDataResponse)
+	err := c.cc.Invoke(ctx, Privacy_ExportUserData_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *privacyClient) EraseUser(ctx context.Context, in *EraseUserRequest, opts ...grpc.CallOption) (*EraseUserResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(EraseUserResponse)
+	err := c.cc.Invoke(ctx, Privacy_EraseUser_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *privacyClient) CancelUserErasure(ctx context.Context, in *CancelUserErasureRequest, opts ...grpc.CallOption) (*CancelUserErasureResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CancelUserErasureResponse)
+	err := c.cc.Invoke(ctx, Privacy_CancelUserErasure_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// PrivacyServer is the server API for Privacy service.
+// All implementations must embed UnimplementedPrivacyServer
+// for forward compatibility.
+//
+// Запросы субъектов данных. Доступно только администраторам
+type PrivacyServer interface {
+	ExportUserData(context.Context, *ExportUserDataRequest) (*ExportUserDataResponse, error)
+	EraseUser(context.Context, *EraseUserRequest) (*EraseUserResponse, error)
+	CancelUserErasure(context.Context, *CancelUserErasureRequest) (*CancelUserErasureResponse, error)
+	mustEmbedUnimplementedPrivacyServer()
+}
+
+// UnimplementedPrivacyServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedPrivacyServer struct{}
+
+func (UnimplementedPrivacyServer) ExportUserData(context.Context, *ExportUserDataRequest) (*ExportUserDataResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ExportUserData not implemented")
+}
+func (UnimplementedPrivacyServer) EraseUser(context.Context, *EraseUserRequest) (*EraseUserResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method EraseUser not implemented")
+}
+func (UnimplementedPrivacyServer) CancelUserErasure(context.Context, *CancelUserErasureRequest) (*CancelUserErasureResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CancelUserErasure not implemented")
+}
+func (UnimplementedPrivacyServer) mustEmbedUnimplementedPrivacyServer() {}
+func (UnimplementedPrivacyServer) testEmbeddedByValue()                 {}
+
+// UnsafePrivacyServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to PrivacyServer will
+// result in compilation errors.
+type UnsafePrivacyServer interface {
+	mustEmbedUnimplementedPrivacyServer()
+}
+
+func RegisterPrivacyServer(s grpc.ServiceRegistrar, srv PrivacyServer) {
+	// If the following call pancis, it indicates UnimplementedPrivacyServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Privacy_ServiceDesc, srv)
+}
+
+func _Privacy_ExportUserData_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ExportUserDataRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PrivacyServer).ExportUserData(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Privacy_ExportUserData_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PrivacyServer).ExportUserData(ctx, req.(*ExportUserDataRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Privacy_EraseUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EraseUserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PrivacyServer).EraseUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Privacy_EraseUser_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PrivacyServer).EraseUser(ctx, req.(*EraseUserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Privacy_CancelUserErasure_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CancelUserErasureRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PrivacyServer).CancelUserErasure(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Privacy_CancelUserErasure_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PrivacyServer).CancelUserErasure(ctx, req.(*CancelUserErasureRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Privacy_ServiceDesc is the grpc.ServiceDesc for Privacy service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Privacy_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "privacy.Privacy",
+	HandlerType: (*PrivacyServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ExportUserData",
+			Handler:    _Privacy_ExportUserData_Handler,
+		},
+		{
+			MethodName: "EraseUser",
+			Handler:    _Privacy_EraseUser_Handler,
+		},
+		{
+			MethodName: "CancelUserErasure",
+			Handler:    _Privacy_CancelUserErasure_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "privacy/privacy.proto",
+}